@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultBestTimeWindow and maxBestTimeWindow bound how far ahead
+	// /best-time looks. NWS publishes about a week of hourly periods.
+	defaultBestTimeWindow = 48 * time.Hour
+	maxBestTimeWindow     = 168 * time.Hour
+)
+
+// activityProfile is a comfort profile /best-time ranks hours against. It is
+// a score request without a point or time range.
+type activityProfile struct {
+	// Hours is how long the activity lasts, default 1
+	Hours           int         `yaml:"hours"`
+	DaytimeOnly     bool        `yaml:"daytimeOnly"`
+	AvoidConditions []condition `yaml:"avoidConditions"`
+	Rules           []scoreRule `yaml:"rules"`
+}
+
+// bound returns a rule limit
+func bound(v float64) *float64 { return &v }
+
+// builtinActivities are the profiles available without an activities file
+var builtinActivities = map[string]activityProfile{
+	"run": {
+		Hours:           1,
+		AvoidConditions: []condition{conditionThunderstorm, conditionFreezingRain, conditionBlizzard},
+		Rules: []scoreRule{
+			{Field: "temperatureC", Min: bound(5), Max: bound(18), Weight: 2},
+			{Field: "precipitationProbability", Max: bound(30)},
+			{Field: "windSpeedKph", Max: bound(25)},
+		},
+	},
+	"cycle": {
+		Hours:           2,
+		DaytimeOnly:     true,
+		AvoidConditions: []condition{conditionThunderstorm, conditionFreezingRain, conditionSnow, conditionBlizzard},
+		Rules: []scoreRule{
+			{Field: "temperatureC", Min: bound(10), Max: bound(25)},
+			{Field: "precipitationProbability", Max: bound(20), Weight: 2},
+			{Field: "windSpeedKph", Max: bound(20), Weight: 2},
+		},
+	},
+	"hike": {
+		Hours:           4,
+		DaytimeOnly:     true,
+		AvoidConditions: []condition{conditionThunderstorm, conditionBlizzard},
+		Rules: []scoreRule{
+			{Field: "temperatureC", Min: bound(8), Max: bound(24)},
+			{Field: "precipitationProbability", Max: bound(30), Weight: 2},
+			{Field: "windSpeedKph", Max: bound(35)},
+		},
+	},
+	"picnic": {
+		Hours:           2,
+		DaytimeOnly:     true,
+		AvoidConditions: []condition{conditionThunderstorm},
+		Rules: []scoreRule{
+			{Field: "temperatureC", Min: bound(18), Max: bound(28)},
+			{Field: "precipitationProbability", Max: bound(10), Required: true, Weight: 2},
+			{Field: "windSpeedKph", Max: bound(20)},
+		},
+	},
+}
+
+// loadActivityProfiles returns the built-in profiles merged with those of a
+// YAML or JSON file mapping activity names to profiles. A profile in the file
+// replaces a built-in one of the same name.
+func loadActivityProfiles(path string) (map[string]activityProfile, error) {
+	profiles := make(map[string]activityProfile, len(builtinActivities))
+	for name, p := range builtinActivities {
+		profiles[name] = p
+	}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("activities file: %v", err)
+	}
+	var file map[string]activityProfile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("activities file %s: %v", path, err)
+	}
+	for name, p := range file {
+		if _, err := p.request(0, 0, time.Time{}, time.Time{}, 1); err != nil {
+			return nil, fmt.Errorf("activities file %s: %s: %v", path, name, err)
+		}
+		profiles[strings.ToLower(name)] = p
+	}
+	return profiles, nil
+}
+
+// request builds the score request ranking a point's hours from start to end
+// against the profile
+func (p activityProfile) request(lat, lon float64, start, end time.Time, limit int) (*scoreRequest, error) {
+	req := &scoreRequest{
+		Latitude:        lat,
+		Longitude:       lon,
+		Hours:           p.Hours,
+		DaytimeOnly:     p.DaytimeOnly,
+		AvoidConditions: p.AvoidConditions,
+		Rules:           slices.Clone(p.Rules),
+		Limit:           limit,
+	}
+	if !start.IsZero() {
+		req.Start, req.End = &start, &end
+	}
+	return req, req.validate()
+}
+
+// activityProfiles returns the profiles loaded from the configured activities
+// file, or the built-in ones before any are loaded
+func (s *server) activityProfiles() map[string]activityProfile {
+	if p := s.activities.Load(); p != nil {
+		return *p
+	}
+	return builtinActivities
+}
+
+// bestTimeResponse is the body of /best-time
+type bestTimeResponse struct {
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	Activity  string         `json:"activity"`
+	Slots     []scoredWindow `json:"slots"`
+}
+
+// bestTimeHandler ranks the hours of the next ?window= against the comfort
+// profile of ?activity= and returns the best slots
+func (s *server) bestTimeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	activity := strings.ToLower(params.Get("activity"))
+	profiles := s.activityProfiles()
+	profile, ok := profiles[activity]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		http.Error(w, fmt.Sprintf("Invalid activity parameter (want one of %s)", strings.Join(names, ", ")), http.StatusBadRequest)
+		return
+	}
+	window := defaultBestTimeWindow
+	if v := params.Get("window"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil || d < time.Hour || d > maxBestTimeWindow {
+			http.Error(w, "Invalid window parameter (want a duration from 1h to 7d)", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	limit := defaultScoreLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxScoreLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit parameter (want 1 to %d)", maxScoreLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	latitude, longitude := parsePoint(lat, lon)
+	// Start from the current hour, which is still partly ahead
+	start := s.clock.Now().Truncate(time.Hour)
+	req, err := profile.request(latitude, longitude, start, start.Add(window), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+
+	resp := bestTimeResponse{Latitude: latitude, Longitude: longitude, Activity: activity}
+	_, resp.Slots = req.scoreWindows(periods)
+	if err := req.err(); err != nil {
+		log.Printf("Failed to score activity %s: %v", activity, err)
+		http.Error(w, "Failed to score activity", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuiltinActivities tests that every built-in profile is a valid score request
+func TestBuiltinActivities(t *testing.T) {
+	for name, p := range builtinActivities {
+		if _, err := p.request(47.6, -122.3, time.Time{}, time.Time{}, 1); err != nil {
+			t.Errorf("expected %s to be valid, got %v", name, err)
+		}
+	}
+}
+
+// TestLoadActivityProfiles tests adding and replacing profiles from a file
+func TestLoadActivityProfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		expectErr string
+	}{
+		{name: "added and replaced", file: `
+Kayak:
+  hours: 3
+  daytimeOnly: true
+  rules:
+    - {field: windSpeedKph, max: 15, required: true}
+run:
+  rules:
+    - {field: temperatureC, min: 0, max: 10}
+`},
+		{name: "json", file: `{"kayak": {"hours": 3, "rules": [{"field": "windSpeedKph", "max": 15}]}}`},
+		{name: "unknown field", file: "kayak:\n  rules:\n    - {field: humidity, max: 80}\n", expectErr: `kayak: unknown field "humidity"`},
+		{name: "no rules", file: "kayak:\n  hours: 2\n", expectErr: "at least one rule"},
+		{name: "not a mapping", file: "- kayak\n", expectErr: "activities file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "activities.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			profiles, err := loadActivityProfiles(path)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Errorf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kayak := profiles["kayak"]; kayak.Hours != 3 || len(kayak.Rules) != 1 || *kayak.Rules[0].Max != 15 {
+				t.Errorf("unexpected kayak profile %+v", kayak)
+			}
+			if _, ok := profiles["hike"]; !ok {
+				t.Error("expected the built-in profiles to remain")
+			}
+		})
+	}
+	if _, err := loadActivityProfiles(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected a missing file to be an error")
+	}
+}
+
+// TestBestTimeHandler tests ranking upcoming hours for an activity
+func TestBestTimeHandler(t *testing.T) {
+	// Hours from 06:00 UTC; the run profile prefers 5 to 18°C, and the hour
+	// from 06:00 has passed
+	var periods []string
+	for i, f := range []int{50, 30, 55, 60, 75, 90} {
+		start := time.Date(2024, 6, 1, 6+i, 0, 0, 0, time.UTC)
+		periods = append(periods, fmt.Sprintf(`{"startTime": %q, "endTime": %q, "isDaytime": true, "shortForecast": "Sunny", "temperature": %d, "temperatureUnit": "F", "windSpeed": "5 mph", "probabilityOfPrecipitation": {"value": 0}}`,
+			start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), f))
+	}
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hourly-url" {
+			w.Write([]byte(`{"properties": {"periods": [` + strings.Join(periods, ",") + `]}}`))
+			return
+		}
+		w.Write([]byte(`{"properties": {"forecastHourly": "http://` + r.Host + `/hourly-url"}}`))
+	}))
+	defer mockNWS.Close()
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.clock = newFakeClock(time.Date(2024, 6, 1, 7, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedStarts []int
+	}{
+		{name: "run", query: "&activity=run&limit=2", expectedStatus: 200, expectedStarts: []int{8, 9}},
+		{name: "short window", query: "&activity=Run&window=2h&limit=2", expectedStatus: 200, expectedStarts: []int{8, 7}},
+		{name: "window past the forecast", query: "&activity=run&window=7d&limit=5", expectedStatus: 200, expectedStarts: []int{8, 9, 7, 10, 11}},
+		{name: "unknown activity", query: "&activity=curling", expectedStatus: 400},
+		{name: "missing activity", query: "", expectedStatus: 400},
+		{name: "bad window", query: "&activity=run&window=30d", expectedStatus: 400},
+		{name: "bad limit", query: "&activity=run&limit=0", expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/best-time?latitude=47.6062&longitude=-122.3321"+tt.query, nil)
+			w := httptest.NewRecorder()
+			srv.bestTimeHandler(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body)
+			}
+			if w.Code != 200 {
+				return
+			}
+			var resp bestTimeResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			var starts []int
+			for _, slot := range resp.Slots {
+				starts = append(starts, slot.Start.UTC().Hour())
+			}
+			if fmt.Sprint(starts) != fmt.Sprint(tt.expectedStarts) {
+				t.Errorf("expected slots starting at %v, got %v", tt.expectedStarts, starts)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Why an alert is notified
+const (
+	alertNew       = "new"
+	alertUpgraded  = "upgraded"
+	alertChanged   = "changed"
+	alertCancelled = "cancelled"
+)
+
+// alertShift is how far an update must move an alert's onset or end to be
+// notified as changed; NWS reissues alerts with times trimmed by minutes
+const alertShift = time.Hour
+
+// alertsNotified counts alert notifications sent or held for subscribers
+var alertsNotified = expvar.NewInt("forecast_alerts_notified")
+
+// severityRank orders CAP severities, with Unknown and anything unrecognized
+// lowest
+func severityRank(severity string) int {
+	return slices.Index([]string{"Minor", "Moderate", "Severe", "Extreme"}, severity) + 1
+}
+
+// eventRank orders alert events by their NWS suffix, so a Winter Storm Watch
+// becoming a Winter Storm Warning is an upgrade
+func eventRank(event string) int {
+	for i, suffix := range []string{"Emergency", "Warning", "Watch", "Advisory", "Statement"} {
+		if strings.HasSuffix(event, suffix) {
+			return 5 - i
+		}
+	}
+	return 0
+}
+
+// classifyAlert returns why an alert is notified, given the earlier version it
+// updates or nil when none was seen, or "" when it isn't worth notifying.
+// Reissues that only reword the headline or nudge times are not.
+func classifyAlert(alert Alert, previous *Alert) string {
+	if previous == nil {
+		if alert.MessageType == "Cancel" {
+			return ""
+		}
+		return alertNew
+	}
+	if alert.MessageType == "Cancel" {
+		return alertCancelled
+	}
+	if severityRank(alert.Severity) > severityRank(previous.Severity) ||
+		(alert.Event != previous.Event && eventRank(alert.Event) > eventRank(previous.Event)) {
+		return alertUpgraded
+	}
+	if alert.Event != previous.Event || alert.Severity != previous.Severity ||
+		alert.Onset.Sub(previous.Onset).Abs() >= alertShift || alert.Ends.Sub(previous.Ends).Abs() >= alertShift {
+		return alertChanged
+	}
+	for _, zone := range alert.Zones {
+		if !slices.Contains(previous.Zones, zone) {
+			return alertChanged
+		}
+	}
+	return ""
+}
+
+// alertUpdate is the body of an alert notification. Previous is the earlier
+// version of the alert that was updated or cancelled.
+type alertUpdate struct {
+	Change   string `json:"change"`
+	Alert    Alert  `json:"alert"`
+	Previous *Alert `json:"previous,omitempty"`
+}
+
+// saveAlert saves an alert the poller fetched, returning the update to notify
+// or nil when it was seen before or isn't worth notifying. The earlier version
+// is the latest saved alert among its references.
+func (s *server) saveAlert(ctx context.Context, alert Alert) (*alertUpdate, error) {
+	_, err := s.store.GetAlert(ctx, alert.ID)
+	if err == nil {
+		return nil, s.store.SaveAlert(ctx, &alert)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	var previous *Alert
+	for _, id := range alert.References {
+		ref, err := s.store.GetAlert(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil || ref.Sent.After(previous.Sent) {
+			previous = ref
+		}
+	}
+	if err := s.store.SaveAlert(ctx, &alert); err != nil {
+		return nil, err
+	}
+	change := classifyAlert(alert, previous)
+	if change == "" {
+		return nil, nil
+	}
+	return &alertUpdate{Change: change, Alert: alert, Previous: previous}, nil
+}
+
+// notifyAlert sends an alert update to subscriptions as the event
+// "alert.<change>", as each subscription's escalation rules decide
+func (s *server) notifyAlert(ctx context.Context, subs []Subscription, update *alertUpdate) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("Failed to encode alert %s: %v", update.Alert.ID, err)
+		return
+	}
+	for _, sub := range subs {
+		d := &Delivery{Event: "alert." + update.Change, ContentType: "application/json", Body: body}
+		var err error
+		switch escalate(sub.Escalation, update) {
+		case escalateDrop:
+			continue
+		case escalateImmediate:
+			err = s.deliver(ctx, sub, d)
+		case escalateDigest:
+			err = s.hold(ctx, sub, d)
+		default:
+			err = s.notify(ctx, sub, d)
+		}
+		if err != nil {
+			log.Printf("Failed to notify alert %s: %v", update.Alert.ID, err)
+			continue
+		}
+		alertsNotified.Add(1)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestClassifyAlert tests which alert updates are worth notifying
+func TestClassifyAlert(t *testing.T) {
+	now := time.Date(2024, 12, 10, 0, 0, 0, 0, time.UTC)
+	watch := Alert{ID: "1", Event: "Winter Storm Watch", Severity: "Severe", Zones: []string{"WAZ558"}, Onset: now, Ends: now.Add(18 * time.Hour)}
+	update := func(f func(*Alert)) Alert {
+		a := watch
+		a.ID, a.MessageType, a.Headline = "2", "Update", "Reworded"
+		f(&a)
+		return a
+	}
+	tests := []struct {
+		name     string
+		alert    Alert
+		previous *Alert
+		expected string
+	}{
+		{name: "first seen", alert: watch, expected: alertNew},
+		{name: "cancel of an unseen alert", alert: Alert{MessageType: "Cancel"}},
+		{name: "reissued", alert: update(func(a *Alert) {}), previous: &watch},
+		{name: "end trimmed", alert: update(func(a *Alert) { a.Ends = a.Ends.Add(-15 * time.Minute) }), previous: &watch},
+		{name: "end extended", alert: update(func(a *Alert) { a.Ends = a.Ends.Add(6 * time.Hour) }), previous: &watch, expected: alertChanged},
+		{name: "watch to warning", alert: update(func(a *Alert) { a.Event = "Winter Storm Warning" }), previous: &watch, expected: alertUpgraded},
+		{name: "more severe", alert: update(func(a *Alert) { a.Severity = "Extreme" }), previous: &watch, expected: alertUpgraded},
+		{name: "downgraded", alert: update(func(a *Alert) { a.Event, a.Severity = "Winter Weather Advisory", "Moderate" }), previous: &watch, expected: alertChanged},
+		{name: "zone added", alert: update(func(a *Alert) { a.Zones = []string{"WAZ558", "WAZ559"} }), previous: &watch, expected: alertChanged},
+		{name: "zone dropped", alert: update(func(a *Alert) { a.Zones = nil }), previous: &watch},
+		{name: "cancelled", alert: update(func(a *Alert) { a.MessageType = "Cancel" }), previous: &watch, expected: alertCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyAlert(tt.alert, tt.previous); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestAlertSequence tests notifying a recorded sequence of NWS updates to a
+// winter storm, from the watch being issued to the warning being cancelled
+func TestAlertSequence(t *testing.T) {
+	data, err := os.ReadFile("testdata/alerts/winter_storm.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var polls []json.RawMessage
+	if err := json.Unmarshal(data, &polls); err != nil {
+		t.Fatal(err)
+	}
+
+	poll := 0
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(polls[poll])
+	}))
+	defer mockNWS.Close()
+	var updates []alertUpdate
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u alertUpdate
+		json.NewDecoder(r.Body).Decode(&u)
+		if r.Header.Get("X-Forecast-Event") != "alert."+u.Change {
+			t.Errorf("unexpected event %q for %q", r.Header.Get("X-Forecast-Event"), u.Change)
+		}
+		updates = append(updates, u)
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+	ctx := context.Background()
+	if err := srv.store.CreateSubscription(ctx, &Subscription{Owner: "alice", Latitude: 47.6062, Longitude: -122.3321, WebhookURL: hook.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watch, a repeat of it, a reworded reissue, the upgrade to a
+	// warning, its extension, and its cancellation
+	expected := []string{alertNew, "", "", alertUpgraded, alertChanged, alertCancelled}
+	for ; poll < len(polls); poll++ {
+		before := len(updates)
+		if _, err := srv.pollAlertsOnce(ctx); err != nil {
+			t.Fatalf("poll %d failed: %v", poll, err)
+		}
+		got := ""
+		if len(updates) > before+1 {
+			t.Fatalf("poll %d: expected at most one notification, got %+v", poll, updates[before:])
+		}
+		if len(updates) > before {
+			got = updates[before].Change
+		}
+		if got != expected[poll] {
+			t.Errorf("poll %d: expected %q, got %q", poll, expected[poll], got)
+		}
+	}
+	if len(updates) == 4 {
+		if upgrade := updates[1]; upgrade.Previous == nil || upgrade.Previous.ID != "urn:oid:2.49.0.1.840.0.ws2" {
+			t.Errorf("expected the upgrade to name the latest version it updates, got %+v", upgrade.Previous)
+		}
+	}
+}
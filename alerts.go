@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAlertHistory is how far back /alerts/history looks without ?since=
+	defaultAlertHistory = 30 * 24 * time.Hour
+	defaultAlertLimit   = 50
+	maxAlertLimit       = 500
+)
+
+var (
+	// alertsSaved counts alerts written by the poller, including updates
+	alertsSaved = expvar.NewInt("forecast_alerts_saved")
+	// alertPollErrors counts points whose active alerts couldn't be fetched
+	alertPollErrors = expvar.NewInt("forecast_alert_poll_errors")
+)
+
+// zonePattern matches NWS UGC codes for forecast zones (WAZ558) and counties
+// (WAC033)
+var zonePattern = regexp.MustCompile(`^[A-Z]{2}[CZ][0-9]{3}$`)
+
+// parseAlerts reads an NWS alerts response. Alerts without an onset begin when
+// they take effect, and those without an end last until they expire.
+func parseAlerts(body []byte) ([]Alert, error) {
+	var resp struct {
+		Features []struct {
+			Properties struct {
+				ID       string `json:"id"`
+				AreaDesc string `json:"areaDesc"`
+				Geocode  struct {
+					UGC []string `json:"UGC"`
+				} `json:"geocode"`
+				Sent      time.Time  `json:"sent"`
+				Effective time.Time  `json:"effective"`
+				Onset     *time.Time `json:"onset"`
+				Expires   time.Time  `json:"expires"`
+				Ends      *time.Time `json:"ends"`
+				Severity  string     `json:"severity"`
+				Event     string     `json:"event"`
+				Headline  string     `json:"headline"`
+				// MessageType is Alert, Update, or Cancel
+				MessageType string `json:"messageType"`
+				References  []struct {
+					Identifier string `json:"identifier"`
+				} `json:"references"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(resp.Features))
+	for _, f := range resp.Features {
+		p := f.Properties
+		if p.ID == "" {
+			continue
+		}
+		alert := Alert{
+			ID:          p.ID,
+			Event:       p.Event,
+			Severity:    p.Severity,
+			Headline:    p.Headline,
+			AreaDesc:    p.AreaDesc,
+			Zones:       p.Geocode.UGC,
+			Sent:        p.Sent,
+			Onset:       p.Effective,
+			Ends:        p.Expires,
+			Expires:     p.Expires,
+			MessageType: p.MessageType,
+		}
+		for _, ref := range p.References {
+			alert.References = append(alert.References, ref.Identifier)
+		}
+		if p.Onset != nil {
+			alert.Onset = *p.Onset
+		}
+		if p.Ends != nil {
+			alert.Ends = *p.Ends
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// alertPoints returns the distinct points of every subscription and saved
+// location, formatted for the NWS alerts API, and the subscriptions at each
+func alertPoints(ctx context.Context, store Store) ([]string, map[string][]Subscription, error) {
+	subs, err := store.ListSubscriptions(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	locs, err := store.ListLocations(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var points []string
+	seen := make(map[string]bool)
+	add := func(lat, lon float64) string {
+		p := nwsPoint(lat, lon)
+		if !seen[p] {
+			seen[p] = true
+			points = append(points, p)
+		}
+		return p
+	}
+	subsAt := make(map[string][]Subscription)
+	for _, sub := range subs {
+		p := add(sub.Latitude, sub.Longitude)
+		subsAt[p] = append(subsAt[p], sub)
+	}
+	for _, loc := range locs {
+		add(loc.Latitude, loc.Longitude)
+	}
+	return points, subsAt, nil
+}
+
+// nwsPoint formats a point for the NWS alerts API, which accepts at most four
+// decimal places
+func nwsPoint(lat, lon float64) string {
+	return strconv.FormatFloat(lat, 'f', 4, 64) + "," + strconv.FormatFloat(lon, 'f', 4, 64)
+}
+
+// activeAlerts fetches the alerts in effect at a point formatted by nwsPoint
+func (s *server) activeAlerts(ctx context.Context, point string) ([]Alert, error) {
+	body, _, _, err := s.makeNWSRequest(ctx, s.state.Config().NWSAPIHost+"/alerts/active?point="+url.QueryEscape(point))
+	if err != nil {
+		return nil, err
+	}
+	return parseAlerts(body)
+}
+
+// activeAlertsResponse is the body of /alerts
+type activeAlertsResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Alerts    []Alert `json:"alerts"`
+}
+
+// activeAlertsHandler serves the watches, warnings, and advisories in effect
+// at a point, most severe first, so clients can show a hurricane warning
+// alongside the forecast. Cancellations are left out.
+func (s *server) activeAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	latitude, errLat := strconv.ParseFloat(lat, 64)
+	longitude, errLon := strconv.ParseFloat(lon, 64)
+	if errLat != nil || errLon != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		http.Error(w, "Invalid latitude or longitude parameter", http.StatusBadRequest)
+		return
+	}
+
+	body, _, statusCode, err := s.makeNWSRequest(r.Context(), s.state.Config().NWSAPIHost+"/alerts/active?point="+url.QueryEscape(nwsPoint(latitude, longitude)))
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	alerts, err := parseAlerts(body)
+	if err != nil {
+		http.Error(w, "Failed to parse alerts response", http.StatusInternalServerError)
+		return
+	}
+
+	resp := activeAlertsResponse{Latitude: latitude, Longitude: longitude, Alerts: []Alert{}}
+	for _, alert := range alerts {
+		if alert.MessageType != "Cancel" {
+			resp.Alerts = append(resp.Alerts, alert)
+		}
+	}
+	slices.SortStableFunc(resp.Alerts, func(a, b Alert) int {
+		return severityRank(b.Severity) - severityRank(a.Severity)
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// pollAlertsOnce saves the active alerts for the point of every subscription
+// and saved location, returning how many distinct alerts were saved. Alerts
+// that are new, upgraded, or materially changed are notified to the
+// subscriptions at their points. A point that fails is logged and skipped.
+func (s *server) pollAlertsOnce(ctx context.Context) (int, error) {
+	points, subsAt, err := alertPoints(ctx, s.store)
+	if err != nil {
+		return 0, err
+	}
+
+	nwsHost := s.state.Config().NWSAPIHost
+	saved := make(map[string]*alertUpdate)
+	for _, point := range points {
+		body, _, _, err := s.makeNWSRequest(ctx, nwsHost+"/alerts/active?point="+url.QueryEscape(point))
+		if err == nil {
+			var alerts []Alert
+			if alerts, err = parseAlerts(body); err == nil {
+				for i := range alerts {
+					update, ok := saved[alerts[i].ID]
+					if !ok {
+						if update, err = s.saveAlert(ctx, alerts[i]); err != nil {
+							return len(saved), err
+						}
+						saved[alerts[i].ID] = update
+						alertsSaved.Add(1)
+					}
+					if update != nil {
+						s.notifyAlert(ctx, subsAt[point], update)
+					}
+				}
+			}
+		}
+		if err != nil {
+			alertPollErrors.Add(1)
+			log.Printf("Failed to poll alerts for %s: %v", point, err)
+		}
+	}
+	return len(saved), nil
+}
+
+// alertPollJob saves and notifies the active alerts for subscribed and saved
+// points every AlertPollInterval, starting at startup. The interval is re-read
+// each run so reloads take effect.
+func (s *server) alertPollJob() *job {
+	return &job{
+		name: "alert-poll",
+		schedule: func() (jobSchedule, error) {
+			return everySchedule(s.state.Config().AlertPollInterval), nil
+		},
+		run: func(ctx context.Context) error {
+			// Each poll is traced on its own, like scheduled reports
+			trace := newTrace()
+			_, err := s.pollAlertsOnce(withTrace(ctx, trace))
+			if err != nil {
+				log.Printf("Alert polling failed (request %s): %v", trace.RequestID, err)
+			}
+			return err
+		},
+		runAtStart: true,
+	}
+}
+
+// encodeAlertCursor returns the opaque cursor resuming after alert
+func encodeAlertCursor(alert Alert) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(alert.Sent.Unix(), 10) + ":" + alert.ID))
+}
+
+// decodeAlertCursor reads a cursor made by encodeAlertCursor into q
+func decodeAlertCursor(cursor string, q *AlertQuery) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return fmt.Errorf("Invalid cursor parameter")
+	}
+	sent, id, ok := strings.Cut(string(b), ":")
+	unix, err := strconv.ParseInt(sent, 10, 64)
+	if !ok || err != nil || id == "" {
+		return fmt.Errorf("Invalid cursor parameter")
+	}
+	q.AfterSent, q.AfterID = time.Unix(unix, 0).UTC(), id
+	return nil
+}
+
+// parseAlertQuery reads the zone, since, limit, and cursor parameters of
+// /alerts/history. Since is a time or a duration back from now, such as 14d.
+func parseAlertQuery(r *http.Request, now time.Time) (AlertQuery, error) {
+	params := r.URL.Query()
+	q := AlertQuery{
+		Zone:  strings.ToUpper(params.Get("zone")),
+		Since: now.Add(-defaultAlertHistory),
+		Limit: defaultAlertLimit,
+	}
+	if q.Zone == "" {
+		return q, fmt.Errorf("Missing zone parameter")
+	}
+	if !zonePattern.MatchString(q.Zone) {
+		return q, fmt.Errorf("Invalid zone parameter (want a UGC code such as WAZ558)")
+	}
+	if v := params.Get("since"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			q.Since = t
+		} else if d, err := parseDuration(v); err == nil {
+			q.Since = now.Add(-d)
+		} else {
+			return q, fmt.Errorf("Invalid since parameter (want an RFC 3339 time or a duration such as 14d)")
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAlertLimit {
+			return q, fmt.Errorf("Invalid limit parameter (want 1 to %d)", maxAlertLimit)
+		}
+		q.Limit = n
+	}
+	if v := params.Get("cursor"); v != "" {
+		if err := decodeAlertCursor(v, &q); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// alertHistoryResponse is the body of /alerts/history. NextCursor is set when
+// there are more alerts to fetch.
+type alertHistoryResponse struct {
+	Zone       string    `json:"zone"`
+	Since      time.Time `json:"since"`
+	Alerts     []Alert   `json:"alerts"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// alertHistoryHandler serves the alerts the poller saw for a zone, oldest
+// first, a page at a time
+func (s *server) alertHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseAlertQuery(r, s.clock.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch one extra alert to learn whether there is another page
+	limit := q.Limit
+	q.Limit++
+	alerts, err := s.store.ListAlerts(r.Context(), q)
+	if err != nil {
+		log.Printf("Failed to list alerts: %v", err)
+		http.Error(w, "Failed to list alerts", http.StatusInternalServerError)
+		return
+	}
+
+	resp := alertHistoryResponse{Zone: q.Zone, Since: q.Since.UTC(), Alerts: alerts}
+	if len(alerts) > limit {
+		resp.Alerts = alerts[:limit]
+		resp.NextCursor = encodeAlertCursor(resp.Alerts[limit-1])
+	}
+	if resp.Alerts == nil {
+		resp.Alerts = []Alert{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAlertsResponse = `{"features": [
+	{"properties": {
+		"id": "urn:oid:2.49.0.1.840.0.1", "areaDesc": "Seattle and Vicinity",
+		"geocode": {"UGC": ["WAZ558", "WAC033"]},
+		"sent": "2024-11-19T08:00:00-08:00", "effective": "2024-11-19T08:00:00-08:00",
+		"onset": "2024-11-19T16:00:00-08:00", "expires": "2024-11-19T20:00:00-08:00",
+		"ends": "2024-11-20T10:00:00-08:00",
+		"severity": "Moderate", "event": "Wind Advisory", "headline": "Wind Advisory until Wednesday"
+	}},
+	{"properties": {
+		"id": "urn:oid:2.49.0.1.840.0.2", "areaDesc": "Seattle and Vicinity",
+		"geocode": {"UGC": ["WAZ558"]},
+		"sent": "2024-11-19T09:00:00-08:00", "effective": "2024-11-19T09:00:00-08:00",
+		"onset": null, "expires": "2024-11-19T18:00:00-08:00", "ends": null,
+		"severity": "Minor", "event": "Special Weather Statement"
+	}}
+]}`
+
+// TestParseAlerts tests reading NWS alerts, falling back to the effective and
+// expiry times when an alert has no onset or end
+func TestParseAlerts(t *testing.T) {
+	alerts, err := parseAlerts([]byte(testAlertsResponse))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(alerts))
+	}
+
+	wind := alerts[0]
+	if wind.Event != "Wind Advisory" || wind.Severity != "Moderate" || len(wind.Zones) != 2 || wind.Zones[1] != "WAC033" {
+		t.Errorf("unexpected alert %+v", wind)
+	}
+	if !wind.Onset.Equal(time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)) || !wind.Ends.Equal(time.Date(2024, 11, 20, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the onset and end, got %v and %v", wind.Onset, wind.Ends)
+	}
+
+	statement := alerts[1]
+	if !statement.Onset.Equal(statement.Sent) || !statement.Ends.Equal(time.Date(2024, 11, 20, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the effective and expiry times, got %v and %v", statement.Onset, statement.Ends)
+	}
+
+	if _, err := parseAlerts([]byte(`{"features": "none"}`)); err == nil {
+		t.Error("expected an error for a malformed response")
+	}
+}
+
+// TestPollAlertsOnce tests saving the active alerts for each subscribed or
+// saved point once, even when points share alerts, and notifying subscribers
+// of new ones
+func TestPollAlertsOnce(t *testing.T) {
+	var points []string
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		points = append(points, r.URL.Query().Get("point"))
+		w.Write([]byte(testAlertsResponse))
+	}))
+	defer mockNWS.Close()
+
+	var events []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, r.Header.Get("X-Forecast-Event"))
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	store := newTestStore(t)
+	srv.store = store
+	ctx := context.Background()
+	if err := store.CreateSubscription(ctx, &Subscription{Owner: "alice", Latitude: 47.6062, Longitude: -122.3321, WebhookURL: hook.URL}); err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []*Location{
+		{Owner: "alice", Name: "Home", Latitude: 47.60621, Longitude: -122.33209},
+		{Owner: "bob", Name: "Office", Latitude: 47.6205, Longitude: -122.3493},
+	} {
+		if err := store.CreateLocation(ctx, loc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := srv.pollAlertsOnce(ctx)
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if saved != 2 {
+		t.Errorf("expected 2 alerts saved, got %d", saved)
+	}
+	// Points that round to the same place are only polled once
+	if len(points) != 2 || points[0] != "47.6062,-122.3321" || points[1] != "47.6205,-122.3493" {
+		t.Errorf("unexpected points polled %v", points)
+	}
+
+	// Only the subscription is notified, once for each new alert
+	if len(events) != 2 || events[0] != "alert.new" || events[1] != "alert.new" {
+		t.Errorf("expected two new alert notifications, got %v", events)
+	}
+	if _, err := srv.pollAlertsOnce(ctx); err != nil || len(events) != 2 {
+		t.Errorf("expected alerts seen before not to be notified again, got %v (%v)", events, err)
+	}
+
+	alerts, err := store.ListAlerts(ctx, AlertQuery{Zone: "WAC033", Limit: 10})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Event != "Wind Advisory" {
+		t.Errorf("expected the wind advisory, got %+v", alerts)
+	}
+}
+
+// TestParseAlertQuery tests the parameters of /alerts/history
+func TestParseAlertQuery(t *testing.T) {
+	now := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	cursor := encodeAlertCursor(Alert{ID: "urn:oid:1", Sent: now.Add(-time.Hour)})
+	tests := []struct {
+		query       string
+		expected    AlertQuery
+		expectError bool
+	}{
+		{query: "zone=waz558", expected: AlertQuery{Zone: "WAZ558", Since: now.Add(-30 * 24 * time.Hour), Limit: 50}},
+		{query: "zone=WAC033&since=14d&limit=5", expected: AlertQuery{Zone: "WAC033", Since: now.Add(-14 * 24 * time.Hour), Limit: 5}},
+		{query: "zone=WAZ558&since=2024-11-01T00:00:00Z", expected: AlertQuery{Zone: "WAZ558", Since: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), Limit: 50}},
+		{query: "zone=WAZ558&cursor=" + cursor, expected: AlertQuery{Zone: "WAZ558", Since: now.Add(-30 * 24 * time.Hour), Limit: 50, AfterSent: now.Add(-time.Hour), AfterID: "urn:oid:1"}},
+		{query: "", expectError: true},
+		{query: "zone=Seattle", expectError: true},
+		{query: "zone=WAZ558&since=last+week", expectError: true},
+		{query: "zone=WAZ558&limit=0", expectError: true},
+		{query: "zone=WAZ558&cursor=not-a-cursor", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseAlertQuery(httptest.NewRequest("GET", "/alerts/history?"+tt.query, nil), now)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if q != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, q)
+			}
+		})
+	}
+}
+
+// TestAlertHistoryHandler tests paging through the alerts for a zone
+func TestAlertHistoryHandler(t *testing.T) {
+	srv := newServer(defaultConfig())
+	srv.store = newTestStore(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, event := range []string{"Flood Watch", "Flood Warning", "Wind Advisory"} {
+		alert := &Alert{ID: event, Event: event, Zones: []string{"WAZ558"}, Sent: now.Add(time.Duration(i-3) * time.Hour), Ends: now}
+		if err := srv.store.SaveAlert(ctx, alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []string
+	path := "/alerts/history?zone=WAZ558&limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("expected paging to end")
+		}
+		w := httptest.NewRecorder()
+		srv.alertHistoryHandler(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp alertHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range resp.Alerts {
+			events = append(events, a.Event)
+		}
+		path = ""
+		if resp.NextCursor != "" {
+			path = "/alerts/history?zone=WAZ558&limit=2&cursor=" + resp.NextCursor
+		}
+	}
+	if len(events) != 3 || events[0] != "Flood Watch" || events[2] != "Wind Advisory" {
+		t.Errorf("expected every alert oldest first, got %v", events)
+	}
+
+	w := httptest.NewRecorder()
+	srv.alertHistoryHandler(w, httptest.NewRequest("GET", "/alerts/history", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without a zone, got %d", w.Code)
+	}
+}
+
+// TestActiveAlertsHandler tests serving the alerts in effect at a point, most
+// severe first and without cancellations
+func TestActiveAlertsHandler(t *testing.T) {
+	cancel := `{"properties": {"id": "urn:oid:2.49.0.1.840.0.3", "messageType": "Cancel", "severity": "Severe", "event": "Flood Warning",
+		"sent": "2024-11-19T10:00:00-08:00", "effective": "2024-11-19T10:00:00-08:00", "expires": "2024-11-19T11:00:00-08:00"}}`
+	body := strings.Replace(testAlertsResponse, "\n]}", ",\n"+cancel+"\n]}", 1)
+	tests := []struct {
+		name           string
+		query          string
+		nws            fakeResponse
+		expectedStatus int
+		expectedEvents []string
+	}{
+		{name: "active", query: "latitude=47.60621&longitude=-122.3321", nws: fakeResponse{body: body}, expectedStatus: http.StatusOK, expectedEvents: []string{"Wind Advisory", "Special Weather Statement"}},
+		{name: "none", query: "latitude=47.6062&longitude=-122.3321", nws: fakeResponse{body: `{"features": []}`}, expectedStatus: http.StatusOK, expectedEvents: []string{}},
+		{name: "missing point", query: "latitude=47.6062", expectedStatus: http.StatusBadRequest},
+		{name: "invalid point", query: "latitude=147.6062&longitude=-122.3321", expectedStatus: http.StatusBadRequest},
+		{name: "unavailable", query: "latitude=47.6062&longitude=-122.3321", nws: fakeResponse{status: http.StatusServiceUnavailable}, expectedStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nws := newFakeDoer(map[string]fakeResponse{"/alerts/active": tt.nws})
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			srv.nws = nws
+			w := httptest.NewRecorder()
+			srv.activeAlertsHandler(w, httptest.NewRequest("GET", "/alerts?"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if got := nws.requests[0].URL.Query().Get("point"); got != "47.6062,-122.3321" {
+				t.Errorf("expected the point to four places, got %q", got)
+			}
+			var resp activeAlertsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			events := []string{}
+			for _, a := range resp.Alerts {
+				events = append(events, a.Event)
+			}
+			if strings.Join(events, ",") != strings.Join(tt.expectedEvents, ",") {
+				t.Errorf("expected alerts %v, got %v", tt.expectedEvents, events)
+			}
+			if len(resp.Alerts) > 0 && !resp.Alerts[0].Expires.Equal(time.Date(2024, 11, 20, 4, 0, 0, 0, time.UTC)) {
+				t.Errorf("expected the expiry time, got %v", resp.Alerts[0].Expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// allForecast is the forecast of one prefetch location in GET /forecast/all
+type allForecast struct {
+	Name string `json:"name"`
+	batchForecast
+}
+
+// allForecastsResponse is the body of GET /forecast/all, in the order the
+// prefetch file lists the locations
+type allForecastsResponse struct {
+	Forecasts []allForecast `json:"forecasts"`
+}
+
+// snapshotForecasts builds the forecasts of the prefetch locations from the
+// NWS cache alone. The forecasts are read from the cache at once, so a
+// prefetch refreshing them meanwhile can't leave some old and some new.
+// Locations whose forecast isn't cached, such as one whose first prefetch
+// failed, come with an error in place of their forecast.
+func (s *server) snapshotForecasts() allForecastsResponse {
+	locations := s.prefetchLocations()
+	resp := allForecastsResponse{Forecasts: make([]allForecast, len(locations))}
+	forecastURLs := make([]string, len(locations))
+	for i, l := range locations {
+		resp.Forecasts[i] = allForecast{Name: l.Name, batchForecast: batchForecast{Latitude: l.Latitude, Longitude: l.Longitude}}
+		p := l.point()
+		key, _ := pointCacheKey(p.Latitude, p.Longitude)
+		body, ok := s.nwsCache.get(key)
+		if !ok {
+			continue
+		}
+		var pointData PointResponse
+		if json.Unmarshal(body, &pointData) == nil {
+			forecastURLs[i] = pointData.Properties.Forecast
+		}
+	}
+
+	bodies := s.nwsCache.snapshot(forecastURLs)
+	now := s.clock.Now()
+	for i := range resp.Forecasts {
+		f := &resp.Forecasts[i]
+		body, ok := bodies[forecastURLs[i]]
+		if !ok {
+			f.Error = "Forecast not cached yet"
+			continue
+		}
+		periods, err := nwsNormalizer{}.normalize(body)
+		if err != nil || len(periods) == 0 {
+			f.Error = "No forecast periods found"
+			continue
+		}
+		periods = dropPeriodAnomalies(periods)
+		period := currentPeriod(periods, now)
+		output := s.periodOutput(period)
+		output.SummaryText = summarizeOutlook(periods)
+		s.applyTransforms(period, &output)
+		f.ForecastOutput = &output
+	}
+	return resp
+}
+
+// allForecastsHandler serves the cached forecasts of every prefetch location
+// in one response, for displays showing many places at once. Its ETag covers
+// the whole set, so a display polling with If-None-Match gets a 304 until any
+// of them changes.
+func (s *server) allForecastsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := json.Marshal(s.snapshotForecasts())
+	if err != nil {
+		http.Error(w, "Failed to encode forecasts", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 says to for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestAllForecastsHandler tests serving the prefetch locations' forecasts from
+// the cache, with an ETag that changes only when a forecast does
+func TestAllForecastsHandler(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 5, 10, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.clock = clk
+	srv.nwsCache = newNWSCache(clk, 0)
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv.nws = nws
+	locations := []prefetchLocation{{Name: "lobby", Latitude: 47.6062, Longitude: -122.3321}, {Name: "warehouse", Latitude: 43.615, Longitude: -116.2023}}
+	srv.prefetch.Store(&locations)
+	if err := srv.prewarmPoint(t.Context(), locations[0].point(), time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	sent := len(nws.paths())
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/forecast/all", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		srv.allForecastsHandler(w, r)
+		return w
+	}
+	w := get("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp allForecastsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Forecasts) != 2 || resp.Forecasts[0].Name != "lobby" || resp.Forecasts[0].ForecastOutput == nil || resp.Forecasts[0].Forecast != "Sunny" {
+		t.Errorf("expected the lobby's cached forecast, got %+v", resp.Forecasts)
+	}
+	if len(resp.Forecasts) == 2 && (resp.Forecasts[1].ForecastOutput != nil || resp.Forecasts[1].Error == "") {
+		t.Errorf("expected an error for the uncached warehouse, got %+v", resp.Forecasts[1])
+	}
+	if len(nws.paths()) != sent {
+		t.Errorf("expected no NWS requests, got %v", nws.paths()[sent:])
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	tests := []struct {
+		name     string
+		etag     string
+		expected int
+	}{
+		{name: "current", etag: etag, expected: http.StatusNotModified},
+		{name: "weak", etag: "W/" + etag, expected: http.StatusNotModified},
+		{name: "listed", etag: `"other", ` + etag, expected: http.StatusNotModified},
+		{name: "stale", etag: `"other"`, expected: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := get(tt.etag).Code; got != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	// A changed forecast changes the ETag
+	nws.responses["/gridpoints/SEW/124,67/forecast"] = fakeResponse{body: `{"properties": {"periods": [{"temperature": 58, "shortForecast": "Rain"}]}}`}
+	if err := srv.prewarmPoint(t.Context(), locations[0].point(), time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a new forecast and ETag, got status %d and ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+}
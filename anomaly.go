@@ -0,0 +1,117 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Upstream data is checked for values no real weather produces before it's
+// categorized, so a glitch in a provider's model output doesn't become a
+// "hot" forecast or trip a notification. Implausible values are dropped with
+// a warning rather than failing the request.
+const (
+	// minPlausibleC and maxPlausibleC bound temperatures, just past the
+	// coldest and hottest ever recorded
+	minPlausibleC = -90.0
+	maxPlausibleC = 60.0
+	// maxTemperatureJumpC is the largest plausible change in temperature
+	// between consecutive values, 60°F
+	maxTemperatureJumpC = 60 * 5 / 9.0
+	// maxPlausibleKPH bounds wind speeds, past the strongest gust recorded
+	maxPlausibleKPH = 450.0
+)
+
+// anomaliesDropped counts implausible upstream values dropped
+var anomaliesDropped = expvar.NewInt("forecast_anomalies_dropped")
+
+// dropAnomaly logs and counts an implausible value being dropped
+func dropAnomaly(format string, args ...any) {
+	anomaliesDropped.Add(1)
+	log.Printf("Dropped implausible upstream value: %s", fmt.Sprintf(format, args...))
+}
+
+// plausiblePercent reports whether v is a percentage
+func plausiblePercent(v float64) bool {
+	return v >= 0 && v <= 100
+}
+
+// dropPeriodAnomalies drops the periods whose temperature is implausible,
+// either outright or as a jump from the period before, and clears
+// implausible wind speeds and chances of precipitation
+func dropPeriodAnomalies(periods []weatherPeriod) []weatherPeriod {
+	kept := periods[:0]
+	for _, p := range periods {
+		if p.TemperatureC < minPlausibleC || p.TemperatureC > maxPlausibleC || math.IsNaN(p.TemperatureC) {
+			dropAnomaly("temperature %.1f°C at %s", p.TemperatureC, p.Start.Format(time.RFC3339))
+			continue
+		}
+		if len(kept) > 0 {
+			if prev := kept[len(kept)-1]; math.Abs(p.TemperatureC-prev.TemperatureC) > maxTemperatureJumpC {
+				dropAnomaly("temperature jump from %.1f°C to %.1f°C at %s", prev.TemperatureC, p.TemperatureC, p.Start.Format(time.RFC3339))
+				continue
+			}
+		}
+		if p.WindSpeedKPH != nil && (*p.WindSpeedKPH < 0 || *p.WindSpeedKPH > maxPlausibleKPH) {
+			dropAnomaly("wind speed %.1f km/h at %s", *p.WindSpeedKPH, p.Start.Format(time.RFC3339))
+			p.WindSpeedKPH = nil
+		}
+		if pop := p.PrecipitationProbability; pop != nil && !plausiblePercent(float64(*pop)) {
+			dropAnomaly("chance of precipitation %d%% at %s", *pop, p.Start.Format(time.RFC3339))
+			p.PrecipitationProbability = nil
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// dropGridAnomalies drops the implausible values of a gridpoint's series:
+// temperatures out of range or jumping from the value before, percentages
+// such as relative humidity outside 0-100, and negative speeds and amounts
+func dropGridAnomalies(data *gridData) {
+	for _, s := range []struct {
+		name   string
+		series *gridSeries
+	}{{"temperature", &data.Temperature}, {"dewpoint", &data.Dewpoint}} {
+		*s.series = filterGridSeries(s.name, *s.series, func(v, prev float64, first bool) bool {
+			return v >= minPlausibleC && v <= maxPlausibleC && (first || math.Abs(v-prev) <= maxTemperatureJumpC)
+		})
+	}
+	for _, s := range []struct {
+		name   string
+		series *gridSeries
+	}{
+		{"relative humidity", &data.RelativeHumidity},
+		{"sky cover", &data.SkyCover},
+		{"chance of precipitation", &data.PrecipitationProbability},
+	} {
+		*s.series = filterGridSeries(s.name, *s.series, func(v, _ float64, _ bool) bool { return plausiblePercent(v) })
+	}
+	data.WindSpeed = filterGridSeries("wind speed", data.WindSpeed, func(v, _ float64, _ bool) bool {
+		return v >= 0 && v <= maxPlausibleKPH
+	})
+	data.QuantitativePrecipitation = filterGridSeries("precipitation", data.QuantitativePrecipitation, func(v, _ float64, _ bool) bool {
+		return v >= 0
+	})
+}
+
+// filterGridSeries keeps the values of a series that plausible accepts, given
+// the last value kept unless the value is the first
+func filterGridSeries(name string, series gridSeries, plausible func(v, prev float64, first bool) bool) gridSeries {
+	kept := series[:0]
+	for _, v := range series {
+		first := len(kept) == 0
+		prev := 0.0
+		if !first {
+			prev = kept[len(kept)-1].Value
+		}
+		if !plausible(v.Value, prev, first) {
+			dropAnomaly("%s %.1f at %s", name, v.Value, v.Start.Format(time.RFC3339))
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestDropPeriodAnomalies tests dropping periods with implausible
+// temperatures and clearing implausible winds and chances of precipitation
+func TestDropPeriodAnomalies(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	pop, badPop := 30, -10
+	wind, badWind := 20.0, -5.0
+	temps := []float64{15, 16, 70, 17, -95, 18, 55, 19}
+	var periods []weatherPeriod
+	for i, temp := range temps {
+		periods = append(periods, weatherPeriod{Start: start.Add(time.Duration(i) * time.Hour), TemperatureC: temp, WindSpeedKPH: &wind, PrecipitationProbability: &pop})
+	}
+	periods[1].WindSpeedKPH = &badWind
+	periods[3].PrecipitationProbability = &badPop
+
+	before := anomaliesDropped.Value()
+	got := dropPeriodAnomalies(periods)
+	var kept []float64
+	for _, p := range got {
+		kept = append(kept, p.TemperatureC)
+	}
+	if expected := []float64{15, 16, 17, 18, 19}; !slices.Equal(kept, expected) {
+		t.Errorf("expected temperatures %v, got %v", expected, kept)
+	}
+	if got[1].WindSpeedKPH != nil || got[0].WindSpeedKPH == nil {
+		t.Errorf("expected only the negative wind speed cleared, got %v and %v", got[0].WindSpeedKPH, got[1].WindSpeedKPH)
+	}
+	if got[2].PrecipitationProbability != nil || got[0].PrecipitationProbability == nil {
+		t.Errorf("expected only the negative chance of precipitation cleared")
+	}
+	if n := anomaliesDropped.Value() - before; n != 5 {
+		t.Errorf("expected 5 anomalies counted, got %d", n)
+	}
+}
+
+// TestDropGridAnomalies tests dropping implausible gridpoint values
+func TestDropGridAnomalies(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	series := func(values ...float64) gridSeries {
+		var s gridSeries
+		for i, v := range values {
+			s = append(s, gridValue{Start: start.Add(time.Duration(i) * time.Hour), Duration: time.Hour, Value: v})
+		}
+		return s
+	}
+	data := gridData{
+		Temperature:               series(10, 11, 50, 12),
+		RelativeHumidity:          series(60, -4, 65, 130),
+		WindSpeed:                 series(10, -1),
+		QuantitativePrecipitation: series(0.5, -0.2),
+	}
+	dropGridAnomalies(&data)
+
+	tests := []struct {
+		name     string
+		series   gridSeries
+		expected []float64
+	}{
+		{name: "temperature", series: data.Temperature, expected: []float64{10, 11, 12}},
+		{name: "relative humidity", series: data.RelativeHumidity, expected: []float64{60, 65}},
+		{name: "wind speed", series: data.WindSpeed, expected: []float64{10}},
+		{name: "precipitation", series: data.QuantitativePrecipitation, expected: []float64{0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			for _, v := range tt.series {
+				got = append(got, v.Value)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// defaultAnswerWithin and maxAnswerWithin bound how far ahead the yes/no
+	// endpoints look. NWS publishes about a week of hourly periods.
+	defaultAnswerWithin = 12 * time.Hour
+	maxAnswerWithin     = 168 * time.Hour
+	// answerThreshold is the chance of precipitation, in percent, at which the
+	// answer becomes yes
+	answerThreshold = 50
+)
+
+// snowConditions are the conditions of frozen precipitation
+var snowConditions = []condition{conditionSnow, conditionRainSnow, conditionSleet, conditionBlizzard}
+
+// question is a yes/no question about precipitation. matches picks the hours
+// whose chance of precipitation counts towards the answer.
+type question struct {
+	Name    string
+	matches func(weatherPeriod) bool
+}
+
+var (
+	// rainQuestion counts every hour not forecast to snow
+	rainQuestion = question{Name: "rain", matches: func(p weatherPeriod) bool {
+		return !slices.Contains(snowConditions, p.Condition) || p.Condition == conditionRainSnow
+	}}
+	// snowQuestion counts the hours forecast to snow or sleet
+	snowQuestion = question{Name: "snow", matches: func(p weatherPeriod) bool {
+		return slices.Contains(snowConditions, p.Condition)
+	}}
+)
+
+// answerResponse is the body of the yes/no endpoints
+type answerResponse struct {
+	Question string    `json:"question"`
+	Answer   bool      `json:"answer"`
+	From     time.Time `json:"from"`
+	Until    time.Time `json:"until"`
+	// Probability is the highest chance of precipitation over the matching
+	// hours, from 0 to 1
+	Probability float64 `json:"probability"`
+	// FirstExpected is the start of the first hour whose chance reaches
+	// answerThreshold, omitted when the answer is no
+	FirstExpected *time.Time `json:"firstExpected,omitempty"`
+}
+
+// answer answers q from the hourly periods overlapping from to until
+func (q question) answer(periods []weatherPeriod, from, until time.Time) answerResponse {
+	resp := answerResponse{Question: q.Name, From: from, Until: until}
+	highest := 0
+	for _, p := range periods {
+		if !p.End.After(from) || !p.Start.Before(until) || !q.matches(p) || p.PrecipitationProbability == nil {
+			continue
+		}
+		pop := *p.PrecipitationProbability
+		highest = max(highest, pop)
+		if pop >= answerThreshold && resp.FirstExpected == nil {
+			start := p.Start
+			resp.FirstExpected = &start
+		}
+	}
+	resp.Probability = float64(highest) / 100
+	resp.Answer = resp.FirstExpected != nil
+	return resp
+}
+
+// answerHandler serves a yes/no answer to q over the next ?within= hours
+func (s *server) answerHandler(q question) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		lat, lon, ok := s.requirePoint(w, r)
+		if !ok {
+			return
+		}
+		within := defaultAnswerWithin
+		if v := r.URL.Query().Get("within"); v != "" {
+			d, err := parseDuration(v)
+			if err != nil || d < time.Hour || d > maxAnswerWithin {
+				http.Error(w, "Invalid within parameter (want a duration from 1h to 7d)", http.StatusBadRequest)
+				return
+			}
+			within = d
+		}
+
+		periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode)
+			return
+		}
+		if len(periods) == 0 {
+			http.Error(w, "No forecast periods found", http.StatusNotFound)
+			return
+		}
+		fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+
+		now := s.clock.Now()
+		writeJSON(w, http.StatusOK, q.answer(periods, now, now.Add(within)))
+	}
+}
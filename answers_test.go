@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestQuestionAnswer tests answering yes/no precipitation questions from hourly periods
+func TestQuestionAnswer(t *testing.T) {
+	from := time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC)
+	pop := func(v int) *int { return &v }
+	hour := func(i int, c condition, p *int) weatherPeriod {
+		start := time.Date(2024, 6, 1, 9+i, 0, 0, 0, time.UTC)
+		return weatherPeriod{Start: start, End: start.Add(time.Hour), Condition: c, PrecipitationProbability: p}
+	}
+	periods := []weatherPeriod{
+		hour(-1, conditionRain, pop(90)),
+		hour(0, conditionCloudy, pop(20)),
+		hour(1, conditionShowers, nil),
+		hour(2, conditionRain, pop(70)),
+		hour(3, conditionSnow, pop(80)),
+		hour(4, conditionSnow, pop(95)),
+	}
+	tests := []struct {
+		name          string
+		q             question
+		within        time.Duration
+		expected      bool
+		probability   float64
+		firstExpected time.Time
+	}{
+		{name: "rain within 1h", q: rainQuestion, within: time.Hour, probability: 0.2},
+		{name: "rain within 4h", q: rainQuestion, within: 4 * time.Hour, expected: true, probability: 0.7, firstExpected: periods[3].Start},
+		{name: "snow within 3h", q: snowQuestion, within: 3 * time.Hour, expected: true, probability: 0.8, firstExpected: periods[4].Start},
+		{name: "snow within 1h", q: snowQuestion, within: time.Hour, probability: 0},
+		{name: "rain ignores snow", q: rainQuestion, within: 12 * time.Hour, expected: true, probability: 0.7, firstExpected: periods[3].Start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.q.answer(periods, from, from.Add(tt.within))
+			if got.Answer != tt.expected || got.Probability != tt.probability {
+				t.Errorf("expected answer %v with probability %v, got %v with %v", tt.expected, tt.probability, got.Answer, got.Probability)
+			}
+			if tt.firstExpected.IsZero() != (got.FirstExpected == nil) || (got.FirstExpected != nil && !got.FirstExpected.Equal(tt.firstExpected)) {
+				t.Errorf("expected first expected %v, got %v", tt.firstExpected, got.FirstExpected)
+			}
+		})
+	}
+}
+
+// TestAnswerHandler tests the will-it-rain endpoint and its parameters
+func TestAnswerHandler(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hourly-url" {
+			w.Write([]byte(`{"properties": {"periods": [
+				{"startTime": "2024-06-01T09:00:00Z", "endTime": "2024-06-01T10:00:00Z", "shortForecast": "Rain", "temperature": 55, "probabilityOfPrecipitation": {"value": 60}}
+			]}}`))
+			return
+		}
+		w.Write([]byte(`{"properties": {"forecastHourly": "http://` + r.Host + `/hourly-url"}}`))
+	}))
+	defer mockNWS.Close()
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.clock = newFakeClock(time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       bool
+	}{
+		{name: "default window", query: "", expectedStatus: 200, expected: true},
+		{name: "short window", query: "&within=1h", expectedStatus: 200},
+		{name: "days", query: "&within=2d", expectedStatus: 200, expected: true},
+		{name: "too long", query: "&within=8d", expectedStatus: 400},
+		{name: "too short", query: "&within=10m", expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/will-it-rain?latitude=47.6062&longitude=-122.3321"+tt.query, nil)
+			w := httptest.NewRecorder()
+			srv.answerHandler(rainQuestion)(w, req)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != 200 {
+				return
+			}
+			var resp answerResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Answer != tt.expected {
+				t.Errorf("expected answer %v, got %+v", tt.expected, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// archiveJitter bounds the random delay of each archive export
+const archiveJitter = time.Minute
+
+// Archive export formats
+const (
+	archiveParquet = "parquet"
+	archiveCSV     = "csv"
+)
+
+var (
+	// archiveRowsExported counts forecast periods written by the archive exporter
+	archiveRowsExported = expvar.NewInt("forecast_archive_rows_exported")
+	// archiveExportErrors counts archive exports that failed
+	archiveExportErrors = expvar.NewInt("forecast_archive_export_errors")
+)
+
+// archiveColumns flattens archived forecast revisions into one row per
+// period, with the point, product, and recording time of its revision
+func archiveColumns(snaps []ForecastSnapshot) ([]parquetColumn, error) {
+	columns := []parquetColumn{
+		{Name: "latitude", Kind: parquetDouble},
+		{Name: "longitude", Kind: parquetDouble},
+		{Name: "product", Kind: parquetString},
+		{Name: "recordedAt", Kind: parquetTimestamp},
+		{Name: "startTime", Kind: parquetTimestamp},
+		{Name: "endTime", Kind: parquetTimestamp},
+		{Name: "forecast", Kind: parquetString},
+		{Name: "conditionCode", Kind: parquetString},
+		{Name: "temperatureC", Kind: parquetDouble},
+		{Name: "windSpeedKph", Kind: parquetDouble},
+		{Name: "windDirection", Kind: parquetString},
+		{Name: "precipitationProbability", Kind: parquetInt32},
+	}
+	for _, snap := range snaps {
+		var periods []hourlyPeriod
+		if err := json.Unmarshal(snap.Periods, &periods); err != nil {
+			return nil, fmt.Errorf("forecast snapshot %d: %v", snap.ID, err)
+		}
+		for _, p := range periods {
+			var wind, pop, direction any
+			if p.WindSpeedKPH != nil {
+				wind = *p.WindSpeedKPH
+			}
+			if p.PrecipitationProbability != nil {
+				pop = *p.PrecipitationProbability
+			}
+			if p.WindDirection != "" {
+				direction = p.WindDirection
+			}
+			row := []any{
+				snap.Latitude, snap.Longitude, snap.Product, snap.RecordedAt,
+				p.StartTime, p.EndTime, p.Forecast, p.ConditionCode,
+				p.TemperatureC, wind, direction, pop,
+			}
+			for i := range columns {
+				columns[i].Values = append(columns[i].Values, row[i])
+			}
+		}
+	}
+	return columns, nil
+}
+
+// writeArchiveCSV writes columns as CSV with a header row. Nulls are empty and
+// times are RFC 3339 in UTC.
+func writeArchiveCSV(columns []parquetColumn) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		record[i] = c.Name
+	}
+	cw.Write(record)
+	rows := 0
+	if len(columns) > 0 {
+		rows = len(columns[0].Values)
+	}
+	for r := range rows {
+		for i, c := range columns {
+			switch v := c.Values[r].(type) {
+			case nil:
+				record[i] = ""
+			case string:
+				record[i] = v
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case int:
+				record[i] = strconv.Itoa(v)
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339)
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// exportArchiveOnce writes the forecast revisions recorded from from until to
+// as one file in format, named for the start of the window, and returns the
+// number of periods written
+func exportArchiveOnce(ctx context.Context, store Store, blobs BlobStore, format string, from, to time.Time) (int, error) {
+	snaps, err := store.ListSnapshots(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	columns, err := archiveColumns(snaps)
+	if err != nil {
+		return 0, err
+	}
+
+	var data []byte
+	contentType := "text/csv"
+	if format == archiveParquet {
+		var buf bytes.Buffer
+		if err := writeParquet(&buf, columns); err != nil {
+			return 0, err
+		}
+		data, contentType = buf.Bytes(), "application/vnd.apache.parquet"
+	} else if data, err = writeArchiveCSV(columns); err != nil {
+		return 0, err
+	}
+
+	key := fmt.Sprintf("forecasts/%s.%s", from.UTC().Format("20060102T150405Z"), format)
+	if err := blobs.Put(ctx, key, data, contentType); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %v", key, err)
+	}
+	rows := len(columns[0].Values)
+	archiveRowsExported.Add(int64(rows))
+	return rows, nil
+}
+
+// windowSchedule runs a job a delay after the end of each window of an
+// interval, aligned to the Unix epoch
+type windowSchedule struct {
+	interval, delay time.Duration
+}
+
+func (w windowSchedule) next(now time.Time) time.Time {
+	return now.Add(-w.delay).Truncate(w.interval).Add(w.interval + w.delay)
+}
+
+func (w windowSchedule) String() string {
+	return fmt.Sprintf("%v after each %v window", w.delay, w.interval)
+}
+
+// archiveExportJob exports the forecast revisions of the last complete
+// ArchiveInterval to blobs, starting at startup. Windows are aligned to the
+// Unix epoch, so daily exports cover UTC days. Exports run on ArchiveSchedule,
+// or a minute after each window is complete when it's unset, allowing late
+// writes to land; each replaces the earlier file of its window.
+func (s *server) archiveExportJob(blobs BlobStore) *job {
+	return &job{
+		name: "archive-export",
+		schedule: func() (jobSchedule, error) {
+			cfg := s.state.Config()
+			if cfg.ArchiveSchedule != "" {
+				return parseJobSchedule(cfg.ArchiveSchedule)
+			}
+			return windowSchedule{interval: cfg.ArchiveInterval, delay: time.Minute}, nil
+		},
+		run: func(ctx context.Context) error {
+			cfg := s.state.Config()
+			to := s.clock.Now().Truncate(cfg.ArchiveInterval)
+			from := to.Add(-cfg.ArchiveInterval)
+			n, err := exportArchiveOnce(ctx, s.store, blobs, cfg.ArchiveFormat, from, to)
+			if err != nil {
+				archiveExportErrors.Add(1)
+				log.Printf("Archive export failed: %v", err)
+				return err
+			}
+			log.Printf("Exported %d archived forecast periods from %s", n, from.UTC().Format(time.RFC3339))
+			return nil
+		},
+		jitter:     archiveJitter,
+		runAtStart: true,
+	}
+}
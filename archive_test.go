@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestExportArchiveOnce tests exporting a window of forecast revisions as CSV
+// and Parquet
+func TestExportArchiveOnce(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	day := time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC)
+	for i, periods := range []string{
+		`[{"startTime": "2024-06-04T06:00:00-07:00", "endTime": "2024-06-04T18:00:00-07:00", "forecast": "Sunny", "conditionCode": "clear", "temperatureC": 21.5, "windSpeedKph": 16.1, "windDirection": "SW", "precipitationProbability": 10},
+		  {"startTime": "2024-06-04T18:00:00-07:00", "endTime": "2024-06-05T06:00:00-07:00", "forecast": "Clear", "conditionCode": "clear", "temperatureC": 12}]`,
+		`[{"startTime": "2024-06-05T06:00:00-07:00", "endTime": "2024-06-05T18:00:00-07:00", "forecast": "Rain", "conditionCode": "rain", "temperatureC": 15}]`,
+	} {
+		// The second revision falls in the next day's export
+		snap := &ForecastSnapshot{Latitude: 47.6062, Longitude: -122.3321, Product: productForecast, Periods: json.RawMessage(periods), RecordedAt: day.Add(time.Duration(i*20) * time.Hour)}
+		if err := store.AddSnapshot(ctx, snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	blobs := &fileBlobStore{dir: dir}
+	n, err := exportArchiveOnce(ctx, store, blobs, archiveCSV, day, day.Add(20*time.Hour))
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 periods exported, got %d", n)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "forecasts", "20240604T000000Z.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "latitude,longitude,product,recordedAt,startTime,endTime,forecast,conditionCode,temperatureC,windSpeedKph,windDirection,precipitationProbability\n" +
+		"47.6062,-122.3321,forecast,2024-06-04T00:00:00Z,2024-06-04T13:00:00Z,2024-06-05T01:00:00Z,Sunny,clear,21.5,16.1,SW,10\n" +
+		"47.6062,-122.3321,forecast,2024-06-04T00:00:00Z,2024-06-05T01:00:00Z,2024-06-05T13:00:00Z,Clear,clear,12,,,\n"
+	if string(got) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	if n, err := exportArchiveOnce(ctx, store, blobs, archiveParquet, day.Add(20*time.Hour), day.Add(44*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("expected 1 period exported, got %d (%v)", n, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "forecasts", "20240604T200000Z.parquet")); err != nil || info.Size() == 0 {
+		t.Errorf("expected a Parquet file, got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scopes that can be granted to an API key. A key with the admin scope may
+// use every route.
+const (
+	scopeRead      = "read"
+	scopeSubscribe = "subscribe"
+	scopeAdmin     = "admin"
+)
+
+// validScopes lists every scope in increasing order of privilege
+var validScopes = []string{scopeRead, scopeSubscribe, scopeAdmin}
+
+// contextKey keys values the middleware stores in a request context
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	traceContextKey
+)
+
+// apiKeyFromContext returns the key that authenticated the request, or nil for
+// anonymous requests
+func apiKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*APIKey)
+	return key
+}
+
+// hasScope reports whether the key may use routes requiring scope
+func (k *APIKey) hasScope(scope string) bool {
+	return slices.Contains(k.Roles, scope) || slices.Contains(k.Roles, scopeAdmin)
+}
+
+// validateScopes checks that every role is a known scope
+func validateScopes(roles []string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	for _, role := range roles {
+		if !slices.Contains(validScopes, role) {
+			return fmt.Errorf("unknown role %q (want one of %s)", role, strings.Join(validScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// newAPIKey generates a key for owner and returns it with the token clients
+// present, which is the key ID and secret joined by a dot
+func newAPIKey(owner, name string, roles []string) (*APIKey, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		ID:    "k_" + hex.EncodeToString(id),
+		Owner: owner,
+		Name:  name,
+		Key:   base64.RawURLEncoding.EncodeToString(secret),
+		Roles: roles,
+	}
+	return key, key.ID + "." + key.Key, nil
+}
+
+// errUnauthorized is returned when a request carries an invalid credential
+var errUnauthorized = errors.New("invalid API key")
+
+// authenticate resolves the API key presented with a request in the
+// Authorization: Bearer or X-API-Key header. When OIDC is configured, a bearer
+// JWT is accepted instead and mapped to a key. Without either, a verified
+// client certificate identifies the caller. It returns nil without error when
+// no credential was presented.
+func (s *server) authenticate(r *http.Request) (*APIKey, error) {
+	token := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); token == "" && auth != "" {
+		scheme, credential, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, errUnauthorized
+		}
+		token = strings.TrimSpace(credential)
+	}
+	if token == "" {
+		return clientCertKey(r), nil
+	}
+	if s.oidc != nil && isJWT(token) {
+		key, err := s.oidc.verify(r.Context(), token, s.clock.Now())
+		if err != nil {
+			log.Printf("Rejected bearer token: %v", err)
+			return nil, errUnauthorized
+		}
+		return key, nil
+	}
+	if s.store == nil {
+		return nil, errUnauthorized
+	}
+
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errUnauthorized
+	}
+	key, err := s.store.GetAPIKey(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(key.Key)) != 1 {
+		return nil, errUnauthorized
+	}
+	return key, nil
+}
+
+// requireScope wraps a handler so it only runs for requests authorized for
+// scope. When authentication isn't required, anonymous requests may still use
+// read routes; so may requests with a valid signed URL when it is.
+func (s *server) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has(signatureParam) {
+			if scope != scopeRead || !verifySignedURL(s.state.Config().URLSigningKey, r, s.clock.Now()) {
+				http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+		// limitRate may have authenticated the request already
+		key := apiKeyFromContext(r.Context())
+		var err error
+		if key == nil {
+			key, err = s.authenticate(r)
+		}
+		if errors.Is(err, errUnauthorized) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="forecast"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("Authentication failed: %v", err)
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+
+		if key == nil {
+			if scope == scopeRead && !s.state.Config().AuthRequired {
+				next(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="forecast"`)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		if !key.hasScope(scope) {
+			http.Error(w, fmt.Sprintf("API key lacks the %s role", scope), http.StatusForbidden)
+			return
+		}
+
+		if s.store != nil {
+			if err := s.store.RecordUsage(r.Context(), key.ID, s.clock.Now()); err != nil {
+				log.Printf("Failed to record usage: %v", err)
+			}
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	}
+}
+
+// audit records an action taken by the key authenticating r
+func (s *server) audit(r *http.Request, action, detail string) {
+	actor := "anonymous"
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		actor = key.ID
+	}
+	if err := s.store.AppendAudit(r.Context(), &AuditEntry{Actor: actor, Action: action, Detail: detail}); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
+
+// createKeyRequest is the body of POST /admin/keys
+type createKeyRequest struct {
+	Owner string   `json:"owner"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// createKeyResponse returns a new key; the token is only ever shown here
+type createKeyResponse struct {
+	APIKey
+	Token string `json:"token"`
+}
+
+func (s *server) createKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Owner == "" {
+		http.Error(w, "Missing owner", http.StatusBadRequest)
+		return
+	}
+	if len(req.Roles) == 0 {
+		req.Roles = []string{scopeRead}
+	}
+	if err := validateScopes(req.Roles); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, token, err := newAPIKey(req.Owner, req.Name, req.Roles)
+	if err == nil {
+		err = s.store.CreateAPIKey(r.Context(), key)
+	}
+	if err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "key.create", fmt.Sprintf("%s owner=%s roles=%s", key.ID, key.Owner, strings.Join(key.Roles, ",")))
+
+	resp := createKeyResponse{APIKey: *key, Token: token}
+	resp.Key = ""
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *server) listKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.store.ListAPIKeys(r.Context())
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+	for i := range keys {
+		keys[i].Key = ""
+	}
+	if keys == nil {
+		keys = []APIKey{}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (s *server) deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := s.store.DeleteAPIKey(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete API key: %v", err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "key.revoke", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// runCreateKeyCommand implements `forecast create-key -owner name [-roles read,subscribe,admin]`,
+// used to bootstrap the first admin key
+func runCreateKeyCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("create-key", flag.ContinueOnError)
+	fset.SetOutput(out)
+	databaseURL := fset.String("database", "", "database URL (defaults to FORECAST_DATABASE_URL)")
+	owner := fset.String("owner", "", "owner of the key")
+	name := fset.String("name", "", "description of the key")
+	roles := fset.String("roles", scopeRead, "comma-separated roles: read, subscribe, admin")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *owner == "" {
+		return fmt.Errorf("-owner is required")
+	}
+	roleList := strings.Split(*roles, ",")
+	if err := validateScopes(roleList); err != nil {
+		return err
+	}
+
+	store, err := openCommandStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	key, token, err := newAPIKey(*owner, *name, roleList)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := store.CreateAPIKey(ctx, key); err != nil {
+		return err
+	}
+	if err := store.AppendAudit(ctx, &AuditEntry{Actor: "cli", Action: "key.create", Detail: fmt.Sprintf("%s owner=%s roles=%s", key.ID, key.Owner, *roles)}); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, token)
+	return nil
+}
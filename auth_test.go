@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAuthServer returns a server backed by a test store holding one key per
+// role, along with their tokens
+func newAuthServer(t *testing.T, cfg Config) (*server, map[string]string) {
+	t.Helper()
+	srv := newServer(cfg)
+	srv.store = newTestStore(t)
+	tokens := map[string]string{}
+	for _, role := range validScopes {
+		key, token, err := newAPIKey("owner-"+role, role, []string{role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.store.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+		tokens[role] = token
+	}
+	return srv, tokens
+}
+
+// TestRequireScope tests which keys may use routes of each scope
+func TestRequireScope(t *testing.T) {
+	srv, tokens := newAuthServer(t, Config{})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name         string
+		scope        string
+		header       string
+		value        string
+		authRequired bool
+		expected     int
+	}{
+		{name: "anonymous read", scope: scopeRead, expected: http.StatusOK},
+		{name: "anonymous read with auth required", scope: scopeRead, authRequired: true, expected: http.StatusUnauthorized},
+		{name: "anonymous subscribe", scope: scopeSubscribe, expected: http.StatusUnauthorized},
+		{name: "read key on read route", scope: scopeRead, header: "X-API-Key", value: tokens[scopeRead], expected: http.StatusOK},
+		{name: "bearer token", scope: scopeRead, header: "Authorization", value: "Bearer " + tokens[scopeRead], expected: http.StatusOK},
+		{name: "read key on subscribe route", scope: scopeSubscribe, header: "X-API-Key", value: tokens[scopeRead], expected: http.StatusForbidden},
+		{name: "read key on admin route", scope: scopeAdmin, header: "X-API-Key", value: tokens[scopeRead], expected: http.StatusForbidden},
+		{name: "subscribe key on subscribe route", scope: scopeSubscribe, header: "X-API-Key", value: tokens[scopeSubscribe], expected: http.StatusOK},
+		{name: "subscribe key on admin route", scope: scopeAdmin, header: "X-API-Key", value: tokens[scopeSubscribe], expected: http.StatusForbidden},
+		{name: "admin key on any route", scope: scopeSubscribe, header: "X-API-Key", value: tokens[scopeAdmin], expected: http.StatusOK},
+		{name: "wrong secret", scope: scopeRead, header: "X-API-Key", value: strings.Split(tokens[scopeRead], ".")[0] + ".wrong", expected: http.StatusUnauthorized},
+		{name: "unknown key", scope: scopeRead, header: "X-API-Key", value: "k_missing.secret", expected: http.StatusUnauthorized},
+		{name: "malformed token", scope: scopeRead, header: "X-API-Key", value: "no-dot", expected: http.StatusUnauthorized},
+		{name: "basic auth", scope: scopeRead, header: "Authorization", value: "Basic dXNlcjpwdw==", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.state.Update(func(c *Config) { c.AuthRequired = tt.authRequired })
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			srv.requireScope(tt.scope, ok)(w, req)
+			if w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// TestAdminKeyEndpoints tests issuing, listing, and revoking keys over the API
+func TestAdminKeyEndpoints(t *testing.T) {
+	srv, tokens := newAuthServer(t, Config{})
+	handler := srv.routes()
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/keys", tokens[scopeRead], `{"owner": "carol"}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected read key to be forbidden, got %d", w.Code)
+	}
+	if w := do("POST", "/admin/keys", tokens[scopeAdmin], `{"owner": "carol", "roles": ["root"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected unknown role to be rejected, got %d", w.Code)
+	}
+
+	w := do("POST", "/admin/keys", tokens[scopeAdmin], `{"owner": "carol", "name": "dashboard", "roles": ["read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created createKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Token == "" || created.Key != "" || created.Owner != "carol" {
+		t.Errorf("unexpected response %+v", created)
+	}
+
+	// The new key authenticates and is read-only
+	if w := do("GET", "/admin/keys", created.Token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected new read key to be forbidden, got %d", w.Code)
+	}
+
+	w = do("GET", "/admin/keys", tokens[scopeAdmin], "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), `"key"`) {
+		t.Errorf("expected secrets to be omitted, got %s", w.Body.String())
+	}
+
+	if w := do("DELETE", "/admin/keys/"+created.ID, tokens[scopeAdmin], ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if w := do("GET", "/forecast", created.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected revoked key to be rejected, got %d", w.Code)
+	}
+
+	// Metrics are for operators only
+	if w := do("GET", "/debug/vars", tokens[scopeRead], ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected read key to be forbidden metrics, got %d", w.Code)
+	}
+	if w := do("GET", "/debug/vars", tokens[scopeAdmin], ""); w.Code != http.StatusOK {
+		t.Errorf("expected admin key to read metrics, got %d", w.Code)
+	}
+
+	audit, err := srv.store.ListAudit(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != 2 || audit[0].Action != "key.create" || audit[1].Action != "key.revoke" {
+		t.Errorf("unexpected audit log %+v", audit)
+	}
+}
+
+// TestCreateKeyCommand tests bootstrapping a key from the command line
+func TestCreateKeyCommand(t *testing.T) {
+	url := "sqlite://" + filepath.Join(t.TempDir(), "forecast.db")
+	if err := runMigrateCommand([]string{"-database", url}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCreateKeyCommand([]string{"-database", url, "-owner", "ops", "-roles", "read,bogus"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected unknown role to be rejected")
+	}
+
+	var out bytes.Buffer
+	if err := runCreateKeyCommand([]string{"-database", url, "-owner", "ops", "-roles", "admin"}, &out); err != nil {
+		t.Fatalf("create-key failed: %v", err)
+	}
+	id, _, ok := strings.Cut(strings.TrimSpace(out.String()), ".")
+	if !ok {
+		t.Fatalf("expected a token, got %q", out.String())
+	}
+
+	store, err := openStore(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	key, err := store.GetAPIKey(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Owner != "ops" || !key.hasScope(scopeSubscribe) {
+		t.Errorf("unexpected key %+v", key)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	// maxBatchPoints bounds the points of one POST /forecasts
+	maxBatchPoints = 250
+	// batchWorkers is how many points of a batch are fetched at once, so a
+	// large batch doesn't flood NWS
+	batchWorkers = 8
+)
+
+// batchPoint is one point of a POST /forecasts body
+type batchPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// batchForecast is the forecast of one point of a batch, as /forecast would
+// report it. Error explains why a point's forecast is missing; the other
+// points are still returned.
+type batchForecast struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	*ForecastOutput
+	Error string `json:"error,omitempty"`
+}
+
+// batchResponse is the body of POST /forecasts, in the order the points were
+// given
+type batchResponse struct {
+	Forecasts []batchForecast `json:"forecasts"`
+}
+
+// parseBatchPoints reads the points of a POST /forecasts body
+func parseBatchPoints(r *http.Request) ([]batchPoint, error) {
+	var points []batchPoint
+	if err := json.NewDecoder(r.Body).Decode(&points); err != nil {
+		return nil, fmt.Errorf("Invalid request body (want an array of points)")
+	}
+	if len(points) == 0 || len(points) > maxBatchPoints {
+		return nil, fmt.Errorf("Invalid request body (want 1 to %d points)", maxBatchPoints)
+	}
+	for i, p := range points {
+		if p.Latitude < -90 || p.Latitude > 90 || p.Longitude < -180 || p.Longitude > 180 {
+			return nil, fmt.Errorf("Invalid point %d (latitude must be within ±90 and longitude within ±180)", i)
+		}
+	}
+	return points, nil
+}
+
+// batchForecastAt builds the batch entry of one point
+func (s *server) batchForecastAt(ctx context.Context, point batchPoint) batchForecast {
+	f := batchForecast{Latitude: point.Latitude, Longitude: point.Longitude}
+	lat := strconv.FormatFloat(point.Latitude, 'f', 4, 64)
+	lon := strconv.FormatFloat(point.Longitude, 'f', 4, 64)
+	periods, _, err := s.fetchPeriods(ctx, lat, lon, false)
+	if err != nil {
+		f.Error = err.Error()
+		return f
+	}
+	if len(periods) == 0 {
+		f.Error = "No forecast periods found"
+		return f
+	}
+	period := currentPeriod(periods, s.clock.Now())
+	output := s.periodOutput(period)
+	output.SummaryText = summarizeOutlook(periods)
+	s.applyTransforms(period, &output)
+	f.ForecastOutput = &output
+	return f
+}
+
+// batchHandler serves the forecasts of many points in one call, fetching them
+// batchWorkers at a time. Points not reached before the request times out are
+// abandoned.
+func (s *server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	points, err := parseBatchPoints(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := batchResponse{Forecasts: make([]batchForecast, len(points))}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(points)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				resp.Forecasts[i] = s.batchForecastAt(r.Context(), points[i])
+			}
+		}()
+	}
+feed:
+	for i := range points {
+		select {
+		case next <- i:
+		case <-r.Context().Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	writeJSON(w, http.StatusOK, resp)
+}
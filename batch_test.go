@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestBatchHandler tests forecasting many points in one call, reporting the
+// points that fail alongside the rest
+func TestBatchHandler(t *testing.T) {
+	forecast := `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expected       []string
+	}{
+		{
+			name:           "points",
+			body:           `[{"latitude": 47.6062, "longitude": -122.3321}, {"latitude": 0, "longitude": 0}, {"latitude": 47.6062, "longitude": -122.3321}]`,
+			expectedStatus: http.StatusOK,
+			expected:       []string{"Partly Cloudy", "error", "Partly Cloudy"},
+		},
+		{name: "not an array", body: `{"latitude": 47.6062, "longitude": -122.3321}`, expectedStatus: http.StatusBadRequest},
+		{name: "empty", body: `[]`, expectedStatus: http.StatusBadRequest},
+		{name: "too many", body: "[" + strings.Repeat(`{"latitude": 1, "longitude": 1},`, maxBatchPoints) + `{"latitude": 1, "longitude": 1}]`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid point", body: `[{"latitude": 97.6, "longitude": -122.3}]`, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			srv.nws = newFakeDoer(map[string]fakeResponse{
+				"/points/47.6062,-122.3321":       {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast"}}`},
+				"/gridpoints/SEW/124,67/forecast": {body: forecast},
+			})
+			w := httptest.NewRecorder()
+			srv.batchHandler(w, httptest.NewRequest("POST", "/forecasts", strings.NewReader(tt.body)))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp batchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range resp.Forecasts {
+				switch {
+				case f.Error != "" && f.ForecastOutput == nil:
+					got = append(got, "error")
+				case f.ForecastOutput != nil:
+					got = append(got, f.Forecast)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected forecasts %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// concurrencyDoer answers every request after a pause, recording the most
+// requests it was sent at once
+type concurrencyDoer struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (d *concurrencyDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.inFlight++
+	d.peak = max(d.peak, d.inFlight)
+	d.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	d.mu.Lock()
+	d.inFlight--
+	d.mu.Unlock()
+	return nil, fmt.Errorf("connection refused")
+}
+
+// TestBatchWorkers tests fetching at most batchWorkers points at once
+func TestBatchWorkers(t *testing.T) {
+	doer := &concurrencyDoer{}
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = doer
+	body := "[" + strings.Repeat(`{"latitude": 1, "longitude": 1},`, 3*batchWorkers) + `{"latitude": 1, "longitude": 1}]`
+	w := httptest.NewRecorder()
+	srv.batchHandler(w, httptest.NewRequest("POST", "/forecasts", strings.NewReader(body)))
+	var resp batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Forecasts) != 3*batchWorkers+1 {
+		t.Fatalf("expected every point, got %s", w.Body.String())
+	}
+	if doer.peak > batchWorkers || doer.peak < 2 {
+		t.Errorf("expected 2 to %d requests at once, got %d", batchWorkers, doer.peak)
+	}
+}
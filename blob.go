@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BlobStore holds files written by the service, such as archive exports and
+// cached images. Keys are slash-separated paths relative to the store's root.
+type BlobStore interface {
+	// Get returns the contents of key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put writes data to key, replacing any existing blob
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// openBlobStore opens the blob store named by a URL: file:///path/to/dir for
+// a local directory, or s3://bucket/prefix for S3 or an S3-compatible service
+// such as MinIO
+func openBlobStore(rawURL string) (BlobStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store URL: %v", err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("blob store URL %q has no directory", rawURL)
+		}
+		return &fileBlobStore{dir: filepath.FromSlash(u.Path)}, nil
+	case "s3":
+		return newS3BlobStore(u.Host, strings.Trim(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("unsupported blob store %q (want file:// or s3://)", rawURL)
+	}
+}
+
+// blobKeyPath joins a key onto a root, rejecting keys that would escape it
+func blobKeyPath(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return clean[1:], nil
+}
+
+// fileBlobStore keeps blobs as files under a directory
+type fileBlobStore struct {
+	dir string
+}
+
+// path returns the file holding key
+func (s *fileBlobStore) path(key string) (string, error) {
+	rel, err := blobKeyPath(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(rel)), nil
+}
+
+func (s *fileBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *fileBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *fileBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3BlobStore keeps blobs as objects under a prefix of an S3 bucket
+type s3BlobStore struct {
+	// endpoint is the base URL objects are addressed under, including the
+	// bucket
+	endpoint string
+	prefix   string
+	region   string
+	creds    awsCredentials
+}
+
+// newS3BlobStore returns a store for a bucket using the standard AWS_
+// environment variables. AWS_ENDPOINT_URL_S3 selects an S3-compatible service,
+// addressed with path-style URLs.
+func newS3BlobStore(bucket, prefix string) (*s3BlobStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 blob store URL has no bucket")
+	}
+	s := &s3BlobStore{
+		prefix: prefix,
+		region: os.Getenv("AWS_REGION"),
+		creds: awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.creds.AccessKeyID == "" || s.creds.SecretAccessKey == "" || s.region == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_REGION must be set to use s3://%s", bucket)
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_S3"); endpoint != "" {
+		s.endpoint = strings.TrimRight(endpoint, "/") + "/" + bucket
+	} else {
+		s.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, s.region)
+	}
+	return s, nil
+}
+
+// do sends a signed request for key and returns the response body, reporting
+// a missing object as ErrNotFound
+func (s *s3BlobStore) do(ctx context.Context, method, key string, data []byte, contentType string) ([]byte, error) {
+	rel, err := blobKeyPath(key)
+	if err != nil {
+		return nil, err
+	}
+	if s.prefix != "" {
+		rel = s.prefix + "/" + rel
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+"/"+rel, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	signAWSv4(req, data, s.creds, s.region, "s3", time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %v", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("s3: %s %s failed with status: %d", method, rel, resp.StatusCode)
+	}
+	return body, nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil, "")
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	return err
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	// S3 reports success for missing objects, but other services may not
+	if _, err := s.do(ctx, http.MethodDelete, key, nil, ""); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
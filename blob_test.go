@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestOpenBlobStore tests choosing a backend from the blob store URL
+func TestOpenBlobStore(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+
+	store, err := openBlobStore("s3://archive/forecast")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if s3 := store.(*s3BlobStore); s3.endpoint != "https://archive.s3.us-west-2.amazonaws.com" || s3.prefix != "forecast" {
+		t.Errorf("unexpected S3 store %+v", s3)
+	}
+	if _, ok := mustOpenBlobStore(t, "file:///var/lib/forecast").(*fileBlobStore); !ok {
+		t.Error("expected a file store")
+	}
+
+	for _, bad := range []string{"ftp://host/dir", "file://", "s3:///prefix"} {
+		if _, err := openBlobStore(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+	t.Setenv("AWS_REGION", "")
+	if _, err := openBlobStore("s3://archive"); err == nil {
+		t.Error("expected an error without a region")
+	}
+}
+
+func mustOpenBlobStore(t *testing.T, rawURL string) BlobStore {
+	t.Helper()
+	store, err := openBlobStore(rawURL)
+	if err != nil {
+		t.Fatalf("open %s failed: %v", rawURL, err)
+	}
+	return store
+}
+
+// testBlobStore runs the BlobStore contract against store
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := store.Get(ctx, "forecasts/day.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound before writing, got %v", err)
+	}
+	if err := store.Put(ctx, "forecasts/day.csv", []byte("a,b\n"), "text/csv"); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := store.Put(ctx, "forecasts/day.csv", []byte("c,d\n"), "text/csv"); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	if got, err := store.Get(ctx, "forecasts/day.csv"); err != nil || string(got) != "c,d\n" {
+		t.Errorf("expected the latest contents, got %q (%v)", got, err)
+	}
+	if err := store.Delete(ctx, "forecasts/day.csv"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "forecasts/day.csv"); err != nil {
+		t.Errorf("expected deleting a missing blob to succeed, got %v", err)
+	}
+	if _, err := store.Get(ctx, "forecasts/day.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after deleting, got %v", err)
+	}
+
+	for _, key := range []string{"", "../escape", "/absolute", "a//b"} {
+		if err := store.Put(ctx, key, nil, "text/plain"); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+}
+
+// TestFileBlobStore tests blobs kept as files under a directory
+func TestFileBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	testBlobStore(t, &fileBlobStore{dir: dir})
+
+	if err := (&fileBlobStore{dir: dir}).Put(context.Background(), "forecasts/day.csv", []byte("a,b\n"), "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "forecasts", "day.csv")); err != nil {
+		t.Errorf("expected the blob under the directory: %v", err)
+	}
+}
+
+// TestS3BlobStore tests signed path-style requests to an S3-compatible service
+func TestS3BlobStore(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	var auth, contentType string
+	minio := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Amz-Content-Sha256") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+			auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer minio.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ENDPOINT_URL_S3", minio.URL+"/")
+	store := mustOpenBlobStore(t, "s3://archive/exports")
+	testBlobStore(t, store)
+
+	if err := store.Put(context.Background(), "forecasts/day.csv", []byte("a,b\n"), "text/csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["/archive/exports/forecasts/day.csv"]; !ok || contentType != "text/csv" {
+		t.Errorf("expected a path-style upload under the prefix, got %v (%s)", objects, contentType)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NWS asks clients to keep their request rate reasonable and may throttle or
+// block a User-Agent that doesn't, so every request sent to NWS is counted by
+// UTC day against FORECAST_NWS_DAILY_BUDGET. Crossing the warning threshold
+// and then the budget each raise an alarm once a day: a log line, a metric,
+// and optionally a POST to FORECAST_NWS_BUDGET_WEBHOOK. Requests are never
+// refused for being over budget.
+
+const (
+	// budgetAlarmWarning and budgetAlarmExceeded are the alarms raised as
+	// the day's requests approach and reach the budget
+	budgetAlarmWarning  = "warning"
+	budgetAlarmExceeded = "exceeded"
+	// budgetHistoryDays is the number of days /admin/nws-budget reports
+	budgetHistoryDays = 7
+)
+
+var (
+	// nwsRequests counts requests sent to NWS
+	nwsRequests = expvar.NewInt("forecast_nws_requests")
+	// nwsBudgetAlarms counts budget alarms by level
+	nwsBudgetAlarms = expvar.NewMap("forecast_nws_budget_alarms")
+)
+
+// budgetDay is the number of requests sent to NWS on a UTC day
+type budgetDay struct {
+	Day      time.Time `json:"day"`
+	Requests int64     `json:"requests"`
+}
+
+// nwsBudget counts the requests sent to NWS over the last budgetHistoryDays
+type nwsBudget struct {
+	mu sync.Mutex
+	// days holds the counts of the latest days, oldest first
+	days []budgetDay
+	// alarms holds the alarms raised today
+	alarms map[string]bool
+}
+
+func newNWSBudget() *nwsBudget {
+	return &nwsBudget{alarms: map[string]bool{}}
+}
+
+// record counts a request sent at now and returns the alarm it raises, if
+// any, with the day's count. A budget of zero raises none.
+func (b *nwsBudget) record(now time.Time, budget, warnPercent int) (string, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	day := usageDay(now)
+	if len(b.days) == 0 || !b.days[len(b.days)-1].Day.Equal(day) {
+		b.days = append(b.days, budgetDay{Day: day})
+		if len(b.days) > budgetHistoryDays {
+			b.days = b.days[len(b.days)-budgetHistoryDays:]
+		}
+		clear(b.alarms)
+	}
+	today := &b.days[len(b.days)-1]
+	today.Requests++
+	if budget <= 0 {
+		return "", today.Requests
+	}
+
+	alarm := ""
+	switch {
+	case today.Requests >= int64(budget):
+		alarm = budgetAlarmExceeded
+	case today.Requests*100 >= int64(budget)*int64(warnPercent):
+		alarm = budgetAlarmWarning
+	}
+	if alarm == "" || b.alarms[alarm] {
+		return "", today.Requests
+	}
+	b.alarms[alarm] = true
+	return alarm, today.Requests
+}
+
+// history returns the counts of the latest days, newest first, with today's
+// count zero when no request has been sent yet today
+func (b *nwsBudget) history(now time.Time) []budgetDay {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	day := usageDay(now)
+	days := []budgetDay{}
+	if len(b.days) == 0 || !b.days[len(b.days)-1].Day.Equal(day) {
+		days = append(days, budgetDay{Day: day})
+	}
+	for i := len(b.days) - 1; i >= 0 && len(days) < budgetHistoryDays; i-- {
+		days = append(days, b.days[i])
+	}
+	return days
+}
+
+// budgetAlarm is the body POSTed to FORECAST_NWS_BUDGET_WEBHOOK
+type budgetAlarm struct {
+	Alarm    string    `json:"alarm"`
+	Day      time.Time `json:"day"`
+	Requests int64     `json:"requests"`
+	Budget   int       `json:"budget"`
+}
+
+// recordNWSRequest counts a request about to be sent to NWS, raising an alarm
+// when it brings the day's requests to the warning threshold or the budget
+func (s *server) recordNWSRequest() {
+	cfg := s.state.Config()
+	if cfg.Offline {
+		// The bundled dataset answers instead of NWS
+		return
+	}
+	nwsRequests.Add(1)
+	now := s.clock.Now()
+	alarm, requests := s.budget.record(now, cfg.NWSDailyBudget, cfg.NWSBudgetWarnPercent)
+	if alarm == "" {
+		return
+	}
+	nwsBudgetAlarms.Add(alarm, 1)
+	log.Printf("NWS request budget %s: %d of %d requests sent today", alarm, requests, cfg.NWSDailyBudget)
+	if cfg.NWSBudgetWebhook == "" {
+		return
+	}
+	body, _ := json.Marshal(budgetAlarm{Alarm: alarm, Day: usageDay(now), Requests: requests, Budget: cfg.NWSDailyBudget})
+	// The alarm is sent in the background so the request to NWS isn't held
+	// up by it
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.NWSBudgetWebhook, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to send NWS budget alarm: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := s.webhooks.Do(req)
+		if err != nil {
+			log.Printf("Failed to send NWS budget alarm: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("NWS budget alarm webhook failed with status: %d", resp.StatusCode)
+		}
+	}()
+}
+
+// budgetResponse is the body of GET /admin/nws-budget
+type budgetResponse struct {
+	Budget      int         `json:"budget"`
+	WarnPercent int         `json:"warnPercent"`
+	Remaining   *int64      `json:"remaining,omitempty"`
+	Days        []budgetDay `json:"days"`
+}
+
+// budgetHandler reports the requests sent to NWS on each of the last seven
+// days, newest first, against the daily budget
+func (s *server) budgetHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := s.state.Config()
+	resp := budgetResponse{Budget: cfg.NWSDailyBudget, WarnPercent: cfg.NWSBudgetWarnPercent, Days: s.budget.history(s.clock.Now())}
+	if cfg.NWSDailyBudget > 0 {
+		remaining := max(int64(cfg.NWSDailyBudget)-resp.Days[0].Requests, 0)
+		resp.Remaining = &remaining
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNWSBudget tests that each alarm is raised once a day as requests
+// approach and reach the budget
+func TestNWSBudget(t *testing.T) {
+	b := newNWSBudget()
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var alarms []string
+	for range 5 {
+		if alarm, _ := b.record(day, 4, 50); alarm != "" {
+			alarms = append(alarms, alarm)
+		}
+	}
+	if strings.Join(alarms, ",") != "warning,exceeded" {
+		t.Errorf("expected a warning and then exceeded, got %q", alarms)
+	}
+
+	if alarm, n := b.record(day.Add(24*time.Hour), 4, 50); alarm != "" || n != 1 {
+		t.Errorf("expected a new day to start over, got %q after %d requests", alarm, n)
+	}
+	if alarm, _ := b.record(day.Add(24*time.Hour), 0, 50); alarm != "" {
+		t.Errorf("expected no alarm without a budget, got %q", alarm)
+	}
+
+	history := b.history(day.Add(72 * time.Hour))
+	if len(history) != 3 || history[0].Requests != 0 || history[1].Requests != 2 || history[2].Requests != 5 {
+		t.Errorf("unexpected history %+v", history)
+	}
+	for i := range 10 {
+		b.record(day.Add(time.Duration(i+2)*24*time.Hour), 4, 50)
+	}
+	if history := b.history(day.Add(11 * 24 * time.Hour)); len(history) != budgetHistoryDays {
+		t.Errorf("expected %d days of history, got %d", budgetHistoryDays, len(history))
+	}
+}
+
+// TestNWSBudgetAlarms tests that requests to NWS are counted and alarms
+// POSTed to the budget webhook
+func TestNWSBudgetAlarms(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSDailyBudget: 2, NWSBudgetWarnPercent: 50, NWSBudgetWebhook: "https://hooks.example.com/nws"})
+	srv.clock = newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv.nws = newFakeDoer(map[string]fakeResponse{"/stations/": {body: `{}`}})
+	alarms := make(chan budgetAlarm, 2)
+	srv.webhooks = doerFunc(func(req *http.Request) (*http.Response, error) {
+		var alarm budgetAlarm
+		json.NewDecoder(req.Body).Decode(&alarm)
+		alarms <- alarm
+		return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	for range 3 {
+		if _, _, _, err := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/stations/KSEA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Alarms are sent in the background, so they may arrive in either order
+	received := map[string]int64{}
+	for range 2 {
+		select {
+		case alarm := <-alarms:
+			if alarm.Budget != 2 {
+				t.Errorf("expected a budget of 2, got %+v", alarm)
+			}
+			received[alarm.Alarm] = alarm.Requests
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected two alarms to be sent")
+		}
+	}
+	if received[budgetAlarmWarning] != 1 || received[budgetAlarmExceeded] != 2 {
+		t.Errorf("expected a warning at 1 request and exceeded at 2, got %v", received)
+	}
+
+	w := httptest.NewRecorder()
+	srv.budgetHandler(w, httptest.NewRequest("GET", "/admin/nws-budget", nil))
+	var resp budgetResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Budget != 2 || resp.Remaining == nil || *resp.Remaining != 0 || len(resp.Days) != 1 || resp.Days[0].Requests != 3 {
+		t.Errorf("unexpected budget %s", w.Body.String())
+	}
+}
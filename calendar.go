@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// calendarLineLength is the longest content line iCalendar allows, in octets,
+// before it must be folded (RFC 5545 section 3.1)
+const calendarLineLength = 75
+
+// calendarWriter builds an iCalendar document
+type calendarWriter struct {
+	b strings.Builder
+}
+
+// line writes a content line, folding it so no line exceeds
+// calendarLineLength octets without splitting a UTF-8 sequence
+func (c *calendarWriter) line(name, value string) {
+	s := name + ":" + value
+	limit := calendarLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		c.b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = calendarLineLength - 1
+	}
+	c.b.WriteString(s + "\r\n")
+}
+
+// calendarText escapes a TEXT value
+func calendarText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// calendarTime formats a time as a UTC DATE-TIME
+func calendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// writeCalendar renders the daily summaries of a point as all-day events and
+// its alerts as timed events
+func writeCalendar(lat, lon float64, days []reportDay, alerts []Alert, now time.Time) string {
+	point := nwsPoint(lat, lon)
+	c := &calendarWriter{}
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//murphybytes//forecast "+build.Version+"//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.line("X-WR-CALNAME", calendarText("Forecast for "+point))
+	// Ask subscribing clients to refresh every few hours
+	c.line("REFRESH-INTERVAL;VALUE=DURATION", "PT3H")
+	c.line("X-PUBLISHED-TTL", "PT3H")
+
+	for _, d := range days {
+		summary := d.Summary
+		if d.HighC != nil {
+			summary += ", high " + reportTemp(d.HighC)
+		}
+		if d.LowC != nil {
+			summary += ", low " + reportTemp(d.LowC)
+		}
+		c.line("BEGIN", "VEVENT")
+		c.line("UID", d.Date.Format("20060102")+"-"+point+"@forecast")
+		c.line("DTSTAMP", calendarTime(now))
+		c.line("DTSTART;VALUE=DATE", d.Date.Format("20060102"))
+		c.line("DTEND;VALUE=DATE", d.Date.AddDate(0, 0, 1).Format("20060102"))
+		c.line("SUMMARY", calendarText(summary))
+		if d.PrecipitationProbability != nil {
+			c.line("DESCRIPTION", calendarText("Chance of precipitation "+reportPrecipitation(d.PrecipitationProbability)))
+		}
+		c.line("TRANSP", "TRANSPARENT")
+		c.line("END", "VEVENT")
+	}
+
+	for _, a := range alerts {
+		c.line("BEGIN", "VEVENT")
+		c.line("UID", a.ID)
+		c.line("DTSTAMP", calendarTime(a.Sent))
+		c.line("DTSTART", calendarTime(a.Onset))
+		c.line("DTEND", calendarTime(a.Ends))
+		c.line("SUMMARY", calendarText(a.Event))
+		c.line("DESCRIPTION", calendarText(a.Headline))
+		c.line("LOCATION", calendarText(a.AreaDesc))
+		c.line("CATEGORIES", "ALERT,"+calendarText(strings.ToUpper(a.Severity)))
+		c.line("TRANSP", "TRANSPARENT")
+		c.line("END", "VEVENT")
+	}
+	c.line("END", "VCALENDAR")
+	return c.b.String()
+}
+
+// calendarHandler serves an iCalendar feed of a point's daily forecast and
+// active alerts for calendar apps to subscribe to. The feed is still served
+// without alerts when they can't be fetched.
+func (s *server) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, false)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	latitude, longitude := parsePoint(lat, lon)
+	alerts, err := s.activeAlerts(r.Context(), nwsPoint(latitude, longitude))
+	if err != nil {
+		log.Printf("Failed to fetch alerts for calendar: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="forecast-%.4f,%.4f.ics"`, latitude, longitude))
+	w.Write([]byte(writeCalendar(latitude, longitude, summarizeDays(periods), alerts, s.clock.Now())))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCalendarLineFolding tests that long lines are folded at 75 octets without splitting characters
+func TestCalendarLineFolding(t *testing.T) {
+	c := &calendarWriter{}
+	c.line("DESCRIPTION", strings.Repeat("é", 80))
+	lines := strings.Split(strings.TrimSuffix(c.b.String(), "\r\n"), "\r\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", lines)
+	}
+	var unfolded string
+	for i, l := range lines {
+		if len(l) > calendarLineLength {
+			t.Errorf("line %d is %d octets", i, len(l))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Errorf("expected continuation line %d to start with a space", i)
+			}
+			l = l[1:]
+		}
+		unfolded += l
+	}
+	if unfolded != "DESCRIPTION:"+strings.Repeat("é", 80) {
+		t.Errorf("unexpected unfolded line %q", unfolded)
+	}
+}
+
+// TestCalendarHandler tests the calendar feed of daily forecasts and alerts
+func TestCalendarHandler(t *testing.T) {
+	alerts := `{"features": [{"properties": {"id": "urn:oid:2.49.0.1.840.0.1", "areaDesc": "Seattle; Bellevue", "event": "Heat Advisory", "severity": "Moderate",
+		"headline": "Heat Advisory, until 8 PM", "sent": "2024-06-01T10:00:00-07:00", "effective": "2024-06-01T10:00:00-07:00", "expires": "2024-06-01T20:00:00-07:00"}}]}`
+	for _, tt := range []struct {
+		name        string
+		alertStatus int
+		expected    []string
+		unexpected  []string
+	}{
+		{
+			name:        "with alerts",
+			alertStatus: http.StatusOK,
+			expected: []string{
+				"BEGIN:VCALENDAR\r\n", "DTSTART;VALUE=DATE:20240601\r\n", "DTEND;VALUE=DATE:20240602\r\n",
+				`SUMMARY:Sunny\, high 27°C / 80°F\, low 13°C / 55°F`, "DESCRIPTION:Chance of precipitation 10%",
+				"UID:urn:oid:2.49.0.1.840.0.1\r\n", "DTSTART:20240601T170000Z\r\n", "DTEND:20240602T030000Z\r\n",
+				`LOCATION:Seattle\; Bellevue`, "END:VCALENDAR\r\n",
+			},
+		},
+		{
+			name:        "alerts unavailable",
+			alertStatus: http.StatusServiceUnavailable,
+			expected:    []string{`SUMMARY:Sunny\, high 27°C / 80°F`},
+			unexpected:  []string{"Heat Advisory"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/alerts/active":
+					if r.URL.Query().Get("point") != "47.6062,-122.3321" {
+						t.Errorf("unexpected alerts point %q", r.URL.Query().Get("point"))
+					}
+					w.WriteHeader(tt.alertStatus)
+					w.Write([]byte(alerts))
+				case "/forecast-url":
+					w.Write([]byte(`{"properties": {"periods": [
+						{"startTime": "2024-06-01T06:00:00-07:00", "isDaytime": true, "shortForecast": "Sunny", "temperature": 80, "temperatureUnit": "F", "probabilityOfPrecipitation": {"value": 10}},
+						{"startTime": "2024-06-01T18:00:00-07:00", "isDaytime": false, "shortForecast": "Clear", "temperature": 55, "temperatureUnit": "F"}
+					]}}`))
+				default:
+					w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast-url"}}`))
+				}
+			}))
+			defer mockNWS.Close()
+			srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+			srv.clock = newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+			w := httptest.NewRecorder()
+			srv.calendarHandler(w, httptest.NewRequest("GET", "/calendar.ics?latitude=47.6062&longitude=-122.3321", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/calendar; charset=utf-8" {
+				t.Errorf("unexpected content type %q", ct)
+			}
+			body := w.Body.String()
+			for _, want := range tt.expected {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected the calendar to contain %q, got %s", want, body)
+				}
+			}
+			for _, unwanted := range tt.unexpected {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("expected the calendar not to contain %q", unwanted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSON field names are camelCase, as the handlers encode them. Consumers that
+// need snake_case ask for it with ?case=snake, or a deployment makes it the
+// default with FORECAST_JSON_CASE, and the names are rewritten as responses
+// are written rather than by every handler.
+const (
+	jsonCaseCamel = "camel"
+	jsonCaseSnake = "snake"
+)
+
+// fieldNamePattern matches the object keys that are field names. Keys that
+// are data, such as location names, rarely look like this and are left alone.
+var fieldNamePattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// parseJSONCase reads the case parameter, falling back to the configured case
+func parseJSONCase(r *http.Request, fallback string) (string, error) {
+	switch c := r.URL.Query().Get("case"); c {
+	case "":
+		return fallback, nil
+	case jsonCaseCamel, jsonCaseSnake:
+		return c, nil
+	default:
+		return "", fmt.Errorf("Invalid case parameter (want %s or %s)", jsonCaseCamel, jsonCaseSnake)
+	}
+}
+
+// snakeCase converts a camelCase field name to snake_case, keeping initialisms
+// together: requestID becomes request_id and htmlURLs becomes html_urls
+func snakeCase(name string) string {
+	if !fieldNamePattern.MatchString(name) {
+		return name
+	}
+	runes := []rune(name)
+	var b []rune
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := !unicode.IsUpper(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !(runes[i+1] == 's' && i+2 == len(runes))
+			if prevLower || nextLower {
+				b = append(b, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b = append(b, r)
+	}
+	return string(b)
+}
+
+// snakeCaseJSON rewrites the field names of a stream of JSON values in
+// snake_case, keeping the order of fields and writing each value on its own
+// line as json.Encoder does
+func snakeCaseJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	// frame is an object or array being written, with the tokens written in
+	// it so far; in an object, even tokens are keys
+	type frame struct {
+		object bool
+		n      int
+	}
+	var stack []frame
+	var out bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && len(stack) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteRune(rune(d))
+			if len(stack) == 0 {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+
+		key := false
+		if len(stack) > 0 {
+			f := &stack[len(stack)-1]
+			key = f.object && f.n%2 == 0
+			switch {
+			case f.object && !key:
+				out.WriteByte(':')
+			case f.n > 0:
+				out.WriteByte(',')
+			}
+			f.n++
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(v))
+			stack = append(stack, frame{object: v == '{'})
+			continue
+		case string:
+			if key {
+				v = snakeCase(v)
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(b)
+		case json.Number:
+			out.WriteString(v.String())
+		case bool:
+			out.WriteString(strconv.FormatBool(v))
+		case nil:
+			out.WriteString("null")
+		}
+		if len(stack) == 0 {
+			out.WriteByte('\n')
+		}
+	}
+}
+
+// snakeCaseWriter buffers a JSON response so its field names can be rewritten
+// once the handler is done. Other responses pass straight through.
+type snakeCaseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffered    bool
+	buf         bytes.Buffer
+}
+
+func (w *snakeCaseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType == "application/json" || mediaType == "application/geo+json" {
+		w.status, w.buffered = status, true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *snakeCaseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffered {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *snakeCaseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes a buffered response with its field names rewritten, or as
+// the handler wrote it if it isn't valid JSON
+func (w *snakeCaseWriter) finish() {
+	if !w.buffered {
+		return
+	}
+	body := w.buf.Bytes()
+	if rewritten, err := snakeCaseJSON(body); err == nil {
+		body = rewritten
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// jsonCasing rewrites the field names of JSON responses in the case the
+// request or configuration asks for. Proxied NWS responses, and those served
+// to cache peers, which parse them as NWS's, are passed on as NWS sent them.
+func (s *server) jsonCasing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/proxy/") || strings.HasPrefix(r.URL.Path, "/peer/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c, err := parseJSONCase(r, s.state.Config().JSONCase)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if c != jsonCaseSnake {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &snakeCaseWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		sw.finish()
+	})
+}
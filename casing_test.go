@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSnakeCase tests converting field names to snake_case
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "forecast", expected: "forecast"},
+		{name: "conditionCode", expected: "condition_code"},
+		{name: "precipitationProbability", expected: "precipitation_probability"},
+		{name: "requestID", expected: "request_id"},
+		{name: "htmlURLs", expected: "html_urls"},
+		{name: "signedUrls", expected: "signed_urls"},
+		{name: "p90High", expected: "p90_high"},
+		{name: "Home Office", expected: "Home Office"},
+		{name: "/points/*", expected: "/points/*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snakeCase(tt.name); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSnakeCaseJSON tests rewriting field names while keeping values and the
+// order of fields
+func TestSnakeCaseJSON(t *testing.T) {
+	body := `{"zoneId":"WAZ558","apiVersion":"1","counts":{"dailyHigh":12.50,"Home":1},"periods":[{"startTime":"2024-06-01","isDaytime":true,"note":null}],"tags":["camelCase"]}
+{"nextCursor":""}
+`
+	expected := `{"zone_id":"WAZ558","api_version":"1","counts":{"daily_high":12.50,"Home":1},"periods":[{"start_time":"2024-06-01","is_daytime":true,"note":null}],"tags":["camelCase"]}
+{"next_cursor":""}
+`
+	got, err := snakeCaseJSON([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if _, err := snakeCaseJSON([]byte(`{"a":`)); err == nil {
+		t.Error("expected an error for truncated JSON")
+	}
+}
+
+// TestJSONCasing tests selecting the case of JSON responses by parameter and
+// configuration, leaving other formats alone
+func TestJSONCasing(t *testing.T) {
+	body := `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`
+	tests := []struct {
+		name     string
+		jsonCase string
+		query    string
+		status   int
+		contains string
+	}{
+		{name: "default", query: "", status: http.StatusOK, contains: `"conditionCode"`},
+		{name: "snake parameter", query: "&case=snake", status: http.StatusOK, contains: `"condition_code"`},
+		{name: "snake configured", jsonCase: jsonCaseSnake, status: http.StatusOK, contains: `"condition_code"`},
+		{name: "camel overrides configuration", jsonCase: jsonCaseSnake, query: "&case=camel", status: http.StatusOK, contains: `"conditionCode"`},
+		{name: "xml unchanged", query: "&case=snake&format=xml", status: http.StatusOK, contains: "<conditionCode>"},
+		{name: "invalid", query: "&case=kebab", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.NWSAPIHost = fakeNWSHost
+			if tt.jsonCase != "" {
+				cfg.JSONCase = tt.jsonCase
+			}
+			srv := newServer(cfg)
+			srv.nws = newFakeNWSDoer(fakeResponse{body: body})
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.contains != "" && !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("expected %s in %s", tt.contains, w.Body.String())
+			}
+		})
+	}
+}
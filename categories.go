@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// categoryScale maps a numeric value onto ordered category labels. A value up to
+// and including Bounds[i] maps to Labels[i]; anything above the last bound maps
+// to the last label, so a scale has exactly one more label than bounds.
+type categoryScale struct {
+	Bounds []int
+	Labels []string
+}
+
+var (
+	// temperatureScale buckets temperatures in °F
+	temperatureScale = categoryScale{
+		Bounds: []int{30, 79},
+		Labels: []string{"cold", "moderate", "hot"},
+	}
+
+	// windScale buckets sustained wind speeds in mph
+	windScale = categoryScale{
+		Bounds: []int{5, 15, 30},
+		Labels: []string{"calm", "breezy", "windy", "strong"},
+	}
+
+	// precipitationScale buckets probability of precipitation in percent
+	precipitationScale = categoryScale{
+		Bounds: []int{20, 60},
+		Labels: []string{"unlikely", "possible", "likely"},
+	}
+)
+
+// category returns the label for a value
+func (s categoryScale) category(v int) string {
+	for i, bound := range s.Bounds {
+		if v <= bound {
+			return s.Labels[i]
+		}
+	}
+	return s.Labels[len(s.Labels)-1]
+}
+
+// parseCategoryScale parses a scale written as labels each followed by the
+// highest value in its bucket, ending with the label for anything higher, such
+// as "cold:30,moderate:79,hot"
+func parseCategoryScale(spec string) (categoryScale, error) {
+	var s categoryScale
+	buckets := strings.Split(spec, ",")
+	for i, bucket := range buckets {
+		label, bound, bounded := strings.Cut(bucket, ":")
+		s.Labels = append(s.Labels, strings.TrimSpace(label))
+		if i == len(buckets)-1 {
+			if bounded {
+				return categoryScale{}, fmt.Errorf("the last bucket, %q, must not have a bound", strings.TrimSpace(bucket))
+			}
+			break
+		}
+		if !bounded {
+			return categoryScale{}, fmt.Errorf("bucket %q needs a bound, such as %s:30", strings.TrimSpace(bucket), strings.TrimSpace(label))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(bound))
+		if err != nil {
+			return categoryScale{}, fmt.Errorf("invalid bound %q for %s", strings.TrimSpace(bound), strings.TrimSpace(label))
+		}
+		s.Bounds = append(s.Bounds, n)
+	}
+	if err := s.validate(); err != nil {
+		return categoryScale{}, err
+	}
+	return s, nil
+}
+
+// String formats a scale as parseCategoryScale parses it
+func (s categoryScale) String() string {
+	var b strings.Builder
+	for i, bound := range s.Bounds {
+		fmt.Fprintf(&b, "%s:%d,", s.Labels[i], bound)
+	}
+	b.WriteString(s.Labels[len(s.Labels)-1])
+	return b.String()
+}
+
+// validate checks that bounds are strictly increasing and that every bucket has
+// a distinct, non-empty label
+func (s categoryScale) validate() error {
+	if len(s.Labels) != len(s.Bounds)+1 {
+		return fmt.Errorf("scale needs %d labels for %d bounds, got %d", len(s.Bounds)+1, len(s.Bounds), len(s.Labels))
+	}
+	for i := 1; i < len(s.Bounds); i++ {
+		if s.Bounds[i] <= s.Bounds[i-1] {
+			return fmt.Errorf("bounds must be strictly increasing: %d follows %d", s.Bounds[i], s.Bounds[i-1])
+		}
+	}
+	seen := make(map[string]bool, len(s.Labels))
+	for _, label := range s.Labels {
+		if label == "" {
+			return fmt.Errorf("labels must not be empty")
+		}
+		if seen[label] {
+			return fmt.Errorf("duplicate label %q", label)
+		}
+		seen[label] = true
+	}
+	return nil
+}
+
+// temperatureCategories is how temperatures are categorized, parsed from the
+// configuration once when it's loaded rather than for every period
+type temperatureCategories struct {
+	scale categoryScale
+	rules []categoryRule
+}
+
+// parseTemperatureCategories parses the temperature categories of cfg and
+// compiles its rules
+func parseTemperatureCategories(cfg Config) (*temperatureCategories, error) {
+	scale, err := parseCategoryScale(cfg.TemperatureCategories)
+	if err != nil {
+		return nil, fmt.Errorf("invalid temperature categories %q: %v", cfg.TemperatureCategories, err)
+	}
+	rules, err := parseCategoryRules(cfg.TemperatureRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid temperature rules: %v", err)
+	}
+	return &temperatureCategories{scale: scale, rules: rules}, nil
+}
+
+// mapTemperature maps a temperature in °F to a category of the configured
+// scale, cold/moderate/hot by default
+func (s *server) mapTemperature(temp int) string {
+	return s.categories.Load().scale.category(temp)
+}
+
+// categoryExprVars are the variables of temperature category rules
+var categoryExprVars = map[string]exprType{
+	"temperatureC":             exprNumber,
+	"tempC":                    exprNumber,
+	"temperatureF":             exprNumber,
+	"tempF":                    exprNumber,
+	"windSpeedKph":             exprNumber,
+	"windSpeedMph":             exprNumber,
+	"precipitationProbability": exprNumber,
+	"pop":                      exprNumber,
+	"forecast":                 exprString,
+	"condition":                exprString,
+}
+
+// categoryRule labels the temperature of periods satisfying its expression
+type categoryRule struct {
+	label string
+	expr  *expression
+}
+
+// parseCategoryRules parses rules separated by semicolons, each a label and
+// the expression it's given for, such as "cold: tempF < 40 && windSpeedMph >
+// 15; hot: tempF >= 95"
+func parseCategoryRules(spec string) ([]categoryRule, error) {
+	var rules []categoryRule
+	for _, rule := range strings.Split(spec, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		label, src, ok := strings.Cut(rule, ":")
+		label = strings.TrimSpace(label)
+		if !ok || label == "" {
+			return nil, fmt.Errorf("rule %q needs a label, such as cold: tempF < 40", strings.TrimSpace(rule))
+		}
+		expr, err := compileExpr(strings.TrimSpace(src), categoryExprVars)
+		if err != nil {
+			return nil, fmt.Errorf("rule for %s: %v", label, err)
+		}
+		rules = append(rules, categoryRule{label: label, expr: expr})
+	}
+	return rules, nil
+}
+
+// temperatureCategory categorizes a period's temperature by the label of the
+// first configured rule it satisfies, or by the scale when it satisfies none.
+// A rule needing a value the period doesn't have isn't satisfied.
+func (s *server) temperatureCategory(p weatherPeriod) string {
+	categories := s.categories.Load()
+	if len(categories.rules) > 0 {
+		env := scoreExprEnv(p)
+		env["forecast"] = p.Summary
+		for _, rule := range categories.rules {
+			if ok, err := rule.expr.eval(env); err == nil && ok {
+				return rule.label
+			}
+		}
+	}
+	return categories.scale.category(roundInt(celsiusToFahrenheit(p.TemperatureC)))
+}
+
+// mapWind maps an NWS wind speed such as "10 mph" or "5 to 15 mph" to a wind
+// category using the highest speed given. It returns "" if the speed can't be parsed.
+func mapWind(windSpeed string) string {
+	speed, ok := parseWindSpeed(windSpeed)
+	if !ok {
+		return ""
+	}
+	return windScale.category(speed)
+}
+
+// mapPrecipitation maps a probability of precipitation to a category. NWS
+// reports null when it has no value, in which case it returns "".
+func mapPrecipitation(probability *int) string {
+	if probability == nil {
+		return ""
+	}
+	return precipitationScale.category(*probability)
+}
+
+// periodOutput maps a normalized period to the categories of the API response
+func (s *server) periodOutput(p weatherPeriod) ForecastOutput {
+	out := ForecastOutput{
+		Forecast:      p.Summary,
+		ConditionCode: string(p.Condition),
+		Temperature:   s.temperatureCategory(p),
+		Precipitation: mapPrecipitation(p.PrecipitationProbability),
+	}
+	if p.WindSpeedKPH != nil {
+		out.Wind = windScale.category(roundInt(kphToMPH(*p.WindSpeedKPH)))
+	}
+	return out
+}
+
+// parseWindSpeed extracts the highest speed in mph from an NWS wind speed string
+func parseWindSpeed(s string) (int, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || fields[len(fields)-1] != "mph" {
+		return 0, false
+	}
+	highest, found := 0, false
+	for _, f := range fields[:len(fields)-1] {
+		if n, err := strconv.Atoi(f); err == nil {
+			if !found || n > highest {
+				highest = n
+			}
+			found = true
+		}
+	}
+	return highest, found
+}
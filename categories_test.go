@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"pgregory.net/rapid"
+)
+
+// categoryScales lists every scale the service categorizes with
+var categoryScales = map[string]categoryScale{
+	"temperature":   temperatureScale,
+	"wind":          windScale,
+	"precipitation": precipitationScale,
+	"beaufort":      beaufortScale,
+}
+
+// TestCategoryScalesValid tests that every built-in scale is well formed
+func TestCategoryScalesValid(t *testing.T) {
+	for name, scale := range categoryScales {
+		t.Run(name, func(t *testing.T) {
+			if err := scale.validate(); err != nil {
+				t.Errorf("invalid scale: %v", err)
+			}
+		})
+	}
+}
+
+// TestCategoryScaleProperties checks invariants every threshold mapper must hold
+// for arbitrary inputs: each value maps to exactly one known label, labels never
+// go down as the value goes up, and the label only changes at a bound.
+func TestCategoryScaleProperties(t *testing.T) {
+	for name, scale := range categoryScales {
+		t.Run(name, func(t *testing.T) {
+			rank := make(map[string]int, len(scale.Labels))
+			for i, label := range scale.Labels {
+				rank[label] = i
+			}
+			// Values next to the bounds, where a mapper goes wrong, are drawn
+			// as often as arbitrary ones
+			var near []int
+			for _, bound := range scale.Bounds {
+				near = append(near, bound-1, bound, bound+1)
+			}
+			value := rapid.OneOf(rapid.Int(), rapid.SampledFrom(near))
+
+			rapid.Check(t, func(t *rapid.T) {
+				v := value.Draw(t, "v")
+				r, ok := rank[scale.category(v)]
+				if !ok {
+					t.Fatalf("category(%d) = %q, not a label", v, scale.category(v))
+				}
+				// The value lies in exactly the bucket its label names
+				lower := math.MinInt
+				if r > 0 {
+					lower = scale.Bounds[r-1] + 1
+				}
+				upper := math.MaxInt
+				if r < len(scale.Bounds) {
+					upper = scale.Bounds[r]
+				}
+				if v < lower || v > upper {
+					t.Fatalf("category(%d) = %q, which covers %d to %d", v, scale.Labels[r], lower, upper)
+				}
+			})
+
+			rapid.Check(t, func(t *rapid.T) {
+				a, b := value.Draw(t, "a"), value.Draw(t, "b")
+				if a > b {
+					a, b = b, a
+				}
+				if rank[scale.category(a)] > rank[scale.category(b)] {
+					t.Fatalf("category(%d) = %q is above category(%d) = %q", a, scale.category(a), b, scale.category(b))
+				}
+			})
+
+			rapid.Check(t, func(t *rapid.T) {
+				x := value.Filter(func(v int) bool { return v < math.MaxInt }).Draw(t, "x")
+				changed := scale.category(x) != scale.category(x+1)
+				if isBound := slices.Contains(scale.Bounds, x); changed != isBound {
+					t.Fatalf("category changes between %d and %d: %v, expected %v", x, x+1, changed, isBound)
+				}
+			})
+
+			// Every label is reachable
+			for i, bound := range scale.Bounds {
+				if got := scale.category(bound); got != scale.Labels[i] {
+					t.Errorf("category(%d) = %q, expected %q", bound, got, scale.Labels[i])
+				}
+			}
+			last := scale.Labels[len(scale.Labels)-1]
+			if got := scale.category(math.MaxInt); got != last {
+				t.Errorf("category(max) = %q, expected %q", got, last)
+			}
+		})
+	}
+}
+
+// TestCategoryScaleValidate tests rejection of malformed scales
+func TestCategoryScaleValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		scale categoryScale
+	}{
+		{name: "too few labels", scale: categoryScale{Bounds: []int{10, 20}, Labels: []string{"a", "b"}}},
+		{name: "too many labels", scale: categoryScale{Bounds: []int{10}, Labels: []string{"a", "b", "c"}}},
+		{name: "decreasing bounds", scale: categoryScale{Bounds: []int{20, 10}, Labels: []string{"a", "b", "c"}}},
+		{name: "overlapping bounds", scale: categoryScale{Bounds: []int{10, 10}, Labels: []string{"a", "b", "c"}}},
+		{name: "duplicate label", scale: categoryScale{Bounds: []int{10}, Labels: []string{"a", "a"}}},
+		{name: "empty label", scale: categoryScale{Bounds: []int{10}, Labels: []string{"a", ""}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.scale.validate(); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+// TestParseCategoryScale tests parsing configured scales
+func TestParseCategoryScale(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected categoryScale
+		err      bool
+	}{
+		{spec: "cold:30,moderate:79,hot", expected: temperatureScale},
+		{spec: " frigid : -10 , cold:40, hot ", expected: categoryScale{Bounds: []int{-10, 40}, Labels: []string{"frigid", "cold", "hot"}}},
+		{spec: "any", expected: categoryScale{Labels: []string{"any"}}},
+		{spec: "", err: true},
+		{spec: "cold:30,hot:80", err: true},
+		{spec: "cold,hot", err: true},
+		{spec: "cold:freezing,hot", err: true},
+		{spec: "hot:80,cold:30,mild", err: true},
+		{spec: "cold:30,cold", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseCategoryScale(tt.spec)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got.Bounds, tt.expected.Bounds) || !slices.Equal(got.Labels, tt.expected.Labels) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+	if got := temperatureScale.String(); got != "cold:30,moderate:79,hot" {
+		t.Errorf("expected the scale to format as it parses, got %q", got)
+	}
+}
+
+// TestTemperatureCategoryRules tests labelling temperatures by configured
+// rules ahead of the scale
+func TestTemperatureCategoryRules(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TemperatureRules = "cold: tempF < 40 && windSpeedMph > 15; snowy: forecast contains 'snow'; muggy: tempF >= 75 && pop >= 60"
+	srv := newServer(cfg)
+	wind := func(mph float64) *float64 { kph := mphToKPH(mph); return &kph }
+	pop := func(v int) *int { return &v }
+	tests := []struct {
+		name     string
+		p        weatherPeriod
+		expected string
+	}{
+		{name: "wind chill", p: weatherPeriod{TemperatureC: 3, WindSpeedKPH: wind(20)}, expected: "cold"},
+		{name: "calm", p: weatherPeriod{TemperatureC: 3, WindSpeedKPH: wind(5)}, expected: "moderate"},
+		{name: "forecast text", p: weatherPeriod{TemperatureC: -5, Summary: "Chance Snow Showers"}, expected: "snowy"},
+		{name: "muggy", p: weatherPeriod{TemperatureC: 27, PrecipitationProbability: pop(70)}, expected: "muggy"},
+		// Without a wind speed or chance of precipitation no rule applies
+		{name: "unknown values", p: weatherPeriod{TemperatureC: 30}, expected: "hot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := srv.temperatureCategory(tt.p); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseCategoryRules tests rejecting malformed temperature rules
+func TestParseCategoryRules(t *testing.T) {
+	tests := []struct {
+		spec  string
+		rules int
+		err   string
+	}{
+		{spec: ""},
+		{spec: "cold: tempF < 40;", rules: 1},
+		{spec: "tempF < 40", err: "needs a label"},
+		{spec: ": tempF < 40", err: "needs a label"},
+		{spec: "cold: tempF", err: "not a condition"},
+		{spec: "cold: hour < 6", err: "unknown variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rules, err := parseCategoryRules(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || len(rules) != tt.rules {
+				t.Errorf("expected %d rules, got %d, %v", tt.rules, len(rules), err)
+			}
+		})
+	}
+}
+
+// TestMapWind tests parsing NWS wind speed strings into categories
+func TestMapWind(t *testing.T) {
+	tests := []struct {
+		windSpeed string
+		expected  string
+	}{
+		{windSpeed: "0 mph", expected: "calm"},
+		{windSpeed: "5 mph", expected: "calm"},
+		{windSpeed: "10 mph", expected: "breezy"},
+		{windSpeed: "5 to 20 mph", expected: "windy"},
+		{windSpeed: "35 mph", expected: "strong"},
+		{windSpeed: "", expected: ""},
+		{windSpeed: "10 km/h", expected: ""},
+		{windSpeed: "gusty mph", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.windSpeed), func(t *testing.T) {
+			if got := mapWind(tt.windSpeed); got != tt.expected {
+				t.Errorf("mapWind(%q) = %q, expected %q", tt.windSpeed, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMapPrecipitation tests probability of precipitation categories
+func TestMapPrecipitation(t *testing.T) {
+	value := func(v int) *int { return &v }
+
+	tests := []struct {
+		name        string
+		probability *int
+		expected    string
+	}{
+		{name: "null", probability: nil, expected: ""},
+		{name: "0", probability: value(0), expected: "unlikely"},
+		{name: "20", probability: value(20), expected: "unlikely"},
+		{name: "21", probability: value(21), expected: "possible"},
+		{name: "60", probability: value(60), expected: "possible"},
+		{name: "100", probability: value(100), expected: "likely"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapPrecipitation(tt.probability); got != tt.expected {
+				t.Errorf("mapPrecipitation = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
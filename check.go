@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// checkTimeout bounds each network check of `forecast check`
+const checkTimeout = 10 * time.Second
+
+// Outcomes of a check
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// checkResult is the outcome of one check of `forecast check`
+type checkResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// checkNWS fetches the root of the NWS API
+func checkNWS(ctx context.Context, host string) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/", nil)
+	if err != nil {
+		return checkResult{"nws", checkFail, err.Error()}
+	}
+	req.Header.Set("User-Agent", userAgent)
+	start := time.Now()
+	resp, err := nwsClient.Do(req)
+	if err != nil {
+		return checkResult{"nws", checkFail, err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return checkResult{"nws", checkFail, fmt.Sprintf("%s returned status: %d", host, resp.StatusCode)}
+	}
+	return checkResult{"nws", checkOK, fmt.Sprintf("%s responded in %v", host, time.Since(start).Round(time.Millisecond))}
+}
+
+// checkDatabase connects to the database and reports migrations that haven't
+// been applied, returning the store for later checks
+func checkDatabase(ctx context.Context, cfg Config) (checkResult, *sqlStore) {
+	store, err := openConfiguredStore(cfg)
+	if err != nil {
+		return checkResult{"database", checkFail, err.Error()}, nil
+	}
+	migrations, err := loadMigrations(store.dialect)
+	if err != nil {
+		store.Close()
+		return checkResult{"database", checkFail, err.Error()}, nil
+	}
+	applied, err := store.appliedMigrations(ctx)
+	if err != nil {
+		store.Close()
+		return checkResult{"database", checkFail, err.Error()}, nil
+	}
+	pending := 0
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return checkResult{"database", checkFail, fmt.Sprintf("%d pending migrations; run forecast migrate", pending)}, store
+	}
+	return checkResult{"database", checkOK, fmt.Sprintf("%s schema at version %d", store.dialect.name, migrations[len(migrations)-1].Version)}, store
+}
+
+// checkOIDC fetches the signing keys of the OIDC issuer
+func checkOIDC(ctx context.Context, cfg Config) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	keys, err := newOIDCVerifier(cfg).fetchKeys(ctx)
+	if err != nil {
+		return checkResult{"oidc", checkFail, err.Error()}
+	}
+	return checkResult{"oidc", checkOK, fmt.Sprintf("%d signing keys from %s", len(keys), cfg.OIDCIssuer)}
+}
+
+// checkArchive writes, reads back, and deletes a probe blob in the archive
+// blob store
+func checkArchive(ctx context.Context, archiveURL string) checkResult {
+	blobs, err := openBlobStore(archiveURL)
+	if err != nil {
+		return checkResult{"archive", checkFail, err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	const key = ".forecast-check"
+	probe := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+	if err := blobs.Put(ctx, key, probe, "text/plain"); err != nil {
+		return checkResult{"archive", checkFail, fmt.Sprintf("write failed: %v", err)}
+	}
+	if data, err := blobs.Get(ctx, key); err != nil || string(data) != string(probe) {
+		return checkResult{"archive", checkFail, fmt.Sprintf("read back failed: %v", err)}
+	}
+	if err := blobs.Delete(ctx, key); err != nil {
+		return checkResult{"archive", checkFail, fmt.Sprintf("delete failed: %v", err)}
+	}
+	return checkResult{"archive", checkOK, "wrote, read, and deleted a probe blob"}
+}
+
+// checkWebhooks connects to the host of every subscription's webhook. The
+// hosts belong to subscribers, so one that can't be reached is a warning
+// rather than a failure.
+func checkWebhooks(ctx context.Context, store Store) checkResult {
+	subs, err := store.ListSubscriptions(ctx, "")
+	if err != nil {
+		return checkResult{"webhooks", checkFail, err.Error()}
+	}
+	hosts := make(map[string]bool)
+	var unreachable []error
+	dialer := &net.Dialer{Timeout: checkTimeout}
+	for _, sub := range subs {
+		u, err := url.Parse(sub.WebhookURL)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Errorf("subscription %d: %v", sub.ID, err))
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+			if u.Scheme == "http" {
+				port = "80"
+			}
+		}
+		addr := net.JoinHostPort(u.Hostname(), port)
+		if hosts[addr] {
+			continue
+		}
+		hosts[addr] = true
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			unreachable = append(unreachable, err)
+			continue
+		}
+		conn.Close()
+	}
+	if len(unreachable) > 0 {
+		return checkResult{"webhooks", checkWarn, fmt.Sprintf("%d of %d hosts unreachable: %v", len(unreachable), len(hosts), errors.Join(unreachable...))}
+	}
+	return checkResult{"webhooks", checkOK, fmt.Sprintf("%d hosts reachable for %d subscriptions", len(hosts), len(subs))}
+}
+
+// runChecks checks everything the server depends on with cfg: its TLS files,
+// NWS, the database, the OIDC issuer, the archive blob store, and the webhooks
+// notifications are delivered to. Checks of unconfigured features are skipped.
+func runChecks(ctx context.Context, cfg Config) []checkResult {
+	var results []checkResult
+	if cfg.TLSCertFile == "" {
+		results = append(results, checkResult{"tls", checkSkip, "not configured"})
+	} else if _, err := tlsConfig(cfg, cfg.ClientAuth != ""); err != nil {
+		results = append(results, checkResult{"tls", checkFail, err.Error()})
+	} else {
+		results = append(results, checkResult{"tls", checkOK, "certificate and key loaded"})
+	}
+
+	results = append(results, checkNWS(ctx, cfg.NWSAPIHost))
+
+	var store *sqlStore
+	if cfg.DatabaseURL == "" {
+		results = append(results, checkResult{"database", checkSkip, "not configured"})
+	} else {
+		var result checkResult
+		result, store = checkDatabase(ctx, cfg)
+		results = append(results, result)
+	}
+
+	if cfg.OIDCIssuer == "" {
+		results = append(results, checkResult{"oidc", checkSkip, "not configured"})
+	} else {
+		results = append(results, checkOIDC(ctx, cfg))
+	}
+
+	if cfg.ArchiveURL == "" {
+		results = append(results, checkResult{"archive", checkSkip, "not configured"})
+	} else {
+		results = append(results, checkArchive(ctx, cfg.ArchiveURL))
+	}
+
+	if store == nil {
+		results = append(results, checkResult{"webhooks", checkSkip, "no database"})
+	} else {
+		results = append(results, checkWebhooks(ctx, store))
+		store.Close()
+	}
+	return results
+}
+
+// runCheckCommand implements `forecast check`, which validates the
+// configuration and the services it names and fails if any check fails
+func runCheckCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("check", flag.ContinueOnError)
+	fset.SetOutput(out)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, build)
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(out, "%-5s %-9s %v\n", checkFail, "config", err)
+		return fmt.Errorf("check failed")
+	}
+	fmt.Fprintf(out, "%-5s %-9s %s\n", checkOK, "config", "loaded")
+
+	failed := 0
+	for _, r := range runChecks(context.Background(), cfg) {
+		fmt.Fprintf(out, "%-5s %-9s %s\n", r.Status, r.Name, r.Detail)
+		if r.Status == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
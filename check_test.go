@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunChecks tests diagnosing the services a configuration depends on
+func TestRunChecks(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "OK"}`))
+	}))
+	defer mockNWS.Close()
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+	// A port that was just released is very likely to refuse connections
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedURL := "http://" + closed.Addr().String() + "/hook"
+	closed.Close()
+
+	dir := t.TempDir()
+	migrated := "sqlite://" + filepath.Join(dir, "migrated.db")
+	store := openMigratedStore(t, migrated)
+	for _, hookURL := range []string{hook.URL, closedURL} {
+		if err := store.CreateSubscription(context.Background(), &Subscription{Owner: "alice", WebhookURL: hookURL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected map[string]string
+	}{
+		{
+			name: "defaults",
+			cfg:  Config{NWSAPIHost: mockNWS.URL},
+			expected: map[string]string{
+				"tls": checkSkip, "nws": checkOK, "database": checkSkip,
+				"oidc": checkSkip, "archive": checkSkip, "webhooks": checkSkip,
+			},
+		},
+		{
+			name: "everything working",
+			cfg:  Config{NWSAPIHost: mockNWS.URL, DatabaseURL: migrated, ArchiveURL: "file://" + filepath.Join(dir, "archive")},
+			expected: map[string]string{
+				"nws": checkOK, "database": checkOK, "archive": checkOK, "webhooks": checkWarn,
+			},
+		},
+		{
+			name: "failures",
+			cfg: Config{
+				NWSAPIHost:  closedURL,
+				DatabaseURL: "sqlite://" + filepath.Join(dir, "empty.db"),
+				TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: filepath.Join(dir, "missing.key"),
+				ArchiveURL: "ftp://archive",
+			},
+			expected: map[string]string{
+				"tls": checkFail, "nws": checkFail, "database": checkFail, "archive": checkFail,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, r := range runChecks(context.Background(), tt.cfg) {
+				got[r.Name] = r.Status
+			}
+			for name, status := range tt.expected {
+				if got[name] != status {
+					t.Errorf("expected %s to be %s, got %s", name, status, got[name])
+				}
+			}
+		})
+	}
+}
+
+// TestCheckCommand tests the report and exit status of forecast check
+func TestCheckCommand(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mockNWS.Close()
+
+	t.Setenv("FORECAST_NWS_HOST", mockNWS.URL)
+	var out bytes.Buffer
+	if err := runCheckCommand(nil, &out); err != nil {
+		t.Fatalf("expected checks to pass, got %v:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "ok    nws") {
+		t.Errorf("expected an nws line, got:\n%s", out.String())
+	}
+
+	t.Setenv("FORECAST_ARCHIVE_FORMAT", "xlsx")
+	out.Reset()
+	if err := runCheckCommand(nil, &out); err == nil {
+		t.Error("expected invalid configuration to fail")
+	}
+	if !strings.Contains(out.String(), "fail  config") {
+		t.Errorf("expected a config failure, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cityPreset is a city a request can name with the city parameter in place
+// of its coordinates
+type cityPreset struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// cityPresets are major US cities by ID, each at its downtown, so demos and
+// quick integrations can ask for ?city=chicago without a geocoder. Where two
+// cities share a name, the larger has the plain ID.
+var cityPresets = func() map[string]cityPreset {
+	presets := map[string]cityPreset{}
+	for _, c := range []cityPreset{
+		{Name: "Albuquerque, NM", Latitude: 35.0844, Longitude: -106.6504},
+		{Name: "Anchorage, AK", Latitude: 61.2181, Longitude: -149.9003},
+		{Name: "Atlanta, GA", Latitude: 33.7490, Longitude: -84.3880},
+		{Name: "Austin, TX", Latitude: 30.2672, Longitude: -97.7431},
+		{Name: "Baltimore, MD", Latitude: 39.2904, Longitude: -76.6122},
+		{Name: "Boise, ID", Latitude: 43.6150, Longitude: -116.2023},
+		{Name: "Boston, MA", Latitude: 42.3601, Longitude: -71.0589},
+		{Name: "Buffalo, NY", Latitude: 42.8864, Longitude: -78.8784},
+		{Name: "Charlotte, NC", Latitude: 35.2271, Longitude: -80.8431},
+		{Name: "Chicago, IL", Latitude: 41.8781, Longitude: -87.6298},
+		{Name: "Cleveland, OH", Latitude: 41.4993, Longitude: -81.6944},
+		{Name: "Columbus, OH", Latitude: 39.9612, Longitude: -82.9988},
+		{Name: "Dallas, TX", Latitude: 32.7767, Longitude: -96.7970},
+		{Name: "Denver, CO", Latitude: 39.7392, Longitude: -104.9903},
+		{Name: "Detroit, MI", Latitude: 42.3314, Longitude: -83.0458},
+		{Name: "El Paso, TX", Latitude: 31.7619, Longitude: -106.4850},
+		{Name: "Fort Worth, TX", Latitude: 32.7555, Longitude: -97.3308},
+		{Name: "Fresno, CA", Latitude: 36.7378, Longitude: -119.7871},
+		{Name: "Honolulu, HI", Latitude: 21.3069, Longitude: -157.8583},
+		{Name: "Houston, TX", Latitude: 29.7604, Longitude: -95.3698},
+		{Name: "Indianapolis, IN", Latitude: 39.7684, Longitude: -86.1581},
+		{Name: "Jacksonville, FL", Latitude: 30.3322, Longitude: -81.6557},
+		{Name: "Kansas City, MO", Latitude: 39.0997, Longitude: -94.5786},
+		{Name: "Las Vegas, NV", Latitude: 36.1699, Longitude: -115.1398},
+		{Name: "Los Angeles, CA", Latitude: 34.0522, Longitude: -118.2437},
+		{Name: "Louisville, KY", Latitude: 38.2527, Longitude: -85.7585},
+		{Name: "Memphis, TN", Latitude: 35.1495, Longitude: -90.0490},
+		{Name: "Miami, FL", Latitude: 25.7617, Longitude: -80.1918},
+		{Name: "Milwaukee, WI", Latitude: 43.0389, Longitude: -87.9065},
+		{Name: "Minneapolis, MN", Latitude: 44.9778, Longitude: -93.2650},
+		{Name: "Nashville, TN", Latitude: 36.1627, Longitude: -86.7816},
+		{Name: "New Orleans, LA", Latitude: 29.9511, Longitude: -90.0715},
+		{Name: "New York, NY", Latitude: 40.7128, Longitude: -74.0060},
+		{Name: "Oklahoma City, OK", Latitude: 35.4676, Longitude: -97.5164},
+		{Name: "Omaha, NE", Latitude: 41.2565, Longitude: -95.9345},
+		{Name: "Philadelphia, PA", Latitude: 39.9526, Longitude: -75.1652},
+		{Name: "Phoenix, AZ", Latitude: 33.4484, Longitude: -112.0740},
+		{Name: "Pittsburgh, PA", Latitude: 40.4406, Longitude: -79.9959},
+		{Name: "Portland, OR", Latitude: 45.5152, Longitude: -122.6784},
+		{ID: "portland-me", Name: "Portland, ME", Latitude: 43.6591, Longitude: -70.2568},
+		{Name: "Raleigh, NC", Latitude: 35.7796, Longitude: -78.6382},
+		{Name: "Sacramento, CA", Latitude: 38.5816, Longitude: -121.4944},
+		{Name: "Salt Lake City, UT", Latitude: 40.7608, Longitude: -111.8910},
+		{Name: "San Antonio, TX", Latitude: 29.4241, Longitude: -98.4936},
+		{Name: "San Diego, CA", Latitude: 32.7157, Longitude: -117.1611},
+		{Name: "San Francisco, CA", Latitude: 37.7749, Longitude: -122.4194},
+		{Name: "San Jose, CA", Latitude: 37.3382, Longitude: -121.8863},
+		{Name: "Seattle, WA", Latitude: 47.6062, Longitude: -122.3321},
+		{Name: "St. Louis, MO", Latitude: 38.6270, Longitude: -90.1994},
+		{Name: "Tampa, FL", Latitude: 27.9506, Longitude: -82.4572},
+		{Name: "Tucson, AZ", Latitude: 32.2226, Longitude: -110.9747},
+		{Name: "Washington, DC", Latitude: 38.9072, Longitude: -77.0369},
+	} {
+		if c.ID == "" {
+			city, _, _ := strings.Cut(c.Name, ",")
+			c.ID = cityID(city)
+		}
+		presets[c.ID] = c
+	}
+	return presets
+}()
+
+// cityID returns the ID a city's name is looked up by: lower case, with each
+// run of spaces and punctuation replaced by a hyphen, so "St. Louis" and
+// "st-louis" are the same city
+func cityID(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// cityPoint resolves the preset of a request's city parameter to its point,
+// writing the error response and returning false when there's no such preset
+func cityPoint(w http.ResponseWriter, city string) (lat, lon string, ok bool) {
+	c, found := cityPresets[cityID(city)]
+	if !found {
+		http.Error(w, "City not found (see /cities for the presets)", http.StatusNotFound)
+		return "", "", false
+	}
+	return strconv.FormatFloat(c.Latitude, 'f', 4, 64), strconv.FormatFloat(c.Longitude, 'f', 4, 64), true
+}
+
+// citiesResponse is the body of GET /cities
+type citiesResponse struct {
+	Cities []cityPreset `json:"cities"`
+}
+
+// citiesHandler lists the city presets by ID
+func citiesHandler(w http.ResponseWriter, r *http.Request) {
+	resp := citiesResponse{Cities: []cityPreset{}}
+	for _, id := range slices.Sorted(maps.Keys(cityPresets)) {
+		resp.Cities = append(resp.Cities, cityPresets[id])
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCityID tests that spellings of a city's name share its ID
+func TestCityID(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "chicago", expected: "chicago"},
+		{name: "New York", expected: "new-york"},
+		{name: "St. Louis", expected: "st-louis"},
+		{name: "  salt_lake   city ", expected: "salt-lake-city"},
+	}
+	for _, tt := range tests {
+		if got := cityID(tt.name); got != tt.expected {
+			t.Errorf("expected %q for %q, got %q", tt.expected, tt.name, got)
+		}
+	}
+}
+
+// TestCityForecast tests forecasting for a city preset
+func TestCityForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedPoint  string
+	}{
+		{name: "city", path: "/forecast?city=chicago", expectedStatus: http.StatusOK, expectedPoint: "/points/41.8781,-87.6298"},
+		{name: "spelled out", path: "/forecast?city=St.+Louis", expectedStatus: http.StatusOK, expectedPoint: "/points/38.6270,-90.1994"},
+		{name: "shared name", path: "/forecast?city=portland-me", expectedStatus: http.StatusOK, expectedPoint: "/points/43.6591,-70.2568"},
+		{name: "coordinates win", path: "/forecast?city=chicago&latitude=43.6323&longitude=-116.2050", expectedStatus: http.StatusOK, expectedPoint: "/points/43.6323,-116.2050"},
+		{name: "unknown", path: "/forecast?city=atlantis", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			srv.nws = nws
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedPoint != "" && nws.paths()[0] != tt.expectedPoint {
+				t.Errorf("expected %s to be looked up, got %v", tt.expectedPoint, nws.paths())
+			}
+		})
+	}
+}
+
+// TestCitiesHandler tests listing the city presets in order
+func TestCitiesHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	newServer(Config{}).routes().ServeHTTP(w, httptest.NewRequest("GET", "/cities", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp citiesResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Cities) != len(cityPresets) {
+		t.Fatalf("expected %d cities, got %d", len(cityPresets), len(resp.Cities))
+	}
+	for i, c := range resp.Cities {
+		if i > 0 && resp.Cities[i-1].ID >= c.ID {
+			t.Errorf("expected cities sorted by ID, got %s after %s", c.ID, resp.Cities[i-1].ID)
+		}
+		if c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180 {
+			t.Errorf("expected a valid point for %s, got %v,%v", c.ID, c.Latitude, c.Longitude)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+// clock tells the time and waits for it to pass. The server reads the time
+// only through its clock, so tests of time-dependent behaviour can substitute
+// one they control.
+type clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
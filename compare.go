@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minComparePoints and maxComparePoints bound the points of /compare
+	minComparePoints = 2
+	maxComparePoints = 10
+)
+
+// compareCurrent is a location's current period in a comparison
+type compareCurrent struct {
+	ForecastOutput
+	StartTime    time.Time `json:"startTime"`
+	TemperatureC float64   `json:"temperatureC"`
+	TemperatureF int       `json:"temperatureF"`
+}
+
+// compareDay is one day of a location's forecast in a comparison
+type compareDay struct {
+	Date    string `json:"date"`
+	Summary string `json:"summary"`
+	// HighC and LowC are omitted when the forecast doesn't cover that half of
+	// the day
+	HighC                    *float64 `json:"highC,omitempty"`
+	LowC                     *float64 `json:"lowC,omitempty"`
+	PrecipitationProbability *int     `json:"precipitationProbability,omitempty"`
+	// Temperature is the category of the day's high, or of its low when the
+	// high is missing
+	Temperature string `json:"temperature,omitempty"`
+}
+
+// compareLocation is one point of a comparison. Error explains why a point's
+// forecast is missing; the other points are still compared.
+type compareLocation struct {
+	Latitude  float64         `json:"latitude"`
+	Longitude float64         `json:"longitude"`
+	Current   *compareCurrent `json:"current,omitempty"`
+	Days      []compareDay    `json:"days,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// compareResponse is the body of /compare, in the order the points were given
+type compareResponse struct {
+	Locations []compareLocation `json:"locations"`
+}
+
+// parseComparePoints reads the points parameter, a semicolon separated list of
+// latitude,longitude pairs. Go's query parser rejects unescaped semicolons, so
+// the raw query is read.
+func parseComparePoints(r *http.Request) ([][2]float64, error) {
+	var raw string
+	for _, param := range strings.Split(r.URL.RawQuery, "&") {
+		if v, ok := strings.CutPrefix(param, "points="); ok {
+			raw, _ = url.QueryUnescape(v)
+		}
+	}
+	if raw == "" {
+		return nil, fmt.Errorf("Missing points parameter")
+	}
+	fields := strings.Split(raw, ";")
+	if len(fields) < minComparePoints || len(fields) > maxComparePoints {
+		return nil, fmt.Errorf("Invalid points parameter (want %d to %d points)", minComparePoints, maxComparePoints)
+	}
+	points := make([][2]float64, 0, len(fields))
+	for _, f := range fields {
+		lat, lon, ok := strings.Cut(strings.TrimSpace(f), ",")
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		longitude, lonErr := strconv.ParseFloat(strings.TrimSpace(lon), 64)
+		if !ok || latErr != nil || lonErr != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return nil, fmt.Errorf("Invalid point %q (want latitude,longitude)", f)
+		}
+		points = append(points, [2]float64{latitude, longitude})
+	}
+	return points, nil
+}
+
+// compareLocationAt builds the comparison entry of one point
+func (s *server) compareLocationAt(ctx context.Context, point [2]float64, now time.Time) compareLocation {
+	loc := compareLocation{Latitude: point[0], Longitude: point[1]}
+	lat := strconv.FormatFloat(point[0], 'f', 4, 64)
+	lon := strconv.FormatFloat(point[1], 'f', 4, 64)
+	periods, _, err := s.fetchPeriods(ctx, lat, lon, false)
+	if err != nil {
+		loc.Error = err.Error()
+		return loc
+	}
+	if len(periods) == 0 {
+		loc.Error = "No forecast periods found"
+		return loc
+	}
+
+	p := currentPeriod(periods, now)
+	loc.Current = &compareCurrent{
+		ForecastOutput: s.periodOutput(p),
+		StartTime:      p.Start,
+		TemperatureC:   roundTenth(p.TemperatureC),
+		TemperatureF:   roundInt(celsiusToFahrenheit(p.TemperatureC)),
+	}
+	s.applyTransforms(p, &loc.Current.ForecastOutput)
+	for _, d := range summarizeDays(periods) {
+		day := compareDay{
+			Date:                     d.Date.Format(time.DateOnly),
+			Summary:                  d.Summary,
+			HighC:                    roundTenthPtr(d.HighC),
+			LowC:                     roundTenthPtr(d.LowC),
+			PrecipitationProbability: d.PrecipitationProbability,
+		}
+		t := d.HighC
+		if t == nil {
+			t = d.LowC
+		}
+		if t != nil {
+			day.Temperature = s.temperatureCategory(weatherPeriod{Summary: d.Summary, TemperatureC: *t, PrecipitationProbability: d.PrecipitationProbability})
+		}
+		loc.Days = append(loc.Days, day)
+	}
+	return loc
+}
+
+// roundTenthPtr rounds an optional temperature to a tenth of a degree
+func roundTenthPtr(c *float64) *float64 {
+	if c == nil {
+		return nil
+	}
+	v := roundTenth(*c)
+	return &v
+}
+
+// compareHandler serves the forecasts of several points side by side. The
+// points are fetched concurrently.
+func (s *server) compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	points, err := parseComparePoints(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := s.clock.Now()
+	resp := compareResponse{Locations: make([]compareLocation, len(points))}
+	var wg sync.WaitGroup
+	for i, point := range points {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.Locations[i] = s.compareLocationAt(r.Context(), point, now)
+		}()
+	}
+	wg.Wait()
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseComparePoints tests reading the points of a comparison
+func TestParseComparePoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		expected  int
+		expectErr string
+	}{
+		{name: "semicolons", query: "points=47.6,-122.3;45.5,-122.7;44.1,-121.3", expected: 3},
+		{name: "escaped semicolons", query: "points=47.6,-122.3%3B45.5,-122.7", expected: 2},
+		{name: "missing", query: "latitude=47.6", expectErr: "Missing points"},
+		{name: "one point", query: "points=47.6,-122.3", expectErr: "want 2 to 10 points"},
+		{name: "too many points", query: "points=" + strings.Repeat("1,1;", 10) + "1,1", expectErr: "want 2 to 10 points"},
+		{name: "bad point", query: "points=47.6,-122.3;north", expectErr: `Invalid point "north"`},
+		{name: "out of range", query: "points=47.6,-122.3;95,10", expectErr: "Invalid point"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := parseComparePoints(httptest.NewRequest("GET", "/compare?"+tt.query, nil))
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Errorf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != tt.expected {
+				t.Errorf("expected %d points, got %d", tt.expected, len(points))
+			}
+		})
+	}
+}
+
+// TestCompareHandler tests comparing points, one of which NWS doesn't cover
+func TestCompareHandler(t *testing.T) {
+	forecasts := map[string]string{
+		"/forecast/ski": `{"properties": {"periods": [
+			{"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true, "shortForecast": "Snow", "temperature": 28, "temperatureUnit": "F"},
+			{"startTime": "2024-06-01T18:00:00-07:00", "endTime": "2024-06-02T06:00:00-07:00", "isDaytime": false, "shortForecast": "Cloudy", "temperature": 20, "temperatureUnit": "F"}
+		]}}`,
+		"/forecast/beach": `{"properties": {"periods": [
+			{"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true, "shortForecast": "Sunny", "temperature": 95, "temperatureUnit": "F"}
+		]}}`,
+	}
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := forecasts[r.URL.Path]; ok {
+			w.Write([]byte(body))
+			return
+		}
+		switch r.URL.Path {
+		case "/points/46.8000,-121.7000":
+			w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast/ski"}}`))
+		case "/points/33.7000,-118.3000":
+			w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast/beach"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockNWS.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.clock = newFakeClock(time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC))
+	req := httptest.NewRequest("GET", "/compare?points=46.8,-121.7;33.7,-118.3;51.5,-0.1", nil)
+	w := httptest.NewRecorder()
+	srv.compareHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var resp compareResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Locations) != 3 {
+		t.Fatalf("expected 3 locations, got %d", len(resp.Locations))
+	}
+	ski, beach, london := resp.Locations[0], resp.Locations[1], resp.Locations[2]
+	if ski.Current == nil || ski.Current.Forecast != "Snow" || ski.Current.Temperature != "cold" || ski.Current.TemperatureF != 28 {
+		t.Errorf("unexpected ski hill forecast %+v", ski.Current)
+	}
+	if len(ski.Days) != 1 || *ski.Days[0].HighC != -2.2 || *ski.Days[0].LowC != -6.7 || ski.Days[0].Date != "2024-06-01" {
+		t.Errorf("unexpected ski hill days %+v", ski.Days)
+	}
+	if beach.Current == nil || beach.Current.Forecast != "Sunny" || beach.Current.Temperature != "hot" {
+		t.Errorf("unexpected beach forecast %+v", beach.Current)
+	}
+	if london.Current != nil || !strings.Contains(london.Error, "404") {
+		t.Errorf("expected an error for a point NWS doesn't cover, got %+v", london)
+	}
+}
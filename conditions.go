@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// condition is a canonical weather condition, reported to clients as
+// conditionCode so they don't have to match on English forecast text
+type condition string
+
+// The condition taxonomy. Precipitation and severe weather take precedence
+// over sky cover when a forecast mentions several.
+const (
+	conditionUnknown       condition = "unknown"
+	conditionClear         condition = "clear"
+	conditionMostlyClear   condition = "mostly-clear"
+	conditionPartlyCloudy  condition = "partly-cloudy"
+	conditionMostlyCloudy  condition = "mostly-cloudy"
+	conditionCloudy        condition = "cloudy"
+	conditionFog           condition = "fog"
+	conditionHaze          condition = "haze"
+	conditionSmoke         condition = "smoke"
+	conditionDust          condition = "dust"
+	conditionWindy         condition = "windy"
+	conditionDrizzle       condition = "drizzle"
+	conditionRain          condition = "rain"
+	conditionShowers       condition = "showers"
+	conditionFreezingRain  condition = "freezing-rain"
+	conditionSleet         condition = "sleet"
+	conditionRainSnow      condition = "rain-snow"
+	conditionSnow          condition = "snow"
+	conditionBlizzard      condition = "blizzard"
+	conditionThunderstorm  condition = "thunderstorm"
+	conditionTropicalStorm condition = "tropical-storm"
+	conditionHurricane     condition = "hurricane"
+	conditionTornado       condition = "tornado"
+	conditionHot           condition = "hot"
+	conditionCold          condition = "cold"
+)
+
+// conditions lists the taxonomy, for validating codes clients send
+var conditions = []condition{
+	conditionUnknown, conditionClear, conditionMostlyClear, conditionPartlyCloudy,
+	conditionMostlyCloudy, conditionCloudy, conditionFog, conditionHaze, conditionSmoke,
+	conditionDust, conditionWindy, conditionDrizzle, conditionRain, conditionShowers,
+	conditionFreezingRain, conditionSleet, conditionRainSnow, conditionSnow,
+	conditionBlizzard, conditionThunderstorm, conditionTropicalStorm, conditionHurricane,
+	conditionTornado, conditionHot, conditionCold,
+}
+
+// nwsIconConditions maps the condition codes in NWS icon URLs, such as
+// https://api.weather.gov/icons/land/day/tsra_sct,40?size=medium, to conditions
+var nwsIconConditions = map[string]condition{
+	"skc":             conditionClear,
+	"few":             conditionMostlyClear,
+	"sct":             conditionPartlyCloudy,
+	"bkn":             conditionMostlyCloudy,
+	"ovc":             conditionCloudy,
+	"wind_skc":        conditionWindy,
+	"wind_few":        conditionWindy,
+	"wind_sct":        conditionWindy,
+	"wind_bkn":        conditionWindy,
+	"wind_ovc":        conditionWindy,
+	"snow":            conditionSnow,
+	"rain_snow":       conditionRainSnow,
+	"rain_sleet":      conditionSleet,
+	"snow_sleet":      conditionSleet,
+	"sleet":           conditionSleet,
+	"fzra":            conditionFreezingRain,
+	"rain_fzra":       conditionFreezingRain,
+	"snow_fzra":       conditionFreezingRain,
+	"rain":            conditionRain,
+	"rain_showers":    conditionShowers,
+	"rain_showers_hi": conditionShowers,
+	"tsra":            conditionThunderstorm,
+	"tsra_sct":        conditionThunderstorm,
+	"tsra_hi":         conditionThunderstorm,
+	"tornado":         conditionTornado,
+	"hurricane":       conditionHurricane,
+	"tropical_storm":  conditionTropicalStorm,
+	"dust":            conditionDust,
+	"smoke":           conditionSmoke,
+	"haze":            conditionHaze,
+	"hot":             conditionHot,
+	"cold":            conditionCold,
+	"blizzard":        conditionBlizzard,
+	"fog":             conditionFog,
+}
+
+// nwsTextConditions maps phrases in NWS shortForecast text to conditions. The
+// first phrase found wins, so the table runs from most to least severe.
+var nwsTextConditions = []struct {
+	phrase    string
+	condition condition
+}{
+	{"tornado", conditionTornado},
+	{"hurricane", conditionHurricane},
+	{"tropical storm", conditionTropicalStorm},
+	{"thunder", conditionThunderstorm},
+	{"t-storm", conditionThunderstorm},
+	{"blizzard", conditionBlizzard},
+	{"freezing", conditionFreezingRain},
+	{"sleet", conditionSleet},
+	{"ice pellets", conditionSleet},
+	{"rain and snow", conditionRainSnow},
+	{"snow and rain", conditionRainSnow},
+	{"wintry mix", conditionRainSnow},
+	{"snow", conditionSnow},
+	{"flurries", conditionSnow},
+	{"showers", conditionShowers},
+	{"drizzle", conditionDrizzle},
+	{"rain", conditionRain},
+	{"fog", conditionFog},
+	{"smoke", conditionSmoke},
+	{"haze", conditionHaze},
+	{"dust", conditionDust},
+	{"sand", conditionDust},
+	{"mostly cloudy", conditionMostlyCloudy},
+	{"considerable cloudiness", conditionMostlyCloudy},
+	{"partly cloudy", conditionPartlyCloudy},
+	{"partly sunny", conditionPartlyCloudy},
+	{"mostly sunny", conditionMostlyClear},
+	{"mostly clear", conditionMostlyClear},
+	{"cloudy", conditionCloudy},
+	{"overcast", conditionCloudy},
+	{"sunny", conditionClear},
+	{"clear", conditionClear},
+	{"fair", conditionClear},
+	{"windy", conditionWindy},
+	{"breezy", conditionWindy},
+	{"blustery", conditionWindy},
+	{"hot", conditionHot},
+	{"cold", conditionCold},
+}
+
+// nwsCondition maps an NWS period to a condition, preferring the code in its
+// icon URL and falling back to its shortForecast wording
+func nwsCondition(text, icon string) condition {
+	if c := nwsIconCondition(icon); c != conditionUnknown {
+		return c
+	}
+	t := strings.ToLower(text)
+	for _, m := range nwsTextConditions {
+		if strings.Contains(t, m.phrase) {
+			return m.condition
+		}
+	}
+	return conditionUnknown
+}
+
+// nwsIconCondition reads the first condition code of an NWS icon URL. Icons
+// for periods that change partway through name two codes; the first describes
+// the start of the period.
+func nwsIconCondition(icon string) condition {
+	u, err := url.Parse(icon)
+	if err != nil || u.Path == "" {
+		return conditionUnknown
+	}
+	// The path is /icons/{set}/{day|night}/{code}[,pop][/{code}[,pop]]
+	parts := strings.Split(strings.TrimPrefix(path.Clean(u.Path), "/"), "/")
+	if len(parts) < 4 || parts[0] != "icons" {
+		return conditionUnknown
+	}
+	code, _, _ := strings.Cut(parts[3], ",")
+	if c, ok := nwsIconConditions[code]; ok {
+		return c
+	}
+	return conditionUnknown
+}
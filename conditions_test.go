@@ -0,0 +1,89 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestNWSCondition tests mapping NWS icons and wording to conditions
+func TestNWSCondition(t *testing.T) {
+	tests := []struct {
+		text     string
+		icon     string
+		expected condition
+	}{
+		{text: "Sunny", expected: conditionClear},
+		{text: "Mostly Clear", expected: conditionMostlyClear},
+		{text: "Partly Sunny", expected: conditionPartlyCloudy},
+		{text: "Mostly Cloudy", expected: conditionMostlyCloudy},
+		{text: "Cloudy", expected: conditionCloudy},
+		{text: "Patchy Fog", expected: conditionFog},
+		{text: "Areas Of Smoke", expected: conditionSmoke},
+		{text: "Patchy Drizzle", expected: conditionDrizzle},
+		{text: "Light Rain", expected: conditionRain},
+		{text: "Chance Rain Showers", expected: conditionShowers},
+		{text: "Freezing Rain", expected: conditionFreezingRain},
+		{text: "Rain And Snow", expected: conditionRainSnow},
+		{text: "Snow Likely", expected: conditionSnow},
+		{text: "Blizzard Conditions", expected: conditionBlizzard},
+		{text: "Chance Showers And Thunderstorms", expected: conditionThunderstorm},
+		{text: "Sunny And Breezy", expected: conditionClear},
+		{text: "Blowing Widgets", expected: conditionUnknown},
+		// The icon wins over the wording
+		{text: "Sunny", icon: "https://api.weather.gov/icons/land/day/tsra_sct,40?size=medium", expected: conditionThunderstorm},
+		{text: "", icon: "https://api.weather.gov/icons/land/night/few", expected: conditionMostlyClear},
+		{text: "", icon: "https://api.weather.gov/icons/land/day/rain_showers,30/snow,60?size=small", expected: conditionShowers},
+		{text: "", icon: "https://api.weather.gov/icons/land/day/wind_bkn", expected: conditionWindy},
+		// Unrecognised icons fall back to the wording
+		{text: "Light Snow", icon: "https://api.weather.gov/icons/land/day/new_code", expected: conditionSnow},
+		{text: "Light Snow", icon: "not a url\x7f", expected: conditionSnow},
+		{text: "Light Snow", icon: "https://example.com/picture.png", expected: conditionSnow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text+tt.icon, func(t *testing.T) {
+			if got := nwsCondition(tt.text, tt.icon); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestNWSTextConditionsOrder tests that severe phrases are checked before the
+// milder phrases they contain
+func TestNWSTextConditionsOrder(t *testing.T) {
+	index := func(phrase string) int {
+		return slices.IndexFunc(nwsTextConditions, func(m struct {
+			phrase    string
+			condition condition
+		}) bool {
+			return m.phrase == phrase
+		})
+	}
+	pairs := [][2]string{
+		{"rain and snow", "snow"},
+		{"rain and snow", "rain"},
+		{"showers", "rain"},
+		{"mostly cloudy", "cloudy"},
+		{"partly cloudy", "cloudy"},
+		{"mostly clear", "clear"},
+	}
+	for _, p := range pairs {
+		if before, after := index(p[0]), index(p[1]); before < 0 || after < 0 || before > after {
+			t.Errorf("expected %q to be checked before %q", p[0], p[1])
+		}
+	}
+}
+
+// TestConditionsListed tests that every mapped condition is in the taxonomy list
+func TestConditionsListed(t *testing.T) {
+	for code, c := range nwsIconConditions {
+		if !slices.Contains(conditions, c) {
+			t.Errorf("icon %s maps to unlisted condition %q", code, c)
+		}
+	}
+	for _, m := range nwsTextConditions {
+		if !slices.Contains(conditions, m.condition) {
+			t.Errorf("phrase %q maps to unlisted condition %q", m.phrase, m.condition)
+		}
+	}
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings of the service
+type Config struct {
+	// Addr is the address the server listens on
+	Addr string
+	// AdminAddr, when set, moves the admin and metrics routes to a separate listener
+	AdminAddr string
+	// TLSCertFile and TLSKeyFile enable HTTPS on every listener
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientAuth selects the listeners requiring client certificates issued by
+	// a CA in ClientCAFile: main, admin, or all
+	ClientAuth   string
+	ClientCAFile string
+	// ForceHTTPS redirects plain HTTP requests to HTTPS
+	ForceHTTPS bool
+	// TrustProxyHeaders honours X-Forwarded-* headers set by a reverse proxy
+	TrustProxyHeaders bool
+	// NWSAPIHost is the base URL of the National Weather Service API
+	NWSAPIHost string
+	// Offline answers NWS requests from a bundled dataset instead of the
+	// network; it is only read at startup
+	Offline bool
+	// NWSProxy serves /proxy/nws/, a caching, rate limited proxy of the NWS
+	// API for other tools
+	NWSProxy bool
+	// NWSCacheTTL is how long NWS forecasts fetched for requests are cached
+	// when NWS's Cache-Control and Expires headers don't say, and gridpoints
+	// and stations for at least a day; zero only caches prewarmed points.
+	// NWSCacheSize bounds the number of cached responses and is only read at
+	// startup.
+	NWSCacheTTL  time.Duration
+	NWSCacheSize int
+	// NWSStaleTTL is how long after a cached response expires it's still
+	// served, marked stale, while it's refreshed in the background; zero
+	// waits for NWS instead
+	NWSStaleTTL time.Duration
+	// NWSRetryAttempts is how many times an NWS request that failed with a
+	// network error or a 5xx is tried in all, waiting an exponential backoff
+	// from NWSRetryBaseDelay up to NWSRetryMaxDelay between tries, and a
+	// random share of it when NWSRetryJitter is set; one doesn't retry
+	NWSRetryAttempts  int
+	NWSRetryBaseDelay time.Duration
+	NWSRetryMaxDelay  time.Duration
+	NWSRetryJitter    bool
+	// NWSRateLimit is how many requests a second are sent to NWS on average,
+	// and NWSRateBurst how many at once after a lull; requests over the limit
+	// wait up to NWSRateWait for their turn before failing. A zero rate
+	// doesn't limit.
+	NWSRateLimit int
+	NWSRateBurst int
+	NWSRateWait  time.Duration
+	// NWSDailyBudget is the number of requests a day NWS is expected to
+	// tolerate; alarms are raised when a UTC day's requests reach
+	// NWSBudgetWarnPercent of it and then all of it, and POSTed to
+	// NWSBudgetWebhook when it's set. Zero disables the alarms.
+	NWSDailyBudget       int
+	NWSBudgetWarnPercent int
+	NWSBudgetWebhook     string
+	// RedisURL is a redis:// or rediss:// URL of a Redis server that
+	// replicas share their NWS caches through; it is only read at startup
+	RedisURL string
+	// CachePeers is a comma-separated list of the base URLs of replicas,
+	// including this one as CachePeerSelf, that fill their NWS caches from
+	// each other. Peers authenticate to each other with CachePeerSecret.
+	CachePeers      string
+	CachePeerSelf   string
+	CachePeerSecret string
+	// ProxyPolicyFile is a YAML or JSON file of the NWS paths the proxy
+	// allows, with their cache TTLs and rate limits, replacing the built-in
+	// ones
+	ProxyPolicyFile string
+	// DatabaseURL selects the persistent store (postgres://... or sqlite://path);
+	// persistence is disabled when empty
+	DatabaseURL string
+	// EncryptionKeysFile is a keyring file used to encrypt stored secrets;
+	// secrets are stored in plaintext when empty
+	EncryptionKeysFile string
+	// AuthRequired rejects requests without an API key; otherwise anonymous
+	// clients may still use read-only routes
+	AuthRequired bool
+	// OIDCIssuer enables JWTs from this OIDC issuer as bearer tokens alongside
+	// API keys; OIDCAudience, when set, must appear in the token's aud claim
+	OIDCIssuer   string
+	OIDCAudience string
+	// OIDCRolesClaim and OIDCTenantClaim name the token claims mapped to the
+	// caller's roles and owner
+	OIDCRolesClaim  string
+	OIDCTenantClaim string
+	// URLSigningKey enables signed URLs, which grant read routes to anyone
+	// holding one until it expires, for embedding without an API key
+	URLSigningKey string
+	// ClientRateLimit is how many requests a minute each API key, or address
+	// of anonymous callers, may make; zero disables the limit
+	ClientRateLimit int
+	// WASMBudget is how long each API key's WASM score rules may run a
+	// minute; zero disables WASM rules
+	WASMBudget time.Duration
+	// TranslateURL is a LibreTranslate server used to translate forecast text
+	// for ?lang=, with TranslateAPIKey if it needs one; translation is disabled
+	// when empty. Both are only read at startup.
+	TranslateURL    string
+	TranslateAPIKey string
+	// Geocoder is the provider geocoding ?q= locations, census or nominatim;
+	// geocoding is disabled when empty. GeocoderURL replaces the provider's
+	// public endpoint, such as with a self-hosted Nominatim. Both are only
+	// read at startup.
+	Geocoder    string
+	GeocoderURL string
+	// ZIPFile is a CSV or tab-separated file of ZIP code centroids, such as
+	// the Census ZCTA gazetteer, for ?zip=; ZIP lookup is disabled when empty
+	ZIPFile string
+	// FIPSFile is a CSV or tab-separated file of county representative
+	// points, such as the Census county gazetteer, for ?fips=; FIPS lookup is
+	// disabled when empty
+	FIPSFile string
+	// W3WKey is a what3words API key enabling ?w3w= addresses, which are
+	// resolved with the what3words API or W3WURL in its place; what3words
+	// lookup is disabled when empty. Both are only read at startup.
+	W3WKey string
+	W3WURL string
+
+	// HistoryRetention, AuditRetention, and UsageRetention bound how long
+	// persisted rows are kept; zero keeps them forever
+	HistoryRetention time.Duration
+	AuditRetention   time.Duration
+	UsageRetention   time.Duration
+	// SnapshotRetention bounds how long forecast revisions are kept
+	SnapshotRetention time.Duration
+	// AlertRetention bounds how long alerts are kept after they end
+	AlertRetention time.Duration
+	// DeliveryRetention bounds how long webhook deliveries are kept for replay
+	DeliveryRetention time.Duration
+	// PruneInterval is how often rows past their retention are deleted
+	PruneInterval time.Duration
+	// PruneSchedule is a cron schedule, or "@every" and a duration, for
+	// pruning that replaces PruneInterval when set
+	PruneSchedule string
+	// AlertPollInterval is how often active alerts are fetched for the points
+	// of subscriptions and saved locations
+	AlertPollInterval time.Duration
+
+	// ArchiveURL is the blob store archived forecasts are exported to
+	// (file:///path or s3://bucket/prefix); exports are disabled when empty
+	ArchiveURL string
+	// ArchiveFormat is the format of archive exports: parquet or csv
+	ArchiveFormat string
+	// ArchiveInterval is the span of archived forecasts in each export file
+	ArchiveInterval time.Duration
+	// ArchiveSchedule is a cron schedule, or "@every" and a duration, for
+	// archive exports; by default they run as each interval completes
+	ArchiveSchedule string
+
+	// ReportFormat enables weekly forecast reports for the saved locations of
+	// each subscription owner, rendered as html or pdf
+	ReportFormat string
+	// ReportSchedule is the weekday and UTC time reports are sent, such as
+	// "monday 06:00"
+	ReportSchedule string
+
+	// ActivitiesFile is a YAML or JSON file of comfort profiles for /best-time,
+	// adding to or replacing the built-in ones
+	ActivitiesFile string
+	// PrefetchFile is a YAML or JSON file of fixed locations, such as kiosks',
+	// whose forecasts are refreshed into the NWS cache on cron schedules
+	PrefetchFile string
+
+	// PrecipitationGapFill fills missing hourly probabilities of precipitation:
+	// linear, carry, or off
+	PrecipitationGapFill string
+	// LapseRate is how much colder it gets per kilometer of elevation, in
+	// °C, when forecasts are adjusted to an ?elevation= other than their
+	// grid cell's; zero disables the adjustment
+	LapseRate float64
+
+	// JSONCase is the case of JSON field names when a request doesn't ask for
+	// one: camel or snake
+	JSONCase string
+	// StrictParams rejects requests with query parameters their route doesn't
+	// accept
+	StrictParams bool
+	// Transforms is a comma-separated list of the registered transforms
+	// applied to forecast responses, in order
+	Transforms string
+	// TemperatureCategories is the scale forecast temperatures in °F are
+	// categorized by, as labels each followed by the highest temperature in
+	// its bucket, such as "cold:30,moderate:79,hot"
+	TemperatureCategories string
+	// TemperatureRules are expressions labelling temperatures ahead of
+	// TemperatureCategories, such as "cold: tempF < 40 && windSpeedMph > 15",
+	// separated by semicolons
+	TemperatureRules string
+	// RequestTimeout is how long a route's handler may run before the
+	// request is answered with 503; routes that fan out upstream allow longer
+	RequestTimeout time.Duration
+	// SlowRequestThreshold is how long a request may take before it's logged
+	// as slow; zero disables the logging
+	SlowRequestThreshold time.Duration
+}
+
+// defaultConfig returns the settings used when nothing is overridden
+func defaultConfig() Config {
+	return Config{
+		Addr:                 ":8080",
+		NWSAPIHost:           "https://api.weather.gov",
+		NWSCacheTTL:          10 * time.Minute,
+		NWSCacheSize:         nwsCacheSize,
+		NWSRetryAttempts:     3,
+		NWSRetryBaseDelay:    100 * time.Millisecond,
+		NWSRetryMaxDelay:     2 * time.Second,
+		NWSRetryJitter:       true,
+		NWSRateLimit:         10,
+		NWSRateBurst:         20,
+		NWSRateWait:          5 * time.Second,
+		NWSBudgetWarnPercent: 80,
+		HistoryRetention:     90 * 24 * time.Hour,
+		AuditRetention:       30 * 24 * time.Hour,
+		UsageRetention:       365 * 24 * time.Hour,
+		SnapshotRetention:    90 * 24 * time.Hour,
+		AlertRetention:       90 * 24 * time.Hour,
+		DeliveryRetention:    30 * 24 * time.Hour,
+		PruneInterval:        time.Hour,
+		AlertPollInterval:    5 * time.Minute,
+		ArchiveFormat:        archiveParquet,
+		ArchiveInterval:      24 * time.Hour,
+		RequestTimeout:       30 * time.Second,
+		ReportSchedule:       "monday 06:00",
+		OIDCRolesClaim:       "roles",
+		OIDCTenantClaim:      "sub",
+
+		PrecipitationGapFill:  gapFillLinear,
+		LapseRate:             standardLapseRate,
+		JSONCase:              jsonCaseCamel,
+		TemperatureCategories: temperatureScale.String(),
+		SlowRequestThreshold:  5 * time.Second,
+		WASMBudget:            time.Second,
+	}
+}
+
+// loadConfig builds a Config from the defaults, overridden by the config file
+// named by FORECAST_CONFIG_FILE and then by environment variables. Every
+// variable can instead be read from a file via its _FILE variant or from a
+// secret manager; see configEnv.
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+	if path := os.Getenv("FORECAST_CONFIG_FILE"); path != "" {
+		if err := loadConfigFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	for name, field := range map[string]*string{
+		"FORECAST_ADDR":                   &cfg.Addr,
+		"FORECAST_ADMIN_ADDR":             &cfg.AdminAddr,
+		"FORECAST_TLS_CERT_FILE":          &cfg.TLSCertFile,
+		"FORECAST_TLS_KEY_FILE":           &cfg.TLSKeyFile,
+		"FORECAST_CLIENT_AUTH":            &cfg.ClientAuth,
+		"FORECAST_CLIENT_CA_FILE":         &cfg.ClientCAFile,
+		"FORECAST_NWS_HOST":               &cfg.NWSAPIHost,
+		"FORECAST_NWS_BUDGET_WEBHOOK":     &cfg.NWSBudgetWebhook,
+		"FORECAST_REDIS_URL":              &cfg.RedisURL,
+		"FORECAST_CACHE_PEERS":            &cfg.CachePeers,
+		"FORECAST_CACHE_PEER_SELF":        &cfg.CachePeerSelf,
+		"FORECAST_CACHE_PEER_SECRET":      &cfg.CachePeerSecret,
+		"FORECAST_DATABASE_URL":           &cfg.DatabaseURL,
+		"FORECAST_ENCRYPTION_KEYS_FILE":   &cfg.EncryptionKeysFile,
+		"FORECAST_OIDC_ISSUER":            &cfg.OIDCIssuer,
+		"FORECAST_OIDC_AUDIENCE":          &cfg.OIDCAudience,
+		"FORECAST_OIDC_ROLES_CLAIM":       &cfg.OIDCRolesClaim,
+		"FORECAST_OIDC_TENANT_CLAIM":      &cfg.OIDCTenantClaim,
+		"FORECAST_URL_SIGNING_KEY":        &cfg.URLSigningKey,
+		"FORECAST_TRANSLATE_URL":          &cfg.TranslateURL,
+		"FORECAST_TRANSLATE_API_KEY":      &cfg.TranslateAPIKey,
+		"FORECAST_GEOCODER":               &cfg.Geocoder,
+		"FORECAST_GEOCODER_URL":           &cfg.GeocoderURL,
+		"FORECAST_ZIP_FILE":               &cfg.ZIPFile,
+		"FORECAST_FIPS_FILE":              &cfg.FIPSFile,
+		"FORECAST_W3W_KEY":                &cfg.W3WKey,
+		"FORECAST_W3W_URL":                &cfg.W3WURL,
+		"FORECAST_POP_GAP_FILL":           &cfg.PrecipitationGapFill,
+		"FORECAST_JSON_CASE":              &cfg.JSONCase,
+		"FORECAST_TRANSFORMS":             &cfg.Transforms,
+		"FORECAST_TEMPERATURE_CATEGORIES": &cfg.TemperatureCategories,
+		"FORECAST_TEMPERATURE_RULES":      &cfg.TemperatureRules,
+		"FORECAST_ARCHIVE_URL":            &cfg.ArchiveURL,
+		"FORECAST_ARCHIVE_FORMAT":         &cfg.ArchiveFormat,
+		"FORECAST_REPORT_FORMAT":          &cfg.ReportFormat,
+		"FORECAST_REPORT_SCHEDULE":        &cfg.ReportSchedule,
+		"FORECAST_ACTIVITIES_FILE":        &cfg.ActivitiesFile,
+		"FORECAST_PROXY_POLICY_FILE":      &cfg.ProxyPolicyFile,
+		"FORECAST_PREFETCH_FILE":          &cfg.PrefetchFile,
+		"FORECAST_PRUNE_SCHEDULE":         &cfg.PruneSchedule,
+		"FORECAST_ARCHIVE_SCHEDULE":       &cfg.ArchiveSchedule,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			*field = v
+		}
+	}
+	cfg.NWSAPIHost = strings.TrimRight(cfg.NWSAPIHost, "/")
+
+	for name, field := range map[string]*bool{
+		"FORECAST_AUTH_REQUIRED":       &cfg.AuthRequired,
+		"FORECAST_FORCE_HTTPS":         &cfg.ForceHTTPS,
+		"FORECAST_TRUST_PROXY_HEADERS": &cfg.TrustProxyHeaders,
+		"FORECAST_OFFLINE":             &cfg.Offline,
+		"FORECAST_NWS_PROXY":           &cfg.NWSProxy,
+		"FORECAST_NWS_RETRY_JITTER":    &cfg.NWSRetryJitter,
+		"FORECAST_STRICT_PARAMS":       &cfg.StrictParams,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	for name, field := range map[string]*int{
+		"FORECAST_CLIENT_RATE_LIMIT": &cfg.ClientRateLimit,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	for name, field := range map[string]*time.Duration{
+		"FORECAST_HISTORY_RETENTION":      &cfg.HistoryRetention,
+		"FORECAST_AUDIT_RETENTION":        &cfg.AuditRetention,
+		"FORECAST_USAGE_RETENTION":        &cfg.UsageRetention,
+		"FORECAST_SNAPSHOT_RETENTION":     &cfg.SnapshotRetention,
+		"FORECAST_ALERT_RETENTION":        &cfg.AlertRetention,
+		"FORECAST_DELIVERY_RETENTION":     &cfg.DeliveryRetention,
+		"FORECAST_PRUNE_INTERVAL":         &cfg.PruneInterval,
+		"FORECAST_ALERT_POLL_INTERVAL":    &cfg.AlertPollInterval,
+		"FORECAST_ARCHIVE_INTERVAL":       &cfg.ArchiveInterval,
+		"FORECAST_REQUEST_TIMEOUT":        &cfg.RequestTimeout,
+		"FORECAST_SLOW_REQUEST_THRESHOLD": &cfg.SlowRequestThreshold,
+		"FORECAST_NWS_CACHE_TTL":          &cfg.NWSCacheTTL,
+		"FORECAST_NWS_STALE_TTL":          &cfg.NWSStaleTTL,
+		"FORECAST_NWS_RETRY_BASE_DELAY":   &cfg.NWSRetryBaseDelay,
+		"FORECAST_NWS_RETRY_MAX_DELAY":    &cfg.NWSRetryMaxDelay,
+		"FORECAST_NWS_RATE_WAIT":          &cfg.NWSRateWait,
+		"FORECAST_WASM_BUDGET":            &cfg.WASMBudget,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			parsed, err := parseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	for name, field := range map[string]*int{
+		"FORECAST_NWS_CACHE_SIZE":          &cfg.NWSCacheSize,
+		"FORECAST_NWS_RETRY_ATTEMPTS":      &cfg.NWSRetryAttempts,
+		"FORECAST_NWS_RATE_LIMIT":          &cfg.NWSRateLimit,
+		"FORECAST_NWS_RATE_BURST":          &cfg.NWSRateBurst,
+		"FORECAST_NWS_DAILY_BUDGET":        &cfg.NWSDailyBudget,
+		"FORECAST_NWS_BUDGET_WARN_PERCENT": &cfg.NWSBudgetWarnPercent,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	for name, field := range map[string]*float64{
+		"FORECAST_LAPSE_RATE": &cfg.LapseRate,
+	} {
+		v, err := configEnv(name)
+		if err != nil {
+			return cfg, err
+		}
+		if v != "" {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = parsed
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+// parseDuration parses a Go duration, additionally accepting a whole number of
+// days such as "90d"
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// validate reports the first setting that can't be used
+func (c Config) validate() error {
+	u, err := url.Parse(c.NWSAPIHost)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid NWS API host %q", c.NWSAPIHost)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("TLS certificate and key must be set together")
+	}
+	switch c.ClientAuth {
+	case "":
+	case clientAuthMain, clientAuthAdmin, clientAuthAll:
+		if c.TLSCertFile == "" || c.ClientCAFile == "" {
+			return fmt.Errorf("client certificate authentication requires a TLS certificate and client CA bundle")
+		}
+		if c.ClientAuth == clientAuthAdmin && c.AdminAddr == "" {
+			return fmt.Errorf("client certificates on the admin listener require an admin address")
+		}
+	default:
+		return fmt.Errorf("invalid client auth %q (want main, admin, or all)", c.ClientAuth)
+	}
+	switch c.PrecipitationGapFill {
+	case gapFillOff, gapFillLinear, gapFillCarry:
+	default:
+		return fmt.Errorf("invalid precipitation gap fill %q (want linear, carry, or off)", c.PrecipitationGapFill)
+	}
+	if c.LapseRate < 0 || c.LapseRate > maxLapseRate {
+		return fmt.Errorf("lapse rate must be between 0 and %g °C per km", float64(maxLapseRate))
+	}
+	if c.JSONCase != jsonCaseCamel && c.JSONCase != jsonCaseSnake {
+		return fmt.Errorf("invalid JSON case %q (want camel or snake)", c.JSONCase)
+	}
+	if _, err := parseTransforms(c.Transforms); err != nil {
+		return err
+	}
+	if _, err := parseTemperatureCategories(c); err != nil {
+		return err
+	}
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("request timeout must be positive")
+	}
+	if c.SlowRequestThreshold < 0 {
+		return fmt.Errorf("slow request threshold must not be negative")
+	}
+	if c.NWSCacheSize <= 0 {
+		return fmt.Errorf("NWS cache size must be positive")
+	}
+	if c.NWSStaleTTL < 0 {
+		return fmt.Errorf("NWS stale TTL must not be negative")
+	}
+	if c.NWSRetryAttempts < 0 || c.NWSRetryAttempts > maxNWSRetryAttempts {
+		return fmt.Errorf("NWS retry attempts must be between 0 and %d", maxNWSRetryAttempts)
+	}
+	if c.NWSRetryBaseDelay < 0 || c.NWSRetryMaxDelay < c.NWSRetryBaseDelay {
+		return fmt.Errorf("NWS retry base delay must not be negative or above the max delay")
+	}
+	if c.NWSRateLimit < 0 || c.NWSRateBurst < 0 || c.NWSRateWait < 0 {
+		return fmt.Errorf("NWS rate limit, burst, and wait must not be negative")
+	}
+	if c.NWSDailyBudget < 0 {
+		return fmt.Errorf("NWS daily budget must not be negative")
+	}
+	if c.NWSBudgetWarnPercent < 1 || c.NWSBudgetWarnPercent > 100 {
+		return fmt.Errorf("NWS budget warning percent must be between 1 and 100")
+	}
+	if c.NWSBudgetWebhook != "" {
+		if u, err := url.Parse(c.NWSBudgetWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("NWS budget webhook must be an http or https URL")
+		}
+	}
+	if c.RedisURL != "" {
+		if _, err := newRedisClient(c.RedisURL); err != nil {
+			return fmt.Errorf("invalid Redis URL: %v", err)
+		}
+	}
+	peers, err := parseCachePeers(c.CachePeers)
+	if err != nil {
+		return fmt.Errorf("invalid cache peers: %v", err)
+	}
+	if len(peers) > 0 {
+		if !slices.Contains(peers, strings.TrimRight(c.CachePeerSelf, "/")) {
+			return fmt.Errorf("cache peer self %q must be one of the cache peers", c.CachePeerSelf)
+		}
+		if c.CachePeerSecret == "" {
+			return fmt.Errorf("cache peers need a peer secret")
+		}
+	}
+	if c.PruneInterval <= 0 {
+		return fmt.Errorf("prune interval must be positive")
+	}
+	if c.PruneSchedule != "" {
+		if _, err := parseJobSchedule(c.PruneSchedule); err != nil {
+			return fmt.Errorf("prune schedule: %v", err)
+		}
+	}
+	if c.AlertPollInterval <= 0 {
+		return fmt.Errorf("alert poll interval must be positive")
+	}
+	switch c.ArchiveFormat {
+	case archiveParquet, archiveCSV:
+	default:
+		return fmt.Errorf("invalid archive format %q (want parquet or csv)", c.ArchiveFormat)
+	}
+	if c.ArchiveInterval <= 0 {
+		return fmt.Errorf("archive interval must be positive")
+	}
+	if c.ArchiveSchedule != "" {
+		if _, err := parseJobSchedule(c.ArchiveSchedule); err != nil {
+			return fmt.Errorf("archive schedule: %v", err)
+		}
+	}
+	if c.ArchiveURL != "" && c.DatabaseURL == "" {
+		return fmt.Errorf("archive exports require a database")
+	}
+	switch c.ReportFormat {
+	case "":
+	case reportHTML, reportPDF:
+		if c.DatabaseURL == "" {
+			return fmt.Errorf("weekly reports require a database")
+		}
+	default:
+		return fmt.Errorf("invalid report format %q (want html or pdf)", c.ReportFormat)
+	}
+	if _, err := parseReportSchedule(c.ReportSchedule); err != nil {
+		return err
+	}
+	if c.AuthRequired && c.DatabaseURL == "" && c.OIDCIssuer == "" {
+		return fmt.Errorf("authentication requires a database to hold API keys or an OIDC issuer")
+	}
+	if c.ClientRateLimit < 0 {
+		return fmt.Errorf("client rate limit must not be negative")
+	}
+	if c.URLSigningKey != "" && len(c.URLSigningKey) < minURLSigningKeyLength {
+		return fmt.Errorf("URL signing key must be at least %d bytes", minURLSigningKeyLength)
+	}
+	if c.TranslateURL != "" {
+		if u, err := url.Parse(c.TranslateURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("translation URL %q must be an http or https URL", c.TranslateURL)
+		}
+	}
+	switch c.Geocoder {
+	case "", geocoderCensus, geocoderNominatim:
+	default:
+		return fmt.Errorf("invalid geocoder %q (want census or nominatim)", c.Geocoder)
+	}
+	if c.GeocoderURL != "" {
+		if c.Geocoder == "" {
+			return fmt.Errorf("a geocoder URL requires a geocoder")
+		}
+		if u, err := url.Parse(c.GeocoderURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("geocoder URL %q must be an http or https URL", c.GeocoderURL)
+		}
+	}
+	if c.W3WURL != "" {
+		if c.W3WKey == "" {
+			return fmt.Errorf("a what3words URL requires a what3words key")
+		}
+		if u, err := url.Parse(c.W3WURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("what3words URL %q must be an http or https URL", c.W3WURL)
+		}
+	}
+	if c.OIDCIssuer != "" {
+		// Plain http is only allowed for issuers on the local machine
+		u, err := url.Parse(c.OIDCIssuer)
+		if err != nil || (u.Scheme != "https" && u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1") {
+			return fmt.Errorf("OIDC issuer %q must be an https URL", c.OIDCIssuer)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearForecastEnv blanks every FORECAST_ environment variable for the test
+func clearForecastEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "FORECAST_") {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+// TestLoadConfig tests environment overrides and validation
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		expected    func(*Config)
+		expectError bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"FORECAST_ADDR":         ":9090",
+				"FORECAST_NWS_HOST":     "http://localhost:4000/",
+				"FORECAST_DATABASE_URL": "sqlite://forecast.db",
+			},
+			expected: func(c *Config) {
+				c.Addr = ":9090"
+				c.NWSAPIHost = "http://localhost:4000"
+				c.DatabaseURL = "sqlite://forecast.db"
+			},
+		},
+		{
+			name: "retention in days and durations",
+			env: map[string]string{
+				"FORECAST_HISTORY_RETENTION": "7d",
+				"FORECAST_AUDIT_RETENTION":   "0",
+				"FORECAST_PRUNE_INTERVAL":    "15m",
+			},
+			expected: func(c *Config) {
+				c.HistoryRetention = 7 * 24 * time.Hour
+				c.AuditRetention = 0
+				c.PruneInterval = 15 * time.Minute
+			},
+		},
+		{
+			name:        "invalid NWS host",
+			env:         map[string]string{"FORECAST_NWS_HOST": "not a url"},
+			expectError: true,
+		},
+		{
+			name: "archive exports",
+			env: map[string]string{
+				"FORECAST_DATABASE_URL":   "sqlite://forecast.db",
+				"FORECAST_ARCHIVE_URL":    "s3://archive/forecast",
+				"FORECAST_ARCHIVE_FORMAT": "csv",
+			},
+			expected: func(c *Config) {
+				c.DatabaseURL = "sqlite://forecast.db"
+				c.ArchiveURL = "s3://archive/forecast"
+				c.ArchiveFormat = "csv"
+			},
+		},
+		{
+			name:        "invalid archive format",
+			env:         map[string]string{"FORECAST_ARCHIVE_FORMAT": "xlsx"},
+			expectError: true,
+		},
+		{
+			name:        "archive exports without a database",
+			env:         map[string]string{"FORECAST_ARCHIVE_URL": "file:///tmp/archive"},
+			expectError: true,
+		},
+		{
+			name: "weekly reports",
+			env: map[string]string{
+				"FORECAST_DATABASE_URL":    "sqlite://forecast.db",
+				"FORECAST_REPORT_FORMAT":   "pdf",
+				"FORECAST_REPORT_SCHEDULE": "Friday 17:30",
+			},
+			expected: func(c *Config) {
+				c.DatabaseURL = "sqlite://forecast.db"
+				c.ReportFormat = "pdf"
+				c.ReportSchedule = "Friday 17:30"
+			},
+		},
+		{
+			name:        "invalid report schedule",
+			env:         map[string]string{"FORECAST_REPORT_SCHEDULE": "weekly"},
+			expectError: true,
+		},
+		{
+			name:        "weekly reports without a database",
+			env:         map[string]string{"FORECAST_REPORT_FORMAT": "html"},
+			expectError: true,
+		},
+		{
+			name:        "invalid alert poll interval",
+			env:         map[string]string{"FORECAST_ALERT_POLL_INTERVAL": "0"},
+			expectError: true,
+		},
+		{
+			name:        "invalid retention",
+			env:         map[string]string{"FORECAST_HISTORY_RETENTION": "-3d"},
+			expectError: true,
+		},
+		{
+			name: "auth required",
+			env: map[string]string{
+				"FORECAST_AUTH_REQUIRED": "true",
+				"FORECAST_DATABASE_URL":  "sqlite://forecast.db",
+			},
+			expected: func(c *Config) {
+				c.AuthRequired = true
+				c.DatabaseURL = "sqlite://forecast.db"
+			},
+		},
+		{
+			name:        "auth required without a database",
+			env:         map[string]string{"FORECAST_AUTH_REQUIRED": "1"},
+			expectError: true,
+		},
+		{
+			name: "OIDC without a database",
+			env: map[string]string{
+				"FORECAST_AUTH_REQUIRED":     "true",
+				"FORECAST_OIDC_ISSUER":       "https://login.example.com",
+				"FORECAST_OIDC_AUDIENCE":     "forecast",
+				"FORECAST_OIDC_ROLES_CLAIM":  "groups",
+				"FORECAST_OIDC_TENANT_CLAIM": "org",
+			},
+			expected: func(c *Config) {
+				c.AuthRequired = true
+				c.OIDCIssuer = "https://login.example.com"
+				c.OIDCAudience = "forecast"
+				c.OIDCRolesClaim = "groups"
+				c.OIDCTenantClaim = "org"
+			},
+		},
+		{
+			name: "URL signing key",
+			env:  map[string]string{"FORECAST_URL_SIGNING_KEY": "0123456789abcdef0123456789abcdef"},
+			expected: func(c *Config) {
+				c.URLSigningKey = "0123456789abcdef0123456789abcdef"
+			},
+		},
+		{
+			name: "translation provider",
+			env:  map[string]string{"FORECAST_TRANSLATE_URL": "http://translate.internal:5000", "FORECAST_TRANSLATE_API_KEY": "key"},
+			expected: func(c *Config) {
+				c.TranslateURL = "http://translate.internal:5000"
+				c.TranslateAPIKey = "key"
+			},
+		},
+		{
+			name:        "translation provider without a scheme",
+			env:         map[string]string{"FORECAST_TRANSLATE_URL": "translate.internal:5000"},
+			expectError: true,
+		},
+		{
+			name: "geocoder",
+			env:  map[string]string{"FORECAST_GEOCODER": "nominatim", "FORECAST_GEOCODER_URL": "http://nominatim.internal:8080/search?format=jsonv2"},
+			expected: func(c *Config) {
+				c.Geocoder = "nominatim"
+				c.GeocoderURL = "http://nominatim.internal:8080/search?format=jsonv2"
+			},
+		},
+		{
+			name:        "invalid geocoder",
+			env:         map[string]string{"FORECAST_GEOCODER": "google"},
+			expectError: true,
+		},
+		{
+			name: "job schedules",
+			env:  map[string]string{"FORECAST_PRUNE_SCHEDULE": "30 3 * * *", "FORECAST_ARCHIVE_SCHEDULE": "@every 6h"},
+			expected: func(c *Config) {
+				c.PruneSchedule = "30 3 * * *"
+				c.ArchiveSchedule = "@every 6h"
+			},
+		},
+		{
+			name:     "transforms",
+			env:      map[string]string{"FORECAST_TRANSFORMS": "beaufort"},
+			expected: func(c *Config) { c.Transforms = "beaufort" },
+		},
+		{
+			name:        "unknown transform",
+			env:         map[string]string{"FORECAST_TRANSFORMS": "beaufort,fire-danger"},
+			expectError: true,
+		},
+		{
+			name:     "temperature categories",
+			env:      map[string]string{"FORECAST_TEMPERATURE_CATEGORIES": "cold:50,mild:75,hot"},
+			expected: func(c *Config) { c.TemperatureCategories = "cold:50,mild:75,hot" },
+		},
+		{
+			name:     "temperature rules",
+			env:      map[string]string{"FORECAST_TEMPERATURE_RULES": "cold: tempF < 40 && windSpeedMph > 15"},
+			expected: func(c *Config) { c.TemperatureRules = "cold: tempF < 40 && windSpeedMph > 15" },
+		},
+		{
+			name:        "invalid temperature rules",
+			env:         map[string]string{"FORECAST_TEMPERATURE_RULES": "cold: temp < 40"},
+			expectError: true,
+		},
+		{
+			name:        "unordered temperature categories",
+			env:         map[string]string{"FORECAST_TEMPERATURE_CATEGORIES": "cold:50,mild:40,hot"},
+			expectError: true,
+		},
+		{
+			name:        "invalid prune schedule",
+			env:         map[string]string{"FORECAST_PRUNE_SCHEDULE": "nightly"},
+			expectError: true,
+		},
+		{
+			name:        "invalid archive schedule",
+			env:         map[string]string{"FORECAST_ARCHIVE_SCHEDULE": "@every 0s"},
+			expectError: true,
+		},
+		{
+			name:        "geocoder URL without a geocoder",
+			env:         map[string]string{"FORECAST_GEOCODER_URL": "http://nominatim.internal:8080/search"},
+			expectError: true,
+		},
+		{
+			name:        "what3words URL without a key",
+			env:         map[string]string{"FORECAST_W3W_URL": "https://w3w.internal/v3/convert-to-coordinates"},
+			expectError: true,
+		},
+		{
+			name:        "short URL signing key",
+			env:         map[string]string{"FORECAST_URL_SIGNING_KEY": "secret"},
+			expectError: true,
+		},
+		{
+			name:        "plain http OIDC issuer",
+			env:         map[string]string{"FORECAST_OIDC_ISSUER": "http://login.example.com"},
+			expectError: true,
+		},
+		{
+			name: "client certificates on the admin listener",
+			env: map[string]string{
+				"FORECAST_ADMIN_ADDR":     ":9443",
+				"FORECAST_TLS_CERT_FILE":  "server.crt",
+				"FORECAST_TLS_KEY_FILE":   "server.key",
+				"FORECAST_CLIENT_AUTH":    "admin",
+				"FORECAST_CLIENT_CA_FILE": "ca.pem",
+			},
+			expected: func(c *Config) {
+				c.AdminAddr = ":9443"
+				c.TLSCertFile = "server.crt"
+				c.TLSKeyFile = "server.key"
+				c.ClientAuth = "admin"
+				c.ClientCAFile = "ca.pem"
+			},
+		},
+		{
+			name:        "TLS certificate without key",
+			env:         map[string]string{"FORECAST_TLS_CERT_FILE": "server.crt"},
+			expectError: true,
+		},
+		{
+			name: "client auth without CA bundle",
+			env: map[string]string{
+				"FORECAST_TLS_CERT_FILE": "server.crt",
+				"FORECAST_TLS_KEY_FILE":  "server.key",
+				"FORECAST_CLIENT_AUTH":   "main",
+			},
+			expectError: true,
+		},
+		{
+			name: "admin client auth without admin listener",
+			env: map[string]string{
+				"FORECAST_TLS_CERT_FILE":  "server.crt",
+				"FORECAST_TLS_KEY_FILE":   "server.key",
+				"FORECAST_CLIENT_AUTH":    "admin",
+				"FORECAST_CLIENT_CA_FILE": "ca.pem",
+			},
+			expectError: true,
+		},
+		{
+			name:        "invalid client auth",
+			env:         map[string]string{"FORECAST_CLIENT_AUTH": "sometimes"},
+			expectError: true,
+		},
+		{
+			name:        "invalid precipitation gap fill",
+			env:         map[string]string{"FORECAST_POP_GAP_FILL": "spline"},
+			expectError: true,
+		},
+		{
+			name:     "snake case JSON",
+			env:      map[string]string{"FORECAST_JSON_CASE": "snake"},
+			expected: func(c *Config) { c.JSONCase = jsonCaseSnake },
+		},
+		{
+			name:        "invalid JSON case",
+			env:         map[string]string{"FORECAST_JSON_CASE": "kebab"},
+			expectError: true,
+		},
+		{
+			name:        "invalid boolean",
+			env:         map[string]string{"FORECAST_AUTH_REQUIRED": "maybe"},
+			expectError: true,
+		},
+		{
+			name:        "zero prune interval",
+			env:         map[string]string{"FORECAST_PRUNE_INTERVAL": "0s"},
+			expectError: true,
+		},
+		{
+			name:     "nws cache",
+			env:      map[string]string{"FORECAST_NWS_CACHE_TTL": "0s", "FORECAST_NWS_CACHE_SIZE": "250"},
+			expected: func(c *Config) { c.NWSCacheTTL = 0; c.NWSCacheSize = 250 },
+		},
+		{
+			name: "nws retry",
+			env:  map[string]string{"FORECAST_NWS_RETRY_ATTEMPTS": "5", "FORECAST_NWS_RETRY_BASE_DELAY": "250ms", "FORECAST_NWS_RETRY_MAX_DELAY": "5s", "FORECAST_NWS_RETRY_JITTER": "false"},
+			expected: func(c *Config) {
+				c.NWSRetryAttempts = 5
+				c.NWSRetryBaseDelay = 250 * time.Millisecond
+				c.NWSRetryMaxDelay = 5 * time.Second
+				c.NWSRetryJitter = false
+			},
+		},
+		{
+			name:        "too many nws retry attempts",
+			env:         map[string]string{"FORECAST_NWS_RETRY_ATTEMPTS": "100"},
+			expectError: true,
+		},
+		{
+			name:        "nws retry base delay above max",
+			env:         map[string]string{"FORECAST_NWS_RETRY_BASE_DELAY": "5s"},
+			expectError: true,
+		},
+		{
+			name:     "nws rate limit",
+			env:      map[string]string{"FORECAST_NWS_RATE_LIMIT": "2", "FORECAST_NWS_RATE_BURST": "4", "FORECAST_NWS_RATE_WAIT": "10s"},
+			expected: func(c *Config) { c.NWSRateLimit = 2; c.NWSRateBurst = 4; c.NWSRateWait = 10 * time.Second },
+		},
+		{
+			name:        "negative nws rate limit",
+			env:         map[string]string{"FORECAST_NWS_RATE_LIMIT": "-1"},
+			expectError: true,
+		},
+		{
+			name:     "nws stale ttl",
+			env:      map[string]string{"FORECAST_NWS_STALE_TTL": "1h"},
+			expected: func(c *Config) { c.NWSStaleTTL = time.Hour },
+		},
+		{
+			name:        "negative nws stale ttl",
+			env:         map[string]string{"FORECAST_NWS_STALE_TTL": "-1m"},
+			expectError: true,
+		},
+		{
+			name:     "lapse rate",
+			env:      map[string]string{"FORECAST_LAPSE_RATE": "9.8"},
+			expected: func(c *Config) { c.LapseRate = 9.8 },
+		},
+		{
+			name:        "negative lapse rate",
+			env:         map[string]string{"FORECAST_LAPSE_RATE": "-2"},
+			expectError: true,
+		},
+		{
+			name:        "invalid lapse rate",
+			env:         map[string]string{"FORECAST_LAPSE_RATE": "steep"},
+			expectError: true,
+		},
+		{
+			name:        "invalid nws cache size",
+			env:         map[string]string{"FORECAST_NWS_CACHE_SIZE": "lots"},
+			expectError: true,
+		},
+		{
+			name:        "zero nws cache size",
+			env:         map[string]string{"FORECAST_NWS_CACHE_SIZE": "0"},
+			expectError: true,
+		},
+		{
+			name: "nws budget",
+			env:  map[string]string{"FORECAST_NWS_DAILY_BUDGET": "50000", "FORECAST_NWS_BUDGET_WARN_PERCENT": "90", "FORECAST_NWS_BUDGET_WEBHOOK": "https://hooks.example.com/nws"},
+			expected: func(c *Config) {
+				c.NWSDailyBudget = 50000
+				c.NWSBudgetWarnPercent = 90
+				c.NWSBudgetWebhook = "https://hooks.example.com/nws"
+			},
+		},
+		{
+			name:        "nws budget warning over 100 percent",
+			env:         map[string]string{"FORECAST_NWS_BUDGET_WARN_PERCENT": "120"},
+			expectError: true,
+		},
+		{
+			name:        "invalid nws budget webhook",
+			env:         map[string]string{"FORECAST_NWS_BUDGET_WEBHOOK": "mailto:ops@example.com"},
+			expectError: true,
+		},
+		{
+			name:     "redis",
+			env:      map[string]string{"FORECAST_REDIS_URL": "redis://cache:6379/2"},
+			expected: func(c *Config) { c.RedisURL = "redis://cache:6379/2" },
+		},
+		{
+			name:        "invalid redis url",
+			env:         map[string]string{"FORECAST_REDIS_URL": "cache:6379"},
+			expectError: true,
+		},
+		{
+			name: "cache peers",
+			env:  map[string]string{"FORECAST_CACHE_PEERS": "http://10.0.0.1:8080, http://10.0.0.2:8080", "FORECAST_CACHE_PEER_SELF": "http://10.0.0.2:8080", "FORECAST_CACHE_PEER_SECRET": "s3cret"},
+			expected: func(c *Config) {
+				c.CachePeers = "http://10.0.0.1:8080, http://10.0.0.2:8080"
+				c.CachePeerSelf = "http://10.0.0.2:8080"
+				c.CachePeerSecret = "s3cret"
+			},
+		},
+		{
+			name:        "cache peers without self",
+			env:         map[string]string{"FORECAST_CACHE_PEERS": "http://10.0.0.1:8080", "FORECAST_CACHE_PEER_SELF": "http://10.0.0.2:8080", "FORECAST_CACHE_PEER_SECRET": "s3cret"},
+			expectError: true,
+		},
+		{
+			name:        "cache peers without secret",
+			env:         map[string]string{"FORECAST_CACHE_PEERS": "http://10.0.0.1:8080", "FORECAST_CACHE_PEER_SELF": "http://10.0.0.1:8080"},
+			expectError: true,
+		},
+		{
+			name:        "invalid cache peer",
+			env:         map[string]string{"FORECAST_CACHE_PEERS": "10.0.0.1:8080", "FORECAST_CACHE_PEER_SELF": "10.0.0.1:8080", "FORECAST_CACHE_PEER_SECRET": "s3cret"},
+			expectError: true,
+		},
+		{
+			name:     "request timeout",
+			env:      map[string]string{"FORECAST_REQUEST_TIMEOUT": "10s"},
+			expected: func(c *Config) { c.RequestTimeout = 10 * time.Second },
+		},
+		{
+			name:        "zero request timeout",
+			env:         map[string]string{"FORECAST_REQUEST_TIMEOUT": "0s"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearForecastEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := loadConfig()
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expected := defaultConfig()
+			if tt.expected != nil {
+				tt.expected(&expected)
+			}
+			if cfg != expected {
+				t.Errorf("expected %+v, got %+v", expected, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config file is YAML (or JSON, which YAML accepts) laid out by configSchema.
+// Each leaf of the schema sets one Config field, so the file covers the same
+// settings as the environment variables, which override it.
+
+// configSetting validates one node of a config file and applies it to a Config
+type configSetting interface {
+	apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error
+}
+
+// configSection is a mapping of named settings
+type configSection map[string]configSetting
+
+// configString is a string setting, optionally limited to some values. Values
+// may reference a secret manager like environment variables can.
+type configString struct {
+	field func(*Config) *string
+	enum  []string
+}
+
+// configBool is a true or false setting
+type configBool func(*Config) *bool
+
+// configDuration is a duration setting, such as 15m or 90d
+type configDuration func(*Config) *time.Duration
+
+// configInt is a whole number setting
+type configInt func(*Config) *int
+
+// configFloat is a number setting, which may have a fraction
+type configFloat func(*Config) *float64
+
+// configFileError locates a problem in a config file
+type configFileError struct {
+	File   string
+	Line   int
+	Path   string
+	Reason string
+}
+
+func (e *configFileError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "top level"
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, path, e.Reason)
+}
+
+func invalidSetting(n *yaml.Node, path, format string, args ...any) []error {
+	return []error{&configFileError{Line: n.Line, Path: path, Reason: fmt.Sprintf(format, args...)}}
+}
+
+func (s configSection) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	if n.Kind != yaml.MappingNode {
+		return invalidSetting(n, path, "expected a mapping")
+	}
+	var errs []error
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+		setting, ok := s[key.Value]
+		if !ok {
+			names := make([]string, 0, len(s))
+			for name := range s {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			errs = append(errs, invalidSetting(key, keyPath, "unknown setting (want one of %s)", strings.Join(names, ", "))...)
+			continue
+		}
+		errs = append(errs, setting.apply(ctx, cfg, value, keyPath)...)
+	}
+	return errs
+}
+
+func (s configString) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	if n.Kind != yaml.ScalarNode {
+		return invalidSetting(n, path, "expected a string")
+	}
+	if s.enum != nil && !slices.Contains(s.enum, n.Value) {
+		return invalidSetting(n, path, "%q is not one of %s", n.Value, strings.Join(s.enum, ", "))
+	}
+	ctx, cancel := context.WithTimeout(ctx, secretsTimeout)
+	defer cancel()
+	value, err := resolveSecret(ctx, n.Value)
+	if err != nil {
+		return invalidSetting(n, path, "%v", err)
+	}
+	*s.field(cfg) = value
+	return nil
+}
+
+func (b configBool) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	var v bool
+	if n.Kind != yaml.ScalarNode || n.Tag != "!!bool" || n.Decode(&v) != nil {
+		return invalidSetting(n, path, "expected true or false")
+	}
+	*b(cfg) = v
+	return nil
+}
+
+func (d configDuration) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	if n.Kind != yaml.ScalarNode {
+		return invalidSetting(n, path, "expected a duration such as 15m or 90d")
+	}
+	v, err := parseDuration(n.Value)
+	if err != nil {
+		return invalidSetting(n, path, "%v", err)
+	}
+	*d(cfg) = v
+	return nil
+}
+
+func (i configInt) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	var v int
+	if n.Kind != yaml.ScalarNode || n.Tag != "!!int" || n.Decode(&v) != nil {
+		return invalidSetting(n, path, "expected a whole number")
+	}
+	*i(cfg) = v
+	return nil
+}
+
+func (f configFloat) apply(ctx context.Context, cfg *Config, n *yaml.Node, path string) []error {
+	var v float64
+	if n.Kind != yaml.ScalarNode || (n.Tag != "!!int" && n.Tag != "!!float") || n.Decode(&v) != nil {
+		return invalidSetting(n, path, "expected a number")
+	}
+	*f(cfg) = v
+	return nil
+}
+
+// configSchema describes every setting of a config file
+var configSchema = configSection{
+	"server": configSection{
+		"addr":                 configString{field: func(c *Config) *string { return &c.Addr }},
+		"adminAddr":            configString{field: func(c *Config) *string { return &c.AdminAddr }},
+		"forceHTTPS":           configBool(func(c *Config) *bool { return &c.ForceHTTPS }),
+		"trustProxyHeaders":    configBool(func(c *Config) *bool { return &c.TrustProxyHeaders }),
+		"strictParams":         configBool(func(c *Config) *bool { return &c.StrictParams }),
+		"jsonCase":             configString{field: func(c *Config) *string { return &c.JSONCase }, enum: []string{jsonCaseCamel, jsonCaseSnake}},
+		"transforms":           configString{field: func(c *Config) *string { return &c.Transforms }},
+		"requestTimeout":       configDuration(func(c *Config) *time.Duration { return &c.RequestTimeout }),
+		"slowRequestThreshold": configDuration(func(c *Config) *time.Duration { return &c.SlowRequestThreshold }),
+		"tls": configSection{
+			"certFile":     configString{field: func(c *Config) *string { return &c.TLSCertFile }},
+			"keyFile":      configString{field: func(c *Config) *string { return &c.TLSKeyFile }},
+			"clientAuth":   configString{field: func(c *Config) *string { return &c.ClientAuth }, enum: []string{clientAuthMain, clientAuthAdmin, clientAuthAll}},
+			"clientCAFile": configString{field: func(c *Config) *string { return &c.ClientCAFile }},
+		},
+	},
+	"upstream": configSection{
+		"nwsHost":   configString{field: func(c *Config) *string { return &c.NWSAPIHost }},
+		"offline":   configBool(func(c *Config) *bool { return &c.Offline }),
+		"cacheTTL":  configDuration(func(c *Config) *time.Duration { return &c.NWSCacheTTL }),
+		"cacheSize": configInt(func(c *Config) *int { return &c.NWSCacheSize }),
+		"staleTTL":  configDuration(func(c *Config) *time.Duration { return &c.NWSStaleTTL }),
+		"redisURL":  configString{field: func(c *Config) *string { return &c.RedisURL }},
+		"peers": configSection{
+			"urls":   configString{field: func(c *Config) *string { return &c.CachePeers }},
+			"self":   configString{field: func(c *Config) *string { return &c.CachePeerSelf }},
+			"secret": configString{field: func(c *Config) *string { return &c.CachePeerSecret }},
+		},
+		"retry": configSection{
+			"attempts":  configInt(func(c *Config) *int { return &c.NWSRetryAttempts }),
+			"baseDelay": configDuration(func(c *Config) *time.Duration { return &c.NWSRetryBaseDelay }),
+			"maxDelay":  configDuration(func(c *Config) *time.Duration { return &c.NWSRetryMaxDelay }),
+			"jitter":    configBool(func(c *Config) *bool { return &c.NWSRetryJitter }),
+		},
+		"rateLimit": configSection{
+			"rps":   configInt(func(c *Config) *int { return &c.NWSRateLimit }),
+			"burst": configInt(func(c *Config) *int { return &c.NWSRateBurst }),
+			"wait":  configDuration(func(c *Config) *time.Duration { return &c.NWSRateWait }),
+		},
+		"budget": configSection{
+			"daily":       configInt(func(c *Config) *int { return &c.NWSDailyBudget }),
+			"warnPercent": configInt(func(c *Config) *int { return &c.NWSBudgetWarnPercent }),
+			"webhook":     configString{field: func(c *Config) *string { return &c.NWSBudgetWebhook }},
+		},
+		"proxy":                configBool(func(c *Config) *bool { return &c.NWSProxy }),
+		"proxyPolicyFile":      configString{field: func(c *Config) *string { return &c.ProxyPolicyFile }},
+		"precipitationGapFill": configString{field: func(c *Config) *string { return &c.PrecipitationGapFill }, enum: []string{gapFillLinear, gapFillCarry, gapFillOff}},
+		"lapseRate":            configFloat(func(c *Config) *float64 { return &c.LapseRate }),
+		"translation": configSection{
+			"url":    configString{field: func(c *Config) *string { return &c.TranslateURL }},
+			"apiKey": configString{field: func(c *Config) *string { return &c.TranslateAPIKey }},
+		},
+		"geocoding": configSection{
+			"provider": configString{field: func(c *Config) *string { return &c.Geocoder }, enum: []string{geocoderCensus, geocoderNominatim}},
+			"url":      configString{field: func(c *Config) *string { return &c.GeocoderURL }},
+			"zipFile":  configString{field: func(c *Config) *string { return &c.ZIPFile }},
+			"fipsFile": configString{field: func(c *Config) *string { return &c.FIPSFile }},
+			"w3wKey":   configString{field: func(c *Config) *string { return &c.W3WKey }},
+			"w3wURL":   configString{field: func(c *Config) *string { return &c.W3WURL }},
+		},
+	},
+	"database": configSection{
+		"url":                configString{field: func(c *Config) *string { return &c.DatabaseURL }},
+		"encryptionKeysFile": configString{field: func(c *Config) *string { return &c.EncryptionKeysFile }},
+		"pruneInterval":      configDuration(func(c *Config) *time.Duration { return &c.PruneInterval }),
+		"pruneSchedule":      configString{field: func(c *Config) *string { return &c.PruneSchedule }},
+		"retention": configSection{
+			"history":    configDuration(func(c *Config) *time.Duration { return &c.HistoryRetention }),
+			"audit":      configDuration(func(c *Config) *time.Duration { return &c.AuditRetention }),
+			"usage":      configDuration(func(c *Config) *time.Duration { return &c.UsageRetention }),
+			"snapshots":  configDuration(func(c *Config) *time.Duration { return &c.SnapshotRetention }),
+			"alerts":     configDuration(func(c *Config) *time.Duration { return &c.AlertRetention }),
+			"deliveries": configDuration(func(c *Config) *time.Duration { return &c.DeliveryRetention }),
+		},
+	},
+	"auth": configSection{
+		"required": configBool(func(c *Config) *bool { return &c.AuthRequired }),
+		"oidc": configSection{
+			"issuer":      configString{field: func(c *Config) *string { return &c.OIDCIssuer }},
+			"audience":    configString{field: func(c *Config) *string { return &c.OIDCAudience }},
+			"rolesClaim":  configString{field: func(c *Config) *string { return &c.OIDCRolesClaim }},
+			"tenantClaim": configString{field: func(c *Config) *string { return &c.OIDCTenantClaim }},
+		},
+		"urlSigningKey": configString{field: func(c *Config) *string { return &c.URLSigningKey }},
+		"rateLimit":     configInt(func(c *Config) *int { return &c.ClientRateLimit }),
+		"wasmBudget":    configDuration(func(c *Config) *time.Duration { return &c.WASMBudget }),
+	},
+	"alerts": configSection{
+		"pollInterval": configDuration(func(c *Config) *time.Duration { return &c.AlertPollInterval }),
+	},
+	"archive": configSection{
+		"url":      configString{field: func(c *Config) *string { return &c.ArchiveURL }},
+		"format":   configString{field: func(c *Config) *string { return &c.ArchiveFormat }, enum: []string{archiveParquet, archiveCSV}},
+		"interval": configDuration(func(c *Config) *time.Duration { return &c.ArchiveInterval }),
+		"schedule": configString{field: func(c *Config) *string { return &c.ArchiveSchedule }},
+	},
+	"categories": configSection{
+		"temperature":      configString{field: func(c *Config) *string { return &c.TemperatureCategories }},
+		"temperatureRules": configString{field: func(c *Config) *string { return &c.TemperatureRules }},
+	},
+	"activities": configSection{
+		"file": configString{field: func(c *Config) *string { return &c.ActivitiesFile }},
+	},
+	"prefetch": configSection{
+		"file": configString{field: func(c *Config) *string { return &c.PrefetchFile }},
+	},
+	"notifications": configSection{
+		"reports": configSection{
+			"format":   configString{field: func(c *Config) *string { return &c.ReportFormat }, enum: []string{reportHTML, reportPDF}},
+			"schedule": configString{field: func(c *Config) *string { return &c.ReportSchedule }},
+		},
+	},
+}
+
+// loadConfigFile applies the settings of a YAML config file to cfg. Every
+// problem in the file is reported, each with its line and setting path.
+func loadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		// An empty file changes nothing
+		return nil
+	}
+
+	errs := configSchema.apply(context.Background(), cfg, doc.Content[0], "")
+	for _, err := range errs {
+		var fe *configFileError
+		if errors.As(err, &fe) {
+			fe.File = path
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadConfigFile tests settings from a config file and their precedence below the environment
+func TestLoadConfigFile(t *testing.T) {
+	clearForecastEnv(t)
+	path := filepath.Join(t.TempDir(), "forecast.yaml")
+	file := `
+server:
+  addr: ":9090"
+  forceHTTPS: true
+upstream:
+  nwsHost: http://localhost:4000/
+  cacheTTL: 5m
+  cacheSize: 500
+  lapseRate: 5.5
+database:
+  url: sqlite://forecast.db
+  retention:
+    history: 30d
+archive:
+  format: csv
+notifications:
+  reports:
+    format: pdf
+    schedule: friday 17:00
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FORECAST_CONFIG_FILE", path)
+	t.Setenv("FORECAST_ADDR", ":7070")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := defaultConfig()
+	expected.Addr = ":7070"
+	expected.ForceHTTPS = true
+	expected.NWSAPIHost = "http://localhost:4000"
+	expected.NWSCacheTTL = 5 * time.Minute
+	expected.NWSCacheSize = 500
+	expected.LapseRate = 5.5
+	expected.DatabaseURL = "sqlite://forecast.db"
+	expected.HistoryRetention = 30 * 24 * time.Hour
+	expected.ArchiveFormat = archiveCSV
+	expected.ReportFormat = reportPDF
+	expected.ReportSchedule = "friday 17:00"
+	if cfg != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+// TestConfigFileErrors tests that every problem in a config file is reported with its line and path
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected []string
+	}{
+		{name: "empty", file: ""},
+		{name: "not a mapping", file: "- server\n", expected: []string{":1: top level: expected a mapping"}},
+		{
+			name: "several problems",
+			file: "server:\n  forceHTTPS: yes please\n  tls:\n    clientAuth: everyone\ncache:\n  size: 10\ndatabase:\n  retention:\n    history: -3d\n",
+			expected: []string{
+				":2: server.forceHTTPS: expected true or false",
+				`:4: server.tls.clientAuth: "everyone" is not one of main, admin, all`,
+				":5: cache: unknown setting (want one of activities, alerts, archive, auth, categories, database, notifications, prefetch, server, upstream)",
+				":9: database.retention.history: invalid number of days",
+			},
+		},
+		{name: "fractional cache size", file: "upstream:\n  cacheSize: 1.5\n", expected: []string{":2: upstream.cacheSize: expected a whole number"}},
+		{name: "text lapse rate", file: "upstream:\n  lapseRate: steep\n", expected: []string{":2: upstream.lapseRate: expected a number"}},
+		{name: "section as a value", file: "server: localhost\n", expected: []string{":1: server: expected a mapping"}},
+		{name: "syntax", file: "server: [\n", expected: []string{"config file"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "forecast.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cfg := defaultConfig()
+			err := loadConfigFile(path, &cfg)
+			if len(tt.expected) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
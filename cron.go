@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard five-field cron schedule: minute, hour, day of
+// the month, month, and day of the week, in UTC. Each field is a set of
+// allowed values as a bit mask.
+type cronSchedule struct {
+	// spec is the schedule as written
+	spec                                   string
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday record a * day or weekday field. When both fields
+	// are restricted, a time matching either is scheduled, as in cron.
+	anyDay, anyWeekday bool
+}
+
+// cronShortcuts are the @ names accepted for common schedules
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses a schedule such as "*/15 6-22 * * 1-5" or "@hourly"
+func parseCron(spec string) (cronSchedule, error) {
+	expr := strings.TrimSpace(spec)
+	if shortcut, ok := cronShortcuts[strings.ToLower(expr)]; ok {
+		expr = shortcut
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("invalid schedule %q (want five cron fields such as \"*/15 * * * *\")", spec)
+	}
+	sched := cronSchedule{spec: spec}
+	for i, f := range []struct {
+		mask     *uint64
+		min, max int
+	}{
+		{&sched.minutes, 0, 59},
+		{&sched.hours, 0, 23},
+		{&sched.days, 1, 31},
+		{&sched.months, 1, 12},
+		{&sched.weekdays, 0, 7},
+	} {
+		mask, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		*f.mask = mask
+	}
+	// Sunday is either 0 or 7
+	if sched.weekdays&(1<<7) != 0 {
+		sched.weekdays |= 1
+	}
+	sched.anyDay = fields[2] == "*"
+	sched.anyWeekday = fields[4] == "*"
+	return sched, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges, and steps
+// such as "1,5-10,*/15" into a mask of the values from min to max it allows
+func parseCronField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step, hasStep := strings.Cut(part, "/")
+		lo, hi := min, max
+		if values != "*" {
+			first, last, isRange := strings.Cut(values, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("%q is not a number", first)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("%q is not a number", last)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+		for v := lo; v <= hi; v += n {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+func (c cronSchedule) String() string { return c.spec }
+
+// matchesDay reports whether the schedule runs on t's day
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// next returns the first scheduled minute after now, or the zero time when
+// the schedule never runs, such as on February 30th
+func (c cronSchedule) next(now time.Time) time.Time {
+	t := now.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every schedule that runs at all runs within a leap year cycle
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case c.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hours&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCronNext tests finding the next run of cron schedules
+func TestCronNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 6, 5, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 6, 5, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 6, 5, 10, 15, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 6, 5, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"30 6-9,17 * * *", time.Date(2024, 6, 5, 17, 30, 0, 0, time.UTC)},
+		{"0 6 * * 1-5", time.Date(2024, 6, 6, 6, 0, 0, 0, time.UTC)},
+		{"0 6 * * 7", time.Date(2024, 6, 9, 6, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// A restricted day and weekday run on either
+		{"0 0 15 * 6", time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sched, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sched.next(now); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseCronErrors tests rejecting malformed schedules
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@yearly"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"path"
+	"time"
+)
+
+// compassPoints name wind directions, clockwise from north
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// compassPoint names the nearest of the compassPoints to a direction in
+// degrees
+func compassPoint(degrees float64) string {
+	i := int(math.Round(math.Mod(degrees, 360)/22.5)) % len(compassPoints)
+	if i < 0 {
+		i += len(compassPoints)
+	}
+	return compassPoints[i]
+}
+
+// currentResponse is the body of /current, the latest observation of the
+// nearest station with its readings categorized as /forecast does. Readings
+// the station didn't report are left out.
+type currentResponse struct {
+	Latitude         float64   `json:"latitude"`
+	Longitude        float64   `json:"longitude"`
+	Station          string    `json:"station"`
+	ObservedAt       time.Time `json:"observedAt"`
+	Description      string    `json:"description"`
+	ConditionCode    string    `json:"conditionCode"`
+	TemperatureC     *float64  `json:"temperatureC,omitempty"`
+	Temperature      string    `json:"temperature,omitempty"`
+	WindSpeedKPH     *float64  `json:"windSpeedKph,omitempty"`
+	WindDirection    string    `json:"windDirection,omitempty"`
+	Wind             string    `json:"wind,omitempty"`
+	RelativeHumidity *float64  `json:"relativeHumidity,omitempty"`
+}
+
+func (s *server) newCurrentResponse(obs observation) currentResponse {
+	resp := currentResponse{
+		Station:          path.Base(obs.Station),
+		ObservedAt:       obs.Time,
+		Description:      obs.Description,
+		ConditionCode:    string(obs.Condition),
+		TemperatureC:     roundTenthPtr(obs.TemperatureC),
+		WindSpeedKPH:     roundTenthPtr(obs.WindSpeedKPH),
+		RelativeHumidity: roundTenthPtr(obs.RelativeHumidity),
+	}
+	if obs.TemperatureC != nil {
+		resp.Temperature = s.temperatureCategory(weatherPeriod{Summary: obs.Description, Condition: obs.Condition, TemperatureC: *obs.TemperatureC, WindSpeedKPH: obs.WindSpeedKPH})
+	}
+	if obs.WindSpeedKPH != nil {
+		resp.Wind = windScale.category(roundInt(kphToMPH(*obs.WindSpeedKPH)))
+	}
+	if obs.WindDirectionDegrees != nil {
+		resp.WindDirection = compassPoint(*obs.WindDirectionDegrees)
+	}
+	return resp
+}
+
+// currentHandler serves the conditions right now at a point, from the latest
+// observation of the station nearest to it
+func (s *server) currentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+
+	pointData, statusCode, err := s.lookupPoint(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	obs, statusCode, err := s.fetchLatestObservation(r.Context(), pointData.Properties.ObservationStations)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := s.newCurrentResponse(obs)
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCompassPoint tests naming wind directions
+func TestCompassPoint(t *testing.T) {
+	tests := []struct {
+		degrees  float64
+		expected string
+	}{
+		{0, "N"},
+		{11, "N"},
+		{12, "NNE"},
+		{200, "SSW"},
+		{350, "N"},
+		{360, "N"},
+		{-90, "W"},
+	}
+	for _, tt := range tests {
+		if got := compassPoint(tt.degrees); got != tt.expected {
+			t.Errorf("expected %v° to be %s, got %s", tt.degrees, tt.expected, got)
+		}
+	}
+}
+
+// TestCurrentHandler tests serving the latest observation of the nearest
+// station
+func TestCurrentHandler(t *testing.T) {
+	points := fakeResponse{body: `{"properties": {"observationStations": "` + fakeNWSHost + `/gridpoints/SEW/124,67/stations"}}`}
+	stations := fakeResponse{body: `{"features": [{"id": "` + fakeNWSHost + `/stations/KSEA"}, {"id": "` + fakeNWSHost + `/stations/KBFI"}]}`}
+	observation := fakeResponse{body: `{"properties": {
+		"station": "` + fakeNWSHost + `/stations/KSEA",
+		"timestamp": "2024-06-01T12:53:00+00:00",
+		"textDescription": "Mostly Cloudy",
+		"temperature": {"unitCode": "wmoUnit:degC", "value": 28.33},
+		"windSpeed": {"unitCode": "wmoUnit:km_h-1", "value": 27.72},
+		"windDirection": {"unitCode": "wmoUnit:degree_(angle)", "value": 310},
+		"relativeHumidity": {"unitCode": "wmoUnit:percent", "value": null}
+	}}`}
+	tests := []struct {
+		name           string
+		responses      map[string]fakeResponse
+		expectedStatus int
+	}{
+		{
+			name:           "nearest station",
+			responses:      map[string]fakeResponse{"/points/": points, "/gridpoints/": stations, "/stations/KSEA/observations/latest": observation},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no stations",
+			responses:      map[string]fakeResponse{"/points/": points, "/gridpoints/": {body: `{"features": []}`}},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "observation unavailable",
+			responses:      map[string]fakeResponse{"/points/": points, "/gridpoints/": stations, "/stations/": {status: http.StatusServiceUnavailable}},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			srv.nws = newFakeDoer(tt.responses)
+			w := httptest.NewRecorder()
+			srv.currentHandler(w, httptest.NewRequest("GET", "/current?latitude=47.6062&longitude=-122.3321", nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp currentResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Station != "KSEA" || resp.Description != "Mostly Cloudy" || resp.ObservedAt.IsZero() {
+				t.Errorf("unexpected observation %+v", resp)
+			}
+			if resp.TemperatureC == nil || *resp.TemperatureC != 28.3 || resp.Temperature != "hot" {
+				t.Errorf("expected a hot 28.3°C, got %v %q", resp.TemperatureC, resp.Temperature)
+			}
+			if resp.WindSpeedKPH == nil || *resp.WindSpeedKPH != 27.7 || resp.Wind != "windy" || resp.WindDirection != "NW" {
+				t.Errorf("expected a windy NW wind of 27.7 km/h, got %v %q %q", resp.WindSpeedKPH, resp.Wind, resp.WindDirection)
+			}
+			if resp.RelativeHumidity != nil {
+				t.Errorf("expected no humidity, got %v", *resp.RelativeHumidity)
+			}
+		})
+	}
+}
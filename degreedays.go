@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultDegreeDayBaseC is the conventional 65°F base for heating and
+	// cooling degree days
+	defaultDegreeDayBaseC = 18.3
+	// defaultGrowingBaseC and growingCapC are the 50°F base and 86°F cap of the
+	// common growing degree day method for corn and many other crops
+	defaultGrowingBaseC = 10.0
+	growingCapC         = 30.0
+)
+
+// degreeDay holds the degree days of one local calendar day, in °C·days
+type degreeDay struct {
+	Date    string  `json:"date"`
+	MinC    float64 `json:"minC"`
+	MaxC    float64 `json:"maxC"`
+	MeanC   float64 `json:"meanC"`
+	Heating float64 `json:"heatingDegreeDays"`
+	Cooling float64 `json:"coolingDegreeDays"`
+	Growing float64 `json:"growingDegreeDays"`
+	// Partial is set for days the forecast covers only some hours of, whose
+	// extremes may be missing
+	Partial bool `json:"partial,omitempty"`
+}
+
+// degreeDayTotals sums degree days over the forecast
+type degreeDayTotals struct {
+	Heating float64 `json:"heatingDegreeDays"`
+	Cooling float64 `json:"coolingDegreeDays"`
+	Growing float64 `json:"growingDegreeDays"`
+}
+
+// degreeDaysResponse is the body of /degree-days
+type degreeDaysResponse struct {
+	Latitude     float64         `json:"latitude"`
+	Longitude    float64         `json:"longitude"`
+	BaseC        float64         `json:"baseC"`
+	GrowingBaseC float64         `json:"growingBaseC"`
+	Days         []degreeDay     `json:"days"`
+	Totals       degreeDayTotals `json:"totals"`
+}
+
+// computeDegreeDays groups hourly periods by local date and computes degree
+// days from each day's mean of its high and low. Growing degree days cap the
+// high at growingCapC and floor both extremes at growingBase.
+func computeDegreeDays(periods []weatherPeriod, base, growingBase float64) ([]degreeDay, degreeDayTotals) {
+	var days []degreeDay
+	var hours []int
+	for _, p := range periods {
+		date := p.Start.Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, degreeDay{Date: date, MinC: p.TemperatureC, MaxC: p.TemperatureC})
+			hours = append(hours, 0)
+		}
+		d := &days[len(days)-1]
+		d.MinC = min(d.MinC, p.TemperatureC)
+		d.MaxC = max(d.MaxC, p.TemperatureC)
+		hours[len(hours)-1] += max(1, int(p.End.Sub(p.Start).Hours()))
+	}
+
+	var totals degreeDayTotals
+	for i := range days {
+		d := &days[i]
+		d.MeanC = roundTenth((d.MinC + d.MaxC) / 2)
+		d.Heating = roundTenth(max(0, base-d.MeanC))
+		d.Cooling = roundTenth(max(0, d.MeanC-base))
+		high := max(min(d.MaxC, growingCapC), growingBase)
+		low := max(min(d.MinC, growingCapC), growingBase)
+		d.Growing = roundTenth((high+low)/2 - growingBase)
+		d.Partial = hours[i] < 24
+
+		totals.Heating += d.Heating
+		totals.Cooling += d.Cooling
+		totals.Growing += d.Growing
+	}
+	totals.Heating = roundTenth(totals.Heating)
+	totals.Cooling = roundTenth(totals.Cooling)
+	totals.Growing = roundTenth(totals.Growing)
+	return days, totals
+}
+
+// roundTenth rounds to one decimal place
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// parseBaseTemperature reads a base temperature in °C from the query, falling
+// back to def when the parameter is absent
+func parseBaseTemperature(r *http.Request, name string, def float64) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	base, err := strconv.ParseFloat(v, 64)
+	if err != nil || base < -50 || base > 50 {
+		return 0, fmt.Errorf("Invalid %s parameter (want °C between -50 and 50)", name)
+	}
+	return base, nil
+}
+
+// degreeDaysHandler serves heating, cooling, and growing degree days for each
+// day of the hourly forecast
+func (s *server) degreeDaysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	base, err := parseBaseTemperature(r, "base", defaultDegreeDayBaseC)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	growingBase, err := parseBaseTemperature(r, "growingBase", defaultGrowingBaseC)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := degreeDaysResponse{BaseC: base, GrowingBaseC: growingBase}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	resp.Days, resp.Totals = computeDegreeDays(periods, base, growingBase)
+	if resp.Days == nil {
+		resp.Days = []degreeDay{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestComputeDegreeDays tests degree days over whole and partial days
+func TestComputeDegreeDays(t *testing.T) {
+	zone := time.FixedZone("CDT", -5*60*60)
+	start := time.Date(2024, 7, 1, 18, 0, 0, 0, zone)
+	var periods []weatherPeriod
+	// Six evening hours on July 1st, then all of July 2nd
+	for i := range 30 {
+		p := weatherPeriod{Start: start.Add(time.Duration(i) * time.Hour)}
+		p.End = p.Start.Add(time.Hour)
+		switch {
+		case i < 6:
+			p.TemperatureC = 24
+		case p.Start.Hour() < 12:
+			p.TemperatureC = 20
+		default:
+			p.TemperatureC = 34
+		}
+		periods = append(periods, p)
+	}
+
+	days, totals := computeDegreeDays(periods, defaultDegreeDayBaseC, defaultGrowingBaseC)
+	expected := []degreeDay{
+		{Date: "2024-07-01", MinC: 24, MaxC: 24, MeanC: 24, Cooling: 5.7, Growing: 14, Partial: true},
+		// The 34°C high is capped at 30°C for growing degree days
+		{Date: "2024-07-02", MinC: 20, MaxC: 34, MeanC: 27, Cooling: 8.7, Growing: 15},
+	}
+	if len(days) != len(expected) {
+		t.Fatalf("expected %d days, got %d", len(expected), len(days))
+	}
+	for i := range expected {
+		if days[i] != expected[i] {
+			t.Errorf("day %d: expected %+v, got %+v", i, expected[i], days[i])
+		}
+	}
+	if want := (degreeDayTotals{Cooling: 14.4, Growing: 29}); totals != want {
+		t.Errorf("expected %+v, got %+v", want, totals)
+	}
+
+	// A cold day accrues heating degree days and no growing degree days
+	cold := []weatherPeriod{{Start: start, End: start.Add(24 * time.Hour), TemperatureC: -2}}
+	days, _ = computeDegreeDays(cold, defaultDegreeDayBaseC, defaultGrowingBaseC)
+	if days[0].Heating != 20.3 || days[0].Cooling != 0 || days[0].Growing != 0 || days[0].Partial {
+		t.Errorf("unexpected cold day %+v", days[0])
+	}
+}
+
+// TestParseBaseTemperature tests reading base temperatures from the query
+func TestParseBaseTemperature(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected float64
+		valid    bool
+	}{
+		{query: "", expected: 18.3, valid: true},
+		{query: "base=15.5", expected: 15.5, valid: true},
+		{query: "base=-5", expected: -5, valid: true},
+		{query: "base=warm"},
+		{query: "base=100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/degree-days?"+tt.query, nil)
+			got, err := parseBaseTemperature(r, "base", defaultDegreeDayBaseC)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got error %v", tt.valid, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+const (
+	// defaultDeliveriesLimit and maxDeliveriesLimit bound the deliveries listed
+	// for a subscription
+	defaultDeliveriesLimit = 20
+	maxDeliveriesLimit     = 100
+)
+
+// webhooksReplayed counts deliveries resent on request
+var webhooksReplayed = expvar.NewInt("forecast_webhooks_replayed")
+
+// deliver sends d to a subscription's webhook, at d.SentAt or now when that's
+// zero, and fills in whether it was delivered. It's signed with the owner's
+// active signing keys, if there are any. When persistence is enabled the
+// delivery is recorded so it can be replayed later.
+func (s *server) deliver(ctx context.Context, sub Subscription, d *Delivery) error {
+	d.SubscriptionID = sub.ID
+	if d.SentAt.IsZero() {
+		d.SentAt = s.clock.Now()
+	}
+	err := deliverWebhook(ctx, s.webhooks, sub, s.signingSecrets(ctx, sub.Owner), d.Event, d.Body, d.ContentType, d.SentAt)
+	d.Delivered = err == nil
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if s.store != nil {
+		if err := s.store.AddDelivery(ctx, d); err != nil {
+			log.Printf("Failed to record delivery to webhook %d: %v", sub.ID, err)
+		}
+	}
+	return err
+}
+
+// ownedSubscription returns a subscription of the caller's owner, or any
+// subscription for admin keys. It returns ErrNotFound for the subscriptions of
+// other owners, so their existence isn't revealed.
+func (s *server) ownedSubscription(r *http.Request, id int64) (*Subscription, error) {
+	key := apiKeyFromContext(r.Context())
+	owner := key.Owner
+	if slices.Contains(key.Roles, scopeAdmin) {
+		owner = ""
+	}
+	subs, err := s.store.ListSubscriptions(r.Context(), owner)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(subs, func(sub Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	return &subs[i], nil
+}
+
+// listDeliveriesHandler lists the latest deliveries to a subscription
+func (s *server) listDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveriesLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit parameter (want 1 to %d)", maxDeliveriesLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	_, err = s.ownedSubscription(r, id)
+	var deliveries []Delivery
+	if err == nil {
+		deliveries, err = s.store.ListDeliveries(r.Context(), id, limit)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to list deliveries: %v", err)
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// replayDeliveryHandler resends the archived body of a past delivery to its
+// subscription's current webhook, signed afresh, and returns the new delivery
+func (s *server) replayDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	past, err := s.store.GetDelivery(r.Context(), id)
+	var sub *Subscription
+	if err == nil {
+		sub, err = s.ownedSubscription(r, past.SubscriptionID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read delivery: %v", err)
+		http.Error(w, "Failed to read delivery", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, "delivery.replay", strconv.FormatInt(id, 10))
+	replay := &Delivery{Event: past.Event, ContentType: past.ContentType, Body: past.Body, ReplayOf: past.ID}
+	s.deliver(r.Context(), *sub, replay)
+	webhooksReplayed.Add(1)
+	status := http.StatusOK
+	if !replay.Delivered {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, replay)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReplayDelivery tests listing a subscription's deliveries and replaying
+// one as its owner or an admin
+func TestReplayDelivery(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusOK
+	var bodies []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, r.Header.Get("X-Forecast-Event")+" "+string(body))
+		w.WriteHeader(status)
+	}))
+	defer hook.Close()
+
+	srv, tokens := newAuthServer(t, Config{})
+	handler := srv.routes()
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	ctx := context.Background()
+	sub := Subscription{Owner: "owner-subscribe", WebhookURL: hook.URL, Secret: "s3cret"}
+	if err := srv.store.CreateSubscription(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	sent := &Delivery{Event: reportEvent, ContentType: "text/plain", Body: []byte("weekly report"), SentAt: time.Now().Add(-time.Hour)}
+	if err := srv.deliver(ctx, sub, sent); err != nil || !sent.Delivered || sent.ID == 0 {
+		t.Fatalf("expected a recorded delivery, got %+v (%v)", sent, err)
+	}
+
+	replayPath := "/deliveries/" + strconv.FormatInt(sent.ID, 10) + "/replay"
+	if w := do("POST", replayPath, tokens[scopeSubscribe]); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := do("POST", replayPath, tokens[scopeAdmin]); w.Code != http.StatusOK {
+		t.Errorf("expected an admin to replay any delivery, got %d", w.Code)
+	}
+	if w := do("POST", replayPath, tokens[scopeRead]); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a read key, got %d", w.Code)
+	}
+	if w := do("POST", "/deliveries/999/replay", tokens[scopeSubscribe]); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown delivery, got %d", w.Code)
+	}
+	mu.Lock()
+	if len(bodies) != 3 || bodies[1] != bodies[0] || bodies[2] != bodies[0] {
+		t.Errorf("expected the original body to be resent twice, got %q", bodies)
+	}
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	w := do("POST", replayPath, tokens[scopeSubscribe])
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502 for a failed replay, got %d", w.Code)
+	}
+	var failed Delivery
+	json.NewDecoder(w.Body).Decode(&failed)
+	if failed.Delivered || failed.ReplayOf != sent.ID || !strings.Contains(failed.Error, "500") {
+		t.Errorf("unexpected failed replay %+v", failed)
+	}
+
+	listPath := "/subscriptions/" + strconv.FormatInt(sub.ID, 10) + "/deliveries"
+	w = do("GET", listPath+"?limit=2", tokens[scopeSubscribe])
+	var deliveries []Delivery
+	if err := json.Unmarshal(w.Body.Bytes(), &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].ID != failed.ID || deliveries[1].ReplayOf != sent.ID {
+		t.Errorf("expected the latest two deliveries newest first, got %+v", deliveries)
+	}
+	if w := do("GET", listPath, tokens[scopeRead]); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a read key, got %d", w.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFiles holds the demo page and its assets
+//
+//go:embed web
+var webFiles embed.FS
+
+// demoFS serves the files under web/
+var demoFS, _ = fs.Sub(webFiles, "web")
+
+// demoContentSecurityPolicy lets the demo page load its own script and
+// stylesheet and call the API, and nothing else
+const demoContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'"
+
+// demoHandler serves the demo page, a form that looks up a point with the API
+// and renders its forecast
+func demoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", demoContentSecurityPolicy)
+	http.ServeFileFS(w, r, demoFS, "index.html")
+}
+
+// demoAssetHandler serves the scripts and stylesheets of the demo page
+func demoAssetHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	if name == "index.html" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", demoContentSecurityPolicy)
+	http.ServeFileFS(w, r, demoFS, name)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDemoPage tests serving the demo page and its assets without credentials
+func TestDemoPage(t *testing.T) {
+	handler := newServer(Config{AuthRequired: true}).routes()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedType   string
+		expectedBody   string
+	}{
+		{name: "page", method: "GET", path: "/", expectedStatus: http.StatusOK, expectedType: "text/html", expectedBody: `<form id="lookup">`},
+		{name: "script", method: "GET", path: "/demo/demo.js", expectedStatus: http.StatusOK, expectedType: "text/javascript", expectedBody: "/forecast/hourly?"},
+		{name: "stylesheet", method: "GET", path: "/demo/demo.css", expectedStatus: http.StatusOK, expectedType: "text/css"},
+		{name: "missing asset", method: "GET", path: "/demo/missing.js", expectedStatus: http.StatusNotFound},
+		{name: "unknown path", method: "GET", path: "/nowhere", expectedStatus: http.StatusNotFound},
+		{name: "post", method: "POST", path: "/", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.expectedType) {
+				t.Errorf("expected content type %s, got %s", tt.expectedType, ct)
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != demoContentSecurityPolicy {
+				t.Errorf("expected the demo content security policy, got %q", csp)
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q", tt.expectedBody)
+			}
+		})
+	}
+}
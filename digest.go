@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// digestEvent is the webhook event held notifications are delivered as
+	digestEvent = "digest"
+	// digestInterval is how often held notifications are checked for digests
+	// that are due
+	digestInterval = 5 * time.Minute
+	// maxNotificationsPerDay bounds a subscription's daily cap
+	maxNotificationsPerDay = 1000
+)
+
+// notificationsHeld counts notifications held for a digest by quiet hours or
+// a daily cap
+var notificationsHeld = expvar.NewInt("forecast_notifications_held")
+
+// parseClock reads a local time such as "07:30" as minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validateNotificationPolicy checks a subscription's quiet hours, time zone,
+// and daily cap
+func validateNotificationPolicy(quietStart, quietEnd, timeZone string, maxPerDay int) error {
+	if (quietStart == "") != (quietEnd == "") {
+		return fmt.Errorf("quietStart and quietEnd must be given together")
+	}
+	if quietStart != "" {
+		for _, v := range []string{quietStart, quietEnd} {
+			if _, err := parseClock(v); err != nil {
+				return fmt.Errorf("quiet hours: %v", err)
+			}
+		}
+		if quietStart == quietEnd {
+			return fmt.Errorf("quietStart and quietEnd must differ")
+		}
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return fmt.Errorf("unknown timeZone %q", timeZone)
+	}
+	if maxPerDay < 0 || maxPerDay > maxNotificationsPerDay {
+		return fmt.Errorf("maxPerDay must be from 0 to %d", maxNotificationsPerDay)
+	}
+	return nil
+}
+
+// location returns the subscription's time zone, UTC when it's unset or
+// unknown
+func (sub Subscription) location() *time.Location {
+	loc, err := time.LoadLocation(sub.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// quiet reports whether t falls in the subscription's quiet hours. Quiet hours
+// that end before they start span midnight.
+func (sub Subscription) quiet(t time.Time) bool {
+	start, err := parseClock(sub.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(sub.QuietEnd)
+	if err != nil {
+		return false
+	}
+	t = t.In(sub.location())
+	m := t.Hour()*60 + t.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// capped reports whether the subscription has had its daily cap of
+// notifications as of now, counting from midnight in its time zone
+func (s *server) capped(ctx context.Context, sub Subscription, now time.Time) (bool, error) {
+	if sub.MaxPerDay == 0 {
+		return false, nil
+	}
+	local := now.In(sub.location())
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	n, err := s.store.CountDeliveries(ctx, sub.ID, midnight)
+	if err != nil {
+		return false, err
+	}
+	return n >= sub.MaxPerDay, nil
+}
+
+// notify delivers d to a subscription like deliver, unless it's in its quiet
+// hours or has had its daily cap, in which case d is recorded as held for the
+// next digest
+func (s *server) notify(ctx context.Context, sub Subscription, d *Delivery) error {
+	if s.store == nil {
+		return s.deliver(ctx, sub, d)
+	}
+	d.SubscriptionID = sub.ID
+	if d.SentAt.IsZero() {
+		d.SentAt = s.clock.Now()
+	}
+	hold := sub.quiet(d.SentAt)
+	if !hold {
+		capped, err := s.capped(ctx, sub, d.SentAt)
+		if err != nil {
+			log.Printf("Failed to check the daily cap of webhook %d: %v", sub.ID, err)
+		}
+		hold = capped
+	}
+	if !hold {
+		return s.deliver(ctx, sub, d)
+	}
+	return s.hold(ctx, sub, d)
+}
+
+// hold records d as held for a subscription's next digest
+func (s *server) hold(ctx context.Context, sub Subscription, d *Delivery) error {
+	d.SubscriptionID = sub.ID
+	if d.SentAt.IsZero() {
+		d.SentAt = s.clock.Now()
+	}
+	d.Held = true
+	if err := s.store.AddDelivery(ctx, d); err != nil {
+		return fmt.Errorf("failed to hold notification for webhook %d: %v", sub.ID, err)
+	}
+	notificationsHeld.Add(1)
+	return nil
+}
+
+// digestNotification is a held notification as it's sent in a digest. The
+// body is base64 encoded in JSON, since it may be HTML or a PDF.
+type digestNotification struct {
+	ID          int64     `json:"id"`
+	Event       string    `json:"event"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	HeldAt      time.Time `json:"heldAt"`
+}
+
+// digestBody is the body of a digest delivery
+type digestBody struct {
+	Notifications []digestNotification `json:"notifications"`
+}
+
+// sendDigests delivers the held notifications of each subscription that's out
+// of its quiet hours and under its daily cap as a single digest, returning how
+// many digests were delivered. A digest that fails is retried next time.
+func (s *server) sendDigests(ctx context.Context, now time.Time) (int, error) {
+	held, err := s.store.ListHeldDeliveries(ctx)
+	if err != nil || len(held) == 0 {
+		return 0, err
+	}
+	subs, err := s.store.ListSubscriptions(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[int64]Subscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+	}
+	pending := make(map[int64][]Delivery)
+	var order []int64
+	for _, d := range held {
+		if _, ok := pending[d.SubscriptionID]; !ok {
+			order = append(order, d.SubscriptionID)
+		}
+		pending[d.SubscriptionID] = append(pending[d.SubscriptionID], d)
+	}
+
+	sent := 0
+	for _, id := range order {
+		sub, ok := byID[id]
+		if !ok || sub.quiet(now) {
+			continue
+		}
+		if capped, err := s.capped(ctx, sub, now); err != nil || capped {
+			if err != nil {
+				log.Printf("Failed to check the daily cap of webhook %d: %v", sub.ID, err)
+			}
+			continue
+		}
+		var body digestBody
+		for _, d := range pending[id] {
+			body.Notifications = append(body.Notifications, digestNotification{
+				ID: d.ID, Event: d.Event, ContentType: d.ContentType, Body: d.Body, HeldAt: d.SentAt,
+			})
+		}
+		b, err := json.Marshal(body)
+		if err != nil {
+			return sent, err
+		}
+		digest := &Delivery{Event: digestEvent, ContentType: "application/json", Body: b, SentAt: now}
+		if err := s.deliver(ctx, sub, digest); err != nil {
+			log.Printf("Failed to deliver digest: %v", err)
+			continue
+		}
+		last := pending[id][len(pending[id])-1].ID
+		if err := s.store.ReleaseDeliveries(ctx, id, last, digest.ID); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// digestJob sends the digests that are due every digestInterval
+func (s *server) digestJob() *job {
+	return &job{
+		name: "digests",
+		schedule: func() (jobSchedule, error) {
+			return everySchedule(digestInterval), nil
+		},
+		run: func(ctx context.Context) error {
+			trace := newTrace()
+			n, err := s.sendDigests(withTrace(ctx, trace), s.clock.Now())
+			if err != nil {
+				log.Printf("Digests failed (request %s): %v", trace.RequestID, err)
+			} else if n > 0 {
+				log.Printf("Delivered %d digests (request %s)", n, trace.RequestID)
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestValidateNotificationPolicy tests validating quiet hours and daily caps
+func TestValidateNotificationPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		quietStart string
+		quietEnd   string
+		timeZone   string
+		maxPerDay  int
+		wantErr    bool
+	}{
+		{name: "none"},
+		{name: "overnight", quietStart: "22:00", quietEnd: "07:00", timeZone: "America/Chicago", maxPerDay: 5},
+		{name: "start only", quietStart: "22:00", wantErr: true},
+		{name: "invalid time", quietStart: "10pm", quietEnd: "07:00", wantErr: true},
+		{name: "empty window", quietStart: "07:00", quietEnd: "07:00", wantErr: true},
+		{name: "unknown zone", timeZone: "Mars/Olympus_Mons", wantErr: true},
+		{name: "negative cap", maxPerDay: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNotificationPolicy(tt.quietStart, tt.quietEnd, tt.timeZone, tt.maxPerDay)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestSubscriptionQuiet tests quiet hours within a day and across midnight in
+// a subscription's time zone
+func TestSubscriptionQuiet(t *testing.T) {
+	overnight := Subscription{QuietStart: "22:00", QuietEnd: "07:00", TimeZone: "America/Chicago"}
+	lunch := Subscription{QuietStart: "12:00", QuietEnd: "13:00"}
+	tests := []struct {
+		name     string
+		sub      Subscription
+		at       time.Time
+		expected bool
+	}{
+		{name: "no quiet hours", sub: Subscription{}, at: time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)},
+		{name: "before midnight", sub: overnight, at: time.Date(2024, 6, 2, 3, 30, 0, 0, time.UTC), expected: true},
+		{name: "after midnight", sub: overnight, at: time.Date(2024, 6, 2, 11, 59, 0, 0, time.UTC), expected: true},
+		{name: "at the end", sub: overnight, at: time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)},
+		{name: "daytime", sub: overnight, at: time.Date(2024, 6, 2, 18, 0, 0, 0, time.UTC)},
+		{name: "within a day", sub: lunch, at: time.Date(2024, 6, 2, 12, 30, 0, 0, time.UTC), expected: true},
+		{name: "outside a day window", sub: lunch, at: time.Date(2024, 6, 2, 23, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.quiet(tt.at); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestNotifyDigest tests holding notifications during quiet hours and past
+// the daily cap, then sending them as one digest
+func TestNotifyDigest(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var last []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, r.Header.Get("X-Forecast-Event"))
+		last = body
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{})
+	srv.store = newTestStore(t)
+	ctx := context.Background()
+	sub := Subscription{Owner: "alice", WebhookURL: hook.URL, Secret: "s3cret", QuietStart: "22:00", QuietEnd: "07:00", MaxPerDay: 2}
+	if err := srv.store.CreateSubscription(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	notify := func(body string, at time.Time) *Delivery {
+		t.Helper()
+		d := &Delivery{Event: reportEvent, ContentType: "text/plain", Body: []byte(body), SentAt: at}
+		if err := srv.notify(ctx, sub, d); err != nil {
+			t.Fatalf("notify failed: %v", err)
+		}
+		return d
+	}
+
+	night := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+	if d := notify("one", night); !d.Held {
+		t.Errorf("expected a notification during quiet hours to be held, got %+v", d)
+	}
+	notify("two", night.Add(time.Hour))
+	if n, err := srv.sendDigests(ctx, night.Add(2*time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected no digest during quiet hours, got %d (%v)", n, err)
+	}
+
+	morning := time.Date(2024, 6, 2, 7, 0, 0, 0, time.UTC)
+	if n, err := srv.sendDigests(ctx, morning); err != nil || n != 1 {
+		t.Fatalf("expected a digest after quiet hours, got %d (%v)", n, err)
+	}
+	var digest digestBody
+	if err := json.Unmarshal(last, &digest); err != nil {
+		t.Fatal(err)
+	}
+	if len(digest.Notifications) != 2 || string(digest.Notifications[0].Body) != "one" || string(digest.Notifications[1].Body) != "two" {
+		t.Errorf("expected both held notifications in order, got %+v", digest.Notifications)
+	}
+	if n, _ := srv.sendDigests(ctx, morning.Add(time.Hour)); n != 0 {
+		t.Errorf("expected released notifications not to be sent again, got %d digests", n)
+	}
+
+	// The digest is the first of the day's two notifications
+	if d := notify("three", morning.Add(time.Hour)); d.Held || !d.Delivered {
+		t.Errorf("expected a notification under the cap to be delivered, got %+v", d)
+	}
+	if d := notify("four", morning.Add(2*time.Hour)); !d.Held {
+		t.Errorf("expected a notification past the cap to be held, got %+v", d)
+	}
+	if n, _ := srv.sendDigests(ctx, morning.Add(3*time.Hour)); n != 0 {
+		t.Errorf("expected no digest while capped, got %d", n)
+	}
+	if n, err := srv.sendDigests(ctx, morning.Add(24*time.Hour)); err != nil || n != 1 {
+		t.Errorf("expected a digest the next day, got %d (%v)", n, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{digestEvent, reportEvent, digestEvent}
+	if len(events) != len(expected) || events[0] != expected[0] || events[1] != expected[1] || events[2] != expected[2] {
+		t.Errorf("expected webhook events %v, got %v", expected, events)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import "net/http"
+
+// doer sends outbound HTTP requests. The server sends requests to NWS and
+// webhooks only through doers, so tests can substitute ones that answer
+// without a network and fail the way networks do. *http.Client is one.
+type doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
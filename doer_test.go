@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResponse is a canned answer of a fakeDoer
+type fakeResponse struct {
+	status int
+	body   string
+	// err fails the request, as a timeout or refused connection would
+	err error
+	// truncate cuts the body off after this many bytes with an unexpected
+	// EOF, when it's nonzero
+	truncate int
+	// header is sent along with the Content-Type
+	header http.Header
+}
+
+// fakeDoer answers requests from canned responses keyed by URL path prefix,
+// the longest matching prefix winning, and records the requests it's sent.
+// Paths without a response are 404.
+type fakeDoer struct {
+	mu        sync.Mutex
+	responses map[string]fakeResponse
+	requests  []*http.Request
+}
+
+func newFakeDoer(responses map[string]fakeResponse) *fakeDoer {
+	return &fakeDoer{responses: responses}
+}
+
+// fakeNWSHost is the NWS host fake NWS responses link to
+const fakeNWSHost = "http://nws.test"
+
+// newFakeNWSDoer returns a fakeDoer answering the points endpoint with a
+// gridpoint whose forecast is forecast
+func newFakeNWSDoer(forecast fakeResponse) *fakeDoer {
+	return newFakeDoer(map[string]fakeResponse{
+		"/points/":                        {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast"}}`},
+		"/gridpoints/SEW/124,67/forecast": forecast,
+	})
+}
+
+func (f *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	match, resp := "", fakeResponse{status: http.StatusNotFound}
+	for prefix, r := range f.responses {
+		if strings.HasPrefix(req.URL.Path, prefix) && len(prefix) > len(match) {
+			match, resp = prefix, r
+		}
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	var body io.Reader = strings.NewReader(resp.body)
+	if resp.truncate > 0 {
+		body = io.MultiReader(strings.NewReader(resp.body[:resp.truncate]), errReader{io.ErrUnexpectedEOF})
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	for name, values := range resp.header {
+		header[name] = values
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", resp.status, http.StatusText(resp.status)),
+		StatusCode: resp.status,
+		Header:     header,
+		Body:       io.NopCloser(body),
+		Request:    req,
+	}, nil
+}
+
+// paths returns the paths of the requests sent
+func (f *fakeDoer) paths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for _, req := range f.requests {
+		paths = append(paths, req.URL.Path)
+	}
+	return paths
+}
+
+// errReader fails every read with err
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// TestForecastHandlerUpstreamFaults tests the status reported for each way a
+// request to NWS can fail
+func TestForecastHandlerUpstreamFaults(t *testing.T) {
+	forecast := `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`
+	tests := []struct {
+		name           string
+		nws            *fakeDoer
+		expectedStatus int
+	}{
+		{name: "success", nws: newFakeNWSDoer(fakeResponse{body: forecast}), expectedStatus: http.StatusOK},
+		{name: "timeout", nws: newFakeNWSDoer(fakeResponse{err: context.DeadlineExceeded}), expectedStatus: http.StatusInternalServerError},
+		{name: "partial body", nws: newFakeNWSDoer(fakeResponse{body: forecast, truncate: 20}), expectedStatus: http.StatusInternalServerError},
+		{name: "unavailable", nws: newFakeNWSDoer(fakeResponse{status: http.StatusServiceUnavailable}), expectedStatus: http.StatusServiceUnavailable},
+		{name: "unknown point", nws: newFakeDoer(nil), expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			srv.nws = tt.nws
+			w := httptest.NewRecorder()
+			srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestNWSRequests tests the requests sent to NWS for a forecast
+func TestNWSRequests(t *testing.T) {
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = nws
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+	var out ForecastOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil || out.Forecast != "Sunny" {
+		t.Fatalf("expected a forecast, got %s", w.Body.String())
+	}
+	expected := []string{"/points/47.6062,-122.3321", "/gridpoints/SEW/124,67/forecast"}
+	if got := nws.paths(); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected requests %v, got %v", expected, got)
+	}
+	for _, req := range nws.requests {
+		if req.Header.Get("User-Agent") != userAgent {
+			t.Errorf("expected the User-Agent on %s, got %q", req.URL.Path, req.Header.Get("User-Agent"))
+		}
+	}
+}
+
+// doerFunc answers requests with a function
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
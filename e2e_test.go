@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenario describes an end-to-end run of the server against a scripted fake NWS
+type scenario struct {
+	Name     string          `yaml:"name"`
+	Upstream []upstreamRoute `yaml:"upstream"`
+	Steps    []scenarioStep  `yaml:"steps"`
+}
+
+// upstreamRoute scripts the responses the fake NWS returns for a path. Each call
+// consumes the next response; the last one is repeated once the script runs out.
+// A path ending in "*" matches by prefix.
+type upstreamRoute struct {
+	Path      string             `yaml:"path"`
+	Responses []upstreamResponse `yaml:"responses"`
+}
+
+// upstreamResponse is a single scripted reply from the fake NWS
+type upstreamResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Delay   time.Duration     `yaml:"delay"`
+	// Fail simulates a transport failure instead of a response; "reset" drops the connection
+	Fail string `yaml:"fail"`
+}
+
+// scenarioStep is a client request made against the server and what it should observe
+type scenarioStep struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Sleep   time.Duration     `yaml:"sleep"`
+	Expect  stepExpectation   `yaml:"expect"`
+}
+
+// stepExpectation holds the client-visible assertions for a step. UpstreamCalls
+// counts are cumulative for the whole scenario, keyed by upstream route path.
+type stepExpectation struct {
+	Status        int               `yaml:"status"`
+	Headers       map[string]string `yaml:"headers"`
+	JSON          any               `yaml:"json"`
+	BodyContains  string            `yaml:"bodyContains"`
+	UpstreamCalls map[string]int    `yaml:"upstreamCalls"`
+}
+
+// fakeNWS serves scripted upstream responses and records how often each route was hit
+type fakeNWS struct {
+	server *httptest.Server
+	routes []upstreamRoute
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// newFakeNWS starts a fake NWS server for the given routes. "{{upstream}}" in a
+// response body is replaced with the fake server's base URL.
+func newFakeNWS(routes []upstreamRoute) *fakeNWS {
+	f := &fakeNWS{routes: routes, calls: make(map[string]int)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeNWS) serve(w http.ResponseWriter, r *http.Request) {
+	route, ok := f.match(r.URL.Path)
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"status": 404, "detail": "no scripted route for %s"}`, r.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	n := f.calls[route.Path]
+	f.calls[route.Path] = n + 1
+	f.mu.Unlock()
+
+	if len(route.Responses) == 0 {
+		http.Error(w, "route has no scripted responses", http.StatusInternalServerError)
+		return
+	}
+	if n >= len(route.Responses) {
+		n = len(route.Responses) - 1
+	}
+	resp := route.Responses[n]
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if resp.Fail == "reset" {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			panic("fake NWS: response writer cannot be hijacked")
+		}
+		conn, _, err := hj.Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return
+	}
+
+	for k, v := range resp.Headers {
+		w.Header().Set(k, strings.ReplaceAll(v, "{{upstream}}", f.server.URL))
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/geo+json")
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, strings.ReplaceAll(resp.Body, "{{upstream}}", f.server.URL))
+}
+
+func (f *fakeNWS) match(path string) (upstreamRoute, bool) {
+	for _, route := range f.routes {
+		if prefix, ok := strings.CutSuffix(route.Path, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return route, true
+			}
+		} else if route.Path == path {
+			return route, true
+		}
+	}
+	return upstreamRoute{}, false
+}
+
+func (f *fakeNWS) callCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[path]
+}
+
+// TestScenarios runs every scenario in testdata/scenarios against the full server
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*.yaml"))
+	if err != nil {
+		t.Fatalf("failed to list scenarios: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenarios found in testdata/scenarios")
+	}
+
+	for _, file := range files {
+		sc := loadScenario(t, file)
+		t.Run(sc.Name, func(t *testing.T) {
+			runScenario(t, sc)
+		})
+	}
+}
+
+func loadScenario(t *testing.T, path string) scenario {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read scenario: %v", err)
+	}
+	var sc scenario
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&sc); err != nil {
+		t.Fatalf("failed to parse scenario %s: %v", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return sc
+}
+
+func runScenario(t *testing.T, sc scenario) {
+	upstream := newFakeNWS(sc.Upstream)
+	defer upstream.server.Close()
+
+	cfg := defaultConfig()
+	cfg.NWSAPIHost = upstream.server.URL
+	srv := httptest.NewServer(newServer(cfg).routes())
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for i, step := range sc.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i+1)
+		}
+
+		if step.Sleep > 0 {
+			time.Sleep(step.Sleep)
+		}
+
+		method := step.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req, err := http.NewRequest(method, srv.URL+step.Path, strings.NewReader(step.Body))
+		if err != nil {
+			t.Fatalf("%s: failed to build request: %v", name, err)
+		}
+		for k, v := range step.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", name, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to read response: %v", name, err)
+		}
+
+		checkStep(t, name, step.Expect, resp, body, upstream)
+	}
+}
+
+func checkStep(t *testing.T, name string, want stepExpectation, resp *http.Response, body []byte, upstream *fakeNWS) {
+	t.Helper()
+
+	if want.Status != 0 && resp.StatusCode != want.Status {
+		t.Errorf("%s: expected status %d, got %d (body: %s)", name, want.Status, resp.StatusCode, body)
+	}
+
+	for k, v := range want.Headers {
+		if got := resp.Header.Get(k); got != v {
+			t.Errorf("%s: expected header %s %q, got %q", name, k, v, got)
+		}
+	}
+
+	if want.BodyContains != "" && !strings.Contains(string(body), want.BodyContains) {
+		t.Errorf("%s: expected body to contain %q, got %q", name, want.BodyContains, body)
+	}
+
+	if want.JSON != nil {
+		var got any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("%s: failed to decode response body %q: %v", name, body, err)
+		} else if !jsonSubset(normalizeJSON(t, want.JSON), got) {
+			t.Errorf("%s: response %s does not match expected %v", name, body, want.JSON)
+		}
+	}
+
+	for path, n := range want.UpstreamCalls {
+		if got := upstream.callCount(path); got != n {
+			t.Errorf("%s: expected %d upstream calls to %s, got %d", name, n, path, got)
+		}
+	}
+}
+
+// normalizeJSON round-trips a YAML-decoded value through JSON so numbers and
+// maps have the same types as a decoded response body
+func normalizeJSON(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode expectation: %v", err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("failed to decode expectation: %v", err)
+	}
+	return out
+}
+
+// jsonSubset reports whether every field in want is present with the same value
+// in got. Arrays must match in length; their elements are compared as subsets.
+func jsonSubset(want, got any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok || !jsonSubset(wv, gv) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !jsonSubset(w[i], g[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(want, got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A forecast is for the elevation of its grid cell, which in the mountains
+// can be far from a trailhead or summit in it. /forecast, /forecast/hourly,
+// and /forecast/periods take the elevation wanted as ?elevation= and shift
+// temperatures to it by FORECAST_LAPSE_RATE.
+const (
+	// standardLapseRate is the average cooling with height of the standard
+	// atmosphere, in °C per km
+	standardLapseRate = 6.5
+	// maxLapseRate bounds the lapse rate to that of dry air, the fastest the
+	// atmosphere cools with height for long
+	maxLapseRate = 10
+	// minElevationM and maxElevationM bound the elevations accepted, a
+	// little past the lowest and highest land
+	minElevationM = -500
+	maxElevationM = 9000
+	// metersPerFoot converts elevations given in feet
+	metersPerFoot = 0.3048
+)
+
+// elevationAdjustment reports how a forecast was shifted to the elevation a
+// request asked for. Adjusted is false when it couldn't be, such as when NWS
+// didn't report the grid cell's elevation.
+type elevationAdjustment struct {
+	ElevationM     float64  `json:"elevationM" xml:"elevationM"`
+	GridElevationM *float64 `json:"gridElevationM,omitempty" xml:"gridElevationM,omitempty"`
+	AdjustmentC    float64  `json:"adjustmentC" xml:"adjustmentC"`
+	Adjusted       bool     `json:"adjusted" xml:"adjusted"`
+}
+
+// parseElevation reads the elevation parameter in meters, nil when it isn't
+// given. A number may end in ft or m, and is otherwise in feet for US units
+// and meters for metric ones.
+func parseElevation(r *http.Request, units string) (*float64, error) {
+	v := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("elevation")))
+	if v == "" {
+		return nil, nil
+	}
+	scale := 1.0
+	if units == unitsUS {
+		scale = metersPerFoot
+	}
+	if n, ok := strings.CutSuffix(v, "ft"); ok {
+		v, scale = n, metersPerFoot
+	} else if n, ok := strings.CutSuffix(v, "m"); ok {
+		v, scale = n, 1
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	m := n * scale
+	if err != nil || math.IsNaN(m) || m < minElevationM || m > maxElevationM {
+		return nil, fmt.Errorf("Invalid elevation parameter (want feet or meters such as 7200ft or 2200m, between %d and %d m)", minElevationM, maxElevationM)
+	}
+	return &m, nil
+}
+
+// adjustForElevation returns a copy of periods with their temperatures
+// shifted from their grid cell's elevation to elevationM by the configured
+// lapse rate, and the adjustment to report, nil when no elevation was asked
+// for. The forecast text, which NWS wrote for the grid cell, is left as it is.
+func (s *server) adjustForElevation(periods []weatherPeriod, elevationM *float64) ([]weatherPeriod, *elevationAdjustment) {
+	if elevationM == nil {
+		return periods, nil
+	}
+	adj := &elevationAdjustment{ElevationM: math.Round(*elevationM)}
+	if len(periods) == 0 || periods[0].GridElevationM == nil {
+		return periods, adj
+	}
+	grid := math.Round(*periods[0].GridElevationM)
+	adj.GridElevationM = &grid
+	rate := s.state.Config().LapseRate
+	if rate == 0 {
+		return periods, adj
+	}
+	delta := -rate * (*elevationM - *periods[0].GridElevationM) / 1000
+	adjusted := slices.Clone(periods)
+	for i := range adjusted {
+		adjusted[i].TemperatureC += delta
+	}
+	adj.AdjustmentC = math.Round(delta*10) / 10
+	adj.Adjusted = true
+	return adjusted, adj
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestParseElevation tests reading elevations in feet and meters
+func TestParseElevation(t *testing.T) {
+	tests := []struct {
+		value    string
+		units    string
+		expected float64
+		absent   bool
+		err      bool
+	}{
+		{value: "", units: unitsUS, absent: true},
+		{value: "7200", units: unitsUS, expected: 2194.56},
+		{value: "2200", units: unitsMetric, expected: 2200},
+		{value: "7200ft", units: unitsMetric, expected: 2194.56},
+		{value: "2200m", units: unitsUS, expected: 2200},
+		{value: " 2200 M ", units: unitsUS, expected: 2200},
+		{value: "-282ft", units: unitsUS, expected: -85.9536},
+		{value: "high", units: unitsUS, err: true},
+		{value: "NaN", units: unitsMetric, err: true},
+		{value: "30000m", units: unitsUS, err: true},
+		{value: "-1000m", units: unitsUS, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.units, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/forecast?elevation="+url.QueryEscape(tt.value), nil)
+			elevation, err := parseElevation(r, tt.units)
+			switch {
+			case tt.err:
+				if err == nil {
+					t.Errorf("expected an error, got %v", *elevation)
+				}
+			case err != nil:
+				t.Fatalf("expected no error, got %v", err)
+			case tt.absent:
+				if elevation != nil {
+					t.Errorf("expected no elevation, got %v", *elevation)
+				}
+			case elevation == nil || math.Abs(*elevation-tt.expected) > 1e-9:
+				t.Errorf("expected %v m, got %v", tt.expected, elevation)
+			}
+		})
+	}
+}
+
+// TestElevationAdjustment tests shifting forecast temperatures to the
+// elevation asked for, and flagging whether they were
+func TestElevationAdjustment(t *testing.T) {
+	meters := func(v float64) *float64 { return &v }
+	withElevation := `{"properties": {"elevation": {"unitCode": "wmoUnit:m", "value": 1000}, "periods": [{"temperature": 50, "temperatureUnit": "F", "shortForecast": "Sunny"}]}}`
+	tests := []struct {
+		name          string
+		path          string
+		forecast      string
+		lapseRate     float64
+		expected      *elevationAdjustment
+		expectedTempC float64
+	}{
+		{name: "no elevation", path: "/forecast/periods?latitude=46.8523&longitude=-121.7603", forecast: withElevation, lapseRate: standardLapseRate, expectedTempC: 10},
+		{
+			name:          "above the grid cell",
+			path:          "/forecast/periods?latitude=46.8523&longitude=-121.7603&elevation=3000m",
+			forecast:      withElevation,
+			lapseRate:     standardLapseRate,
+			expected:      &elevationAdjustment{ElevationM: 3000, GridElevationM: meters(1000), AdjustmentC: -13, Adjusted: true},
+			expectedTempC: -3,
+		},
+		{
+			name:          "below the grid cell",
+			path:          "/forecast/periods?latitude=46.8523&longitude=-121.7603&elevation=500m",
+			forecast:      withElevation,
+			lapseRate:     standardLapseRate,
+			expected:      &elevationAdjustment{ElevationM: 500, GridElevationM: meters(1000), AdjustmentC: 3.3, Adjusted: true},
+			expectedTempC: 13.25,
+		},
+		{
+			name:          "adjustment disabled",
+			path:          "/forecast/periods?latitude=46.8523&longitude=-121.7603&elevation=3000m",
+			forecast:      withElevation,
+			expected:      &elevationAdjustment{ElevationM: 3000, GridElevationM: meters(1000)},
+			expectedTempC: 10,
+		},
+		{
+			name:          "grid elevation unknown",
+			path:          "/forecast/periods?latitude=46.8523&longitude=-121.7603&elevation=3000m",
+			forecast:      `{"properties": {"periods": [{"temperature": 50, "temperatureUnit": "F", "shortForecast": "Sunny"}]}}`,
+			lapseRate:     standardLapseRate,
+			expected:      &elevationAdjustment{ElevationM: 3000},
+			expectedTempC: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost, LapseRate: tt.lapseRate})
+			srv.nws = newFakeNWSDoer(fakeResponse{body: tt.forecast})
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var resp periodsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(resp.Periods[0].TemperatureC-tt.expectedTempC) > 1e-9 {
+				t.Errorf("expected %v°C, got %v", tt.expectedTempC, resp.Periods[0].TemperatureC)
+			}
+			switch {
+			case tt.expected == nil && resp.Elevation != nil:
+				t.Errorf("expected no elevation, got %+v", *resp.Elevation)
+			case tt.expected == nil:
+			case resp.Elevation == nil:
+				t.Errorf("expected %+v, got no elevation", *tt.expected)
+			case resp.Elevation.ElevationM != tt.expected.ElevationM || resp.Elevation.AdjustmentC != tt.expected.AdjustmentC || resp.Elevation.Adjusted != tt.expected.Adjusted ||
+				(resp.Elevation.GridElevationM == nil) != (tt.expected.GridElevationM == nil) ||
+				(tt.expected.GridElevationM != nil && *resp.Elevation.GridElevationM != *tt.expected.GridElevationM):
+				t.Errorf("expected %+v, got %+v", *tt.expected, *resp.Elevation)
+			}
+		})
+	}
+}
+
+// TestForecastElevation tests that /forecast categorizes the adjusted
+// temperature and reports the adjustment
+func TestForecastElevation(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, LapseRate: standardLapseRate})
+	srv.nws = newFakeNWSDoer(fakeResponse{body: `{"properties": {"elevation": {"unitCode": "wmoUnit:m", "value": 0}, "periods": [{"temperature": 75, "temperatureUnit": "F", "shortForecast": "Sunny"}]}}`})
+	w := httptest.NewRecorder()
+	srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=46.8523&longitude=-121.7603&elevation=14000ft", nil))
+	var out ForecastOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("expected a forecast, got %d: %s", w.Code, w.Body.String())
+	}
+	if out.Temperature != "cold" {
+		t.Errorf("expected the summit to be cold, got %q", out.Temperature)
+	}
+	if out.Elevation == nil || !out.Elevation.Adjusted || out.Elevation.ElevationM != 4267 {
+		t.Errorf("expected an adjustment to 4267 m, got %+v", out.Elevation)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks a stored value sealed by a secretCipher. Values without
+// it are plaintext written before encryption was enabled.
+const encryptedPrefix = "enc:v1:"
+
+// secretCipher encrypts credentials before they are written to the store using
+// AES-256-GCM. New values are sealed with the primary key; every key in the ring
+// can still open values, so keys can be rotated without downtime.
+type secretCipher struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// keyringFile is the on-disk format of the encryption keys:
+//
+//	{"primary": "2024-06", "keys": {"2024-01": "<base64>", "2024-06": "<base64>"}}
+//
+// Each key is 32 random bytes, base64 encoded.
+type keyringFile struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// loadKeyring reads the encryption keys from a keyring file
+func loadKeyring(path string) (*secretCipher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption keys: %v", err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption keys: %v", err)
+	}
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q is not valid base64: %v", id, err)
+		}
+		keys[id] = key
+	}
+	return newSecretCipher(file.Primary, keys)
+}
+
+// newSecretCipher builds a cipher from 32-byte keys keyed by ID
+func newSecretCipher(primary string, keys map[string][]byte) (*secretCipher, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q not found", primary)
+	}
+	c := &secretCipher{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+// seal encrypts a value with the primary key. Empty values stay empty. A nil
+// cipher leaves values in plaintext.
+func (c *secretCipher) seal(plaintext string) (string, error) {
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	aead := c.keys[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	// The key ID is authenticated so a value can't be replayed under another key
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.primary))
+	return encryptedPrefix + c.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a stored value. Plaintext values are returned unchanged.
+func (c *secretCipher) open(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	if c == nil {
+		return "", fmt.Errorf("value is encrypted but no encryption keys are configured")
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("value is encrypted with unknown key %q", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %q: %v", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// current reports whether a stored value is already sealed with the primary key
+func (c *secretCipher) current(value string) bool {
+	if c == nil {
+		return !strings.HasPrefix(value, encryptedPrefix)
+	}
+	if value == "" {
+		return true
+	}
+	return strings.HasPrefix(value, encryptedPrefix+c.primary+":")
+}
+
+// runRotateKeysCommand implements `forecast rotate-keys [-database url]`, which
+// re-encrypts stored secrets with the primary key after it changes
+func runRotateKeysCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	fset.SetOutput(out)
+	databaseURL := fset.String("database", "", "database URL (defaults to FORECAST_DATABASE_URL)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openCommandStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if store.cipher == nil {
+		return fmt.Errorf("no encryption keys configured; set FORECAST_ENCRYPTION_KEYS_FILE")
+	}
+
+	n, err := store.rotateSecrets(context.Background())
+	fmt.Fprintf(out, "re-encrypted %d secrets with key %q\n", n, store.cipher.primary)
+	return err
+}
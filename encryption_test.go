@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// TestSecretCipherRoundTrip tests sealing and opening values across key rotation
+func TestSecretCipherRoundTrip(t *testing.T) {
+	old, err := newSecretCipher("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.seal("webhook-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:k1:") || strings.Contains(sealed, "webhook-secret") {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+
+	rotated, err := newSecretCipher("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.current(sealed) {
+		t.Error("value sealed with k1 should not be current after rotating to k2")
+	}
+	plaintext, err := rotated.open(sealed)
+	if err != nil || plaintext != "webhook-secret" {
+		t.Errorf("expected old key to still open value, got %q (%v)", plaintext, err)
+	}
+
+	// Plaintext from before encryption was enabled is passed through
+	if plaintext, err := rotated.open("legacy"); err != nil || plaintext != "legacy" {
+		t.Errorf("expected plaintext passthrough, got %q (%v)", plaintext, err)
+	}
+	if empty, _ := rotated.seal(""); empty != "" {
+		t.Errorf("expected empty value to stay empty, got %q", empty)
+	}
+}
+
+// TestSecretCipherRejectsTampering tests failures opening bad ciphertexts
+func TestSecretCipherRejectsTampering(t *testing.T) {
+	c, err := newSecretCipher("k1", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := c.seal("secret")
+
+	tests := map[string]string{
+		"unknown key":     strings.Replace(sealed, "enc:v1:k1:", "enc:v1:k9:", 1),
+		"key swapped":     strings.Replace(sealed, "enc:v1:k1:", "enc:v1:k2:", 1),
+		"truncated":       sealed[:len(sealed)-8],
+		"not base64":      "enc:v1:k1:!!!",
+		"missing key ID":  "enc:v1:abc",
+		"flipped payload": sealed[:len(sealed)-4] + "AAAA",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.open(value); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	var none *secretCipher
+	if _, err := none.open(sealed); err == nil {
+		t.Error("expected error opening encrypted value without keys")
+	}
+}
+
+// TestNewSecretCipherValidation tests keyring validation
+func TestNewSecretCipherValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		keys    map[string][]byte
+	}{
+		{name: "missing primary", primary: "k2", keys: map[string][]byte{"k1": testKey(1)}},
+		{name: "short key", primary: "k1", keys: map[string][]byte{"k1": []byte("short")}},
+		{name: "colon in ID", primary: "a:b", keys: map[string][]byte{"a:b": testKey(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSecretCipher(tt.primary, tt.keys); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// writeKeyring writes a keyring file and returns its path
+func writeKeyring(t *testing.T, dir, primary string, keys map[string][]byte) string {
+	t.Helper()
+	file := keyringFile{Primary: primary, Keys: make(map[string]string)}
+	for id, key := range keys {
+		file.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	data, _ := json.Marshal(file)
+	path := filepath.Join(dir, "keys-"+primary+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestStoreEncryptsSecrets tests that secrets are encrypted at rest and that
+// rotate-keys re-encrypts plaintext and old-key values with the new primary
+func TestStoreEncryptsSecrets(t *testing.T) {
+	clearForecastEnv(t)
+	dir := t.TempDir()
+	databaseURL := "sqlite://" + filepath.Join(dir, "forecast.db")
+	if err := runMigrateCommand([]string{"-database", databaseURL}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// A key written before encryption was enabled
+	plain, err := openStore(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.CreateAPIKey(ctx, &APIKey{ID: "legacy", Owner: "alice", Key: "legacy-token"}); err != nil {
+		t.Fatal(err)
+	}
+	plain.Close()
+
+	t.Setenv("FORECAST_ENCRYPTION_KEYS_FILE", writeKeyring(t, dir, "k1", map[string][]byte{"k1": testKey(1)}))
+	store, err := openCommandStore(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSubscription(ctx, &Subscription{Owner: "alice", WebhookURL: "https://example.com", Secret: "hmac-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	var raw string
+	if err := store.db.QueryRow(`SELECT secret FROM subscriptions`).Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, "enc:v1:k1:") {
+		t.Errorf("expected secret to be encrypted at rest, got %q", raw)
+	}
+	subs, err := store.ListSubscriptions(ctx, "")
+	if err != nil || len(subs) != 1 || subs[0].Secret != "hmac-secret" {
+		t.Errorf("expected decrypted secret, got %+v (%v)", subs, err)
+	}
+	store.Close()
+
+	t.Setenv("FORECAST_ENCRYPTION_KEYS_FILE", writeKeyring(t, dir, "k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)}))
+	var out bytes.Buffer
+	if err := runRotateKeysCommand([]string{"-database", databaseURL}, &out); err != nil {
+		t.Fatalf("rotate-keys failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "re-encrypted 2 secrets") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	store, err = openCommandStore(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	rows, err := store.db.Query(`SELECT key FROM api_keys UNION ALL SELECT secret FROM subscriptions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rows.Scan(&raw)
+		if !strings.HasPrefix(raw, "enc:v1:k2:") {
+			t.Errorf("expected value sealed with k2, got %q", raw)
+		}
+	}
+	keys, err := store.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].Key != "legacy-token" {
+		t.Errorf("expected decrypted legacy key, got %+v (%v)", keys, err)
+	}
+}
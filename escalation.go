@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Escalation actions. Alerts matching no rule are notified normally.
+const (
+	// escalateImmediate delivers the alert at once, even in quiet hours or
+	// past the daily cap
+	escalateImmediate = "immediate"
+	// escalateNotify delivers the alert subject to quiet hours and the cap
+	escalateNotify = "notify"
+	// escalateDigest holds the alert for the next digest
+	escalateDigest = "digest"
+	// escalateDrop doesn't notify the alert
+	escalateDrop = "drop"
+)
+
+// maxEscalationRules bounds the rules of a subscription
+const maxEscalationRules = 20
+
+// escalationExprVars are the variables a rule's When expression can use
+var escalationExprVars = map[string]exprType{
+	"event":        exprString,
+	"severity":     exprString,
+	"severityRank": exprNumber,
+	"change":       exprString,
+	"headline":     exprString,
+	"areaDesc":     exprString,
+	"messageType":  exprString,
+}
+
+// escalationExprEnv returns the values of an alert update for When expressions
+func escalationExprEnv(update *alertUpdate) map[string]any {
+	return map[string]any{
+		"event":        update.Alert.Event,
+		"severity":     update.Alert.Severity,
+		"severityRank": float64(severityRank(update.Alert.Severity)),
+		"change":       update.Change,
+		"headline":     update.Alert.Headline,
+		"areaDesc":     update.Alert.AreaDesc,
+		"messageType":  update.Alert.MessageType,
+	}
+}
+
+// validateEscalation checks a subscription's escalation rules
+func validateEscalation(rules []EscalationRule) error {
+	if len(rules) > maxEscalationRules {
+		return fmt.Errorf("escalation may have at most %d rules", maxEscalationRules)
+	}
+	for i, rule := range rules {
+		if rule.MinSeverity != "" && severityRank(rule.MinSeverity) == 0 {
+			return fmt.Errorf("escalation rule %d: minSeverity must be Minor, Moderate, Severe, or Extreme", i+1)
+		}
+		for _, change := range rule.Changes {
+			if !slices.Contains([]string{alertNew, alertUpgraded, alertChanged, alertCancelled}, change) {
+				return fmt.Errorf("escalation rule %d: unknown change %q", i+1, change)
+			}
+		}
+		if rule.When != "" {
+			if _, err := compileExpr(rule.When, escalationExprVars); err != nil {
+				return fmt.Errorf("escalation rule %d: when: %v", i+1, err)
+			}
+		}
+		if !slices.Contains([]string{escalateImmediate, escalateNotify, escalateDigest, escalateDrop}, rule.Action) {
+			return fmt.Errorf("escalation rule %d: action must be immediate, notify, digest, or drop", i+1)
+		}
+	}
+	return nil
+}
+
+// matches reports whether an alert update satisfies every condition of a rule
+func (rule EscalationRule) matches(update *alertUpdate) bool {
+	if rule.MinSeverity != "" && severityRank(update.Alert.Severity) < severityRank(rule.MinSeverity) {
+		return false
+	}
+	if len(rule.Events) > 0 && !slices.Contains(rule.Events, update.Alert.Event) {
+		return false
+	}
+	if len(rule.Changes) > 0 && !slices.Contains(rule.Changes, update.Change) {
+		return false
+	}
+	if rule.When == "" {
+		return true
+	}
+	// Rules are stored as written, and expressions are cheap to compile. One
+	// that no longer compiles or can't be decided doesn't match.
+	expr, err := compileExpr(rule.When, escalationExprVars)
+	if err != nil {
+		return false
+	}
+	ok, err := expr.eval(escalationExprEnv(update))
+	return err == nil && ok
+}
+
+// escalate returns the action of the first rule an alert update matches, or
+// escalateNotify when none does
+func escalate(rules []EscalationRule, update *alertUpdate) string {
+	for _, rule := range rules {
+		if rule.matches(update) {
+			return rule.Action
+		}
+	}
+	return escalateNotify
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestValidateEscalation tests validating escalation rules
+func TestValidateEscalation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []EscalationRule
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "valid", rules: []EscalationRule{{MinSeverity: "Extreme", Changes: []string{alertNew, alertUpgraded}, Action: escalateImmediate}, {Action: escalateDigest}}},
+		{name: "unknown severity", rules: []EscalationRule{{MinSeverity: "Catastrophic", Action: escalateImmediate}}, wantErr: true},
+		{name: "unknown change", rules: []EscalationRule{{Changes: []string{"extended"}, Action: escalateNotify}}, wantErr: true},
+		{name: "when", rules: []EscalationRule{{When: "severityRank >= 3 && event != 'Flood Watch'", Action: escalateImmediate}}},
+		{name: "bad when", rules: []EscalationRule{{When: "severity >= 3", Action: escalateImmediate}}, wantErr: true},
+		{name: "unknown action", rules: []EscalationRule{{Action: "sms"}}, wantErr: true},
+		{name: "missing action", rules: []EscalationRule{{MinSeverity: "Severe"}}, wantErr: true},
+		{name: "too many", rules: make([]EscalationRule, maxEscalationRules+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateEscalation(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestEscalate tests that the first matching rule decides an alert's action
+func TestEscalate(t *testing.T) {
+	rules := []EscalationRule{
+		{MinSeverity: "Extreme", Changes: []string{alertNew, alertUpgraded}, Action: escalateImmediate},
+		{Events: []string{"Special Weather Statement"}, Action: escalateDrop},
+		{MinSeverity: "Severe", Action: escalateNotify},
+		{Action: escalateDigest},
+	}
+	tests := []struct {
+		name     string
+		rules    []EscalationRule
+		update   alertUpdate
+		expected string
+	}{
+		{name: "no rules", update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Extreme"}}, expected: escalateNotify},
+		{name: "new extreme", rules: rules, update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Extreme"}}, expected: escalateImmediate},
+		{name: "changed extreme", rules: rules, update: alertUpdate{Change: alertChanged, Alert: Alert{Severity: "Extreme"}}, expected: escalateNotify},
+		{name: "statement", rules: rules, update: alertUpdate{Change: alertNew, Alert: Alert{Event: "Special Weather Statement", Severity: "Minor"}}, expected: escalateDrop},
+		{name: "severe", rules: rules, update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Severe"}}, expected: escalateNotify},
+		{name: "moderate", rules: rules, update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Moderate"}}, expected: escalateDigest},
+		{name: "unknown severity", rules: rules[:1], update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Unknown"}}, expected: escalateNotify},
+		{name: "when", rules: []EscalationRule{{When: "severityRank >= 2 && messageType == 'Alert'", Action: escalateImmediate}}, update: alertUpdate{Change: alertNew, Alert: Alert{Severity: "Moderate", MessageType: "Alert"}}, expected: escalateImmediate},
+		{name: "when unmet", rules: []EscalationRule{{When: "severityRank >= 2 && messageType == 'Alert'", Action: escalateImmediate}}, update: alertUpdate{Change: alertChanged, Alert: Alert{Severity: "Moderate", MessageType: "Update"}}, expected: escalateNotify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escalate(tt.rules, &tt.update); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestNotifyAlertEscalation tests delivering extreme alerts during quiet hours
+// while holding the rest for a digest
+func TestNotifyAlertEscalation(t *testing.T) {
+	var events []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, r.Header.Get("X-Forecast-Event"))
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{})
+	srv.store = newTestStore(t)
+	srv.clock = newFakeClock(time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+	sub := Subscription{Owner: "alice", WebhookURL: hook.URL, QuietStart: "22:00", QuietEnd: "07:00", Escalation: []EscalationRule{
+		{MinSeverity: "Extreme", Action: escalateImmediate},
+		{Events: []string{"Special Weather Statement"}, Action: escalateDrop},
+	}}
+	if err := srv.store.CreateSubscription(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alert := range []Alert{
+		{ID: "1", Event: "Tornado Warning", Severity: "Extreme"},
+		{ID: "2", Event: "Special Weather Statement", Severity: "Minor"},
+		{ID: "3", Event: "Wind Advisory", Severity: "Moderate"},
+	} {
+		srv.notifyAlert(ctx, []Subscription{sub}, &alertUpdate{Change: alertNew, Alert: alert})
+	}
+	if len(events) != 1 || events[0] != "alert.new" {
+		t.Errorf("expected only the extreme alert delivered, got %v", events)
+	}
+	held, err := srv.store.ListHeldDeliveries(ctx)
+	if err != nil || len(held) != 1 {
+		t.Errorf("expected the advisory held for the digest, got %+v (%v)", held, err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// exportVersion is bumped when the export format changes incompatibly. Version
+// 2 added signing keys; version 1 exports, which have none, still import.
+const (
+	exportVersion    = 2
+	minExportVersion = 1
+)
+
+// stateExport is a backup of the service state that can be restored into another
+// environment. History, usage, and the audit log are not included.
+type stateExport struct {
+	Version       int            `json:"version"`
+	ExportedAt    time.Time      `json:"exportedAt"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	Locations     []Location     `json:"locations"`
+	APIKeys       []APIKey       `json:"apiKeys"`
+	SigningKeys   []SigningKey   `json:"signingKeys"`
+}
+
+// exportState reads the subscriptions, saved locations, API keys, and webhook
+// signing keys from store
+func exportState(ctx context.Context, store Store) (*stateExport, error) {
+	subs, err := store.ListSubscriptions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	locs, err := store.ListLocations(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signing, err := store.ListSigningKeys(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return &stateExport{
+		Version:       exportVersion,
+		ExportedAt:    time.Now().UTC().Truncate(time.Second),
+		Subscriptions: subs,
+		Locations:     locs,
+		APIKeys:       keys,
+		SigningKeys:   signing,
+	}, nil
+}
+
+// importState writes an export into store, all of it or, if any record fails,
+// none of it. Subscriptions, locations, and signing keys get new IDs; API keys
+// keep theirs, so importing a key that already exists fails.
+func importState(ctx context.Context, store Store, data *stateExport) error {
+	if data.Version < minExportVersion || data.Version > exportVersion {
+		return fmt.Errorf("unsupported export version %d (want %d to %d)", data.Version, minExportVersion, exportVersion)
+	}
+	return store.Atomically(ctx, func(store Store) error {
+		return importRecords(ctx, store, data)
+	})
+}
+
+// importRecords writes the records of an export into store
+func importRecords(ctx context.Context, store Store, data *stateExport) error {
+	for i := range data.APIKeys {
+		if err := store.CreateAPIKey(ctx, &data.APIKeys[i]); err != nil {
+			return fmt.Errorf("API key %s: %v", data.APIKeys[i].ID, err)
+		}
+	}
+	for i := range data.Subscriptions {
+		sub := data.Subscriptions[i]
+		sub.ID = 0
+		if err := store.CreateSubscription(ctx, &sub); err != nil {
+			return err
+		}
+	}
+	for i := range data.Locations {
+		loc := data.Locations[i]
+		loc.ID = 0
+		if err := store.CreateLocation(ctx, &loc); err != nil {
+			return err
+		}
+	}
+	for i := range data.SigningKeys {
+		key := data.SigningKeys[i]
+		key.ID = 0
+		if err := store.CreateSigningKey(ctx, &key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runExportCommand implements `forecast export [-database url] [-o file]`
+func runExportCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	fset.SetOutput(out)
+	databaseURL := fset.String("database", "", "database URL (defaults to FORECAST_DATABASE_URL)")
+	output := fset.String("o", "-", "file to write the export to, - for stdout")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openCommandStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	data, err := exportState(context.Background(), store)
+	if err != nil {
+		return err
+	}
+
+	w := out
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// runImportCommand implements `forecast import [-database url] file`, reading
+// stdin when file is - or omitted
+func runImportCommand(args []string, in io.Reader, out io.Writer) error {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	fset.SetOutput(out)
+	databaseURL := fset.String("database", "", "database URL (defaults to FORECAST_DATABASE_URL)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	r := in
+	if file := fset.Arg(0); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var data stateExport
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&data); err != nil {
+		return fmt.Errorf("failed to parse export: %v", err)
+	}
+
+	store, err := openCommandStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := importState(context.Background(), store, &data); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported %d subscriptions, %d locations, %d API keys, %d signing keys\n",
+		len(data.Subscriptions), len(data.Locations), len(data.APIKeys), len(data.SigningKeys))
+	return nil
+}
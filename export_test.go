@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedState fills a store with one of each exported record
+func seedState(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := store.CreateSubscription(ctx, &Subscription{Owner: "alice", Latitude: 47.6, Longitude: -122.3, WebhookURL: "https://example.com/hook", Secret: "hmac",
+		QuietStart: "22:00", QuietEnd: "07:00", Escalation: []EscalationRule{{MinSeverity: "Extreme", Action: escalateImmediate}}, CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateLocation(ctx, &Location{Owner: "alice", Name: "Home", Latitude: 47.6, Longitude: -122.3, CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAPIKey(ctx, &APIKey{ID: "key-1", Owner: "alice", Name: "laptop", Key: "secret-token", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	expires := created.Add(time.Hour)
+	if err := store.CreateSigningKey(ctx, &SigningKey{Owner: "alice", Secret: "signing-secret", CreatedAt: created, ExpiresAt: &expires}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExportImportRoundTrip tests restoring an export into an empty store
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := newTestStore(t)
+	seedState(t, source)
+
+	data, err := exportState(ctx, source)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	target := newTestStore(t)
+	if err := importState(ctx, target, data); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	restored, err := exportState(ctx, target)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(restored.Subscriptions) != 1 || !reflect.DeepEqual(restored.Subscriptions[0], data.Subscriptions[0]) {
+		t.Errorf("subscriptions differ: %+v vs %+v", restored.Subscriptions, data.Subscriptions)
+	}
+	if len(restored.Locations) != 1 || restored.Locations[0] != data.Locations[0] {
+		t.Errorf("locations differ: %+v vs %+v", restored.Locations, data.Locations)
+	}
+	if len(restored.APIKeys) != 1 || !reflect.DeepEqual(restored.APIKeys[0], data.APIKeys[0]) {
+		t.Errorf("API keys differ: %+v vs %+v", restored.APIKeys, data.APIKeys)
+	}
+	if len(restored.SigningKeys) != 1 || !reflect.DeepEqual(restored.SigningKeys[0], data.SigningKeys[0]) || restored.SigningKeys[0].Secret != "signing-secret" {
+		t.Errorf("signing keys differ: %+v vs %+v", restored.SigningKeys, data.SigningKeys)
+	}
+
+	// Keys keep their IDs, so a second import must not duplicate them, and
+	// nothing else it holds is imported
+	if err := importState(ctx, target, data); err == nil {
+		t.Error("expected duplicate API key to fail")
+	}
+	if subs, _ := target.ListSubscriptions(ctx, ""); len(subs) != 1 {
+		t.Errorf("expected the failed import to be rolled back, got %d subscriptions", len(subs))
+	}
+}
+
+// TestImportRollsBack tests that an import failing partway leaves the store as
+// it was
+func TestImportRollsBack(t *testing.T) {
+	ctx := context.Background()
+	source := newTestStore(t)
+	seedState(t, source)
+	data, err := exportState(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second key is a duplicate of the first, failing after it and
+	// before anything else is written
+	data.APIKeys = append(data.APIKeys, data.APIKeys[0])
+
+	target := newTestStore(t)
+	if err := importState(ctx, target, data); err == nil {
+		t.Fatal("expected the duplicate API key to fail")
+	}
+	restored, err := exportState(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.APIKeys) != 0 || len(restored.Subscriptions) != 0 || len(restored.Locations) != 0 || len(restored.SigningKeys) != 0 {
+		t.Errorf("expected nothing imported, got %+v", restored)
+	}
+}
+
+// TestImportRejectsUnknownVersion tests the export version check
+func TestImportRejectsUnknownVersion(t *testing.T) {
+	if err := importState(context.Background(), newTestStore(t), &stateExport{Version: 99}); err == nil {
+		t.Error("expected error for unknown version")
+	}
+	// Exports from before signing keys were added still import
+	if err := importState(context.Background(), newTestStore(t), &stateExport{Version: 1}); err != nil {
+		t.Errorf("expected version 1 to import, got %v", err)
+	}
+}
+
+// TestExportImportCommands tests the export and import subcommands end to end
+func TestExportImportCommands(t *testing.T) {
+	dir := t.TempDir()
+	sourceURL := "sqlite://" + filepath.Join(dir, "source.db")
+	targetURL := "sqlite://" + filepath.Join(dir, "target.db")
+	for _, url := range []string{sourceURL, targetURL} {
+		if err := runMigrateCommand([]string{"-database", url}, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source, err := openStore(sourceURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedState(t, source)
+	source.Close()
+
+	exportFile := filepath.Join(dir, "export.json")
+	if err := runExportCommand([]string{"-database", sourceURL, "-o", exportFile}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if info, err := os.Stat(exportFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected export file with mode 0600, got %v (%v)", info, err)
+	}
+
+	var out bytes.Buffer
+	if err := runImportCommand([]string{"-database", targetURL, exportFile}, nil, &out); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "imported 1 subscriptions, 1 locations, 1 API keys, 1 signing keys") {
+		t.Errorf("unexpected import output %q", out.String())
+	}
+
+	out.Reset()
+	err = runImportCommand([]string{"-database", targetURL}, strings.NewReader(`{"version": 1, "bogus": true}`), &out)
+	if err == nil {
+		t.Error("expected unknown fields to be rejected")
+	}
+}
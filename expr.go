@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Rule expressions let clients write conditions such as
+// "tempF < 35 && pop > 50 && hour >= 6" instead of ranges of a single field.
+// They're a small language of numbers, strings, and booleans with comparison,
+// arithmetic, and logical operators, and contains for matching text, checked
+// against the variables they're used with when they're compiled. Without
+// loops or calls, an expression runs in time proportional to its size, which
+// is limited, so they're safe to evaluate for any client.
+
+const (
+	// maxExprLength, maxExprNodes, and maxExprDepth bound the size and
+	// nesting of an expression
+	maxExprLength = 256
+	maxExprNodes  = 64
+	maxExprDepth  = 16
+)
+
+// exprType is the type of an expression value: float64, string, or bool
+type exprType int
+
+const (
+	exprNumber exprType = iota
+	exprString
+	exprBool
+)
+
+func (t exprType) String() string {
+	return [...]string{"number", "string", "boolean"}[t]
+}
+
+// errExprUnknown is returned by eval when the expression needs a variable
+// that has no value, such as a wind speed NWS didn't forecast
+var errExprUnknown = errors.New("unknown value")
+
+// exprNode is a node of a compiled expression
+type exprNode struct {
+	op          string
+	value       any
+	left, right *exprNode
+	typ         exprType
+}
+
+// expression is a compiled boolean expression
+type expression struct {
+	src  string
+	root *exprNode
+}
+
+func (e *expression) String() string { return e.src }
+
+// compileExpr parses and type checks a boolean expression over vars, which
+// maps the names it may use to their types
+func compileExpr(src string, vars map[string]exprType) (*expression, error) {
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExprLength)
+	}
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, vars: vars}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if root.typ != exprBool {
+		return nil, fmt.Errorf("expression is a %s, not a condition", root.typ)
+	}
+	return &expression{src: src, root: root}, nil
+}
+
+// lexExpr splits an expression into tokens
+func lexExpr(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, src[i:i+end+2])
+			i += end + 2
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser parses tokens by recursive descent, from the loosest binding
+// operator to the tightest: ||, &&, comparisons and contains, + and -, * and
+// /, and unary ! and -
+type exprParser struct {
+	tokens []string
+	pos    int
+	nodes  int
+	vars   map[string]exprType
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// node counts a new node against maxExprNodes
+func (p *exprParser) node(n *exprNode) (*exprNode, error) {
+	if p.nodes++; p.nodes > maxExprNodes {
+		return nil, fmt.Errorf("expression has more than %d terms", maxExprNodes)
+	}
+	return n, nil
+}
+
+// binary parses a left-associative run of operators of one precedence, whose
+// operands are parsed by next and typed by check
+func (p *exprParser) binary(depth int, ops []string, next func(int) (*exprNode, error), check func(op string, l, r exprType) (exprType, bool)) (*exprNode, error) {
+	left, err := next(depth)
+	if err != nil {
+		return nil, err
+	}
+	for slices.Contains(ops, p.peek()) {
+		op := p.tokens[p.pos]
+		p.pos++
+		right, err := next(depth)
+		if err != nil {
+			return nil, err
+		}
+		typ, ok := check(op, left.typ, right.typ)
+		if !ok {
+			return nil, fmt.Errorf("%s %s %s is not allowed", left.typ, op, right.typ)
+		}
+		if left, err = p.node(&exprNode{op: op, left: left, right: right, typ: typ}); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseOr(depth int) (*exprNode, error) {
+	return p.binary(depth, []string{"||"}, p.parseAnd, logicalType)
+}
+
+func (p *exprParser) parseAnd(depth int) (*exprNode, error) {
+	return p.binary(depth, []string{"&&"}, p.parseComparison, logicalType)
+}
+
+func (p *exprParser) parseComparison(depth int) (*exprNode, error) {
+	return p.binary(depth, []string{"==", "!=", "<", "<=", ">", ">=", "contains"}, p.parseSum, func(op string, l, r exprType) (exprType, bool) {
+		switch op {
+		case "==", "!=":
+			return exprBool, l == r
+		case "contains":
+			return exprBool, l == exprString && r == exprString
+		}
+		return exprBool, l == exprNumber && r == exprNumber
+	})
+}
+
+func (p *exprParser) parseSum(depth int) (*exprNode, error) {
+	return p.binary(depth, []string{"+", "-"}, p.parseProduct, arithmeticType)
+}
+
+func (p *exprParser) parseProduct(depth int) (*exprNode, error) {
+	return p.binary(depth, []string{"*", "/"}, p.parseUnary, arithmeticType)
+}
+
+func logicalType(op string, l, r exprType) (exprType, bool) {
+	return exprBool, l == exprBool && r == exprBool
+}
+
+func arithmeticType(op string, l, r exprType) (exprType, bool) {
+	return exprNumber, l == exprNumber && r == exprNumber
+}
+
+func (p *exprParser) parseUnary(depth int) (*exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, fmt.Errorf("expression is nested more than %d deep", maxExprDepth)
+	}
+	switch op := p.peek(); op {
+	case "!", "-":
+		p.pos++
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		want := exprBool
+		if op == "-" {
+			want = exprNumber
+		}
+		if operand.typ != want {
+			return nil, fmt.Errorf("%s%s is not allowed", op, operand.typ)
+		}
+		return p.node(&exprNode{op: op, left: operand, typ: want})
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *exprParser) parsePrimary(depth int) (*exprNode, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch c := tok[0]; {
+	case tok == "(":
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case c >= '0' && c <= '9' || c == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return p.node(&exprNode{op: "value", value: v, typ: exprNumber})
+	case c == '"' || c == '\'':
+		return p.node(&exprNode{op: "value", value: tok[1 : len(tok)-1], typ: exprString})
+	case tok == "true" || tok == "false":
+		return p.node(&exprNode{op: "value", value: tok == "true", typ: exprBool})
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		typ, ok := p.vars[tok]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %q", tok)
+		}
+		return p.node(&exprNode{op: "var", value: tok, typ: typ})
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// eval evaluates the expression with the values of its variables, returning
+// errExprUnknown when it needs one env doesn't have
+func (e *expression) eval(env map[string]any) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func (n *exprNode) eval(env map[string]any) (any, error) {
+	switch n.op {
+	case "value":
+		return n.value, nil
+	case "var":
+		v, ok := env[n.value.(string)]
+		if !ok || v == nil {
+			return nil, errExprUnknown
+		}
+		return v, nil
+	case "&&", "||":
+		// Short-circuit, so a known side can decide without an unknown one
+		l, err := n.left.eval(env)
+		if err == nil && l.(bool) == (n.op == "||") {
+			return l, nil
+		}
+		r, rerr := n.right.eval(env)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if err != nil {
+			if r.(bool) == (n.op == "||") {
+				return r, nil
+			}
+			return nil, err
+		}
+		return r, nil
+	}
+
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		return !l.(bool), nil
+	case "-":
+		if n.right == nil {
+			return -l.(float64), nil
+		}
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "contains":
+		// Text is matched ignoring case, as forecasts capitalize words
+		return strings.Contains(strings.ToLower(l.(string)), strings.ToLower(r.(string))), nil
+	}
+	a, b := l.(float64), r.(float64)
+	switch n.op {
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	default:
+		return a / b, nil
+	}
+}
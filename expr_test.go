@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestExpression tests compiling and evaluating rule expressions
+func TestExpression(t *testing.T) {
+	vars := map[string]exprType{"temp": exprNumber, "pop": exprNumber, "day": exprBool, "sky": exprString}
+	env := map[string]any{"temp": 30.0, "pop": 60.0, "day": true, "sky": "rain"}
+	tests := []struct {
+		expr     string
+		expected bool
+		err      string
+	}{
+		{expr: "temp < 35 && pop > 50", expected: true},
+		{expr: "temp < 35 && pop > 70", expected: false},
+		{expr: "temp > 35 || sky == 'rain'", expected: true},
+		{expr: `sky != "snow" && day`, expected: true},
+		{expr: "!day || (temp - 32) * 5 / 9 < 0", expected: true},
+		{expr: "-temp < -29.5", expected: true},
+		{expr: "1 + 2 * 3 == 7", expected: true},
+		{expr: "sky contains 'RAI' && !(sky contains 'snow')", expected: true},
+		{expr: "temp contains 3", err: "number contains number is not allowed"},
+		{expr: "temp + 5", err: "not a condition"},
+		{expr: "sky < 3", err: "string < number is not allowed"},
+		{expr: "humidity > 50", err: "unknown variable"},
+		{expr: "temp < ", err: "unexpected end"},
+		{expr: "(temp < 35", err: "missing )"},
+		{expr: "temp < 35 pop", err: `unexpected "pop"`},
+		{expr: "temp = 35", err: "unexpected '='"},
+		{expr: "sky == 'rain", err: "unterminated string"},
+		{expr: "temp < 1.2.3", err: "invalid number"},
+		{expr: strings.Repeat("day||", 40) + "day", err: "more than 64 terms"},
+		{expr: strings.Repeat("(", 20) + "day" + strings.Repeat(")", 20), err: "nested more than"},
+		{expr: strings.Repeat(" ", 300) + "day", err: "longer than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := compileExpr(tt.expr, vars)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := e.eval(env)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestExpressionUnknown tests evaluating expressions missing a value, which
+// are unknown unless the rest of the expression decides them
+func TestExpressionUnknown(t *testing.T) {
+	vars := map[string]exprType{"temp": exprNumber, "pop": exprNumber}
+	env := map[string]any{"temp": 30.0}
+	tests := []struct {
+		expr     string
+		expected bool
+		unknown  bool
+	}{
+		{expr: "pop > 50", unknown: true},
+		{expr: "temp < 35 && pop > 50", unknown: true},
+		{expr: "temp > 35 && pop > 50", expected: false},
+		{expr: "pop > 50 && temp > 35", expected: false},
+		{expr: "pop > 50 || temp < 35", expected: true},
+		{expr: "pop > 50 || temp > 35", unknown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := compileExpr(tt.expr, vars)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := e.eval(env)
+			if tt.unknown {
+				if !errors.Is(err, errExprUnknown) {
+					t.Errorf("expected an unknown value, got %v, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("expected %v, got %v, %v", tt.expected, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// feedRevisions is how many forecast revisions a feed lists
+	feedRevisions = 20
+	// feedPeriods is how many periods of a revision its entry summarises
+	feedPeriods = 4
+)
+
+// atomFeed is an Atom feed document (RFC 4287)
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated time.Time   `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  time.Time    `xml:"updated"`
+	Category atomCategory `xml:"category"`
+	Content  atomContent  `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// revisionEntry describes an archived forecast revision as a feed entry
+func revisionEntry(point string, snap ForecastSnapshot) (atomEntry, error) {
+	var periods []hourlyPeriod
+	if err := json.Unmarshal(snap.Periods, &periods); err != nil {
+		return atomEntry{}, err
+	}
+	entry := atomEntry{
+		ID:       fmt.Sprintf("tag:murphybytes.com,2024:forecast/%s/revision/%d", point, snap.ID),
+		Title:    "Forecast updated",
+		Updated:  snap.RecordedAt,
+		Category: atomCategory{Term: "forecast"},
+		Content:  atomContent{Type: "text"},
+	}
+	if len(periods) > 0 {
+		entry.Title += ": " + periods[0].Forecast
+	}
+	var lines []string
+	for _, p := range periods[:min(len(periods), feedPeriods)] {
+		temp := p.TemperatureC
+		lines = append(lines, fmt.Sprintf("%s: %s, %s", p.StartTime.Format("Mon Jan 2 3 PM"), p.Forecast, reportTemp(&temp)))
+	}
+	entry.Content.Text = strings.Join(lines, "\n")
+	return entry, nil
+}
+
+// alertEntry describes an alert as a feed entry
+func alertEntry(a Alert) atomEntry {
+	return atomEntry{
+		ID:       a.ID,
+		Title:    a.Event,
+		Updated:  a.Sent,
+		Category: atomCategory{Term: "alert"},
+		Content: atomContent{Type: "text", Text: fmt.Sprintf("%s\nSeverity: %s\nIn effect %s until %s for %s",
+			a.Headline, a.Severity, a.Onset.Format(time.RFC1123), a.Ends.Format(time.RFC1123), a.AreaDesc)},
+	}
+}
+
+// feedHandler serves an Atom feed of a point's forecast revisions and active
+// alerts. The forecast is fetched on every request, so a feed reader polling
+// the feed archives a new revision, and sees a new entry, whenever NWS changes
+// the forecast.
+func (s *server) feedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	latitude, longitude := parsePoint(lat, lon)
+	point := nwsPoint(latitude, longitude)
+
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, false)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	s.archiveForecast(r.Context(), latitude, longitude, productForecast, periods)
+	snaps, err := s.store.RecentSnapshots(r.Context(), latitude, longitude, productForecast, feedRevisions)
+	if err != nil {
+		log.Printf("Failed to list forecast revisions: %v", err)
+		http.Error(w, "Failed to list forecast revisions", http.StatusInternalServerError)
+		return
+	}
+
+	self := externalURL(r, s.state.Config().TrustProxyHeaders)
+	feed := atomFeed{
+		ID:     "tag:murphybytes.com,2024:forecast/" + point,
+		Title:  "Forecast for " + point,
+		Author: atomAuthor{Name: "forecast"},
+		Links:  []atomLink{{Rel: "self", Href: self.String()}},
+	}
+	alerts, err := s.activeAlerts(r.Context(), point)
+	if err != nil {
+		log.Printf("Failed to fetch alerts for feed: %v", err)
+	}
+	for _, a := range alerts {
+		feed.Entries = append(feed.Entries, alertEntry(a))
+	}
+	for _, snap := range snaps {
+		entry, err := revisionEntry(point, snap)
+		if err != nil {
+			log.Printf("Failed to read forecast revision %d: %v", snap.ID, err)
+			continue
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	for _, e := range feed.Entries {
+		if e.Updated.After(feed.Updated) {
+			feed.Updated = e.Updated
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("Failed to write feed: %v", err)
+	}
+}
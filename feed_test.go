@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestFeedHandler tests that forecast changes and alerts appear as feed entries
+func TestFeedHandler(t *testing.T) {
+	var summary atomic.Value
+	summary.Store("Sunny")
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alerts/active":
+			w.Write([]byte(`{"features": [{"properties": {"id": "urn:oid:2.49.0.1.840.0.1", "event": "Heat Advisory", "severity": "Moderate",
+				"headline": "Heat Advisory until 8 PM", "sent": "2024-06-01T10:00:00-07:00", "effective": "2024-06-01T10:00:00-07:00", "expires": "2024-06-01T20:00:00-07:00"}}]}`))
+		case "/forecast-url":
+			w.Write([]byte(`{"properties": {"periods": [
+				{"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true, "shortForecast": "` + summary.Load().(string) + `", "temperature": 80, "temperatureUnit": "F"}
+			]}}`))
+		default:
+			w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast-url"}}`))
+		}
+	}))
+	defer mockNWS.Close()
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+
+	fetch := func() atomFeed {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.feedHandler(w, httptest.NewRequest("GET", "http://forecast.example.com/feed.atom?latitude=47.6062&longitude=-122.3321", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		var feed atomFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		return feed
+	}
+
+	feed := fetch()
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "Heat Advisory" || feed.Entries[1].Title != "Forecast updated: Sunny" {
+		t.Fatalf("expected an alert and a forecast entry, got %+v", feed.Entries)
+	}
+	if len(feed.Links) != 1 || feed.Links[0].Href != "http://forecast.example.com/feed.atom?latitude=47.6062&longitude=-122.3321" {
+		t.Errorf("unexpected self link %+v", feed.Links)
+	}
+	if !strings.Contains(feed.Entries[1].Content.Text, "Sunny, 27°C / 80°F") {
+		t.Errorf("unexpected forecast entry content %q", feed.Entries[1].Content.Text)
+	}
+
+	// An unchanged forecast adds no entry
+	if again := fetch(); len(again.Entries) != 2 {
+		t.Errorf("expected no new entry for an unchanged forecast, got %d entries", len(again.Entries))
+	}
+
+	summary.Store("Showers")
+	feed = fetch()
+	if len(feed.Entries) != 3 || feed.Entries[1].Title != "Forecast updated: Showers" || feed.Entries[2].Title != "Forecast updated: Sunny" {
+		t.Errorf("expected the new revision first, got %+v", feed.Entries)
+	}
+}
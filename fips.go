@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// validFIPS reports whether code is a five-digit county FIPS code, two
+// digits of state and three of county
+func validFIPS(code string) bool {
+	return validZIP(code)
+}
+
+// loadCountyCentroids returns the representative points of counties in a CSV
+// or tab-separated file with a header naming its FIPS code, latitude, and
+// longitude columns, such as the Census Bureau's county gazetteer file, or
+// none when path is empty
+func loadCountyCentroids(path string) (map[string]centroid, error) {
+	return loadCentroids(path, "FIPS", []string{"fips", "county_fips", "geoid"}, validFIPS)
+}
+
+// countyCentroids returns the county points of the configured FIPS file, nil
+// when FIPS lookup is disabled
+func (s *server) countyCentroids() map[string]centroid {
+	if c := s.counties.Load(); c != nil {
+		return *c
+	}
+	return nil
+}
+
+// fipsPoint resolves the county FIPS code of a request's fips parameter to
+// the county's representative point, writing the error response and
+// returning false when it can't
+func (s *server) fipsPoint(w http.ResponseWriter, code string) (lat, lon string, ok bool) {
+	if s.countyCentroids() == nil {
+		http.Error(w, "FIPS code lookup isn't enabled on this server (use latitude and longitude)", http.StatusBadRequest)
+		return "", "", false
+	}
+	code = strings.TrimSpace(code)
+	// Spreadsheets drop the leading zero of states such as California (06)
+	if len(code) == 4 {
+		code = "0" + code
+	}
+	if !validFIPS(code) {
+		http.Error(w, "Invalid fips parameter (want a five-digit county FIPS code such as 53033)", http.StatusBadRequest)
+		return "", "", false
+	}
+	c, found := s.countyCentroids()[code]
+	if !found {
+		http.Error(w, fmt.Sprintf("FIPS code %s not found", code), http.StatusNotFound)
+		return "", "", false
+	}
+	return strconv.FormatFloat(c.Latitude, 'f', 4, 64), strconv.FormatFloat(c.Longitude, 'f', 4, 64), true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadCountyCentroids tests reading county points from CSV and from the
+// Census county gazetteer's tab-separated format
+func TestLoadCountyCentroids(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]centroid
+		err      bool
+	}{
+		{
+			name:     "csv",
+			contents: "fips,latitude,longitude\n53033,47.4905,-121.8341\n06037,34.1961,-118.2619\n",
+			expected: map[string]centroid{"53033": {47.4905, -121.8341}, "06037": {34.1961, -118.2619}},
+		},
+		{
+			name:     "gazetteer",
+			contents: "USPS\tGEOID\tANSICODE\tNAME\tALAND\tAWATER\tALAND_SQMI\tAWATER_SQMI\tINTPTLAT\tINTPTLONG          \nWA\t53033\t01531933\tKing County\t5479337803\t495969463\t2115.584\t191.495\t47.490552\t-121.834125          \n",
+			expected: map[string]centroid{"53033": {47.490552, -121.834125}},
+		},
+		{name: "state code only", contents: "fips,lat,lon\n53,47.4905,-121.8341\n", err: true},
+		{name: "no code column", contents: "county,lat,lon\nKing,47.4905,-121.8341\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "counties.txt")
+			if err := os.WriteFile(file, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			centroids, err := loadCountyCentroids(file)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", centroids)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(centroids) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, centroids)
+			}
+			for code, c := range tt.expected {
+				if centroids[code] != c {
+					t.Errorf("expected %s at %v, got %v", code, c, centroids[code])
+				}
+			}
+		})
+	}
+}
+
+// TestFIPSForecast tests forecasting for a county's FIPS code
+func TestFIPSForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		disabled       bool
+		expectedStatus int
+		expectedPoint  string
+		expectedBody   string
+	}{
+		{name: "FIPS code", path: "/forecast?fips=53033", expectedStatus: http.StatusOK, expectedPoint: "/points/47.4906,-121.8341"},
+		{name: "leading zero dropped", path: "/forecast?fips=6037", expectedStatus: http.StatusOK, expectedPoint: "/points/34.1961,-118.2619"},
+		{name: "coordinates win", path: "/forecast?fips=53033&latitude=43.6323&longitude=-116.2050", expectedStatus: http.StatusOK, expectedPoint: "/points/43.6323,-116.2050"},
+		{name: "unknown", path: "/forecast?fips=99999", expectedStatus: http.StatusNotFound, expectedBody: "FIPS code 99999 not found"},
+		{name: "invalid", path: "/forecast?fips=king", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid fips parameter"},
+		{name: "disabled", path: "/forecast?fips=53033", disabled: true, expectedStatus: http.StatusBadRequest, expectedBody: "FIPS code lookup isn't enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			srv.nws = nws
+			if !tt.disabled {
+				srv.counties.Store(&map[string]centroid{"53033": {47.490552, -121.834125}, "06037": {34.1961, -118.2619}})
+			}
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedPoint != "" && nws.paths()[0] != tt.expectedPoint {
+				t.Errorf("expected %s to be looked up, got %v", tt.expectedPoint, nws.paths())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultFrostNights = 3
+	maxFrostNights     = 7
+
+	// frostSpreadC is the typical error of an overnight low forecast for the
+	// coming night; frostSpreadGrowthC widens it for each night after that
+	frostSpreadC       = 1.5
+	frostSpreadGrowthC = 0.5
+)
+
+// Frost risk levels, by the probability of a freeze
+const (
+	frostRiskNone     = "none"
+	frostRiskLow      = "low"
+	frostRiskModerate = "moderate"
+	frostRiskHigh     = "high"
+)
+
+// frostNight is the freeze outlook for one night
+type frostNight struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	MinTemperatureC float64   `json:"minTemperatureC"`
+	// ColdestTime is when the low is expected, and FirstFreeze the first hour
+	// forecast at or below 0°C
+	ColdestTime       time.Time  `json:"coldestTime"`
+	FirstFreeze       *time.Time `json:"firstFreeze,omitempty"`
+	FreezeProbability int        `json:"freezeProbability"`
+	Risk              string     `json:"risk"`
+}
+
+// frostResponse is the body of /frost
+type frostResponse struct {
+	Latitude  float64      `json:"latitude"`
+	Longitude float64      `json:"longitude"`
+	Nights    []frostNight `json:"nights"`
+}
+
+// frostOutlook groups the night-time hours of an hourly forecast into nights
+// and estimates the chance of each falling to 0°C or below. Forecast lows are
+// treated as normally distributed about the forecast value, with a spread that
+// grows with lead time.
+func frostOutlook(periods []weatherPeriod, nights int) []frostNight {
+	var out []frostNight
+	inNight := false
+	for _, p := range periods {
+		if p.IsDaytime {
+			inNight = false
+			continue
+		}
+		if !inNight {
+			if len(out) == nights {
+				break
+			}
+			out = append(out, frostNight{Start: p.Start, MinTemperatureC: p.TemperatureC, ColdestTime: p.Start})
+			inNight = true
+		}
+		n := &out[len(out)-1]
+		n.End = p.End
+		if p.TemperatureC < n.MinTemperatureC {
+			n.MinTemperatureC, n.ColdestTime = p.TemperatureC, p.Start
+		}
+		if n.FirstFreeze == nil && p.TemperatureC <= 0 {
+			start := p.Start
+			n.FirstFreeze = &start
+		}
+	}
+
+	for i := range out {
+		spread := frostSpreadC + frostSpreadGrowthC*float64(i)
+		n := &out[i]
+		n.FreezeProbability = roundInt(100 * normalCDF(-n.MinTemperatureC/spread))
+		n.Risk = frostRisk(n.FreezeProbability)
+	}
+	return out
+}
+
+// normalCDF is the standard normal cumulative distribution function
+func normalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// frostRisk categorises a freeze probability
+func frostRisk(probability int) string {
+	switch {
+	case probability >= 60:
+		return frostRiskHigh
+	case probability >= 30:
+		return frostRiskModerate
+	case probability >= 10:
+		return frostRiskLow
+	default:
+		return frostRiskNone
+	}
+}
+
+// frostHandler serves the freeze outlook for the next ?nights= nights
+func (s *server) frostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	nights := defaultFrostNights
+	if v := r.URL.Query().Get("nights"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFrostNights {
+			http.Error(w, fmt.Sprintf("Invalid nights parameter (want 1 to %d)", maxFrostNights), http.StatusBadRequest)
+			return
+		}
+		nights = n
+	}
+
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := frostResponse{Nights: frostOutlook(periods, nights)}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	if resp.Nights == nil {
+		resp.Nights = []frostNight{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
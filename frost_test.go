@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFrostOutlook tests grouping nights and estimating freeze probabilities
+func TestFrostOutlook(t *testing.T) {
+	start := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	// Alternate six daytime hours with six night-time hours, giving each night
+	// the temperatures listed
+	nightTemps := [][]float64{{4, 0, 2}, {3, 1, 2}, {5, 3, 4}, {-3, -4, -2}}
+	var periods []weatherPeriod
+	next := start
+	add := func(temp float64, day bool) {
+		periods = append(periods, weatherPeriod{Start: next, End: next.Add(time.Hour), TemperatureC: temp, IsDaytime: day})
+		next = next.Add(time.Hour)
+	}
+	for _, temps := range nightTemps {
+		add(12, true)
+		add(10, true)
+		for _, temp := range temps {
+			add(temp, false)
+		}
+	}
+
+	nights := frostOutlook(periods, 3)
+	if len(nights) != 3 {
+		t.Fatalf("expected 3 nights, got %d", len(nights))
+	}
+	expected := []struct {
+		min         float64
+		coldest     int
+		freeze      int
+		probability int
+		risk        string
+	}{
+		{min: 0, coldest: 3, freeze: 3, probability: 50, risk: frostRiskModerate},
+		{min: 1, coldest: 8, freeze: -1, probability: 31, risk: frostRiskModerate},
+		{min: 3, coldest: 13, freeze: -1, probability: 12, risk: frostRiskLow},
+	}
+	for i, e := range expected {
+		n := nights[i]
+		if n.MinTemperatureC != e.min || !n.ColdestTime.Equal(periods[e.coldest].Start) {
+			t.Errorf("night %d: expected low %v at %v, got %v at %v", i, e.min, periods[e.coldest].Start, n.MinTemperatureC, n.ColdestTime)
+		}
+		if (n.FirstFreeze != nil) != (e.freeze >= 0) || (n.FirstFreeze != nil && !n.FirstFreeze.Equal(periods[e.freeze].Start)) {
+			t.Errorf("night %d: unexpected first freeze %v", i, n.FirstFreeze)
+		}
+		if n.FreezeProbability != e.probability || n.Risk != e.risk {
+			t.Errorf("night %d: expected %d%% (%s), got %d%% (%s)", i, e.probability, e.risk, n.FreezeProbability, n.Risk)
+		}
+	}
+	if !nights[0].Start.Equal(periods[2].Start) || !nights[0].End.Equal(periods[4].End) {
+		t.Errorf("unexpected first night %v - %v", nights[0].Start, nights[0].End)
+	}
+
+	nights = frostOutlook(periods, 4)
+	if n := nights[3]; n.FreezeProbability != 91 || n.Risk != frostRiskHigh {
+		t.Errorf("expected a hard freeze to be high risk, got %d%% (%s)", n.FreezeProbability, n.Risk)
+	}
+}
+
+// TestFrostRisk tests the risk level boundaries
+func TestFrostRisk(t *testing.T) {
+	tests := map[int]string{0: frostRiskNone, 9: frostRiskNone, 10: frostRiskLow, 29: frostRiskLow, 30: frostRiskModerate, 60: frostRiskHigh, 100: frostRiskHigh}
+	for probability, expected := range tests {
+		if got := frostRisk(probability); got != expected {
+			t.Errorf("%d%%: expected %s, got %s", probability, expected, got)
+		}
+	}
+}
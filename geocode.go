@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Routes taking a point also accept a free-text location as ?q= when a
+// geocoding provider is configured. Queries are cleaned up by
+// normalizeGeocodeQuery before they reach the provider, and results are cached
+// by cachingGeocoder. Nominatim's usage policy allows one request a second, so
+// its lookups also wait their turn in a rateLimitedGeocoder.
+const (
+	// maxGeocodeQueryLen bounds a location query, in characters
+	maxGeocodeQueryLen = 200
+	// geocodeCacheTTL is how long a resolved location is reused
+	geocodeCacheTTL = 24 * time.Hour
+	// geocodeNegativeTTL is how long a query that matched nothing is remembered
+	geocodeNegativeTTL = time.Hour
+	// geocodeCacheSize bounds the number of cached queries
+	geocodeCacheSize = 10000
+	// nominatimRate is the most requests a second sent to Nominatim
+	nominatimRate = 1
+	// geocodeMaxWait is the longest a lookup waits for the rate limit before
+	// it's refused
+	geocodeMaxWait = 5 * time.Second
+)
+
+var (
+	// errInvalidGeocodeQuery is returned for queries that can't be sent to a provider
+	errInvalidGeocodeQuery = errors.New("invalid location query")
+	// errLocationNotFound is returned when a provider has no match for a query
+	errLocationNotFound = errors.New("location not found")
+	// errGeocodeRateLimited is returned when a lookup would wait too long for
+	// the provider's rate limit
+	errGeocodeRateLimited = errors.New("geocoding provider rate limit exceeded")
+)
+
+// geoPoint is a geocoded location
+type geoPoint struct {
+	Latitude  float64
+	Longitude float64
+	// Name is the provider's description of the match
+	Name string
+}
+
+// geocoder resolves a normalized free-text query to a point. Implementations
+// must pass the query to the provider as an encoded parameter (see
+// geocodeRequestURL), never by splicing it into a URL or request body.
+type geocoder interface {
+	geocode(ctx context.Context, query string) (geoPoint, error)
+}
+
+// normalizeGeocodeQuery validates a free-text location and canonicalizes its
+// spacing: control and formatting characters are dropped and runs of
+// whitespace collapse to one space. It also returns the case-folded key the
+// query is cached under.
+func normalizeGeocodeQuery(q string) (query, key string, err error) {
+	if !utf8.ValidString(q) {
+		return "", "", fmt.Errorf("%w: not valid UTF-8", errInvalidGeocodeQuery)
+	}
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, q)
+	query = strings.Join(strings.Fields(cleaned), " ")
+	if query == "" {
+		return "", "", fmt.Errorf("%w: empty", errInvalidGeocodeQuery)
+	}
+	if utf8.RuneCountInString(query) > maxGeocodeQueryLen {
+		return "", "", fmt.Errorf("%w: longer than %d characters", errInvalidGeocodeQuery, maxGeocodeQueryLen)
+	}
+	return query, strings.ToLower(query), nil
+}
+
+// geocodeRequestURL adds params to a provider endpoint, encoding them so user
+// input can't alter the path or inject other parameters
+func geocodeRequestURL(endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for name, values := range params {
+		q[name] = values
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// geocodeEntry is a cached result; err is set for negative entries
+type geocodeEntry struct {
+	point   geoPoint
+	err     error
+	expires time.Time
+}
+
+// geocodeCall is a lookup in progress, whose result is set before done is
+// closed
+type geocodeCall struct {
+	done  chan struct{}
+	point geoPoint
+	err   error
+}
+
+// cachingGeocoder normalizes queries and caches a provider's answers. Queries
+// the provider couldn't match are cached for a shorter time; other failures,
+// such as the provider being unreachable, aren't cached. Concurrent lookups of
+// the same query share one request to the provider.
+type cachingGeocoder struct {
+	provider geocoder
+	clock    clock
+
+	mu      sync.Mutex
+	entries map[string]geocodeEntry
+	pending map[string]*geocodeCall
+}
+
+func newCachingGeocoder(provider geocoder, clk clock) *cachingGeocoder {
+	return &cachingGeocoder{provider: provider, clock: clk, entries: map[string]geocodeEntry{}, pending: map[string]*geocodeCall{}}
+}
+
+func (c *cachingGeocoder) geocode(ctx context.Context, q string) (geoPoint, error) {
+	query, key, err := normalizeGeocodeQuery(q)
+	if err != nil {
+		return geoPoint{}, err
+	}
+
+	now := c.clock.Now()
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.point, entry.err
+	}
+	if call, ok := c.pending[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.point, call.err
+		case <-ctx.Done():
+			return geoPoint{}, ctx.Err()
+		}
+	}
+	call := &geocodeCall{done: make(chan struct{})}
+	c.pending[key] = call
+	c.mu.Unlock()
+
+	// The lookup outlives a caller that gives up, since others may be
+	// waiting for it
+	call.point, call.err = c.provider.geocode(context.WithoutCancel(ctx), query)
+	switch {
+	case call.err == nil:
+		c.store(key, geocodeEntry{point: call.point, expires: now.Add(geocodeCacheTTL)}, now)
+	case errors.Is(call.err, errLocationNotFound):
+		c.store(key, geocodeEntry{err: call.err, expires: now.Add(geocodeNegativeTTL)}, now)
+	}
+	c.mu.Lock()
+	delete(c.pending, key)
+	c.mu.Unlock()
+	close(call.done)
+	return call.point, call.err
+}
+
+// store saves an entry, evicting expired entries and then arbitrary ones when
+// the cache is full
+func (c *cachingGeocoder) store(key string, entry geocodeEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= geocodeCacheSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < geocodeCacheSize {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// Geocoding providers
+const (
+	// geocoderCensus is the US Census Bureau geocoder, which matches street
+	// addresses
+	geocoderCensus = "census"
+	// geocoderNominatim is OpenStreetMap's Nominatim, which also matches
+	// place names such as cities
+	geocoderNominatim = "nominatim"
+)
+
+// geocoderEndpoints are the public endpoints of the providers, used unless
+// another is configured
+var geocoderEndpoints = map[string]string{
+	geocoderCensus:    "https://geocoding.geo.census.gov/geocoder/locations/onelineaddress?benchmark=Public_AR_Current&format=json",
+	geocoderNominatim: "https://nominatim.openstreetmap.org/search?format=jsonv2&limit=1&countrycodes=us",
+}
+
+// geocodeClient calls the geocoding provider
+var geocodeClient = &http.Client{Timeout: 10 * time.Second}
+
+// newGeocoder returns the geocoder configured by cfg, or nil when geocoding is
+// disabled
+func newGeocoder(cfg Config, clk clock) geocoder {
+	endpoint := cfg.GeocoderURL
+	if endpoint == "" {
+		endpoint = geocoderEndpoints[cfg.Geocoder]
+	}
+	switch cfg.Geocoder {
+	case geocoderCensus:
+		return newCachingGeocoder(censusGeocoder{client: geocodeClient, endpoint: endpoint}, clk)
+	case geocoderNominatim:
+		return newCachingGeocoder(newRateLimitedGeocoder(nominatimGeocoder{client: geocodeClient, endpoint: endpoint}, nominatimRate, clk), clk)
+	default:
+		return nil
+	}
+}
+
+// rateLimitedGeocoder holds lookups until a provider's rate limit allows
+// them, refusing those that would wait longer than geocodeMaxWait
+type rateLimitedGeocoder struct {
+	provider geocoder
+	clock    clock
+
+	mu     sync.Mutex
+	bucket *tokenBucket
+}
+
+// newRateLimitedGeocoder limits provider to rate lookups a second, one at a
+// time
+func newRateLimitedGeocoder(provider geocoder, rate float64, clk clock) *rateLimitedGeocoder {
+	return &rateLimitedGeocoder{provider: provider, clock: clk, bucket: newTokenBucket(rate, 1, clk.Now())}
+}
+
+func (l *rateLimitedGeocoder) geocode(ctx context.Context, query string) (geoPoint, error) {
+	l.mu.Lock()
+	wait, ok := l.bucket.reserve(l.clock.Now(), geocodeMaxWait)
+	l.mu.Unlock()
+	if !ok {
+		return geoPoint{}, errGeocodeRateLimited
+	}
+	if wait > 0 {
+		select {
+		case <-l.clock.After(wait):
+		case <-ctx.Done():
+			return geoPoint{}, ctx.Err()
+		}
+	}
+	return l.provider.geocode(ctx, query)
+}
+
+// getGeocode sends a provider a query and decodes its JSON answer into v
+func getGeocode(ctx context.Context, client doer, endpoint string, params url.Values, v any) error {
+	u, err := geocodeRequestURL(endpoint, params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("geocoding provider returned status: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse geocoding response: %v", err)
+	}
+	return nil
+}
+
+// censusGeocoder geocodes with the Census Bureau's one-line address lookup
+type censusGeocoder struct {
+	client   doer
+	endpoint string
+}
+
+func (c censusGeocoder) geocode(ctx context.Context, query string) (geoPoint, error) {
+	var result struct {
+		Result struct {
+			AddressMatches []struct {
+				MatchedAddress string `json:"matchedAddress"`
+				Coordinates    struct {
+					X float64 `json:"x"`
+					Y float64 `json:"y"`
+				} `json:"coordinates"`
+			} `json:"addressMatches"`
+		} `json:"result"`
+	}
+	if err := getGeocode(ctx, c.client, c.endpoint, url.Values{"address": {query}}, &result); err != nil {
+		return geoPoint{}, err
+	}
+	if len(result.Result.AddressMatches) == 0 {
+		return geoPoint{}, errLocationNotFound
+	}
+	match := result.Result.AddressMatches[0]
+	return geoPoint{Latitude: match.Coordinates.Y, Longitude: match.Coordinates.X, Name: match.MatchedAddress}, nil
+}
+
+// nominatimGeocoder geocodes with a Nominatim search
+type nominatimGeocoder struct {
+	client   doer
+	endpoint string
+}
+
+func (n nominatimGeocoder) geocode(ctx context.Context, query string) (geoPoint, error) {
+	var places []struct {
+		Lat         string `json:"lat"`
+		Lon         string `json:"lon"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := getGeocode(ctx, n.client, n.endpoint, url.Values{"q": {query}}, &places); err != nil {
+		return geoPoint{}, err
+	}
+	if len(places) == 0 {
+		return geoPoint{}, errLocationNotFound
+	}
+	lat, latErr := strconv.ParseFloat(places[0].Lat, 64)
+	lon, lonErr := strconv.ParseFloat(places[0].Lon, 64)
+	if latErr != nil || lonErr != nil {
+		return geoPoint{}, fmt.Errorf("geocoding provider returned an invalid point %q,%q", places[0].Lat, places[0].Lon)
+	}
+	return geoPoint{Latitude: lat, Longitude: lon, Name: places[0].DisplayName}, nil
+}
+
+// geocodePoint resolves the free-text location of a request's q parameter,
+// writing the error response and returning false when it can't
+func (s *server) geocodePoint(w http.ResponseWriter, r *http.Request, q string) (lat, lon string, ok bool) {
+	point, err := s.geocoder.geocode(r.Context(), q)
+	switch {
+	case errors.Is(err, errInvalidGeocodeQuery):
+		http.Error(w, fmt.Sprintf("Invalid q parameter (want a place name or address of up to %d characters)", maxGeocodeQueryLen), http.StatusBadRequest)
+		return "", "", false
+	case errors.Is(err, errLocationNotFound):
+		http.Error(w, "Location not found", http.StatusNotFound)
+		return "", "", false
+	case errors.Is(err, errGeocodeRateLimited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(geocodeMaxWait.Seconds())))
+		http.Error(w, "Too many locations to geocode, try again later", http.StatusServiceUnavailable)
+		return "", "", false
+	case err != nil:
+		log.Printf("Failed to geocode location: %v", err)
+		http.Error(w, "Failed to geocode location", http.StatusBadGateway)
+		return "", "", false
+	}
+	return strconv.FormatFloat(point.Latitude, 'f', 4, 64), strconv.FormatFloat(point.Longitude, 'f', 4, 64), true
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestNormalizeGeocodeQuery tests cleanup and validation of free-text locations
+func TestNormalizeGeocodeQuery(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedQuery string
+		expectedKey   string
+		expectError   bool
+	}{
+		{input: "Boise, ID", expectedQuery: "Boise, ID", expectedKey: "boise, id"},
+		{input: "  Seattle,\t\tWA \n", expectedQuery: "Seattle, WA", expectedKey: "seattle, wa"},
+		{input: "Port\x00land\x1b[31m", expectedQuery: "Portland[31m", expectedKey: "portland[31m"},
+		{input: "Zero\u200bWidth", expectedQuery: "ZeroWidth", expectedKey: "zerowidth"},
+		{input: "São Paulo", expectedQuery: "São Paulo", expectedKey: "são paulo"},
+		{input: "", expectError: true},
+		{input: " \t\r\n", expectError: true},
+		{input: "\xff\xfe", expectError: true},
+		{input: strings.Repeat("a", maxGeocodeQueryLen+1), expectError: true},
+		{input: strings.Repeat("é", maxGeocodeQueryLen), expectedQuery: strings.Repeat("é", maxGeocodeQueryLen), expectedKey: strings.Repeat("é", maxGeocodeQueryLen)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			query, key, err := normalizeGeocodeQuery(tt.input)
+			if tt.expectError {
+				if !errors.Is(err, errInvalidGeocodeQuery) {
+					t.Errorf("expected errInvalidGeocodeQuery, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query != tt.expectedQuery || key != tt.expectedKey {
+				t.Errorf("expected %q/%q, got %q/%q", tt.expectedQuery, tt.expectedKey, query, key)
+			}
+		})
+	}
+}
+
+// TestGeocodeRequestURL tests that queries can't escape their parameter
+func TestGeocodeRequestURL(t *testing.T) {
+	got, err := geocodeRequestURL("https://geocoder.example.com/search?format=json", url.Values{"q": {"a&format=xml#/../admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(got)
+	if u.Path != "/search" || u.Fragment != "" {
+		t.Errorf("query altered the URL: %s", got)
+	}
+	if q := u.Query(); q.Get("format") != "json" || q.Get("q") != "a&format=xml#/../admin" {
+		t.Errorf("unexpected parameters in %s", got)
+	}
+}
+
+// fakeGeocoder answers from a map and counts lookups
+type fakeGeocoder struct {
+	points map[string]geoPoint
+	err    error
+	calls  int
+}
+
+func (f *fakeGeocoder) geocode(ctx context.Context, query string) (geoPoint, error) {
+	f.calls++
+	if f.err != nil {
+		return geoPoint{}, f.err
+	}
+	point, ok := f.points[query]
+	if !ok {
+		return geoPoint{}, errLocationNotFound
+	}
+	return point, nil
+}
+
+// TestCachingGeocoder tests positive and negative caching of lookups
+func TestCachingGeocoder(t *testing.T) {
+	provider := &fakeGeocoder{points: map[string]geoPoint{"Boise, ID": {Latitude: 43.6, Longitude: -116.2}}}
+	clk := newFakeClock(time.Now())
+	c := newCachingGeocoder(provider, clk)
+	ctx := context.Background()
+
+	for _, q := range []string{"Boise, ID", "  boise,   ID"} {
+		if point, err := c.geocode(ctx, q); err != nil || point.Latitude != 43.6 {
+			t.Fatalf("unexpected result %+v (%v)", point, err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("expected one lookup, got %d", provider.calls)
+	}
+
+	// Misses are cached for the negative TTL
+	for range 2 {
+		if _, err := c.geocode(ctx, "Atlantis"); !errors.Is(err, errLocationNotFound) {
+			t.Fatalf("expected errLocationNotFound, got %v", err)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("expected the miss to be cached, got %d lookups", provider.calls)
+	}
+	clk.Advance(geocodeNegativeTTL + time.Second)
+	c.geocode(ctx, "Atlantis")
+	if provider.calls != 3 {
+		t.Errorf("expected the miss to expire, got %d lookups", provider.calls)
+	}
+
+	// Outages aren't cached
+	provider.err = errors.New("connection refused")
+	for range 2 {
+		if _, err := c.geocode(ctx, "Nampa, ID"); err == nil {
+			t.Fatal("expected provider error")
+		}
+	}
+	if provider.calls != 5 {
+		t.Errorf("expected failures to be retried, got %d lookups", provider.calls)
+	}
+
+	// Invalid queries never reach the provider
+	if _, err := c.geocode(ctx, "\x00\x01"); !errors.Is(err, errInvalidGeocodeQuery) {
+		t.Errorf("expected errInvalidGeocodeQuery, got %v", err)
+	}
+	if provider.calls != 5 {
+		t.Errorf("expected no lookup for an invalid query, got %d", provider.calls)
+	}
+}
+
+// geocoderFunc adapts a function to a geocoder
+type geocoderFunc func(ctx context.Context, query string) (geoPoint, error)
+
+func (f geocoderFunc) geocode(ctx context.Context, query string) (geoPoint, error) {
+	return f(ctx, query)
+}
+
+// TestCachingGeocoderShared tests that concurrent lookups of a query share
+// one request to the provider
+func TestCachingGeocoderShared(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := newCachingGeocoder(geocoderFunc(func(ctx context.Context, query string) (geoPoint, error) {
+		calls.Add(1)
+		<-release
+		return geoPoint{Latitude: 43.6, Longitude: -116.2}, nil
+	}), newFakeClock(time.Now()))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if point, err := c.geocode(context.Background(), "Boise, ID"); err != nil || point.Latitude != 43.6 {
+				t.Errorf("unexpected result %+v (%v)", point, err)
+			}
+		}()
+	}
+	// Let the lookups pile up behind the first
+	for deadline := time.Now().Add(5 * time.Second); calls.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected one lookup, got %d", got)
+	}
+}
+
+// TestRateLimitedGeocoder tests holding lookups to the provider's rate, and
+// refusing those that would wait too long
+func TestRateLimitedGeocoder(t *testing.T) {
+	provider := &fakeGeocoder{points: map[string]geoPoint{"Boise, ID": {Latitude: 43.6, Longitude: -116.2}}}
+	clk := newFakeClock(time.Now())
+	l := newRateLimitedGeocoder(provider, nominatimRate, clk)
+
+	if _, err := l.geocode(context.Background(), "Boise, ID"); err != nil {
+		t.Fatalf("expected the first lookup right away, got %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := l.geocode(context.Background(), "Boise, ID")
+		done <- err
+	}()
+	clk.BlockUntil(t, 1)
+	if provider.calls != 1 {
+		t.Fatalf("expected the second lookup to wait, got %d lookups", provider.calls)
+	}
+	clk.Advance(time.Second)
+	if err := <-done; err != nil || provider.calls != 2 {
+		t.Fatalf("expected the second lookup after a second, got %v with %d lookups", err, provider.calls)
+	}
+
+	// Lookups whose callers give up keep their place in the queue, until it's
+	// longer than a lookup may wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range int(geocodeMaxWait / time.Second) {
+		if _, err := l.geocode(ctx, "Boise, ID"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the lookup to be canceled, got %v", err)
+		}
+	}
+	if _, err := l.geocode(ctx, "Boise, ID"); !errors.Is(err, errGeocodeRateLimited) {
+		t.Errorf("expected errGeocodeRateLimited, got %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("expected no lookups past the limit, got %d", provider.calls)
+	}
+}
+
+// TestGeocodeProviders tests reading the best match of each provider's
+// response, and telling no match from a failure
+func TestGeocodeProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		response  fakeResponse
+		expected  geoPoint
+		notFound  bool
+		expectErr bool
+	}{
+		{
+			name:     "census match",
+			provider: geocoderCensus,
+			response: fakeResponse{body: `{"result": {"addressMatches": [{"matchedAddress": "150 N CAPITOL BLVD, BOISE, ID, 83702", "coordinates": {"x": -116.2023, "y": 43.6150}}]}}`},
+			expected: geoPoint{Latitude: 43.6150, Longitude: -116.2023, Name: "150 N CAPITOL BLVD, BOISE, ID, 83702"},
+		},
+		{name: "census no match", provider: geocoderCensus, response: fakeResponse{body: `{"result": {"addressMatches": []}}`}, notFound: true},
+		{
+			name:     "nominatim match",
+			provider: geocoderNominatim,
+			response: fakeResponse{body: `[{"lat": "43.6166163", "lon": "-116.200886", "display_name": "Boise, Ada County, Idaho, United States"}]`},
+			expected: geoPoint{Latitude: 43.6166163, Longitude: -116.200886, Name: "Boise, Ada County, Idaho, United States"},
+		},
+		{name: "nominatim no match", provider: geocoderNominatim, response: fakeResponse{body: `[]`}, notFound: true},
+		{name: "nominatim invalid point", provider: geocoderNominatim, response: fakeResponse{body: `[{"lat": "north", "lon": "-116.2"}]`}, expectErr: true},
+		{name: "provider error", provider: geocoderNominatim, response: fakeResponse{status: http.StatusServiceUnavailable}, expectErr: true},
+		{name: "invalid response", provider: geocoderCensus, response: fakeResponse{body: `<html>`}, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeDoer(map[string]fakeResponse{"/": tt.response})
+			var provider geocoder = censusGeocoder{client: client, endpoint: geocoderEndpoints[geocoderCensus]}
+			if tt.provider == geocoderNominatim {
+				provider = nominatimGeocoder{client: client, endpoint: geocoderEndpoints[geocoderNominatim]}
+			}
+			point, err := provider.geocode(context.Background(), "Boise, ID")
+			switch {
+			case tt.notFound:
+				if !errors.Is(err, errLocationNotFound) {
+					t.Errorf("expected errLocationNotFound, got %v", err)
+				}
+			case tt.expectErr:
+				if err == nil || errors.Is(err, errLocationNotFound) {
+					t.Errorf("expected a provider error, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case point != tt.expected:
+				t.Errorf("expected %+v, got %+v", tt.expected, point)
+			}
+			if len(client.requests) != 1 || client.requests[0].Header.Get("User-Agent") != userAgent {
+				t.Fatalf("expected one request with our User-Agent, got %v", client.requests)
+			}
+			if q := client.requests[0].URL.Query(); q.Get("q")+q.Get("address") != "Boise, ID" {
+				t.Errorf("expected the query as a parameter, got %s", client.requests[0].URL)
+			}
+		})
+	}
+}
+
+// TestGeocodedForecast tests forecasts for a place name given as q
+func TestGeocodedForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		geocoder       bool
+		expectedStatus int
+	}{
+		{name: "place name", path: "/forecast?q=Boise,ID", geocoder: true, expectedStatus: http.StatusOK},
+		{name: "no match", path: "/forecast?q=Atlantis", geocoder: true, expectedStatus: http.StatusNotFound},
+		{name: "invalid query", path: "/forecast?q=%00", geocoder: true, expectedStatus: http.StatusBadRequest},
+		{name: "coordinates win", path: "/forecast?q=Atlantis&latitude=43.6166&longitude=-116.2009", geocoder: true, expectedStatus: http.StatusOK},
+		{name: "geocoding disabled", path: "/forecast?q=Boise,ID", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			srv.nws = nws
+			if tt.geocoder {
+				srv.geocoder = newCachingGeocoder(&fakeGeocoder{points: map[string]geoPoint{"Boise,ID": {Latitude: 43.61661, Longitude: -116.20089}}}, newFakeClock(time.Now()))
+			}
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK && nws.paths()[0] != "/points/43.6166,-116.2009" {
+				t.Errorf("expected the geocoded point to be looked up, got %v", nws.paths())
+			}
+		})
+	}
+}
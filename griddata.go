@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// Gridpoint time zones are IANA names, which must resolve even in
+	// containers without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// The NWS forecastGridData product holds the quantitative data behind the text
+// forecasts as time series. Each value is valid over an ISO 8601 interval such
+// as "2024-06-01T06:00:00+00:00/PT3H", and values are in WMO units that differ
+// from series to series.
+
+// gridValue is one value of a gridpoint series, valid for Duration from Start
+type gridValue struct {
+	Start    time.Time
+	Duration time.Duration
+	Value    float64
+}
+
+// gridSeries is a gridpoint series in canonical units, ordered by Start
+type gridSeries []gridValue
+
+// at returns the value valid at t
+func (g gridSeries) at(t time.Time) (float64, bool) {
+	i := sort.Search(len(g), func(i int) bool { return g[i].Start.After(t) }) - 1
+	if i < 0 || !t.Before(g[i].Start.Add(g[i].Duration)) {
+		return 0, false
+	}
+	return g[i].Value, true
+}
+
+// forecastStart returns the hour to start an hourly forecast from: the hour
+// containing now, or the start of the series if that is later
+func (g gridSeries) forecastStart(now time.Time) time.Time {
+	start := now.Truncate(time.Hour)
+	if len(g) > 0 && g[0].Start.After(start) {
+		start = g[0].Start.Truncate(time.Hour)
+	}
+	return start
+}
+
+// gridData holds the gridpoint series used by the agricultural and energy
+// endpoints: temperatures in °C, speeds in km/h, percentages, and millimetres
+type gridData struct {
+	// Location is the gridpoint's time zone, for grouping values by local day
+	Location                  *time.Location
+	ElevationM                float64
+	Temperature               gridSeries
+	Dewpoint                  gridSeries
+	RelativeHumidity          gridSeries
+	WindSpeed                 gridSeries
+	SkyCover                  gridSeries
+	PrecipitationProbability  gridSeries
+	QuantitativePrecipitation gridSeries
+}
+
+// nwsGridSeries is a series of an NWS forecastGridData response
+type nwsGridSeries struct {
+	UOM    string `json:"uom"`
+	Values []struct {
+		ValidTime string   `json:"validTime"`
+		Value     *float64 `json:"value"`
+	} `json:"values"`
+}
+
+// gridUnitConversions convert the WMO units NWS uses into canonical units
+var gridUnitConversions = map[string]func(float64) float64{
+	"wmoUnit:degC":           func(v float64) float64 { return v },
+	"wmoUnit:degF":           fahrenheitToCelsius,
+	"wmoUnit:km_h-1":         func(v float64) float64 { return v },
+	"wmoUnit:m_s-1":          func(v float64) float64 { return v * 3.6 },
+	"wmoUnit:percent":        func(v float64) float64 { return v },
+	"wmoUnit:mm":             func(v float64) float64 { return v },
+	"wmoUnit:m":              func(v float64) float64 { return v },
+	"wmoUnit:degree_(angle)": func(v float64) float64 { return v },
+}
+
+// parseGridData reads an NWS forecastGridData response. Null values are
+// skipped, so a series only holds the intervals NWS has data for.
+func parseGridData(body []byte) (gridData, error) {
+	var resp struct {
+		Properties struct {
+			Elevation struct {
+				UnitCode string  `json:"unitCode"`
+				Value    float64 `json:"value"`
+			} `json:"elevation"`
+			Temperature                nwsGridSeries `json:"temperature"`
+			Dewpoint                   nwsGridSeries `json:"dewpoint"`
+			RelativeHumidity           nwsGridSeries `json:"relativeHumidity"`
+			WindSpeed                  nwsGridSeries `json:"windSpeed"`
+			SkyCover                   nwsGridSeries `json:"skyCover"`
+			ProbabilityOfPrecipitation nwsGridSeries `json:"probabilityOfPrecipitation"`
+			QuantitativePrecipitation  nwsGridSeries `json:"quantitativePrecipitation"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return gridData{}, err
+	}
+	p := resp.Properties
+
+	data := gridData{Location: time.UTC, ElevationM: p.Elevation.Value}
+	if p.Elevation.UnitCode == "wmoUnit:ft" {
+		data.ElevationM = p.Elevation.Value * metersPerFoot
+	}
+	targets := []struct {
+		series *gridSeries
+		raw    nwsGridSeries
+	}{
+		{&data.Temperature, p.Temperature},
+		{&data.Dewpoint, p.Dewpoint},
+		{&data.RelativeHumidity, p.RelativeHumidity},
+		{&data.WindSpeed, p.WindSpeed},
+		{&data.SkyCover, p.SkyCover},
+		{&data.PrecipitationProbability, p.ProbabilityOfPrecipitation},
+		{&data.QuantitativePrecipitation, p.QuantitativePrecipitation},
+	}
+	for _, t := range targets {
+		series, err := t.raw.normalize()
+		if err != nil {
+			return gridData{}, err
+		}
+		*t.series = series
+	}
+	return data, nil
+}
+
+// normalize converts a raw series to canonical units
+func (raw nwsGridSeries) normalize() (gridSeries, error) {
+	if len(raw.Values) == 0 {
+		return nil, nil
+	}
+	convert, ok := gridUnitConversions[raw.UOM]
+	if !ok {
+		return nil, fmt.Errorf("unknown grid unit %q", raw.UOM)
+	}
+	series := make(gridSeries, 0, len(raw.Values))
+	for _, v := range raw.Values {
+		start, duration, err := parseValidTime(v.ValidTime)
+		if err != nil {
+			return nil, err
+		}
+		if v.Value == nil {
+			continue
+		}
+		series = append(series, gridValue{Start: start, Duration: duration, Value: convert(*v.Value)})
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Start.Before(series[j].Start) })
+	return series, nil
+}
+
+// parseValidTime reads an ISO 8601 interval of a start time and a duration,
+// such as "2024-06-01T06:00:00+00:00/P1DT6H"
+func parseValidTime(s string) (time.Time, time.Duration, error) {
+	startText, durationText, ok := strings.Cut(s, "/")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid valid time %q", s)
+	}
+	start, err := time.Parse(time.RFC3339, startText)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid valid time %q: %v", s, err)
+	}
+	duration, err := parseISODuration(durationText)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid valid time %q: %v", s, err)
+	}
+	return start, duration, nil
+}
+
+// parseISODuration reads the day, hour, and minute parts of an ISO 8601
+// duration such as "P1DT6H", the only parts NWS uses
+func parseISODuration(s string) (time.Duration, error) {
+	rest, ok := strings.CutPrefix(s, "P")
+	if !ok || rest == "" || strings.HasSuffix(rest, "T") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := map[byte]time.Duration{'D': 24 * time.Hour}
+	var d time.Duration
+	for rest != "" {
+		if rest[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute}
+			rest = rest[1:]
+			continue
+		}
+		i := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit, ok := units[rest[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n, _ := strconv.Atoi(rest[:i])
+		d += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+	return d, nil
+}
+
+// fetchGridData looks up the NWS gridpoint for a point and returns its
+// forecast grid data. Errors come with the HTTP status to report.
+func (s *server) fetchGridData(ctx context.Context, lat, lon string) (gridData, int, error) {
+	pointData, statusCode, err := s.lookupPoint(ctx, lat, lon)
+	if err != nil {
+		return gridData{}, statusCode, err
+	}
+	if pointData.Properties.ForecastGridData == "" {
+		return gridData{}, http.StatusNotFound, fmt.Errorf("Forecast grid data URL not found")
+	}
+
+	gridURL := pointData.Properties.ForecastGridData
+	body, statusCode, err := s.cachedNWSRequest(ctx, gridURL, gridURL, s.state.Config().NWSCacheTTL)
+	if err != nil {
+		return gridData{}, statusCode, err
+	}
+	data, err := parseGridData(body)
+	if err != nil {
+		return gridData{}, http.StatusInternalServerError, fmt.Errorf("Failed to parse grid data response")
+	}
+	dropGridAnomalies(&data)
+	if loc, err := time.LoadLocation(pointData.Properties.TimeZone); err == nil && pointData.Properties.TimeZone != "" {
+		data.Location = loc
+	}
+	return data, http.StatusOK, nil
+}
+
+const (
+	// defaultGridHours and maxGridHours bound the horizon of /griddata; NWS
+	// forecasts the grid about a week ahead
+	defaultGridHours = 48
+	maxGridHours     = 168
+)
+
+// gridHour is one hour of the /griddata response. Series that weren't asked
+// for, or that NWS has no value for in the hour, are left out.
+type gridHour struct {
+	StartTime                   time.Time `json:"startTime"`
+	ProbabilityOfPrecipitation  *float64  `json:"probabilityOfPrecipitation,omitempty"`
+	WindSpeedKPH                *float64  `json:"windSpeedKph,omitempty"`
+	RelativeHumidity            *float64  `json:"relativeHumidity,omitempty"`
+	DewpointC                   *float64  `json:"dewpointC,omitempty"`
+	SkyCover                    *float64  `json:"skyCover,omitempty"`
+	TemperatureC                *float64  `json:"temperatureC,omitempty"`
+	QuantitativePrecipitationMm *float64  `json:"quantitativePrecipitationMm,omitempty"`
+}
+
+// gridDataResponse is the body of /griddata
+type gridDataResponse struct {
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Series    []string   `json:"series"`
+	Hours     []gridHour `json:"hours"`
+}
+
+// gridHourSeries are the series /griddata serves by their ?series= names,
+// each with the field of a gridHour it fills
+var gridHourSeries = []struct {
+	name   string
+	series func(gridData) gridSeries
+	field  func(*gridHour) **float64
+}{
+	{"probabilityOfPrecipitation", func(g gridData) gridSeries { return g.PrecipitationProbability }, func(h *gridHour) **float64 { return &h.ProbabilityOfPrecipitation }},
+	{"windSpeed", func(g gridData) gridSeries { return g.WindSpeed }, func(h *gridHour) **float64 { return &h.WindSpeedKPH }},
+	{"relativeHumidity", func(g gridData) gridSeries { return g.RelativeHumidity }, func(h *gridHour) **float64 { return &h.RelativeHumidity }},
+	{"dewpoint", func(g gridData) gridSeries { return g.Dewpoint }, func(h *gridHour) **float64 { return &h.DewpointC }},
+	{"skyCover", func(g gridData) gridSeries { return g.SkyCover }, func(h *gridHour) **float64 { return &h.SkyCover }},
+	{"temperature", func(g gridData) gridSeries { return g.Temperature }, func(h *gridHour) **float64 { return &h.TemperatureC }},
+	{"quantitativePrecipitation", func(g gridData) gridSeries { return g.QuantitativePrecipitation }, func(h *gridHour) **float64 { return &h.QuantitativePrecipitationMm }},
+}
+
+// defaultGridSeries are the series /griddata serves without ?series=
+var defaultGridSeries = []string{"probabilityOfPrecipitation", "windSpeed", "relativeHumidity", "dewpoint", "skyCover"}
+
+// parseGridSeries reads the comma-separated series parameter. Names are
+// accepted in either JSON case.
+func parseGridSeries(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("series")
+	if v == "" {
+		return defaultGridSeries, nil
+	}
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, s := range gridHourSeries {
+			if name == s.name || name == snakeCase(s.name) {
+				if !slices.Contains(names, s.name) {
+					names = append(names, s.name)
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			valid := make([]string, len(gridHourSeries))
+			for i, s := range gridHourSeries {
+				valid[i] = s.name
+			}
+			return nil, fmt.Errorf("Invalid series parameter %q (want any of %s)", name, strings.Join(valid, ", "))
+		}
+	}
+	return names, nil
+}
+
+// gridHours samples the named series of g at each hour from start, up to
+// hours hours, skipping hours none of them has a value for
+func gridHours(g gridData, names []string, start time.Time, hours int) []gridHour {
+	out := []gridHour{}
+	for h := range hours {
+		t := start.Add(time.Duration(h) * time.Hour)
+		hour := gridHour{StartTime: t.In(g.Location)}
+		found := false
+		for _, s := range gridHourSeries {
+			if !slices.Contains(names, s.name) {
+				continue
+			}
+			if v, ok := s.series(g).at(t); ok {
+				v = roundTenth(v)
+				*s.field(&hour) = &v
+				found = true
+			}
+		}
+		if found {
+			out = append(out, hour)
+		}
+	}
+	return out
+}
+
+// gridDataHandler serves hourly values of the quantitative series behind the
+// text forecast, such as wind speed and sky cover, for charting
+func (s *server) gridDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	names, err := parseGridSeries(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hours := defaultGridHours
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxGridHours {
+			http.Error(w, fmt.Sprintf("Invalid hours parameter (want 1 to %d)", maxGridHours), http.StatusBadRequest)
+			return
+		}
+		hours = n
+	}
+
+	data, statusCode, err := s.fetchGridData(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	// Start from the current hour, or from the earliest series if they all
+	// start later
+	now := s.clock.Now()
+	var start time.Time
+	for _, gs := range gridHourSeries {
+		if series := gs.series(data); len(series) > 0 && slices.Contains(names, gs.name) {
+			if t := series.forecastStart(now); start.IsZero() || t.Before(start) {
+				start = t
+			}
+		}
+	}
+	if start.IsZero() {
+		start = now.Truncate(time.Hour)
+	}
+	resp := gridDataResponse{Series: names, Hours: gridHours(data, names, start, hours)}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestParseISODuration tests the ISO 8601 durations NWS uses
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		valid    bool
+	}{
+		{input: "PT1H", expected: time.Hour, valid: true},
+		{input: "PT30M", expected: 30 * time.Minute, valid: true},
+		{input: "P1D", expected: 24 * time.Hour, valid: true},
+		{input: "P1DT6H", expected: 30 * time.Hour, valid: true},
+		{input: "P7DT12H30M", expected: 7*24*time.Hour + 12*time.Hour + 30*time.Minute, valid: true},
+		{input: "P"},
+		{input: "1H"},
+		{input: "PT"},
+		{input: "P1H"},
+		{input: "PT6"},
+		{input: "PTH"},
+		{input: "P1DT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseISODuration(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got error %v", tt.valid, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseGridData tests reading and normalizing an NWS grid data response
+func TestParseGridData(t *testing.T) {
+	body := `{"properties": {
+		"elevation": {"unitCode": "wmoUnit:m", "value": 54.9},
+		"temperature": {"uom": "wmoUnit:degC", "values": [
+			{"validTime": "2024-06-01T18:00:00+00:00/PT2H", "value": 20},
+			{"validTime": "2024-06-01T12:00:00+00:00/PT6H", "value": 12.5}
+		]},
+		"windSpeed": {"uom": "wmoUnit:m_s-1", "values": [
+			{"validTime": "2024-06-01T12:00:00+00:00/P1D", "value": 5}
+		]},
+		"skyCover": {"uom": "wmoUnit:percent", "values": [
+			{"validTime": "2024-06-01T12:00:00+00:00/PT1H", "value": null},
+			{"validTime": "2024-06-01T13:00:00+00:00/PT1H", "value": 75}
+		]}
+	}}`
+	g, err := parseGridData([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g.ElevationM != 54.9 || g.Location != time.UTC {
+		t.Errorf("unexpected gridpoint %v m in %v", g.ElevationM, g.Location)
+	}
+
+	noon := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		series   gridSeries
+		at       time.Time
+		expected float64
+		found    bool
+	}{
+		{name: "sorted by start", series: g.Temperature, at: noon.Add(3 * time.Hour), expected: 12.5, found: true},
+		{name: "interval start", series: g.Temperature, at: noon.Add(6 * time.Hour), expected: 20, found: true},
+		{name: "interval end is exclusive", series: g.Temperature, at: noon.Add(8 * time.Hour)},
+		{name: "before the series", series: g.Temperature, at: noon.Add(-time.Hour)},
+		{name: "converted to km/h", series: g.WindSpeed, at: noon.Add(23 * time.Hour), expected: 18, found: true},
+		{name: "null values skipped", series: g.SkyCover, at: noon},
+		{name: "after a null", series: g.SkyCover, at: noon.Add(time.Hour), expected: 75, found: true},
+		{name: "missing series", series: g.Dewpoint, at: noon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := tt.series.at(tt.at)
+			if found != tt.found || math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected %v (%v), got %v (%v)", tt.expected, tt.found, got, found)
+			}
+		})
+	}
+
+	invalid := []string{
+		`{"properties": {"temperature": {"uom": "wmoUnit:K", "values": [{"validTime": "2024-06-01T12:00:00+00:00/PT1H", "value": 290}]}}}`,
+		`{"properties": {"temperature": {"uom": "wmoUnit:degC", "values": [{"validTime": "2024-06-01T12:00:00+00:00", "value": 20}]}}}`,
+		`{"properties": {"temperature": {"uom": "wmoUnit:degC", "values": [{"validTime": "yesterday/PT1H", "value": 20}]}}}`,
+	}
+	for _, body := range invalid {
+		if _, err := parseGridData([]byte(body)); err == nil {
+			t.Errorf("expected error for %s", body)
+		}
+	}
+}
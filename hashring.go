@@ -0,0 +1,51 @@
+package main
+
+import (
+	"hash/crc32"
+	"slices"
+	"strconv"
+)
+
+// hashRingReplicas is the number of points each node has on a hash ring,
+// which evens out the share of keys each node gets
+const hashRingReplicas = 64
+
+// hashRing assigns keys to nodes by consistent hashing, so adding or removing
+// a node only moves the keys of its neighbours on the ring
+type hashRing struct {
+	nodes []string
+	// hashes are the sorted points of the ring, and owners the node of each
+	hashes []uint32
+	owners map[uint32]string
+}
+
+// newHashRing returns a ring of nodes
+func newHashRing(nodes []string) *hashRing {
+	r := &hashRing{nodes: nodes, owners: map[uint32]string{}}
+	for _, node := range nodes {
+		for i := range hashRingReplicas {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			if _, taken := r.owners[h]; taken {
+				continue
+			}
+			r.owners[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	slices.Sort(r.hashes)
+	return r
+}
+
+// get returns the node owning key, the first clockwise of the key's hash, or
+// "" when the ring is empty
+func (r *hashRing) get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i, _ := slices.BinarySearch(r.hashes, h)
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
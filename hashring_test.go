@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestHashRing tests that keys spread over the nodes and that removing a node
+// only moves its own keys
+func TestHashRing(t *testing.T) {
+	nodes := []string{"http://a:8080", "http://b:8080", "http://c:8080"}
+	ring := newHashRing(nodes)
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for i := range 3000 {
+		key := fmt.Sprintf("points/%d", i)
+		owners[key] = ring.get(key)
+		counts[owners[key]]++
+	}
+	for _, node := range nodes {
+		if counts[node] < 500 {
+			t.Errorf("expected %s to own a fair share of keys, got %d of 3000", node, counts[node])
+		}
+	}
+
+	smaller := newHashRing(nodes[:2])
+	for key, owner := range owners {
+		if owner != nodes[2] && smaller.get(key) != owner {
+			t.Errorf("expected %s to stay on %s, got %s", key, owner, smaller.get(key))
+		}
+	}
+
+	if got := newHashRing(nil).get("points/1"); got != "" {
+		t.Errorf("expected no owner on an empty ring, got %q", got)
+	}
+}
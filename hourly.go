@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// hourlyPeriod is one hour of the /forecast/hourly response, in canonical units
+type hourlyPeriod struct {
+	StartTime                 time.Time `json:"startTime"`
+	EndTime                   time.Time `json:"endTime"`
+	Forecast                  string    `json:"forecast"`
+	DetailedForecast          string    `json:"detailedForecast,omitempty"`
+	ConditionCode             string    `json:"conditionCode"`
+	TemperatureC              float64   `json:"temperatureC"`
+	WindSpeedKPH              *float64  `json:"windSpeedKph,omitempty"`
+	WindDirection             string    `json:"windDirection,omitempty"`
+	PrecipitationProbability  *int      `json:"precipitationProbability,omitempty"`
+	PrecipitationInterpolated bool      `json:"precipitationInterpolated,omitempty"`
+}
+
+// hourlyResponse is the body of /forecast/hourly
+type hourlyResponse struct {
+	Latitude  float64              `json:"latitude"`
+	Longitude float64              `json:"longitude"`
+	Elevation *elevationAdjustment `json:"elevation,omitempty"`
+	Periods   []hourlyPeriod       `json:"periods"`
+}
+
+func newHourlyPeriod(p weatherPeriod) hourlyPeriod {
+	return hourlyPeriod{
+		StartTime:                 p.Start,
+		EndTime:                   p.End,
+		Forecast:                  p.Summary,
+		ConditionCode:             string(p.Condition),
+		TemperatureC:              p.TemperatureC,
+		WindSpeedKPH:              p.WindSpeedKPH,
+		WindDirection:             p.WindDirection,
+		PrecipitationProbability:  p.PrecipitationProbability,
+		PrecipitationInterpolated: p.PrecipitationInterpolated,
+	}
+}
+
+// hourlyHandler serves the hourly forecast for a point. Missing probabilities
+// of precipitation are filled in as configured by FORECAST_POP_GAP_FILL, and
+// ?interval= aggregates the hours into coarser buckets.
+func (s *server) hourlyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	var interval time.Duration
+	if v := r.URL.Query().Get("interval"); v != "" {
+		var err error
+		if interval, err = parseInterval(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	lang, err := parseLang(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	detail, err := parseDetail(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	units, err := parseUnits(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	elevation, err := parseElevation(r, units)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	periods, statusCode, err := s.fetchPeriodsIn(r.Context(), lat, lon, true, units)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	if s.store != nil {
+		latitude, longitude := parsePoint(lat, lon)
+		s.archiveForecast(r.Context(), latitude, longitude, productHourly, periods)
+	}
+	periods, adjustment := s.adjustForElevation(periods, elevation)
+	fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+	if interval > time.Hour {
+		periods = resample(periods, interval)
+	}
+
+	resp := hourlyResponse{Elevation: adjustment, Periods: make([]hourlyPeriod, 0, len(periods))}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	texts := make([]*string, 0, 2*len(periods))
+	for _, p := range periods {
+		hp := newHourlyPeriod(p)
+		if detail {
+			hp.DetailedForecast = p.Detail
+		}
+		localizeUnits(units, p.TextUnits, &hp.Forecast, &hp.DetailedForecast)
+		resp.Periods = append(resp.Periods, hp)
+		last := &resp.Periods[len(resp.Periods)-1]
+		texts = append(texts, &last.Forecast, &last.DetailedForecast)
+	}
+	setContentLanguage(w, lang, s.translateTexts(r.Context(), lang, texts...))
+	writeJSON(w, http.StatusOK, resp)
+}
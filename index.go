@@ -0,0 +1,289 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiVersion identifies the shape of API responses; it changes only when an
+// existing response changes incompatibly
+const apiVersion = "1"
+
+// endpoint is a route of the API. Every route is registered from one of these,
+// so the index served at GET / always matches what the server handles.
+type endpoint struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Scope is the role a caller needs, empty for public routes
+	Scope       string `json:"scope,omitempty"`
+	Description string `json:"description"`
+	// Params lists the query parameters the route accepts, besides the
+	// commonParams every route accepts
+	Params []string `json:"params,omitempty"`
+
+	handler http.HandlerFunc
+	// timeout overrides the configured request timeout for slow routes
+	timeout time.Duration
+	// passesParams marks routes that pass their query parameters on, so
+	// strict mode doesn't check them
+	passesParams bool
+	// checksMethod marks handlers that answer other methods with 405
+	// themselves, so they're registered for every method
+	checksMethod bool
+}
+
+// commonParams are the query parameters every route accepts
+var commonParams = []string{"case", signatureParam, expiresParam}
+
+// pointParams returns the parameters of a route taking a point, followed by
+// its own
+func pointParams(params ...string) []string {
+	return append([]string{"latitude", "longitude", "zip", "fips", "q", "city", "station", "pluscode", "w3w"}, params...)
+}
+
+// unknownParams returns the query parameters of r that are neither in params
+// nor commonParams, in the order given. The raw query is read since some
+// routes accept values Go's query parser rejects.
+func unknownParams(r *http.Request, params []string) []string {
+	var unknown []string
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if name == "" || slices.Contains(params, name) || slices.Contains(commonParams, name) || slices.Contains(unknown, name) {
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+	return unknown
+}
+
+// strictParams rejects requests with query parameters the route doesn't
+// accept when strict mode is enabled, so a typo such as lattitude is reported
+// as such rather than as a missing latitude
+func (s *server) strictParams(params []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.state.Config().StrictParams {
+			if unknown := unknownParams(r, params); len(unknown) > 0 {
+				want := "none"
+				if len(params) > 0 {
+					want = strings.Join(params, ", ")
+				}
+				http.Error(w, fmt.Sprintf("Unknown query parameters: %s (want %s)", strings.Join(unknown, ", "), want), http.StatusBadRequest)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// register adds e to mux behind its scope check and the client rate limit,
+// rejecting parameters it doesn't accept in strict mode
+func (s *server) register(mux *http.ServeMux, e endpoint) {
+	pattern := e.Method + " " + e.Path
+	if e.checksMethod {
+		pattern = e.Path
+	}
+	handler := e.handler
+	if !e.passesParams {
+		handler = s.strictParams(e.Params, handler)
+	}
+	if e.Scope != "" {
+		handler = s.requireScope(e.Scope, handler)
+	}
+	mux.HandleFunc(pattern, s.withTimeout(e.timeout, s.limitRate(s.withRetryAfter(s.withStaleWarning(handler)))))
+}
+
+// apiEndpoints returns the routes of the main listener, other than the admin
+// routes
+func (s *server) apiEndpoints() []endpoint {
+	endpoints := []endpoint{
+		{Method: "GET", Path: "/{$}", Description: "Demo page, or this index when JSON is accepted", handler: s.rootHandler},
+		{Method: "GET", Path: "/demo/{file}", Description: "Scripts and stylesheets of the demo page", handler: demoAssetHandler},
+		{Method: "GET", Path: "/cities", Description: "City presets accepted as the city parameter", handler: citiesHandler},
+		{Method: "GET", Path: "/version", Description: "Build of the running server and its enabled features", handler: s.versionHandler},
+		{Method: "GET", Path: "/forecast", Scope: scopeRead, Description: "Current forecast categories for a point", Params: pointParams("format", "period", "lang", "detail", "units", "elevation"), handler: s.forecastHandler, checksMethod: true},
+		{Method: "GET", Path: "/forecast/hourly", Scope: scopeRead, Description: "Hourly forecast periods in canonical units", Params: pointParams("interval", "lang", "detail", "units", "elevation"), handler: s.hourlyHandler, checksMethod: true},
+		{Method: "GET", Path: "/forecast/all", Scope: scopeRead, Description: "Cached forecasts of every prefetch location, with an ETag over the set", handler: s.allForecastsHandler, checksMethod: true},
+		{Method: "GET", Path: "/forecast/periods", Scope: scopeRead, Description: "Every twelve-hour forecast period", Params: pointParams("periods", "lang", "detail", "units", "elevation"), handler: s.periodsHandler, checksMethod: true},
+		{Method: "GET", Path: "/current", Scope: scopeRead, Description: "Latest observation from the nearest station", Params: pointParams(), handler: s.currentHandler, checksMethod: true},
+		{Method: "POST", Path: "/forecasts", Scope: scopeRead, Description: "Forecasts of up to 250 points in one call", handler: s.batchHandler, timeout: slowRouteTimeout},
+		{Method: "GET", Path: "/compare", Scope: scopeRead, Description: "Forecasts of 2 to 10 points side by side", Params: []string{"points"}, handler: s.compareHandler, timeout: slowRouteTimeout, checksMethod: true},
+		{Method: "GET", Path: "/will-it-rain", Scope: scopeRead, Description: "Whether rain is expected within a window", Params: pointParams("within"), handler: s.answerHandler(rainQuestion), checksMethod: true},
+		{Method: "GET", Path: "/will-it-snow", Scope: scopeRead, Description: "Whether snow is expected within a window", Params: pointParams("within"), handler: s.answerHandler(snowQuestion), checksMethod: true},
+		{Method: "GET", Path: "/forecast/stats", Scope: scopeRead, Description: "Summary statistics over a forecast window", Params: pointParams("hours"), handler: s.statsHandler, checksMethod: true},
+		{Method: "GET", Path: "/degree-days", Scope: scopeRead, Description: "Heating, cooling, and growing degree days", Params: pointParams("base", "growingBase"), handler: s.degreeDaysHandler, checksMethod: true},
+		{Method: "GET", Path: "/frost", Scope: scopeRead, Description: "Frost and freeze outlook by night", Params: pointParams("nights"), handler: s.frostHandler, checksMethod: true},
+		{Method: "GET", Path: "/irrigation", Scope: scopeRead, Description: "Evapotranspiration and irrigation advice", Params: pointParams("kc"), handler: s.irrigationHandler, checksMethod: true},
+		{Method: "GET", Path: "/griddata", Scope: scopeRead, Description: "Hourly quantitative forecast series for charting", Params: pointParams("series", "hours"), handler: s.gridDataHandler, checksMethod: true},
+		{Method: "GET", Path: "/solar", Scope: scopeRead, Description: "Solar position and PV output estimates", Params: pointParams("kw"), handler: s.solarHandler, checksMethod: true},
+		{Method: "GET", Path: "/wind", Scope: scopeRead, Description: "Hub height wind and turbine output estimates", Params: pointParams("height", "shear", "kw", "cutIn", "ratedSpeed", "cutOut"), handler: s.windHandler, checksMethod: true},
+		{Method: "GET", Path: "/road", Scope: scopeRead, Description: "Road risk categories by hour", Params: pointParams(), handler: s.roadHandler, checksMethod: true},
+		{Method: "GET", Path: "/calendar.ics", Scope: scopeRead, Description: "iCalendar feed of daily forecasts and alerts", Params: pointParams(), handler: s.calendarHandler, checksMethod: true},
+		{Method: "GET", Path: "/best-time", Scope: scopeRead, Description: "Best upcoming slots for an activity", Params: pointParams("activity", "window", "limit"), handler: s.bestTimeHandler, checksMethod: true},
+		{Method: "GET", Path: "/alerts", Scope: scopeRead, Description: "Watches, warnings, and advisories in effect at a point", Params: pointParams(), handler: s.activeAlertsHandler, checksMethod: true},
+		{Method: "POST", Path: "/score", Scope: scopeRead, Description: "Score forecast hours against event rules", handler: s.scoreHandler},
+	}
+	if s.state.Config().URLSigningKey != "" {
+		endpoints = append(endpoints, endpoint{Method: "POST", Path: "/sign", Scope: scopeRead, Description: "Sign a read URL for use without an API key", handler: s.signHandler})
+	}
+	if s.state.Config().CachePeers != "" {
+		endpoints = append(endpoints, endpoint{Method: "GET", Path: "/route", Scope: scopeRead, Description: "Replica whose cache serves a point's gridpoint", Params: pointParams(), handler: s.routeHandler, checksMethod: true})
+		endpoints = append(endpoints, endpoint{Method: "GET", Path: "/peer/nws", Description: "NWS response for a peer replica's cache, with its peer token", Params: []string{"key", "url", "ttl"}, handler: s.peerHandler})
+	}
+	if s.state.Config().NWSProxy {
+		endpoints = append(endpoints, endpoint{Method: "GET", Path: "/proxy/nws/{path...}", Scope: scopeRead, Description: "Cached, rate limited proxy of the NWS API", handler: s.proxyHandler, passesParams: true})
+	}
+	if s.store != nil {
+		endpoints = append(endpoints,
+			endpoint{Method: "GET", Path: "/subscriptions", Scope: scopeSubscribe, Description: "List the caller's webhook subscriptions", handler: s.listSubscriptionsHandler},
+			endpoint{Method: "POST", Path: "/subscriptions", Scope: scopeSubscribe, Description: "Create a webhook subscription", handler: s.createSubscriptionHandler},
+			endpoint{Method: "DELETE", Path: "/subscriptions/{id}", Scope: scopeSubscribe, Description: "Delete a webhook subscription", handler: s.deleteSubscriptionHandler},
+			endpoint{Method: "GET", Path: "/subscriptions/{id}/deliveries", Scope: scopeSubscribe, Description: "List recent deliveries to a webhook subscription", Params: []string{"limit"}, handler: s.listDeliveriesHandler},
+			endpoint{Method: "GET", Path: "/webhook-keys", Scope: scopeSubscribe, Description: "List the caller's webhook signing keys", handler: s.listSigningKeysHandler},
+			endpoint{Method: "POST", Path: "/webhook-keys", Scope: scopeSubscribe, Description: "Create a webhook signing key", handler: s.createSigningKeyHandler},
+			endpoint{Method: "POST", Path: "/webhook-keys/{id}/rotate", Scope: scopeSubscribe, Description: "Replace a webhook signing key, keeping the old one for an overlap", Params: []string{"overlap"}, handler: s.rotateSigningKeyHandler},
+			endpoint{Method: "DELETE", Path: "/webhook-keys/{id}", Scope: scopeSubscribe, Description: "Revoke a webhook signing key", handler: s.revokeSigningKeyHandler},
+			endpoint{Method: "POST", Path: "/deliveries/{id}/replay", Scope: scopeSubscribe, Description: "Resend a past webhook delivery", handler: s.replayDeliveryHandler},
+			endpoint{Method: "GET", Path: "/forecast/asof", Scope: scopeRead, Description: "Forecast as archived at a past time", Params: pointParams("time", "product"), handler: s.asofHandler, checksMethod: true},
+			endpoint{Method: "GET", Path: "/feed.atom", Scope: scopeRead, Description: "Atom feed of forecast revisions and alerts", Params: pointParams(), handler: s.feedHandler, checksMethod: true},
+			endpoint{Method: "POST", Path: "/share", Scope: scopeRead, Description: "Create a short link to a point's forecast", handler: s.createShareHandler},
+			endpoint{Method: "GET", Path: "/s/{token}", Description: "Forecast named by a share link, as a page or JSON", handler: s.shareHandler},
+			endpoint{Method: "GET", Path: "/share/{token}/qr.png", Description: "QR code of a share link", Params: []string{"scale"}, handler: s.shareQRHandler},
+			endpoint{Method: "GET", Path: "/alerts/history", Scope: scopeRead, Description: "Alerts in effect for a zone since a time", Params: []string{"zone", "since", "limit", "cursor"}, handler: s.alertHistoryHandler, checksMethod: true},
+		)
+	}
+	return endpoints
+}
+
+// adminEndpoints returns the admin and metrics routes
+func (s *server) adminEndpoints() []endpoint {
+	var endpoints []endpoint
+	if s.store != nil {
+		endpoints = append(endpoints,
+			endpoint{Method: "GET", Path: "/admin/keys", Scope: scopeAdmin, Description: "List API keys", handler: s.listKeysHandler},
+			endpoint{Method: "POST", Path: "/admin/keys", Scope: scopeAdmin, Description: "Issue an API key", handler: s.createKeyHandler},
+			endpoint{Method: "DELETE", Path: "/admin/keys/{id}", Scope: scopeAdmin, Description: "Revoke an API key", handler: s.deleteKeyHandler},
+		)
+	}
+	endpoints = append(endpoints,
+		endpoint{Method: "POST", Path: "/admin/prewarm", Scope: scopeAdmin, Description: "Prewarm the NWS cache for a CSV of points", handler: s.startPrewarmHandler},
+		endpoint{Method: "GET", Path: "/admin/prewarm", Scope: scopeAdmin, Description: "Progress of the latest prewarm", handler: s.prewarmStatusHandler},
+		endpoint{Method: "GET", Path: "/admin/nws-budget", Scope: scopeAdmin, Description: "Requests sent to NWS by day against the daily budget", handler: s.budgetHandler},
+		endpoint{Method: "GET", Path: "/admin/jobs", Scope: scopeAdmin, Description: "Scheduled jobs with their next runs and last results", handler: s.jobsHandler},
+	)
+	return append(endpoints, endpoint{Method: "GET", Path: "/debug/vars", Scope: scopeAdmin, Description: "Metrics in expvar format", handler: expvar.Handler().ServeHTTP, checksMethod: true})
+}
+
+// indexFeatures reports the optional features enabled in this deployment
+type indexFeatures struct {
+	Persistence          bool     `json:"persistence"`
+	AuthRequired         bool     `json:"authRequired"`
+	OIDC                 bool     `json:"oidc"`
+	SignedURLs           bool     `json:"signedUrls"`
+	AlertHistory         bool     `json:"alertHistory"`
+	ArchiveExports       bool     `json:"archiveExports"`
+	WeeklyReports        bool     `json:"weeklyReports"`
+	SeparateAdmin        bool     `json:"separateAdmin"`
+	Offline              bool     `json:"offline"`
+	NWSProxy             bool     `json:"nwsProxy"`
+	Geocoding            bool     `json:"geocoding"`
+	ZIPLookup            bool     `json:"zipLookup"`
+	Prefetch             bool     `json:"prefetch"`
+	PrecipitationGapFill string   `json:"precipitationGapFill"`
+	JSONCase             string   `json:"jsonCase"`
+	StrictParams         bool     `json:"strictParams"`
+	Transforms           []string `json:"transforms"`
+}
+
+// features reports the optional features of the current configuration
+func (s *server) features() indexFeatures {
+	cfg := s.state.Config()
+	transforms, _ := parseTransforms(cfg.Transforms)
+	return indexFeatures{
+		Persistence:          s.store != nil,
+		AuthRequired:         cfg.AuthRequired,
+		OIDC:                 cfg.OIDCIssuer != "",
+		SignedURLs:           cfg.URLSigningKey != "",
+		AlertHistory:         s.store != nil,
+		ArchiveExports:       s.store != nil && cfg.ArchiveURL != "",
+		WeeklyReports:        s.store != nil && cfg.ReportFormat != "",
+		SeparateAdmin:        cfg.AdminAddr != "",
+		Offline:              cfg.Offline,
+		NWSProxy:             cfg.NWSProxy,
+		Geocoding:            cfg.Geocoder != "",
+		ZIPLookup:            cfg.ZIPFile != "",
+		Prefetch:             cfg.PrefetchFile != "",
+		PrecipitationGapFill: cfg.PrecipitationGapFill,
+		JSONCase:             cfg.JSONCase,
+		StrictParams:         cfg.StrictParams,
+		Transforms:           transforms,
+	}
+}
+
+// indexResponse is the body of GET / for JSON clients
+type indexResponse struct {
+	Service    string        `json:"service"`
+	Version    string        `json:"version"`
+	APIVersion string        `json:"apiVersion"`
+	Formats    []string      `json:"formats"`
+	Features   indexFeatures `json:"features"`
+	Endpoints  []endpoint    `json:"endpoints"`
+}
+
+// acceptsJSON reports whether a request's Accept header asks for JSON ahead of
+// HTML
+func acceptsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
+
+// rootHandler serves the demo page to browsers and the API index to clients
+// that accept JSON
+func (s *server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Vary", "Accept")
+	if !acceptsJSON(r) {
+		demoHandler(w, r)
+		return
+	}
+
+	endpoints := s.apiEndpoints()
+	if s.state.Config().AdminAddr == "" {
+		endpoints = append(endpoints, s.adminEndpoints()...)
+	}
+	for i := range endpoints {
+		endpoints[i].Path = strings.TrimSuffix(endpoints[i].Path, "{$}")
+	}
+	formats := make([]string, 0, len(renderers))
+	for name := range renderers {
+		formats = append(formats, name)
+	}
+	slices.Sort(formats)
+
+	writeJSON(w, http.StatusOK, indexResponse{
+		Service:    "forecast",
+		Version:    build.Version,
+		APIVersion: apiVersion,
+		Formats:    formats,
+		Features:   s.features(),
+		Endpoints:  endpoints,
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAcceptsJSON tests choosing between the demo page and the index
+func TestAcceptsJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{accept: "", expected: false},
+		{accept: "*/*", expected: false},
+		{accept: "application/json", expected: true},
+		{accept: "text/html,application/xhtml+xml,*/*;q=0.8", expected: false},
+		{accept: "application/xml, application/json;q=0.9", expected: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := acceptsJSON(r); got != tt.expected {
+			t.Errorf("Accept %q: expected %v, got %v", tt.accept, tt.expected, got)
+		}
+	}
+}
+
+// TestRootIndex tests that the index lists every route the server handles
+func TestRootIndex(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           Config
+		withStore     bool
+		expected      []string
+		notExpected   []string
+		persistence   bool
+		weeklyReports bool
+	}{
+		{
+			name:        "stateless",
+			cfg:         defaultConfig(),
+			expected:    []string{"GET /forecast", "POST /score", "GET /debug/vars", "GET /"},
+			notExpected: []string{"GET /subscriptions", "GET /admin/keys"},
+		},
+		{
+			name:          "with a database",
+			cfg:           Config{DatabaseURL: "sqlite://forecast.db", ReportFormat: reportPDF},
+			withStore:     true,
+			expected:      []string{"GET /subscriptions", "GET /alerts/history", "GET /admin/keys"},
+			persistence:   true,
+			weeklyReports: true,
+		},
+		{
+			name:        "separate admin listener",
+			cfg:         Config{AdminAddr: ":9090"},
+			expected:    []string{"GET /forecast"},
+			notExpected: []string{"GET /debug/vars"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(tt.cfg)
+			if tt.withStore {
+				srv.store = newTestStore(t)
+			}
+			handler := srv.routes()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			var index indexResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+				t.Fatal(err)
+			}
+			if index.Features.Persistence != tt.persistence || index.Features.WeeklyReports != tt.weeklyReports {
+				t.Errorf("unexpected features %+v", index.Features)
+			}
+
+			routes := map[string]bool{}
+			for _, e := range index.Endpoints {
+				routes[e.Method+" "+e.Path] = true
+				// Every listed route must be handled; fill in path parameters.
+				// Handlers may answer 404 for a missing resource, but not with
+				// the mux's own page.
+				path := strings.NewReplacer("{id}", "1", "{file}", "demo.js", "{token}", "missing").Replace(e.Path)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(e.Method, path, nil))
+				if (w.Code == http.StatusNotFound && strings.HasPrefix(w.Body.String(), "404 page not found")) || w.Code == http.StatusMethodNotAllowed {
+					t.Errorf("%s %s: expected the route to be handled, got %d", e.Method, e.Path, w.Code)
+				}
+			}
+			for _, route := range tt.expected {
+				if !routes[route] {
+					t.Errorf("expected %s in the index", route)
+				}
+			}
+			for _, route := range tt.notExpected {
+				if routes[route] {
+					t.Errorf("expected %s to be missing from the index", route)
+				}
+			}
+		})
+	}
+}
+
+// TestStrictParams tests rejecting unknown query parameters in strict mode
+func TestStrictParams(t *testing.T) {
+	body := `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`
+	tests := []struct {
+		name           string
+		strict         bool
+		path           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "typo allowed by default", path: "/forecast?lattitude=47.6&latitude=47.6&longitude=-122.3", expectedStatus: http.StatusOK},
+		{name: "known parameters", strict: true, path: "/forecast?latitude=47.6&longitude=-122.3&format=json&case=snake", expectedStatus: http.StatusOK},
+		{name: "typo", strict: true, path: "/forecast?lattitude=47.6&longitude=-122.3", expectedStatus: http.StatusBadRequest, expectedError: "Unknown query parameters: lattitude (want latitude, longitude, zip, fips, q, city, station, pluscode, w3w, format,"},
+		{name: "several unknown", strict: true, path: "/forecast/stats?latitude=47.6&longitude=-122.3&hour=6&fmt=csv&hour=7", expectedStatus: http.StatusBadRequest, expectedError: "Unknown query parameters: hour, fmt (want latitude, longitude, zip, fips, q, city, station, pluscode, w3w, hours)"},
+		{name: "raw compare points", strict: true, path: "/compare?points=47.6,-122.3;40.7,-74.0", expectedStatus: http.StatusOK},
+		{name: "route without parameters", strict: true, path: "/version?verbose=1", expectedStatus: http.StatusBadRequest, expectedError: "Unknown query parameters: verbose (want none)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost, JSONCase: jsonCaseCamel, StrictParams: tt.strict})
+			srv.nws = newFakeNWSDoer(fakeResponse{body: body})
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedError) {
+				t.Errorf("expected %q, got %q", tt.expectedError, w.Body.String())
+			}
+		})
+	}
+}
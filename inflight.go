@@ -0,0 +1,63 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+)
+
+var (
+	// requestsInFlight gauges the requests being handled
+	requestsInFlight = expvar.NewInt("forecast_requests_in_flight")
+	// connectionsOpen gauges the client connections of every listener
+	connectionsOpen = expvar.NewInt("forecast_connections_open")
+	// slowRequests counts requests that took longer than
+	// SlowRequestThreshold
+	slowRequests = expvar.NewInt("forecast_slow_requests")
+)
+
+// trackConnState keeps connectionsOpen up to date, as an http.Server's
+// ConnState hook
+func trackConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		connectionsOpen.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		connectionsOpen.Add(-1)
+	}
+}
+
+// inFlight counts the requests being handled and logs those slower than the
+// configured threshold, once when they pass it, so a hang shows up while it's
+// happening, and again when they finish
+func (s *server) inFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsInFlight.Add(1)
+		defer requestsInFlight.Add(-1)
+		threshold := s.state.Config().SlowRequestThreshold
+		if threshold <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, _ := traceFromContext(r.Context())
+		start := s.clock.Now()
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-done:
+			case <-s.clock.After(threshold):
+				log.Printf("Slow request still running after %v: %s %s (request %s, %d in flight)",
+					threshold, r.Method, r.URL.Path, t.RequestID, requestsInFlight.Value())
+			}
+		}()
+		next.ServeHTTP(w, r)
+		close(done)
+
+		if elapsed := s.clock.Now().Sub(start); elapsed >= threshold {
+			slowRequests.Add(1)
+			log.Printf("Slow request took %v: %s %s (request %s)", elapsed, r.Method, r.URL.Path, t.RequestID)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestInFlight tests gauging requests while they're handled and counting
+// those slower than the threshold
+func TestInFlight(t *testing.T) {
+	tests := []struct {
+		name         string
+		threshold    time.Duration
+		duration     time.Duration
+		expectedSlow int64
+	}{
+		{name: "fast", threshold: 5 * time.Second, duration: time.Second},
+		{name: "slow", threshold: 5 * time.Second, duration: 6 * time.Second, expectedSlow: 1},
+		{name: "disabled", duration: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := newFakeClock(time.Now())
+			srv := newServer(Config{SlowRequestThreshold: tt.threshold})
+			srv.clock = clk
+			inFlight, slow := requestsInFlight.Value(), slowRequests.Value()
+			handler := srv.inFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := requestsInFlight.Value(); got != inFlight+1 {
+					t.Errorf("expected %d requests in flight, got %d", inFlight+1, got)
+				}
+				if tt.threshold > 0 {
+					clk.BlockUntil(t, 1)
+				}
+				clk.Advance(tt.duration)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/forecast", nil))
+			if got := requestsInFlight.Value(); got != inFlight {
+				t.Errorf("expected %d requests in flight after, got %d", inFlight, got)
+			}
+			if got := slowRequests.Value() - slow; got != tt.expectedSlow {
+				t.Errorf("expected %d slow requests, got %d", tt.expectedSlow, got)
+			}
+		})
+	}
+}
+
+// TestTrackConnState tests gauging open connections as they change state
+func TestTrackConnState(t *testing.T) {
+	open := connectionsOpen.Value()
+	for _, state := range []http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateNew, http.StateClosed} {
+		trackConnState(nil, state)
+	}
+	if got := connectionsOpen.Value() - open; got != 1 {
+		t.Errorf("expected 1 open connection, got %d", got)
+	}
+	trackConnState(nil, http.StateHijacked)
+	if got := connectionsOpen.Value(); got != open {
+		t.Errorf("expected %d open connections, got %d", open, got)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultCropCoefficient suits cool-season lawns, the most common target
+	// of smart sprinkler controllers
+	defaultCropCoefficient = 0.8
+	// effectiveRainFraction is the share of forecast rain assumed to reach the
+	// root zone rather than run off or evaporate from leaves
+	effectiveRainFraction = 0.8
+	// minIrrigationMm is the smallest deficit worth running sprinklers for
+	minIrrigationMm = 5.0
+)
+
+// Irrigation recommendations
+const (
+	irrigationWater = "water"
+	irrigationSkip  = "skip"
+)
+
+// dailyWeather holds the daily values reference evapotranspiration is
+// computed from
+type dailyWeather struct {
+	Date            time.Time
+	MinC, MaxC      float64
+	MinRH, MaxRH    float64
+	HasRH           bool
+	DewpointC       float64
+	HasDewpoint     bool
+	WindKPH         float64
+	SkyCover        float64
+	PrecipitationMm float64
+}
+
+// dailyGridWeather summarises grid data by local day. Only days the
+// temperature series covers completely are returned.
+func dailyGridWeather(g gridData) []dailyWeather {
+	if len(g.Temperature) == 0 {
+		return nil
+	}
+	type accumulator struct {
+		day                     dailyWeather
+		hours                   int
+		rhHours, dewHours       int
+		windHours, skyHours     int
+		dewSum, windSum, skySum float64
+	}
+	var days []*accumulator
+	byDate := map[string]*accumulator{}
+	dayOf := func(t time.Time) *accumulator {
+		local := t.In(g.Location)
+		key := local.Format("2006-01-02")
+		if a, ok := byDate[key]; ok {
+			return a
+		}
+		a := &accumulator{day: dailyWeather{
+			Date: time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, g.Location),
+			MinC: math.Inf(1), MaxC: math.Inf(-1), MinRH: math.Inf(1), MaxRH: math.Inf(-1),
+		}}
+		byDate[key] = a
+		days = append(days, a)
+		return a
+	}
+
+	first := g.Temperature[0].Start.Truncate(time.Hour)
+	last := g.Temperature[len(g.Temperature)-1]
+	for t := first; t.Before(last.Start.Add(last.Duration)); t = t.Add(time.Hour) {
+		temp, ok := g.Temperature.at(t)
+		if !ok {
+			continue
+		}
+		a := dayOf(t)
+		a.hours++
+		a.day.MinC = min(a.day.MinC, temp)
+		a.day.MaxC = max(a.day.MaxC, temp)
+		if rh, ok := g.RelativeHumidity.at(t); ok {
+			a.rhHours++
+			a.day.MinRH = min(a.day.MinRH, rh)
+			a.day.MaxRH = max(a.day.MaxRH, rh)
+		}
+		if dew, ok := g.Dewpoint.at(t); ok {
+			a.dewHours++
+			a.dewSum += dew
+		}
+		if wind, ok := g.WindSpeed.at(t); ok {
+			a.windHours++
+			a.windSum += wind
+		}
+		if sky, ok := g.SkyCover.at(t); ok {
+			a.skyHours++
+			a.skySum += sky
+		}
+	}
+	// Precipitation amounts are totals over their interval, spread evenly
+	// over its hours
+	for _, v := range g.QuantitativePrecipitation {
+		hours := max(1, int(v.Duration/time.Hour))
+		for h := range hours {
+			if a, ok := byDate[v.Start.Add(time.Duration(h)*time.Hour).In(g.Location).Format("2006-01-02")]; ok {
+				a.day.PrecipitationMm += v.Value / float64(hours)
+			}
+		}
+	}
+
+	var out []dailyWeather
+	for _, a := range days {
+		if a.hours < int(a.day.Date.AddDate(0, 0, 1).Sub(a.day.Date).Hours()) {
+			continue
+		}
+		d := a.day
+		d.HasRH = a.rhHours > 0
+		if a.dewHours > 0 {
+			d.HasDewpoint, d.DewpointC = true, a.dewSum/float64(a.dewHours)
+		}
+		if a.windHours > 0 {
+			d.WindKPH = a.windSum / float64(a.windHours)
+		}
+		if a.skyHours > 0 {
+			d.SkyCover = a.skySum / float64(a.skyHours)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// saturationVapourPressure returns the saturation vapour pressure in kPa at a
+// temperature in °C
+func saturationVapourPressure(c float64) float64 {
+	return 0.6108 * math.Exp(17.27*c/(c+237.3))
+}
+
+// extraterrestrialRadiation returns the daily solar radiation at the top of
+// the atmosphere in MJ/m², for a latitude in degrees and a day of the year
+func extraterrestrialRadiation(latitude float64, dayOfYear int) float64 {
+	phi := latitude * math.Pi / 180
+	angle := 2 * math.Pi * float64(dayOfYear) / 365
+	distance := 1 + 0.033*math.Cos(angle)
+	declination := 0.409 * math.Sin(angle-1.39)
+	sunset := math.Acos(max(-1, min(1, -math.Tan(phi)*math.Tan(declination))))
+	return 24 * 60 / math.Pi * 0.0820 * distance *
+		(sunset*math.Sin(phi)*math.Sin(declination) + math.Cos(phi)*math.Cos(declination)*math.Sin(sunset))
+}
+
+// referenceET computes the FAO-56 Penman-Monteith reference evapotranspiration
+// of a grass surface in mm/day. Forecasts carry no sunshine duration, so solar
+// radiation is estimated from sky cover with the Angström formula, taking the
+// clear fraction of the sky as the relative sunshine duration. Wind speeds are
+// forecast at 10 m and adjusted to the 2 m the equation expects.
+func referenceET(d dailyWeather, latitude, elevationM float64) float64 {
+	mean := (d.MinC + d.MaxC) / 2
+	pressure := 101.3 * math.Pow((293-0.0065*elevationM)/293, 5.26)
+	gamma := 0.000665 * pressure
+	delta := 4098 * saturationVapourPressure(mean) / math.Pow(mean+237.3, 2)
+
+	es := (saturationVapourPressure(d.MinC) + saturationVapourPressure(d.MaxC)) / 2
+	var ea float64
+	switch {
+	case d.HasRH:
+		ea = (saturationVapourPressure(d.MinC)*d.MaxRH/100 + saturationVapourPressure(d.MaxC)*d.MinRH/100) / 2
+	case d.HasDewpoint:
+		ea = saturationVapourPressure(d.DewpointC)
+	default:
+		// Without humidity, assume the air saturates at the daily low
+		ea = saturationVapourPressure(d.MinC)
+	}
+
+	u2 := d.WindKPH / 3.6 * 4.87 / math.Log(67.8*10-5.42)
+
+	ra := extraterrestrialRadiation(latitude, d.Date.YearDay())
+	rs := (0.25 + 0.5*(1-d.SkyCover/100)) * ra
+	rso := (0.75 + 2e-5*elevationM) * ra
+	rnl := 4.903e-9 * (math.Pow(d.MaxC+273.16, 4) + math.Pow(d.MinC+273.16, 4)) / 2 *
+		(0.34 - 0.14*math.Sqrt(ea)) * (1.35*min(1, rs/rso) - 0.35)
+	rn := 0.77*rs - rnl
+
+	et := (0.408*delta*rn + gamma*900/(mean+273)*u2*(es-ea)) / (delta + gamma*(1+0.34*u2))
+	return max(0, et)
+}
+
+// irrigationDay is one day of the /irrigation response
+type irrigationDay struct {
+	Date            string  `json:"date"`
+	ET0Mm           float64 `json:"et0Mm"`
+	CropETMm        float64 `json:"cropEtMm"`
+	PrecipitationMm float64 `json:"precipitationMm"`
+}
+
+// irrigationAdvice is the water balance over the forecast and what to do
+// about it
+type irrigationAdvice struct {
+	DemandMm        float64 `json:"demandMm"`
+	EffectiveRainMm float64 `json:"effectiveRainMm"`
+	DeficitMm       float64 `json:"deficitMm"`
+	Recommendation  string  `json:"recommendation"`
+	WaterMm         float64 `json:"waterMm,omitempty"`
+}
+
+// irrigationResponse is the body of /irrigation
+type irrigationResponse struct {
+	Latitude        float64          `json:"latitude"`
+	Longitude       float64          `json:"longitude"`
+	CropCoefficient float64          `json:"cropCoefficient"`
+	Days            []irrigationDay  `json:"days"`
+	Irrigation      irrigationAdvice `json:"irrigation"`
+}
+
+// adviseIrrigation balances crop water demand against forecast rain. Watering
+// is recommended when the deficit is worth a sprinkler run.
+func adviseIrrigation(days []dailyWeather, latitude, elevationM, kc float64) ([]irrigationDay, irrigationAdvice) {
+	out := make([]irrigationDay, 0, len(days))
+	var advice irrigationAdvice
+	for _, d := range days {
+		et0 := referenceET(d, latitude, elevationM)
+		out = append(out, irrigationDay{
+			Date:            d.Date.Format("2006-01-02"),
+			ET0Mm:           roundTenth(et0),
+			CropETMm:        roundTenth(et0 * kc),
+			PrecipitationMm: roundTenth(d.PrecipitationMm),
+		})
+		advice.DemandMm += et0 * kc
+		advice.EffectiveRainMm += d.PrecipitationMm * effectiveRainFraction
+	}
+	deficit := max(0, advice.DemandMm-advice.EffectiveRainMm)
+	advice.DemandMm = roundTenth(advice.DemandMm)
+	advice.EffectiveRainMm = roundTenth(advice.EffectiveRainMm)
+	advice.DeficitMm = roundTenth(deficit)
+	advice.Recommendation = irrigationSkip
+	if deficit >= minIrrigationMm {
+		advice.Recommendation, advice.WaterMm = irrigationWater, advice.DeficitMm
+	}
+	return out, advice
+}
+
+// irrigationHandler serves daily reference evapotranspiration and an
+// irrigation recommendation for the forecast days. ?kc= sets the crop
+// coefficient relating the crop's water use to the reference grass.
+func (s *server) irrigationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	kc := defaultCropCoefficient
+	if v := r.URL.Query().Get("kc"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || n > 2 {
+			http.Error(w, "Invalid kc parameter (want a crop coefficient above 0 and at most 2)", http.StatusBadRequest)
+			return
+		}
+		kc = n
+	}
+
+	data, statusCode, err := s.fetchGridData(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := irrigationResponse{CropCoefficient: kc}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	resp.Days, resp.Irrigation = adviseIrrigation(dailyGridWeather(data), resp.Latitude, data.ElevationM, kc)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestReferenceET tests against worked example 18 of FAO Irrigation and
+// Drainage Paper 56: Brussels on 6 July, where ET₀ is 3.9 mm/day
+func TestReferenceET(t *testing.T) {
+	day := dailyWeather{
+		Date: time.Date(2024, 7, 5, 0, 0, 0, 0, time.UTC), // day 187 of a leap year
+		MinC: 12.3, MaxC: 21.5,
+		MinRH: 63, MaxRH: 84, HasRH: true,
+		// 2.078 m/s at 2 m, measured as 2.78 m/s at 10 m
+		WindKPH: 2.78 * 3.6,
+		// 9.25 of a possible 16.1 hours of sunshine
+		SkyCover: 100 * (1 - 9.25/16.1),
+	}
+	if got := referenceET(day, 50.8, 100); math.Abs(got-3.9) > 0.05 {
+		t.Errorf("expected 3.9 mm/day, got %.2f", got)
+	}
+
+	if ra := extraterrestrialRadiation(50.8, 187); math.Abs(ra-41.09) > 0.1 {
+		t.Errorf("expected 41.09 MJ/m², got %.2f", ra)
+	}
+	// Polar night receives nothing
+	if ra := extraterrestrialRadiation(80, 355); ra > 0.01 {
+		t.Errorf("expected no radiation, got %.2f", ra)
+	}
+
+	// Humid, overcast, and calm days lose less water than dry, sunny, windy ones
+	humid := referenceET(dailyWeather{Date: day.Date, MinC: 15, MaxC: 20, MinRH: 90, MaxRH: 100, HasRH: true, SkyCover: 100}, 40, 0)
+	dry := referenceET(dailyWeather{Date: day.Date, MinC: 15, MaxC: 30, MinRH: 20, MaxRH: 50, HasRH: true, WindKPH: 20}, 40, 0)
+	if humid >= dry {
+		t.Errorf("expected humid day (%.2f) below dry day (%.2f)", humid, dry)
+	}
+}
+
+// TestDailyGridWeather tests summarising grid data by local day
+func TestDailyGridWeather(t *testing.T) {
+	zone := time.FixedZone("CDT", -5*60*60)
+	start := time.Date(2024, 7, 1, 12, 0, 0, 0, zone)
+	g := gridData{
+		Location: zone,
+		// Twelve hours of July 1st, then all of July 2nd
+		Temperature: gridSeries{
+			{Start: start, Duration: 12 * time.Hour, Value: 25},
+			{Start: start.Add(12 * time.Hour), Duration: 12 * time.Hour, Value: 15},
+			{Start: start.Add(24 * time.Hour), Duration: 12 * time.Hour, Value: 30},
+		},
+		RelativeHumidity: gridSeries{
+			{Start: start, Duration: 24 * time.Hour, Value: 80},
+			{Start: start.Add(24 * time.Hour), Duration: 12 * time.Hour, Value: 40},
+		},
+		WindSpeed: gridSeries{{Start: start, Duration: 36 * time.Hour, Value: 10}},
+		SkyCover: gridSeries{
+			{Start: start.Add(12 * time.Hour), Duration: 12 * time.Hour, Value: 100},
+			{Start: start.Add(24 * time.Hour), Duration: 12 * time.Hour, Value: 0},
+		},
+		// 6 mm over the six hours either side of midnight, half on each day
+		QuantitativePrecipitation: gridSeries{{Start: start.Add(9 * time.Hour), Duration: 6 * time.Hour, Value: 6}},
+	}
+
+	days := dailyGridWeather(g)
+	if len(days) != 1 {
+		t.Fatalf("expected only the complete day, got %d days", len(days))
+	}
+	d := days[0]
+	if !d.Date.Equal(time.Date(2024, 7, 2, 0, 0, 0, 0, zone)) {
+		t.Errorf("unexpected date %v", d.Date)
+	}
+	if d.MinC != 15 || d.MaxC != 30 || d.MinRH != 40 || d.MaxRH != 80 || !d.HasRH || d.HasDewpoint {
+		t.Errorf("unexpected extremes %+v", d)
+	}
+	if d.WindKPH != 10 || d.SkyCover != 50 || d.PrecipitationMm != 3 {
+		t.Errorf("unexpected means %+v", d)
+	}
+
+	if days := dailyGridWeather(gridData{Location: time.UTC}); days != nil {
+		t.Errorf("expected no days, got %+v", days)
+	}
+}
+
+// TestAdviseIrrigation tests the recommendation from the water balance
+func TestAdviseIrrigation(t *testing.T) {
+	sunny := dailyWeather{Date: time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC), MinC: 18, MaxC: 32, MinRH: 30, MaxRH: 70, HasRH: true, WindKPH: 12}
+	rainy := sunny
+	rainy.Date = sunny.Date.AddDate(0, 0, 1)
+	rainy.PrecipitationMm = 25
+
+	days, advice := adviseIrrigation([]dailyWeather{sunny, sunny}, 40, 200, defaultCropCoefficient)
+	if len(days) != 2 || days[0].Date != "2024-07-02" || days[0].CropETMm != roundTenth(days[0].ET0Mm*defaultCropCoefficient) {
+		t.Errorf("unexpected days %+v", days)
+	}
+	if advice.Recommendation != irrigationWater || advice.WaterMm != advice.DeficitMm || advice.DeficitMm < minIrrigationMm {
+		t.Errorf("expected watering on a dry week, got %+v", advice)
+	}
+
+	_, advice = adviseIrrigation([]dailyWeather{sunny, rainy}, 40, 200, defaultCropCoefficient)
+	if advice.Recommendation != irrigationSkip || advice.WaterMm != 0 || advice.EffectiveRainMm != 20 {
+		t.Errorf("expected rain to cover demand, got %+v", advice)
+	}
+
+	days, advice = adviseIrrigation(nil, 40, 200, defaultCropCoefficient)
+	if len(days) != 0 || advice.Recommendation != irrigationSkip {
+		t.Errorf("expected nothing to do without forecast days, got %+v", advice)
+	}
+}
@@ -1,55 +1,331 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-const (
-	userAgent = "(murphybytes.com murphybytes@gmail.com)"
-)
+// nwsClient sends every request to NWS unless the server is given another
+// doer, as in offline mode. Its timeout ends requests left running by
+// handlers that timed out. Redirects are returned rather than followed, for
+// doNWS to follow.
+var nwsClient = &http.Client{
+	Timeout:       upstreamTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
 
-var (
-	// nwsAPIHost can be overridden for testing
-	nwsAPIHost = "https://api.weather.gov"
-)
+// userAgent identifies the service and its build to NWS, which asks clients
+// for contact details in case of problems
+var userAgent = "forecast/" + build.Version + " (murphybytes.com murphybytes@gmail.com)"
 
 // PointResponse represents the NWS points API response
 type PointResponse struct {
 	Properties struct {
-		Forecast string `json:"forecast"`
-	} `json:"properties"`
-}
-
-// ForecastResponse represents the NWS forecast API response
-type ForecastResponse struct {
-	Properties struct {
-		Periods []struct {
-			ShortForecast string `json:"shortForecast"`
-			Temperature   int    `json:"temperature"`
-		} `json:"periods"`
+		Forecast            string `json:"forecast"`
+		ForecastHourly      string `json:"forecastHourly"`
+		ForecastGridData    string `json:"forecastGridData"`
+		ObservationStations string `json:"observationStations"`
+		TimeZone            string `json:"timeZone"`
 	} `json:"properties"`
 }
 
 // ForecastOutput represents our API response
 type ForecastOutput struct {
-	Forecast    string `json:"forecast"`
-	Temperature string `json:"temperature"`
+	XMLName       xml.Name `json:"-" xml:"forecast"`
+	Forecast      string   `json:"forecast" xml:"shortForecast"`
+	ConditionCode string   `json:"conditionCode" xml:"conditionCode"`
+	Temperature   string   `json:"temperature" xml:"temperature"`
+	Wind          string   `json:"wind,omitempty" xml:"wind,omitempty"`
+	Precipitation string   `json:"precipitation,omitempty" xml:"precipitation,omitempty"`
+	// DetailedForecast is only filled in for ?detail=true
+	DetailedForecast string `json:"detailedForecast,omitempty" xml:"detailedForecast,omitempty"`
+	// SummaryText is a one-sentence outlook for the next few days
+	SummaryText string `json:"summaryText,omitempty" xml:"summaryText,omitempty"`
+	// Elevation is only filled in for ?elevation=
+	Elevation *elevationAdjustment `json:"elevation,omitempty" xml:"elevation,omitempty"`
+}
+
+// server holds the dependencies shared by the HTTP handlers
+type server struct {
+	state *state
+	// store is nil when persistence is disabled
+	store Store
+	// oidc is nil unless JWT authentication is configured
+	oidc *oidcVerifier
+	// clock tells the time for handlers and background jobs
+	clock clock
+	// activities holds the comfort profiles of /best-time, reloaded with the
+	// configuration
+	activities atomic.Pointer[map[string]activityProfile]
+	// categories holds the temperature categories of the configuration,
+	// reloaded with it
+	categories atomic.Pointer[temperatureCategories]
+	// clients rate limits each client's requests
+	clients clientLimiter
+	// wasmBudget holds the run time of WASM rules left to each API key
+	wasmBudget wasmBudget
+	// translator is nil unless a translation provider is configured
+	translator translator
+	// geocoder is nil unless a geocoding provider is configured
+	geocoder geocoder
+	// w3w is nil unless what3words lookup is configured
+	w3w geocoder
+	// nws sends requests to NWS and webhooks sends notifications, so tests
+	// and offline mode can answer them without a network
+	nws      doer
+	webhooks doer
+	// proxy caches and rate limits the requests of /proxy/nws/
+	proxy *nwsProxy
+	// nwsCache holds recent NWS responses and those of prewarmed points
+	nwsCache *nwsCache
+	// refreshing holds the keys of stale NWS responses being refreshed
+	refreshing sync.Map
+	// redirects remembers where NWS URLs permanently moved
+	redirects nwsRedirects
+	// throttle pauses requests to NWS after it answers 429
+	throttle nwsThrottle
+	// peers is the hash ring of the cache peers, rebuilt when they change
+	peers atomic.Pointer[hashRing]
+	// budget counts the requests sent to NWS against the daily budget
+	budget *nwsBudget
+	// limiter rate limits the requests sent to NWS
+	limiter nwsLimiter
+	// prewarm is the latest prewarm started by /admin/prewarm
+	prewarm atomic.Pointer[prewarmJob]
+	// prefetch holds the locations kept warm on a schedule, reloaded with
+	// the configuration
+	prefetch atomic.Pointer[[]prefetchLocation]
+	// zips holds the ZIP code centroids of ?zip=, reloaded with the
+	// configuration
+	zips atomic.Pointer[map[string]centroid]
+	// counties holds the county points of ?fips=, reloaded with the
+	// configuration
+	counties atomic.Pointer[map[string]centroid]
+	// jobs runs the background jobs listed by /admin/jobs
+	jobs *scheduler
+}
+
+// newServer returns a server using cfg
+func newServer(cfg Config) *server {
+	s := &server{state: newState(cfg), oidc: newOIDCVerifier(cfg), clock: realClock{}, translator: newTranslator(cfg, realClock{}), geocoder: newGeocoder(cfg, realClock{}), w3w: newW3WResolver(cfg, realClock{}), nws: nwsClient, webhooks: webhookClient, proxy: newNWSProxy(realClock{}), nwsCache: newNWSCache(realClock{}, cfg.NWSCacheSize), budget: newNWSBudget(), jobs: newScheduler(realClock{})}
+	categories, err := parseTemperatureCategories(cfg)
+	if err != nil {
+		// loadConfig rejects invalid categories and rules, so only a Config
+		// built without it lacks them
+		categories = &temperatureCategories{scale: temperatureScale}
+	}
+	s.categories.Store(categories)
+	return s
 }
 
 func main() {
-	http.HandleFunc("/forecast", forecastHandler)
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	log.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	cfg, err := loadConfig()
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	log.Printf("Starting %s", build)
+	srv := newServer(cfg)
+	files, err := readDataFiles(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.useDataFiles(files)
+	if cfg.RedisURL != "" {
+		if srv.nwsCache.shared, err = newRedisClient(cfg.RedisURL); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Sharing the NWS cache through Redis at %s", srv.nwsCache.shared.addr)
+	}
+	if cfg.Offline {
+		srv.nws = &http.Client{Transport: offlineTransport{now: srv.clock.Now}}
+		log.Println("Offline mode: serving canned NWS data for every point")
+	}
+	if cfg.DatabaseURL != "" {
+		store, err := openConfiguredStore(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+		srv.store = store
+		srv.jobs.add(srv.pruneJob())
+		srv.jobs.add(srv.alertPollJob())
+		srv.jobs.add(srv.digestJob())
+		if cfg.ArchiveURL != "" {
+			blobs, err := openBlobStore(cfg.ArchiveURL)
+			if err != nil {
+				log.Fatal(err)
+			}
+			srv.jobs.add(srv.archiveExportJob(blobs))
+		}
+		if cfg.ReportFormat != "" {
+			srv.jobs.add(srv.reportJob())
+		}
+	}
+	if cfg.PrefetchFile != "" {
+		srv.jobs.add(srv.prefetchJob())
+	}
+	srv.jobs.start(context.Background())
+	go srv.reloadOnSignal()
+
+	if cfg.AdminAddr != "" {
+		log.Printf("Admin server starting on %s", cfg.AdminAddr)
+		go func() {
+			log.Fatal(listen(cfg.AdminAddr, srv.adminRoutes(), cfg, true))
+		}()
+	}
+	log.Printf("Server starting on %s", cfg.Addr)
+	log.Fatal(listen(cfg.Addr, srv.routes(), cfg, false))
+}
+
+// runCommand runs a forecast subcommand such as `forecast migrate`
+func runCommand(name string, args []string) error {
+	switch name {
+	case "check":
+		return runCheckCommand(args, os.Stdout)
+	case "version":
+		return runVersionCommand(args, os.Stdout)
+	case "migrate":
+		return runMigrateCommand(args, os.Stdout)
+	case "export":
+		return runExportCommand(args, os.Stdout)
+	case "import":
+		return runImportCommand(args, os.Stdin, os.Stdout)
+	case "rotate-keys":
+		return runRotateKeysCommand(args, os.Stdout)
+	case "create-key":
+		return runCreateKeyCommand(args, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// routes builds the handler serving every route of the forecast API. The admin
+// routes are included unless they have a listener of their own.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	for _, e := range s.apiEndpoints() {
+		s.register(mux, e)
+	}
+	if s.state.Config().AdminAddr == "" {
+		s.registerAdminRoutes(mux)
+	}
+	return s.secure(traced(s.inFlight(s.jsonCasing(mux))))
+}
+
+// adminRoutes builds the handler for the separate admin listener
+func (s *server) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+	return s.secure(traced(s.inFlight(mux)))
+}
+
+func (s *server) registerAdminRoutes(mux *http.ServeMux) {
+	for _, e := range s.adminEndpoints() {
+		s.register(mux, e)
+	}
 }
 
-func forecastHandler(w http.ResponseWriter, r *http.Request) {
+// reloadOnSignal reloads the configuration from the config file and
+// environment on SIGHUP, along with the data files it names. Everything is
+// read before anything is replaced, so a reload that fails partway keeps the
+// previous configuration and files. The listen addresses and TLS settings are
+// only read at startup.
+func (s *server) reloadOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := s.reload(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+			continue
+		}
+		log.Println("Config reloaded")
+	}
+}
+
+// reload reads the configuration and its data files, and replaces the
+// current ones with them only if all could be read
+func (s *server) reload() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	files, err := readDataFiles(cfg)
+	if err != nil {
+		return err
+	}
+	categories, err := parseTemperatureCategories(cfg)
+	if err != nil {
+		return err
+	}
+	s.useDataFiles(files)
+	s.categories.Store(categories)
+	s.state.Store(cfg)
+	return nil
+}
+
+// dataFiles are the parsed contents of the data files a configuration names
+type dataFiles struct {
+	activities    map[string]activityProfile
+	proxyPolicies []proxyPolicy
+	prefetch      []prefetchLocation
+	zips          map[string]centroid
+	counties      map[string]centroid
+}
+
+// readDataFiles reads and parses every data file cfg names
+func readDataFiles(cfg Config) (dataFiles, error) {
+	var files dataFiles
+	var err error
+	if files.activities, err = loadActivityProfiles(cfg.ActivitiesFile); err != nil {
+		return files, err
+	}
+	if files.proxyPolicies, err = loadProxyPolicies(cfg.ProxyPolicyFile); err != nil {
+		return files, err
+	}
+	if files.prefetch, err = loadPrefetchLocations(cfg.PrefetchFile); err != nil {
+		return files, err
+	}
+	if files.zips, err = loadZIPCentroids(cfg.ZIPFile); err != nil {
+		return files, err
+	}
+	if files.counties, err = loadCountyCentroids(cfg.FIPSFile); err != nil {
+		return files, err
+	}
+	return files, nil
+}
+
+// useDataFiles replaces the server's data with that of files
+func (s *server) useDataFiles(files dataFiles) {
+	s.activities.Store(&files.activities)
+	s.proxy.setPolicies(files.proxyPolicies)
+	s.prefetch.Store(&files.prefetch)
+	s.zips.Store(&files.zips)
+	s.counties.Store(&files.counties)
+}
+
+func (s *server) forecastHandler(w http.ResponseWriter, r *http.Request) {
 	// Only accept GET requests
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -57,106 +333,332 @@ func forecastHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get query parameters
-	lat := r.URL.Query().Get("latitude")
-	lon := r.URL.Query().Get("longitude")
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
 
-	if lat == "" || lon == "" {
-		http.Error(w, "Missing latitude or longitude parameter", http.StatusBadRequest)
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	first, err := parsePeriodSelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lang, err := parseLang(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	detail, err := parseDetail(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	units, err := parseUnits(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	elevation, err := parseElevation(r, units)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Step 1: Call the points endpoint
-	pointsURL := fmt.Sprintf("%s/points/%s,%s", nwsAPIHost, lat, lon)
-	pointResp, statusCode, err := makeNWSRequest(pointsURL)
+	// Steps 1-3: Look up the forecast for the point
+	periods, statusCode, err := s.fetchPeriodsIn(r.Context(), lat, lon, false, units)
 	if err != nil {
 		http.Error(w, err.Error(), statusCode)
 		return
 	}
 
-	var pointData PointResponse
-	if err := json.Unmarshal(pointResp, &pointData); err != nil {
-		http.Error(w, "Failed to parse points response", http.StatusInternalServerError)
+	// Step 4: Pick the period to report
+	if len(periods) == 0 {
+		http.Error(w, "No forecast periods found", http.StatusNotFound)
 		return
 	}
+	adjusted, adjustment := s.adjustForElevation(periods, elevation)
+	period := adjusted[0]
+	if !first {
+		period = currentPeriod(adjusted, s.clock.Now())
+	}
+
+	// Step 5: Map temperature, wind, and precipitation to categories
+	output := s.periodOutput(period)
+	output.Elevation = adjustment
+	if detail {
+		output.DetailedForecast = period.Detail
+	}
+	output.SummaryText = summarizeOutlook(periods)
+	s.applyTransforms(period, &output)
+
+	latitude, longitude := parsePoint(lat, lon)
+	if s.store != nil {
+		rec := &HistoryRecord{
+			Latitude:    latitude,
+			Longitude:   longitude,
+			Forecast:    period.Summary,
+			Temperature: roundInt(celsiusToFahrenheit(period.TemperatureC)),
+		}
+		if err := s.store.AddHistory(r.Context(), rec); err != nil {
+			log.Printf("Failed to record forecast history: %v", err)
+		}
+		s.archiveForecast(r.Context(), latitude, longitude, productForecast, periods)
+	}
+
+	// Step 6: Build and return the response in the negotiated format, with
+	// the forecast text in the units and language asked for
+	localizeUnits(units, period.TextUnits, &output.Forecast, &output.DetailedForecast)
+	setContentLanguage(w, lang, s.translateTexts(r.Context(), lang, &output.Forecast, &output.DetailedForecast, &output.SummaryText))
+	writeDocument(w, format, forecastDocument{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Output:    output,
+	})
+}
 
+// requirePoint reads the latitude and longitude query parameters, or in their
+// place looks up the zip or fips parameter or geocodes the q parameter when
+// those are configured, looks up the city or station parameter, or decodes the
+// pluscode or w3w parameter, replying with an error when there's no point
+func (s *server) requirePoint(w http.ResponseWriter, r *http.Request) (lat, lon string, ok bool) {
+	lat = r.URL.Query().Get("latitude")
+	lon = r.URL.Query().Get("longitude")
+	if zip := r.URL.Query().Get("zip"); zip != "" && lat == "" && lon == "" {
+		return s.zipPoint(w, zip)
+	}
+	if fips := r.URL.Query().Get("fips"); fips != "" && lat == "" && lon == "" {
+		return s.fipsPoint(w, fips)
+	}
+	if q := r.URL.Query().Get("q"); q != "" && lat == "" && lon == "" && s.geocoder != nil {
+		return s.geocodePoint(w, r, q)
+	}
+	if city := r.URL.Query().Get("city"); city != "" && lat == "" && lon == "" {
+		return cityPoint(w, city)
+	}
+	if station := r.URL.Query().Get("station"); station != "" && lat == "" && lon == "" {
+		return s.stationPoint(w, r, station)
+	}
+	if code := r.URL.Query().Get("pluscode"); code != "" && lat == "" && lon == "" {
+		return plusCodePoint(w, code)
+	}
+	if address := r.URL.Query().Get("w3w"); address != "" && lat == "" && lon == "" {
+		return s.w3wPoint(w, r, address)
+	}
+	if lat == "" || lon == "" {
+		http.Error(w, "Missing latitude or longitude parameter", http.StatusBadRequest)
+		return "", "", false
+	}
+	return lat, lon, true
+}
+
+// parseDetail reads the detail parameter, reporting whether the full prose
+// forecast was asked for. It's left out by default since it's large.
+func parseDetail(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("detail")
+	if v == "" {
+		return false, nil
+	}
+	detail, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("Invalid detail parameter (want true or false)")
+	}
+	return detail, nil
+}
+
+// parseUnits reads the units parameter selecting the units of forecast text:
+// us (or imperial), as NWS writes it by default, or metric
+func parseUnits(r *http.Request) (string, error) {
+	switch units := r.URL.Query().Get("units"); units {
+	case "", unitsUS, unitsImperial:
+		return unitsUS, nil
+	case unitsMetric:
+		return units, nil
+	default:
+		return "", fmt.Errorf("Invalid units parameter (want %s or %s)", unitsMetric, unitsImperial)
+	}
+}
+
+// Values of the period parameter of /forecast
+const (
+	periodCurrent = "current"
+	periodFirst   = "first"
+)
+
+// parsePeriodSelection reads the period parameter, reporting whether the
+// first period NWS lists was asked for rather than the current one
+func parsePeriodSelection(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("period") {
+	case "", periodCurrent:
+		return false, nil
+	case periodFirst:
+		return true, nil
+	default:
+		return false, fmt.Errorf("Invalid period parameter (want %s or %s)", periodCurrent, periodFirst)
+	}
+}
+
+// currentPeriod returns the period covering now, or the next to start when
+// now falls between periods. NWS can list a period that ended hours ago first,
+// so its position isn't enough. When every period has ended the forecast is
+// stale and the first period is returned.
+func currentPeriod(periods []weatherPeriod, now time.Time) weatherPeriod {
+	for _, p := range periods {
+		if now.Before(p.End) {
+			return p
+		}
+	}
+	return periods[0]
+}
+
+// parsePoint converts the coordinates of a request for use in responses
+func parsePoint(lat, lon string) (float64, float64) {
+	latitude, _ := strconv.ParseFloat(lat, 64)
+	longitude, _ := strconv.ParseFloat(lon, 64)
+	return latitude, longitude
+}
+
+// fetchPeriods looks up the NWS gridpoint for a point and returns its
+// normalized forecast periods: twelve-hour periods, or hourly ones when hourly
+// is set. Errors come with the HTTP status to report.
+func (s *server) fetchPeriods(ctx context.Context, lat, lon string, hourly bool) ([]weatherPeriod, int, error) {
+	return s.fetchPeriodsIn(ctx, lat, lon, hourly, unitsUS)
+}
+
+// fetchPeriodsIn is fetchPeriods with the forecast text written in units
+func (s *server) fetchPeriodsIn(ctx context.Context, lat, lon string, hourly bool, units string) ([]weatherPeriod, int, error) {
+	// Step 1: Call the points endpoint
+	pointData, statusCode, err := s.lookupPoint(ctx, lat, lon)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	return s.fetchPointPeriods(ctx, pointData, hourly, units)
+}
+
+// fetchPointPeriods returns the normalized forecast periods of a gridpoint
+// already looked up, with the forecast text written in units
+func (s *server) fetchPointPeriods(ctx context.Context, pointData PointResponse, hourly bool, units string) ([]weatherPeriod, int, error) {
 	// Step 2: Get the forecast URL from the response
 	forecastURL := pointData.Properties.Forecast
+	if hourly {
+		forecastURL = pointData.Properties.ForecastHourly
+	}
 	if forecastURL == "" {
-		http.Error(w, "Forecast URL not found", http.StatusNotFound)
-		return
+		return nil, http.StatusNotFound, fmt.Errorf("Forecast URL not found")
+	}
+	// NWS writes the text in metric itself, which reads better than
+	// converting it
+	if units == unitsMetric {
+		u, err := url.Parse(forecastURL)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Invalid forecast URL")
+		}
+		q := u.Query()
+		q.Set("units", "si")
+		u.RawQuery = q.Encode()
+		forecastURL = u.String()
 	}
 
 	// Step 3: Call the forecast endpoint
-	forecastResp, statusCode, err := makeNWSRequest(forecastURL)
+	forecastResp, statusCode, err := s.cachedNWSRequest(ctx, forecastURL, forecastURL, s.state.Config().NWSCacheTTL)
 	if err != nil {
-		http.Error(w, err.Error(), statusCode)
-		return
+		return nil, statusCode, err
 	}
 
-	var forecastData ForecastResponse
-	if err := json.Unmarshal(forecastResp, &forecastData); err != nil {
-		http.Error(w, "Failed to parse forecast response", http.StatusInternalServerError)
-		return
+	periods, err := nwsNormalizer{}.normalize(forecastResp)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to parse forecast response")
 	}
+	return dropPeriodAnomalies(periods), statusCode, nil
+}
 
-	// Step 4: Extract the first period's data
-	if len(forecastData.Properties.Periods) == 0 {
-		http.Error(w, "No forecast periods found", http.StatusNotFound)
-		return
+// lookupPoint calls the NWS points endpoint, which links a point to the
+// forecast products of its gridpoint
+func (s *server) lookupPoint(ctx context.Context, lat, lon string) (PointResponse, int, error) {
+	var pointData PointResponse
+	pointsURL := fmt.Sprintf("%s/points/%s,%s", s.state.Config().NWSAPIHost, lat, lon)
+	var pointResp []byte
+	var statusCode int
+	var err error
+	if key, ok := pointCacheKey(lat, lon); ok {
+		// NWS redirects points with more than four decimals to the rounded
+		// point, so that's asked for in the first place
+		pointsURL = s.state.Config().NWSAPIHost + "/" + key
+		pointResp, statusCode, err = s.cachedNWSRequest(ctx, key, pointsURL, pointCacheTTLFor(s.state.Config().NWSCacheTTL))
+	} else {
+		pointResp, _, statusCode, err = s.makeNWSRequest(ctx, pointsURL)
 	}
-
-	firstPeriod := forecastData.Properties.Periods[0]
-
-	// Step 5: Map temperature to cold/moderate/hot
-	tempCategory := mapTemperature(firstPeriod.Temperature)
-
-	// Step 6: Build and return the response
-	output := ForecastOutput{
-		Forecast:    firstPeriod.ShortForecast,
-		Temperature: tempCategory,
+	if err != nil {
+		return pointData, statusCode, err
 	}
+	if err := json.Unmarshal(pointResp, &pointData); err != nil {
+		return pointData, http.StatusInternalServerError, fmt.Errorf("Failed to parse points response")
+	}
+	return pointData, http.StatusOK, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(output)
+// makeNWSRequest makes an HTTP request to the NWS API with the required
+// User-Agent header, returning the response headers with the body so callers
+// can tell how long it may be cached. Network errors and transient 5xx
+// responses are retried with backoff as configured. A 429 is retried once its
+// Retry-After has passed, if that's within FORECAST_NWS_RATE_WAIT, and is
+// otherwise reported as a 503. Waiting stops when ctx is done.
+func (s *server) makeNWSRequest(ctx context.Context, url string) ([]byte, http.Header, int, error) {
+	cfg := s.state.Config()
+	for n := 1; ; n++ {
+		body, header, statusCode, err := s.makeNWSAttempt(ctx, url)
+		throttled := statusCode == http.StatusTooManyRequests
+		if throttled {
+			statusCode, err = http.StatusServiceUnavailable, errNWSThrottled
+		}
+		transient := throttled || err != nil && !errors.Is(err, errNWSRateLimited) && (header == nil || retryableStatus(statusCode))
+		if !transient || n >= cfg.NWSRetryAttempts || ctx.Err() != nil {
+			return body, header, statusCode, err
+		}
+		nwsRetries.Add(1)
+		if !throttled {
+			// After a 429 the next attempt waits out the pause in waitForNWS
+			select {
+			case <-s.clock.After(retryDelay(n, cfg.NWSRetryBaseDelay, cfg.NWSRetryMaxDelay, cfg.NWSRetryJitter)):
+			case <-ctx.Done():
+				return body, header, statusCode, err
+			}
+		}
+	}
 }
 
-// makeNWSRequest makes an HTTP request to the NWS API with the required User-Agent header
-func makeNWSRequest(url string) ([]byte, int, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// makeNWSAttempt sends one request of makeNWSRequest. The headers are nil
+// when no response was received.
+func (s *server) makeNWSAttempt(ctx context.Context, url string) ([]byte, http.Header, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, http.StatusInternalServerError, fmt.Errorf("failed to create request: %v", err)
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.doNWS(req)
+	if errors.Is(err, errNWSRateLimited) {
+		return nil, nil, http.StatusServiceUnavailable, err
+	}
 	if err != nil {
-		return nil, http.StatusInternalServerError, fmt.Errorf("failed to make request: %v", err)
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// If the status is not 2xx, return the status code
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, resp.StatusCode, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, resp.Header, resp.StatusCode, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, http.StatusInternalServerError, fmt.Errorf("failed to read response: %v", err)
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	return body, resp.StatusCode, nil
-}
-
-// mapTemperature maps a temperature value to cold/moderate/hot
-func mapTemperature(temp int) string {
-	if temp <= 30 {
-		return "cold"
-	}
-	if temp >= 80 {
-		return "hot"
-	}
-	return "moderate"
+	return body, resp.Header, resp.StatusCode, nil
 }
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestForecastHandler tests the forecast endpoint with mocked NWS API
@@ -174,10 +179,8 @@ func TestForecastHandler(t *testing.T) {
 			mockNWS := createMockNWSServer(tt.pointsStatusCode, tt.forecastStatusCode, tt.forecastResponse)
 			defer mockNWS.Close()
 
-			// Override nwsAPIHost for testing
-			originalHost := nwsAPIHost
-			nwsAPIHost = mockNWS.URL
-			defer func() { nwsAPIHost = originalHost }()
+			// Point the server at the mock NWS API
+			srv := newServer(Config{NWSAPIHost: mockNWS.URL})
 
 			// Create test request
 			url := fmt.Sprintf("/forecast?latitude=%s&longitude=%s", tt.latitude, tt.longitude)
@@ -185,7 +188,7 @@ func TestForecastHandler(t *testing.T) {
 			w := httptest.NewRecorder()
 
 			// Execute handler
-			forecastHandler(w, req)
+			srv.forecastHandler(w, req)
 
 			// Check status code
 			if w.Code != tt.expectedStatus {
@@ -240,7 +243,7 @@ func TestForecastHandlerMissingParameters(t *testing.T) {
 			req := httptest.NewRequest("GET", tt.url, nil)
 			w := httptest.NewRecorder()
 
-			forecastHandler(w, req)
+			newServer(defaultConfig()).forecastHandler(w, req)
 
 			if w.Code != tt.expectedStatus {
 				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
@@ -258,7 +261,7 @@ func TestForecastHandlerInvalidMethod(t *testing.T) {
 			req := httptest.NewRequest(method, "/forecast?latitude=47.6062&longitude=-122.3321", nil)
 			w := httptest.NewRecorder()
 
-			forecastHandler(w, req)
+			newServer(defaultConfig()).forecastHandler(w, req)
 
 			if w.Code != http.StatusMethodNotAllowed {
 				t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
@@ -267,6 +270,194 @@ func TestForecastHandlerInvalidMethod(t *testing.T) {
 	}
 }
 
+// TestForecastHandlerPeriodSelection tests reporting the period covering the
+// current time rather than the first one listed
+func TestForecastHandlerPeriodSelection(t *testing.T) {
+	forecast := `{
+		"properties": {
+			"periods": [
+				{"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "shortForecast": "Sunny", "temperature": 80},
+				{"startTime": "2024-06-01T18:00:00-07:00", "endTime": "2024-06-02T06:00:00-07:00", "shortForecast": "Clear", "temperature": 55},
+				{"startTime": "2024-06-02T08:00:00-07:00", "endTime": "2024-06-02T18:00:00-07:00", "shortForecast": "Rain", "temperature": 60}
+			]
+		}
+	}`
+	tests := []struct {
+		name             string
+		now              time.Time
+		query            string
+		expectedStatus   int
+		expectedForecast string
+	}{
+		{name: "covering period", now: time.Date(2024, 6, 2, 4, 0, 0, 0, time.UTC), expectedStatus: 200, expectedForecast: "Clear"},
+		{name: "first period requested", now: time.Date(2024, 6, 2, 4, 0, 0, 0, time.UTC), query: "&period=first", expectedStatus: 200, expectedForecast: "Sunny"},
+		{name: "between periods", now: time.Date(2024, 6, 2, 14, 30, 0, 0, time.UTC), query: "&period=current", expectedStatus: 200, expectedForecast: "Rain"},
+		{name: "stale forecast", now: time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC), expectedStatus: 200, expectedForecast: "Sunny"},
+		{name: "invalid period", now: time.Date(2024, 6, 2, 4, 0, 0, 0, time.UTC), query: "&period=last", expectedStatus: 400},
+	}
+
+	mockNWS := createMockNWSServer(200, 200, forecast)
+	defer mockNWS.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+			srv.clock = newFakeClock(tt.now)
+			req := httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321"+tt.query, nil)
+			w := httptest.NewRecorder()
+			srv.forecastHandler(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != 200 {
+				return
+			}
+			var response ForecastOutput
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Forecast != tt.expectedForecast {
+				t.Errorf("expected forecast %q, got %q", tt.expectedForecast, response.Forecast)
+			}
+		})
+	}
+}
+
+// TestForecastHandlerDetail tests returning the detailed forecast only when
+// it's asked for
+func TestForecastHandlerDetail(t *testing.T) {
+	detail := "Sunny, with a high near 80. Light north wind."
+	mockNWS := createMockNWSServer(200, 200, `{"properties": {"periods": [{"temperature": 80, "shortForecast": "Sunny", "detailedForecast": "`+detail+`"}]}}`)
+	defer mockNWS.Close()
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedDetail string
+	}{
+		{name: "default", expectedStatus: 200},
+		{name: "detail", query: "&detail=true", expectedStatus: 200, expectedDetail: detail},
+		{name: "no detail", query: "&detail=false", expectedStatus: 200},
+		{name: "invalid detail", query: "&detail=full", expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+			w := httptest.NewRecorder()
+			srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != 200 {
+				return
+			}
+			var response ForecastOutput
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.DetailedForecast != tt.expectedDetail {
+				t.Errorf("expected detail %q, got %q", tt.expectedDetail, response.DetailedForecast)
+			}
+		})
+	}
+}
+
+// TestForecastHandlerUnits tests converting the units of forecast text
+func TestForecastHandlerUnits(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 64, "shortForecast": "Sunny", "detailedForecast": "Sunny, with a high near 64. West wind 10 mph."}]}}`})
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedDetail string
+	}{
+		{name: "default", query: "&detail=true", expectedStatus: 200, expectedDetail: "Sunny, with a high near 64. West wind 10 mph."},
+		{name: "us", query: "&detail=true&units=us", expectedStatus: 200, expectedDetail: "Sunny, with a high near 64. West wind 10 mph."},
+		{name: "imperial", query: "&detail=true&units=imperial", expectedStatus: 200, expectedDetail: "Sunny, with a high near 64. West wind 10 mph."},
+		{name: "metric", query: "&detail=true&units=metric", expectedStatus: 200, expectedDetail: "Sunny, with a high near 18°C. West wind 16 km/h."},
+		{name: "invalid units", query: "&units=si", expectedStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != 200 {
+				return
+			}
+			var response ForecastOutput
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.DetailedForecast != tt.expectedDetail {
+				t.Errorf("expected detail %q, got %q", tt.expectedDetail, response.DetailedForecast)
+			}
+		})
+	}
+}
+
+// TestForecastHandlerSIUnits tests asking NWS for its metric forecast text,
+// which is served as written
+func TestForecastHandlerSIUnits(t *testing.T) {
+	us := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 64, "temperatureUnit": "F", "shortForecast": "Sunny", "detailedForecast": "Sunny, with a high near 64. West wind 10 mph."}]}}`})
+	si := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 18, "temperatureUnit": "C", "windSpeed": "16 km/h", "shortForecast": "Sunny", "detailedForecast": "Sunny, with a high near 18. West wind 16 km/h."}]}}`})
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = doerFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("units") == "si" {
+			return si.Do(req)
+		}
+		return us.Do(req)
+	})
+
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321&detail=true&units=metric", nil))
+	var response ForecastOutput
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(si.paths()) != 1 || len(us.paths()) != 1 {
+		t.Errorf("expected the forecast to be fetched with units=si, got %v and %v", si.paths(), us.paths())
+	}
+	if response.DetailedForecast != "Sunny, with a high near 18. West wind 16 km/h." {
+		t.Errorf("expected NWS's metric text, got %q", response.DetailedForecast)
+	}
+	if response.Temperature != "moderate" || response.Wind != "breezy" {
+		t.Errorf("expected the categories of the converted values, got %q and %q", response.Temperature, response.Wind)
+	}
+}
+
+// TestForecastHandlerSIUnitsQuery tests asking for metric units of a forecast
+// URL that already has a query, which keeps it
+func TestForecastHandlerSIUnitsQuery(t *testing.T) {
+	nws := newFakeDoer(map[string]fakeResponse{
+		"/points/":                        {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast?units=us&featureFlags=forecast_temperature_qv"}}`},
+		"/gridpoints/SEW/124,67/forecast": {body: `{"properties": {"periods": [{"temperature": 18, "temperatureUnit": "C", "shortForecast": "Sunny"}]}}`},
+	})
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = nws
+
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321&units=metric", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var forecast *url.URL
+	for _, req := range nws.requests {
+		if strings.HasPrefix(req.URL.Path, "/gridpoints/") {
+			forecast = req.URL
+		}
+	}
+	if forecast == nil {
+		t.Fatal("expected the forecast to be fetched")
+	}
+	if q := forecast.Query(); q.Get("units") != "si" || len(q["units"]) != 1 || q.Get("featureFlags") != "forecast_temperature_qv" {
+		t.Errorf("expected units=si alongside the other parameters, got %s", forecast.RawQuery)
+	}
+}
+
 // TestMapTemperature tests the temperature mapping function
 func TestMapTemperature(t *testing.T) {
 	tests := []struct {
@@ -284,9 +475,10 @@ func TestMapTemperature(t *testing.T) {
 		{temperature: 120, expected: "hot"},
 	}
 
+	srv := newServer(defaultConfig())
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("temp_%d", tt.temperature), func(t *testing.T) {
-			result := mapTemperature(tt.temperature)
+			result := srv.mapTemperature(tt.temperature)
 			if result != tt.expected {
 				t.Errorf("mapTemperature(%d) = %q, expected %q", tt.temperature, result, tt.expected)
 			}
@@ -294,6 +486,20 @@ func TestMapTemperature(t *testing.T) {
 	}
 }
 
+// TestMapTemperatureConfigured tests categorizing temperatures by a configured
+// scale
+func TestMapTemperatureConfigured(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TemperatureCategories = "frigid:10, cold:50, mild:75, warm:95, hot"
+	srv := newServer(cfg)
+	tests := map[int]string{0: "frigid", 10: "frigid", 11: "cold", 60: "mild", 85: "warm", 96: "hot"}
+	for temp, expected := range tests {
+		if got := srv.mapTemperature(temp); got != expected {
+			t.Errorf("mapTemperature(%d) = %q, expected %q", temp, got, expected)
+		}
+	}
+}
+
 // createMockNWSServer creates a mock NWS API server for testing
 func createMockNWSServer(pointsStatus int, forecastStatus int, forecastResp string) *httptest.Server {
 	handler := http.NewServeMux()
@@ -329,3 +535,59 @@ func createMockNWSServer(pointsStatus int, forecastStatus int, forecastResp stri
 	server = httptest.NewServer(handler)
 	return server
 }
+
+// TestReload tests that a reload replaces the configuration and data files
+// only when every file can be read
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	zips := filepath.Join(dir, "zips.csv")
+	if err := os.WriteFile(zips, []byte("zip,latitude,longitude\n98101,47.6114,-122.3305\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(defaultConfig())
+
+	t.Setenv("FORECAST_ZIP_FILE", zips)
+	t.Setenv("FORECAST_FIPS_FILE", filepath.Join(dir, "missing.csv"))
+	if err := srv.reload(); err == nil {
+		t.Fatal("expected the missing FIPS file to fail the reload")
+	}
+	if srv.zipCentroids() != nil || srv.state.Config().ZIPFile != "" {
+		t.Errorf("expected nothing replaced by the failed reload, got %v", srv.zipCentroids())
+	}
+
+	t.Setenv("FORECAST_FIPS_FILE", "")
+	if err := srv.reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := srv.zipCentroids()["98101"]; !ok || srv.state.Config().ZIPFile != zips {
+		t.Errorf("expected the ZIP file to be loaded, got %v", srv.zipCentroids())
+	}
+
+	// Temperature categories are parsed once per reload
+	t.Setenv("FORECAST_TEMPERATURE_CATEGORIES", "cold:50, mild")
+	if err := srv.reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := srv.mapTemperature(60); got != "mild" {
+		t.Errorf("expected the reloaded scale, got %q", got)
+	}
+	t.Setenv("FORECAST_TEMPERATURE_CATEGORIES", "cold:50, mild:40, hot")
+	if err := srv.reload(); err == nil {
+		t.Fatal("expected invalid temperature categories to fail the reload")
+	}
+	if got := srv.mapTemperature(60); got != "mild" {
+		t.Errorf("expected the scale kept after a failed reload, got %q", got)
+	}
+	t.Setenv("FORECAST_TEMPERATURE_CATEGORIES", "")
+	t.Setenv("FORECAST_TEMPERATURE_RULES", "muggy: tempF >=")
+	if err := srv.reload(); err == nil {
+		t.Fatal("expected an invalid temperature rule to fail the reload")
+	}
+	t.Setenv("FORECAST_TEMPERATURE_RULES", "muggy: tempF >= 75")
+	if err := srv.reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := srv.temperatureCategory(weatherPeriod{TemperatureC: 27}); got != "muggy" {
+		t.Errorf("expected the reloaded rule, got %q", got)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations for each dialect, named
+// {version}_{description}.up.sql and {version}_{description}.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is one versioned schema change
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations reads the embedded migrations for a dialect in version order
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := path.Join("migrations", d.name)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		prefix, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no version prefix", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %v", name, err)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationTable creates the table tracking applied migrations
+func (s *sqlStore) ensureMigrationTable(ctx context.Context) error {
+	_, err := s.exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, applied_at BIGINT NOT NULL)`)
+	return err
+}
+
+// appliedMigrations returns the versions already applied to the database
+func (s *sqlStore) appliedMigrations(ctx context.Context) (map[int64]bool, error) {
+	if err := s.ensureMigrationTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migration table: %v", err)
+	}
+	rows, err := s.query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// migrateUp applies every pending migration, each in its own transaction, and
+// returns the versions applied
+func (s *sqlStore) migrateUp(ctx context.Context) ([]int64, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int64
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := s.runMigration(ctx, m.Up,
+			`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, m.Version, time.Now().Unix()); err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// migrateDown reverts the most recently applied migrations, up to steps of them,
+// and returns the versions reverted
+func (s *sqlStore) migrateDown(ctx context.Context, steps int) ([]int64, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int64
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if !applied[m.Version] {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+		if err := s.runMigration(ctx, m.Down,
+			`DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// runMigration executes a migration script and its bookkeeping statement atomically
+func (s *sqlStore) runMigration(ctx context.Context, script, bookkeeping string, args ...any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range strings.Split(script, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.dialect.rebind(bookkeeping), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// openCommandStore opens the store for a subcommand: the -database flag if
+// given, otherwise FORECAST_DATABASE_URL
+func openCommandStore(databaseURL string) (*sqlStore, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if databaseURL != "" {
+		cfg.DatabaseURL = databaseURL
+	}
+	if cfg.DatabaseURL == "" {
+		return nil, fmt.Errorf("no database configured; set FORECAST_DATABASE_URL or pass -database")
+	}
+	return openConfiguredStore(cfg)
+}
+
+// runMigrateCommand implements `forecast migrate [up|down [-steps n]|status]`
+func runMigrateCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fset.SetOutput(out)
+	databaseURL := fset.String("database", "", "database URL (defaults to FORECAST_DATABASE_URL)")
+	steps := fset.Int("steps", 1, "number of migrations to revert with down")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	direction := "up"
+	if fset.NArg() > 0 {
+		direction = fset.Arg(0)
+		// Allow flags after the direction, e.g. `migrate down -steps 2`
+		if err := fset.Parse(fset.Args()[1:]); err != nil {
+			return err
+		}
+	}
+
+	store, err := openCommandStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	switch direction {
+	case "up":
+		done, err := store.migrateUp(ctx)
+		for _, v := range done {
+			fmt.Fprintf(out, "applied %d\n", v)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		done, err := store.migrateDown(ctx, *steps)
+		for _, v := range done {
+			fmt.Fprintf(out, "reverted %d\n", v)
+		}
+		return err
+	case "status":
+		migrations, err := loadMigrations(store.dialect)
+		if err != nil {
+			return err
+		}
+		applied, err := store.appliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status := "pending"
+			if applied[m.Version] {
+				status = "applied"
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", m.Version, m.Name, status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate direction %q (want up, down, or status)", direction)
+	}
+}
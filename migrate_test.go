@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadMigrations tests that every dialect has the same, complete set of migrations
+func TestLoadMigrations(t *testing.T) {
+	sqlite, err := loadMigrations(sqliteDialect)
+	if err != nil {
+		t.Fatalf("failed to load sqlite migrations: %v", err)
+	}
+	postgres, err := loadMigrations(postgresDialect)
+	if err != nil {
+		t.Fatalf("failed to load postgres migrations: %v", err)
+	}
+
+	if len(sqlite) == 0 || len(sqlite) != len(postgres) {
+		t.Fatalf("expected matching migrations, got %d sqlite and %d postgres", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d differs: %d_%s vs %d_%s", i, sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+		if sqlite[i].Down == "" || postgres[i].Down == "" {
+			t.Errorf("migration %d_%s is missing a down script", sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+// TestMigrateUpDown tests applying, re-applying, and reverting migrations
+func TestMigrateUpDown(t *testing.T) {
+	store, err := openStore("sqlite://:memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	migrations, err := loadMigrations(store.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := store.migrateUp(ctx)
+	if err != nil {
+		t.Fatalf("migrate up failed: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("expected %d migrations applied, got %d", len(migrations), len(applied))
+	}
+
+	applied, err = store.migrateUp(ctx)
+	if err != nil {
+		t.Fatalf("second migrate up failed: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected no pending migrations, got %v", applied)
+	}
+
+	reverted, err := store.migrateDown(ctx, len(migrations))
+	if err != nil {
+		t.Fatalf("migrate down failed: %v", err)
+	}
+	if len(reverted) != len(migrations) {
+		t.Errorf("expected %d migrations reverted, got %d", len(migrations), len(reverted))
+	}
+	if _, err := store.ListAudit(ctx, time.Time{}); err == nil {
+		t.Error("expected tables to be dropped")
+	}
+}
+
+// TestMigrateCommand tests the migrate subcommand against a SQLite file
+func TestMigrateCommand(t *testing.T) {
+	databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "forecast.db")
+
+	run := func(args ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runMigrateCommand(append([]string{"-database", databaseURL}, args...), &out); err != nil {
+			t.Fatalf("migrate %v failed: %v", args, err)
+		}
+		return out.String()
+	}
+
+	if out := run("status"); !strings.Contains(out, "0001_init\tpending") {
+		t.Errorf("expected pending status, got %q", out)
+	}
+	if out := run(); !strings.Contains(out, "applied 1") {
+		t.Errorf("expected migration applied, got %q", out)
+	}
+	if out := run("up"); !strings.Contains(out, "no pending migrations") {
+		t.Errorf("expected nothing to apply, got %q", out)
+	}
+	if out := run("down", "-steps", "1"); strings.Count(out, "reverted") != 1 {
+		t.Errorf("expected migration reverted, got %q", out)
+	}
+
+	var out bytes.Buffer
+	if err := runMigrateCommand([]string{"-database", databaseURL, "sideways"}, &out); err == nil {
+		t.Error("expected error for unknown direction")
+	}
+}
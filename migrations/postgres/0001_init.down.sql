@@ -0,0 +1,4 @@
+DROP TABLE audit;
+DROP TABLE usage;
+DROP TABLE history;
+DROP TABLE subscriptions;
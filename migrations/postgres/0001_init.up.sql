@@ -0,0 +1,36 @@
+CREATE TABLE subscriptions (
+    id          BIGSERIAL        PRIMARY KEY,
+    owner       TEXT             NOT NULL,
+    latitude    DOUBLE PRECISION NOT NULL,
+    longitude   DOUBLE PRECISION NOT NULL,
+    webhook_url TEXT             NOT NULL,
+    secret      TEXT             NOT NULL DEFAULT '',
+    created_at  BIGINT           NOT NULL
+);
+CREATE INDEX subscriptions_owner ON subscriptions (owner);
+
+CREATE TABLE history (
+    id          BIGSERIAL        PRIMARY KEY,
+    latitude    DOUBLE PRECISION NOT NULL,
+    longitude   DOUBLE PRECISION NOT NULL,
+    forecast    TEXT             NOT NULL,
+    temperature INTEGER          NOT NULL,
+    recorded_at BIGINT           NOT NULL
+);
+CREATE INDEX history_point ON history (latitude, longitude, recorded_at);
+
+CREATE TABLE usage (
+    api_key  TEXT   NOT NULL,
+    day      BIGINT NOT NULL,
+    requests BIGINT NOT NULL,
+    PRIMARY KEY (api_key, day)
+);
+
+CREATE TABLE audit (
+    id     BIGSERIAL PRIMARY KEY,
+    actor  TEXT      NOT NULL,
+    action TEXT      NOT NULL,
+    detail TEXT      NOT NULL DEFAULT '',
+    at     BIGINT    NOT NULL
+);
+CREATE INDEX audit_at ON audit (at);
@@ -0,0 +1,17 @@
+CREATE TABLE locations (
+    id         BIGSERIAL        PRIMARY KEY,
+    owner      TEXT             NOT NULL,
+    name       TEXT             NOT NULL,
+    latitude   DOUBLE PRECISION NOT NULL,
+    longitude  DOUBLE PRECISION NOT NULL,
+    created_at BIGINT           NOT NULL
+);
+CREATE INDEX locations_owner ON locations (owner);
+
+CREATE TABLE api_keys (
+    id         TEXT   PRIMARY KEY,
+    owner      TEXT   NOT NULL,
+    name       TEXT   NOT NULL DEFAULT '',
+    key        TEXT   NOT NULL,
+    created_at BIGINT NOT NULL
+);
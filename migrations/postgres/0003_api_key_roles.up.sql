@@ -0,0 +1 @@
+ALTER TABLE api_keys ADD COLUMN roles TEXT NOT NULL DEFAULT 'read';
@@ -0,0 +1 @@
+DROP TABLE forecast_snapshots;
@@ -0,0 +1,9 @@
+CREATE TABLE forecast_snapshots (
+    id          BIGSERIAL        PRIMARY KEY,
+    latitude    DOUBLE PRECISION NOT NULL,
+    longitude   DOUBLE PRECISION NOT NULL,
+    product     TEXT             NOT NULL,
+    periods     TEXT             NOT NULL,
+    recorded_at BIGINT           NOT NULL
+);
+CREATE INDEX forecast_snapshots_point ON forecast_snapshots (latitude, longitude, product, recorded_at);
@@ -0,0 +1,11 @@
+CREATE TABLE share_links (
+    token      TEXT             PRIMARY KEY,
+    owner      TEXT             NOT NULL,
+    latitude   DOUBLE PRECISION NOT NULL,
+    longitude  DOUBLE PRECISION NOT NULL,
+    start_time BIGINT,
+    end_time   BIGINT,
+    created_at BIGINT           NOT NULL,
+    expires_at BIGINT           NOT NULL
+);
+CREATE INDEX share_links_expires ON share_links (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT    NOT NULL,
+    event           TEXT      NOT NULL,
+    content_type    TEXT      NOT NULL,
+    body            BYTEA     NOT NULL,
+    delivered       BOOLEAN   NOT NULL,
+    error           TEXT      NOT NULL DEFAULT '',
+    replay_of       BIGINT,
+    sent_at         BIGINT    NOT NULL
+);
+CREATE INDEX deliveries_subscription ON deliveries (subscription_id, sent_at);
@@ -0,0 +1,6 @@
+ALTER TABLE deliveries DROP COLUMN digest_id;
+ALTER TABLE deliveries DROP COLUMN held;
+ALTER TABLE subscriptions DROP COLUMN max_per_day;
+ALTER TABLE subscriptions DROP COLUMN time_zone;
+ALTER TABLE subscriptions DROP COLUMN quiet_end;
+ALTER TABLE subscriptions DROP COLUMN quiet_start;
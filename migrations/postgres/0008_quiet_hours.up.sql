@@ -0,0 +1,6 @@
+ALTER TABLE subscriptions ADD COLUMN quiet_start TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN quiet_end TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN max_per_day INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE deliveries ADD COLUMN held BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE deliveries ADD COLUMN digest_id BIGINT;
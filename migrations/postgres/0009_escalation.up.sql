@@ -0,0 +1 @@
+ALTER TABLE subscriptions ADD COLUMN escalation TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    id         BIGSERIAL PRIMARY KEY,
+    owner      TEXT      NOT NULL,
+    secret     TEXT      NOT NULL,
+    created_at BIGINT    NOT NULL,
+    expires_at BIGINT,
+    revoked_at BIGINT
+);
+CREATE INDEX signing_keys_owner ON signing_keys (owner);
@@ -0,0 +1,36 @@
+CREATE TABLE subscriptions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner       TEXT    NOT NULL,
+    latitude    REAL    NOT NULL,
+    longitude   REAL    NOT NULL,
+    webhook_url TEXT    NOT NULL,
+    secret      TEXT    NOT NULL DEFAULT '',
+    created_at  INTEGER NOT NULL
+);
+CREATE INDEX subscriptions_owner ON subscriptions (owner);
+
+CREATE TABLE history (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    latitude    REAL    NOT NULL,
+    longitude   REAL    NOT NULL,
+    forecast    TEXT    NOT NULL,
+    temperature INTEGER NOT NULL,
+    recorded_at INTEGER NOT NULL
+);
+CREATE INDEX history_point ON history (latitude, longitude, recorded_at);
+
+CREATE TABLE usage (
+    api_key  TEXT    NOT NULL,
+    day      INTEGER NOT NULL,
+    requests INTEGER NOT NULL,
+    PRIMARY KEY (api_key, day)
+);
+
+CREATE TABLE audit (
+    id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor  TEXT    NOT NULL,
+    action TEXT    NOT NULL,
+    detail TEXT    NOT NULL DEFAULT '',
+    at     INTEGER NOT NULL
+);
+CREATE INDEX audit_at ON audit (at);
@@ -0,0 +1,17 @@
+CREATE TABLE locations (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner      TEXT    NOT NULL,
+    name       TEXT    NOT NULL,
+    latitude   REAL    NOT NULL,
+    longitude  REAL    NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX locations_owner ON locations (owner);
+
+CREATE TABLE api_keys (
+    id         TEXT    PRIMARY KEY,
+    owner      TEXT    NOT NULL,
+    name       TEXT    NOT NULL DEFAULT '',
+    key        TEXT    NOT NULL,
+    created_at INTEGER NOT NULL
+);
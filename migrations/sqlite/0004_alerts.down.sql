@@ -0,0 +1,2 @@
+DROP TABLE alert_zones;
+DROP TABLE alerts;
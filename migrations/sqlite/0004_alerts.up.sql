@@ -0,0 +1,18 @@
+CREATE TABLE alerts (
+    id        TEXT    PRIMARY KEY,
+    event     TEXT    NOT NULL,
+    severity  TEXT    NOT NULL DEFAULT '',
+    headline  TEXT    NOT NULL DEFAULT '',
+    area_desc TEXT    NOT NULL DEFAULT '',
+    sent      INTEGER NOT NULL,
+    onset     INTEGER NOT NULL,
+    ends      INTEGER NOT NULL
+);
+CREATE INDEX alerts_sent ON alerts (sent, id);
+
+CREATE TABLE alert_zones (
+    alert_id TEXT NOT NULL,
+    zone     TEXT NOT NULL,
+    PRIMARY KEY (alert_id, zone)
+);
+CREATE INDEX alert_zones_zone ON alert_zones (zone);
@@ -0,0 +1,9 @@
+CREATE TABLE forecast_snapshots (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    latitude    REAL    NOT NULL,
+    longitude   REAL    NOT NULL,
+    product     TEXT    NOT NULL,
+    periods     TEXT    NOT NULL,
+    recorded_at INTEGER NOT NULL
+);
+CREATE INDEX forecast_snapshots_point ON forecast_snapshots (latitude, longitude, product, recorded_at);
@@ -0,0 +1,11 @@
+CREATE TABLE share_links (
+    token      TEXT    PRIMARY KEY,
+    owner      TEXT    NOT NULL,
+    latitude   REAL    NOT NULL,
+    longitude  REAL    NOT NULL,
+    start_time INTEGER,
+    end_time   INTEGER,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+CREATE INDEX share_links_expires ON share_links (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE deliveries (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,
+    event           TEXT    NOT NULL,
+    content_type    TEXT    NOT NULL,
+    body            BLOB    NOT NULL,
+    delivered       INTEGER NOT NULL,
+    error           TEXT    NOT NULL DEFAULT '',
+    replay_of       INTEGER,
+    sent_at         INTEGER NOT NULL
+);
+CREATE INDEX deliveries_subscription ON deliveries (subscription_id, sent_at);
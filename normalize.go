@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Normalized weather data uses canonical units regardless of provider:
+// temperatures in °C, speeds in km/h, and probabilities in percent. Each
+// provider has a normalizer translating its responses, so data from different
+// providers can be compared and combined.
+
+// weatherPeriod is a forecast period in canonical units
+type weatherPeriod struct {
+	// Name is the provider's name for the period, such as "Tonight", empty
+	// for hourly periods
+	Name      string
+	Start     time.Time
+	End       time.Time
+	IsDaytime bool
+	// TemperatureC is the forecast temperature in °C
+	TemperatureC float64
+	// WindSpeedKPH is the highest sustained wind speed in km/h, nil if unknown
+	WindSpeedKPH  *float64
+	WindDirection string
+	// PrecipitationProbability is the chance of precipitation in percent, nil if unknown
+	PrecipitationProbability *int
+	// PrecipitationInterpolated is set when the probability was filled in by
+	// fillPrecipitationGaps rather than reported by the provider
+	PrecipitationInterpolated bool
+	Condition                 condition
+	// Summary is the provider's short description, such as "Partly Sunny"
+	Summary string
+	// Detail is the provider's full prose forecast, often several sentences
+	Detail string
+	// TextUnits is the unit system Summary and Detail are written in
+	TextUnits string
+	// GridElevationM is the elevation of the forecast's grid cell in meters,
+	// nil if unknown
+	GridElevationM *float64
+}
+
+// normalizer converts a provider's forecast response into canonical periods
+type normalizer interface {
+	normalize(body []byte) ([]weatherPeriod, error)
+}
+
+// Unit conversions between provider and canonical units
+func fahrenheitToCelsius(f float64) float64 { return (f - 32) * 5 / 9 }
+func celsiusToFahrenheit(c float64) float64 { return c*9/5 + 32 }
+func mphToKPH(mph float64) float64          { return mph * 1.609344 }
+func kphToMPH(kph float64) float64          { return kph / 1.609344 }
+func inchesToCM(in float64) float64         { return in * 2.54 }
+
+// roundInt rounds a converted value to the nearest whole unit
+func roundInt(v float64) int {
+	return int(math.Round(v))
+}
+
+// nwsNormalizer normalizes responses of the NWS forecast endpoints, which
+// report US customary units by default and SI units when requested with
+// ?units=si
+type nwsNormalizer struct{}
+
+// nwsPeriod is a period of an NWS forecast response
+type nwsPeriod struct {
+	Name                       string    `json:"name"`
+	StartTime                  time.Time `json:"startTime"`
+	EndTime                    time.Time `json:"endTime"`
+	IsDaytime                  bool      `json:"isDaytime"`
+	ShortForecast              string    `json:"shortForecast"`
+	DetailedForecast           string    `json:"detailedForecast"`
+	Temperature                float64   `json:"temperature"`
+	TemperatureUnit            string    `json:"temperatureUnit"`
+	WindSpeed                  string    `json:"windSpeed"`
+	WindDirection              string    `json:"windDirection"`
+	Icon                       string    `json:"icon"`
+	ProbabilityOfPrecipitation struct {
+		Value *int `json:"value"`
+	} `json:"probabilityOfPrecipitation"`
+}
+
+func (nwsNormalizer) normalize(body []byte) ([]weatherPeriod, error) {
+	var resp struct {
+		Properties struct {
+			Elevation *struct {
+				UnitCode string   `json:"unitCode"`
+				Value    *float64 `json:"value"`
+			} `json:"elevation"`
+			Periods []nwsPeriod `json:"periods"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	var elevationM *float64
+	if e := resp.Properties.Elevation; e != nil && e.Value != nil {
+		m := *e.Value
+		if e.UnitCode == "wmoUnit:ft" {
+			m *= metersPerFoot
+		}
+		elevationM = &m
+	}
+	periods := make([]weatherPeriod, 0, len(resp.Properties.Periods))
+	for _, p := range resp.Properties.Periods {
+		wp := weatherPeriod{
+			Name:                     p.Name,
+			Start:                    p.StartTime,
+			End:                      p.EndTime,
+			IsDaytime:                p.IsDaytime,
+			TemperatureC:             p.Temperature,
+			WindDirection:            p.WindDirection,
+			PrecipitationProbability: p.ProbabilityOfPrecipitation.Value,
+			Condition:                nwsCondition(p.ShortForecast, p.Icon),
+			Summary:                  p.ShortForecast,
+			Detail:                   p.DetailedForecast,
+			GridElevationM:           elevationM,
+		}
+		switch p.TemperatureUnit {
+		case "F", "":
+			wp.TemperatureC = fahrenheitToCelsius(p.Temperature)
+			wp.TextUnits = unitsUS
+		case "C":
+			wp.TextUnits = unitsMetric
+		default:
+			return nil, fmt.Errorf("unknown temperature unit %q", p.TemperatureUnit)
+		}
+		if kph, ok := parseSpeedKPH(p.WindSpeed); ok {
+			wp.WindSpeedKPH = &kph
+		}
+		periods = append(periods, wp)
+	}
+	return periods, nil
+}
+
+// parseSpeedKPH reads the highest speed from an NWS wind speed such as
+// "5 to 10 mph" or "15 km/h", in km/h
+func parseSpeedKPH(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	unit := fields[len(fields)-1]
+	if unit != "mph" && unit != "km/h" {
+		return 0, false
+	}
+	highest, found := 0.0, false
+	for _, f := range fields[:len(fields)-1] {
+		if n, err := strconv.ParseFloat(f, 64); err == nil {
+			highest, found = max(highest, n), true
+		}
+	}
+	if unit == "mph" {
+		highest = mphToKPH(highest)
+	}
+	return highest, found
+}
+
+// Ways to fill missing probabilities of precipitation, set by FORECAST_POP_GAP_FILL
+const (
+	gapFillOff    = "off"
+	gapFillLinear = "linear"
+	gapFillCarry  = "carry"
+)
+
+// fillPrecipitationGaps fills in missing probabilities of precipitation so a
+// series is complete, marking the values it adds. With gapFillLinear, gaps are
+// interpolated between the reported values on either side; with gapFillCarry,
+// the last reported value is carried forward. Leading gaps take the first
+// reported value and trailing gaps the last. A series without any reported
+// value is left alone.
+func fillPrecipitationGaps(periods []weatherPeriod, mode string) {
+	if mode != gapFillLinear && mode != gapFillCarry {
+		return
+	}
+	prev := -1
+	for i := 0; i <= len(periods); i++ {
+		if i < len(periods) && periods[i].PrecipitationProbability == nil {
+			continue
+		}
+		// periods[prev+1:i] is a gap between reported values at prev and i
+		for j := prev + 1; j < i; j++ {
+			var v int
+			switch {
+			case prev < 0 && i == len(periods):
+				return
+			case prev < 0:
+				v = *periods[i].PrecipitationProbability
+			case i == len(periods) || mode == gapFillCarry:
+				v = *periods[prev].PrecipitationProbability
+			default:
+				a, b := *periods[prev].PrecipitationProbability, *periods[i].PrecipitationProbability
+				v = roundInt(float64(a) + float64(b-a)*float64(j-prev)/float64(i-prev))
+			}
+			periods[j].PrecipitationProbability = &v
+			periods[j].PrecipitationInterpolated = true
+		}
+		prev = i
+	}
+}
+
+// Unit systems of the units parameter, which selects the units of forecast
+// text. Numeric fields are always in canonical units. imperial is a synonym
+// of us.
+const (
+	unitsUS       = "us"
+	unitsImperial = "imperial"
+	unitsMetric   = "metric"
+)
+
+// Patterns of the US customary quantities in NWS forecast text. Temperatures
+// carry no unit there, so only the phrasings that introduce one are matched.
+var (
+	speedText       = regexp.MustCompile(`\b(\d+(?:\.\d+)?)( to (\d+(?:\.\d+)?))? mph\b`)
+	lengthText      = regexp.MustCompile(`\b(\d+(?:\.\d+)?)( to (\d+(?:\.\d+)?))? inch(?:es)?\b`)
+	temperatureText = regexp.MustCompile(`(?i)\b((?:high|low|temperatures? (?:falling|rising) to) (?:near|around)|(?:wind chill|heat index) values as (?:low|high) as) (-?\d+)\b`)
+	fahrenheitText  = regexp.MustCompile(`(-?\d+) ?°F`)
+)
+
+// replaceQuantities converts the numbers of each match of re in text: groups
+// 1 and 3 hold a value or the ends of a range, and unit replaces the rest.
+// Values are rounded to whole units unless that would round them to zero.
+func replaceQuantities(re *regexp.Regexp, text string, convert func(float64) float64, unit string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		format := func(s string) string {
+			v, _ := strconv.ParseFloat(s, 64)
+			if v = convert(v); v > 0 && v < 0.5 {
+				return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+			}
+			return strconv.Itoa(roundInt(v))
+		}
+		out := format(m[1])
+		if m[3] != "" {
+			out += " to " + format(m[3])
+		}
+		return out + " " + unit
+	})
+}
+
+// metricText converts the US customary units of NWS forecast text to metric,
+// so "Southwest wind 5 to 10 mph, with a high near 64" becomes "Southwest
+// wind 8 to 16 km/h, with a high near 18°C"
+func metricText(text string) string {
+	text = replaceQuantities(speedText, text, mphToKPH, "km/h")
+	text = replaceQuantities(lengthText, text, inchesToCM, "cm")
+	text = temperatureText.ReplaceAllStringFunc(text, func(match string) string {
+		m := temperatureText.FindStringSubmatch(match)
+		f, _ := strconv.ParseFloat(m[2], 64)
+		return fmt.Sprintf("%s %d°C", m[1], roundInt(fahrenheitToCelsius(f)))
+	})
+	return fahrenheitText.ReplaceAllStringFunc(text, func(match string) string {
+		f, _ := strconv.ParseFloat(fahrenheitText.FindStringSubmatch(match)[1], 64)
+		return fmt.Sprintf("%d°C", roundInt(fahrenheitToCelsius(f)))
+	})
+}
+
+// localizeUnits converts texts written in the units from in place into the
+// units asked for
+func localizeUnits(units, from string, texts ...*string) {
+	if units != unitsMetric || from == unitsMetric {
+		return
+	}
+	for _, text := range texts {
+		*text = metricText(*text)
+	}
+}
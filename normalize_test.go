@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestUnitConversions tests round trips between provider and canonical units
+func TestUnitConversions(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{name: "freezing", got: fahrenheitToCelsius(32), expected: 0},
+		{name: "boiling", got: fahrenheitToCelsius(212), expected: 100},
+		{name: "-40 is the same in both", got: celsiusToFahrenheit(-40), expected: -40},
+		{name: "body temperature", got: celsiusToFahrenheit(37), expected: 98.6},
+		{name: "mph to km/h", got: mphToKPH(10), expected: 16.09344},
+		{name: "km/h to mph", got: kphToMPH(100), expected: 62.137119},
+		{name: "temperature round trip", got: celsiusToFahrenheit(fahrenheitToCelsius(72)), expected: 72},
+		{name: "speed round trip", got: kphToMPH(mphToKPH(15)), expected: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.expected) > 1e-6 {
+				t.Errorf("expected %v, got %v", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+// TestNWSNormalizer tests that US customary and SI responses normalize alike
+func TestNWSNormalizer(t *testing.T) {
+	customary := `{"properties": {"elevation": {"unitCode": "wmoUnit:ft", "value": 328.084}, "periods": [{
+		"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true,
+		"shortForecast": "Chance Rain Showers", "temperature": 50, "temperatureUnit": "F",
+		"windSpeed": "5 to 10 mph", "windDirection": "SW", "probabilityOfPrecipitation": {"value": 40}
+	}]}}`
+	si := `{"properties": {"elevation": {"unitCode": "wmoUnit:m", "value": 100}, "periods": [{
+		"startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true,
+		"shortForecast": "Chance Rain Showers", "temperature": 10, "temperatureUnit": "C",
+		"windSpeed": "8 to 16.09344 km/h", "windDirection": "SW", "probabilityOfPrecipitation": {"value": 40}
+	}]}}`
+
+	for name, body := range map[string]string{"customary": customary, "si": si} {
+		t.Run(name, func(t *testing.T) {
+			periods, err := nwsNormalizer{}.normalize([]byte(body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(periods) != 1 {
+				t.Fatalf("expected 1 period, got %d", len(periods))
+			}
+			p := periods[0]
+			if math.Abs(p.TemperatureC-10) > 1e-9 {
+				t.Errorf("expected 10°C, got %v", p.TemperatureC)
+			}
+			if p.WindSpeedKPH == nil || math.Abs(*p.WindSpeedKPH-16.09344) > 1e-9 {
+				t.Errorf("expected 16.09344 km/h, got %v", p.WindSpeedKPH)
+			}
+			if p.PrecipitationProbability == nil || *p.PrecipitationProbability != 40 {
+				t.Errorf("expected 40%%, got %v", p.PrecipitationProbability)
+			}
+			if p.Condition != conditionShowers || p.Summary != "Chance Rain Showers" || p.WindDirection != "SW" || !p.IsDaytime {
+				t.Errorf("unexpected period %+v", p)
+			}
+			if p.GridElevationM == nil || math.Abs(*p.GridElevationM-100) > 1e-3 {
+				t.Errorf("expected a 100 m grid cell, got %v", p.GridElevationM)
+			}
+			if p.End.Sub(p.Start) != 12*time.Hour {
+				t.Errorf("expected a 12 hour period, got %v", p.End.Sub(p.Start))
+			}
+		})
+	}
+
+	if _, err := (nwsNormalizer{}).normalize([]byte(`{"properties": {"periods": [{"temperature": 10, "temperatureUnit": "K"}]}}`)); err == nil {
+		t.Error("expected unknown unit to be rejected")
+	}
+	periods, err := nwsNormalizer{}.normalize([]byte(`{"properties": {"periods": [{"temperature": 60, "windSpeed": ""}]}}`))
+	if err != nil || periods[0].WindSpeedKPH != nil || periods[0].PrecipitationProbability != nil || periods[0].GridElevationM != nil {
+		t.Errorf("expected missing values to stay unknown, got %+v (%v)", periods, err)
+	}
+}
+
+// TestFillPrecipitationGaps tests each gap filling mode
+func TestFillPrecipitationGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		input    []int
+		expected []int
+	}{
+		{name: "linear", mode: gapFillLinear, input: []int{10, -1, -1, 40}, expected: []int{10, 20, 30, 40}},
+		{name: "linear rounds", mode: gapFillLinear, input: []int{0, -1, -1, 10}, expected: []int{0, 3, 7, 10}},
+		{name: "carry", mode: gapFillCarry, input: []int{10, -1, -1, 40}, expected: []int{10, 10, 10, 40}},
+		{name: "edges hold the nearest value", mode: gapFillLinear, input: []int{-1, 30, -1, 50, -1}, expected: []int{30, 30, 40, 50, 50}},
+		{name: "off", mode: gapFillOff, input: []int{10, -1, 40}, expected: []int{10, -1, 40}},
+		{name: "nothing reported", mode: gapFillLinear, input: []int{-1, -1}, expected: []int{-1, -1}},
+		{name: "complete", mode: gapFillLinear, input: []int{5, 6}, expected: []int{5, 6}},
+		{name: "empty", mode: gapFillLinear},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods := make([]weatherPeriod, len(tt.input))
+			for i, v := range tt.input {
+				if v >= 0 {
+					periods[i].PrecipitationProbability = &v
+				}
+			}
+			fillPrecipitationGaps(periods, tt.mode)
+			for i, p := range periods {
+				got := -1
+				if p.PrecipitationProbability != nil {
+					got = *p.PrecipitationProbability
+				}
+				if got != tt.expected[i] {
+					t.Errorf("period %d: expected %d, got %d", i, tt.expected[i], got)
+				}
+				if p.PrecipitationInterpolated != (tt.input[i] < 0 && got >= 0) {
+					t.Errorf("period %d: unexpected interpolated flag %v", i, p.PrecipitationInterpolated)
+				}
+			}
+		})
+	}
+}
+
+// TestMetricText tests converting the units of NWS forecast text
+func TestMetricText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{
+			text:     "Partly sunny, with a high near 64. Southwest wind 5 to 10 mph, with gusts as high as 20 mph.",
+			expected: "Partly sunny, with a high near 18°C. Southwest wind 8 to 16 km/h, with gusts as high as 32 km/h.",
+		},
+		{
+			text:     "Snow likely. Mostly cloudy, with a low around -4. Wind chill values as low as -15. New snow accumulation of 1 to 3 inches possible.",
+			expected: "Snow likely. Mostly cloudy, with a low around -20°C. Wind chill values as low as -26°C. New snow accumulation of 3 to 8 cm possible.",
+		},
+		{
+			text:     "Rain, mainly after 11pm. Temperatures falling to around 30 by 5am. Chance of precipitation is 80%. Less than 0.1 inch of rain possible.",
+			expected: "Rain, mainly after 11pm. Temperatures falling to around -1°C by 5am. Chance of precipitation is 80%. Less than 0.3 cm of rain possible.",
+		},
+		{text: "Heat index values as high as 105. Feels like 98°F.", expected: "Heat index values as high as 41°C. Feels like 37°C."},
+		{text: "Sunny", expected: "Sunny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := metricText(tt.text); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NWS responses are cached in memory, and in Redis when FORECAST_REDIS_URL is
+// set, so that repeated requests for a location don't each wait on NWS.
+// Responses fetched for requests are kept for as long as NWS's Cache-Control
+// or Expires headers say they're fresh, or FORECAST_NWS_CACHE_TTL when it
+// sends neither, and those warmed by /admin/prewarm for longer. The least
+// recently used responses are evicted when the cache is full.
+const (
+	// pointCacheTTL is how long a point's gridpoint is reused. NWS rarely
+	// redraws its grid.
+	pointCacheTTL = 24 * time.Hour
+	// forecastCacheTTL is how long a prewarmed gridpoint's forecast is
+	// reused. NWS updates forecasts about hourly.
+	forecastCacheTTL = 30 * time.Minute
+	// nwsCacheSize is the number of cached responses when
+	// FORECAST_NWS_CACHE_SIZE isn't set
+	nwsCacheSize = 10000
+)
+
+var (
+	// nwsCacheHits and nwsCacheMisses count lookups of the NWS cache
+	nwsCacheHits   = expvar.NewInt("forecast_nws_cache_hits")
+	nwsCacheMisses = expvar.NewInt("forecast_nws_cache_misses")
+	// nwsCacheEvictions counts responses evicted to make room for others
+	nwsCacheEvictions = expvar.NewInt("forecast_nws_cache_evictions")
+	// nwsCacheStaleHits counts expired responses served while they're
+	// refreshed
+	nwsCacheStaleHits = expvar.NewInt("forecast_nws_cache_stale_hits")
+)
+
+// staleContextKey is the context key of a request's staleMarker
+type staleContextKey struct{}
+
+// staleMarker records that a request was answered from an NWS response served
+// stale. cachedNWSRequest sets it, and withStaleWarning reports it to the
+// client, so every route marks stale responses the same way.
+type staleMarker struct {
+	stale atomic.Bool
+}
+
+// nwsCacheEntry is a cached NWS response body
+type nwsCacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+// nwsCache holds successful NWS responses until they expire, evicting the
+// least recently used when it holds size of them. With a shared cache, such
+// as Redis, responses are also stored there, and local misses are looked up
+// in it, so replicas share what each fetched.
+type nwsCache struct {
+	clock  clock
+	size   int
+	shared *redisClient
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries, most recently used first
+	order *list.List
+}
+
+// newNWSCache returns a cache of up to size responses, or nwsCacheSize when
+// size isn't positive
+func newNWSCache(clk clock, size int) *nwsCache {
+	if size <= 0 {
+		size = nwsCacheSize
+	}
+	return &nwsCache{clock: clk, size: size, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns the unexpired response cached under key, looking in the shared
+// cache when it isn't cached locally
+func (c *nwsCache) get(key string) ([]byte, bool) {
+	body, _, ok := c.lookup(key)
+	return body, ok
+}
+
+// lookup is get that also returns how much longer the response is fresh
+func (c *nwsCache) lookup(key string) ([]byte, time.Duration, bool) {
+	if body, ttl, ok := c.getLocal(key); ok || c.shared == nil {
+		return body, ttl, ok
+	}
+	body, ttl, err := c.shared.get(key)
+	if err != nil {
+		log.Printf("Failed to read %s from the shared cache: %v", key, err)
+	}
+	if body == nil {
+		return nil, 0, false
+	}
+	c.storeLocal(key, body, ttl)
+	return body, ttl, true
+}
+
+func (c *nwsCache) getLocal(key string) ([]byte, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	// Expired entries are kept, to be served stale, until they're replaced or
+	// evicted
+	entry := elem.Value.(*nwsCacheEntry)
+	ttl := entry.expires.Sub(c.clock.Now())
+	if ttl <= 0 {
+		return nil, 0, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.body, ttl, true
+}
+
+// stale returns the response cached locally under key if it expired less than
+// window ago
+func (c *nwsCache) stale(key string, window time.Duration) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*nwsCacheEntry)
+	if now := c.clock.Now(); !now.Before(entry.expires.Add(window)) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.body, true
+}
+
+// snapshot returns the unexpired responses cached locally under keys, read
+// together so that none is replaced while the others are read. Keys that
+// aren't cached are left out.
+func (c *nwsCache) snapshot(keys []string) map[string][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	bodies := map[string][]byte{}
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			if entry := elem.Value.(*nwsCacheEntry); now.Before(entry.expires) {
+				bodies[key] = entry.body
+			}
+		}
+	}
+	return bodies
+}
+
+// store saves a response for ttl, here and in the shared cache
+func (c *nwsCache) store(key string, body []byte, ttl time.Duration) {
+	c.storeLocal(key, body, ttl)
+	if c.shared != nil {
+		if err := c.shared.set(key, body, ttl); err != nil {
+			log.Printf("Failed to write %s to the shared cache: %v", key, err)
+		}
+	}
+}
+
+// storeLocal saves a response for ttl, evicting the least recently used
+// responses when the cache is full
+func (c *nwsCache) storeLocal(key string, body []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &nwsCacheEntry{key: key, body: body, expires: c.clock.Now().Add(ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*nwsCacheEntry).key)
+		nwsCacheEvictions.Add(1)
+	}
+}
+
+// pointCacheKey is the key a point's gridpoint is cached under, rounded to
+// the four decimals NWS resolves points to so that spellings of the same
+// point share an entry. Points that don't parse aren't cached.
+func pointCacheKey(lat, lon string) (string, bool) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return "", false
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return "", false
+	}
+	return "points/" + strconv.FormatFloat(latitude, 'f', 4, 64) + "," + strconv.FormatFloat(longitude, 'f', 4, 64), true
+}
+
+// pointCacheTTLFor returns how long a response NWS rarely changes, such as a
+// point's gridpoint or observation stations, is cached when other responses
+// are cached for ttl
+func pointCacheTTLFor(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	return max(ttl, pointCacheTTL)
+}
+
+// nwsResponseTTL returns how long a response with header may be cached: the
+// s-maxage or max-age of its Cache-Control, less its Age, or else until its
+// Expires, by the clock of its Date when it has one. Responses NWS says not to
+// store or reuse unchecked get 0, and those without either header get ttl.
+// A zero ttl turns caching off whatever the headers say.
+func nwsResponseTTL(header http.Header, now time.Time, ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	if cc := header.Get("Cache-Control"); cc != "" {
+		maxAge, sharedMaxAge := -1, -1
+		for _, directive := range strings.Split(cc, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			switch strings.ToLower(name) {
+			case "no-store", "no-cache", "private":
+				return 0
+			case "max-age":
+				if err == nil {
+					maxAge = seconds
+				}
+			case "s-maxage":
+				if err == nil {
+					sharedMaxAge = seconds
+				}
+			}
+		}
+		// This is a cache shared by every client, so s-maxage takes precedence
+		if sharedMaxAge >= 0 {
+			maxAge = sharedMaxAge
+		}
+		if maxAge >= 0 {
+			age, _ := strconv.Atoi(header.Get("Age"))
+			return max(0, time.Duration(maxAge-max(0, age))*time.Second)
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid date, such as "0", means the response has expired
+			return 0
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return max(0, at.Sub(now))
+	}
+	return ttl
+}
+
+// cachedNWSRequest answers a request to NWS from the response cached under
+// key when there is one, and otherwise caches a successful response for as
+// long as NWS says it's fresh, or ttl when it doesn't say, asking the peer
+// owning key for it first when there are cache peers. A response that expired
+// within FORECAST_NWS_STALE_TTL is answered at once while it's refreshed in
+// the background, and the request of ctx is marked stale. A zero ttl leaves
+// the cache to /admin/prewarm.
+func (s *server) cachedNWSRequest(ctx context.Context, key, url string, ttl time.Duration) ([]byte, int, error) {
+	if body, ok := s.nwsCache.get(key); ok {
+		nwsCacheHits.Add(1)
+		return body, http.StatusOK, nil
+	}
+	if window := s.state.Config().NWSStaleTTL; window > 0 && ttl > 0 {
+		if body, ok := s.nwsCache.stale(key, window); ok {
+			nwsCacheStaleHits.Add(1)
+			s.refreshNWS(ctx, key, url, ttl)
+			if m, ok := ctx.Value(staleContextKey{}).(*staleMarker); ok {
+				m.stale.Store(true)
+			}
+			return body, http.StatusOK, nil
+		}
+	}
+	nwsCacheMisses.Add(1)
+	return s.fillNWS(ctx, key, url, ttl)
+}
+
+// staleWarningWriter adds a Warning header to a response once its request has
+// been marked stale
+type staleWarningWriter struct {
+	http.ResponseWriter
+	marker      *staleMarker
+	wroteHeader bool
+}
+
+func (w *staleWarningWriter) WriteHeader(status int) {
+	if !w.wroteHeader && w.marker.stale.Load() {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *staleWarningWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *staleWarningWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withStaleWarning tells clients of next when its response was built from an
+// NWS response served stale
+func (s *server) withStaleWarning(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		marker := &staleMarker{}
+		ctx := context.WithValue(r.Context(), staleContextKey{}, marker)
+		next(&staleWarningWriter{ResponseWriter: w, marker: marker}, r.WithContext(ctx))
+	}
+}
+
+// refreshNWS fills the cache entry of key in the background, unless it's
+// already being refreshed. The refresh outlives the request that found the
+// entry stale, so it isn't cancelled with it.
+func (s *server) refreshNWS(ctx context.Context, key, url string, ttl time.Duration) {
+	if _, busy := s.refreshing.LoadOrStore(key, true); busy {
+		return
+	}
+	go func() {
+		defer s.refreshing.Delete(key)
+		if _, _, err := s.fillNWS(context.WithoutCancel(ctx), key, url, ttl); err != nil {
+			log.Printf("Failed to refresh stale %s: %v", key, err)
+		}
+	}()
+}
+
+// fillNWS fetches the response of key from the peer owning it, or from NWS
+// when there's no peer or it can't be reached, caching it
+func (s *server) fillNWS(ctx context.Context, key, url string, ttl time.Duration) ([]byte, int, error) {
+	if peer := s.cachePeer(key); peer != "" && ttl > 0 {
+		body, header, statusCode, err := s.peerNWSRequest(ctx, peer, key, url, ttl)
+		if cacheTTL := nwsResponseTTL(header, s.nwsCache.clock.Now(), ttl); err == nil && cacheTTL > 0 {
+			s.nwsCache.store(key, body, cacheTTL)
+		}
+		if !errors.Is(err, errPeerUnavailable) {
+			return body, statusCode, err
+		}
+	}
+	return s.fetchNWS(ctx, key, url, ttl)
+}
+
+// fetchNWS requests url from NWS, caching a successful response under key for
+// as long as its headers allow, or ttl when they don't say. Bodies that aren't
+// JSON, such as an error page served with a 200, aren't cached.
+func (s *server) fetchNWS(ctx context.Context, key, url string, ttl time.Duration) ([]byte, int, error) {
+	body, header, statusCode, err := s.makeNWSRequest(ctx, url)
+	if cacheTTL := nwsResponseTTL(header, s.nwsCache.clock.Now(), ttl); err == nil && cacheTTL > 0 && json.Valid(body) {
+		s.nwsCache.store(key, body, cacheTTL)
+	}
+	return body, statusCode, err
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNWSCache tests that responses expire and the least recently used are
+// evicted when the cache is full
+func TestNWSCache(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	c := newNWSCache(clk, 2)
+	c.store("a", []byte("a"), time.Hour)
+	c.store("b", []byte("b"), time.Hour)
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	// b is now the least recently used
+	c.store("c", []byte("c"), time.Minute)
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if body, ok := c.get(key); !ok || string(body) != key {
+			t.Errorf("expected %s to be cached, got %q", key, body)
+		}
+	}
+
+	c.store("a", []byte("a2"), time.Hour)
+	if body, _ := c.get("a"); string(body) != "a2" {
+		t.Errorf("expected a to be replaced, got %q", body)
+	}
+	clk.Advance(time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("expected c to expire")
+	}
+	// Expired entries can be served stale until the stale window passes
+	if body, ok := c.stale("c", time.Hour); !ok || string(body) != "c" {
+		t.Errorf("expected c to be served stale, got %q", body)
+	}
+	clk.Advance(time.Hour)
+	if _, ok := c.stale("c", time.Hour); ok {
+		t.Error("expected c to be past the stale window")
+	}
+	if len(c.entries) != 1 || c.order.Len() != 1 {
+		t.Errorf("expected the expired entry to be dropped, got %d entries", len(c.entries))
+	}
+}
+
+// TestCachedNWSRequest tests that forecasts fetched for requests are cached
+// for the configured TTL, with points shared by their rounded coordinates
+func TestCachedNWSRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		expected int
+	}{
+		{name: "cached", ttl: 10 * time.Minute, expected: 2},
+		{name: "disabled", ttl: 0, expected: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: tt.ttl})
+			nws := newFakeDoer(map[string]fakeResponse{
+				"/points/":                        {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast"}}`},
+				"/gridpoints/SEW/124,67/forecast": {body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`},
+			})
+			srv.nws = nws
+			for _, point := range []string{"latitude=47.6062&longitude=-122.3321", "latitude=47.60620&longitude=-122.33210", "latitude=47.6062&longitude=-122.3321"} {
+				w := httptest.NewRecorder()
+				srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?"+point, nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+				}
+			}
+			if got := len(nws.paths()); got != tt.expected {
+				t.Errorf("expected %d NWS requests, got %v", tt.expected, nws.paths())
+			}
+		})
+	}
+}
+
+// TestNWSResponseTTL tests reading how long a response may be cached from its
+// headers
+func TestNWSResponseTTL(t *testing.T) {
+	now := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{name: "no headers", ttl: 10 * time.Minute, expected: 10 * time.Minute},
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=1800"}}, ttl: 10 * time.Minute, expected: 30 * time.Minute},
+		{name: "s-maxage", header: http.Header{"Cache-Control": {"public, max-age=1800, s-maxage=120"}}, ttl: 10 * time.Minute, expected: 2 * time.Minute},
+		{name: "age", header: http.Header{"Cache-Control": {"max-age=1800"}, "Age": {"600"}}, ttl: 10 * time.Minute, expected: 20 * time.Minute},
+		{name: "stale", header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"120"}}, ttl: 10 * time.Minute, expected: 0},
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store"}}, ttl: 10 * time.Minute, expected: 0},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"No-Cache"}}, ttl: 10 * time.Minute, expected: 0},
+		{name: "expires", header: http.Header{"Expires": {"Thu, 15 Jan 2026 12:45:00 GMT"}}, ttl: 10 * time.Minute, expected: 45 * time.Minute},
+		{name: "expires by date", header: http.Header{"Expires": {"Thu, 15 Jan 2026 12:45:00 GMT"}, "Date": {"Thu, 15 Jan 2026 12:30:00 GMT"}}, ttl: 10 * time.Minute, expected: 15 * time.Minute},
+		{name: "expired", header: http.Header{"Expires": {"Thu, 15 Jan 2026 11:00:00 GMT"}}, ttl: 10 * time.Minute, expected: 0},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}, ttl: 10 * time.Minute, expected: 0},
+		{name: "max-age over expires", header: http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Thu, 15 Jan 2026 12:45:00 GMT"}}, ttl: 10 * time.Minute, expected: time.Minute},
+		{name: "caching off", header: http.Header{"Cache-Control": {"max-age=1800"}}, ttl: 0, expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nwsResponseTTL(tt.header, now, tt.ttl); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCachedNWSRequestHeaders tests that responses are cached for as long as
+// NWS's headers say
+func TestCachedNWSRequestHeaders(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: 10 * time.Minute})
+	srv.nwsCache = newNWSCache(clk, 0)
+	nws := newFakeDoer(map[string]fakeResponse{
+		"/gridpoints/SEW/124,67/forecast": {body: `{}`, header: http.Header{"Cache-Control": {"public, max-age=3600"}}},
+		"/gridpoints/SEW/124,67":          {body: `{}`, header: http.Header{"Cache-Control": {"no-store"}}},
+	})
+	srv.nws = nws
+	for _, url := range []string{fakeNWSHost + "/gridpoints/SEW/124,67/forecast", fakeNWSHost + "/gridpoints/SEW/124,67"} {
+		srv.cachedNWSRequest(t.Context(), url, url, 10*time.Minute)
+	}
+	clk.Advance(30 * time.Minute)
+	for _, url := range []string{fakeNWSHost + "/gridpoints/SEW/124,67/forecast", fakeNWSHost + "/gridpoints/SEW/124,67"} {
+		srv.cachedNWSRequest(t.Context(), url, url, 10*time.Minute)
+	}
+	expected := []string{"/gridpoints/SEW/124,67/forecast", "/gridpoints/SEW/124,67", "/gridpoints/SEW/124,67"}
+	if got := nws.paths(); !slices.Equal(got, expected) {
+		t.Errorf("expected NWS requests %v, got %v", expected, got)
+	}
+}
+
+// TestPointCacheTTLFor tests that gridpoints are cached for at least a day
+// while caching is on
+func TestPointCacheTTLFor(t *testing.T) {
+	tests := []struct {
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{ttl: 0, expected: 0},
+		{ttl: 10 * time.Minute, expected: pointCacheTTL},
+		{ttl: 48 * time.Hour, expected: 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := pointCacheTTLFor(tt.ttl); got != tt.expected {
+			t.Errorf("expected %s for %s, got %s", tt.expected, tt.ttl, got)
+		}
+	}
+}
+
+// TestStaleWhileRevalidate tests that expired forecasts are served at once,
+// marked stale, while they're refreshed in the background
+func TestStaleWhileRevalidate(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: 10 * time.Minute, NWSStaleTTL: time.Hour})
+	srv.clock = clk
+	srv.nwsCache = newNWSCache(clk, 0)
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv.nws = nws
+	setForecast := func(r fakeResponse) {
+		nws.mu.Lock()
+		defer nws.mu.Unlock()
+		nws.responses["/gridpoints/SEW/124,67/forecast"] = r
+	}
+	// waitForRefresh waits for the background refresh to send its request
+	// and finish
+	waitForRefresh := func(requests int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			busy := false
+			srv.refreshing.Range(func(any, any) bool { busy = true; return false })
+			if len(nws.paths()) >= requests && !busy {
+				return
+			}
+		}
+		t.Fatalf("expected a refresh, got requests %v", nws.paths())
+	}
+	forecast := func() *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	if w := forecast(); w.Header().Get("Warning") != "" {
+		t.Errorf("expected a fresh forecast, got Warning %q", w.Header().Get("Warning"))
+	}
+
+	// NWS failing leaves the stale forecast in place
+	clk.Advance(15 * time.Minute)
+	setForecast(fakeResponse{status: http.StatusServiceUnavailable})
+	w := forecast()
+	if w.Header().Get("Warning") == "" || !strings.Contains(w.Body.String(), "Sunny") {
+		t.Errorf("expected the stale forecast with a Warning, got %q: %s", w.Header().Get("Warning"), w.Body.String())
+	}
+	waitForRefresh(3)
+
+	// A successful refresh replaces it
+	setForecast(fakeResponse{body: `{"properties": {"periods": [{"temperature": 58, "shortForecast": "Rain"}]}}`})
+	if w := forecast(); !strings.Contains(w.Body.String(), "Sunny") {
+		t.Errorf("expected the stale forecast, got %s", w.Body.String())
+	}
+	waitForRefresh(4)
+	if w := forecast(); w.Header().Get("Warning") != "" || !strings.Contains(w.Body.String(), "Rain") {
+		t.Errorf("expected the refreshed forecast, got %q: %s", w.Header().Get("Warning"), w.Body.String())
+	}
+
+	// Past the stale window, requests wait for NWS again
+	clk.Advance(2 * time.Hour)
+	setForecast(fakeResponse{status: http.StatusServiceUnavailable})
+	w = httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 past the stale window, got %d", w.Code)
+	}
+}
+
+// TestStaleWarning tests that every route built from a stale NWS response
+// says so
+func TestStaleWarning(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: 10 * time.Minute, NWSStaleTTL: time.Hour})
+	srv.clock = clk
+	srv.nwsCache = newNWSCache(clk, 0)
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"name": "Today", "startTime": "2024-06-01T06:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv.nws = nws
+	routes := srv.routes()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	paths := []string{"/forecast?latitude=47.6062&longitude=-122.3321", "/forecast/periods?latitude=47.6062&longitude=-122.3321", "/calendar.ics?latitude=47.6062&longitude=-122.3321"}
+	for _, path := range paths {
+		if w := get(path); w.Code != http.StatusOK || w.Header().Get("Warning") != "" {
+			t.Errorf("%s: expected a fresh response, got %d with Warning %q", path, w.Code, w.Header().Get("Warning"))
+		}
+	}
+	// NWS failing keeps the forecast stale while it's refreshed
+	nws.mu.Lock()
+	nws.responses["/gridpoints/SEW/124,67/forecast"] = fakeResponse{status: http.StatusServiceUnavailable}
+	nws.mu.Unlock()
+	clk.Advance(15 * time.Minute)
+	for _, path := range paths {
+		if w := get(path); w.Code != http.StatusOK || w.Header().Get("Warning") != `110 - "Response is Stale"` {
+			t.Errorf("%s: expected a stale response, got %d with Warning %q", path, w.Code, w.Header().Get("Warning"))
+		}
+	}
+	if w := get("/version"); w.Header().Get("Warning") != "" {
+		t.Errorf("expected no Warning on a route not using NWS, got %q", w.Header().Get("Warning"))
+	}
+}
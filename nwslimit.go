@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NWS may throttle or block a User-Agent that sends too many requests, so
+// every request to NWS takes a token of FORECAST_NWS_RATE_LIMIT first. When
+// none is left the request queues for the next, for up to
+// FORECAST_NWS_RATE_WAIT, so a burst of client traffic is smoothed out rather
+// than passed on to NWS. When NWS answers 429 anyway, no request is sent
+// until its Retry-After has passed, and clients get a 503 with a Retry-After
+// of their own.
+
+const (
+	// defaultNWSThrottle is how long requests pause after a 429 without a
+	// usable Retry-After
+	defaultNWSThrottle = 10 * time.Second
+	// maxNWSThrottle bounds the pause asked for by a Retry-After
+	maxNWSThrottle = 10 * time.Minute
+)
+
+var (
+	// nwsRateWaits counts NWS requests that queued for the rate limit, and
+	// nwsRateRejected those that would have queued too long
+	nwsRateWaits    = expvar.NewInt("forecast_nws_rate_waits")
+	nwsRateRejected = expvar.NewInt("forecast_nws_rate_rejected")
+	// nwsThrottled counts 429 responses from NWS
+	nwsThrottled = expvar.NewInt("forecast_nws_throttled")
+)
+
+var (
+	// errNWSRateLimited is returned for NWS requests that would wait longer
+	// than FORECAST_NWS_RATE_WAIT for the rate limit or a pause NWS asked for
+	errNWSRateLimited = errors.New("too many requests to NWS, try again later")
+	// errNWSThrottled is returned for NWS requests answered with 429
+	errNWSThrottled = errors.New("NWS is throttling requests, try again later")
+)
+
+// nwsLimiter is the token bucket of requests to NWS, rebuilt when the
+// configured rate or burst changes
+type nwsLimiter struct {
+	mu          sync.Mutex
+	rate, burst int
+	bucket      *tokenBucket
+}
+
+// reserve takes a token for a request at now, returning how long to wait for
+// it, or false when that's longer than maxWait. A zero rate doesn't limit.
+func (l *nwsLimiter) reserve(now time.Time, rate, burst int, maxWait time.Duration) (time.Duration, bool) {
+	if rate <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.bucket == nil || l.rate != rate || l.burst != burst {
+		l.rate, l.burst = rate, burst
+		l.bucket = newTokenBucket(float64(rate), float64(max(burst, 1)), now)
+	}
+	return l.bucket.reserve(now, maxWait)
+}
+
+// nwsThrottle is when requests to NWS may resume after a 429
+type nwsThrottle struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// extend pauses requests until at least until
+func (t *nwsThrottle) extend(until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until.After(t.until) {
+		t.until = until
+	}
+}
+
+// remaining returns how long requests are still paused at now
+func (t *nwsThrottle) remaining(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return max(t.until.Sub(now), 0)
+}
+
+// throttleNWS pauses requests to NWS for the Retry-After of a 429 response
+func (s *server) throttleNWS(header http.Header) {
+	nwsThrottled.Add(1)
+	now := s.clock.Now()
+	pause, ok := parseRetryAfter(header.Get("Retry-After"), now)
+	if !ok {
+		pause = defaultNWSThrottle
+	}
+	s.throttle.extend(now.Add(min(pause, maxNWSThrottle)))
+}
+
+// waitForNWS holds a request to NWS until a pause NWS asked for is over and
+// the rate limit allows it, returning errNWSRateLimited when that would take
+// longer than FORECAST_NWS_RATE_WAIT, or the context's error if it's done
+// first. The token is reserved up front, so the wait is the longer of the
+// pause and the rate limit's, not their sum.
+func (s *server) waitForNWS(ctx context.Context) error {
+	cfg := s.state.Config()
+	if cfg.Offline {
+		return nil
+	}
+	now := s.clock.Now()
+	pause := s.throttle.remaining(now)
+	if pause > cfg.NWSRateWait {
+		nwsRateRejected.Add(1)
+		return errNWSRateLimited
+	}
+	wait, ok := s.limiter.reserve(now, cfg.NWSRateLimit, cfg.NWSRateBurst, cfg.NWSRateWait)
+	if !ok {
+		nwsRateRejected.Add(1)
+		return errNWSRateLimited
+	}
+	if wait = max(wait, pause); wait > 0 {
+		nwsRateWaits.Add(1)
+		select {
+		case <-s.clock.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// retryAfterWriter adds a Retry-After to 503 responses while requests to NWS
+// are paused, so clients know when to try again
+type retryAfterWriter struct {
+	http.ResponseWriter
+	s *server
+}
+
+func (w retryAfterWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+		if pause := w.s.throttle.remaining(w.s.clock.Now()); pause > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(pause.Seconds()))))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w retryAfterWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.Write(b)
+}
+
+func (w retryAfterWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withRetryAfter tells clients of next's 503s when NWS will be asked again
+func (s *server) withRetryAfter(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(retryAfterWriter{ResponseWriter: w, s: s}, r)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestNWSLimiter tests that requests over the rate queue for their turn, up
+// to the longest wait allowed
+func TestNWSLimiter(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var l nwsLimiter
+	tests := []struct {
+		at           time.Duration
+		expectedWait time.Duration
+		expectedOK   bool
+	}{
+		{at: 0, expectedWait: 0, expectedOK: true},
+		{at: 0, expectedWait: 0, expectedOK: true},
+		{at: 0, expectedWait: 500 * time.Millisecond, expectedOK: true},
+		{at: 0, expectedWait: time.Second, expectedOK: true},
+		{at: 0, expectedWait: 1500 * time.Millisecond, expectedOK: false},
+		{at: 3 * time.Second, expectedWait: 0, expectedOK: true},
+	}
+	for i, tt := range tests {
+		wait, ok := l.reserve(start.Add(tt.at), 2, 2, time.Second)
+		if wait != tt.expectedWait || ok != tt.expectedOK {
+			t.Errorf("request %d: expected a wait of %s and %v, got %s and %v", i, tt.expectedWait, tt.expectedOK, wait, ok)
+		}
+	}
+
+	if wait, ok := l.reserve(start, 0, 0, 0); wait != 0 || !ok {
+		t.Errorf("expected no limit at a zero rate, got a wait of %s and %v", wait, ok)
+	}
+}
+
+// TestMakeNWSRequestRateLimit tests that NWS requests over the rate limit
+// wait for their turn, and fail when they'd wait too long
+func TestMakeNWSRequestRateLimit(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSRateLimit: 1, NWSRateBurst: 1, NWSRateWait: time.Second})
+	srv.clock = clk
+	nws := newFakeDoer(map[string]fakeResponse{"/stations/": {body: `{}`}})
+	srv.nws = nws
+
+	if _, _, _, err := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/stations/KSEA"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, _, _, err := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/stations/KSEA")
+		done <- err
+	}()
+	clk.BlockUntil(t, 1)
+	if len(nws.paths()) != 1 {
+		t.Errorf("expected the second request to wait, got %v", nws.paths())
+	}
+
+	// A third would wait two seconds
+	if _, _, status, err := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/stations/KSEA"); !errors.Is(err, errNWSRateLimited) || status != http.StatusServiceUnavailable {
+		t.Errorf("expected the third request to be refused with 503, got %d: %v", status, err)
+	}
+
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(nws.paths()) != 2 {
+		t.Errorf("expected the second request to be sent once its turn came, got %v", nws.paths())
+	}
+}
+
+// TestWaitForNWS tests that a pause NWS asked for and the rate limit's queue
+// are waited out together within FORECAST_NWS_RATE_WAIT, and that a request
+// stops waiting when its context is done
+func TestWaitForNWS(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	setup := func(pause time.Duration, queued int) (*server, *fakeClock) {
+		clk := newFakeClock(start)
+		srv := newServer(Config{NWSRateLimit: 1, NWSRateBurst: 1, NWSRateWait: 1500 * time.Millisecond})
+		srv.clock = clk
+		srv.throttle.extend(start.Add(pause))
+		for range queued {
+			srv.limiter.reserve(start, 1, 1, time.Hour)
+		}
+		return srv, clk
+	}
+
+	// A 1s pause with two requests queued ahead would take 2s in all
+	srv, _ := setup(time.Second, 2)
+	if err := srv.waitForNWS(t.Context()); !errors.Is(err, errNWSRateLimited) {
+		t.Errorf("expected the combined wait to be refused, got %v", err)
+	}
+
+	// The token accrues during the pause, so one queued request doesn't add
+	// to it
+	srv, clk := setup(time.Second, 1)
+	done := make(chan error)
+	go func() { done <- srv.waitForNWS(t.Context()) }()
+	clk.BlockUntil(t, 1)
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("expected the request to go once the pause was over, got %v", err)
+	}
+
+	srv, clk = setup(time.Second, 0)
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() { done <- srv.waitForNWS(ctx) }()
+	clk.BlockUntil(t, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled request to stop waiting, got %v", err)
+	}
+}
+
+// TestNWSThrottle tests that a 429 from NWS pauses requests to it for its
+// Retry-After, and that clients get a 503 saying when to try again
+func TestNWSThrottle(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSRetryAttempts: 3, NWSRateWait: 5 * time.Second})
+	srv.clock = clk
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	points := nws.responses["/points/"]
+	nws.responses["/points/"] = fakeResponse{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"120"}}}
+	srv.nws = nws
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+		return w
+	}
+	for i, expectedRetryAfter := range []string{"120", "90"} {
+		w := get()
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != expectedRetryAfter {
+			t.Errorf("request %d: expected 503 with Retry-After %s, got %d with %q: %s", i+1, expectedRetryAfter, w.Code, w.Header().Get("Retry-After"), w.Body.String())
+		}
+		if len(nws.paths()) != 1 {
+			t.Errorf("request %d: expected NWS to be asked once, got %v", i+1, nws.paths())
+		}
+		clk.Advance(30 * time.Second)
+	}
+
+	clk.Advance(time.Minute)
+	nws.mu.Lock()
+	nws.responses["/points/"] = points
+	nws.mu.Unlock()
+	if w := get(); w.Code != http.StatusOK || w.Header().Get("Retry-After") != "" {
+		t.Errorf("expected a forecast once the pause was over, got %d with %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"expvar"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// NWS answers some requests with a redirect, notably /points/{lat},{lon} for
+// coordinates with more than four decimals, which it sends to the rounded
+// point. nwsClient doesn't follow redirects itself, so that every hop waits
+// for the rate limit and counts against the budget like any request. doNWS
+// follows them instead, and remembers where a URL permanently moved so later
+// requests for it go straight there.
+const (
+	// maxNWSRedirects bounds the redirects followed for one request
+	maxNWSRedirects = 3
+	// maxNWSRedirectTargets bounds the permanent redirects remembered
+	maxNWSRedirectTargets = 10000
+)
+
+// nwsRedirectsFollowed counts redirects followed from NWS, and
+// nwsRedirectsSkipped requests that went straight to a remembered target
+var (
+	nwsRedirectsFollowed = expvar.NewInt("forecast_nws_redirects")
+	nwsRedirectsSkipped  = expvar.NewInt("forecast_nws_redirects_skipped")
+)
+
+// nwsRedirects remembers the targets of permanent NWS redirects
+type nwsRedirects struct {
+	mu      sync.Mutex
+	targets map[string]string
+}
+
+func (r *nwsRedirects) lookup(from string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	to, ok := r.targets[from]
+	return to, ok
+}
+
+// store remembers a redirect, forgetting the others when full, since they're
+// only a shortcut
+func (r *nwsRedirects) store(from, to string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.targets == nil || len(r.targets) >= maxNWSRedirectTargets {
+		r.targets = make(map[string]string)
+	}
+	r.targets[from] = to
+}
+
+// nwsRedirectTarget returns where a redirect response to req points, or false
+// unless it's a redirect to another URL on the same host
+func nwsRedirectTarget(req *http.Request, resp *http.Response) (*url.URL, bool) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, false
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, false
+	}
+	target, err := req.URL.Parse(location)
+	if err != nil || target.Scheme != req.URL.Scheme || target.Host != req.URL.Host || target.String() == req.URL.String() {
+		return nil, false
+	}
+	return target, true
+}
+
+// doNWS sends a GET request to NWS, waiting for the rate limit and following
+// redirects on the same host. Redirects it can't follow, such as to another
+// host or past maxNWSRedirects, are returned as they are. A 429 pauses later
+// requests for its Retry-After.
+func (s *server) doNWS(req *http.Request) (*http.Response, error) {
+	original := req.URL.String()
+	if to, ok := s.redirects.lookup(original); ok {
+		if target, err := url.Parse(to); err == nil {
+			nwsRedirectsSkipped.Add(1)
+			req = redirectRequest(req, target)
+		}
+	}
+	for hops := 0; ; hops++ {
+		if err := s.waitForNWS(req.Context()); err != nil {
+			return nil, err
+		}
+		s.recordNWSRequest()
+		resp, err := s.nws.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			s.throttleNWS(resp.Header)
+		}
+		target, ok := nwsRedirectTarget(req, resp)
+		if !ok || hops >= maxNWSRedirects {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		nwsRedirectsFollowed.Add(1)
+		if resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect {
+			s.redirects.store(original, target.String())
+		}
+		req = redirectRequest(req, target)
+	}
+}
+
+// redirectRequest copies req, with its headers, for target
+func redirectRequest(req *http.Request, target *url.URL) *http.Request {
+	next := req.Clone(req.Context())
+	next.URL = target
+	next.Host = ""
+	return next
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// TestLookupPointRounds tests that points are asked of NWS rounded to the
+// four decimals it would redirect them to
+func TestLookupPointRounds(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv.nws = nws
+	w := httptest.NewRecorder()
+	srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=47.606209&longitude=-122.332071", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if paths := nws.paths(); paths[0] != "/points/47.6062,-122.3321" {
+		t.Errorf("expected the rounded point to be looked up, got %v", paths)
+	}
+}
+
+// TestNWSRedirects tests following NWS redirects on the same host, and going
+// straight to the target of a permanent one afterwards
+func TestNWSRedirects(t *testing.T) {
+	tests := []struct {
+		name           string
+		responses      map[string]fakeResponse
+		expectedStatus int
+		expectedPaths  []string
+		// expectedAgain are the paths of a second request for the same URL
+		expectedAgain []string
+	}{
+		{
+			name: "permanent",
+			responses: map[string]fakeResponse{
+				"/points/47.606209": {status: http.StatusMovedPermanently, header: http.Header{"Location": {"/points/47.6062,-122.3321"}}},
+				"/points/47.6062,":  {body: `{}`},
+			},
+			expectedStatus: http.StatusOK,
+			expectedPaths:  []string{"/points/47.606209,-122.332071", "/points/47.6062,-122.3321"},
+			expectedAgain:  []string{"/points/47.6062,-122.3321"},
+		},
+		{
+			name: "absolute location",
+			responses: map[string]fakeResponse{
+				"/points/47.606209": {status: http.StatusPermanentRedirect, header: http.Header{"Location": {fakeNWSHost + "/points/47.6062,-122.3321"}}},
+				"/points/47.6062,":  {body: `{}`},
+			},
+			expectedStatus: http.StatusOK,
+			expectedPaths:  []string{"/points/47.606209,-122.332071", "/points/47.6062,-122.3321"},
+			expectedAgain:  []string{"/points/47.6062,-122.3321"},
+		},
+		{
+			name: "temporary",
+			responses: map[string]fakeResponse{
+				"/points/47.606209": {status: http.StatusFound, header: http.Header{"Location": {"/points/47.6062,-122.3321"}}},
+				"/points/47.6062,":  {body: `{}`},
+			},
+			expectedStatus: http.StatusOK,
+			expectedPaths:  []string{"/points/47.606209,-122.332071", "/points/47.6062,-122.3321"},
+			expectedAgain:  []string{"/points/47.606209,-122.332071", "/points/47.6062,-122.3321"},
+		},
+		{
+			name: "another host",
+			responses: map[string]fakeResponse{
+				"/points/47.606209": {status: http.StatusMovedPermanently, header: http.Header{"Location": {"http://elsewhere.test/points/47.6062,-122.3321"}}},
+			},
+			expectedStatus: http.StatusMovedPermanently,
+			expectedPaths:  []string{"/points/47.606209,-122.332071"},
+			expectedAgain:  []string{"/points/47.606209,-122.332071"},
+		},
+		{
+			name: "loop",
+			responses: map[string]fakeResponse{
+				"/points/a": {status: http.StatusMovedPermanently, header: http.Header{"Location": {"/points/b"}}},
+				"/points/b": {status: http.StatusMovedPermanently, header: http.Header{"Location": {"/points/a"}}},
+				"/points/4": {status: http.StatusMovedPermanently, header: http.Header{"Location": {"/points/a"}}},
+			},
+			expectedStatus: http.StatusMovedPermanently,
+			expectedPaths:  []string{"/points/47.606209,-122.332071", "/points/a", "/points/b", "/points/a"},
+			expectedAgain:  []string{"/points/a", "/points/b", "/points/a", "/points/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeDoer(tt.responses)
+			srv.nws = nws
+			for i, expected := range [][]string{tt.expectedPaths, tt.expectedAgain} {
+				nws.requests = nil
+				_, _, statusCode, _ := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/points/47.606209,-122.332071")
+				if statusCode != tt.expectedStatus {
+					t.Errorf("request %d: expected status %d, got %d", i+1, tt.expectedStatus, statusCode)
+				}
+				if paths := nws.paths(); !slices.Equal(paths, expected) {
+					t.Errorf("request %d: expected %v, got %v", i+1, expected, paths)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// observation is the latest report of an observation station, in canonical
+// units. Values stations did not report are nil.
+type observation struct {
+	Station     string
+	Time        time.Time
+	Description string
+	Condition   condition
+	// TemperatureC is the air temperature in °C
+	TemperatureC *float64
+	// WindSpeedKPH is the sustained wind speed in km/h
+	WindSpeedKPH *float64
+	// WindDirectionDegrees is where the wind blows from, clockwise from north
+	WindDirectionDegrees *float64
+	// RelativeHumidity is in percent
+	RelativeHumidity *float64
+	// RecentPrecipitationMm is the precipitation over the longest of the last
+	// 6, 3, or 1 hours the station reported
+	RecentPrecipitationMm    *float64
+	RecentPrecipitationHours int
+}
+
+// nwsQuantity is a measured value of an NWS observation
+type nwsQuantity struct {
+	UnitCode string   `json:"unitCode"`
+	Value    *float64 `json:"value"`
+}
+
+// canonical returns the value in canonical units, nil if it is missing or in
+// an unknown unit
+func (q nwsQuantity) canonical() *float64 {
+	convert, ok := gridUnitConversions[q.UnitCode]
+	if q.Value == nil || !ok {
+		return nil
+	}
+	v := convert(*q.Value)
+	return &v
+}
+
+// parseObservation reads an NWS latest observation response
+func parseObservation(body []byte) (observation, error) {
+	var resp struct {
+		Properties struct {
+			Station                 string      `json:"station"`
+			Timestamp               time.Time   `json:"timestamp"`
+			TextDescription         string      `json:"textDescription"`
+			Icon                    string      `json:"icon"`
+			Temperature             nwsQuantity `json:"temperature"`
+			WindSpeed               nwsQuantity `json:"windSpeed"`
+			WindDirection           nwsQuantity `json:"windDirection"`
+			RelativeHumidity        nwsQuantity `json:"relativeHumidity"`
+			PrecipitationLastHour   nwsQuantity `json:"precipitationLastHour"`
+			PrecipitationLast3Hours nwsQuantity `json:"precipitationLast3Hours"`
+			PrecipitationLast6Hours nwsQuantity `json:"precipitationLast6Hours"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return observation{}, err
+	}
+	p := resp.Properties
+	obs := observation{
+		Station:      p.Station,
+		Time:         p.Timestamp,
+		Description:  p.TextDescription,
+		Condition:    nwsCondition(p.TextDescription, p.Icon),
+		TemperatureC: p.Temperature.canonical(),
+
+		WindSpeedKPH:         p.WindSpeed.canonical(),
+		WindDirectionDegrees: p.WindDirection.canonical(),
+		RelativeHumidity:     p.RelativeHumidity.canonical(),
+	}
+	for _, recent := range []struct {
+		quantity nwsQuantity
+		hours    int
+	}{
+		{p.PrecipitationLast6Hours, 6},
+		{p.PrecipitationLast3Hours, 3},
+		{p.PrecipitationLastHour, 1},
+	} {
+		if v := recent.quantity.canonical(); v != nil {
+			obs.RecentPrecipitationMm, obs.RecentPrecipitationHours = v, recent.hours
+			break
+		}
+	}
+	return obs, nil
+}
+
+// fetchLatestObservation returns the latest observation of the first station
+// listed at stationsURL, the observationStations link of a points response,
+// which NWS orders nearest first
+func (s *server) fetchLatestObservation(ctx context.Context, stationsURL string) (observation, int, error) {
+	if stationsURL == "" {
+		return observation{}, http.StatusNotFound, fmt.Errorf("Observation stations URL not found")
+	}
+	body, statusCode, err := s.cachedNWSRequest(ctx, stationsURL, stationsURL, pointCacheTTLFor(s.state.Config().NWSCacheTTL))
+	if err != nil {
+		return observation{}, statusCode, err
+	}
+	var stations struct {
+		Features []struct {
+			ID string `json:"id"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &stations); err != nil {
+		return observation{}, http.StatusInternalServerError, fmt.Errorf("Failed to parse stations response")
+	}
+	if len(stations.Features) == 0 || stations.Features[0].ID == "" {
+		return observation{}, http.StatusNotFound, fmt.Errorf("No observation stations found")
+	}
+
+	body, _, statusCode, err = s.makeNWSRequest(ctx, stations.Features[0].ID+"/observations/latest")
+	if err != nil {
+		return observation{}, statusCode, err
+	}
+	obs, err := parseObservation(body)
+	if err != nil {
+		return observation{}, http.StatusInternalServerError, fmt.Errorf("Failed to parse observation response")
+	}
+	return obs, http.StatusOK, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+// TestParseObservation tests reading the latest observation of a station
+func TestParseObservation(t *testing.T) {
+	body := `{"properties": {
+		"station": "https://api.weather.gov/stations/KSEA",
+		"timestamp": "2024-01-10T05:53:00+00:00",
+		"textDescription": "Light Snow",
+		"temperature": {"unitCode": "wmoUnit:degC", "value": -1.1},
+		"precipitationLastHour": {"unitCode": "wmoUnit:mm", "value": 0.5},
+		"precipitationLast3Hours": {"unitCode": "wmoUnit:mm", "value": 2.3},
+		"precipitationLast6Hours": {"unitCode": "wmoUnit:mm", "value": null}
+	}}`
+	obs, err := parseObservation([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obs.Station != "https://api.weather.gov/stations/KSEA" || obs.Condition != conditionSnow || obs.Time.IsZero() {
+		t.Errorf("unexpected observation %+v", obs)
+	}
+	if obs.TemperatureC == nil || *obs.TemperatureC != -1.1 {
+		t.Errorf("expected -1.1°C, got %v", obs.TemperatureC)
+	}
+	// The longest reported window wins
+	if obs.RecentPrecipitationMm == nil || *obs.RecentPrecipitationMm != 2.3 || obs.RecentPrecipitationHours != 3 {
+		t.Errorf("expected 2.3 mm over 3 hours, got %v over %d", obs.RecentPrecipitationMm, obs.RecentPrecipitationHours)
+	}
+
+	obs, err = parseObservation([]byte(`{"properties": {"temperature": {"unitCode": "wmoUnit:K", "value": 270}}}`))
+	if err != nil || obs.TemperatureC != nil || obs.RecentPrecipitationMm != nil {
+		t.Errorf("expected unknown units and missing values to be nil, got %+v (%v)", obs, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestShiftFixtureTimes tests moving canned times forward while keeping their offsets
+func TestShiftFixtureTimes(t *testing.T) {
+	body := `{"startTime": "2024-06-01T06:00:00-07:00", "validTime": "2024-06-30T13:00:00+00:00/PT1H", "timestamp": "2024-06-01T12:53:00Z", "name": "Today"}`
+	expected := `{"startTime": "2024-07-03T06:00:00-07:00", "validTime": "2024-08-01T13:00:00Z/PT1H", "timestamp": "2024-07-03T12:53:00Z", "name": "Today"}`
+	if got := string(shiftFixtureTimes([]byte(body), 32)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+// TestOfflineMode tests serving every endpoint family from the bundled dataset
+func TestOfflineMode(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	// The host is never contacted
+	srv := newServer(Config{NWSAPIHost: "http://nws.invalid"})
+	srv.nws = &http.Client{Transport: offlineTransport{now: func() time.Time { return now }}}
+	srv.store = newTestStore(t)
+	handler := srv.routes()
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "forecast", path: "/forecast?latitude=40.7128&longitude=-74.0060"},
+		{name: "hourly", path: "/forecast/hourly?latitude=47.6062&longitude=-122.3321"},
+		{name: "grid data", path: "/degree-days?latitude=47.6062&longitude=-122.3321"},
+		{name: "observations", path: "/road?latitude=47.6062&longitude=-122.3321"},
+		{name: "current", path: "/current?latitude=47.6062&longitude=-122.3321"},
+		{name: "station", path: "/forecast?station=KSEA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/forecast/hourly?latitude=47.6062&longitude=-122.3321", nil))
+	var hourly struct {
+		Periods []hourlyPeriod `json:"periods"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &hourly); err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly.Periods) == 0 || hourly.Periods[0].StartTime.UTC().Format(time.DateOnly) != "2025-03-10" {
+		t.Errorf("expected the canned forecast to start today, got %+v", hourly.Periods)
+	}
+
+	if err := srv.store.CreateLocation(context.Background(), &Location{Owner: "alice", Name: "Home", Latitude: 47.6, Longitude: -122.3}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := srv.pollAlertsOnce(context.Background()); err != nil || n != 1 {
+		t.Errorf("expected the canned alert to be saved, got %d, %v", n, err)
+	}
+	if _, _, status, err := srv.makeNWSRequest(t.Context(), "http://nws.invalid/products/types"); err == nil || status != http.StatusNotFound {
+		t.Errorf("expected unknown paths to be 404, got %d", status)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksCacheTTL is how long fetched signing keys are trusted before refetching
+	jwksCacheTTL = time.Hour
+	// jwksMinRefresh limits refetches triggered by tokens signed with unknown keys
+	jwksMinRefresh = time.Minute
+	// jwtLeeway tolerates clock skew when checking exp and nbf
+	jwtLeeway = time.Minute
+)
+
+// oidcVerifier validates JWTs issued by an OIDC provider, as an alternative to
+// API keys. Signing keys are discovered from the issuer's JWKS and cached.
+type oidcVerifier struct {
+	issuer      string
+	audience    string
+	rolesClaim  string
+	tenantClaim string
+	client      *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// refreshing is closed when the JWKS fetch in progress, if any, is done,
+	// and refreshErr is the error of the last one
+	refreshing chan struct{}
+	refreshErr error
+}
+
+// newOIDCVerifier returns a verifier for the issuer in cfg, or nil when OIDC
+// isn't configured. Nothing is fetched until the first token is verified.
+func newOIDCVerifier(cfg Config) *oidcVerifier {
+	if cfg.OIDCIssuer == "" {
+		return nil
+	}
+	return &oidcVerifier{
+		issuer:      cfg.OIDCIssuer,
+		audience:    cfg.OIDCAudience,
+		rolesClaim:  cfg.OIDCRolesClaim,
+		tenantClaim: cfg.OIDCTenantClaim,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// isJWT reports whether a bearer token looks like a JWT rather than an API key
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// jwtHeader is the JOSE header of a signed JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks a token's signature, issuer, audience, and lifetime, and maps
+// its claims to a key: the tenant claim becomes the owner and recognised values
+// of the roles claim become its roles
+func (v *oidcVerifier) verify(ctx context.Context, token string, now time.Time) (*APIKey, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	key, err := v.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return nil, fmt.Errorf("token issued by %q", iss)
+	}
+	if v.audience != "" && !slices.Contains(stringsClaim(claims["aud"]), v.audience) {
+		return nil, fmt.Errorf("token not intended for audience %q", v.audience)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token not yet valid")
+	}
+
+	sub, _ := claims["sub"].(string)
+	owner, _ := claims[v.tenantClaim].(string)
+	if sub == "" || owner == "" {
+		return nil, fmt.Errorf("token has no %q claim", v.tenantClaim)
+	}
+	var roles []string
+	for _, role := range stringsClaim(claims[v.rolesClaim]) {
+		if slices.Contains(validScopes, role) && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return &APIKey{ID: "oidc:" + sub, Owner: owner, Roles: roles}, nil
+}
+
+// stringsClaim reads a claim holding a string array or a space-separated string
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWTSignature checks an RS256/384/512 or ES256/384 signature. Other
+// algorithms, including none and the HMAC family, are rejected.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hashID = crypto.SHA256
+	case "RS384", "ES384":
+		hashID = crypto.SHA384
+	case "RS512":
+		hashID = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	h := hashID.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" && alg != "RS384" && alg != "RS512" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(key, hashID, digest, signature); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if (alg != "ES256" || size != 32) && (alg != "ES384" || size != 48) {
+			break
+		}
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported token algorithm %q", alg)
+}
+
+// key returns the signing key with the given ID, fetching the JWKS when the
+// cache has expired or the key is unknown
+func (v *oidcVerifier) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	stale := now.Sub(v.fetched) > jwksCacheTTL
+	// A token signed with an unknown key may follow a rotation at the issuer
+	refetch := stale || now.Sub(v.fetched) > jwksMinRefresh
+	v.mu.Unlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if refetch {
+		if err := v.refresh(ctx, now); err != nil {
+			if ok {
+				// Keep serving the cached key while the issuer is unreachable
+				return key, nil
+			}
+			return nil, fmt.Errorf("failed to fetch signing keys: %v", err)
+		}
+		v.mu.Lock()
+		key, ok = v.keys[kid]
+		v.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the JWKS into the cache, or waits for the fetch already in
+// progress, without holding the lock so cached keys keep verifying meanwhile.
+// The fetch isn't cancelled with the request that started it, since others
+// may be waiting for it; the client's timeout bounds it instead.
+func (v *oidcVerifier) refresh(ctx context.Context, now time.Time) error {
+	v.mu.Lock()
+	if done := v.refreshing; done != nil {
+		v.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.refreshErr
+	}
+	done := make(chan struct{})
+	v.refreshing = done
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys(context.WithoutCancel(ctx))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil {
+		v.keys, v.fetched = keys, now
+	}
+	v.refreshing, v.refreshErr = nil, err
+	close(done)
+	return err
+}
+
+// fetchKeys discovers the issuer's JWKS and parses its RSA and EC keys. Keys
+// that can't be parsed are skipped, so one malformed or unsupported key
+// doesn't lock out tokens signed with the others.
+func (v *oidcVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, strings.TrimRight(v.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("issuer has no jwks_uri")
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping OIDC signing key %q: %v", k.Kid, err)
+			continue
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status: %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// jwk is a JSON Web Key as published in a JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA or EC key. Other key types are skipped.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	default:
+		return nil, nil
+	}
+}
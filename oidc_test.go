@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIssuer serves OIDC discovery and a JWKS holding the given keys. Keys
+// given as a map[string]string are served as that JWK. While block holds a
+// channel, fetching the JWKS waits for it to close.
+type fakeIssuer struct {
+	*httptest.Server
+	keys        atomic.Pointer[map[string]crypto.PublicKey]
+	jwksFetches atomic.Int32
+	block       atomic.Pointer[chan struct{}]
+}
+
+func newFakeIssuer(t *testing.T, keys map[string]crypto.PublicKey) *fakeIssuer {
+	t.Helper()
+	iss := &fakeIssuer{}
+	iss.keys.Store(&keys)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.URL, "jwks_uri": iss.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.jwksFetches.Add(1)
+		if block := iss.block.Load(); block != nil {
+			<-*block
+		}
+		var set []map[string]string
+		for kid, key := range *iss.keys.Load() {
+			switch key := key.(type) {
+			case *rsa.PublicKey:
+				set = append(set, map[string]string{
+					"kty": "RSA", "kid": kid, "use": "sig",
+					"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			case *ecdsa.PublicKey:
+				point, _ := key.Bytes()
+				set = append(set, map[string]string{
+					"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": base64.RawURLEncoding.EncodeToString(point[1:33]),
+					"y": base64.RawURLEncoding.EncodeToString(point[33:]),
+				})
+			case map[string]string:
+				set = append(set, key)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": set})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// signJWT builds a token signed with an RSA or P-256 key
+func signJWT(t *testing.T, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// TestOIDCVerify tests signature, claim, and role mapping checks on JWTs
+func TestOIDCVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	iss := newFakeIssuer(t, map[string]crypto.PublicKey{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+		// Keys that can't be parsed are skipped
+		"p521":    map[string]string{"kty": "EC", "kid": "p521", "crv": "P-521", "x": "AA", "y": "AA"},
+		"rsa-bad": map[string]string{"kty": "RSA", "kid": "rsa-bad", "n": "AQAB", "e": "AQABAQAB"},
+	})
+
+	cfg := defaultConfig()
+	cfg.OIDCIssuer = iss.URL
+	cfg.OIDCAudience = "forecast"
+	cfg.OIDCTenantClaim = "org"
+	v := newOIDCVerifier(cfg)
+	now := time.Now()
+
+	claims := func(modify func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   iss.URL,
+			"aud":   []string{"forecast", "other"},
+			"sub":   "user-1",
+			"org":   "acme",
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"read", "subscribe", "unknown"},
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		expected    []string
+		expectError bool
+	}{
+		{name: "RS256", token: signJWT(t, "rsa", rsaKey, claims(nil)), expected: []string{"read", "subscribe"}},
+		{name: "ES256", token: signJWT(t, "ec", ecKey, claims(nil)), expected: []string{"read", "subscribe"}},
+		{name: "space-separated roles", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["roles"] = "admin" })), expected: []string{"admin"}},
+		{name: "string audience", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["aud"] = "forecast" })), expected: []string{"read", "subscribe"}},
+		{name: "expired", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() })), expectError: true},
+		{name: "not yet valid", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() })), expectError: true},
+		{name: "wrong issuer", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["iss"] = "https://evil.example.com" })), expectError: true},
+		{name: "wrong audience", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { c["aud"] = "other" })), expectError: true},
+		{name: "missing tenant", token: signJWT(t, "rsa", rsaKey, claims(func(c map[string]any) { delete(c, "org") })), expectError: true},
+		{name: "signed by another key", token: signJWT(t, "rsa", otherKey, claims(nil)), expectError: true},
+		{name: "unknown key ID", token: signJWT(t, "missing", rsaKey, claims(nil)), expectError: true},
+		{name: "unparsable key", token: signJWT(t, "p521", rsaKey, claims(nil)), expectError: true},
+		{name: "alg none", token: "eyJhbGciOiJub25lIiwia2lkIjoicnNhIn0.e30.", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := v.verify(t.Context(), tt.token, now)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key.ID != "oidc:user-1" || key.Owner != "acme" || len(key.Roles) != len(tt.expected) {
+				t.Fatalf("unexpected key %+v", key)
+			}
+			for i, role := range tt.expected {
+				if key.Roles[i] != role {
+					t.Errorf("expected roles %v, got %v", tt.expected, key.Roles)
+				}
+			}
+		})
+	}
+}
+
+// TestOIDCKeyRotation tests that the JWKS is cached and refetched for new keys
+func TestOIDCKeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	iss := newFakeIssuer(t, map[string]crypto.PublicKey{"old": &oldKey.PublicKey})
+
+	cfg := defaultConfig()
+	cfg.OIDCIssuer = iss.URL
+	v := newOIDCVerifier(cfg)
+	now := time.Now()
+	claims := map[string]any{"iss": iss.URL, "sub": "user-1", "exp": now.Add(time.Hour).Unix()}
+
+	for range 3 {
+		if _, err := v.verify(t.Context(), signJWT(t, "old", oldKey, claims), now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := iss.jwksFetches.Load(); n != 1 {
+		t.Errorf("expected keys to be cached, got %d fetches", n)
+	}
+
+	// The issuer rotates; the new key is picked up once the refresh limit passes
+	iss.keys.Store(&map[string]crypto.PublicKey{"new": &newKey.PublicKey})
+	token := signJWT(t, "new", newKey, claims)
+	if _, err := v.verify(t.Context(), token, now.Add(time.Second)); err == nil {
+		t.Error("expected unknown key to fail within the refresh limit")
+	}
+	if _, err := v.verify(t.Context(), token, now.Add(2*jwksMinRefresh)); err != nil {
+		t.Errorf("expected rotated key to verify, got %v", err)
+	}
+	if n := iss.jwksFetches.Load(); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+}
+
+// TestOIDCRefreshUnlocked tests that cached keys keep verifying while the
+// JWKS is being refetched, and that concurrent refetches share one fetch
+func TestOIDCRefreshUnlocked(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	iss := newFakeIssuer(t, map[string]crypto.PublicKey{"old": &oldKey.PublicKey})
+
+	cfg := defaultConfig()
+	cfg.OIDCIssuer = iss.URL
+	v := newOIDCVerifier(cfg)
+	now := time.Now()
+	claims := map[string]any{"iss": iss.URL, "sub": "user-1", "exp": now.Add(time.Hour).Unix()}
+	if _, err := v.verify(t.Context(), signJWT(t, "old", oldKey, claims), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	iss.keys.Store(&map[string]crypto.PublicKey{"old": &oldKey.PublicKey, "new": &newKey.PublicKey})
+	block := make(chan struct{})
+	iss.block.Store(&block)
+	release := sync.OnceFunc(func() { close(block) })
+	t.Cleanup(release)
+	later := now.Add(2 * jwksMinRefresh)
+	token := signJWT(t, "new", newKey, claims)
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := v.verify(t.Context(), token, later)
+			errs <- err
+		}()
+	}
+	for iss.jwksFetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	oldToken := signJWT(t, "old", oldKey, claims)
+	cached := make(chan error, 1)
+	go func() {
+		_, err := v.verify(t.Context(), oldToken, later)
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Errorf("expected the cached key to verify during the fetch, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the cached key to verify without waiting for the fetch")
+	}
+	release()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("expected the new key to verify, got %v", err)
+		}
+	}
+	if n := iss.jwksFetches.Load(); n != 2 {
+		t.Errorf("expected the refetches to share one fetch, got %d fetches", n)
+	}
+}
+
+// TestJWTAuthentication tests JWTs through the route middleware
+func TestJWTAuthentication(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	iss := newFakeIssuer(t, map[string]crypto.PublicKey{"k1": &key.PublicKey})
+
+	cfg := defaultConfig()
+	cfg.OIDCIssuer = iss.URL
+	cfg.AuthRequired = true
+	srv := newServer(cfg)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if apiKeyFromContext(r.Context()).Owner != "user-1" {
+			t.Errorf("expected the token subject as owner")
+		}
+	}
+
+	token := signJWT(t, "k1", key, map[string]any{
+		"iss": iss.URL, "sub": "user-1", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"read"},
+	})
+	tests := []struct {
+		scope    string
+		token    string
+		expected int
+	}{
+		{scope: scopeRead, token: token, expected: http.StatusOK},
+		{scope: scopeAdmin, token: token, expected: http.StatusForbidden},
+		{scope: scopeRead, token: token[:len(token)-4] + "AAAA", expected: http.StatusUnauthorized},
+		{scope: scopeRead, expected: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		srv.requireScope(tt.scope, ok)(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.scope, tt.expected, w.Code)
+		}
+	}
+}
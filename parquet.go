@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// This file writes the subset of Apache Parquet needed for archive exports: a
+// flat schema of optional columns, stored as one row group with a single
+// uncompressed, PLAIN encoded data page per column. Metadata is serialized with
+// the Thrift compact protocol as the format requires.
+
+// parquetKind is the type of a column's values
+type parquetKind int
+
+const (
+	// parquetString columns hold strings
+	parquetString parquetKind = iota
+	// parquetDouble columns hold float64s
+	parquetDouble
+	// parquetInt32 columns hold ints
+	parquetInt32
+	// parquetTimestamp columns hold time.Times, stored as UTC milliseconds
+	parquetTimestamp
+)
+
+// parquetColumn is a named column of values; nil values are nulls
+type parquetColumn struct {
+	Name   string
+	Kind   parquetKind
+	Values []any
+}
+
+// Parquet enum values from parquet.thrift
+const (
+	parquetTypeInt32     = 1
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetOptional = 1
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetPageData = 0
+)
+
+// physicalType returns the Parquet type and converted type of a kind, -1 when
+// there is no converted type
+func (k parquetKind) physicalType() (int32, int32) {
+	switch k {
+	case parquetString:
+		return parquetTypeByteArray, parquetConvertedUTF8
+	case parquetDouble:
+		return parquetTypeDouble, -1
+	case parquetInt32:
+		return parquetTypeInt32, -1
+	default:
+		return parquetTypeInt64, parquetConvertedTimestampMillis
+	}
+}
+
+// encodePage returns the body of a data page holding a column: its definition
+// levels followed by its non-null values
+func (c parquetColumn) encodePage() ([]byte, error) {
+	// Definition levels are one bit each, written as a single bit-packed run
+	// of the RLE/bit-packing hybrid and prefixed by their length
+	groups := (len(c.Values) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	bits := make([]byte, groups)
+	var values []byte
+	for i, v := range c.Values {
+		if v == nil {
+			continue
+		}
+		bits[i/8] |= 1 << (i % 8)
+		switch c.Kind {
+		case parquetString:
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("column %s: expected a string, got %T", c.Name, v)
+			}
+			values = binary.LittleEndian.AppendUint32(values, uint32(len(s)))
+			values = append(values, s...)
+		case parquetDouble:
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("column %s: expected a float64, got %T", c.Name, v)
+			}
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(f))
+		case parquetInt32:
+			n, ok := v.(int)
+			if !ok {
+				return nil, fmt.Errorf("column %s: expected an int, got %T", c.Name, v)
+			}
+			values = binary.LittleEndian.AppendUint32(values, uint32(int32(n)))
+		case parquetTimestamp:
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("column %s: expected a time, got %T", c.Name, v)
+			}
+			values = binary.LittleEndian.AppendUint64(values, uint64(t.UnixMilli()))
+		}
+	}
+	levels = append(levels, bits...)
+
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	return append(page, values...), nil
+}
+
+// writeParquet writes columns of equal length as a Parquet file
+func writeParquet(w io.Writer, columns []parquetColumn) error {
+	rows := 0
+	if len(columns) > 0 {
+		rows = len(columns[0].Values)
+	}
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(columns))
+	for i, c := range columns {
+		if len(c.Values) != rows {
+			return fmt.Errorf("column %s has %d values, want %d", c.Name, len(c.Values), rows)
+		}
+		page, err := c.encodePage()
+		if err != nil {
+			return err
+		}
+		var header thriftWriter
+		header.i32Field(1, parquetPageData)
+		header.i32Field(2, int32(len(page)))
+		header.i32Field(3, int32(len(page)))
+		header.structField(5)
+		header.i32Field(1, int32(rows))
+		header.i32Field(2, parquetEncodingPlain)
+		header.i32Field(3, parquetEncodingRLE)
+		header.i32Field(4, parquetEncodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunks[i].offset = int64(file.Len())
+		file.Write(header.buf.Bytes())
+		file.Write(page)
+		chunks[i].size = int64(file.Len()) - chunks[i].offset
+	}
+
+	var meta thriftWriter
+	meta.i32Field(1, 1)
+	meta.listField(2, thriftStruct, len(columns)+1)
+	meta.structBegin()
+	meta.binaryField(4, "schema")
+	meta.i32Field(5, int32(len(columns)))
+	meta.structEnd()
+	for _, c := range columns {
+		typ, converted := c.Kind.physicalType()
+		meta.structBegin()
+		meta.i32Field(1, typ)
+		meta.i32Field(3, parquetOptional)
+		meta.binaryField(4, c.Name)
+		if converted >= 0 {
+			meta.i32Field(6, converted)
+		}
+		meta.structEnd()
+	}
+	meta.i64Field(3, int64(rows))
+	meta.listField(4, thriftStruct, 1)
+	meta.structBegin()
+	meta.listField(1, thriftStruct, len(columns))
+	var total int64
+	for i, c := range columns {
+		typ, _ := c.Kind.physicalType()
+		meta.structBegin()
+		meta.i64Field(2, chunks[i].offset)
+		meta.structField(3)
+		meta.i32Field(1, typ)
+		meta.listField(2, thriftI32, 2)
+		meta.i32(parquetEncodingPlain)
+		meta.i32(parquetEncodingRLE)
+		meta.listField(3, thriftBinary, 1)
+		meta.binary(c.Name)
+		meta.i32Field(4, 0) // uncompressed
+		meta.i64Field(5, int64(rows))
+		meta.i64Field(6, chunks[i].size)
+		meta.i64Field(7, chunks[i].size)
+		meta.i64Field(9, chunks[i].offset)
+		meta.structEnd()
+		meta.structEnd()
+		total += chunks[i].size
+	}
+	meta.i64Field(2, total)
+	meta.i64Field(3, int64(rows))
+	meta.structEnd()
+	meta.binaryField(6, "forecast")
+	meta.structEnd()
+
+	file.Write(meta.buf.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.buf.Len())))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol type IDs
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter serializes structs with the Thrift compact protocol. Fields are
+// written in ascending ID order; each struct, including the outermost one, is
+// closed with structEnd.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastField is the last field ID written in the current struct, and
+	// parents those of the structs enclosing it
+	lastField int16
+	parents   []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.lastField; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftWriter) i32(v int32) { t.zigzag(int64(v)) }
+
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32Field(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.i32(v)
+}
+
+func (t *thriftWriter) i64Field(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binaryField(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.binary(s)
+}
+
+// listField starts a list field of n elements, which are written next
+func (t *thriftWriter) listField(id int16, elem byte, n int) {
+	t.fieldHeader(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+// structField starts a struct field, whose fields are written next
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structBegin()
+}
+
+// structBegin starts a struct that is a list element
+func (t *thriftWriter) structBegin() {
+	t.parents = append(t.parents, t.lastField)
+	t.lastField = 0
+}
+
+// structEnd closes the current struct
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	if n := len(t.parents); n > 0 {
+		t.lastField = t.parents[n-1]
+		t.parents = t.parents[:n-1]
+	}
+}
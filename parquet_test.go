@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// TestParquetEncodePage tests definition levels and PLAIN encoded values
+func TestParquetEncodePage(t *testing.T) {
+	tests := []struct {
+		name     string
+		column   parquetColumn
+		expected []byte
+	}{
+		{
+			name:   "strings with a null",
+			column: parquetColumn{Kind: parquetString, Values: []any{"ab", nil}},
+			// levels: length 2, one bit-packed group with only the first value defined
+			expected: []byte{2, 0, 0, 0, 0x03, 0x01, 2, 0, 0, 0, 'a', 'b'},
+		},
+		{
+			name:     "ints",
+			column:   parquetColumn{Kind: parquetInt32, Values: []any{-1}},
+			expected: []byte{2, 0, 0, 0, 0x03, 0x01, 0xff, 0xff, 0xff, 0xff},
+		},
+		{
+			name:     "timestamps",
+			column:   parquetColumn{Kind: parquetTimestamp, Values: []any{time.UnixMilli(258)}},
+			expected: []byte{2, 0, 0, 0, 0x03, 0x01, 2, 1, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:     "empty",
+			column:   parquetColumn{Kind: parquetDouble},
+			expected: []byte{1, 0, 0, 0, 0x01},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.column.encodePage()
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("expected % x, got % x", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := (parquetColumn{Name: "t", Kind: parquetDouble, Values: []any{"warm"}}).encodePage(); err == nil {
+		t.Error("expected an error for a value of the wrong type")
+	}
+}
+
+// TestThriftWriter tests compact protocol field headers, including IDs too far
+// apart for a delta
+func TestThriftWriter(t *testing.T) {
+	var w thriftWriter
+	w.i32Field(1, 1)
+	w.i64Field(3, -1)
+	w.binaryField(20, "x")
+	w.structField(21)
+	w.i32Field(1, 0)
+	w.structEnd()
+	w.structEnd()
+	expected := []byte{
+		0x15, 0x02, // field 1 i32 1
+		0x26, 0x01, // field 3 i64 -1
+		0x08, 0x28, 0x01, 'x', // field 20 binary, long form header
+		0x1c,       // field 21 struct
+		0x15, 0x00, // field 1 i32 0
+		0x00, // end of inner struct
+		0x00, // end of outer struct
+	}
+	if !bytes.Equal(w.buf.Bytes(), expected) {
+		t.Errorf("expected % x, got % x", expected, w.buf.Bytes())
+	}
+}
+
+// TestWriteParquet tests the file layout: magic bytes around the data and a
+// footer whose length is recorded before the closing magic
+func TestWriteParquet(t *testing.T) {
+	var buf bytes.Buffer
+	columns := []parquetColumn{
+		{Name: "forecast", Kind: parquetString, Values: []any{"Sunny", "Rain"}},
+		{Name: "temperatureC", Kind: parquetDouble, Values: []any{21.5, nil}},
+	}
+	if err := writeParquet(&buf, columns); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("expected PAR1 magic bytes, got % x", data)
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		t.Fatalf("unexpected footer length %d in a %d byte file", footer, len(data))
+	}
+	meta := data[len(data)-8-footer : len(data)-8]
+	// The footer starts with version 1 and names every column
+	if !bytes.HasPrefix(meta, []byte{0x15, 0x02}) || !bytes.Contains(meta, []byte("temperatureC")) {
+		t.Errorf("unexpected footer % x", meta)
+	}
+
+	columns[1].Values = columns[1].Values[:1]
+	if err := writeParquet(&buf, columns); err == nil {
+		t.Error("expected an error for columns of different lengths")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestPDFText tests escaping and encoding text for PDF strings
+func TestPDFText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "Sunny", expected: "Sunny"},
+		{input: `High (est.) \ low`, expected: `High \(est.\) \\ low`},
+		{input: "22°C", expected: `22\260C`},
+		{input: "Snow ❄", expected: "Snow ?"},
+	}
+
+	for _, tt := range tests {
+		if got := pdfText(tt.input); got != tt.expected {
+			t.Errorf("pdfText(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestWritePDF tests that documents are paginated with a valid cross-reference table
+func TestWritePDF(t *testing.T) {
+	lines := make([]string, pdfLinesPerPage+1)
+	for i := range lines {
+		lines[i] = "Line " + strconv.Itoa(i)
+	}
+	var buf bytes.Buffer
+	if err := writePDF(&buf, lines); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") || !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Fatal("expected a PDF header and trailer")
+	}
+	if !strings.Contains(doc, "/Count 2") {
+		t.Error("expected two pages")
+	}
+	if !strings.Contains(doc, "(Line 0) Tj") || !strings.Contains(doc, "(Line "+strconv.Itoa(pdfLinesPerPage)+") Tj") {
+		t.Error("expected every line to be drawn")
+	}
+
+	// startxref must point at the table, and every entry at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	if m == nil {
+		t.Fatal("expected startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n0 8\n") {
+		t.Fatalf("expected an xref table of 8 entries at %d", xref)
+	}
+	entries := strings.Split(doc[xref:], "\n")[3:10]
+	for i, entry := range entries {
+		off, _ := strconv.Atoi(entry[:10])
+		if want := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(doc[off:], want) {
+			t.Errorf("expected xref entry %d to point at %q", i+1, want)
+		}
+	}
+}
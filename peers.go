@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replicas listed in FORECAST_CACHE_PEERS fill their NWS caches from each
+// other, as groupcache does. Each cache key is owned by one peer, picked by
+// consistent hashing, and on a miss the other peers ask the owner for it
+// instead of NWS, so a fleet fetches each forecast from NWS once. The owner
+// answers from its cache or fetches the response itself, and the asking peer
+// keeps a copy for the same TTL. When the owner can't be reached, the peer
+// goes to NWS directly.
+
+const (
+	// peerTokenHeader carries FORECAST_CACHE_PEER_SECRET on requests between
+	// peers
+	peerTokenHeader = "X-Forecast-Peer-Token"
+	// peerAnswerHeader marks a peer's answer as coming from NWS or its
+	// cache, telling NWS errors apart from the peer failing
+	peerAnswerHeader = "X-Forecast-Peer-Answer"
+)
+
+// errPeerUnavailable is returned by peerNWSRequest when the peer couldn't
+// answer, and the caller should go to NWS itself
+var errPeerUnavailable = errors.New("cache peer unavailable")
+
+// peerClient sends cache fills to peers; a peer that doesn't answer promptly
+// is skipped
+var peerClient = &http.Client{Timeout: 5 * time.Second}
+
+var (
+	// nwsPeerFills counts cache misses answered by the owning peer
+	nwsPeerFills = expvar.NewInt("forecast_nws_peer_fills")
+	// nwsPeerFailures counts owning peers that couldn't be reached
+	nwsPeerFailures = expvar.NewInt("forecast_nws_peer_failures")
+)
+
+// parseCachePeers splits a comma-separated list of peer base URLs
+func parseCachePeers(list string) ([]string, error) {
+	var peers []string
+	for _, peer := range strings.Split(list, ",") {
+		peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+		if peer == "" {
+			continue
+		}
+		u, err := url.Parse(peer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("peer %q must be an http or https URL", peer)
+		}
+		if !slices.Contains(peers, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, nil
+}
+
+// peerRing returns the hash ring of the configured peers, empty when there
+// are none
+func (s *server) peerRing() *hashRing {
+	// The list was checked when the configuration was loaded
+	peers, _ := parseCachePeers(s.state.Config().CachePeers)
+	ring := s.peers.Load()
+	if ring == nil || !slices.Equal(ring.nodes, peers) {
+		ring = newHashRing(peers)
+		s.peers.Store(ring)
+	}
+	return ring
+}
+
+// cachePeer returns the peer owning key, or "" when there are no peers or
+// this replica owns it
+func (s *server) cachePeer(key string) string {
+	cfg := s.state.Config()
+	if cfg.CachePeers == "" {
+		return ""
+	}
+	if owner := s.peerRing().get(key); owner != strings.TrimRight(cfg.CachePeerSelf, "/") {
+		return owner
+	}
+	return ""
+}
+
+// peerNWSRequest asks peer for the response cached under key, which it
+// fetches from url on a miss. The peer's Cache-Control header tells how much
+// longer the response is fresh. It returns errPeerUnavailable when the peer
+// couldn't answer.
+func (s *server) peerNWSRequest(ctx context.Context, peer, key, nwsURL string, ttl time.Duration) ([]byte, http.Header, int, error) {
+	query := url.Values{"key": {key}, "url": {nwsURL}, "ttl": {ttl.String()}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/peer/nws?"+query.Encode(), nil)
+	if err != nil {
+		return nil, nil, 0, errPeerUnavailable
+	}
+	req.Header.Set(peerTokenHeader, s.state.Config().CachePeerSecret)
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		nwsPeerFailures.Add(1)
+		log.Printf("Failed to fill %s from peer %s: %v", key, peer, err)
+		return nil, nil, 0, errPeerUnavailable
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.Header.Get(peerAnswerHeader) == "" {
+		nwsPeerFailures.Add(1)
+		log.Printf("Failed to fill %s from peer %s: status %d", key, peer, resp.StatusCode)
+		return nil, nil, 0, errPeerUnavailable
+	}
+	nwsPeerFills.Add(1)
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, resp.StatusCode, errors.New(strings.TrimSpace(string(body)))
+	}
+	return body, resp.Header, http.StatusOK, nil
+}
+
+// peerHandler answers a peer's cache fill from this replica's cache, or from
+// NWS on a miss. Only NWS URLs are fetched, so the route can't be used to
+// reach other hosts.
+func (s *server) peerHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := s.state.Config()
+	token := r.Header.Get(peerTokenHeader)
+	if cfg.CachePeerSecret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.CachePeerSecret)) != 1 {
+		http.Error(w, "Invalid peer token", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	key, nwsURL := q.Get("key"), q.Get("url")
+	ttl, err := parseDuration(q.Get("ttl"))
+	if key == "" || !strings.HasPrefix(nwsURL, cfg.NWSAPIHost+"/") || err != nil || ttl <= 0 {
+		http.Error(w, "Invalid key, url, or ttl parameter", http.StatusBadRequest)
+		return
+	}
+
+	body, fresh, ok := s.nwsCache.lookup(key)
+	if ok {
+		nwsCacheHits.Add(1)
+	} else {
+		nwsCacheMisses.Add(1)
+		var statusCode int
+		body, statusCode, err = s.fetchNWS(r.Context(), key, nwsURL, ttl)
+		if err != nil {
+			w.Header().Set(peerAnswerHeader, "nws")
+			http.Error(w, err.Error(), statusCode)
+			return
+		}
+		// fetchNWS cached the response for as long as NWS allowed, if at all
+		_, fresh, _ = s.nwsCache.lookup(key)
+	}
+	w.Header().Set(peerAnswerHeader, "nws")
+	if seconds := int(fresh / time.Second); seconds > 0 {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(seconds))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCachePeers tests that replicas fill their caches from the peer owning
+// each response, so NWS is asked once across them, whatever case their JSON
+// responses are configured to use
+func TestCachePeers(t *testing.T) {
+	for _, jsonCase := range []string{jsonCaseCamel, jsonCaseSnake} {
+		t.Run(jsonCase, func(t *testing.T) {
+			nws := newFakeDoer(map[string]fakeResponse{
+				"/points/":                        {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast"}}`},
+				"/gridpoints/SEW/124,67/forecast": {body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`},
+			})
+			var servers []*server
+			var urls []string
+			for range 2 {
+				var srv *server
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { srv.routes().ServeHTTP(w, r) }))
+				defer ts.Close()
+				srv = newServer(Config{})
+				srv.nws = nws
+				servers = append(servers, srv)
+				urls = append(urls, ts.URL)
+			}
+			for i, srv := range servers {
+				srv.state.Store(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: time.Minute, CachePeers: strings.Join(urls, ","), CachePeerSelf: urls[i], CachePeerSecret: "peer-secret", JSONCase: jsonCase})
+			}
+
+			for _, srv := range servers {
+				w := httptest.NewRecorder()
+				srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+				if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Partly Cloudy") {
+					t.Fatalf("expected the forecast, got %d: %s", w.Code, w.Body.String())
+				}
+			}
+			if len(nws.paths()) != 2 {
+				t.Errorf("expected the point and forecast to be fetched once, got %v", nws.paths())
+			}
+			for i, srv := range servers {
+				if _, ok := srv.nwsCache.get("points/47.6062,-122.3321"); !ok {
+					t.Errorf("expected replica %d to cache the point", i)
+				}
+			}
+		})
+	}
+
+	// A replica whose peer is down goes to NWS itself
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`})
+	down := newServer(Config{NWSAPIHost: fakeNWSHost, NWSCacheTTL: time.Minute, CachePeers: "http://127.0.0.1:1,http://self", CachePeerSelf: "http://self", CachePeerSecret: "peer-secret"})
+	down.nws = nws
+	w := httptest.NewRecorder()
+	down.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200 without the peer, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestPeerHandler tests that peer fills need the peer secret and an NWS URL
+func TestPeerHandler(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, CachePeers: "http://self", CachePeerSelf: "http://self", CachePeerSecret: "peer-secret"})
+	srv.nws = newFakeDoer(map[string]fakeResponse{"/stations/": {status: http.StatusNotFound}})
+	tests := []struct {
+		name     string
+		query    string
+		token    string
+		expected int
+	}{
+		{name: "missing token", query: "key=k&url=" + fakeNWSHost + "/stations/KSEA&ttl=1m", expected: http.StatusForbidden},
+		{name: "wrong token", query: "key=k&url=" + fakeNWSHost + "/stations/KSEA&ttl=1m", token: "guess", expected: http.StatusForbidden},
+		{name: "other host", query: "key=k&url=http://internal.example.com/&ttl=1m", token: "peer-secret", expected: http.StatusBadRequest},
+		{name: "missing ttl", query: "key=k&url=" + fakeNWSHost + "/stations/KSEA", token: "peer-secret", expected: http.StatusBadRequest},
+		{name: "NWS error passed on", query: "key=k&url=" + fakeNWSHost + "/stations/KSEA&ttl=1m", token: "peer-secret", expected: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/peer/nws?"+tt.query, nil)
+			r.Header.Set(peerTokenHeader, tt.token)
+			w := httptest.NewRecorder()
+			srv.peerHandler(w, r)
+			if w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestPeerHandlerFreshness tests that peers tell how much longer a response is
+// fresh, so the replica asking caches it no longer than NWS allows
+func TestPeerHandlerFreshness(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, CachePeers: "http://self", CachePeerSelf: "http://self", CachePeerSecret: "peer-secret"})
+	srv.nwsCache = newNWSCache(clk, 0)
+	srv.nws = newFakeDoer(map[string]fakeResponse{
+		"/stations/KSEA": {body: `{}`, header: http.Header{"Cache-Control": {"max-age=300"}}},
+		"/stations/KBFI": {body: `{}`, header: http.Header{"Cache-Control": {"no-store"}}},
+	})
+	tests := []struct {
+		station  string
+		advance  time.Duration
+		expected string
+	}{
+		{station: "KSEA", expected: "max-age=300"},
+		{station: "KSEA", advance: time.Minute, expected: "max-age=240"},
+		{station: "KBFI", expected: "no-store"},
+	}
+	for _, tt := range tests {
+		clk.Advance(tt.advance)
+		r := httptest.NewRequest("GET", "/peer/nws?key="+tt.station+"&url="+fakeNWSHost+"/stations/"+tt.station+"&ttl=1h", nil)
+		r.Header.Set(peerTokenHeader, "peer-secret")
+		w := httptest.NewRecorder()
+		srv.peerHandler(w, r)
+		if got := w.Header().Get("Cache-Control"); got != tt.expected {
+			t.Errorf("expected Cache-Control %q for %s, got %q", tt.expected, tt.station, got)
+		}
+	}
+}
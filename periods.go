@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// forecastPeriod is one period of the /forecast/periods response, such as
+// "Tonight", with the temperature both in °C and as /forecast categorizes it
+type forecastPeriod struct {
+	Name                     string    `json:"name"`
+	StartTime                time.Time `json:"startTime"`
+	EndTime                  time.Time `json:"endTime"`
+	IsDaytime                bool      `json:"isDaytime"`
+	Forecast                 string    `json:"forecast"`
+	DetailedForecast         string    `json:"detailedForecast,omitempty"`
+	ConditionCode            string    `json:"conditionCode"`
+	TemperatureC             float64   `json:"temperatureC"`
+	Temperature              string    `json:"temperature"`
+	WindSpeedKPH             *float64  `json:"windSpeedKph,omitempty"`
+	WindDirection            string    `json:"windDirection,omitempty"`
+	PrecipitationProbability *int      `json:"precipitationProbability,omitempty"`
+}
+
+// periodsResponse is the body of /forecast/periods
+type periodsResponse struct {
+	Latitude  float64              `json:"latitude"`
+	Longitude float64              `json:"longitude"`
+	Elevation *elevationAdjustment `json:"elevation,omitempty"`
+	Periods   []forecastPeriod     `json:"periods"`
+}
+
+func (s *server) newForecastPeriod(p weatherPeriod) forecastPeriod {
+	return forecastPeriod{
+		Name:                     p.Name,
+		StartTime:                p.Start,
+		EndTime:                  p.End,
+		IsDaytime:                p.IsDaytime,
+		Forecast:                 p.Summary,
+		ConditionCode:            string(p.Condition),
+		TemperatureC:             p.TemperatureC,
+		Temperature:              s.periodOutput(p).Temperature,
+		WindSpeedKPH:             p.WindSpeedKPH,
+		WindDirection:            p.WindDirection,
+		PrecipitationProbability: p.PrecipitationProbability,
+	}
+}
+
+// parsePeriodCount reads the periods parameter limiting how many periods are
+// returned, 0 meaning all of them
+func parsePeriodCount(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("periods")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid periods parameter (want a positive number)")
+	}
+	return n, nil
+}
+
+// periodsHandler serves every twelve-hour period NWS forecasts for a point,
+// where /forecast reports only one, or the first ?periods= of them
+func (s *server) periodsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	count, err := parsePeriodCount(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lang, err := parseLang(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	detail, err := parseDetail(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	units, err := parseUnits(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	elevation, err := parseElevation(r, units)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	periods, statusCode, err := s.fetchPeriodsIn(r.Context(), lat, lon, false, units)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	if s.store != nil {
+		latitude, longitude := parsePoint(lat, lon)
+		s.archiveForecast(r.Context(), latitude, longitude, productForecast, periods)
+	}
+	if count > 0 && count < len(periods) {
+		periods = periods[:count]
+	}
+	periods, adjustment := s.adjustForElevation(periods, elevation)
+
+	resp := periodsResponse{Elevation: adjustment, Periods: make([]forecastPeriod, 0, len(periods))}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	texts := make([]*string, 0, 3*len(periods))
+	for _, p := range periods {
+		fp := s.newForecastPeriod(p)
+		if detail {
+			fp.DetailedForecast = p.Detail
+		}
+		localizeUnits(units, p.TextUnits, &fp.Name, &fp.Forecast, &fp.DetailedForecast)
+		resp.Periods = append(resp.Periods, fp)
+		last := &resp.Periods[len(resp.Periods)-1]
+		texts = append(texts, &last.Name, &last.Forecast, &last.DetailedForecast)
+	}
+	setContentLanguage(w, lang, s.translateTexts(r.Context(), lang, texts...))
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPeriodsHandler tests returning every forecast period, or the first few
+func TestPeriodsHandler(t *testing.T) {
+	forecast := `{"properties": {"periods": [
+		{"name": "This Afternoon", "startTime": "2024-06-01T14:00:00-07:00", "endTime": "2024-06-01T18:00:00-07:00", "isDaytime": true, "temperature": 88, "windSpeed": "10 mph", "shortForecast": "Sunny", "detailedForecast": "Sunny, with a high near 88."},
+		{"name": "Tonight", "startTime": "2024-06-01T18:00:00-07:00", "endTime": "2024-06-02T06:00:00-07:00", "temperature": 55, "shortForecast": "Clear"},
+		{"name": "Sunday", "startTime": "2024-06-02T06:00:00-07:00", "endTime": "2024-06-02T18:00:00-07:00", "isDaytime": true, "temperature": 62, "probabilityOfPrecipitation": {"value": 70}, "shortForecast": "Rain Likely"}
+	]}}`
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedNames  []string
+	}{
+		{name: "all", expectedStatus: http.StatusOK, expectedNames: []string{"This Afternoon", "Tonight", "Sunday"}},
+		{name: "first two", query: "&periods=2", expectedStatus: http.StatusOK, expectedNames: []string{"This Afternoon", "Tonight"}},
+		{name: "more than forecast", query: "&periods=14", expectedStatus: http.StatusOK, expectedNames: []string{"This Afternoon", "Tonight", "Sunday"}},
+		{name: "zero", query: "&periods=0", expectedStatus: http.StatusBadRequest},
+		{name: "not a number", query: "&periods=all", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			srv.nws = newFakeNWSDoer(fakeResponse{body: forecast})
+			w := httptest.NewRecorder()
+			srv.periodsHandler(w, httptest.NewRequest("GET", "/forecast/periods?latitude=47.6062&longitude=-122.3321"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp periodsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(resp.Periods) != len(tt.expectedNames) {
+				t.Fatalf("expected %d periods, got %d", len(tt.expectedNames), len(resp.Periods))
+			}
+			for i, name := range tt.expectedNames {
+				if resp.Periods[i].Name != name {
+					t.Errorf("expected period %d to be %q, got %q", i, name, resp.Periods[i].Name)
+				}
+			}
+			first := resp.Periods[0]
+			if first.Temperature != "hot" || first.Forecast != "Sunny" || !first.IsDaytime || first.StartTime.IsZero() || first.DetailedForecast != "" {
+				t.Errorf("unexpected first period %+v", first)
+			}
+		})
+	}
+}
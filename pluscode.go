@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Open Location Codes, or plus codes, name a small area by a code such as
+// 849VCWC8+R9. They're decoded here, without calling anyone, following the
+// specification at https://github.com/google/open-location-code.
+const (
+	// plusCodeAlphabet is the base 20 digits of a plus code
+	plusCodeAlphabet = "23456789CFGHJMPQRVWX"
+	// plusCodeSeparator follows the eighth digit of a full code
+	plusCodeSeparator = '+'
+	// plusCodePadding fills a full code shortened to a larger area
+	plusCodePadding = '0'
+	// plusCodePairDigits is the number of digits encoded as latitude and
+	// longitude pairs; those after them refine a 5 by 4 grid
+	plusCodePairDigits = 10
+	// plusCodeMaxDigits bounds the digits decoded, beyond which the area is
+	// smaller than a forecast could tell apart
+	plusCodeMaxDigits = 15
+)
+
+// plusCodePairResolutions are the degrees of each pair of digits
+var plusCodePairResolutions = []float64{20, 1, 0.05, 0.0025, 0.000125}
+
+// errInvalidPlusCode is returned for codes that aren't full plus codes
+var errInvalidPlusCode = errors.New("invalid plus code")
+
+// decodePlusCode returns the center of the area of a full plus code. Short
+// codes, such as CWC8+R9, need a nearby place to recover their first digits
+// and aren't accepted.
+func decodePlusCode(code string) (lat, lon float64, err error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	sep := strings.IndexByte(code, plusCodeSeparator)
+	if sep != 8 || strings.LastIndexByte(code, plusCodeSeparator) != sep {
+		return 0, 0, fmt.Errorf("%w: the separator must follow the eighth digit", errInvalidPlusCode)
+	}
+	digits, rest := code[:sep], code[sep+1:]
+	if len(rest) == 1 {
+		return 0, 0, fmt.Errorf("%w: a single digit after the separator", errInvalidPlusCode)
+	}
+	if pad := strings.IndexByte(digits, plusCodePadding); pad >= 0 {
+		if pad == 0 || pad%2 != 0 || strings.Trim(digits[pad:], string(plusCodePadding)) != "" || rest != "" {
+			return 0, 0, fmt.Errorf("%w: misplaced padding", errInvalidPlusCode)
+		}
+		digits = digits[:pad]
+	}
+	digits += rest
+	if len(digits) > plusCodeMaxDigits {
+		digits = digits[:plusCodeMaxDigits]
+	}
+	values := make([]int, len(digits))
+	for i := range digits {
+		if values[i] = strings.IndexByte(plusCodeAlphabet, digits[i]); values[i] < 0 {
+			return 0, 0, fmt.Errorf("%w: unexpected %q", errInvalidPlusCode, digits[i])
+		}
+	}
+	// The first pair counts 20 degree bands from the south pole and
+	// antimeridian, of which there are 9 and 18
+	if values[0] >= 9 || values[1] >= 18 {
+		return 0, 0, fmt.Errorf("%w: out of range", errInvalidPlusCode)
+	}
+
+	lat, lon = -90, -180
+	var latRes, lonRes float64
+	for i := 0; i < len(values) && i < plusCodePairDigits; i += 2 {
+		latRes, lonRes = plusCodePairResolutions[i/2], plusCodePairResolutions[i/2]
+		lat += float64(values[i]) * latRes
+		lon += float64(values[i+1]) * lonRes
+	}
+	for i := plusCodePairDigits; i < len(values); i++ {
+		latRes, lonRes = latRes/5, lonRes/4
+		lat += float64(values[i]/4) * latRes
+		lon += float64(values[i]%4) * lonRes
+	}
+	return min(lat+latRes/2, 90), lon + lonRes/2, nil
+}
+
+// plusCodePoint resolves the plus code of a request's pluscode parameter,
+// writing the error response and returning false when it can't
+func plusCodePoint(w http.ResponseWriter, code string) (lat, lon string, ok bool) {
+	latitude, longitude, err := decodePlusCode(code)
+	if err != nil {
+		http.Error(w, "Invalid pluscode parameter (want a full plus code such as 849VCWC8+R9)", http.StatusBadRequest)
+		return "", "", false
+	}
+	return strconv.FormatFloat(latitude, 'f', 4, 64), strconv.FormatFloat(longitude, 'f', 4, 64), true
+}
+
+// what3words addresses name a 3 meter square with three words, such as
+// ///filled.count.soap. Resolving one needs the what3words API, so it's only
+// enabled with a key. The resolver is a geocoder, and is cached like one.
+
+// what3wordsEndpoint is the public what3words conversion API, used unless
+// another is configured
+const what3wordsEndpoint = "https://api.what3words.com/v3/convert-to-coordinates"
+
+// normalizeW3W validates a what3words address, dropping a leading /// and
+// lowercasing it
+func normalizeW3W(address string) (string, error) {
+	address = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(address), "///"))
+	words := strings.Split(address, ".")
+	if len(words) != 3 {
+		return "", fmt.Errorf("%w: want three words", errInvalidGeocodeQuery)
+	}
+	for _, word := range words {
+		if word == "" || len(word) > 64 || strings.ContainsAny(word, " /?&#%\\") {
+			return "", fmt.Errorf("%w: invalid word %q", errInvalidGeocodeQuery, word)
+		}
+	}
+	return address, nil
+}
+
+// what3wordsResolver resolves what3words addresses with the what3words API
+type what3wordsResolver struct {
+	client   doer
+	endpoint string
+	key      string
+}
+
+func (r what3wordsResolver) geocode(ctx context.Context, query string) (geoPoint, error) {
+	words, err := normalizeW3W(query)
+	if err != nil {
+		return geoPoint{}, err
+	}
+	u, err := geocodeRequestURL(r.endpoint, url.Values{"words": {words}, "key": {r.key}})
+	if err != nil {
+		return geoPoint{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return geoPoint{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return geoPoint{}, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Coordinates *struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"coordinates"`
+		NearestPlace string `json:"nearestPlace"`
+		Error        *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		io.Copy(io.Discard, resp.Body)
+		return geoPoint{}, fmt.Errorf("what3words returned status: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return geoPoint{}, fmt.Errorf("failed to parse what3words response: %v", err)
+	}
+	switch {
+	case result.Error != nil && result.Error.Code == "BadWords":
+		// Words that aren't an address are reported as a 400 BadWords
+		return geoPoint{}, errLocationNotFound
+	case result.Error != nil:
+		return geoPoint{}, fmt.Errorf("what3words returned error %s", result.Error.Code)
+	case resp.StatusCode != http.StatusOK || result.Coordinates == nil:
+		return geoPoint{}, fmt.Errorf("what3words returned no coordinates")
+	}
+	return geoPoint{Latitude: result.Coordinates.Lat, Longitude: result.Coordinates.Lng, Name: result.NearestPlace}, nil
+}
+
+// newW3WResolver returns the what3words resolver configured by cfg, or nil
+// when what3words lookup is disabled
+func newW3WResolver(cfg Config, clk clock) geocoder {
+	if cfg.W3WKey == "" {
+		return nil
+	}
+	endpoint := cfg.W3WURL
+	if endpoint == "" {
+		endpoint = what3wordsEndpoint
+	}
+	return newCachingGeocoder(what3wordsResolver{client: geocodeClient, endpoint: endpoint, key: cfg.W3WKey}, clk)
+}
+
+// w3wPoint resolves the what3words address of a request's w3w parameter,
+// writing the error response and returning false when it can't
+func (s *server) w3wPoint(w http.ResponseWriter, r *http.Request, address string) (lat, lon string, ok bool) {
+	if s.w3w == nil {
+		http.Error(w, "what3words lookup isn't enabled on this server (use latitude and longitude)", http.StatusBadRequest)
+		return "", "", false
+	}
+	point, err := s.w3w.geocode(r.Context(), address)
+	switch {
+	case errors.Is(err, errInvalidGeocodeQuery):
+		http.Error(w, "Invalid w3w parameter (want a what3words address such as filled.count.soap)", http.StatusBadRequest)
+		return "", "", false
+	case errors.Is(err, errLocationNotFound):
+		http.Error(w, "what3words address not found", http.StatusNotFound)
+		return "", "", false
+	case err != nil:
+		log.Printf("Failed to resolve what3words address: %v", err)
+		http.Error(w, "Failed to resolve what3words address", http.StatusBadGateway)
+		return "", "", false
+	}
+	return strconv.FormatFloat(point.Latitude, 'f', 4, 64), strconv.FormatFloat(point.Longitude, 'f', 4, 64), true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDecodePlusCode tests decoding full plus codes to the center of their
+// area, and rejecting codes that aren't full plus codes
+func TestDecodePlusCode(t *testing.T) {
+	tests := []struct {
+		code        string
+		expectedLat float64
+		expectedLon float64
+		err         bool
+	}{
+		{code: "849VCWC8+R9", expectedLat: 37.4220625, expectedLon: -122.0840625},
+		{code: "849vcwc8+r9", expectedLat: 37.4220625, expectedLon: -122.0840625},
+		{code: " 84VVJM3Q+82 ", expectedLat: 47.6033125, expectedLon: -122.3124375},
+		{code: "849VCWC8+R9J", expectedLat: 37.4220875, expectedLon: -122.084109375},
+		{code: "849VCW00+", expectedLat: 37.425, expectedLon: -122.075},
+		{code: "CFX30000+", expectedLat: 89.5, expectedLon: 1.5},
+		{code: "CWC8+R9", err: true},
+		{code: "849VCWC8R9", err: true},
+		{code: "849VCWC8+R", err: true},
+		{code: "849VCWC8+R9+", err: true},
+		{code: "849V0WC8+", err: true},
+		{code: "849VC000+", err: true},
+		{code: "849VCW00+R9", err: true},
+		{code: "849VCWC8+A9", err: true},
+		{code: "F49VCWC8+R9", err: true},
+		{code: "8Y9VCWC8+R9", err: true},
+		{code: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			lat, lon, err := decodePlusCode(tt.code)
+			if tt.err {
+				if !errors.Is(err, errInvalidPlusCode) {
+					t.Errorf("expected errInvalidPlusCode, got %v, %v, %v", lat, lon, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if math.Abs(lat-tt.expectedLat) > 1e-9 || math.Abs(lon-tt.expectedLon) > 1e-9 {
+				t.Errorf("expected %v,%v, got %v,%v", tt.expectedLat, tt.expectedLon, lat, lon)
+			}
+		})
+	}
+}
+
+// TestWhat3WordsResolver tests resolving what3words addresses with the
+// what3words API
+func TestWhat3WordsResolver(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		response  fakeResponse
+		expected  geoPoint
+		invalid   bool
+		notFound  bool
+		expectErr bool
+	}{
+		{
+			name:     "address",
+			address:  "///Filled.Count.Soap",
+			response: fakeResponse{body: `{"coordinates": {"lng": -0.195543, "lat": 51.520847}, "words": "filled.count.soap", "nearestPlace": "Bayswater, London"}`},
+			expected: geoPoint{Latitude: 51.520847, Longitude: -0.195543, Name: "Bayswater, London"},
+		},
+		{name: "bad words", address: "filled.count.zzzz", response: fakeResponse{status: http.StatusBadRequest, body: `{"error": {"code": "BadWords", "message": "words must be a valid 3 word address"}}`}, notFound: true},
+		{name: "bad key", address: "filled.count.soap", response: fakeResponse{status: http.StatusUnauthorized, body: `{"error": {"code": "InvalidKey"}}`}, expectErr: true},
+		{name: "other error", address: "filled.count.soap", response: fakeResponse{status: http.StatusBadRequest, body: `{"error": {"code": "BadCoordinates"}}`}, expectErr: true},
+		{name: "no coordinates", address: "filled.count.soap", response: fakeResponse{body: `{}`}, expectErr: true},
+		{name: "two words", address: "filled.count", invalid: true},
+		{name: "empty word", address: "filled..soap", invalid: true},
+		{name: "injected parameter", address: "filled.count.soap&key=other", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeDoer(map[string]fakeResponse{"/": tt.response})
+			resolver := what3wordsResolver{client: client, endpoint: what3wordsEndpoint, key: "w3w-key"}
+			point, err := resolver.geocode(context.Background(), tt.address)
+			switch {
+			case tt.invalid:
+				if !errors.Is(err, errInvalidGeocodeQuery) {
+					t.Errorf("expected errInvalidGeocodeQuery, got %v", err)
+				}
+				if len(client.requests) != 0 {
+					t.Errorf("expected no request, got %v", client.requests)
+				}
+				return
+			case tt.notFound:
+				if !errors.Is(err, errLocationNotFound) {
+					t.Errorf("expected errLocationNotFound, got %v", err)
+				}
+			case tt.expectErr:
+				if err == nil || errors.Is(err, errLocationNotFound) {
+					t.Errorf("expected a provider error, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case point != tt.expected:
+				t.Errorf("expected %+v, got %+v", tt.expected, point)
+			}
+			if len(client.requests) != 1 {
+				t.Fatalf("expected one request, got %v", client.requests)
+			}
+			if q := client.requests[0].URL.Query(); q.Get("key") != "w3w-key" || q.Get("words") == "" || q.Get("words")[0] == '/' {
+				t.Errorf("expected the words and key as parameters, got %s", client.requests[0].URL)
+			}
+		})
+	}
+}
+
+// TestPlusCodeAndW3WForecast tests forecasts for a point given as a plus code
+// or a what3words address
+func TestPlusCodeAndW3WForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		w3w            bool
+		expectedStatus int
+		expectedPoint  string
+	}{
+		{name: "plus code", path: "/forecast?pluscode=84VVJM3Q%2B82", expectedStatus: http.StatusOK, expectedPoint: "/points/47.6033,-122.3124"},
+		{name: "invalid plus code", path: "/forecast?pluscode=JM3Q%2B82", expectedStatus: http.StatusBadRequest},
+		{name: "what3words", path: "/forecast?w3w=index.home.raft", w3w: true, expectedStatus: http.StatusOK, expectedPoint: "/points/47.6062,-122.3321"},
+		{name: "unknown what3words", path: "/forecast?w3w=index.home.nope", w3w: true, expectedStatus: http.StatusNotFound},
+		{name: "invalid what3words", path: "/forecast?w3w=index.home", w3w: true, expectedStatus: http.StatusBadRequest},
+		{name: "what3words disabled", path: "/forecast?w3w=index.home.raft", expectedStatus: http.StatusBadRequest},
+		{name: "coordinates win", path: "/forecast?pluscode=JM3Q%2B82&latitude=43.6166&longitude=-116.2009", expectedStatus: http.StatusOK, expectedPoint: "/points/43.6166,-116.2009"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			srv.nws = nws
+			if tt.w3w {
+				w3w := doerFunc(func(req *http.Request) (*http.Response, error) {
+					body := `{"error": {"code": "BadWords"}}`
+					status := http.StatusBadRequest
+					if req.URL.Query().Get("words") == "index.home.raft" {
+						body, status = `{"coordinates": {"lng": -122.33207, "lat": 47.60621}}`, http.StatusOK
+					}
+					return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+				})
+				srv.w3w = newCachingGeocoder(what3wordsResolver{client: w3w, endpoint: what3wordsEndpoint, key: "w3w-key"}, newFakeClock(time.Now()))
+			}
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusOK && nws.paths()[0] != tt.expectedPoint {
+				t.Errorf("expected %s to be looked up, got %v", tt.expectedPoint, nws.paths())
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// prefetchRuns and prefetchFailures count scheduled prefetches of kiosk
+	// locations and those that failed
+	prefetchRuns     = expvar.NewInt("forecast_prefetch_runs")
+	prefetchFailures = expvar.NewInt("forecast_prefetch_failures")
+)
+
+// prefetchLocation is a fixed location, such as a kiosk's, whose gridpoint
+// and forecasts are kept in the NWS cache, refreshed on a cron schedule
+type prefetchLocation struct {
+	Name      string  `yaml:"name"`
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Schedule  string  `yaml:"schedule"`
+
+	schedule cronSchedule
+}
+
+// key identifies a location and its schedule across reloads
+func (l prefetchLocation) key() string {
+	return fmt.Sprintf("%s\x00%v,%v\x00%s", l.Name, l.Latitude, l.Longitude, l.Schedule)
+}
+
+// point returns the location as a prewarm point
+func (l prefetchLocation) point() prewarmPoint {
+	return prewarmPoint{Latitude: strconv.FormatFloat(l.Latitude, 'f', 4, 64), Longitude: strconv.FormatFloat(l.Longitude, 'f', 4, 64)}
+}
+
+// loadPrefetchLocations returns the locations of a YAML or JSON file listing
+// them, or none when path is empty
+func loadPrefetchLocations(path string) ([]prefetchLocation, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("prefetch file: %v", err)
+	}
+	var locations []prefetchLocation
+	if err := yaml.Unmarshal(data, &locations); err != nil {
+		return nil, fmt.Errorf("prefetch file %s: %v", path, err)
+	}
+	for i := range locations {
+		l := &locations[i]
+		if l.Name == "" {
+			l.Name = fmt.Sprintf("%v,%v", l.Latitude, l.Longitude)
+		}
+		if l.Latitude < -90 || l.Latitude > 90 || l.Longitude < -180 || l.Longitude > 180 {
+			return nil, fmt.Errorf("prefetch file %s: %s: latitude must be within ±90 and longitude within ±180", path, l.Name)
+		}
+		if l.schedule, err = parseCron(l.Schedule); err != nil {
+			return nil, fmt.Errorf("prefetch file %s: %s: %v", path, l.Name, err)
+		}
+		if l.schedule.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("prefetch file %s: %s: schedule %q never runs", path, l.Name, l.Schedule)
+		}
+	}
+	return locations, nil
+}
+
+// prefetchLocations returns the locations of the configured prefetch file
+func (s *server) prefetchLocations() []prefetchLocation {
+	if l := s.prefetch.Load(); l != nil {
+		return *l
+	}
+	return nil
+}
+
+// prefetchJob keeps the prefetch locations warm. It checks them every
+// minute, the resolution of their schedules: each location is fetched when
+// it's first loaded and then on its schedule, and cached until the run after
+// next, so a failed refresh leaves the previous forecast in place and
+// requests for it never wait on NWS.
+func (s *server) prefetchJob() *job {
+	everyMinute, _ := parseCron("* * * * *")
+	due := map[string]time.Time{}
+	return &job{
+		name:     "prefetch",
+		schedule: func() (jobSchedule, error) { return everyMinute, nil },
+		run: func(ctx context.Context) error {
+			now := s.clock.Now()
+			current := map[string]bool{}
+			var errs []error
+			for _, l := range s.prefetchLocations() {
+				key := l.key()
+				current[key] = true
+				if next, ok := due[key]; ok && now.Before(next) {
+					continue
+				}
+				next := l.schedule.next(now)
+				due[key] = next
+				prefetchRuns.Add(1)
+				if err := s.prewarmPoint(ctx, l.point(), l.schedule.next(next).Sub(now), true); err != nil {
+					prefetchFailures.Add(1)
+					log.Printf("Prefetch of %s failed: %v", l.Name, err)
+					errs = append(errs, fmt.Errorf("%s: %v", l.Name, err))
+				}
+			}
+			for key := range due {
+				if !current[key] {
+					delete(due, key)
+				}
+			}
+			return errors.Join(errs...)
+		},
+		runAtStart: true,
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadPrefetchLocations tests reading kiosk locations from a file
+func TestLoadPrefetchLocations(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected []string
+		err      bool
+	}{
+		{
+			name: "locations",
+			contents: `
+- name: lobby
+  latitude: 47.6062
+  longitude: -122.3321
+  schedule: "*/15 * * * *"
+- latitude: 43.6
+  longitude: -116.2
+  schedule: "@hourly"
+`,
+			expected: []string{"lobby", "43.6,-116.2"},
+		},
+		{name: "invalid schedule", contents: `[{"name": "lobby", "latitude": 47.6, "longitude": -122.3, "schedule": "hourly"}]`, err: true},
+		{name: "never runs", contents: `[{"name": "lobby", "latitude": 47.6, "longitude": -122.3, "schedule": "0 0 31 4 *"}]`, err: true},
+		{name: "invalid point", contents: `[{"name": "lobby", "latitude": 147.6, "longitude": -122.3, "schedule": "@hourly"}]`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "prefetch.yaml")
+			if err := os.WriteFile(file, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			locations, err := loadPrefetchLocations(file)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", locations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(locations) != len(tt.expected) {
+				t.Fatalf("expected %d locations, got %d", len(tt.expected), len(locations))
+			}
+			for i, name := range tt.expected {
+				if locations[i].Name != name {
+					t.Errorf("expected location %d to be %s, got %s", i, name, locations[i].Name)
+				}
+			}
+		})
+	}
+}
+
+// TestPrefetcher tests refreshing kiosk locations on their schedules, so that
+// forecasts for them are served without calling NWS
+func TestPrefetcher(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 5, 10, 7, 30, 0, time.UTC))
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.clock = clk
+	srv.nwsCache = newNWSCache(clk, 0)
+	nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+	srv.nws = nws
+	sched, _ := parseCron("@hourly")
+	srv.prefetch.Store(&[]prefetchLocation{{Name: "lobby", Latitude: 47.6062, Longitude: -122.3321, Schedule: "@hourly", schedule: sched}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.jobs = newScheduler(clk)
+	srv.jobs.add(srv.prefetchJob())
+	srv.jobs.start(ctx)
+
+	// Fetched once loaded
+	clk.BlockUntil(t, 1)
+	if len(nws.paths()) != 2 {
+		t.Fatalf("expected the location to be fetched when loaded, got %v", nws.paths())
+	}
+	// Not again until the top of the hour
+	clk.Advance(time.Minute)
+	clk.BlockUntil(t, 1)
+	if len(nws.paths()) != 2 {
+		t.Fatalf("expected no fetch before the schedule, got %v", nws.paths())
+	}
+	clk.Advance(52 * time.Minute)
+	clk.BlockUntil(t, 1)
+	if len(nws.paths()) != 4 {
+		t.Fatalf("expected the location to be refreshed on schedule, got %v", nws.paths())
+	}
+
+	// Served from the cache until the run after next, even if a refresh fails
+	nws.responses["/points/"] = fakeResponse{status: http.StatusServiceUnavailable}
+	clk.Advance(time.Hour)
+	clk.BlockUntil(t, 1)
+	sent := len(nws.paths())
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(nws.paths()) != sent {
+		t.Errorf("expected a prefetched forecast not to call NWS, got %v", nws.paths()[sent:])
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPrewarmPoints bounds the points of one import, so that their
+	// gridpoints and forecasts fit in the NWS cache
+	maxPrewarmPoints = nwsCacheSize / 3
+	// maxPrewarmErrors bounds the failures a prewarm status lists
+	maxPrewarmErrors = 100
+)
+
+// prewarmPoint is a point of an imported CSV, formatted as NWS is asked for it
+type prewarmPoint struct {
+	// Row is the point's line in the CSV
+	Row       int
+	Latitude  string
+	Longitude string
+}
+
+// prewarmError is a point that couldn't be prewarmed
+type prewarmError struct {
+	Row       int     `json:"row"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Error     string  `json:"error"`
+}
+
+// prewarmStatus is the progress of a prewarm, the body of /admin/prewarm
+type prewarmStatus struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt,omitzero"`
+	Points     int            `json:"points"`
+	Warmed     int            `json:"warmed"`
+	Failed     int            `json:"failed"`
+	Errors     []prewarmError `json:"errors,omitempty"`
+}
+
+// prewarmJob tracks a prewarm running in the background
+type prewarmJob struct {
+	mu     sync.Mutex
+	status prewarmStatus
+	// done is closed when every point has been tried
+	done chan struct{}
+}
+
+// progress returns a copy of the job's status
+func (j *prewarmJob) progress() prewarmStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.Errors = append([]prewarmError(nil), j.status.Errors...)
+	return status
+}
+
+// running reports whether the job has points left to try
+func (j *prewarmJob) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// record counts a point as warmed or failed, returning how many points have
+// been tried
+func (j *prewarmJob) record(p prewarmPoint, err error) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err == nil {
+		j.status.Warmed++
+	} else {
+		j.status.Failed++
+		if len(j.status.Errors) < maxPrewarmErrors {
+			lat, lon := parsePoint(p.Latitude, p.Longitude)
+			j.status.Errors = append(j.status.Errors, prewarmError{Row: p.Row, Latitude: lat, Longitude: lon, Error: err.Error()})
+		}
+	}
+	return j.status.Warmed + j.status.Failed
+}
+
+// parsePrewarmCSV reads the points of a CSV with a latitude and a longitude
+// on each line. The first line may be a header naming the columns, latitude
+// or lat and longitude, lon, or lng, in which case other columns, such as a
+// store's name, are ignored; without one the first two columns are used.
+func parsePrewarmCSV(r io.Reader) ([]prewarmPoint, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+
+	latCol, lonCol, first := 0, 1, 0
+	if len(records) > 0 {
+		if _, err := strconv.ParseFloat(records[0][0], 64); err != nil {
+			latCol, lonCol, first = -1, -1, 1
+			for i, name := range records[0] {
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "latitude", "lat":
+					latCol = i
+				case "longitude", "lon", "lng":
+					lonCol = i
+				}
+			}
+			if latCol < 0 || lonCol < 0 {
+				return nil, fmt.Errorf("Invalid CSV header (want latitude and longitude columns)")
+			}
+		}
+	}
+
+	points := make([]prewarmPoint, 0, len(records)-first)
+	for i, record := range records[first:] {
+		row := first + i + 1
+		if len(record) <= max(latCol, lonCol) {
+			return nil, fmt.Errorf("Invalid CSV line %d (want a latitude and a longitude)", row)
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[latCol]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[lonCol]), 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("Invalid point on CSV line %d (latitude must be within ±90 and longitude within ±180)", row)
+		}
+		points = append(points, prewarmPoint{Row: row, Latitude: strconv.FormatFloat(lat, 'f', 4, 64), Longitude: strconv.FormatFloat(lon, 'f', 4, 64)})
+	}
+	if len(points) == 0 || len(points) > maxPrewarmPoints {
+		return nil, fmt.Errorf("Invalid CSV (want 1 to %d points)", maxPrewarmPoints)
+	}
+	return points, nil
+}
+
+// prewarmPoint resolves a point's gridpoint and fetches its forecasts into the
+// NWS cache for ttl. Unless refetch is set, forecasts already cached for
+// another point of the same gridpoint aren't fetched again.
+func (s *server) prewarmPoint(ctx context.Context, p prewarmPoint, ttl time.Duration, refetch bool) error {
+	pointsURL := fmt.Sprintf("%s/points/%s,%s", s.state.Config().NWSAPIHost, p.Latitude, p.Longitude)
+	body, _, _, err := s.makeNWSRequest(ctx, pointsURL)
+	if err != nil {
+		return err
+	}
+	var pointData PointResponse
+	if err := json.Unmarshal(body, &pointData); err != nil {
+		return fmt.Errorf("Failed to parse points response")
+	}
+	key, _ := pointCacheKey(p.Latitude, p.Longitude)
+	s.nwsCache.store(key, body, max(pointCacheTTL, ttl))
+
+	for _, forecastURL := range []string{pointData.Properties.Forecast, pointData.Properties.ForecastHourly} {
+		if forecastURL == "" {
+			continue
+		}
+		if _, ok := s.nwsCache.get(forecastURL); ok && !refetch {
+			continue
+		}
+		body, _, _, err := s.makeNWSRequest(ctx, forecastURL)
+		if err != nil {
+			return err
+		}
+		if _, err := (nwsNormalizer{}).normalize(body); err != nil {
+			return fmt.Errorf("Failed to parse forecast response")
+		}
+		s.nwsCache.store(forecastURL, body, ttl)
+	}
+	return nil
+}
+
+// runPrewarm warms the points of a job batchWorkers at a time, logging its
+// progress every tenth of the way
+func (s *server) runPrewarm(job *prewarmJob, points []prewarmPoint) {
+	defer close(job.done)
+	step := max(1, len(points)/10)
+	next := make(chan prewarmPoint)
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(points)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range next {
+				if tried := job.record(p, s.prewarmPoint(context.Background(), p, forecastCacheTTL, false)); tried%step == 0 && tried < len(points) {
+					log.Printf("Prewarmed %d of %d points", tried, len(points))
+				}
+			}
+		}()
+	}
+	for _, p := range points {
+		next <- p
+	}
+	close(next)
+	wg.Wait()
+
+	job.mu.Lock()
+	job.status.FinishedAt = s.clock.Now()
+	status := job.status
+	job.mu.Unlock()
+	log.Printf("Prewarm finished: %d of %d points warmed, %d failed, in %v",
+		status.Warmed, status.Points, status.Failed, status.FinishedAt.Sub(status.StartedAt).Round(time.Second))
+}
+
+// errPrewarmRunning is returned when a prewarm is started while another runs
+var errPrewarmRunning = errors.New("A prewarm is already running")
+
+// startPrewarm starts warming points in the background, unless a prewarm is
+// already running
+func (s *server) startPrewarm(points []prewarmPoint) (*prewarmJob, error) {
+	job := &prewarmJob{status: prewarmStatus{StartedAt: s.clock.Now(), Points: len(points)}, done: make(chan struct{})}
+	current := s.prewarm.Load()
+	if current != nil && current.running() || !s.prewarm.CompareAndSwap(current, job) {
+		return nil, errPrewarmRunning
+	}
+	log.Printf("Prewarm started for %d points", len(points))
+	go s.runPrewarm(job, points)
+	return job, nil
+}
+
+// startPrewarmHandler imports a CSV of points, such as store locations, and
+// resolves their gridpoints and fetches their forecasts into the NWS cache in
+// the background, so that the first requests for them after a deploy don't
+// wait on NWS
+func (s *server) startPrewarmHandler(w http.ResponseWriter, r *http.Request) {
+	points, err := parsePrewarmCSV(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job, err := s.startPrewarm(points)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job.progress())
+}
+
+// prewarmStatusHandler reports the progress of the latest prewarm
+func (s *server) prewarmStatusHandler(w http.ResponseWriter, r *http.Request) {
+	job := s.prewarm.Load()
+	if job == nil {
+		http.Error(w, "No prewarm has been started", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job.progress())
+}
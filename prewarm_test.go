@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParsePrewarmCSV tests reading the points of a prewarm import
+func TestParsePrewarmCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		expected []prewarmPoint
+		err      bool
+	}{
+		{
+			name:     "no header",
+			csv:      "47.6062,-122.3321\n40.7128, -74.0060\n",
+			expected: []prewarmPoint{{1, "47.6062", "-122.3321"}, {2, "40.7128", "-74.0060"}},
+		},
+		{
+			name:     "header",
+			csv:      "store,lng,lat\nSeattle,-122.33213,47.60621\n\"Boise, ID\",-116.2,43.6\n",
+			expected: []prewarmPoint{{2, "47.6062", "-122.3321"}, {3, "43.6000", "-116.2000"}},
+		},
+		{name: "header without longitude", csv: "name,latitude\nSeattle,47.6\n", err: true},
+		{name: "missing column", csv: "47.6062,-122.3321\n40.7128\n", err: true},
+		{name: "not a number", csv: "47.6062,-122.3321\n40.7128,west\n", err: true},
+		{name: "out of range", csv: "97.6,-122.3\n", err: true},
+		{name: "empty", csv: "", err: true},
+		{name: "header only", csv: "latitude,longitude\n", err: true},
+		{name: "too many", csv: strings.Repeat("1,1\n", maxPrewarmPoints+1), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := parsePrewarmCSV(strings.NewReader(tt.csv))
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", points)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if fmt.Sprint(points) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, points)
+			}
+		})
+	}
+}
+
+// TestPrewarmHandler tests warming the NWS cache for imported points,
+// reporting those that fail, so that later forecasts for them don't call NWS
+func TestPrewarmHandler(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	nws := newFakeDoer(map[string]fakeResponse{
+		"/points/47.6062,-122.3321":       {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast", "forecastHourly": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast/hourly"}}`},
+		"/points/47.6097,-122.3331":       {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast", "forecastHourly": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast/hourly"}}`},
+		"/gridpoints/SEW/124,67/forecast": {body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Partly Cloudy"}]}}`},
+	})
+	srv.nws = nws
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		switch {
+		case method == "POST":
+			srv.startPrewarmHandler(w, r)
+		case path == "/admin/prewarm":
+			srv.prewarmStatusHandler(w, r)
+		default:
+			srv.forecastHandler(w, r)
+		}
+		return w
+	}
+
+	if w := do("GET", "/admin/prewarm", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 before any prewarm, got %d", w.Code)
+	}
+	if w := do("POST", "/admin/prewarm", "latitude\n47.6"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid CSV, got %d", w.Code)
+	}
+	w := do("POST", "/admin/prewarm", "name,latitude,longitude\nPike Place,47.6062,-122.3321\nPioneer Square,47.6097,-122.3331\nNowhere,0,0\n")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case <-srv.prewarm.Load().done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the prewarm to finish")
+	}
+
+	var status prewarmStatus
+	if err := json.Unmarshal(do("GET", "/admin/prewarm", "").Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Points != 3 || status.Warmed != 2 || status.Failed != 1 || status.FinishedAt.IsZero() {
+		t.Errorf("expected 2 of 3 points warmed, got %+v", status)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].Row != 4 {
+		t.Errorf("expected the error of line 4, got %+v", status.Errors)
+	}
+	forecasts := 0
+	for _, path := range nws.paths() {
+		if path == "/gridpoints/SEW/124,67/forecast" {
+			forecasts++
+		}
+	}
+	if forecasts != 1 {
+		t.Errorf("expected the shared gridpoint's forecast to be fetched once, got %v", nws.paths())
+	}
+
+	sent := len(nws.paths())
+	if w := do("GET", "/forecast?latitude=47.60620&longitude=-122.3321", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(nws.paths()) != sent {
+		t.Errorf("expected a prewarmed forecast not to call NWS, got %v", nws.paths()[sent:])
+	}
+}
+
+// TestPrewarmRunning tests refusing a prewarm while another runs
+func TestPrewarmRunning(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	release := make(chan struct{})
+	srv.nws = doerFunc(func(*http.Request) (*http.Response, error) {
+		<-release
+		return nil, fmt.Errorf("unreachable")
+	})
+	points := []prewarmPoint{{1, "47.6062", "-122.3321"}}
+	job, err := srv.startPrewarm(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.startPrewarm(points); err != errPrewarmRunning {
+		t.Errorf("expected %v, got %v", errPrewarmRunning, err)
+	}
+	close(release)
+	<-job.done
+	job, err = srv.startPrewarm(points)
+	if err != nil {
+		t.Fatalf("expected a prewarm to start after the last finished, got %v", err)
+	}
+	<-job.done
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// With FORECAST_NWS_PROXY, other tools can send NWS requests through
+// /proxy/nws/ instead of calling NWS themselves. Only paths a proxy policy
+// allows are proxied. Responses are cached and requests that miss the cache
+// are rate limited, both overall and by policy, so the tools share this
+// service's NWS budget instead of each spending their own.
+const (
+	// proxyRate is how many requests per second the proxy sends NWS, and
+	// proxyBurst how many it can send at once after being idle
+	proxyRate  = 5.0
+	proxyBurst = 10.0
+	// proxyDefaultTTL is how long a response is cached when NWS doesn't say,
+	// and proxyMaxTTL the longest any is cached
+	proxyDefaultTTL = time.Minute
+	proxyMaxTTL     = time.Hour
+	// proxyCacheSize bounds the number of cached responses
+	proxyCacheSize = 1000
+	// maxProxyBody bounds the size of a proxied response
+	maxProxyBody = 16 << 20
+)
+
+var (
+	// proxyHits and proxyMisses count proxied requests answered from the
+	// cache and from NWS
+	proxyHits   = expvar.NewInt("forecast_proxy_hits")
+	proxyMisses = expvar.NewInt("forecast_proxy_misses")
+	// proxyThrottled counts proxied requests refused by a rate limit, and
+	// proxyRefused those of paths no policy allows
+	proxyThrottled = expvar.NewInt("forecast_proxy_throttled")
+	proxyRefused   = expvar.NewInt("forecast_proxy_refused")
+)
+
+// maxAgePattern matches the max-age directive of a Cache-Control header
+var maxAgePattern = regexp.MustCompile(`(?:^|[,\s])max-age=(\d+)`)
+
+// proxyEntry is a cached NWS response
+type proxyEntry struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// nwsProxy caches successful NWS responses and rate limits the requests it
+// sends with token buckets, one for every request and one for each policy
+// with a rate
+type nwsProxy struct {
+	clock clock
+
+	mu       sync.Mutex
+	entries  map[string]proxyEntry
+	bucket   *tokenBucket
+	policies []proxyPolicy
+	buckets  []*tokenBucket
+}
+
+func newNWSProxy(clk clock) *nwsProxy {
+	p := &nwsProxy{clock: clk, entries: map[string]proxyEntry{}, bucket: newTokenBucket(proxyRate, proxyBurst, clk.Now())}
+	p.setPolicies(builtinProxyPolicies)
+	return p
+}
+
+// setPolicies replaces the proxy's policies, resetting their rate limits
+func (p *nwsProxy) setPolicies(policies []proxyPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	p.policies = policies
+	p.buckets = make([]*tokenBucket, len(policies))
+	for i, policy := range policies {
+		if policy.Rate > 0 {
+			p.buckets[i] = newTokenBucket(policy.Rate, policy.Burst, now)
+		}
+	}
+}
+
+// policy returns the first policy allowing an NWS path with its rate limit,
+// nil when it has no rate, or false when no policy allows the path. The
+// bucket is returned with the policy, under one lock, so a reload replacing
+// the policies can't charge a request to another policy's limit.
+func (p *nwsProxy) policy(nwsPath string) (proxyPolicy, *tokenBucket, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, policy := range p.policies {
+		if ok, _ := path.Match(policy.Path, nwsPath); ok {
+			return policy, p.buckets[i], true
+		}
+	}
+	return proxyPolicy{}, nil, false
+}
+
+// cached returns the unexpired response cached under key
+func (p *nwsProxy) cached(key string) (proxyEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.entries[key]
+	if !ok || !p.clock.Now().Before(entry.expires) {
+		return proxyEntry{}, false
+	}
+	return entry, true
+}
+
+// take spends a token of a policy's bucket b, if it has one, and of the
+// overall limit, otherwise returning how long until both have one. Neither is
+// spent unless both can be.
+func (p *nwsProxy) take(b *tokenBucket) (bool, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if b != nil {
+		if ok, wait := b.take(now); !ok {
+			return false, wait
+		}
+		if ok, wait := p.bucket.take(now); !ok {
+			b.tokens++
+			return false, wait
+		}
+		return true, 0
+	}
+	return p.bucket.take(now)
+}
+
+// store caches entry under key for ttl, evicting expired entries, and then
+// arbitrary ones, when the cache is full
+func (p *nwsProxy) store(key string, entry proxyEntry, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	entry.expires = now.Add(ttl)
+	if len(p.entries) >= proxyCacheSize {
+		for k, e := range p.entries {
+			if !now.Before(e.expires) || len(p.entries) >= proxyCacheSize {
+				delete(p.entries, k)
+			}
+		}
+	}
+	p.entries[key] = entry
+}
+
+// proxyTTL is how long to cache a response with the given Cache-Control
+// header, or 0 if it mustn't be cached
+func proxyTTL(cacheControl string) time.Duration {
+	if strings.Contains(cacheControl, "no-store") {
+		return 0
+	}
+	m := maxAgePattern.FindStringSubmatch(cacheControl)
+	if m == nil {
+		return proxyDefaultTTL
+	}
+	seconds, err := strconv.Atoi(m[1])
+	if err != nil {
+		return proxyDefaultTTL
+	}
+	return min(time.Duration(seconds)*time.Second, proxyMaxTTL)
+}
+
+// proxyHandler forwards a GET of /proxy/nws/{path...} to the same path and
+// query of NWS with our User-Agent, answering from the cache when it can.
+// Paths no policy allows are refused. NWS errors are passed back as they are,
+// and only successes are cached.
+func (s *server) proxyHandler(w http.ResponseWriter, r *http.Request) {
+	nwsPath, err := proxyPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	policy, bucket, ok := s.proxy.policy(nwsPath)
+	if !ok {
+		proxyRefused.Add(1)
+		http.Error(w, "Path not allowed by the proxy policies", http.StatusForbidden)
+		return
+	}
+	key := nwsPath + "?" + r.URL.RawQuery + "\x00" + r.Header.Get("Accept")
+	if entry, ok := s.proxy.cached(key); ok {
+		proxyHits.Add(1)
+		writeProxyEntry(w, entry, "HIT")
+		return
+	}
+	if ok, wait := s.proxy.take(bucket); !ok {
+		proxyThrottled.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many proxied requests", http.StatusTooManyRequests)
+		return
+	}
+	proxyMisses.Add(1)
+
+	u, err := url.Parse(s.state.Config().NWSAPIHost)
+	if err != nil {
+		http.Error(w, "Invalid NWS API host", http.StatusInternalServerError)
+		return
+	}
+	u = u.JoinPath(nwsPath)
+	u.RawQuery = r.URL.RawQuery
+	target := u.String()
+	req, err := http.NewRequestWithContext(r.Context(), "GET", target, nil)
+	if err != nil {
+		http.Error(w, "Invalid proxy path", http.StatusBadRequest)
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := s.doNWS(req)
+	if errors.Is(err, errNWSRateLimited) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to proxy %s: %v", target, err)
+		http.Error(w, fmt.Sprintf("failed to make request: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyBody+1))
+	if err != nil || len(body) > maxProxyBody {
+		http.Error(w, "Failed to read proxied response", http.StatusBadGateway)
+		return
+	}
+
+	entry := proxyEntry{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: body}
+	ttl := policy.TTL
+	if ttl == 0 {
+		ttl = proxyTTL(resp.Header.Get("Cache-Control"))
+	}
+	if resp.StatusCode == http.StatusOK && ttl > 0 {
+		s.proxy.store(key, entry, ttl)
+	}
+	writeProxyEntry(w, entry, "MISS")
+}
+
+// proxyPath returns the NWS path of a request to /proxy/nws/, cleaned and
+// escaped again so that policies match the path NWS is sent. Paths with dot
+// segments, or that decode to a query or fragment, are refused, as NWS could
+// resolve them to a path no policy allows.
+func proxyPath(r *http.Request) (string, error) {
+	decoded, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/proxy/nws"))
+	if err != nil {
+		return "", errors.New("Invalid proxy path")
+	}
+	if strings.ContainsAny(decoded, "?#") {
+		return "", errors.New("Proxy path mustn't contain ? or #")
+	}
+	for _, segment := range strings.Split(decoded, "/") {
+		if segment == "." || segment == ".." {
+			return "", errors.New("Proxy path mustn't contain . or .. segments")
+		}
+	}
+	return (&url.URL{Path: path.Clean("/" + decoded)}).EscapedPath(), nil
+}
+
+// writeProxyEntry writes a proxied response, saying in X-Cache whether it came
+// from the cache
+func writeProxyEntry(w http.ResponseWriter, entry proxyEntry, cache string) {
+	if entry.contentType != "" {
+		w.Header().Set("Content-Type", entry.contentType)
+	}
+	w.Header().Set("X-Cache", cache)
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// proxyPolicy allows proxying the NWS paths matching Path, a pattern in which
+// * matches one path segment, such as /gridpoints/*/*/forecast. TTL, when
+// set, is how long responses are cached regardless of what NWS says, and Rate
+// limits the requests per second sent for the policy's paths, with bursts of
+// up to Burst.
+type proxyPolicy struct {
+	Path  string        `yaml:"path"`
+	TTL   time.Duration `yaml:"-"`
+	Rate  float64       `yaml:"rate"`
+	Burst float64       `yaml:"burst"`
+}
+
+// builtinProxyPolicies allow the NWS endpoints this service itself uses when
+// no proxy policy file is configured
+var builtinProxyPolicies = []proxyPolicy{
+	{Path: "/points/*"},
+	{Path: "/gridpoints/*/*"},
+	{Path: "/gridpoints/*/*/forecast"},
+	{Path: "/gridpoints/*/*/forecast/hourly"},
+	{Path: "/gridpoints/*/*/stations"},
+	{Path: "/stations/*"},
+	{Path: "/stations/*/observations/latest"},
+	{Path: "/alerts/active"},
+}
+
+// loadProxyPolicies returns the policies of a YAML or JSON file listing them
+// in the order they're tried, or the built-in ones when path is empty
+func loadProxyPolicies(file string) ([]proxyPolicy, error) {
+	if file == "" {
+		return builtinProxyPolicies, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("proxy policy file: %v", err)
+	}
+	var entries []struct {
+		proxyPolicy `yaml:",inline"`
+		TTL         string `yaml:"ttl"`
+	}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("proxy policy file %s: %v", file, err)
+	}
+	policies := make([]proxyPolicy, 0, len(entries))
+	for i, e := range entries {
+		policy := e.proxyPolicy
+		if !strings.HasPrefix(policy.Path, "/") {
+			return nil, fmt.Errorf("proxy policy file %s: policy %d: path must start with /", file, i+1)
+		}
+		if _, err := path.Match(policy.Path, ""); err != nil {
+			return nil, fmt.Errorf("proxy policy file %s: policy %d: invalid path %q", file, i+1, policy.Path)
+		}
+		if e.TTL != "" {
+			if policy.TTL, err = parseDuration(e.TTL); err != nil || policy.TTL < 0 {
+				return nil, fmt.Errorf("proxy policy file %s: policy %d: invalid ttl %q", file, i+1, e.TTL)
+			}
+		}
+		if policy.Rate < 0 || policy.Burst < 0 {
+			return nil, fmt.Errorf("proxy policy file %s: policy %d: rate and burst must not be negative", file, i+1)
+		}
+		if policy.Rate > 0 && policy.Burst < 1 {
+			policy.Burst = max(1, policy.Rate)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProxyTTL tests caching proxied responses as long as NWS allows
+func TestProxyTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		expected     time.Duration
+	}{
+		{"", proxyDefaultTTL},
+		{"public, max-age=300", 5 * time.Minute},
+		{"max-age=0", 0},
+		{"public, s-maxage=60", proxyDefaultTTL},
+		{"max-age=86400", proxyMaxTTL},
+		{"no-store", 0},
+	}
+	for _, tt := range tests {
+		if got := proxyTTL(tt.cacheControl); got != tt.expected {
+			t.Errorf("expected %q to be cached for %v, got %v", tt.cacheControl, tt.expected, got)
+		}
+	}
+}
+
+// TestProxyHandler tests proxying NWS requests with our User-Agent, answering
+// repeats from the cache until they expire and passing errors on uncached
+func TestProxyHandler(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	nws := newFakeDoer(map[string]fakeResponse{
+		"/stations/KSEA": {body: `{"properties": {"stationIdentifier": "KSEA"}}`},
+	})
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSProxy: true, JSONCase: jsonCaseSnake})
+	srv.nws = nws
+	srv.proxy = newNWSProxy(clk)
+	handler := srv.routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", "application/geo+json")
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, expected := range []string{"MISS", "HIT"} {
+		w := get("/proxy/nws/stations/KSEA?units=si")
+		if w.Code != http.StatusOK || w.Header().Get("X-Cache") != expected {
+			t.Fatalf("expected a %s, got %d %q", expected, w.Code, w.Header().Get("X-Cache"))
+		}
+		if w.Body.String() != `{"properties": {"stationIdentifier": "KSEA"}}` {
+			t.Errorf("expected the response as NWS sent it, got %s", w.Body.String())
+		}
+	}
+	if len(nws.requests) != 1 {
+		t.Fatalf("expected one request to NWS, got %d", len(nws.requests))
+	}
+	req := nws.requests[0]
+	if req.URL.String() != fakeNWSHost+"/stations/KSEA?units=si" || req.Header.Get("User-Agent") != userAgent || req.Header.Get("Accept") != "application/geo+json" {
+		t.Errorf("unexpected request to NWS %s %v", req.URL, req.Header)
+	}
+	clk.Advance(proxyDefaultTTL)
+	if w := get("/proxy/nws/stations/KSEA?units=si"); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected the cached response to expire, got %q", w.Header().Get("X-Cache"))
+	}
+
+	for range 2 {
+		if w := get("/proxy/nws/stations/NONE"); w.Code != http.StatusNotFound || w.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("expected an uncached 404, got %d %q", w.Code, w.Header().Get("X-Cache"))
+		}
+	}
+}
+
+// TestProxyPath tests refusing proxy paths that NWS could resolve to another
+// path than the one the policies checked, and sending the rest as they were
+// escaped
+func TestProxyPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		target string
+	}{
+		{"/proxy/nws/stations/KSEA", http.StatusOK, "/stations/KSEA"},
+		{"/proxy/nws/alerts/active?area=WA", http.StatusOK, "/alerts/active?area=WA"},
+		{"/proxy/nws/points/47.6,-122.3", http.StatusOK, "/points/47.6,-122.3"},
+		{"/proxy/nws/stations/K%20SEA", http.StatusOK, "/stations/K%20SEA"},
+		{"/proxy/nws/stations/KSEA%3Flimit=1", http.StatusBadRequest, ""},
+		{"/proxy/nws/stations/KSEA%23latest", http.StatusBadRequest, ""},
+		{"/proxy/nws/stations/%2E%2E/alerts", http.StatusBadRequest, ""},
+		{"/proxy/nws/stations/KSEA/%2e", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSProxy: true})
+		nws := newFakeDoer(map[string]fakeResponse{"/": {body: `{}`}})
+		srv.nws = nws
+		srv.proxy = newNWSProxy(newFakeClock(time.Now()))
+		w := httptest.NewRecorder()
+		srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, w.Code)
+			continue
+		}
+		if tt.target == "" {
+			if len(nws.requests) != 0 {
+				t.Errorf("%s: expected no request to NWS, got %v", tt.path, nws.requests[0].URL)
+			}
+		} else if len(nws.requests) != 1 || nws.requests[0].URL.String() != fakeNWSHost+tt.target {
+			t.Errorf("%s: expected a request to %s, got %v", tt.path, tt.target, nws.paths())
+		}
+	}
+}
+
+// TestProxyRateLimit tests refusing proxied requests past the rate limit
+// until tokens accrue again
+func TestProxyRateLimit(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSProxy: true})
+	srv.nws = newFakeDoer(map[string]fakeResponse{"/": {body: `{}`}})
+	srv.proxy = newNWSProxy(clk)
+	handler := srv.routes()
+
+	get := func(i int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/proxy/nws/stations/K%03d", i), nil))
+		return w
+	}
+	for i := range int(proxyBurst) {
+		if w := get(i); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be proxied, got %d", i, w.Code)
+		}
+	}
+	w := get(100)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected status 429 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// Cached responses don't count against the limit
+	if w := get(0); w.Code != http.StatusOK {
+		t.Errorf("expected a cached response, got %d", w.Code)
+	}
+	clk.Advance(time.Second / time.Duration(proxyRate))
+	if w := get(100); w.Code != http.StatusOK {
+		t.Errorf("expected a token to accrue, got %d", w.Code)
+	}
+}
+
+// TestProxyPolicies tests refusing paths no policy allows, and the cache
+// TTLs and rate limits of the policies that do
+func TestProxyPolicies(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSProxy: true})
+	nws := newFakeDoer(map[string]fakeResponse{"/": {body: `{}`}})
+	srv.nws = nws
+	srv.proxy = newNWSProxy(clk)
+	srv.proxy.setPolicies([]proxyPolicy{
+		{Path: "/points/*", TTL: time.Hour},
+		{Path: "/stations/*/observations/latest", Rate: 1, Burst: 2},
+	})
+	handler := srv.routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	for _, path := range []string{"/proxy/nws/stations", "/proxy/nws/points/47.6,-122.3/stations", "/proxy/nws/products/types"} {
+		if w := get(path); w.Code != http.StatusForbidden {
+			t.Errorf("expected %s to be refused with 403, got %d", path, w.Code)
+		}
+	}
+	if len(nws.requests) != 0 {
+		t.Errorf("expected no requests to NWS for refused paths, got %v", nws.paths())
+	}
+
+	get("/proxy/nws/points/47.6,-122.3")
+	clk.Advance(30 * time.Minute)
+	if w := get("/proxy/nws/points/47.6,-122.3"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected the policy TTL to outlast the default, got %q", w.Header().Get("X-Cache"))
+	}
+
+	for i := range 2 {
+		if w := get(fmt.Sprintf("/proxy/nws/stations/K%03d/observations/latest", i)); w.Code != http.StatusOK {
+			t.Fatalf("expected observation %d to be proxied, got %d", i, w.Code)
+		}
+	}
+	if w := get("/proxy/nws/stations/K100/observations/latest"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected the policy rate limit to refuse with 429, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("/proxy/nws/points/40.7,-74.0"); w.Code != http.StatusOK {
+		t.Errorf("expected other policies to be unaffected, got %d", w.Code)
+	}
+}
+
+// TestProxyPolicyEscapes tests that policies match the path NWS is sent,
+// however the client escaped it
+func TestProxyPolicyEscapes(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		target string
+	}{
+		{"/proxy/nws/points%2F47.6,-122.3", http.StatusOK, "/points/47.6,-122.3"},
+		{"/proxy/nws/points/47.6%2C-122.3", http.StatusOK, "/points/47.6,-122.3"},
+		{"/proxy/nws/points/47.6,-122.3%2F", http.StatusOK, "/points/47.6,-122.3"},
+		{"/proxy/nws/points/47.6,-122.3%2Fstations", http.StatusForbidden, ""},
+		{"/proxy/nws/points/47.6%2F..%2F..%2Falerts", http.StatusBadRequest, ""},
+		{"/proxy/nws/points/%2E%2E%2Falerts", http.StatusBadRequest, ""},
+		{"/proxy/nws/points/..%2Falerts", http.StatusBadRequest, ""},
+		{"/proxy/nws/points/47.6,-122.3%3F..%2Falerts", http.StatusBadRequest, ""},
+		{"/proxy/nws/points/alerts%3Factive", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		srv := newServer(Config{NWSAPIHost: fakeNWSHost, NWSProxy: true})
+		nws := newFakeDoer(map[string]fakeResponse{"/": {body: `{}`}})
+		srv.nws = nws
+		srv.proxy = newNWSProxy(newFakeClock(time.Now()))
+		srv.proxy.setPolicies([]proxyPolicy{{Path: "/points/*"}})
+		w := httptest.NewRecorder()
+		srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, w.Code)
+			continue
+		}
+		if tt.target == "" {
+			if len(nws.requests) != 0 {
+				t.Errorf("%s: expected no request to NWS, got %v", tt.path, nws.requests[0].URL)
+			}
+		} else if len(nws.requests) != 1 || nws.requests[0].URL.String() != fakeNWSHost+tt.target {
+			t.Errorf("%s: expected a request to %s, got %v", tt.path, tt.target, nws.paths())
+		}
+	}
+}
+
+// TestProxyPoliciesReloaded tests that a request matched before the policies
+// are replaced is charged to its own policy's limit
+func TestProxyPoliciesReloaded(t *testing.T) {
+	p := newNWSProxy(newFakeClock(time.Now()))
+	p.setPolicies([]proxyPolicy{
+		{Path: "/points/*"},
+		{Path: "/stations/*", Rate: 1, Burst: 1},
+	})
+	_, bucket, ok := p.policy("/stations/KSEA")
+	if !ok || bucket == nil {
+		t.Fatalf("expected the stations policy and its limit, got %v %v", bucket, ok)
+	}
+	p.setPolicies([]proxyPolicy{{Path: "/points/*"}})
+	if ok, _ := p.take(bucket); !ok {
+		t.Error("expected the matched policy's token to be taken")
+	}
+	if ok, _ := p.take(bucket); ok {
+		t.Error("expected the matched policy's limit to apply")
+	}
+}
+
+// TestLoadProxyPolicies tests reading proxy policies from a file
+func TestLoadProxyPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected []proxyPolicy
+		err      bool
+	}{
+		{
+			name: "yaml",
+			contents: `
+- path: /points/*
+  ttl: 1h
+- path: /gridpoints/*/*/forecast
+  rate: 2
+- path: /alerts/active
+  rate: 0.5
+  burst: 3
+`,
+			expected: []proxyPolicy{
+				{Path: "/points/*", TTL: time.Hour},
+				{Path: "/gridpoints/*/*/forecast", Rate: 2, Burst: 2},
+				{Path: "/alerts/active", Rate: 0.5, Burst: 3},
+			},
+		},
+		{
+			name:     "json",
+			contents: `[{"path": "/stations/*", "ttl": "10m"}]`,
+			expected: []proxyPolicy{{Path: "/stations/*", TTL: 10 * time.Minute}},
+		},
+		{name: "relative path", contents: `[{"path": "points/*"}]`, err: true},
+		{name: "bad pattern", contents: `[{"path": "/points/[*"}]`, err: true},
+		{name: "bad ttl", contents: `[{"path": "/points/*", "ttl": "soon"}]`, err: true},
+		{name: "negative rate", contents: `[{"path": "/points/*", "rate": -1}]`, err: true},
+		{name: "not a list", contents: `path: /points/*`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policies.yaml")
+			if err := os.WriteFile(file, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			policies, err := loadProxyPolicies(file)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", policies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if fmt.Sprint(policies) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, policies)
+			}
+		})
+	}
+
+	if policies, err := loadProxyPolicies(""); err != nil || len(policies) != len(builtinProxyPolicies) {
+		t.Errorf("expected the built-in policies without a file, got %v %v", policies, err)
+	}
+	if _, err := loadProxyPolicies(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// TestProxyDisabled tests that the proxy is only served when configured
+func TestProxyDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	newServer(Config{NWSAPIHost: fakeNWSHost}).routes().ServeHTTP(w, httptest.NewRequest("GET", "/proxy/nws/stations/KSEA", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
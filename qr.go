@@ -0,0 +1,443 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// This file is a minimal QR code encoder (ISO/IEC 18004) for share links. It
+// encodes bytes at error correction level M in versions 1 to 10, which holds
+// up to 213 bytes, plenty for a URL.
+
+// qrVersion describes the error correction blocks of a version at level M
+type qrVersion struct {
+	// ecPerBlock is the number of error correction codewords of each block
+	ecPerBlock int
+	// blocks lists the data codewords of each block, short blocks first
+	blocks []int
+	// alignment lists the centres of the alignment patterns on each axis
+	alignment []int
+}
+
+var qrVersions = []qrVersion{
+	1:  {ecPerBlock: 10, blocks: []int{16}},
+	2:  {ecPerBlock: 16, blocks: []int{28}, alignment: []int{6, 18}},
+	3:  {ecPerBlock: 26, blocks: []int{44}, alignment: []int{6, 22}},
+	4:  {ecPerBlock: 18, blocks: []int{32, 32}, alignment: []int{6, 26}},
+	5:  {ecPerBlock: 24, blocks: []int{43, 43}, alignment: []int{6, 30}},
+	6:  {ecPerBlock: 16, blocks: []int{27, 27, 27, 27}, alignment: []int{6, 34}},
+	7:  {ecPerBlock: 18, blocks: []int{31, 31, 31, 31}, alignment: []int{6, 22, 38}},
+	8:  {ecPerBlock: 22, blocks: []int{38, 38, 39, 39}, alignment: []int{6, 24, 42}},
+	9:  {ecPerBlock: 22, blocks: []int{36, 36, 36, 37, 37}, alignment: []int{6, 26, 46}},
+	10: {ecPerBlock: 26, blocks: []int{43, 43, 43, 43, 44}, alignment: []int{6, 28, 50}},
+}
+
+// dataCodewords returns the number of data codewords of the version
+func (v qrVersion) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// errQRTooLong is returned for data that doesn't fit the largest version
+var errQRTooLong = errors.New("data too long for a QR code")
+
+// qrCode is a square grid of modules, true for dark
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// encodeQR encodes data in byte mode in the smallest version it fits
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrVersions[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errQRTooLong
+	}
+	info := qrVersions[version]
+
+	// Mode indicator, character count, and data, then a terminator and
+	// padding to fill the data codewords
+	var bits qrBits
+	bits.append(0b0100, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * info.dataCodewords()
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	codewords := bits.bytes()
+	for pad := byte(0xEC); len(codewords) < info.dataCodewords(); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	q := newQRCode(version)
+	q.placeData(interleaveQR(codewords, info))
+	q.applyBestMask()
+	return q, nil
+}
+
+// qrBits is a bit stream, one bool per bit
+type qrBits []bool
+
+// append appends the n low bits of v, most significant first
+func (b *qrBits) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 == 1)
+	}
+}
+
+// bytes packs the stream, whose length is a multiple of 8, into bytes
+func (b qrBits) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// interleaveQR splits data into the version's blocks, appends each block's
+// error correction codewords, and interleaves the blocks
+func interleaveQR(data []byte, info qrVersion) []byte {
+	divisor := rsDivisor(info.ecPerBlock)
+	blocks := make([][]byte, len(info.blocks))
+	ecs := make([][]byte, len(info.blocks))
+	for i, n := range info.blocks {
+		blocks[i], data = data[:n], data[n:]
+		ecs[i] = rsRemainder(blocks[i], divisor)
+	}
+	var out []byte
+	for i := 0; i < info.blocks[len(info.blocks)-1]; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, ec := range ecs {
+			out = append(out, ec[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplies in GF(2^8) modulo the QR polynomial x^8+x^4+x^3+x^2+1
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of a degree, highest
+// coefficient first and its leading 1 omitted
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode returns a code of a version with its function patterns drawn
+func newQRCode(version int) *qrCode {
+	size := 17 + 4*version
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range size {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+
+	// Timing patterns
+	for i := range size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// Finder patterns with their separators
+	for _, c := range [][2]int{{3, 3}, {3, size - 4}, {size - 4, 3}} {
+		for dr := -4; dr <= 4; dr++ {
+			for dc := -4; dc <= 4; dc++ {
+				r, col := c[0]+dr, c[1]+dc
+				if r < 0 || r >= size || col < 0 || col >= size {
+					continue
+				}
+				d := max(abs(dr), abs(dc))
+				q.set(r, col, d != 2 && d != 4)
+			}
+		}
+	}
+	// Alignment patterns, except where they'd overlap the finders
+	pos := qrVersions[version].alignment
+	for i, r := range pos {
+		for j, col := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == len(pos)-1) || (i == len(pos)-1 && j == 0) {
+				continue
+			}
+			for dr := -2; dr <= 2; dr++ {
+				for dc := -2; dc <= 2; dc++ {
+					q.set(r+dr, col+dc, max(abs(dr), abs(dc)) != 1)
+				}
+			}
+		}
+	}
+	// Reserve the format areas, drawn for real once the mask is chosen
+	q.drawFormat(0)
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			a, b := size-11+i%3, i/3
+			q.set(b, a, bits>>i&1 == 1)
+			q.set(a, b, bits>>i&1 == 1)
+		}
+	}
+	return q
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// set sets a function module
+func (q *qrCode) set(row, col int, dark bool) {
+	q.modules[row][col] = dark
+	q.function[row][col] = true
+}
+
+// drawFormat draws both copies of the format information for level M and a
+// mask, and the dark module beside them
+func (q *qrCode) drawFormat(mask int) {
+	// Level M is 00, so the data is the mask alone
+	rem := mask
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (mask<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		q.set(i, 8, bit(i))
+	}
+	q.set(7, 8, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(8, 14-i, bit(i))
+	}
+	for i := range 8 {
+		q.set(8, q.size-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(q.size-15+i, 8, bit(i))
+	}
+	q.set(q.size-8, 8, true)
+}
+
+// placeData fills the non-function modules with codewords in the zigzag order,
+// two columns at a time from the bottom right. Modules left over stay light.
+func (q *qrCode) placeData(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// Skip the vertical timing pattern
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range q.size {
+			row := vert
+			if upward {
+				row = q.size - 1 - vert
+			}
+			for j := range 2 {
+				col := right - j
+				if q.function[row][col] || i >= len(codewords)*8 {
+					continue
+				}
+				q.modules[row][col] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// qrMasks are the eight mask conditions; modules where one holds are inverted
+var qrMasks = []func(row, col int) bool{
+	func(r, c int) bool { return (r+c)%2 == 0 },
+	func(r, c int) bool { return r%2 == 0 },
+	func(r, c int) bool { return c%3 == 0 },
+	func(r, c int) bool { return (r+c)%3 == 0 },
+	func(r, c int) bool { return (r/2+c/3)%2 == 0 },
+	func(r, c int) bool { return r*c%2+r*c%3 == 0 },
+	func(r, c int) bool { return (r*c%2+r*c%3)%2 == 0 },
+	func(r, c int) bool { return ((r+c)%2+r*c%3)%2 == 0 },
+}
+
+// applyMask inverts the data modules a mask selects; applying it twice undoes it
+func (q *qrCode) applyMask(mask int) {
+	for r := range q.size {
+		for c := range q.size {
+			if !q.function[r][c] && qrMasks[mask](r, c) {
+				q.modules[r][c] = !q.modules[r][c]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty
+func (q *qrCode) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := range qrMasks {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+}
+
+// penalty scores how hard the code is to scan, as the standard defines
+func (q *qrCode) penalty() int {
+	at := func(transpose bool, i, j int) bool {
+		if transpose {
+			return q.modules[j][i]
+		}
+		return q.modules[i][j]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	matches := func(transpose bool, i, j int, pattern []bool) bool {
+		for k, v := range pattern {
+			if at(transpose, i, j+k) != v {
+				return false
+			}
+		}
+		return true
+	}
+	light := func(transpose bool, i, from, to int) bool {
+		for j := max(from, 0); j < min(to, q.size); j++ {
+			if at(transpose, i, j) {
+				return false
+			}
+		}
+		return true
+	}
+
+	penalty := 0
+	for _, transpose := range []bool{false, true} {
+		for i := range q.size {
+			// Runs of five or more modules of one colour
+			run := 1
+			for j := 1; j <= q.size; j++ {
+				if j < q.size && at(transpose, i, j) == at(transpose, i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			// Finder-like patterns with four light modules on either side
+			for j := 0; j+len(finder) <= q.size; j++ {
+				if matches(transpose, i, j, finder) && (light(transpose, i, j-4, j) || light(transpose, i, j+7, j+11)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for r := range q.size {
+		for c := range q.size {
+			if q.modules[r][c] {
+				dark++
+			}
+			// 2x2 blocks of one colour
+			if r > 0 && c > 0 {
+				v := q.modules[r][c]
+				if q.modules[r-1][c] == v && q.modules[r][c-1] == v && q.modules[r-1][c-1] == v {
+					penalty += 3
+				}
+			}
+		}
+	}
+	// Deviation of the dark proportion from half, in steps of 5%
+	total := q.size * q.size
+	penalty += abs(dark*100/total-50) / 5 * 10
+	return penalty
+}
+
+// qrQuietZone is the light border around a code, in modules
+const qrQuietZone = 4
+
+// image renders the code with each module scale pixels wide
+func (q *qrCode) image(scale int) *image.Paletted {
+	width := (q.size + 2*qrQuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for r := range q.size {
+		for c := range q.size {
+			if !q.modules[r][c] {
+				continue
+			}
+			for y := range scale {
+				for x := range scale {
+					img.SetColorIndex((c+qrQuietZone)*scale+x, (r+qrQuietZone)*scale+y, 1)
+				}
+			}
+		}
+	}
+	return img
+}
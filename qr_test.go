@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestRSRemainder tests error correction codewords against the worked example
+// of the standard, HELLO WORLD at version 1-M
+func TestRSRemainder(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+// TestEncodeQR tests choosing the version and drawing the fixed patterns
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		expected int
+		wantErr  bool
+	}{
+		{name: "version 1", length: 14, expected: 21},
+		{name: "version 2", length: 15, expected: 25},
+		{name: "share link", length: 42, expected: 29},
+		{name: "version 10", length: 213, expected: 57},
+		{name: "too long", length: 214, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := encodeQR(bytes.Repeat([]byte("a"), tt.length))
+			if tt.wantErr {
+				if !errors.Is(err, errQRTooLong) {
+					t.Fatalf("expected errQRTooLong, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.size != tt.expected {
+				t.Fatalf("expected size %d, got %d", tt.expected, q.size)
+			}
+			// The finder patterns have a dark outer ring, a light ring, and a dark centre
+			for _, c := range [][2]int{{0, 0}, {0, q.size - 7}, {q.size - 7, 0}} {
+				if !q.modules[c[0]][c[1]] || q.modules[c[0]+1][c[1]+1] || !q.modules[c[0]+3][c[1]+3] {
+					t.Errorf("expected a finder pattern at %v", c)
+				}
+			}
+			if !q.modules[q.size-8][8] {
+				t.Error("expected the dark module")
+			}
+			// Both copies of the format information agree
+			for i := range 6 {
+				if q.modules[i][8] != q.modules[8][q.size-1-i] {
+					t.Errorf("format bit %d differs between copies", i)
+				}
+			}
+		})
+	}
+}
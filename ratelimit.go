@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With FORECAST_CLIENT_RATE_LIMIT set, each client may make that many
+// requests a minute, in bursts of up to a minute's worth. A client is its API
+// key when it presents one, and otherwise its address. Every response reports
+// what's left of the limit in X-RateLimit headers, so clients can slow down
+// before they're refused with 429.
+
+// maxRateLimitClients bounds the clients whose buckets are kept
+const maxRateLimitClients = 10000
+
+var (
+	// rateLimitTokens gauges the tokens left to each client, and
+	// rateLimitThrottled counts the requests refused to each, keyed by
+	// clientID
+	rateLimitTokens    = expvar.NewMap("forecast_rate_limit_tokens")
+	rateLimitThrottled = expvar.NewMap("forecast_rate_limit_throttled")
+)
+
+// tokenBucket allows rate requests per second on average, and up to burst at
+// once after being idle
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	refilled    time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, refilled: now}
+}
+
+// refill adds the tokens accrued since the bucket was last refilled
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.refilled).Seconds()*b.rate)
+	b.refilled = now
+}
+
+// charge spends n tokens, leaving the bucket in debt when it has fewer
+func (b *tokenBucket) charge(now time.Time, n float64) {
+	b.refill(now)
+	b.tokens -= n
+}
+
+// take spends a token if one is available, otherwise returning how long until
+// one is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// state returns the whole tokens left and how long until the bucket is full
+func (b *tokenBucket) state(now time.Time) (int, time.Duration) {
+	b.refill(now)
+	return int(max(0, b.tokens)), time.Duration((b.burst - b.tokens) / b.rate * float64(time.Second))
+}
+
+// reserve spends a token now or, when none is available, the next one to
+// become available, returning how long until it is. A request that would wait
+// longer than maxWait spends nothing and gets false.
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.refill(now)
+	var wait time.Duration
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+	// Tokens go negative while requests queue, so each waits its turn
+	b.tokens--
+	return wait, true
+}
+
+// rateLimit is the state of a rate limit, reported to the client in
+// X-RateLimit headers
+type rateLimit struct {
+	limit     int
+	remaining int
+	// reset is how long until the limit is full again, and wait how long
+	// until a refused request could be made
+	reset time.Duration
+	wait  time.Duration
+}
+
+// setRateLimitHeaders reports a rate limit to the client, so it can slow down
+// before being refused. X-RateLimit-Reset is the seconds until the limit is
+// full again.
+func setRateLimitHeaders(h http.Header, limit rateLimit) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(limit.remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(limit.reset.Seconds()))))
+}
+
+// clientLimiter holds a token bucket for each client
+type clientLimiter struct {
+	mu sync.Mutex
+	// perMinute is the limit the buckets were made for
+	perMinute int
+	buckets   map[string]*tokenBucket
+}
+
+// take spends one of client's tokens, allowing perMinute requests a minute,
+// and returns the state of its limit. A changed limit starts every client
+// afresh.
+func (l *clientLimiter) take(client string, perMinute int, now time.Time) (bool, rateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil || l.perMinute != perMinute {
+		l.perMinute = perMinute
+		l.buckets = make(map[string]*tokenBucket)
+		rateLimitTokens.Init()
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.forgetIdle(now)
+		}
+		b = newTokenBucket(float64(perMinute)/60, float64(perMinute), now)
+		l.buckets[client] = b
+	}
+	allowed, wait := b.take(now)
+	if !allowed {
+		rateLimitThrottled.Add(client, 1)
+	}
+	remaining, reset := b.state(now)
+	tokens := new(expvar.Float)
+	tokens.Set(max(0, b.tokens))
+	rateLimitTokens.Set(client, tokens)
+	return allowed, rateLimit{limit: perMinute, remaining: remaining, reset: reset, wait: wait}
+}
+
+// forgetIdle drops the buckets of clients that have refilled, which are as
+// good as new, and every bucket when none has, along with their metrics
+func (l *clientLimiter) forgetIdle(now time.Time) {
+	for client, b := range l.buckets {
+		if _, reset := b.state(now); reset <= 0 {
+			delete(l.buckets, client)
+			rateLimitTokens.Delete(client)
+			rateLimitThrottled.Delete(client)
+		}
+	}
+	if len(l.buckets) >= maxRateLimitClients {
+		l.buckets = make(map[string]*tokenBucket)
+		rateLimitTokens.Init()
+		rateLimitThrottled.Init()
+	}
+}
+
+// clientID identifies the caller of r for rate limiting: its API key, or its
+// address when it has none. Behind a trusted proxy, the address is the one
+// the proxy added last to X-Forwarded-For.
+func clientID(r *http.Request, trustProxy bool) string {
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		return key.ID
+	}
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustProxy && len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+			addr = hop
+		}
+	}
+	return "ip:" + addr
+}
+
+// limitRate wraps a handler so each client's requests are rate limited,
+// reporting the client's limit on every response. The caller's API key, if
+// it presents a valid one, is kept in the request context for requireScope.
+func (s *server) limitRate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.state.Config()
+		if cfg.ClientRateLimit == 0 {
+			next(w, r)
+			return
+		}
+		if !r.URL.Query().Has(signatureParam) {
+			// Invalid credentials are answered by requireScope; until then
+			// the caller counts as its address
+			if key, err := s.authenticate(r); err == nil && key != nil {
+				r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key))
+			}
+		}
+		ok, limit := s.clients.take(clientID(r, cfg.TrustProxyHeaders), cfg.ClientRateLimit, s.clock.Now())
+		setRateLimitHeaders(w.Header(), limit)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
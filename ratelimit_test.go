@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLimitRate tests rate limiting each client's requests and reporting the
+// limit on every response
+func TestLimitRate(t *testing.T) {
+	srv, tokens := newAuthServer(t, Config{ClientRateLimit: 2})
+	clk := newFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	srv.clock = clk
+	routes := srv.routes()
+	get := func(path, addr string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr + ":4321"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+		return w
+	}
+	check := func(w *httptest.ResponseRecorder, status int, remaining, reset string) {
+		t.Helper()
+		if w.Code != status {
+			t.Errorf("expected status %d, got %d", status, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("expected X-RateLimit-Limit 2, got %q", got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != remaining {
+			t.Errorf("expected X-RateLimit-Remaining %s, got %q", remaining, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Reset"); got != reset {
+			t.Errorf("expected X-RateLimit-Reset %s, got %q", reset, got)
+		}
+	}
+
+	check(get("/version", "192.0.2.1", nil), http.StatusOK, "1", "30")
+	check(get("/version", "192.0.2.1", nil), http.StatusOK, "0", "60")
+	w := get("/version", "192.0.2.1", nil)
+	check(w, http.StatusTooManyRequests, "0", "60")
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+	if got := rateLimitThrottled.Get("ip:192.0.2.1"); got == nil || got.String() != "1" {
+		t.Errorf("expected 1 request throttled for the address, got %v", got)
+	}
+
+	// Other addresses, and keys presented from the same address, have limits
+	// of their own
+	check(get("/version", "192.0.2.2", nil), http.StatusOK, "1", "30")
+	admin := http.Header{"X-Api-Key": {tokens[scopeAdmin]}}
+	check(get("/admin/keys", "192.0.2.1", admin), http.StatusOK, "1", "30")
+	check(get("/version", "192.0.2.1", admin), http.StatusOK, "0", "60")
+	check(get("/admin/keys", "192.0.2.1", admin), http.StatusTooManyRequests, "0", "60")
+	if got := rateLimitTokens.Get(keyID(tokens[scopeAdmin])); got == nil || got.String() != "0" {
+		t.Errorf("expected no tokens left to the key, got %v", got)
+	}
+
+	clk.Advance(30 * time.Second)
+	check(get("/version", "192.0.2.1", nil), http.StatusOK, "0", "60")
+
+	// Behind a trusted proxy, the client is the address it added
+	srv.state.Update(func(c *Config) { c.TrustProxyHeaders = true })
+	proxied := http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.7"}}
+	check(get("/version", "192.0.2.1", proxied), http.StatusOK, "1", "30")
+	if rateLimitTokens.Get("ip:198.51.100.7") == nil {
+		t.Error("expected the forwarded address to be limited")
+	}
+
+	srv.state.Update(func(c *Config) { c.ClientRateLimit = 0 })
+	if w := get("/version", "192.0.2.1", nil); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("expected no limit once disabled, got %d with %v", w.Code, w.Header())
+	}
+}
+
+// keyID returns the key ID of an API key token
+func keyID(token string) string {
+	id, _, _ := strings.Cut(token, ".")
+	return id
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal Redis client, speaking enough of RESP for the shared NWS cache:
+// AUTH, SELECT, GET, PTTL, and SET with an expiry. Connections are pooled and
+// commands of one call are pipelined.
+
+const (
+	// redisDialTimeout and redisTimeout bound connecting to Redis and each
+	// round trip; a slow Redis is treated as a cache miss
+	redisDialTimeout = 2 * time.Second
+	redisTimeout     = time.Second
+	// redisPoolSize is the number of idle connections kept
+	redisPoolSize = 8
+	// redisKeyPrefix namespaces the keys of the NWS cache
+	redisKeyPrefix = "forecast:nws:"
+)
+
+// redisErrors counts failed Redis calls
+var redisErrors = expvar.NewInt("forecast_redis_errors")
+
+// redisError is an error reply from Redis
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisConn is a connection to Redis with its reader
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisClient sends commands to the Redis server of a redis:// or rediss://
+// URL, such as redis://:password@localhost:6379/2
+type redisClient struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+// newRedisClient returns a client of the server at rawURL. It doesn't
+// connect until the first command.
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("want a redis:// or rediss:// URL")
+	}
+	c := &redisClient{addr: u.Host, tls: u.Scheme == "rediss", pool: make(chan *redisConn, redisPoolSize)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		if c.password == "" {
+			// redis://password@host names the password alone
+			c.password = u.User.Username()
+		} else {
+			c.username = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// conn returns an idle connection, or dials a new one and logs in
+func (c *redisClient) conn() (*redisConn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+	}
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var nc net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		nc, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		nc, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	var setup [][]string
+	switch {
+	case c.username != "":
+		setup = append(setup, []string{"AUTH", c.username, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		replies, err := conn.pipeline(setup)
+		if err == nil {
+			err = firstRedisError(replies)
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// do sends commands in one round trip and returns their replies. Error
+// replies are returned as redisError values among the replies.
+func (c *redisClient) do(cmds ...[]string) ([]any, error) {
+	conn, err := c.conn()
+	if err != nil {
+		redisErrors.Add(1)
+		return nil, err
+	}
+	replies, err := conn.pipeline(cmds)
+	if err != nil {
+		redisErrors.Add(1)
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+	return replies, nil
+}
+
+// pipeline writes cmds and reads a reply to each
+func (conn *redisConn) pipeline(cmds [][]string) ([]any, error) {
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		reply, err := readRedisReply(conn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// firstRedisError returns the first error reply among replies
+func firstRedisError(replies []any) error {
+	for _, reply := range replies {
+		if err, ok := reply.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRedisReply reads a RESP reply: a string, an int64, []byte for a bulk
+// string, nil for a null, []any for an array, or a redisError
+func readRedisReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return redisError(rest), nil
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// get returns the value of key and how long it has left to live, or a nil
+// value when it isn't set
+func (c *redisClient) get(key string) ([]byte, time.Duration, error) {
+	replies, err := c.do([]string{"GET", redisKeyPrefix + key}, []string{"PTTL", redisKeyPrefix + key})
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := firstRedisError(replies); err != nil {
+		redisErrors.Add(1)
+		return nil, 0, err
+	}
+	body, _ := replies[0].([]byte)
+	ttl, _ := replies[1].(int64)
+	if ttl <= 0 {
+		// Keys without an expiry weren't set by the cache
+		return nil, 0, nil
+	}
+	return body, time.Duration(ttl) * time.Millisecond, nil
+}
+
+// set stores value under key for ttl
+func (c *redisClient) set(key string, value []byte, ttl time.Duration) error {
+	replies, err := c.do([]string{"SET", redisKeyPrefix + key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)})
+	if err != nil {
+		return err
+	}
+	if err := firstRedisError(replies); err != nil {
+		redisErrors.Add(1)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// forecastDocument is the domain object rendered by every output format: the
+// forecast together with the point it was requested for
+type forecastDocument struct {
+	Latitude  float64
+	Longitude float64
+	Output    ForecastOutput
+}
+
+// renderer writes a forecastDocument in one output format
+type renderer struct {
+	contentType string
+	render      func(w io.Writer, doc forecastDocument) error
+}
+
+// renderers holds every supported output format keyed by its ?format= name
+var renderers = map[string]renderer{
+	"json":     {contentType: "application/json", render: renderJSON},
+	"xml":      {contentType: "application/xml", render: renderXML},
+	"csv":      {contentType: "text/csv", render: renderCSV},
+	"text":     {contentType: "text/plain; charset=utf-8", render: renderText},
+	"geojson":  {contentType: "application/geo+json", render: renderGeoJSON},
+	"protobuf": {contentType: "application/x-protobuf", render: renderProtobuf},
+}
+
+// acceptFormats maps Accept header media types to output formats
+var acceptFormats = map[string]string{
+	"application/json":       "json",
+	"application/xml":        "xml",
+	"text/xml":               "xml",
+	"text/csv":               "csv",
+	"text/plain":             "text",
+	"application/geo+json":   "geojson",
+	"application/x-protobuf": "protobuf",
+	"application/protobuf":   "protobuf",
+}
+
+// negotiateFormat picks the output format for a request. An explicit ?format=
+// wins over the Accept header; anything unrecognised in Accept falls back to JSON.
+func negotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := renderers[format]; !ok {
+			return "", fmt.Errorf("unsupported format: %s", format)
+		}
+		return format, nil
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if format, ok := acceptFormats[mediaType]; ok {
+			return format, nil
+		}
+	}
+	return "json", nil
+}
+
+// writeDocument renders doc in the given format with a 200 status
+func writeDocument(w http.ResponseWriter, format string, doc forecastDocument) {
+	rd := renderers[format]
+	w.Header().Set("Content-Type", rd.contentType)
+	w.WriteHeader(http.StatusOK)
+	rd.render(w, doc)
+}
+
+func renderJSON(w io.Writer, doc forecastDocument) error {
+	return json.NewEncoder(w).Encode(doc.Output)
+}
+
+func renderXML(w io.Writer, doc forecastDocument) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc.Output); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// renderCSV writes a header and one row; the detailedForecast column is only
+// added when the detailed forecast was asked for, and the elevation columns
+// when an elevation was. summaryText is left out to keep the columns of every
+// response the same.
+func renderCSV(w io.Writer, doc forecastDocument) error {
+	cw := csv.NewWriter(w)
+	header := []string{"latitude", "longitude", "forecast", "temperature", "wind", "precipitation", "conditionCode"}
+	row := []string{
+		strconv.FormatFloat(doc.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(doc.Longitude, 'f', -1, 64),
+		doc.Output.Forecast,
+		doc.Output.Temperature,
+		doc.Output.Wind,
+		doc.Output.Precipitation,
+		doc.Output.ConditionCode,
+	}
+	if doc.Output.DetailedForecast != "" {
+		header = append(header, "detailedForecast")
+		row = append(row, doc.Output.DetailedForecast)
+	}
+	if e := doc.Output.Elevation; e != nil {
+		grid := ""
+		if e.GridElevationM != nil {
+			grid = strconv.FormatFloat(*e.GridElevationM, 'f', -1, 64)
+		}
+		header = append(header, "elevationM", "gridElevationM", "elevationAdjustmentC", "elevationAdjusted")
+		row = append(row,
+			strconv.FormatFloat(e.ElevationM, 'f', -1, 64),
+			grid,
+			strconv.FormatFloat(e.AdjustmentC, 'f', -1, 64),
+			strconv.FormatBool(e.Adjusted),
+		)
+	}
+	cw.Write(header)
+	cw.Write(row)
+	cw.Flush()
+	return cw.Error()
+}
+
+func renderText(w io.Writer, doc forecastDocument) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Forecast: %s\nCondition: %s\nTemperature: %s\n", doc.Output.Forecast, doc.Output.ConditionCode, doc.Output.Temperature)
+	if doc.Output.Wind != "" {
+		fmt.Fprintf(&b, "Wind: %s\n", doc.Output.Wind)
+	}
+	if doc.Output.Precipitation != "" {
+		fmt.Fprintf(&b, "Precipitation: %s\n", doc.Output.Precipitation)
+	}
+	if doc.Output.DetailedForecast != "" {
+		fmt.Fprintf(&b, "Detail: %s\n", doc.Output.DetailedForecast)
+	}
+	if doc.Output.SummaryText != "" {
+		fmt.Fprintf(&b, "Outlook: %s\n", doc.Output.SummaryText)
+	}
+	if e := doc.Output.Elevation; e != nil {
+		if e.Adjusted {
+			fmt.Fprintf(&b, "Elevation: %g m (%+g °C from the grid's %g m)\n", e.ElevationM, e.AdjustmentC, *e.GridElevationM)
+		} else {
+			fmt.Fprintf(&b, "Elevation: %g m (not adjusted)\n", e.ElevationM)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// geoJSONFeature is a GeoJSON Feature with a Point geometry
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoJSONPoint   `json:"geometry"`
+	Properties ForecastOutput `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func renderGeoJSON(w io.Writer, doc forecastDocument) error {
+	return json.NewEncoder(w).Encode(geoJSONFeature{
+		Type: "Feature",
+		Geometry: geoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float64{doc.Longitude, doc.Latitude},
+		},
+		Properties: doc.Output,
+	})
+}
+
+// renderProtobuf encodes the forecast.Forecast message described in forecast.proto
+func renderProtobuf(w io.Writer, doc forecastDocument) error {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, doc.Output.Forecast)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, doc.Output.Temperature)
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(doc.Latitude))
+	b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(doc.Longitude))
+	if doc.Output.Wind != "" {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, doc.Output.Wind)
+	}
+	if doc.Output.Precipitation != "" {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, doc.Output.Precipitation)
+	}
+	if doc.Output.ConditionCode != "" {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, doc.Output.ConditionCode)
+	}
+	if doc.Output.DetailedForecast != "" {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendString(b, doc.Output.DetailedForecast)
+	}
+	if doc.Output.SummaryText != "" {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendString(b, doc.Output.SummaryText)
+	}
+	if doc.Output.Elevation != nil {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendElevationProtobuf(nil, doc.Output.Elevation))
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// appendElevationProtobuf encodes the forecast.Elevation message
+func appendElevationProtobuf(b []byte, e *elevationAdjustment) []byte {
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(e.ElevationM))
+	if e.GridElevationM != nil {
+		b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*e.GridElevationM))
+	}
+	if e.AdjustmentC != 0 {
+		b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(e.AdjustmentC))
+	}
+	if e.Adjusted {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	return b
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// goldenExtensions maps each output format to the extension of its golden file
+var goldenExtensions = map[string]string{
+	"json":     ".json",
+	"xml":      ".xml",
+	"csv":      ".csv",
+	"text":     ".txt",
+	"geojson":  ".geojson",
+	"protobuf": ".pb",
+}
+
+// goldenDocument is the domain object rendered into every golden file
+func goldenDocument() forecastDocument {
+	gridElevation := 1500.0
+	return forecastDocument{
+		Latitude:  47.6062,
+		Longitude: -122.3321,
+		Output: ForecastOutput{
+			Forecast:      "Chance Rain, Snow & \"Fog\"",
+			ConditionCode: "rain-snow",
+			Temperature:   "cold",
+			Wind:          "breezy",
+			Precipitation: "likely",
+			Elevation: &elevationAdjustment{
+				ElevationM:     2200,
+				GridElevationM: &gridElevation,
+				AdjustmentC:    -4.6,
+				Adjusted:       true,
+			},
+		},
+	}
+}
+
+// TestRenderGolden renders the same forecast in every output format and compares
+// it to testdata/golden. Run with -update to accept intentional format changes.
+func TestRenderGolden(t *testing.T) {
+	for format, rd := range renderers {
+		t.Run(format, func(t *testing.T) {
+			ext, ok := goldenExtensions[format]
+			if !ok {
+				t.Fatalf("format %q has no golden file; add it to goldenExtensions", format)
+			}
+
+			var buf bytes.Buffer
+			if err := rd.render(&buf, goldenDocument()); err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+
+			path := filepath.Join("testdata", "golden", "forecast"+ext)
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run go test -update to create it): %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s output differs from %s\ngot:\n%s\nwant:\n%s", format, path, buf.Bytes(), want)
+			}
+		})
+	}
+}
+
+// TestNegotiateFormat tests picking the output format from ?format= and Accept
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		expected    string
+		expectError bool
+	}{
+		{name: "default", url: "/forecast", expected: "json"},
+		{name: "query parameter", url: "/forecast?format=csv", expected: "csv"},
+		{name: "query parameter wins over accept", url: "/forecast?format=xml", accept: "text/csv", expected: "xml"},
+		{name: "accept geojson", url: "/forecast", accept: "application/geo+json", expected: "geojson"},
+		{name: "accept with parameters", url: "/forecast", accept: "text/plain; charset=utf-8", expected: "text"},
+		{name: "first known accept type", url: "/forecast", accept: "text/html, application/xml;q=0.9, */*", expected: "xml"},
+		{name: "unknown accept falls back to json", url: "/forecast", accept: "text/html", expected: "json"},
+		{name: "unknown format", url: "/forecast?format=yaml", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			format, err := negotiateFormat(req)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got format %q", format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != tt.expected {
+				t.Errorf("expected format %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
+
+// TestRenderDetail tests that the detailed forecast is rendered in every
+// format once it's asked for
+func TestRenderDetail(t *testing.T) {
+	doc := goldenDocument()
+	doc.Output.DetailedForecast = "Rain and snow likely, mainly after 4pm."
+	for format, rd := range renderers {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := rd.render(&buf, doc); err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			if !bytes.Contains(buf.Bytes(), []byte("mainly after 4pm")) {
+				t.Errorf("expected the detailed forecast, got %q", buf.String())
+			}
+		})
+	}
+}
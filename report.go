@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weekly report formats
+const (
+	reportHTML = "html"
+	reportPDF  = "pdf"
+)
+
+const (
+	// reportDays is how many days of forecast a weekly report covers
+	reportDays = 7
+	// reportEvent is the webhook event weekly reports are delivered as
+	reportEvent = "report.weekly"
+)
+
+// reportsDelivered counts weekly reports accepted by subscriber webhooks
+var reportsDelivered = expvar.NewInt("forecast_reports_delivered")
+
+// reportSchedule is the weekly time reports are sent, in UTC
+type reportSchedule struct {
+	Day          time.Weekday
+	Hour, Minute int
+}
+
+// parseReportSchedule parses a schedule such as "monday 06:00"
+func parseReportSchedule(s string) (reportSchedule, error) {
+	day, clock, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if ok {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if !strings.EqualFold(day, d.String()) {
+				continue
+			}
+			t, err := time.Parse("15:04", strings.TrimSpace(clock))
+			if err != nil {
+				break
+			}
+			return reportSchedule{Day: d, Hour: t.Hour(), Minute: t.Minute()}, nil
+		}
+	}
+	return reportSchedule{}, fmt.Errorf("invalid report schedule %q (want a weekday and time such as \"monday 06:00\")", s)
+}
+
+func (rs reportSchedule) String() string {
+	return fmt.Sprintf("%s %02d:%02d", strings.ToLower(rs.Day.String()), rs.Hour, rs.Minute)
+}
+
+// next returns the first scheduled time after now
+func (rs reportSchedule) next(now time.Time) time.Time {
+	now = now.UTC()
+	t := time.Date(now.Year(), now.Month(), now.Day(), rs.Hour, rs.Minute, 0, 0, time.UTC)
+	t = t.AddDate(0, 0, int(rs.Day-t.Weekday()+7)%7)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 7)
+	}
+	return t
+}
+
+// reportDay summarizes one day of a location's forecast
+type reportDay struct {
+	Date    time.Time
+	Summary string
+	// HighC and LowC are the daytime high and overnight low, nil when the
+	// forecast doesn't include that half of the day
+	HighC, LowC *float64
+	// PrecipitationProbability is the highest chance of precipitation over
+	// the day and night, nil if unknown
+	PrecipitationProbability *int
+}
+
+// reportLocation is the forecast of one saved location in a report
+type reportLocation struct {
+	Name string
+	Days []reportDay
+	// Error explains why the location's forecast is missing
+	Error string
+}
+
+// weeklyReport is the weekly summary sent to an owner
+type weeklyReport struct {
+	Owner     string
+	Generated time.Time
+	Locations []reportLocation
+}
+
+// summarizeDays groups day and night forecast periods into days, in the local
+// time of the forecast, keeping at most reportDays
+func summarizeDays(periods []weatherPeriod) []reportDay {
+	var days []reportDay
+	for _, p := range periods {
+		y, m, d := p.Start.Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, p.Start.Location())
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(date) {
+			if len(days) == reportDays {
+				break
+			}
+			days = append(days, reportDay{Date: date})
+		}
+		day := &days[len(days)-1]
+		temp := p.TemperatureC
+		if p.IsDaytime {
+			day.HighC, day.Summary = &temp, p.Summary
+		} else {
+			day.LowC = &temp
+			if day.Summary == "" {
+				day.Summary = p.Summary
+			}
+		}
+		if pop := p.PrecipitationProbability; pop != nil && (day.PrecipitationProbability == nil || *pop > *day.PrecipitationProbability) {
+			day.PrecipitationProbability = pop
+		}
+	}
+	return days
+}
+
+// weeklyReport builds the report for an owner's saved locations. A location
+// whose forecast can't be fetched is reported with the error rather than
+// failing the whole report.
+func (s *server) weeklyReport(ctx context.Context, owner string, locs []Location, now time.Time) *weeklyReport {
+	report := &weeklyReport{Owner: owner, Generated: now}
+	for _, loc := range locs {
+		lat := strconv.FormatFloat(loc.Latitude, 'f', 4, 64)
+		lon := strconv.FormatFloat(loc.Longitude, 'f', 4, 64)
+		entry := reportLocation{Name: loc.Name}
+		if periods, _, err := s.fetchPeriods(ctx, lat, lon, false); err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Days = summarizeDays(periods)
+		}
+		report.Locations = append(report.Locations, entry)
+	}
+	return report
+}
+
+// reportTemp formats a temperature in °C and °F for a report
+func reportTemp(c *float64) string {
+	if c == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d°C / %d°F", roundInt(*c), roundInt(celsiusToFahrenheit(*c)))
+}
+
+// reportPrecipitation formats a chance of precipitation for a report
+func reportPrecipitation(pop *int) string {
+	if pop == nil {
+		return "-"
+	}
+	return strconv.Itoa(*pop) + "%"
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"temp":   reportTemp,
+	"precip": reportPrecipitation,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Weekly forecast</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>Weekly forecast</h1>
+<p>Generated {{.Generated.UTC.Format "Monday, January 2, 2006 15:04 MST"}}</p>
+{{range .Locations}}
+<h2>{{.Name}}</h2>
+{{if .Error}}<p>Forecast unavailable: {{.Error}}</p>{{else}}
+<table>
+<tr><th>Day</th><th>Forecast</th><th>High</th><th>Low</th><th>Precipitation</th></tr>
+{{range .Days}}<tr><td>{{.Date.Format "Mon Jan 2"}}</td><td>{{.Summary}}</td><td>{{temp .HighC}}</td><td>{{temp .LowC}}</td><td>{{precip .PrecipitationProbability}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// renderReportHTML renders a report as an HTML page
+func renderReportHTML(r *weeklyReport) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderReportPDF renders a report as a PDF document, one line per day
+func renderReportPDF(r *weeklyReport) ([]byte, error) {
+	lines := []string{
+		"Weekly forecast",
+		"Generated " + r.Generated.UTC().Format("Monday, January 2, 2006 15:04 MST"),
+	}
+	for _, loc := range r.Locations {
+		lines = append(lines, "", loc.Name)
+		if loc.Error != "" {
+			lines = append(lines, "  Forecast unavailable: "+loc.Error)
+			continue
+		}
+		for _, d := range loc.Days {
+			lines = append(lines, fmt.Sprintf("  %s  %s  High %s  Low %s  Precipitation %s",
+				d.Date.Format("Mon Jan 2"), d.Summary, reportTemp(d.HighC), reportTemp(d.LowC), reportPrecipitation(d.PrecipitationProbability)))
+		}
+	}
+	var buf bytes.Buffer
+	if err := writePDF(&buf, lines); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendWeeklyReports delivers a report in format to the webhook of every
+// subscription whose owner has saved locations, returning how many were
+// delivered. Deliveries that fail are logged and skipped, and those held by
+// quiet hours or a daily cap go out later in a digest.
+func (s *server) sendWeeklyReports(ctx context.Context, format string, now time.Time) (int, error) {
+	subs, err := s.store.ListSubscriptions(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	byOwner := make(map[string][]Subscription)
+	var owners []string
+	for _, sub := range subs {
+		if _, ok := byOwner[sub.Owner]; !ok {
+			owners = append(owners, sub.Owner)
+		}
+		byOwner[sub.Owner] = append(byOwner[sub.Owner], sub)
+	}
+
+	delivered := 0
+	for _, owner := range owners {
+		locs, err := s.store.ListLocations(ctx, owner)
+		if err != nil {
+			return delivered, err
+		}
+		if len(locs) == 0 {
+			continue
+		}
+		report := s.weeklyReport(ctx, owner, locs, now)
+		body, contentType := []byte(nil), "text/html; charset=utf-8"
+		if format == reportPDF {
+			body, err = renderReportPDF(report)
+			contentType = "application/pdf"
+		} else {
+			body, err = renderReportHTML(report)
+		}
+		if err != nil {
+			return delivered, err
+		}
+		for _, sub := range byOwner[owner] {
+			d := &Delivery{Event: reportEvent, ContentType: contentType, Body: body, SentAt: now}
+			if err := s.notify(ctx, sub, d); err != nil {
+				log.Printf("Failed to deliver weekly report: %v", err)
+				continue
+			}
+			if d.Held {
+				continue
+			}
+			reportsDelivered.Add(1)
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// reportJob sends weekly reports at each ReportSchedule time. The schedule
+// and format are re-read before every run, and no reports are sent while
+// ReportFormat is empty.
+func (s *server) reportJob() *job {
+	return &job{
+		name: "weekly-reports",
+		schedule: func() (jobSchedule, error) {
+			return parseReportSchedule(s.state.Config().ReportSchedule)
+		},
+		run: func(ctx context.Context) error {
+			format := s.state.Config().ReportFormat
+			if format == "" {
+				return nil
+			}
+			// Each run is traced on its own, so subscribers can tell which
+			// deliveries came from the same run
+			trace := newTrace()
+			n, err := s.sendWeeklyReports(withTrace(ctx, trace), format, s.clock.Now())
+			if err != nil {
+				log.Printf("Weekly reports failed (request %s): %v", trace.RequestID, err)
+				return err
+			}
+			log.Printf("Delivered %d weekly reports (request %s)", n, trace.RequestID)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReportSchedule tests parsing schedules and finding the next report time
+func TestReportSchedule(t *testing.T) {
+	sched, err := parseReportSchedule("Monday 06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{name: "earlier in the week", now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), expected: time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC)},
+		{name: "same day before", now: time.Date(2024, 6, 3, 5, 59, 0, 0, time.UTC), expected: time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC)},
+		{name: "at the time", now: time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC), expected: time.Date(2024, 6, 10, 6, 0, 0, 0, time.UTC)},
+		{name: "other zone", now: time.Date(2024, 6, 2, 23, 30, 0, 0, time.FixedZone("PDT", -7*3600)), expected: time.Date(2024, 6, 10, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sched.next(tt.now); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "monday", "mon 06:00", "monday 25:00"} {
+		if _, err := parseReportSchedule(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestSummarizeDays tests grouping day and night periods into daily summaries
+func TestSummarizeDays(t *testing.T) {
+	pdt := time.FixedZone("PDT", -7*3600)
+	pop := func(v int) *int { return &v }
+	start := time.Date(2024, 6, 1, 18, 0, 0, 0, pdt)
+	periods := []weatherPeriod{
+		{Start: start, TemperatureC: 12, Summary: "Clear", PrecipitationProbability: pop(5)},
+	}
+	for i := 0; i < 16; i++ {
+		day := i%2 == 0
+		p := weatherPeriod{Start: start.Add(time.Duration(i+1) * 12 * time.Hour), IsDaytime: day, TemperatureC: 10, Summary: "Rain", PrecipitationProbability: pop(10 * i)}
+		if day {
+			p.TemperatureC, p.Summary = 20, "Sunny"
+		}
+		periods = append(periods, p)
+	}
+
+	days := summarizeDays(periods)
+	if len(days) != reportDays {
+		t.Fatalf("expected %d days, got %d", reportDays, len(days))
+	}
+	if first := days[0]; first.HighC != nil || *first.LowC != 12 || first.Summary != "Clear" || *first.PrecipitationProbability != 5 {
+		t.Errorf("unexpected first day %+v", first)
+	}
+	second := days[1]
+	if !second.Date.Equal(time.Date(2024, 6, 2, 0, 0, 0, 0, pdt)) || *second.HighC != 20 || *second.LowC != 10 || second.Summary != "Sunny" {
+		t.Errorf("unexpected second day %+v", second)
+	}
+	if *second.PrecipitationProbability != 10 {
+		t.Errorf("expected the wettest period's chance of 10%%, got %d", *second.PrecipitationProbability)
+	}
+}
+
+// TestSendWeeklyReports tests that owners with saved locations receive a report on each subscription
+func TestSendWeeklyReports(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/forecast-url" {
+			w.Write([]byte(`{"properties": {"periods": [
+				{"startTime": "2024-06-03T06:00:00-07:00", "isDaytime": true, "shortForecast": "Sunny", "temperature": 72, "temperatureUnit": "F"},
+				{"startTime": "2024-06-03T18:00:00-07:00", "isDaytime": false, "shortForecast": "Clear", "temperature": 50, "temperatureUnit": "F"}
+			]}}`))
+			return
+		}
+		w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast-url"}}`))
+	}))
+	defer mockNWS.Close()
+
+	var mu sync.Mutex
+	received := make(map[string]string)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = r.Header.Get("Content-Type") + "\n" + string(body)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+	ctx := context.Background()
+	for _, sub := range []Subscription{
+		{Owner: "alice", Latitude: 47.6, Longitude: -122.3, WebhookURL: hook.URL + "/alice", Secret: "a"},
+		{Owner: "bob", Latitude: 47.6, Longitude: -122.3, WebhookURL: hook.URL + "/bob", Secret: "b"},
+	} {
+		if err := srv.store.CreateSubscription(ctx, &sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := srv.store.CreateLocation(ctx, &Location{Owner: "alice", Name: "Home", Latitude: 47.6062, Longitude: -122.3321}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{reportHTML, reportPDF} {
+		t.Run(format, func(t *testing.T) {
+			clear(received)
+			n, err := srv.sendWeeklyReports(ctx, format, time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 || len(received) != 1 {
+				t.Fatalf("expected only alice to get a report, got %d deliveries to %v", n, received)
+			}
+			report := received["/alice"]
+			if format == reportPDF {
+				if !strings.HasPrefix(report, "application/pdf\n%PDF-") || !strings.Contains(report, `(Home) Tj`) {
+					t.Errorf("unexpected PDF report %q", report)
+				}
+				return
+			}
+			for _, want := range []string{"text/html", "<h2>Home</h2>", "Sunny", "22°C / 72°F", "10°C / 50°F"} {
+				if !strings.Contains(report, want) {
+					t.Errorf("expected the report to contain %q, got %s", want, report)
+				}
+			}
+		})
+	}
+}
+
+// TestRunReportScheduler tests that reports go out at the scheduled time and
+// not before
+func TestRunReportScheduler(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer mockNWS.Close()
+	delivered := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		delivered <- string(body)
+	}))
+	defer hook.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL, ReportFormat: reportHTML, ReportSchedule: "monday 06:00"})
+	srv.store = newTestStore(t)
+	clk := newFakeClock(time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC))
+	srv.clock = clk
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := srv.store.CreateSubscription(ctx, &Subscription{Owner: "alice", Latitude: 47.6, Longitude: -122.3, WebhookURL: hook.URL, Secret: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.store.CreateLocation(ctx, &Location{Owner: "alice", Name: "Home", Latitude: 47.6, Longitude: -122.3}); err != nil {
+		t.Fatal(err)
+	}
+	srv.jobs = newScheduler(clk)
+	srv.jobs.add(srv.reportJob())
+	srv.jobs.start(ctx)
+
+	clk.BlockUntil(t, 1)
+	clk.Advance(17*time.Hour + 59*time.Minute)
+	select {
+	case body := <-delivered:
+		t.Fatalf("expected no report before the schedule, got %s", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(time.Minute)
+	select {
+	case body := <-delivered:
+		if !strings.Contains(body, "Generated Monday, June 3, 2024 06:00 UTC") {
+			t.Errorf("expected the report to be generated at the scheduled time, got %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a report at the scheduled time")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseInterval reads a resampling interval such as "3h". Intervals are whole
+// hours that divide a day evenly, so buckets line up with local midnight.
+func parseInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Hour || d > 24*time.Hour || d%time.Hour != 0 || (24*time.Hour)%d != 0 {
+		return 0, fmt.Errorf("invalid interval %q (want 1h, 2h, 3h, 4h, 6h, 8h, 12h, or 24h)", s)
+	}
+	return d, nil
+}
+
+// resample aggregates consecutive periods into buckets of interval, aligned to
+// midnight in each period's own time zone. A bucket reports the highest
+// temperature, wind speed, and probability of precipitation of its periods and
+// their most common condition.
+func resample(periods []weatherPeriod, interval time.Duration) []weatherPeriod {
+	var out []weatherPeriod
+	var bucket []weatherPeriod
+	var bucketStart time.Time
+	for _, p := range periods {
+		start := bucketFloor(p.Start, interval)
+		if len(bucket) > 0 && !start.Equal(bucketStart) {
+			out = append(out, aggregate(bucket))
+			bucket = bucket[:0]
+		}
+		bucketStart = start
+		bucket = append(bucket, p)
+	}
+	if len(bucket) > 0 {
+		out = append(out, aggregate(bucket))
+	}
+	return out
+}
+
+// bucketFloor returns the start of the bucket of interval containing t
+func bucketFloor(t time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / interval * interval)
+}
+
+// aggregate combines the periods of one bucket
+func aggregate(bucket []weatherPeriod) weatherPeriod {
+	out := bucket[0]
+	out.End = bucket[len(bucket)-1].End
+
+	counts := map[condition]int{}
+	for _, p := range bucket {
+		out.TemperatureC = max(out.TemperatureC, p.TemperatureC)
+		if p.WindSpeedKPH != nil && (out.WindSpeedKPH == nil || *p.WindSpeedKPH > *out.WindSpeedKPH) {
+			out.WindSpeedKPH, out.WindDirection = p.WindSpeedKPH, p.WindDirection
+		}
+		if p.PrecipitationProbability != nil && (out.PrecipitationProbability == nil || *p.PrecipitationProbability > *out.PrecipitationProbability) {
+			out.PrecipitationProbability, out.PrecipitationInterpolated = p.PrecipitationProbability, p.PrecipitationInterpolated
+		}
+		counts[p.Condition]++
+	}
+
+	// The most common condition wins; ties go to the one seen first
+	for _, p := range bucket {
+		if counts[p.Condition] > counts[out.Condition] {
+			out.Condition, out.Summary, out.Detail = p.Condition, p.Summary, p.Detail
+		}
+	}
+	return out
+}
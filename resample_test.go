@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseInterval tests which resampling intervals are accepted
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		valid    bool
+	}{
+		{input: "1h", expected: time.Hour, valid: true},
+		{input: "3h", expected: 3 * time.Hour, valid: true},
+		{input: "6h", expected: 6 * time.Hour, valid: true},
+		{input: "24h", expected: 24 * time.Hour, valid: true},
+		{input: "5h"},
+		{input: "90m"},
+		{input: "30m"},
+		{input: "48h"},
+		{input: "3"},
+		{input: "-3h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseInterval(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid=%v, got error %v", tt.valid, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestResample tests aggregating hourly periods into coarser buckets
+func TestResample(t *testing.T) {
+	zone := time.FixedZone("PDT", -7*60*60)
+	start := time.Date(2024, 6, 1, 4, 0, 0, 0, zone)
+	pop := func(v int) *int { return &v }
+	wind := func(v float64) *float64 { return &v }
+	hours := []weatherPeriod{
+		{TemperatureC: 10, Condition: conditionCloudy, Summary: "Cloudy", PrecipitationProbability: pop(20)},
+		{TemperatureC: 12, Condition: conditionRain, Summary: "Light Rain", PrecipitationProbability: pop(60), WindSpeedKPH: wind(10), WindDirection: "S"},
+		{TemperatureC: 11, Condition: conditionRain, Summary: "Rain", PrecipitationProbability: pop(40), WindSpeedKPH: wind(20), WindDirection: "SW"},
+		{TemperatureC: 14, Condition: conditionCloudy, Summary: "Cloudy", PrecipitationProbability: pop(10), PrecipitationInterpolated: true},
+		{TemperatureC: 15, Condition: conditionClear, Summary: "Sunny"},
+	}
+	for i := range hours {
+		hours[i].Start = start.Add(time.Duration(i) * time.Hour)
+		hours[i].End = hours[i].Start.Add(time.Hour)
+	}
+
+	got := resample(hours, 3*time.Hour)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(got))
+	}
+
+	// 04:00 falls in the 03:00-06:00 bucket, so the first bucket is partial
+	first := got[0]
+	if !first.Start.Equal(start) || !first.End.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("unexpected first bucket span %v - %v", first.Start, first.End)
+	}
+	if first.TemperatureC != 12 || *first.PrecipitationProbability != 60 {
+		t.Errorf("expected maxima 12°C and 60%%, got %v and %d", first.TemperatureC, *first.PrecipitationProbability)
+	}
+	if *first.WindSpeedKPH != 10 || first.WindDirection != "S" {
+		t.Errorf("expected 10 km/h S, got %v %s", *first.WindSpeedKPH, first.WindDirection)
+	}
+	// Tied counts keep the condition seen first
+	if first.Condition != conditionCloudy || first.Summary != "Cloudy" {
+		t.Errorf("expected cloudy, got %s (%s)", first.Condition, first.Summary)
+	}
+
+	second := got[1]
+	if !second.Start.Equal(start.Add(2*time.Hour)) || !second.End.Equal(start.Add(5*time.Hour)) {
+		t.Errorf("unexpected second bucket span %v - %v", second.Start, second.End)
+	}
+	if second.TemperatureC != 15 || *second.PrecipitationProbability != 40 || second.PrecipitationInterpolated {
+		t.Errorf("unexpected second bucket %+v", second)
+	}
+	if *second.WindSpeedKPH != 20 || second.WindDirection != "SW" {
+		t.Errorf("expected 20 km/h SW, got %v %s", *second.WindSpeedKPH, second.WindDirection)
+	}
+	if second.Condition != conditionRain || second.Summary != "Rain" {
+		t.Errorf("expected rain, got %s (%s)", second.Condition, second.Summary)
+	}
+
+	if got := resample(nil, 3*time.Hour); len(got) != 0 {
+		t.Errorf("expected no buckets, got %d", len(got))
+	}
+}
+
+// TestResampleDominantCondition tests that the most common condition wins
+func TestResampleDominantCondition(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	conditions := []condition{conditionClear, conditionShowers, conditionShowers, conditionClear, conditionShowers, conditionCloudy}
+	var hours []weatherPeriod
+	for i, c := range conditions {
+		hours = append(hours, weatherPeriod{Start: start.Add(time.Duration(i) * time.Hour), Condition: c, Summary: string(c)})
+	}
+	got := resample(hours, 6*time.Hour)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 bucket, got %d", len(got))
+	}
+	if got[0].Condition != conditionShowers || got[0].Summary != "showers" {
+		t.Errorf("expected showers, got %s (%s)", got[0].Condition, got[0].Summary)
+	}
+}
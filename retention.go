@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+)
+
+// pruneJitter bounds the random delay of each pruning run, so replicas
+// sharing a database don't prune at once
+const pruneJitter = 5 * time.Minute
+
+var (
+	// prunedRows counts rows deleted by the pruning job, keyed by table
+	prunedRows = expvar.NewMap("forecast_pruned_rows")
+	// pruneRuns counts completed pruning runs
+	pruneRuns = expvar.NewInt("forecast_prune_runs")
+	// pruneErrors counts pruning runs that failed for at least one table
+	pruneErrors = expvar.NewInt("forecast_prune_errors")
+)
+
+// pruneOnce deletes every persisted row older than its retention period as of
+// now, and every share link that has expired, and returns the rows deleted per
+// table. Tables with zero retention are skipped.
+func pruneOnce(ctx context.Context, store Store, cfg *Config, now time.Time) (map[string]int64, error) {
+	// cutoff is the time rows kept for retention must be newer than, zero to
+	// keep them forever
+	cutoff := func(retention time.Duration) time.Time {
+		if retention <= 0 {
+			return time.Time{}
+		}
+		return now.Add(-retention)
+	}
+	tables := []struct {
+		name   string
+		before time.Time
+		prune  func(context.Context, time.Time) (int64, error)
+	}{
+		{name: "history", before: cutoff(cfg.HistoryRetention), prune: store.PruneHistory},
+		{name: "audit", before: cutoff(cfg.AuditRetention), prune: store.PruneAudit},
+		{name: "usage", before: cutoff(cfg.UsageRetention), prune: store.PruneUsage},
+		{name: "snapshots", before: cutoff(cfg.SnapshotRetention), prune: store.PruneSnapshots},
+		{name: "alerts", before: cutoff(cfg.AlertRetention), prune: store.PruneAlerts},
+		{name: "deliveries", before: cutoff(cfg.DeliveryRetention), prune: store.PruneDeliveries},
+		{name: "share_links", before: now, prune: store.PruneShareLinks},
+		{name: "signing_keys", before: now, prune: store.PruneSigningKeys},
+	}
+
+	deleted := make(map[string]int64)
+	var firstErr error
+	for _, table := range tables {
+		if table.before.IsZero() {
+			continue
+		}
+		n, err := table.prune(ctx, table.before)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted[table.name] = n
+		prunedRows.Add(table.name, n)
+	}
+
+	pruneRuns.Add(1)
+	if firstErr != nil {
+		pruneErrors.Add(1)
+	}
+	return deleted, firstErr
+}
+
+// pruneJob prunes the store on PruneSchedule, or every PruneInterval when
+// it's unset, starting at startup. The schedule and retention periods are
+// re-read each run so reloads take effect.
+func (s *server) pruneJob() *job {
+	return &job{
+		name: "prune",
+		schedule: func() (jobSchedule, error) {
+			cfg := s.state.Config()
+			if cfg.PruneSchedule != "" {
+				return parseJobSchedule(cfg.PruneSchedule)
+			}
+			return everySchedule(cfg.PruneInterval), nil
+		},
+		run: func(ctx context.Context) error {
+			deleted, err := pruneOnce(ctx, s.store, s.state.Config(), s.clock.Now())
+			if err != nil {
+				log.Printf("Pruning failed: %v", err)
+			}
+			for table, n := range deleted {
+				if n > 0 {
+					log.Printf("Pruned %d %s rows", n, table)
+				}
+			}
+			return err
+		},
+		jitter:     pruneJitter,
+		runAtStart: true,
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+)
+
+// TestPruneOnce tests that rows past their retention are deleted and counted
+func TestPruneOnce(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, age := range []time.Duration{100 * 24 * time.Hour, 89 * 24 * time.Hour, time.Hour} {
+		rec := &HistoryRecord{Latitude: 1, Longitude: 2, Forecast: "Sunny", RecordedAt: now.Add(-age)}
+		if err := store.AddHistory(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, age := range []time.Duration{31 * 24 * time.Hour, 29 * 24 * time.Hour} {
+		if err := store.AppendAudit(ctx, &AuditEntry{Actor: "admin", Action: "test", At: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.RecordUsage(ctx, "key", now.Add(-400*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaultConfig()
+	before := prunedRows.Get("history")
+	deleted, err := pruneOnce(ctx, store, &cfg, now)
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+
+	expected := map[string]int64{"history": 1, "audit": 1, "usage": 1}
+	for table, n := range expected {
+		if deleted[table] != n {
+			t.Errorf("expected %d %s rows deleted, got %d", n, table, deleted[table])
+		}
+	}
+
+	history, _ := store.ListHistory(ctx, 1, 2, time.Time{})
+	if len(history) != 2 {
+		t.Errorf("expected 2 history rows left, got %d", len(history))
+	}
+	audit, _ := store.ListAudit(ctx, time.Time{})
+	if len(audit) != 1 {
+		t.Errorf("expected 1 audit row left, got %d", len(audit))
+	}
+
+	var beforeCount int64
+	if before != nil {
+		beforeCount = before.(*expvar.Int).Value()
+	}
+	if got := prunedRows.Get("history").(*expvar.Int).Value(); got != beforeCount+1 {
+		t.Errorf("expected pruned history metric %d, got %d", beforeCount+1, got)
+	}
+}
+
+// TestPruneOnceSkipsZeroRetention tests that zero retention keeps rows forever
+func TestPruneOnceSkipsZeroRetention(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := store.AddHistory(ctx, &HistoryRecord{Forecast: "Old", RecordedAt: now.Add(-1000 * 24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaultConfig()
+	cfg.HistoryRetention = 0
+	deleted, err := pruneOnce(ctx, store, &cfg, now)
+	if err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if _, ok := deleted["history"]; ok {
+		t.Error("expected history to be skipped")
+	}
+	if history, _ := store.ListHistory(ctx, 0, 0, time.Time{}); len(history) != 1 {
+		t.Errorf("expected history to be kept, got %d rows", len(history))
+	}
+}
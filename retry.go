@@ -0,0 +1,62 @@
+package main
+
+import (
+	"expvar"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNWSRetryAttempts bounds FORECAST_NWS_RETRY_ATTEMPTS, so a request can't
+// be retried for longer than any client would wait
+const maxNWSRetryAttempts = 10
+
+// nwsRetries counts NWS requests sent again after a transient failure
+var nwsRetries = expvar.NewInt("forecast_nws_retries")
+
+// retryableStatus reports whether an NWS status is worth retrying: NWS
+// answers sporadic 500s, 502s, 503s, and 504s that succeed when asked again
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before retry n, counting from 1: base
+// doubled for each earlier retry, capped at max. With jitter the wait is a
+// random share of that instead, so replicas that failed together don't retry
+// together.
+func retryDelay(n int, base, max time.Duration, jitter bool) time.Duration {
+	delay := max
+	if n-1 < 32 && base<<(n-1) > 0 && base<<(n-1) < max {
+		delay = base << (n - 1)
+	}
+	if jitter && delay > 0 {
+		return rand.N(delay + 1)
+	}
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header, either a number of seconds or an
+// HTTP date, as a wait from now. A date in the past is no wait.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRetryDelay tests that retries back off exponentially up to the cap, and
+// that jitter stays within the backoff
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected time.Duration
+	}{
+		{n: 1, expected: 100 * time.Millisecond},
+		{n: 2, expected: 200 * time.Millisecond},
+		{n: 3, expected: 400 * time.Millisecond},
+		{n: 6, expected: time.Second},
+		{n: 64, expected: time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.n, 100*time.Millisecond, time.Second, false); got != tt.expected {
+			t.Errorf("expected %s before retry %d, got %s", tt.expected, tt.n, got)
+		}
+		for range 20 {
+			if got := retryDelay(tt.n, 100*time.Millisecond, time.Second, true); got < 0 || got > tt.expected {
+				t.Errorf("expected a jittered delay within %s before retry %d, got %s", tt.expected, tt.n, got)
+			}
+		}
+	}
+}
+
+// TestMakeNWSRequestRetries tests that network errors and transient 5xx
+// responses are retried until the attempts run out, that a 429 is retried
+// once its Retry-After has passed if that's soon enough, and that other
+// failures aren't
+func TestMakeNWSRequestRetries(t *testing.T) {
+	errReset := errors.New("connection reset by peer")
+	tests := []struct {
+		name           string
+		attempts       int
+		responses      []int
+		retryAfter     string
+		expectedCalls  int
+		expectedStatus int
+	}{
+		{name: "sporadic 503", attempts: 3, responses: []int{503, 200}, expectedCalls: 2, expectedStatus: 200},
+		{name: "network error", attempts: 3, responses: []int{0, 200}, expectedCalls: 2, expectedStatus: 200},
+		{name: "attempts run out", attempts: 3, responses: []int{502, 504, 500, 200}, expectedCalls: 3, expectedStatus: 500},
+		{name: "not found isn't retried", attempts: 3, responses: []int{404, 200}, expectedCalls: 1, expectedStatus: 404},
+		{name: "429 past the rate wait", attempts: 3, responses: []int{429, 200}, retryAfter: "120", expectedCalls: 1, expectedStatus: 503},
+		{name: "429 without a Retry-After", attempts: 3, responses: []int{429, 200}, expectedCalls: 1, expectedStatus: 503},
+		{name: "429 ready to retry", attempts: 3, responses: []int{429, 200}, retryAfter: "0", expectedCalls: 2, expectedStatus: 200},
+		{name: "429 with retries off", attempts: 1, responses: []int{429, 200}, retryAfter: "0", expectedCalls: 1, expectedStatus: 503},
+		{name: "retries off", attempts: 1, responses: []int{503, 200}, expectedCalls: 1, expectedStatus: 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSRetryAttempts: tt.attempts, NWSRetryBaseDelay: time.Millisecond, NWSRetryMaxDelay: time.Millisecond, NWSRetryJitter: true})
+			calls := 0
+			srv.nws = doerFunc(func(req *http.Request) (*http.Response, error) {
+				status := tt.responses[min(calls, len(tt.responses)-1)]
+				calls++
+				if status == 0 {
+					return nil, errReset
+				}
+				header := http.Header{}
+				if status == http.StatusTooManyRequests && tt.retryAfter != "" {
+					header.Set("Retry-After", tt.retryAfter)
+				}
+				return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+			})
+			_, _, status, _ := srv.makeNWSRequest(t.Context(), fakeNWSHost+"/points/47.6062,-122.3321")
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d requests, got %d", tt.expectedCalls, calls)
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+// TestMakeNWSRequestCancelled tests that a request stops retrying once its
+// context is done, and that NWS gets the context with the request
+func TestMakeNWSRequestCancelled(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv := newServer(Config{NWSRetryAttempts: 3, NWSRetryBaseDelay: time.Second, NWSRetryMaxDelay: time.Second})
+	srv.clock = clk
+	ctx, cancel := context.WithCancel(t.Context())
+	calls := 0
+	srv.nws = doerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if req.Context() != ctx {
+			t.Error("expected the request to carry the caller's context")
+		}
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	})
+
+	done := make(chan int)
+	go func() {
+		_, _, status, _ := srv.makeNWSRequest(ctx, fakeNWSHost+"/points/47.6062,-122.3321")
+		done <- status
+	}()
+	clk.BlockUntil(t, 1)
+	cancel()
+	if status := <-done; status != http.StatusServiceUnavailable {
+		t.Errorf("expected the last status, got %d", status)
+	}
+	if calls != 1 {
+		t.Errorf("expected no retry after cancelling, got %d requests", calls)
+	}
+}
+
+// TestParseRetryAfter tests reading Retry-After as seconds and as a date
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "120", expected: 2 * time.Minute, ok: true},
+		{value: " 0 ", ok: true},
+		{value: "Sat, 01 Jun 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Sat, 01 Jun 2024 11:00:00 GMT", ok: true},
+		{value: "-5"},
+		{value: "soon"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("expected %q to be %s (%v), got %s (%v)", tt.value, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
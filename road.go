@@ -0,0 +1,225 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// roadHorizonHours is how far ahead /road forecasts
+	roadHorizonHours = 24
+	// roadPrecipitationThreshold is the probability of precipitation from
+	// which an hour is expected to be wet
+	roadPrecipitationThreshold = 50
+	// roadDryingHours is how long pavement stays wet after precipitation ends
+	roadDryingHours = 3
+	// snowMeltC is the temperature above which snow on roads melts, and
+	// snowSticksC the one at or below which falling snow settles
+	snowMeltC   = 2.0
+	snowSticksC = 1.0
+	// maxObservationAge is how old an observation can be and still describe
+	// the state of the roads when the forecast begins
+	maxObservationAge = 6 * time.Hour
+)
+
+// Road risk categories, from least to most hazardous
+const (
+	roadDry         = "dry"
+	roadWet         = "wet"
+	roadIceRisk     = "ice-risk"
+	roadSnowCovered = "snow-covered-risk"
+)
+
+// Kinds of precipitation, as they affect roads
+const (
+	precipitationNone = iota
+	precipitationRain
+	precipitationSnow
+	precipitationIce
+)
+
+// precipitationKind classifies a condition by what it leaves on roads at a
+// temperature in °C
+func precipitationKind(c condition, temperatureC float64) int {
+	switch c {
+	case conditionDrizzle, conditionRain, conditionShowers, conditionThunderstorm, conditionTropicalStorm, conditionHurricane:
+		return precipitationRain
+	case conditionSnow, conditionBlizzard:
+		return precipitationSnow
+	case conditionRainSnow:
+		if temperatureC <= snowSticksC {
+			return precipitationSnow
+		}
+		return precipitationRain
+	case conditionFreezingRain, conditionSleet:
+		return precipitationIce
+	default:
+		return precipitationNone
+	}
+}
+
+// roadState tracks what is on the road surface from hour to hour
+type roadState struct {
+	// wetHours counts down the hours until wet pavement has dried
+	wetHours int
+	snow     bool
+}
+
+// roadStateFromObservation infers the road surface at the start of the
+// forecast from the latest observation, if recent enough
+func roadStateFromObservation(obs *observation, start time.Time) roadState {
+	var state roadState
+	if obs == nil || obs.RecentPrecipitationMm == nil || *obs.RecentPrecipitationMm <= 0 || start.Sub(obs.Time) > maxObservationAge {
+		return state
+	}
+	state.wetHours = roadDryingHours
+	temperature := snowSticksC + 1
+	if obs.TemperatureC != nil {
+		temperature = *obs.TemperatureC
+	}
+	if precipitationKind(obs.Condition, temperature) == precipitationSnow && temperature <= snowSticksC {
+		state.snow = true
+	}
+	return state
+}
+
+// roadRisk advances the road state through a forecast hour and returns its
+// risk category
+func (st *roadState) roadRisk(p weatherPeriod) string {
+	kind := precipitationNone
+	if p.PrecipitationProbability == nil || *p.PrecipitationProbability >= roadPrecipitationThreshold {
+		kind = precipitationKind(p.Condition, p.TemperatureC)
+	}
+
+	ice := false
+	switch kind {
+	case precipitationRain:
+		st.wetHours = roadDryingHours
+		// Rain falling onto frozen pavement freezes on contact
+		ice = p.TemperatureC <= 0
+	case precipitationSnow:
+		if p.TemperatureC <= snowSticksC {
+			st.snow = true
+		} else {
+			st.wetHours = roadDryingHours
+		}
+	case precipitationIce:
+		st.wetHours = roadDryingHours
+		ice = true
+	default:
+		if st.wetHours > 0 {
+			st.wetHours--
+		}
+	}
+	if st.snow && p.TemperatureC > snowMeltC {
+		st.snow = false
+		st.wetHours = roadDryingHours
+	}
+
+	switch {
+	case ice:
+		return roadIceRisk
+	case st.snow:
+		return roadSnowCovered
+	case st.wetHours > 0 && p.TemperatureC <= 0:
+		// Wet pavement refreezes
+		return roadIceRisk
+	case st.wetHours > 0 || kind != precipitationNone:
+		return roadWet
+	default:
+		return roadDry
+	}
+}
+
+// roadHour is one hour of the /road response
+type roadHour struct {
+	StartTime                time.Time `json:"startTime"`
+	TemperatureC             float64   `json:"temperatureC"`
+	PrecipitationProbability *int      `json:"precipitationProbability,omitempty"`
+	ConditionCode            string    `json:"conditionCode"`
+	Risk                     string    `json:"risk"`
+}
+
+// roadObservation is the observation the road state was started from
+type roadObservation struct {
+	Station                  string    `json:"station"`
+	Time                     time.Time `json:"time"`
+	Description              string    `json:"description"`
+	TemperatureC             *float64  `json:"temperatureC,omitempty"`
+	RecentPrecipitationMm    *float64  `json:"recentPrecipitationMm,omitempty"`
+	RecentPrecipitationHours int       `json:"recentPrecipitationHours,omitempty"`
+}
+
+// roadResponse is the body of /road
+type roadResponse struct {
+	Latitude    float64          `json:"latitude"`
+	Longitude   float64          `json:"longitude"`
+	Observation *roadObservation `json:"observation,omitempty"`
+	Hours       []roadHour       `json:"hours"`
+}
+
+// roadForecast categorises the road risk of each of the first hours periods,
+// carrying wet pavement and settled snow from hour to hour
+func roadForecast(periods []weatherPeriod, obs *observation, hours int) []roadHour {
+	periods = periods[:min(len(periods), hours)]
+	out := make([]roadHour, 0, len(periods))
+	if len(periods) == 0 {
+		return out
+	}
+	state := roadStateFromObservation(obs, periods[0].Start)
+	for _, p := range periods {
+		out = append(out, roadHour{
+			StartTime:                p.Start,
+			TemperatureC:             roundTenth(p.TemperatureC),
+			PrecipitationProbability: p.PrecipitationProbability,
+			ConditionCode:            string(p.Condition),
+			Risk:                     state.roadRisk(p),
+		})
+	}
+	return out
+}
+
+// roadHandler serves the hourly road risk for the next day. The latest
+// observation from the nearest station says whether roads start out wet or
+// snowy; the forecast goes ahead without it if it is unavailable.
+func (s *server) roadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+
+	pointData, statusCode, err := s.lookupPoint(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	periods, statusCode, err := s.fetchPointPeriods(r.Context(), pointData, true, unitsUS)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := roadResponse{}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	var obs *observation
+	if o, _, err := s.fetchLatestObservation(r.Context(), pointData.Properties.ObservationStations); err != nil {
+		log.Printf("Failed to fetch observation for road risk: %v", err)
+	} else {
+		obs = &o
+		resp.Observation = &roadObservation{
+			Station:                  o.Station,
+			Time:                     o.Time,
+			Description:              o.Description,
+			TemperatureC:             o.TemperatureC,
+			RecentPrecipitationMm:    o.RecentPrecipitationMm,
+			RecentPrecipitationHours: o.RecentPrecipitationHours,
+		}
+	}
+	resp.Hours = roadForecast(periods, obs, roadHorizonHours)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRoadForecast tests how road risk evolves through sequences of hours
+func TestRoadForecast(t *testing.T) {
+	type hour struct {
+		temp float64
+		pop  int
+		c    condition
+	}
+	tests := []struct {
+		name     string
+		hours    []hour
+		expected []string
+	}{
+		{
+			name:     "dry",
+			hours:    []hour{{10, 0, conditionClear}, {5, 20, conditionRain}},
+			expected: []string{roadDry, roadDry},
+		},
+		{
+			name:     "rain dries out",
+			hours:    []hour{{10, 80, conditionRain}, {10, 0, conditionCloudy}, {10, 0, conditionCloudy}, {10, 0, conditionCloudy}},
+			expected: []string{roadWet, roadWet, roadWet, roadDry},
+		},
+		{
+			name:     "wet roads refreeze",
+			hours:    []hour{{3, 80, conditionRain}, {1, 0, conditionCloudy}, {-1, 0, conditionClear}},
+			expected: []string{roadWet, roadWet, roadIceRisk},
+		},
+		{
+			name:     "freezing rain",
+			hours:    []hour{{1, 60, conditionFreezingRain}},
+			expected: []string{roadIceRisk},
+		},
+		{
+			name:     "rain on frozen roads",
+			hours:    []hour{{-1, 70, conditionRain}},
+			expected: []string{roadIceRisk},
+		},
+		{
+			name:     "snow settles until it melts",
+			hours:    []hour{{-2, 90, conditionSnow}, {0, 0, conditionCloudy}, {3, 0, conditionClear}, {4, 0, conditionClear}},
+			expected: []string{roadSnowCovered, roadSnowCovered, roadWet, roadWet},
+		},
+		{
+			name:     "warm snow only wets",
+			hours:    []hour{{3, 90, conditionSnow}},
+			expected: []string{roadWet},
+		},
+		{
+			name:     "rain and snow depends on temperature",
+			hours:    []hour{{4, 90, conditionRainSnow}, {0, 90, conditionRainSnow}},
+			expected: []string{roadWet, roadSnowCovered},
+		},
+	}
+	start := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var periods []weatherPeriod
+			for i, h := range tt.hours {
+				pop := h.pop
+				periods = append(periods, weatherPeriod{Start: start.Add(time.Duration(i) * time.Hour), TemperatureC: h.temp, PrecipitationProbability: &pop, Condition: h.c})
+			}
+			hours := roadForecast(periods, nil, roadHorizonHours)
+			for i, h := range hours {
+				if h.Risk != tt.expected[i] {
+					t.Errorf("hour %d: expected %s, got %s", i, tt.expected[i], h.Risk)
+				}
+			}
+		})
+	}
+}
+
+// TestRoadForecastObservation tests starting from recently observed precipitation
+func TestRoadForecastObservation(t *testing.T) {
+	start := time.Date(2024, 1, 10, 6, 0, 0, 0, time.UTC)
+	mm, cold, mild := 4.0, -3.0, 5.0
+	periods := []weatherPeriod{{Start: start, TemperatureC: -3, Condition: conditionCloudy}}
+
+	tests := []struct {
+		name     string
+		obs      *observation
+		expected string
+	}{
+		{name: "no observation", expected: roadDry},
+		{name: "recent snow", obs: &observation{Time: start.Add(-time.Hour), Condition: conditionSnow, TemperatureC: &cold, RecentPrecipitationMm: &mm}, expected: roadSnowCovered},
+		{name: "recent rain refreezes", obs: &observation{Time: start.Add(-time.Hour), Condition: conditionRain, TemperatureC: &mild, RecentPrecipitationMm: &mm}, expected: roadIceRisk},
+		{name: "stale observation", obs: &observation{Time: start.Add(-12 * time.Hour), Condition: conditionSnow, TemperatureC: &cold, RecentPrecipitationMm: &mm}, expected: roadDry},
+		{name: "no precipitation", obs: &observation{Time: start, Condition: conditionSnow, TemperatureC: &cold}, expected: roadDry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hours := roadForecast(periods, tt.obs, roadHorizonHours)
+			if hours[0].Risk != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, hours[0].Risk)
+			}
+		})
+	}
+
+	if hours := roadForecast(nil, nil, roadHorizonHours); len(hours) != 0 {
+		t.Errorf("expected no hours, got %d", len(hours))
+	}
+}
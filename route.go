@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// routeResponse is the body of GET /route
+type routeResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Gridpoint string  `json:"gridpoint"`
+	Replica   string  `json:"replica"`
+}
+
+// gridpointID returns the office and coordinates of a point's gridpoint, such
+// as SEW/124,67, from the links of its points response
+func gridpointID(pointData PointResponse) string {
+	for _, link := range []string{pointData.Properties.ForecastGridData, pointData.Properties.Forecast} {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if _, rest, ok := strings.Cut(u.Path, "/gridpoints/"); ok {
+			if parts := strings.Split(rest, "/"); len(parts) >= 2 {
+				return parts[0] + "/" + parts[1]
+			}
+		}
+	}
+	return ""
+}
+
+// routeHandler names the replica of FORECAST_CACHE_PEERS that serves a
+// point's gridpoint, so load balancers and clients can send every request for
+// a gridpoint to one replica, whose cache then holds it. Gridpoints are
+// assigned by consistent hashing, the same on every replica.
+func (s *server) routeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	pointData, statusCode, err := s.lookupPoint(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	gridpoint := gridpointID(pointData)
+	if gridpoint == "" {
+		http.Error(w, "Gridpoint not found", http.StatusNotFound)
+		return
+	}
+	latitude, _ := strconv.ParseFloat(lat, 64)
+	longitude, _ := strconv.ParseFloat(lon, 64)
+	writeJSON(w, http.StatusOK, routeResponse{Latitude: latitude, Longitude: longitude, Gridpoint: gridpoint, Replica: s.peerRing().get("gridpoints/" + gridpoint)})
+}
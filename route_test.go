@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestGridpointID tests reading the gridpoint from a points response
+func TestGridpointID(t *testing.T) {
+	tests := []struct {
+		name     string
+		grid     string
+		forecast string
+		expected string
+	}{
+		{name: "grid data", grid: "https://api.weather.gov/gridpoints/SEW/124,67", expected: "SEW/124,67"},
+		{name: "forecast", forecast: "https://api.weather.gov/gridpoints/BOI/133,86/forecast", expected: "BOI/133,86"},
+		{name: "none", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p PointResponse
+			p.Properties.ForecastGridData, p.Properties.Forecast = tt.grid, tt.forecast
+			if got := gridpointID(p); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestRouteHandler tests that every replica routes a gridpoint to the same
+// replica
+func TestRouteHandler(t *testing.T) {
+	peers := "http://10.0.0.1:8080,http://10.0.0.2:8080,http://10.0.0.3:8080"
+	var replicas []string
+	for _, self := range []string{"http://10.0.0.1:8080", "http://10.0.0.3:8080"} {
+		srv := newServer(Config{NWSAPIHost: fakeNWSHost, CachePeers: peers, CachePeerSelf: self, CachePeerSecret: "s3cret"})
+		srv.nws = newFakeDoer(map[string]fakeResponse{
+			"/points/": {body: `{"properties": {"forecast": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast"}}`},
+		})
+		w := httptest.NewRecorder()
+		srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/route?latitude=47.6062&longitude=-122.3321", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp routeResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Gridpoint != "SEW/124,67" || resp.Replica == "" {
+			t.Errorf("unexpected route %+v", resp)
+		}
+		replicas = append(replicas, resp.Replica)
+	}
+	if replicas[0] != replicas[1] {
+		t.Errorf("expected the replicas to agree, got %v", replicas)
+	}
+
+	w := httptest.NewRecorder()
+	newServer(Config{}).routes().ServeHTTP(w, httptest.NewRequest("GET", "/route?latitude=47.6062&longitude=-122.3321", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 without peers, got %d", w.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// jobRuns, jobFailures, and jobSkipped count the runs of each scheduled
+	// job, those that failed, and the runs skipped because the job was still
+	// running when they were due
+	jobRuns     = expvar.NewMap("forecast_job_runs")
+	jobFailures = expvar.NewMap("forecast_job_failures")
+	jobSkipped  = expvar.NewMap("forecast_job_skipped")
+)
+
+// jobSchedule tells when a scheduled job runs next
+type jobSchedule interface {
+	// next returns the first run after now, or the zero time for none
+	next(now time.Time) time.Time
+	String() string
+}
+
+// everySchedule runs a job a fixed interval after each run
+type everySchedule time.Duration
+
+func (e everySchedule) next(now time.Time) time.Time { return now.Add(time.Duration(e)) }
+func (e everySchedule) String() string               { return "@every " + time.Duration(e).String() }
+
+// parseJobSchedule parses a cron schedule or "@every" and a duration, such
+// as "@every 90m"
+func parseJobSchedule(spec string) (jobSchedule, error) {
+	if d, ok := strings.CutPrefix(strings.TrimSpace(spec), "@every "); ok {
+		interval, err := parseDuration(strings.TrimSpace(d))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q (want a positive duration after @every)", spec)
+		}
+		return everySchedule(interval), nil
+	}
+	return parseCron(spec)
+}
+
+// job is a background task the scheduler runs
+type job struct {
+	name string
+	// schedule is re-read before each run, so reloads take effect
+	schedule func() (jobSchedule, error)
+	run      func(ctx context.Context) error
+	// jitter delays each run by a random amount up to it, so replicas don't
+	// all run a job at once
+	jitter time.Duration
+	// runAtStart runs the job once as soon as the scheduler starts
+	runAtStart bool
+
+	mu     sync.Mutex
+	status jobStatus
+}
+
+// jobStatus is a job's entry in /admin/jobs
+type jobStatus struct {
+	Name       string    `json:"name"`
+	Schedule   string    `json:"schedule"`
+	Running    bool      `json:"running"`
+	NextRun    time.Time `json:"nextRun,omitzero"`
+	LastStart  time.Time `json:"lastStart,omitzero"`
+	LastFinish time.Time `json:"lastFinish,omitzero"`
+	LastError  string    `json:"lastError,omitempty"`
+	Runs       int       `json:"runs"`
+	Failures   int       `json:"failures"`
+	Skipped    int       `json:"skipped"`
+}
+
+// scheduler runs jobs on their schedules. A job's runs never overlap: runs
+// that fall due while it's still running are skipped.
+type scheduler struct {
+	clock clock
+	// delay returns a random jitter up to max
+	delay func(max time.Duration) time.Duration
+
+	mu   sync.Mutex
+	jobs []*job
+}
+
+func newScheduler(clk clock) *scheduler {
+	return &scheduler{clock: clk, delay: func(max time.Duration) time.Duration { return rand.N(max) }}
+}
+
+// add registers a job, which runs once the scheduler starts
+func (sc *scheduler) add(j *job) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	j.status.Name = j.name
+	sc.jobs = append(sc.jobs, j)
+}
+
+// start runs every job on its schedule until ctx is done
+func (sc *scheduler) start(ctx context.Context) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, j := range sc.jobs {
+		go sc.loop(ctx, j)
+	}
+}
+
+// statuses returns the status of every job, by name
+func (sc *scheduler) statuses() []jobStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	statuses := make([]jobStatus, 0, len(sc.jobs))
+	for _, j := range sc.jobs {
+		j.mu.Lock()
+		statuses = append(statuses, j.status)
+		j.mu.Unlock()
+	}
+	slices.SortFunc(statuses, func(a, b jobStatus) int { return strings.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+// loop runs a job each time it falls due until ctx is done or its schedule
+// stops
+func (sc *scheduler) loop(ctx context.Context, j *job) {
+	if j.runAtStart {
+		sc.runOnce(ctx, j)
+	}
+	for {
+		sched, err := j.schedule()
+		if err != nil {
+			log.Printf("Job %s stopped: %v", j.name, err)
+			j.update(func(st *jobStatus) { st.NextRun, st.LastError = time.Time{}, err.Error() })
+			return
+		}
+		now := sc.clock.Now()
+		next := sched.next(now)
+		if next.IsZero() {
+			log.Printf("Job %s stopped: schedule %s never runs again", j.name, sched)
+			j.update(func(st *jobStatus) { st.NextRun = time.Time{} })
+			return
+		}
+		if j.jitter > 0 {
+			next = next.Add(sc.delay(j.jitter))
+		}
+		j.update(func(st *jobStatus) { st.Schedule, st.NextRun = sched.String(), next })
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sc.clock.After(next.Sub(now)):
+		}
+		start := sc.runOnce(ctx, j)
+		if finish := sc.clock.Now(); !sched.next(start).After(finish) {
+			jobSkipped.Add(j.name, 1)
+			j.update(func(st *jobStatus) { st.Skipped++ })
+			log.Printf("Job %s took %v, past its next run; skipping to the one after", j.name, finish.Sub(start))
+		}
+	}
+}
+
+// runOnce runs a job and records the outcome, returning when it started
+func (sc *scheduler) runOnce(ctx context.Context, j *job) time.Time {
+	start := sc.clock.Now()
+	j.update(func(st *jobStatus) { st.Running, st.LastStart = true, start })
+	err := j.run(ctx)
+	jobRuns.Add(j.name, 1)
+	if err != nil {
+		jobFailures.Add(j.name, 1)
+	}
+	j.update(func(st *jobStatus) {
+		st.Running, st.LastFinish = false, sc.clock.Now()
+		st.Runs++
+		st.LastError = ""
+		if err != nil {
+			st.Failures++
+			st.LastError = err.Error()
+		}
+	})
+	return start
+}
+
+// update changes a job's status
+func (j *job) update(f func(*jobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f(&j.status)
+}
+
+// jobsHandler lists the scheduled jobs with their next run times and the
+// results of their last runs
+func (s *server) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := []jobStatus{}
+	if s.jobs != nil {
+		statuses = s.jobs.statuses()
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
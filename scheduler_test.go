@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestParseJobSchedule tests parsing cron and @every schedules
+func TestParseJobSchedule(t *testing.T) {
+	now := time.Date(2024, 6, 5, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+		err      bool
+	}{
+		{spec: "*/15 * * * *", expected: time.Date(2024, 6, 5, 10, 15, 0, 0, time.UTC)},
+		{spec: "@daily", expected: time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90m", expected: now.Add(90 * time.Minute)},
+		{spec: "@every 1d", expected: now.Add(24 * time.Hour)},
+		{spec: "@every", err: true},
+		{spec: "@every -5m", err: true},
+		{spec: "@every soon", err: true},
+		{spec: "hourly", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sched, err := parseJobSchedule(tt.spec)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", sched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sched.next(now); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestWindowSchedule tests running archive exports once each window completes
+func TestWindowSchedule(t *testing.T) {
+	sched := windowSchedule{interval: 24 * time.Hour, delay: time.Minute}
+	tests := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{time.Date(2024, 6, 5, 10, 7, 0, 0, time.UTC), time.Date(2024, 6, 6, 0, 1, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 6, 0, 0, 30, 0, time.UTC), time.Date(2024, 6, 6, 0, 1, 0, 0, time.UTC)},
+		{time.Date(2024, 6, 6, 0, 1, 0, 0, time.UTC), time.Date(2024, 6, 7, 0, 1, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := sched.next(tt.now); !got.Equal(tt.expected) {
+			t.Errorf("expected the window after %v to be exported at %v, got %v", tt.now, tt.expected, got)
+		}
+	}
+}
+
+// TestScheduler tests running a job on its schedule with jitter, recording
+// failures, and skipping runs that fall due while it's still running
+func TestScheduler(t *testing.T) {
+	clk := newFakeClock(time.Date(2024, 6, 5, 10, 7, 30, 0, time.UTC))
+	sc := newScheduler(clk)
+	sc.delay = func(max time.Duration) time.Duration { return max / 2 }
+	hourly, _ := parseCron("@hourly")
+	ran := make(chan int, 10)
+	calls := 0
+	sc.add(&job{
+		name:     "refresh",
+		schedule: func() (jobSchedule, error) { return hourly, nil },
+		run: func(ctx context.Context) error {
+			calls++
+			defer func() { ran <- calls }()
+			switch calls {
+			case 2:
+				return errors.New("NWS unavailable")
+			case 3:
+				// Runs past the next top of the hour
+				clk.Advance(90 * time.Minute)
+			}
+			return nil
+		},
+		jitter:     2 * time.Minute,
+		runAtStart: true,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc.start(ctx)
+
+	// status waits for a run and returns the job's status once it's waiting
+	// for the next
+	status := func() jobStatus {
+		t.Helper()
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the job to run")
+		}
+		clk.BlockUntil(t, 1)
+		return sc.statuses()[0]
+	}
+
+	st := status()
+	if st.Runs != 1 || st.Schedule != "@hourly" {
+		t.Errorf("expected a run at start on @hourly, got %+v", st)
+	}
+	if expected := time.Date(2024, 6, 5, 11, 1, 0, 0, time.UTC); !st.NextRun.Equal(expected) {
+		t.Errorf("expected the next run at %v with jitter, got %v", expected, st.NextRun)
+	}
+
+	clk.Advance(53*time.Minute + 30*time.Second)
+	st = status()
+	if st.Runs != 2 || st.Failures != 1 || st.LastError != "NWS unavailable" {
+		t.Errorf("expected a failed run, got %+v", st)
+	}
+
+	clk.Advance(time.Hour)
+	st = status()
+	if st.Runs != 3 || st.Skipped != 1 || st.LastError != "" {
+		t.Errorf("expected a successful run that skipped the next, got %+v", st)
+	}
+	if expected := time.Date(2024, 6, 5, 14, 1, 0, 0, time.UTC); !st.NextRun.Equal(expected) {
+		t.Errorf("expected the next run at %v, got %v", expected, st.NextRun)
+	}
+
+	srv := newServer(Config{})
+	srv.jobs = sc
+	w := httptest.NewRecorder()
+	srv.jobsHandler(w, httptest.NewRequest("GET", "/admin/jobs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var listed []jobStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Name != "refresh" || listed[0].Runs != 3 || !listed[0].NextRun.Equal(st.NextRun) {
+		t.Errorf("expected the job to be listed, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	defaultScoreLimit = 3
+	maxScoreLimit     = 24
+	maxScoreRules     = 16
+)
+
+// scoreField reads a value of an hour for rules to test, reporting false when
+// the forecast has no value
+type scoreField struct {
+	value func(p weatherPeriod) (float64, bool)
+	// tolerance is how far past a limit a value can fall before a soft rule
+	// scores nothing
+	tolerance float64
+}
+
+// scoreFields are the values rules can test, by name
+var scoreFields = map[string]scoreField{
+	"temperatureC": {
+		value:     func(p weatherPeriod) (float64, bool) { return p.TemperatureC, true },
+		tolerance: 5,
+	},
+	"windSpeedKph": {
+		value: func(p weatherPeriod) (float64, bool) {
+			if p.WindSpeedKPH == nil {
+				return 0, false
+			}
+			return *p.WindSpeedKPH, true
+		},
+		tolerance: 15,
+	},
+	"precipitationProbability": {
+		value: func(p weatherPeriod) (float64, bool) {
+			if p.PrecipitationProbability == nil {
+				return 0, false
+			}
+			return float64(*p.PrecipitationProbability), true
+		},
+		tolerance: 30,
+	},
+}
+
+// scoreExprVars are the variables an expression rule can use, each an hour's
+// value
+var scoreExprVars = map[string]exprType{
+	"temperatureC":             exprNumber,
+	"tempC":                    exprNumber,
+	"temperatureF":             exprNumber,
+	"tempF":                    exprNumber,
+	"windSpeedKph":             exprNumber,
+	"windSpeedMph":             exprNumber,
+	"precipitationProbability": exprNumber,
+	"pop":                      exprNumber,
+	"hour":                     exprNumber,
+	"daytime":                  exprBool,
+	"condition":                exprString,
+}
+
+// scoreExprEnv returns the values of an hour for expression rules, leaving out
+// those the forecast doesn't have
+func scoreExprEnv(p weatherPeriod) map[string]any {
+	env := map[string]any{
+		"temperatureC": p.TemperatureC,
+		"tempC":        p.TemperatureC,
+		"temperatureF": celsiusToFahrenheit(p.TemperatureC),
+		"tempF":        celsiusToFahrenheit(p.TemperatureC),
+		"hour":         float64(p.Start.Hour()),
+		"daytime":      p.IsDaytime,
+		"condition":    string(p.Condition),
+	}
+	if p.WindSpeedKPH != nil {
+		env["windSpeedKph"] = *p.WindSpeedKPH
+		env["windSpeedMph"] = kphToMPH(*p.WindSpeedKPH)
+	}
+	if p.PrecipitationProbability != nil {
+		env["precipitationProbability"] = float64(*p.PrecipitationProbability)
+		env["pop"] = float64(*p.PrecipitationProbability)
+	}
+	return env
+}
+
+// wasmScoreType is the signature of the score function a WASM rule exports:
+// given an hour's temperatureC, windSpeedKph, precipitationProbability, hour,
+// and daytime (1 or 0), with NaN for unknown values, it returns the hour's
+// score from 0 to 1, or NaN when it can't score the hour
+var wasmScoreType = wasmFuncType{params: []byte{wasmF64, wasmF64, wasmF64, wasmF64, wasmI32}, results: []byte{wasmF64}}
+
+// scoreRule constrains a field to a range. An hour within the range scores
+// full marks for the rule; outside it, the score falls away linearly over the
+// field's tolerance. A required rule instead makes any hour outside the range
+// a no-go.
+//
+// A rule may instead give an Expr, such as "tempF < 35 && pop > 50", which an
+// hour satisfies for full marks or fails for none, or a base64 WASM module
+// exporting a score function, for logic an expression can't express. Name
+// labels the violations of an Expr or WASM rule.
+type scoreRule struct {
+	Name     string   `json:"name,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Expr     string   `json:"expr,omitempty"`
+	WASM     string   `json:"wasm,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Weight   float64  `json:"weight,omitempty"`
+	Required bool     `json:"required,omitempty"`
+
+	expr *expression
+	// module is the decoded WASM, and wasm the rule's own instance of it, so
+	// a request's hours share its memory but no other request does
+	module    []byte
+	wasm      *wasmModule
+	wasmScore api.Function
+	// err is the first failure of a WASM rule
+	err error
+}
+
+// name labels the rule's violations
+func (r *scoreRule) name() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Expr != "":
+		return r.Expr
+	case r.WASM != "":
+		return "wasm"
+	}
+	return r.Field
+}
+
+// validate checks that a rule names a known field and a sensible range, or
+// compiles its expression
+func (r *scoreRule) validate() error {
+	if r.Expr != "" || r.WASM != "" {
+		if r.Field != "" || r.Min != nil || r.Max != nil || (r.Expr != "" && r.WASM != "") {
+			return fmt.Errorf("rule %q can't also have a field, min, max, or another expr or wasm", r.name())
+		}
+		if r.Weight < 0 {
+			return fmt.Errorf("rule %q has a negative weight", r.name())
+		}
+		if r.WASM != "" {
+			b, err := base64.StdEncoding.DecodeString(r.WASM)
+			if err != nil {
+				return fmt.Errorf("rule %q: wasm isn't base64", r.name())
+			}
+			if len(b) > maxWASMModuleSize {
+				return fmt.Errorf("rule %q: wasm is larger than %d bytes", r.name(), maxWASMModuleSize)
+			}
+			r.module = b
+			return nil
+		}
+		expr, err := compileExpr(r.Expr, scoreExprVars)
+		if err != nil {
+			return fmt.Errorf("rule %q: %v", r.Expr, err)
+		}
+		r.expr = expr
+		return nil
+	}
+	if _, ok := scoreFields[r.Field]; !ok {
+		return fmt.Errorf("unknown field %q", r.Field)
+	}
+	if r.Min == nil && r.Max == nil {
+		return fmt.Errorf("rule for %s needs a min or max", r.Field)
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("rule for %s has min above max", r.Field)
+	}
+	if r.Weight < 0 {
+		return fmt.Errorf("rule for %s has a negative weight", r.Field)
+	}
+	return nil
+}
+
+// instantiate compiles a WASM rule's module into an instance of its own in rt
+func (r *scoreRule) instantiate(rt *wasmRuntime) error {
+	m, err := rt.compile(r.module)
+	if err != nil {
+		return fmt.Errorf("rule %q: %w", r.name(), err)
+	}
+	r.wasm = m
+	if r.wasmScore, err = m.export("score", wasmScoreType); err != nil {
+		return fmt.Errorf("rule %q: %w", r.name(), err)
+	}
+	return nil
+}
+
+// scoreWASM runs a WASM rule's score function for an hour, reporting false
+// when it can't score the hour
+func (r *scoreRule) scoreWASM(p weatherPeriod) (float64, bool) {
+	if r.err != nil {
+		return 0, false
+	}
+	unknown := func(v *float64) float64 {
+		if v == nil {
+			return math.NaN()
+		}
+		return *v
+	}
+	pop := math.NaN()
+	if p.PrecipitationProbability != nil {
+		pop = float64(*p.PrecipitationProbability)
+	}
+	results, err := r.wasm.run(r.wasmScore,
+		math.Float64bits(p.TemperatureC),
+		math.Float64bits(unknown(p.WindSpeedKPH)),
+		math.Float64bits(pop),
+		math.Float64bits(float64(p.Start.Hour())),
+		wasmBool(p.IsDaytime),
+	)
+	if err != nil {
+		r.err = fmt.Errorf("rule %q: %w", r.name(), err)
+		return 0, false
+	}
+	score := math.Float64frombits(results[0])
+	if math.IsNaN(score) {
+		return 0, false
+	}
+	return min(max(score, 0), 1), true
+}
+
+// usesWASM reports whether any of the request's rules is a WASM module
+func (req *scoreRequest) usesWASM() bool {
+	return slices.ContainsFunc(req.Rules, func(r scoreRule) bool { return r.WASM != "" })
+}
+
+// instantiate compiles the request's WASM rules into rt
+func (req *scoreRequest) instantiate(rt *wasmRuntime) error {
+	for i := range req.Rules {
+		if req.Rules[i].module != nil {
+			if err := req.Rules[i].instantiate(rt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// err returns the first failure of the request's WASM rules
+func (req *scoreRequest) err() error {
+	for _, rule := range req.Rules {
+		if rule.err != nil {
+			return rule.err
+		}
+	}
+	return nil
+}
+
+// evaluate scores a value from 0 to 1 and reports whether it is in range
+func (r scoreRule) evaluate(v float64) (float64, bool) {
+	var distance float64
+	if r.Min != nil && v < *r.Min {
+		distance = *r.Min - v
+	}
+	if r.Max != nil && v > *r.Max {
+		distance = v - *r.Max
+	}
+	if distance == 0 {
+		return 1, true
+	}
+	return max(0, 1-distance/scoreFields[r.Field].tolerance), false
+}
+
+// scoreRequest is the body of POST /score. Start and End limit the hours
+// considered, and Hours is the length of window wanted.
+type scoreRequest struct {
+	Latitude        float64     `json:"latitude"`
+	Longitude       float64     `json:"longitude"`
+	Start           *time.Time  `json:"start,omitempty"`
+	End             *time.Time  `json:"end,omitempty"`
+	Hours           int         `json:"hours,omitempty"`
+	DaytimeOnly     bool        `json:"daytimeOnly,omitempty"`
+	AvoidConditions []condition `json:"avoidConditions,omitempty"`
+	Rules           []scoreRule `json:"rules"`
+	Limit           int         `json:"limit,omitempty"`
+}
+
+// validate checks a score request and fills in defaults
+func (req *scoreRequest) validate() error {
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
+		return fmt.Errorf("latitude or longitude out of range")
+	}
+	if req.Start != nil && req.End != nil && !req.Start.Before(*req.End) {
+		return fmt.Errorf("start must be before end")
+	}
+	if req.Hours == 0 {
+		req.Hours = 1
+	}
+	if req.Hours < 1 || req.Hours > 24 {
+		return fmt.Errorf("hours must be between 1 and 24")
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultScoreLimit
+	}
+	if req.Limit < 1 || req.Limit > maxScoreLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxScoreLimit)
+	}
+	if len(req.Rules) == 0 && len(req.AvoidConditions) == 0 && !req.DaytimeOnly {
+		return fmt.Errorf("at least one rule is required")
+	}
+	if len(req.Rules) > maxScoreRules {
+		return fmt.Errorf("at most %d rules are allowed", maxScoreRules)
+	}
+	for i := range req.Rules {
+		if err := req.Rules[i].validate(); err != nil {
+			return err
+		}
+		if req.Rules[i].Weight == 0 {
+			req.Rules[i].Weight = 1
+		}
+	}
+	for _, c := range req.AvoidConditions {
+		if !slices.Contains(conditions, c) {
+			return fmt.Errorf("unknown condition %q", c)
+		}
+	}
+	return nil
+}
+
+// scoredHour is one hour of the /score response
+type scoredHour struct {
+	StartTime time.Time `json:"startTime"`
+	// Score is the weighted average of the hour's rule scores, out of 100
+	Score int  `json:"score"`
+	Go    bool `json:"go"`
+	// Violations names the rules, conditions, or darkness that ruled the hour
+	// out or cost it points
+	Violations []string `json:"violations,omitempty"`
+}
+
+// scoredWindow is a run of consecutive hours
+type scoredWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Score int       `json:"score"`
+	Go    bool      `json:"go"`
+}
+
+// scoreResponse is the body of POST /score
+type scoreResponse struct {
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	Hours     []scoredHour   `json:"hours"`
+	Windows   []scoredWindow `json:"windows"`
+}
+
+// scoreHour evaluates a request's rules against one hour
+func (req *scoreRequest) scoreHour(p weatherPeriod) scoredHour {
+	h := scoredHour{StartTime: p.Start, Go: true}
+	if req.DaytimeOnly && !p.IsDaytime {
+		h.Go = false
+		h.Violations = append(h.Violations, "daytime")
+	}
+	if slices.Contains(req.AvoidConditions, p.Condition) {
+		h.Go = false
+		h.Violations = append(h.Violations, string(p.Condition))
+	}
+
+	var total, weights float64
+	var env map[string]any
+	for i := range req.Rules {
+		rule := &req.Rules[i]
+		var score float64
+		var within bool
+		switch {
+		case rule.wasm != nil:
+			var ok bool
+			if score, ok = rule.scoreWASM(p); !ok {
+				continue
+			}
+			within = score == 1
+		case rule.expr != nil:
+			if env == nil {
+				env = scoreExprEnv(p)
+			}
+			var err error
+			if within, err = rule.expr.eval(env); err != nil {
+				// Unknown values neither help nor hurt
+				continue
+			}
+			if within {
+				score = 1
+			}
+		default:
+			v, ok := scoreFields[rule.Field].value(p)
+			if !ok {
+				continue
+			}
+			score, within = rule.evaluate(v)
+		}
+		if !within {
+			h.Violations = append(h.Violations, rule.name())
+			if rule.Required {
+				h.Go = false
+			}
+		}
+		total += score * rule.Weight
+		weights += rule.Weight
+	}
+	h.Score = 100
+	if weights > 0 {
+		h.Score = roundInt(100 * total / weights)
+	}
+	if !h.Go {
+		h.Score = 0
+	}
+	return h
+}
+
+// scoreWindows scores every hour and picks the best non-overlapping windows of
+// consecutive hours. A window scores the mean of its hours and is a go only
+// when all of them are. Go windows rank first, then higher scores, then
+// earlier ones.
+func (req *scoreRequest) scoreWindows(periods []weatherPeriod) ([]scoredHour, []scoredWindow) {
+	hours := make([]scoredHour, 0, len(periods))
+	for _, p := range periods {
+		if (req.Start != nil && p.Start.Before(*req.Start)) || (req.End != nil && p.Start.Add(time.Hour).After(*req.End)) {
+			continue
+		}
+		hours = append(hours, req.scoreHour(p))
+	}
+
+	windows := make([]scoredWindow, 0, len(hours))
+	for i := 0; i+req.Hours <= len(hours); i++ {
+		run := hours[i : i+req.Hours]
+		// Skip runs with a gap between hours
+		if !run[len(run)-1].StartTime.Equal(run[0].StartTime.Add(time.Duration(req.Hours-1) * time.Hour)) {
+			continue
+		}
+		w := scoredWindow{Start: run[0].StartTime, End: run[0].StartTime.Add(time.Duration(req.Hours) * time.Hour), Go: true}
+		total := 0
+		for _, h := range run {
+			total += h.Score
+			w.Go = w.Go && h.Go
+		}
+		w.Score = roundInt(float64(total) / float64(len(run)))
+		windows = append(windows, w)
+	}
+
+	// Windows are in time order, so a stable sort keeps earlier ones first
+	sort.SliceStable(windows, func(a, b int) bool {
+		if windows[a].Go != windows[b].Go {
+			return windows[a].Go
+		}
+		return windows[a].Score > windows[b].Score
+	})
+	best := []scoredWindow{}
+	for _, w := range windows {
+		if len(best) == req.Limit {
+			break
+		}
+		if !slices.ContainsFunc(best, func(b scoredWindow) bool { return w.Start.Before(b.End) && b.Start.Before(w.End) }) {
+			best = append(best, w)
+		}
+	}
+	return hours, best
+}
+
+// scoreHandler scores each hour of the forecast against client supplied rules
+// and returns the best windows for an outdoor event
+func (s *server) scoreHandler(w http.ResponseWriter, r *http.Request) {
+	var req scoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// WASM rules run on the caller's budget, so they need a key to charge
+	budget := s.state.Config().WASMBudget
+	var key *APIKey
+	var left time.Duration
+	if req.usesWASM() {
+		if budget == 0 {
+			http.Error(w, "WASM rules are disabled", http.StatusBadRequest)
+			return
+		}
+		if key = apiKeyFromContext(r.Context()); key == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="forecast"`)
+			http.Error(w, "WASM rules require an API key", http.StatusUnauthorized)
+			return
+		}
+		var wait time.Duration
+		if left, wait = s.wasmBudget.left(key.ID, budget, s.clock.Now()); left == 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "WASM run time budget exhausted", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	lat := strconv.FormatFloat(req.Latitude, 'f', -1, 64)
+	lon := strconv.FormatFloat(req.Longitude, 'f', -1, 64)
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+
+	resp := scoreResponse{Latitude: req.Latitude, Longitude: req.Longitude}
+	if key == nil {
+		resp.Hours, resp.Windows = req.scoreWindows(periods)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), min(left, maxWASMRunTime))
+	defer cancel()
+	rt := newWASMRuntime(ctx)
+	defer rt.close()
+	start := time.Now()
+	err = req.instantiate(rt)
+	if err == nil {
+		resp.Hours, resp.Windows = req.scoreWindows(periods)
+	}
+	s.wasmBudget.charge(key.ID, budget, time.Since(start), s.clock.Now())
+	if err != nil && !errors.Is(err, errWASMRunTime) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		err = req.err()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestScoreRuleEvaluate tests rule scores inside and beyond their range
+func TestScoreRuleEvaluate(t *testing.T) {
+	lo, hi := 15.0, 25.0
+	rule := scoreRule{Field: "temperatureC", Min: &lo, Max: &hi}
+	tests := []struct {
+		value    float64
+		expected float64
+		within   bool
+	}{
+		{value: 15, expected: 1, within: true},
+		{value: 20, expected: 1, within: true},
+		{value: 25, expected: 1, within: true},
+		{value: 27.5, expected: 0.5},
+		{value: 12, expected: 0.4},
+		{value: 5, expected: 0},
+	}
+	for _, tt := range tests {
+		got, within := rule.evaluate(tt.value)
+		if got != tt.expected || within != tt.within {
+			t.Errorf("%v°C: expected %v (%v), got %v (%v)", tt.value, tt.expected, tt.within, got, within)
+		}
+	}
+}
+
+// TestScoreRequestValidate tests rejecting malformed score requests
+func TestScoreRequestValidate(t *testing.T) {
+	one, two := 1.0, 2.0
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(-time.Hour)
+	tests := []struct {
+		name  string
+		req   scoreRequest
+		error string
+	}{
+		{name: "valid", req: scoreRequest{Rules: []scoreRule{{Field: "windSpeedKph", Max: &one}}}},
+		{name: "avoid only", req: scoreRequest{AvoidConditions: []condition{conditionThunderstorm}}},
+		{name: "no rules", req: scoreRequest{}, error: "at least one rule"},
+		{name: "unknown field", req: scoreRequest{Rules: []scoreRule{{Field: "humidity", Max: &one}}}, error: "unknown field"},
+		{name: "no range", req: scoreRequest{Rules: []scoreRule{{Field: "temperatureC"}}}, error: "needs a min or max"},
+		{name: "inverted range", req: scoreRequest{Rules: []scoreRule{{Field: "temperatureC", Min: &two, Max: &one}}}, error: "min above max"},
+		{name: "negative weight", req: scoreRequest{Rules: []scoreRule{{Field: "temperatureC", Min: &one, Weight: -1}}}, error: "negative weight"},
+		{name: "expression", req: scoreRequest{Rules: []scoreRule{{Expr: "tempF < 35 && pop > 50"}}}},
+		{name: "bad expression", req: scoreRequest{Rules: []scoreRule{{Expr: "humidity > 50"}}}, error: "unknown variable"},
+		{name: "expression and field", req: scoreRequest{Rules: []scoreRule{{Expr: "pop > 50", Field: "temperatureC", Min: &one}}}, error: "can't also have"},
+		{name: "wasm", req: scoreRequest{Rules: []scoreRule{{WASM: wasmDryRule}}}},
+		{name: "wasm not base64", req: scoreRequest{Rules: []scoreRule{{WASM: "not a module!"}}}, error: "isn't base64"},
+		{name: "wasm too large", req: scoreRequest{Rules: []scoreRule{{WASM: base64.StdEncoding.EncodeToString(make([]byte, maxWASMModuleSize+1))}}}, error: "larger than"},
+		{name: "unknown condition", req: scoreRequest{AvoidConditions: []condition{"frogs"}}, error: "unknown condition"},
+		{name: "window too long", req: scoreRequest{DaytimeOnly: true, Hours: 48}, error: "hours must be"},
+		{name: "too many results", req: scoreRequest{DaytimeOnly: true, Limit: 100}, error: "limit must be"},
+		{name: "backwards", req: scoreRequest{DaytimeOnly: true, Start: &start, End: &end}, error: "start must be before end"},
+		{name: "out of range", req: scoreRequest{DaytimeOnly: true, Latitude: 91}, error: "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.validate()
+			if tt.error == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tt.req.Hours != 1 || tt.req.Limit != defaultScoreLimit {
+					t.Errorf("expected defaults, got %+v", tt.req)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("expected error containing %q, got %v", tt.error, err)
+			}
+		})
+	}
+}
+
+// TestScoreWindows tests scoring hours and picking the best windows
+func TestScoreWindows(t *testing.T) {
+	start := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	wind := func(v float64) *float64 { return &v }
+	pop := func(v int) *int { return &v }
+	type hour struct {
+		wind float64
+		pop  int
+		c    condition
+	}
+	forecast := []hour{
+		{wind: 10, pop: 10, c: conditionClear},        // 08:00 perfect
+		{wind: 10, pop: 10, c: conditionClear},        // 09:00 perfect
+		{wind: 25, pop: 10, c: conditionClear},        // 10:00 too windy, costs points
+		{wind: 10, pop: 70, c: conditionRain},         // 11:00 too wet, a no-go
+		{wind: 10, pop: 10, c: conditionThunderstorm}, // 12:00 avoided
+		{wind: 12, pop: 0, c: conditionClear},         // 13:00 perfect
+		{wind: 12, pop: 0, c: conditionClear},         // 14:00 perfect
+	}
+	var periods []weatherPeriod
+	for i, h := range forecast {
+		periods = append(periods, weatherPeriod{Start: start.Add(time.Duration(i) * time.Hour), IsDaytime: true, WindSpeedKPH: wind(h.wind), PrecipitationProbability: pop(h.pop), Condition: h.c})
+	}
+
+	maxWind, maxPop := 20.0, 30.0
+	req := scoreRequest{
+		Hours:           2,
+		AvoidConditions: []condition{conditionThunderstorm},
+		Rules: []scoreRule{
+			{Field: "windSpeedKph", Max: &maxWind},
+			{Field: "precipitationProbability", Max: &maxPop, Required: true, Weight: 2},
+		},
+	}
+	if err := req.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hours, windows := req.scoreWindows(periods)
+
+	expectedHours := []struct {
+		score      int
+		go_        bool
+		violations string
+	}{
+		{100, true, ""},
+		{100, true, ""},
+		// The wind rule scores 1-5/15 with weight 1 of 3
+		{89, true, "windSpeedKph"},
+		{0, false, "precipitationProbability"},
+		{0, false, "thunderstorm"},
+		{100, true, ""},
+		{100, true, ""},
+	}
+	for i, e := range expectedHours {
+		h := hours[i]
+		if h.Score != e.score || h.Go != e.go_ || strings.Join(h.Violations, ",") != e.violations {
+			t.Errorf("hour %d: expected %d %v %q, got %d %v %q", i, e.score, e.go_, e.violations, h.Score, h.Go, h.Violations)
+		}
+	}
+
+	// The two perfect windows come first, earliest first, then the best
+	// non-overlapping go window left
+	expectedStarts := []int{0, 5}
+	if len(windows) != 3 {
+		t.Fatalf("expected 3 windows, got %+v", windows)
+	}
+	for i, hour := range expectedStarts {
+		if !windows[i].Start.Equal(start.Add(time.Duration(hour)*time.Hour)) || windows[i].Score != 100 || !windows[i].Go {
+			t.Errorf("window %d: unexpected %+v", i, windows[i])
+		}
+	}
+	if w := windows[2]; w.Go || !w.End.Equal(w.Start.Add(2*time.Hour)) {
+		t.Errorf("expected a no-go window to fill the last place, got %+v", w)
+	}
+
+	// Start and end limit the hours considered
+	from, to := start.Add(5*time.Hour), start.Add(7*time.Hour)
+	req.Start, req.End = &from, &to
+	hours, windows = req.scoreWindows(periods)
+	if len(hours) != 2 || len(windows) != 1 || !windows[0].Start.Equal(from) {
+		t.Errorf("expected one window from %v, got %+v", from, windows)
+	}
+}
+
+// TestScoreExpressionRules tests scoring hours against expression rules
+func TestScoreExpressionRules(t *testing.T) {
+	start := time.Date(2024, 1, 10, 5, 0, 0, 0, time.UTC)
+	pop := func(v int) *int { return &v }
+	periods := []weatherPeriod{
+		{Start: start, TemperatureC: 0, PrecipitationProbability: pop(80)},
+		{Start: start.Add(time.Hour), TemperatureC: 0, PrecipitationProbability: pop(80)},
+		{Start: start.Add(2 * time.Hour), TemperatureC: 5, PrecipitationProbability: pop(80)},
+		{Start: start.Add(3 * time.Hour), TemperatureC: 0},
+	}
+	req := scoreRequest{
+		Rules: []scoreRule{
+			{Expr: "tempF < 35 && pop > 50 && hour >= 6", Required: true},
+			{Expr: "condition != 'thunderstorm'"},
+		},
+	}
+	if err := req.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hours, _ := req.scoreWindows(periods)
+	expected := []struct {
+		score      int
+		go_        bool
+		violations string
+	}{
+		{0, false, "tempF < 35 && pop > 50 && hour >= 6"},
+		{100, true, ""},
+		{0, false, "tempF < 35 && pop > 50 && hour >= 6"},
+		// Without a chance of precipitation the first rule can't be decided
+		{100, true, ""},
+	}
+	for i, e := range expected {
+		h := hours[i]
+		if h.Score != e.score || h.Go != e.go_ || strings.Join(h.Violations, ",") != e.violations {
+			t.Errorf("hour %d: expected %d %v %q, got %d %v %q", i, e.score, e.go_, e.violations, h.Score, h.Go, h.Violations)
+		}
+	}
+}
+
+// wasmDryRule is a WASM rule scoring an hour 1 - precipitationProbability/100
+var wasmDryRule = base64.StdEncoding.EncodeToString(buildWASM(-1, testWASMFunc{
+	params:  wasmScoreType.params,
+	results: wasmScoreType.results,
+	export:  "score",
+	// f64.const 1, local.get 2, f64.const 100, f64.div, f64.sub
+	body: []byte{0x44, 0, 0, 0, 0, 0, 0, 0xF0, 0x3F, 0x20, 2, 0x44, 0, 0, 0, 0, 0, 0, 0x59, 0x40, 0xA3, 0xA1, 0x0B},
+}))
+
+// TestScoreWASMRules tests scoring hours with WASM rules and failing requests
+// whose rules trap
+func TestScoreWASMRules(t *testing.T) {
+	start := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	pop := func(v int) *int { return &v }
+	periods := []weatherPeriod{
+		{Start: start, PrecipitationProbability: pop(0)},
+		{Start: start.Add(time.Hour), PrecipitationProbability: pop(40)},
+		{Start: start.Add(2 * time.Hour)},
+	}
+	// instantiate validates req and compiles its rules into a runtime that
+	// gives up after timeout
+	instantiate := func(req *scoreRequest, timeout time.Duration) {
+		t.Helper()
+		if err := req.validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		rt := newWASMRuntime(ctx)
+		t.Cleanup(func() {
+			rt.close()
+			cancel()
+		})
+		if err := req.instantiate(rt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	req := scoreRequest{Rules: []scoreRule{{Name: "dry", WASM: wasmDryRule}}}
+	instantiate(&req, time.Second)
+	hours, _ := req.scoreWindows(periods)
+	expected := []struct {
+		score      int
+		violations string
+	}{
+		{100, ""},
+		{60, "dry"},
+		// An unknown chance of precipitation makes the rule return NaN
+		{100, ""},
+	}
+	for i, e := range expected {
+		if h := hours[i]; h.Score != e.score || strings.Join(h.Violations, ",") != e.violations {
+			t.Errorf("hour %d: expected %d %q, got %d %q", i, e.score, e.violations, h.Score, h.Violations)
+		}
+	}
+	if err := req.err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	spin := base64.StdEncoding.EncodeToString(buildWASM(-1, testWASMFunc{
+		params:  wasmScoreType.params,
+		results: wasmScoreType.results,
+		export:  "score",
+		body:    []byte{0x03, 0x40, 0x0C, 0, 0x0B, 0x00, 0x0B},
+	}))
+	req = scoreRequest{Rules: []scoreRule{{Name: "spin", WASM: spin}}}
+	instantiate(&req, 50*time.Millisecond)
+	req.scoreWindows(periods)
+	if err := req.err(); !errors.Is(err, errWASMRunTime) {
+		t.Errorf("expected the rule to run out of time, got %v", err)
+	}
+}
+
+// TestScoreWASMBudget tests that WASM rules need an API key, and run on its
+// budget until it's spent
+func TestScoreWASMBudget(t *testing.T) {
+	srv, tokens := newAuthServer(t, Config{NWSAPIHost: fakeNWSHost, WASMBudget: 50 * time.Millisecond})
+	clk := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv.clock = clk
+	srv.nws = newFakeDoer(map[string]fakeResponse{
+		"/points/":                               {body: `{"properties": {"forecastHourly": "` + fakeNWSHost + `/gridpoints/SEW/124,67/forecast/hourly"}}`},
+		"/gridpoints/SEW/124,67/forecast/hourly": {body: `{"properties": {"periods": [{"startTime": "2024-06-01T13:00:00Z", "endTime": "2024-06-01T14:00:00Z", "temperature": 65, "isDaytime": true, "probabilityOfPrecipitation": {"value": 20}}]}}`},
+	})
+	routes := srv.routes()
+	score := func(wasm, token string) *httptest.ResponseRecorder {
+		body := `{"latitude": 47.6, "longitude": -122.3, "rules": [{"name": "rule", "wasm": "` + wasm + `"}]}`
+		req := httptest.NewRequest("POST", "/score", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-API-Key", token)
+		}
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+		return w
+	}
+	token := tokens[scopeRead]
+
+	if w := score(wasmDryRule, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected anonymous WASM rules to be refused with 401, got %d", w.Code)
+	}
+	if w := score(wasmDryRule, token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"score":80`) {
+		t.Errorf("expected the rule to score the hour, got %d: %s", w.Code, w.Body.String())
+	}
+	noScore := base64.StdEncoding.EncodeToString(buildWASM(-1, testWASMFunc{body: []byte{0x0B}}))
+	if w := score(noScore, token); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "doesn't export score") {
+		t.Errorf("expected a module without score to be refused with 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A rule that spins runs until the budget is spent, and the key can't
+	// run another until it refills
+	spin := base64.StdEncoding.EncodeToString(buildWASM(-1, testWASMFunc{
+		params:  wasmScoreType.params,
+		results: wasmScoreType.results,
+		export:  "score",
+		body:    []byte{0x03, 0x40, 0x0C, 0, 0x0B, 0x00, 0x0B},
+	}))
+	if w := score(spin, token); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected the spinning rule to fail with 422, got %d: %s", w.Code, w.Body.String())
+	}
+	w := score(wasmDryRule, token)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the spent budget to refuse with 429 and Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if got := wasmRunSeconds.Get(keyID(token)); got == nil || got.String() == "0" {
+		t.Errorf("expected run time charged to the key, got %v", got)
+	}
+	if w := score(wasmDryRule, tokens[scopeAdmin]); w.Code != http.StatusOK {
+		t.Errorf("expected other keys to have budgets of their own, got %d", w.Code)
+	}
+	clk.Advance(time.Minute)
+	if w := score(wasmDryRule, token); w.Code != http.StatusOK {
+		t.Errorf("expected the budget to refill, got %d", w.Code)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secretsTimeout bounds a single lookup in an external secret manager
+const secretsTimeout = 10 * time.Second
+
+// secretsClient calls the secret managers. Its timeout bounds a lookup even
+// when the caller's context doesn't, so a manager that never answers fails
+// startup rather than hanging it.
+var secretsClient doer = &http.Client{Timeout: secretsTimeout}
+
+// configEnv reads a setting from the environment variable name or, when that
+// is unset, from the file named by name_FILE (as mounted by Docker and
+// Kubernetes secrets). A value of the form vault://path#field or
+// aws-sm://secret-id#field is resolved from the secret manager.
+func configEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		if path := os.Getenv(name + "_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("%s_FILE: %v", name, err)
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	resolved, err := resolveSecret(ctx, value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return resolved, nil
+}
+
+// resolveSecret looks up a secret manager reference, returning any other value unchanged
+func resolveSecret(ctx context.Context, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "vault://"):
+		return resolveVaultSecret(ctx, strings.TrimPrefix(value, "vault://"))
+	case strings.HasPrefix(value, "aws-sm://"):
+		return resolveAWSSecret(ctx, strings.TrimPrefix(value, "aws-sm://"))
+	default:
+		return value, nil
+	}
+}
+
+// resolveVaultSecret reads a field from a Vault KV secret, e.g.
+// secret/data/forecast#database_url. Both KV v1 and v2 responses are supported.
+// The server and token come from VAULT_ADDR and VAULT_TOKEN.
+func resolveVaultSecret(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference %q must be path#field", ref)
+	}
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to read vault://%s", ref)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	body, err := doSecretsRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %v", err)
+	}
+
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("vault: failed to parse response: %v", err)
+	}
+	fields := resp.Data
+	// KV v2 nests the secret under data.data
+	if nested, ok := resp.Data["data"]; ok {
+		var inner map[string]json.RawMessage
+		if json.Unmarshal(nested, &inner) == nil {
+			fields = inner
+		}
+	}
+	return secretField(fields, field)
+}
+
+// resolveAWSSecret reads a secret from AWS Secrets Manager, e.g.
+// prod/forecast#database_url. Without a field the whole SecretString is
+// returned; with one, the SecretString is parsed as a JSON object. Credentials
+// and region come from the standard AWS_ environment variables.
+func resolveAWSSecret(ctx context.Context, ref string) (string, error) {
+	secretID, field, _ := strings.Cut(ref, "#")
+	if secretID == "" {
+		return "", fmt.Errorf("aws-sm reference %q has no secret ID", ref)
+	}
+	creds := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" || region == "" {
+		return "", fmt.Errorf("AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_REGION must be set to read aws-sm://%s", ref)
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"SecretId": secretID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSv4(req, payload, creds, region, "secretsmanager", time.Now())
+
+	body, err := doSecretsRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("aws secrets manager: %v", err)
+	}
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("aws secrets manager: failed to parse response: %v", err)
+	}
+	if field == "" {
+		return resp.SecretString, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(resp.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("aws secrets manager: secret %s is not a JSON object", secretID)
+	}
+	return secretField(fields, field)
+}
+
+// secretField extracts a string field from a decoded secret
+func secretField(fields map[string]json.RawMessage, field string) (string, error) {
+	raw, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("secret field %q is not a string", field)
+	}
+	return value, nil
+}
+
+func doSecretsRequest(req *http.Request) ([]byte, error) {
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// awsCredentials are the keys used to sign AWS requests
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// signAWSv4 adds AWS Signature Version 4 headers to req. Every header already
+// set on the request is signed, along with Host and X-Amz-Date.
+func signAWSv4(req *http.Request, payload []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfigEnvFile tests reading settings from _FILE variants
+func TestConfigEnvFile(t *testing.T) {
+	clearForecastEnv(t)
+	path := filepath.Join(t.TempDir(), "database_url")
+	if err := os.WriteFile(path, []byte("postgres://user:pw@db/forecast\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FORECAST_DATABASE_URL_FILE", path)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://user:pw@db/forecast" {
+		t.Errorf("expected value from file, got %q", cfg.DatabaseURL)
+	}
+
+	// The plain variable wins over the file
+	t.Setenv("FORECAST_DATABASE_URL", "sqlite://direct.db")
+	if cfg, _ := loadConfig(); cfg.DatabaseURL != "sqlite://direct.db" {
+		t.Errorf("expected direct value to win, got %q", cfg.DatabaseURL)
+	}
+
+	t.Setenv("FORECAST_DATABASE_URL", "")
+	t.Setenv("FORECAST_DATABASE_URL_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "FORECAST_DATABASE_URL_FILE") {
+		t.Errorf("expected error naming the variable, got %v", err)
+	}
+}
+
+// TestResolveVaultSecret tests reading KV v1 and v2 secrets from Vault
+func TestResolveVaultSecret(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/forecast":
+			w.Write([]byte(`{"data": {"data": {"database_url": "postgres://from-vault"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/forecast":
+			w.Write([]byte(`{"data": {"database_url": "postgres://from-kv-v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	clearForecastEnv(t)
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	tests := []struct {
+		ref         string
+		expected    string
+		expectError bool
+	}{
+		{ref: "vault://secret/data/forecast#database_url", expected: "postgres://from-vault"},
+		{ref: "vault://kv/forecast#database_url", expected: "postgres://from-kv-v1"},
+		{ref: "vault://secret/data/forecast#missing", expectError: true},
+		{ref: "vault://secret/data/other#database_url", expectError: true},
+		{ref: "vault://secret/data/forecast", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			t.Setenv("FORECAST_DATABASE_URL", tt.ref)
+			cfg, err := loadConfig()
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.DatabaseURL != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, cfg.DatabaseURL)
+			}
+		})
+	}
+}
+
+// TestSecretsClient tests that secret lookups go through secretsClient, which
+// gives up on a secret manager that doesn't answer
+func TestSecretsClient(t *testing.T) {
+	if c, ok := secretsClient.(*http.Client); !ok || c.Timeout <= 0 || c.Timeout > secretsTimeout {
+		t.Errorf("expected secretsClient to time out within %v, got %#v", secretsTimeout, secretsClient)
+	}
+
+	client := secretsClient
+	t.Cleanup(func() { secretsClient = client })
+	var requested []string
+	secretsClient = doerFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		return nil, context.DeadlineExceeded
+	})
+	t.Setenv("VAULT_ADDR", "http://vault.invalid")
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	_, err := resolveSecret(t.Context(), "vault://secret/data/forecast#database_url")
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("expected the lookup to fail with the client's error, got %v", err)
+	}
+	if len(requested) != 1 || requested[0] != "http://vault.invalid/v1/secret/data/forecast" {
+		t.Errorf("expected one request through secretsClient, got %v", requested)
+	}
+}
+
+// TestResolveAWSSecret tests reading secrets from AWS Secrets Manager
+func TestResolveAWSSecret(t *testing.T) {
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.SecretId {
+		case "prod/forecast":
+			w.Write([]byte(`{"SecretString": "{\"database_url\": \"postgres://from-aws\"}"}`))
+		case "prod/plain":
+			w.Write([]byte(`{"SecretString": "plain-value"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer aws.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", aws.URL)
+
+	tests := []struct {
+		ref         string
+		expected    string
+		expectError bool
+	}{
+		{ref: "aws-sm://prod/forecast#database_url", expected: "postgres://from-aws"},
+		{ref: "aws-sm://prod/plain", expected: "plain-value"},
+		{ref: "aws-sm://prod/plain#field", expectError: true},
+		{ref: "aws-sm://prod/unknown", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			value, err := resolveSecret(t.Context(), tt.ref)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+// TestSignAWSv4 checks the signer against the get-vanilla case of the AWS
+// Signature Version 4 test suite
+func TestSignAWSv4(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	req.Header = http.Header{}
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	signAWSv4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("unexpected Authorization header\ngot:  %s\nwant: %s", got, expected)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultContentSecurityPolicy forbids loading anything, since API responses are
+// never rendered as pages. Handlers serving HTML set a policy of their own.
+const defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// hstsMaxAge is how long browsers remember to use HTTPS, in seconds
+const hstsMaxAge = "63072000"
+
+// secure wraps every route with standard security headers and, when
+// ForceHTTPS is set, redirects plain HTTP requests to HTTPS
+func (s *server) secure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.state.Config()
+		https := isHTTPS(r, cfg.TrustProxyHeaders)
+		if cfg.ForceHTTPS && !https {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "HTTPS required", http.StatusForbidden)
+				return
+			}
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", defaultContentSecurityPolicy)
+		if https {
+			h.Set("Strict-Transport-Security", "max-age="+hstsMaxAge+"; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isHTTPS reports whether the client connected over TLS, either directly or,
+// when trusted, to a proxy that says so in X-Forwarded-Proto
+func isHTTPS(r *http.Request, trustProxy bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return trustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// externalURL returns the URL a client used to reach the server, for links
+// that must work from outside, such as those in feeds
+func externalURL(r *http.Request, trustProxy bool) *url.URL {
+	u := *r.URL
+	u.Scheme, u.Host = "http", r.Host
+	if isHTTPS(r, trustProxy) {
+		u.Scheme = "https"
+	}
+	return &u
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSecurityHeaders tests the headers set on every response and HTTPS enforcement
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            Config
+		method         string
+		tls            bool
+		forwardedProto string
+		expectedStatus int
+		expectedHSTS   bool
+		expectedTarget string
+	}{
+		{name: "plain HTTP", method: "GET", expectedStatus: http.StatusNotFound},
+		{name: "TLS", method: "GET", tls: true, expectedStatus: http.StatusNotFound, expectedHSTS: true},
+		{name: "untrusted forwarded proto", method: "GET", forwardedProto: "https", expectedStatus: http.StatusNotFound},
+		{name: "trusted forwarded proto", cfg: Config{TrustProxyHeaders: true}, method: "GET", forwardedProto: "https", expectedStatus: http.StatusNotFound, expectedHSTS: true},
+		{name: "forced HTTPS redirect", cfg: Config{ForceHTTPS: true}, method: "GET", expectedStatus: http.StatusPermanentRedirect, expectedTarget: "https://example.com/missing?a=1"},
+		{name: "forced HTTPS rejects writes", cfg: Config{ForceHTTPS: true}, method: "POST", expectedStatus: http.StatusForbidden},
+		{name: "forced HTTPS behind proxy", cfg: Config{ForceHTTPS: true, TrustProxyHeaders: true}, method: "GET", forwardedProto: "https", expectedStatus: http.StatusNotFound, expectedHSTS: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com/missing?a=1", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.forwardedProto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+			}
+			w := httptest.NewRecorder()
+			newServer(tt.cfg).routes().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.expectedTarget {
+				t.Errorf("expected Location %q, got %q", tt.expectedTarget, got)
+			}
+			if got := w.Header().Get("Strict-Transport-Security") != ""; got != tt.expectedHSTS {
+				t.Errorf("expected HSTS %v, got %v", tt.expectedHSTS, got)
+			}
+			if w.Code == http.StatusNotFound {
+				for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Content-Security-Policy"} {
+					if w.Header().Get(header) == "" {
+						t.Errorf("expected %s header", header)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// shareTokenBytes is the entropy of a share token, which encodes to 12
+	// URL-safe characters
+	shareTokenBytes = 9
+	// defaultShareExpiry and maxShareExpiry bound how long a share link resolves
+	defaultShareExpiry = 7 * 24 * time.Hour
+	maxShareExpiry     = 30 * 24 * time.Hour
+	// maxShareWindow is the longest time window a link may name. NWS publishes
+	// about a week of hourly periods.
+	maxShareWindow = 168 * time.Hour
+	// defaultShareView is how far ahead a link without a window shows
+	defaultShareView = 24 * time.Hour
+	// defaultQRScale and maxQRScale bound the pixels per module of a share
+	// link's QR code
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// createShareRequest is the body of POST /share. Start and End name the hours
+// to show and are optional; without them a link shows the next day from when
+// it's opened. ExpiresIn is a duration such as "48h" or "7d".
+type createShareRequest struct {
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Start     *time.Time `json:"start"`
+	End       *time.Time `json:"end"`
+	ExpiresIn string     `json:"expiresIn"`
+}
+
+// validate checks the point and window of a new link and returns how long it
+// resolves for
+func (req createShareRequest) validate() (time.Duration, error) {
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
+		return 0, fmt.Errorf("latitude or longitude out of range")
+	}
+	if (req.Start == nil) != (req.End == nil) {
+		return 0, fmt.Errorf("start and end must be given together")
+	}
+	if req.Start != nil && (!req.End.After(*req.Start) || req.End.Sub(*req.Start) > maxShareWindow) {
+		return 0, fmt.Errorf("end must be after start and at most 7d later")
+	}
+	expiry := defaultShareExpiry
+	if req.ExpiresIn != "" {
+		d, err := parseDuration(req.ExpiresIn)
+		if err != nil || d < time.Hour || d > maxShareExpiry {
+			return 0, fmt.Errorf("expiresIn must be a duration from 1h to 30d")
+		}
+		expiry = d
+	}
+	return expiry, nil
+}
+
+// shareResponse is the body of POST /share
+type shareResponse struct {
+	ShareLink
+	URL string `json:"url"`
+}
+
+// newShareToken returns a random share token
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// createShareHandler saves a share link for a point and returns its URL
+func (s *server) createShareHandler(w http.ResponseWriter, r *http.Request) {
+	var req createShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	expiry, err := req.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err := newShareToken()
+	if err != nil {
+		http.Error(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	now := s.clock.Now()
+	link := &ShareLink{
+		Token:     token,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Start:     req.Start,
+		End:       req.End,
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiry),
+	}
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		link.Owner = key.Owner
+	}
+	if err := s.store.CreateShareLink(r.Context(), link); err != nil {
+		log.Printf("Failed to create share link: %v", err)
+		http.Error(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "share.create", token)
+
+	writeJSON(w, http.StatusCreated, shareResponse{ShareLink: *link, URL: s.shareURL(r, token)})
+}
+
+// shareView is a shared forecast, the JSON body of /s/{token}
+type shareView struct {
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	From      time.Time      `json:"from"`
+	Until     time.Time      `json:"until"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	Periods   []hourlyPeriod `json:"periods"`
+}
+
+var shareTemplate = template.Must(template.New("share").Funcs(template.FuncMap{
+	"temp":   func(c float64) string { return reportTemp(&c) },
+	"precip": reportPrecipitation,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Forecast for {{printf "%.4f, %.4f" .Latitude .Longitude}}</title>
+<meta property="og:title" content="Forecast for {{printf "%.4f, %.4f" .Latitude .Longitude}}">
+{{with .Periods}}<meta property="og:description" content="{{(index . 0).Forecast}}, {{temp (index . 0).TemperatureC}}">{{end}}
+</head>
+<body>
+<h1>Forecast for {{printf "%.4f, %.4f" .Latitude .Longitude}}</h1>
+<p>{{.From.UTC.Format "Mon Jan 2 15:04"}} to {{.Until.UTC.Format "Mon Jan 2 15:04 MST"}}</p>
+{{if .Periods}}
+<table>
+<tr><th>Time</th><th>Forecast</th><th>Temperature</th><th>Precipitation</th></tr>
+{{range .Periods}}<tr><td>{{.StartTime.UTC.Format "Mon 15:04"}}</td><td>{{.Forecast}}</td><td>{{temp .TemperatureC}}</td><td>{{precip .PrecipitationProbability}}</td></tr>
+{{end}}</table>
+{{else}}<p>No forecast is available for these hours.</p>{{end}}
+<p>This link expires {{.ExpiresAt.UTC.Format "Monday, January 2, 2006 15:04 MST"}}.</p>
+</body>
+</html>
+`))
+
+// openShareLink reads the link named by the token path parameter, writing an
+// error response if it's missing or expired
+func (s *server) openShareLink(w http.ResponseWriter, r *http.Request) (*ShareLink, bool) {
+	link, err := s.store.GetShareLink(r.Context(), r.PathValue("token"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to read share link: %v", err)
+		http.Error(w, "Failed to read share link", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !s.clock.Now().Before(link.ExpiresAt) {
+		http.Error(w, "Share link expired", http.StatusGone)
+		return nil, false
+	}
+	return link, true
+}
+
+// shareURL returns the absolute URL of a share link
+func (s *server) shareURL(r *http.Request, token string) string {
+	u := externalURL(r, s.state.Config().TrustProxyHeaders)
+	u.Path, u.RawQuery = "/s/"+token, ""
+	return u.String()
+}
+
+// shareHandler serves the forecast a share link names, as JSON to clients
+// that accept it and as a page otherwise. It needs no API key: the token is
+// the credential.
+func (s *server) shareHandler(w http.ResponseWriter, r *http.Request) {
+	link, ok := s.openShareLink(w, r)
+	if !ok {
+		return
+	}
+
+	now := s.clock.Now()
+	view := shareView{Latitude: link.Latitude, Longitude: link.Longitude, ExpiresAt: link.ExpiresAt, Periods: []hourlyPeriod{}}
+	if link.Start != nil {
+		view.From, view.Until = *link.Start, *link.End
+	} else {
+		view.From, view.Until = now, now.Add(defaultShareView)
+	}
+	lat := strconv.FormatFloat(link.Latitude, 'f', 4, 64)
+	lon := strconv.FormatFloat(link.Longitude, 'f', 4, 64)
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+	for _, p := range periods {
+		if p.End.After(view.From) && p.Start.Before(view.Until) {
+			view.Periods = append(view.Periods, newHourlyPeriod(p))
+		}
+	}
+
+	w.Header().Set("Vary", "Accept")
+	if acceptsJSON(r) {
+		writeJSON(w, http.StatusOK, view)
+		return
+	}
+	var buf bytes.Buffer
+	if err := shareTemplate.Execute(&buf, view); err != nil {
+		log.Printf("Failed to render share page: %v", err)
+		http.Error(w, "Failed to render share page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// shareQRHandler serves a QR code of a share link's URL as a PNG, for printing
+// on posters or showing on kiosks. ?scale= sets the pixels per module.
+func (s *server) shareQRHandler(w http.ResponseWriter, r *http.Request) {
+	scale := defaultQRScale
+	if v := r.URL.Query().Get("scale"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQRScale {
+			http.Error(w, fmt.Sprintf("Invalid scale parameter (want 1 to %d)", maxQRScale), http.StatusBadRequest)
+			return
+		}
+		scale = n
+	}
+	link, ok := s.openShareLink(w, r)
+	if !ok {
+		return
+	}
+	code, err := encodeQR([]byte(s.shareURL(r, link.Token)))
+	if err != nil {
+		log.Printf("Failed to encode QR code: %v", err)
+		http.Error(w, "Failed to encode QR code", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.image(scale)); err != nil {
+		log.Printf("Failed to render QR code: %v", err)
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	// The code never changes, but stops being useful when the link expires
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(link.ExpiresAt.Sub(s.clock.Now()).Seconds())))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCreateShareRequestValidate tests validating the body of POST /share
+func TestCreateShareRequestValidate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		v := start.Add(d)
+		return &v
+	}
+	tests := []struct {
+		name     string
+		req      createShareRequest
+		expected time.Duration
+		wantErr  bool
+	}{
+		{name: "point only", req: createShareRequest{Latitude: 47.6, Longitude: -122.3}, expected: defaultShareExpiry},
+		{name: "window", req: createShareRequest{Start: at(0), End: at(3 * time.Hour), ExpiresIn: "2d"}, expected: 48 * time.Hour},
+		{name: "out of range", req: createShareRequest{Latitude: 91}, wantErr: true},
+		{name: "start without end", req: createShareRequest{Start: at(0)}, wantErr: true},
+		{name: "end before start", req: createShareRequest{Start: at(time.Hour), End: at(0)}, wantErr: true},
+		{name: "window too long", req: createShareRequest{Start: at(0), End: at(8 * 24 * time.Hour)}, wantErr: true},
+		{name: "expiry too long", req: createShareRequest{ExpiresIn: "31d"}, wantErr: true},
+		{name: "invalid expiry", req: createShareRequest{ExpiresIn: "soon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected expiry %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestShareLinks tests creating a share link and opening it as JSON, HTML,
+// and a QR code until it expires
+func TestShareLinks(t *testing.T) {
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hourly-url" {
+			w.Write([]byte(`{"properties": {"periods": [
+				{"startTime": "2024-06-01T09:00:00Z", "endTime": "2024-06-01T10:00:00Z", "shortForecast": "Sunny", "temperature": 68},
+				{"startTime": "2024-06-01T10:00:00Z", "endTime": "2024-06-01T11:00:00Z", "shortForecast": "Rain <heavy>", "temperature": 59, "probabilityOfPrecipitation": {"value": 80}},
+				{"startTime": "2024-06-01T11:00:00Z", "endTime": "2024-06-01T12:00:00Z", "shortForecast": "Cloudy", "temperature": 61}
+			]}}`))
+			return
+		}
+		w.Write([]byte(`{"properties": {"forecastHourly": "http://` + r.Host + `/hourly-url"}}`))
+	}))
+	defer mockNWS.Close()
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+	clock := newFakeClock(time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC))
+	srv.clock = clock
+	handler := srv.routes()
+
+	body := `{"latitude": 47.6062, "longitude": -122.3321, "start": "2024-06-01T10:00:00Z", "end": "2024-06-01T12:00:00Z", "expiresIn": "1d"}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "http://forecast.example.com/share", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+	}
+	var created shareResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Token) != 12 || created.URL != "http://forecast.example.com/s/"+created.Token {
+		t.Fatalf("unexpected link %+v", created)
+	}
+	if !created.ExpiresAt.Equal(time.Date(2024, 6, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the link to expire in a day, got %v", created.ExpiresAt)
+	}
+
+	open := func(path, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w = open("/s/"+created.Token, "application/json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var view shareView
+	if err := json.NewDecoder(w.Body).Decode(&view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.Periods) != 2 || view.Periods[0].Forecast != "Rain <heavy>" || view.Periods[1].Forecast != "Cloudy" {
+		t.Errorf("expected the two hours of the window, got %+v", view.Periods)
+	}
+
+	w = open("/s/"+created.Token, "text/html")
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/html; charset=utf-8" {
+		t.Fatalf("expected an HTML page, got %d %q", w.Code, ct)
+	}
+	page := w.Body.String()
+	if !strings.Contains(page, "Rain &lt;heavy&gt;") || !strings.Contains(page, "15°C / 59°F") || strings.Contains(page, "Sunny") {
+		t.Errorf("unexpected page %s", page)
+	}
+
+	w = open("/share/"+created.Token+"/qr.png?scale=4", "image/png")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a PNG, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 42 byte URL needs version 3, 29 modules plus the quiet zone
+	if b := img.Bounds(); b.Dx() != (29+2*qrQuietZone)*4 || b.Dy() != b.Dx() {
+		t.Errorf("unexpected image size %v", b)
+	}
+	if w := open("/share/"+created.Token+"/qr.png?scale=100", "image/png"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid scale, got %d", w.Code)
+	}
+
+	if w := open("/s/unknown", "text/html"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown token, got %d", w.Code)
+	}
+	clock.Advance(24 * time.Hour)
+	for _, path := range []string{"/s/" + created.Token, "/share/" + created.Token + "/qr.png"} {
+		if w := open(path, "text/html"); w.Code != http.StatusGone {
+			t.Errorf("%s: expected status 410 for an expired link, got %d", path, w.Code)
+		}
+	}
+}
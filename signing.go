@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signatureParam and expiresParam are the query parameters a signed URL
+	// adds to the URL it signs
+	signatureParam = "signature"
+	expiresParam   = "expires"
+	// minURLSigningKeyLength is the shortest signing key accepted, in bytes
+	minURLSigningKeyLength = 32
+	// defaultSignedURLExpiry and maxSignedURLExpiry bound how long a signed
+	// URL is valid
+	defaultSignedURLExpiry = 7 * 24 * time.Hour
+	maxSignedURLExpiry     = 365 * 24 * time.Hour
+)
+
+// urlSignature returns the signature of a path and query. The query includes
+// the expiry and excludes the signature; url.Values encodes it sorted by key,
+// so the order parameters are given in doesn't matter.
+func urlSignature(key, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(path + "?" + query.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignedURL reports whether a request carries a valid signature that
+// hasn't expired as of now
+func verifySignedURL(key string, r *http.Request, now time.Time) bool {
+	if key == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	query := r.URL.Query()
+	signature := query.Get(signatureParam)
+	query.Del(signatureParam)
+	expires, err := strconv.ParseInt(query.Get(expiresParam), 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(urlSignature(key, r.URL.Path, query)))
+}
+
+// signRequest is the body of POST /sign. URL is the path and query of a read
+// route, and ExpiresIn a duration such as "24h" or "30d".
+type signRequest struct {
+	URL       string `json:"url"`
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// signResponse is the body of POST /sign
+type signResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// signable reports whether a path names a GET route that needs no more than
+// the read role, the only routes a signed URL opens
+func (s *server) signable(path string) bool {
+	mux := http.NewServeMux()
+	for _, e := range s.apiEndpoints() {
+		if e.Scope == scopeRead && e.Method == http.MethodGet {
+			mux.HandleFunc("GET "+e.Path, func(http.ResponseWriter, *http.Request) {})
+		}
+	}
+	_, pattern := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}})
+	return pattern != ""
+}
+
+// signHandler signs a URL of a read route so it can be embedded in a page or
+// shared without an API key until it expires
+func (s *server) signHandler(w http.ResponseWriter, r *http.Request) {
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || target.Scheme != "" || target.Host != "" || !strings.HasPrefix(target.Path, "/") {
+		http.Error(w, "url must be a path and query, such as /forecast?latitude=47.6&longitude=-122.3", http.StatusBadRequest)
+		return
+	}
+	if !s.signable(target.Path) {
+		http.Error(w, "url must name a GET route needing only the read role", http.StatusBadRequest)
+		return
+	}
+	expiry := defaultSignedURLExpiry
+	if req.ExpiresIn != "" {
+		d, err := parseDuration(req.ExpiresIn)
+		if err != nil || d < time.Minute || d > maxSignedURLExpiry {
+			http.Error(w, "expiresIn must be a duration from 1m to 365d", http.StatusBadRequest)
+			return
+		}
+		expiry = d
+	}
+
+	cfg := s.state.Config()
+	expiresAt := s.clock.Now().Add(expiry).Truncate(time.Second)
+	query := target.Query()
+	query.Del(signatureParam)
+	query.Set(expiresParam, strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set(signatureParam, urlSignature(cfg.URLSigningKey, target.Path, query))
+
+	u := externalURL(r, cfg.TrustProxyHeaders)
+	u.Path, u.RawQuery = target.Path, query.Encode()
+	if s.store != nil {
+		s.audit(r, "url.sign", fmt.Sprintf("%s until %s", target.Path, expiresAt.UTC().Format(time.RFC3339)))
+	}
+	writeJSON(w, http.StatusOK, signResponse{URL: u.String(), ExpiresAt: expiresAt.UTC()})
+}
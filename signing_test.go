@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "0123456789abcdef0123456789abcdef"
+
+// TestVerifySignedURL tests accepting signed URLs and rejecting altered or
+// expired ones
+func TestVerifySignedURL(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	query := url.Values{"latitude": {"47.6062"}, "longitude": {"-122.3321"}, expiresParam: {"1717250400"}}
+	query.Set(signatureParam, urlSignature(testSigningKey, "/forecast", query))
+	signed := "/forecast?" + query.Encode()
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		key      string
+		now      time.Time
+		expected bool
+	}{
+		{name: "valid", method: "GET", target: signed, key: testSigningKey, now: now, expected: true},
+		{name: "reordered parameters", method: "GET", target: "/forecast?signature=" + query.Get(signatureParam) + "&longitude=-122.3321&expires=1717250400&latitude=47.6062", key: testSigningKey, now: now, expected: true},
+		{name: "expired", method: "GET", target: signed, key: testSigningKey, now: now.Add(2 * time.Hour)},
+		{name: "altered point", method: "GET", target: strings.Replace(signed, "47.6062", "40.7128", 1), key: testSigningKey, now: now},
+		{name: "altered expiry", method: "GET", target: strings.Replace(signed, "1717250400", "1917250400", 1), key: testSigningKey, now: now},
+		{name: "other path", method: "GET", target: strings.Replace(signed, "/forecast", "/forecast/hourly", 1), key: testSigningKey, now: now},
+		{name: "other key", method: "GET", target: signed, key: strings.Repeat("x", 32), now: now},
+		{name: "signing disabled", method: "GET", target: signed, now: now},
+		{name: "POST", method: "POST", target: signed, key: testSigningKey, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifySignedURL(tt.key, httptest.NewRequest(tt.method, tt.target, nil), tt.now); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSignHandler tests signing a URL and using it without an API key while
+// authentication is required
+func TestSignHandler(t *testing.T) {
+	mockNWS := createMockNWSServer(http.StatusOK, http.StatusOK, `{"properties": {"periods": [{"temperature": 72, "shortForecast": "Sunny"}]}}`)
+	defer mockNWS.Close()
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL, AuthRequired: true, URLSigningKey: testSigningKey, OIDCIssuer: "https://login.example.com"})
+	clock := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv.clock = clock
+	handler := srv.routes()
+
+	get := func(target string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w.Code
+	}
+	if code := get("/forecast?latitude=47.6062&longitude=-122.3321"); code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 without a key, got %d", code)
+	}
+
+	// Signing is a read route, so it also needs a key while authentication
+	// is required; call the handler directly as an authenticated caller would
+	sign := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.signHandler(w, httptest.NewRequest("POST", "https://forecast.example.com/sign", strings.NewReader(body)))
+		return w
+	}
+	w := sign(`{"url": "/forecast?latitude=47.6062&longitude=-122.3321", "expiresIn": "1h"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp signResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.URL, "https://forecast.example.com/forecast?") || !resp.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("unexpected signed URL %+v", resp)
+	}
+	u, _ := url.Parse(resp.URL)
+	if code := get(u.RequestURI()); code != http.StatusOK {
+		t.Errorf("expected status 200 for the signed URL, got %d", code)
+	}
+	if code := get(strings.Replace(u.RequestURI(), "47.6062", "40.7128", 1)); code != http.StatusForbidden {
+		t.Errorf("expected status 403 for an altered URL, got %d", code)
+	}
+	clock.Advance(time.Hour)
+	if code := get(u.RequestURI()); code != http.StatusForbidden {
+		t.Errorf("expected status 403 for an expired URL, got %d", code)
+	}
+
+	for name, body := range map[string]string{
+		"absolute URL":   `{"url": "https://example.com/forecast"}`,
+		"write route":    `{"url": "/score"}`,
+		"public route":   `{"url": "/version"}`,
+		"unknown route":  `{"url": "/nothing"}`,
+		"invalid expiry": `{"url": "/forecast", "expiresIn": "2y"}`,
+	} {
+		if w := sign(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, w.Code)
+		}
+	}
+}
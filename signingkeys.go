@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultSigningKeyOverlap and maxSigningKeyOverlap bound how long a
+	// rotated signing key keeps signing next to its replacement
+	defaultSigningKeyOverlap = 24 * time.Hour
+	maxSigningKeyOverlap     = 7 * 24 * time.Hour
+)
+
+// signingSecrets returns the secrets of owner's active signing keys, newest
+// first, or none when the owner has none and notifications are signed with
+// each subscription's secret
+func (s *server) signingSecrets(ctx context.Context, owner string) []string {
+	if s.store == nil {
+		return nil
+	}
+	keys, err := s.store.ListSigningKeys(ctx, owner)
+	if err != nil {
+		log.Printf("Failed to list signing keys of %s: %v", owner, err)
+		return nil
+	}
+	now := s.clock.Now()
+	var secrets []string
+	for _, key := range slices.Backward(keys) {
+		if key.active(now) {
+			secrets = append(secrets, key.Secret)
+		}
+	}
+	return secrets
+}
+
+// newSigningKey saves a signing key for owner with a random secret
+func (s *server) newSigningKey(ctx context.Context, owner string) (*SigningKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	key := &SigningKey{Owner: owner, Secret: hex.EncodeToString(b), CreatedAt: s.clock.Now()}
+	if err := s.store.CreateSigningKey(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ownedSigningKey returns the signing key of the caller's owner with the ID in
+// the request path, writing the error response and returning nil when there
+// isn't one
+func (s *server) ownedSigningKey(w http.ResponseWriter, r *http.Request) *SigningKey {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid signing key ID", http.StatusBadRequest)
+		return nil
+	}
+	keys, err := s.store.ListSigningKeys(r.Context(), apiKeyFromContext(r.Context()).Owner)
+	if err != nil {
+		log.Printf("Failed to list signing keys: %v", err)
+		http.Error(w, "Failed to read signing key", http.StatusInternalServerError)
+		return nil
+	}
+	i := slices.IndexFunc(keys, func(key SigningKey) bool { return key.ID == id })
+	if i < 0 {
+		http.Error(w, "Signing key not found", http.StatusNotFound)
+		return nil
+	}
+	return &keys[i]
+}
+
+func (s *server) listSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.store.ListSigningKeys(r.Context(), apiKeyFromContext(r.Context()).Owner)
+	if err != nil {
+		log.Printf("Failed to list signing keys: %v", err)
+		http.Error(w, "Failed to list signing keys", http.StatusInternalServerError)
+		return
+	}
+	for i := range keys {
+		keys[i].Secret = ""
+	}
+	if keys == nil {
+		keys = []SigningKey{}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (s *server) createSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := s.newSigningKey(r.Context(), apiKeyFromContext(r.Context()).Owner)
+	if err != nil {
+		log.Printf("Failed to create signing key: %v", err)
+		http.Error(w, "Failed to create signing key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "signing_key.create", strconv.FormatInt(key.ID, 10))
+	// The secret is only returned when the key is created
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// rotateSigningKeyHandler replaces a signing key with a new one. The old key
+// keeps signing for the overlap parameter, 24h by default, so subscribers can
+// accept either while they switch.
+func (s *server) rotateSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	overlap := defaultSigningKeyOverlap
+	if v := r.URL.Query().Get("overlap"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil || d > maxSigningKeyOverlap {
+			http.Error(w, fmt.Sprintf("Invalid overlap parameter (want a duration up to %s)", maxSigningKeyOverlap), http.StatusBadRequest)
+			return
+		}
+		overlap = d
+	}
+	old := s.ownedSigningKey(w, r)
+	if old == nil {
+		return
+	}
+	now := s.clock.Now()
+	if !old.active(now) {
+		http.Error(w, "Signing key is no longer active", http.StatusConflict)
+		return
+	}
+
+	key, err := s.newSigningKey(r.Context(), old.Owner)
+	if err == nil {
+		// A key already expiring sooner keeps its earlier expiry
+		expires := now.Add(overlap)
+		if old.ExpiresAt != nil && old.ExpiresAt.Before(expires) {
+			expires = *old.ExpiresAt
+		}
+		err = s.store.ExpireSigningKey(r.Context(), old.ID, expires)
+	}
+	if err != nil {
+		log.Printf("Failed to rotate signing key %d: %v", old.ID, err)
+		http.Error(w, "Failed to rotate signing key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "signing_key.rotate", fmt.Sprintf("%d -> %d", old.ID, key.ID))
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// revokeSigningKeyHandler stops a signing key signing at once
+func (s *server) revokeSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := s.ownedSigningKey(w, r)
+	if key == nil {
+		return
+	}
+	err := s.store.RevokeSigningKey(r.Context(), key.ID, s.clock.Now())
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Signing key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke signing key: %v", err)
+		http.Error(w, "Failed to revoke signing key", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "signing_key.revoke", strconv.FormatInt(key.ID, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
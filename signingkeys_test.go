@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSigningKeyEndpoints tests creating, rotating, and revoking signing keys,
+// and that deliveries are signed with every active key during an overlap
+func TestSigningKeyEndpoints(t *testing.T) {
+	var mu sync.Mutex
+	var signature, timestamp string
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		signature, timestamp = r.Header.Get("X-Forecast-Signature"), r.Header.Get("X-Forecast-Timestamp")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer hook.Close()
+
+	srv, tokens := newAuthServer(t, Config{})
+	clock := newFakeClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv.clock = clock
+	handler := srv.routes()
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	ctx := context.Background()
+	sub := Subscription{Owner: "owner-subscribe", WebhookURL: hook.URL, Secret: "s3cret"}
+	if err := srv.store.CreateSubscription(ctx, &sub); err != nil {
+		t.Fatal(err)
+	}
+	// signatures delivers a notification and returns the secrets it was
+	// signed with, in order
+	signatures := func(secrets ...string) []string {
+		t.Helper()
+		if err := srv.deliver(ctx, sub, &Delivery{Event: "test.event", ContentType: "text/plain", Body: []byte("hello")}); err != nil {
+			t.Fatalf("expected delivery, got %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ts, _ := strconv.ParseInt(timestamp, 10, 64)
+		var signed []string
+		for _, sig := range strings.Split(signature, ",") {
+			for _, secret := range secrets {
+				if sig == signWebhook(secret, ts, body) {
+					signed = append(signed, secret)
+				}
+			}
+		}
+		return signed
+	}
+	key := func(w *httptest.ResponseRecorder) SigningKey {
+		t.Helper()
+		var key SigningKey
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+		}
+		json.NewDecoder(w.Body).Decode(&key)
+		if key.Secret == "" || key.Owner != "owner-subscribe" {
+			t.Fatalf("expected a new key with its secret, got %+v", key)
+		}
+		return key
+	}
+
+	if got := signatures("s3cret"); len(got) != 1 {
+		t.Errorf("expected the subscription secret without signing keys, got %q", got)
+	}
+	if w := do("POST", "/webhook-keys", tokens[scopeRead]); w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 for a read key, got %d", w.Code)
+	}
+	first := key(do("POST", "/webhook-keys", tokens[scopeSubscribe]))
+	if got := signatures("s3cret", first.Secret); len(got) != 1 || got[0] != first.Secret {
+		t.Errorf("expected the signing key in place of the subscription secret, got %q", got)
+	}
+
+	path := "/webhook-keys/" + strconv.FormatInt(first.ID, 10)
+	for _, tt := range []struct {
+		path     string
+		token    string
+		expected int
+	}{
+		{path: path + "/rotate?overlap=8d", token: tokens[scopeSubscribe], expected: http.StatusBadRequest},
+		{path: path + "/rotate?overlap=soon", token: tokens[scopeSubscribe], expected: http.StatusBadRequest},
+		{path: "/webhook-keys/999/rotate", token: tokens[scopeSubscribe], expected: http.StatusNotFound},
+		{path: path + "/rotate", token: tokens[scopeAdmin], expected: http.StatusNotFound},
+	} {
+		if w := do("POST", tt.path, tt.token); w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.expected, w.Code)
+		}
+	}
+
+	second := key(do("POST", path+"/rotate?overlap=2h", tokens[scopeSubscribe]))
+	if got := signatures(first.Secret, second.Secret); len(got) != 2 || got[0] != second.Secret {
+		t.Errorf("expected both keys, newest first, during the overlap, got %q", got)
+	}
+	clock.Advance(2 * time.Hour)
+	if got := signatures(first.Secret, second.Secret); len(got) != 1 || got[0] != second.Secret {
+		t.Errorf("expected only the new key after the overlap, got %q", got)
+	}
+	if w := do("POST", path+"/rotate", tokens[scopeSubscribe]); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 rotating an expired key, got %d", w.Code)
+	}
+
+	w := do("GET", "/webhook-keys", tokens[scopeSubscribe])
+	var keys []SigningKey
+	json.NewDecoder(w.Body).Decode(&keys)
+	if len(keys) != 2 || keys[0].Secret != "" || keys[0].ExpiresAt == nil || keys[1].ExpiresAt != nil {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+
+	secondPath := "/webhook-keys/" + strconv.FormatInt(second.ID, 10)
+	if w := do("DELETE", secondPath, tokens[scopeSubscribe]); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	if got := signatures("s3cret"); len(got) != 1 {
+		t.Errorf("expected the subscription secret once every key is revoked, got %q", got)
+	}
+}
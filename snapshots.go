@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Forecast products archived as snapshots
+const (
+	productForecast = "forecast"
+	productHourly   = "hourly"
+)
+
+// archiveForecast saves the periods served for a point as a new revision of
+// the product, unless they match the latest revision already archived.
+// Periods are archived as reported, before any gaps are filled.
+func (s *server) archiveForecast(ctx context.Context, lat, lon float64, product string, periods []weatherPeriod) {
+	out := make([]hourlyPeriod, 0, len(periods))
+	for _, p := range periods {
+		out = append(out, newHourlyPeriod(p))
+	}
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		log.Printf("Failed to archive forecast: %v", err)
+		return
+	}
+
+	latest, err := s.store.GetSnapshot(ctx, lat, lon, product, s.clock.Now())
+	if err == nil && bytes.Equal(latest.Periods, encoded) {
+		return
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to read latest forecast snapshot: %v", err)
+	}
+	snap := &ForecastSnapshot{Latitude: lat, Longitude: lon, Product: product, Periods: encoded}
+	if err := s.store.AddSnapshot(ctx, snap); err != nil {
+		log.Printf("Failed to archive forecast: %v", err)
+	}
+}
+
+// asofResponse is the body of /forecast/asof. RecordedAt is when the revision
+// in effect at Time was first served.
+type asofResponse struct {
+	Latitude   float64         `json:"latitude"`
+	Longitude  float64         `json:"longitude"`
+	Product    string          `json:"product"`
+	Time       time.Time       `json:"time"`
+	RecordedAt time.Time       `json:"recordedAt"`
+	Periods    json.RawMessage `json:"periods"`
+}
+
+// asofHandler serves the forecast for a point as it stood at ?time=, from the
+// revisions archived when forecasts were served. ?product=hourly selects the
+// hourly forecast instead of the twelve-hour one.
+func (s *server) asofHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	v := r.URL.Query().Get("time")
+	if v == "" {
+		http.Error(w, "Missing time parameter", http.StatusBadRequest)
+		return
+	}
+	at, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		http.Error(w, "Invalid time parameter (want an RFC 3339 time)", http.StatusBadRequest)
+		return
+	}
+	product := r.URL.Query().Get("product")
+	switch product {
+	case "":
+		product = productForecast
+	case productForecast, productHourly:
+	default:
+		http.Error(w, "Invalid product parameter (want forecast or hourly)", http.StatusBadRequest)
+		return
+	}
+
+	latitude, longitude := parsePoint(lat, lon)
+	snap, err := s.store.GetSnapshot(r.Context(), latitude, longitude, product, at)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "No forecast archived for that time", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read forecast snapshot: %v", err)
+		http.Error(w, "Failed to read forecast snapshot", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, asofResponse{
+		Latitude:   latitude,
+		Longitude:  longitude,
+		Product:    product,
+		Time:       at,
+		RecordedAt: snap.RecordedAt,
+		Periods:    snap.Periods,
+	})
+}
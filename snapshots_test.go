@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestArchiveForecast tests that served forecasts are archived once per revision
+func TestArchiveForecast(t *testing.T) {
+	forecast := `{"properties": {"periods": [{"startTime": "2024-06-01T06:00:00-07:00", "shortForecast": "Sunny", "temperature": 72, "temperatureUnit": "F"}]}}`
+	mockNWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/forecast-url" {
+			w.Write([]byte(forecast))
+			return
+		}
+		w.Write([]byte(`{"properties": {"forecast": "http://` + r.Host + `/forecast-url"}}`))
+	}))
+	defer mockNWS.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+	serve := func() {
+		w := httptest.NewRecorder()
+		srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+	}
+
+	serve()
+	first, err := srv.store.GetSnapshot(context.Background(), 47.6062, -122.3321, productForecast, time.Now())
+	if err != nil {
+		t.Fatalf("expected a snapshot, got %v", err)
+	}
+	var periods []hourlyPeriod
+	if err := json.Unmarshal(first.Periods, &periods); err != nil {
+		t.Fatal(err)
+	}
+	if len(periods) != 1 || periods[0].Forecast != "Sunny" {
+		t.Errorf("unexpected periods %s", first.Periods)
+	}
+
+	// An unchanged forecast isn't archived again
+	serve()
+	if latest, _ := srv.store.GetSnapshot(context.Background(), 47.6062, -122.3321, productForecast, time.Now()); latest.ID != first.ID {
+		t.Errorf("expected snapshot %d to remain the latest, got %d", first.ID, latest.ID)
+	}
+
+	forecast = `{"properties": {"periods": [{"startTime": "2024-06-01T06:00:00-07:00", "shortForecast": "Rain", "temperature": 60, "temperatureUnit": "F"}]}}`
+	serve()
+	if latest, _ := srv.store.GetSnapshot(context.Background(), 47.6062, -122.3321, productForecast, time.Now()); latest.ID == first.ID {
+		t.Error("expected the revised forecast to be archived")
+	}
+}
+
+// TestAsofHandler tests retrieving the forecast as it stood at a past time
+func TestAsofHandler(t *testing.T) {
+	srv := newServer(defaultConfig())
+	srv.store = newTestStore(t)
+	tuesday := time.Date(2024, 6, 4, 6, 0, 0, 0, time.UTC)
+	for i, periods := range []string{`[{"forecast": "Sunny"}]`, `[{"forecast": "Thunderstorms"}]`} {
+		snap := &ForecastSnapshot{Latitude: 47.6062, Longitude: -122.3321, Product: productForecast, Periods: json.RawMessage(periods), RecordedAt: tuesday.Add(time.Duration(i) * 6 * time.Hour)}
+		if err := srv.store.AddSnapshot(context.Background(), snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedFirst  string
+	}{
+		{name: "morning", query: "time=2024-06-04T09:00:00Z", expectedStatus: http.StatusOK, expectedFirst: "Sunny"},
+		{name: "offset", query: "time=2024-06-04T07:30:00-07:00", expectedStatus: http.StatusOK, expectedFirst: "Thunderstorms"},
+		{name: "before archive", query: "time=2024-06-03T00:00:00Z", expectedStatus: http.StatusNotFound},
+		{name: "other product", query: "time=2024-06-04T09:00:00Z&product=hourly", expectedStatus: http.StatusNotFound},
+		{name: "missing time", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "invalid time", query: "time=tuesday", expectedStatus: http.StatusBadRequest},
+		{name: "invalid product", query: "time=2024-06-04T09:00:00Z&product=daily", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.asofHandler(w, httptest.NewRequest("GET", "/forecast/asof?latitude=47.6062&longitude=-122.3321&"+tt.query, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Periods []hourlyPeriod `json:"periods"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Periods) != 1 || resp.Periods[0].Forecast != tt.expectedFirst {
+				t.Errorf("expected %s, got %+v", tt.expectedFirst, resp.Periods)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// solarHorizonHours is how far ahead /solar forecasts
+	solarHorizonHours = 48
+	// performanceRatio accounts for inverter, wiring, and soiling losses of a
+	// typical residential system
+	performanceRatio = 0.85
+	// panelTemperatureCoefficient is the fractional loss of output per °C the
+	// cells run above 25°C, typical of crystalline silicon
+	panelTemperatureCoefficient = 0.004
+	// cellHeatingCoefficient estimates how far sunlight heats cells above the
+	// air, in °C per W/m²
+	cellHeatingCoefficient = 0.03
+)
+
+// solarElevation returns the elevation of the sun above the horizon in
+// degrees at t, using the NOAA approximations of the equation of time and
+// declination
+func solarElevation(t time.Time, latitude, longitude float64) float64 {
+	t = t.UTC()
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	gamma := 2 * math.Pi / 365 * (float64(t.YearDay()-1) + (hour-12)/24)
+	eqTime := 229.18 * (0.000075 + 0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2*gamma) - 0.040849*math.Sin(2*gamma))
+	declination := 0.006918 - 0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2*gamma) + 0.000907*math.Sin(2*gamma) -
+		0.002697*math.Cos(3*gamma) + 0.00148*math.Sin(3*gamma)
+
+	solarMinutes := hour*60 + eqTime + 4*longitude
+	hourAngle := (solarMinutes/4 - 180) * math.Pi / 180
+	phi := latitude * math.Pi / 180
+	cosZenith := math.Sin(phi)*math.Sin(declination) + math.Cos(phi)*math.Cos(declination)*math.Cos(hourAngle)
+	return 90 - math.Acos(max(-1, min(1, cosZenith)))*180/math.Pi
+}
+
+// clearSkyIrradiance returns the global horizontal irradiance under a clear
+// sky in W/m² for a solar elevation in degrees, by the Haurwitz model
+func clearSkyIrradiance(elevation float64) float64 {
+	if elevation <= 0 {
+		return 0
+	}
+	cosZenith := math.Sin(elevation * math.Pi / 180)
+	return 1098 * cosZenith * math.Exp(-0.057/cosZenith)
+}
+
+// cloudyIrradiance reduces clear sky irradiance for sky cover in percent, by
+// the Kasten-Czeplak relation
+func cloudyIrradiance(clear, skyCover float64) float64 {
+	return clear * (1 - 0.75*math.Pow(skyCover/100, 3.4))
+}
+
+// solarHour is one hour of the /solar response
+type solarHour struct {
+	StartTime     time.Time `json:"startTime"`
+	SunElevation  float64   `json:"sunElevation"`
+	SkyCover      float64   `json:"skyCover"`
+	IrradianceWM2 float64   `json:"irradianceWm2"`
+	OutputKW      float64   `json:"outputKw"`
+}
+
+// solarResponse is the body of /solar
+type solarResponse struct {
+	Latitude  float64     `json:"latitude"`
+	Longitude float64     `json:"longitude"`
+	KW        float64     `json:"kw"`
+	EnergyKWh float64     `json:"energyKwh"`
+	Hours     []solarHour `json:"hours"`
+}
+
+// solarForecast estimates the average output of kw of panels for each hour
+// from start for which the grid forecasts sky cover, up to hours hours. The
+// sun is placed at the middle of each hour and panels are treated as lying
+// flat, so tilted arrays facing the sun will do somewhat better.
+func solarForecast(g gridData, latitude, longitude, kw float64, start time.Time, hours int) []solarHour {
+	var out []solarHour
+	for h := range hours {
+		t := start.Add(time.Duration(h) * time.Hour)
+		sky, ok := g.SkyCover.at(t)
+		if !ok {
+			continue
+		}
+		elevation := solarElevation(t.Add(30*time.Minute), latitude, longitude)
+		irradiance := cloudyIrradiance(clearSkyIrradiance(elevation), sky)
+
+		output := kw * irradiance / 1000 * performanceRatio
+		if air, ok := g.Temperature.at(t); ok {
+			cell := air + cellHeatingCoefficient*irradiance
+			output *= 1 - panelTemperatureCoefficient*max(0, cell-25)
+		}
+		out = append(out, solarHour{
+			StartTime:     t.In(g.Location),
+			SunElevation:  roundTenth(elevation),
+			SkyCover:      sky,
+			IrradianceWM2: math.Round(irradiance),
+			OutputKW:      math.Round(output*100) / 100,
+		})
+	}
+	return out
+}
+
+// solarHandler serves the estimated hourly output of ?kw= kilowatts of solar
+// panels over the next two days
+func (s *server) solarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	kw := 1.0
+	if v := r.URL.Query().Get("kw"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || n > 10000 {
+			http.Error(w, "Invalid kw parameter (want a system size above 0 and at most 10000)", http.StatusBadRequest)
+			return
+		}
+		kw = n
+	}
+
+	data, statusCode, err := s.fetchGridData(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := solarResponse{KW: kw}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	start := data.SkyCover.forecastStart(s.clock.Now())
+	resp.Hours = solarForecast(data, resp.Latitude, resp.Longitude, kw, start, solarHorizonHours)
+	for _, h := range resp.Hours {
+		resp.EnergyKWh += h.OutputKW
+	}
+	resp.EnergyKWh = roundTenth(resp.EnergyKWh)
+	if resp.Hours == nil {
+		resp.Hours = []solarHour{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
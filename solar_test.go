@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestSolarElevation tests the sun's elevation against known positions
+func TestSolarElevation(t *testing.T) {
+	// The highest the sun gets over Denver on the June solstice is
+	// 90° - 39.74° + 23.44°
+	day := time.Date(2024, 6, 20, 12, 0, 0, 0, time.UTC)
+	highest := -90.0
+	for m := 0; m < 24*60; m += 5 {
+		highest = max(highest, solarElevation(day.Add(time.Duration(m)*time.Minute), 39.74, -104.99))
+	}
+	if math.Abs(highest-73.7) > 0.3 {
+		t.Errorf("expected a 73.7° high, got %.2f°", highest)
+	}
+
+	// Solar noon at Greenwich on the March equinox is a few minutes after noon
+	// UTC, with the sun over the equator
+	if e := solarElevation(time.Date(2024, 3, 20, 12, 7, 0, 0, time.UTC), 0, 0); math.Abs(e-90) > 0.5 {
+		t.Errorf("expected the sun overhead, got %.2f°", e)
+	}
+	// Midnight is dark
+	if e := solarElevation(time.Date(2024, 6, 21, 6, 0, 0, 0, time.UTC), 39.74, -104.99); e >= 0 {
+		t.Errorf("expected the sun below the horizon, got %.2f°", e)
+	}
+}
+
+// TestIrradiance tests clear sky irradiance and its reduction by cloud
+func TestIrradiance(t *testing.T) {
+	if got := clearSkyIrradiance(90); math.Abs(got-1037.2) > 0.1 {
+		t.Errorf("expected 1037.2 W/m² overhead, got %.1f", got)
+	}
+	if got := clearSkyIrradiance(-5); got != 0 {
+		t.Errorf("expected nothing at night, got %.1f", got)
+	}
+	if low, high := clearSkyIrradiance(20), clearSkyIrradiance(60); low >= high {
+		t.Errorf("expected a low sun (%.1f) to give less than a high one (%.1f)", low, high)
+	}
+	if got := cloudyIrradiance(1000, 0); got != 1000 {
+		t.Errorf("expected clear skies unchanged, got %.1f", got)
+	}
+	if got := cloudyIrradiance(1000, 100); got != 250 {
+		t.Errorf("expected overcast skies to pass a quarter, got %.1f", got)
+	}
+}
+
+// TestSolarForecast tests hourly output estimates
+func TestSolarForecast(t *testing.T) {
+	zone := time.FixedZone("MDT", -6*60*60)
+	start := time.Date(2024, 6, 20, 0, 0, 0, 0, zone)
+	g := gridData{
+		Location: zone,
+		SkyCover: gridSeries{
+			{Start: start, Duration: 24 * time.Hour, Value: 0},
+			{Start: start.Add(24 * time.Hour), Duration: 12 * time.Hour, Value: 100},
+		},
+		Temperature: gridSeries{{Start: start, Duration: 36 * time.Hour, Value: 20}},
+	}
+
+	hours := solarForecast(g, 39.74, -104.99, 5, start, 48)
+	if len(hours) != 36 {
+		t.Fatalf("expected an hour for each hour of sky cover, got %d", len(hours))
+	}
+	midnight, noon, cloudyNoon := hours[0], hours[12], hours[36-12]
+	if midnight.OutputKW != 0 || midnight.IrradianceWM2 != 0 {
+		t.Errorf("expected no output at midnight, got %+v", midnight)
+	}
+	// 5 kW of flat panels in clear June sun, less system and heat losses
+	if noon.OutputKW < 3.5 || noon.OutputKW > 4.2 {
+		t.Errorf("expected about 3.8 kW at noon, got %+v", noon)
+	}
+	if cloudyNoon.OutputKW > noon.OutputKW/3 {
+		t.Errorf("expected overcast to cut output, got %v kW against %v kW", cloudyNoon.OutputKW, noon.OutputKW)
+	}
+	if !noon.StartTime.Equal(start.Add(12*time.Hour)) || noon.StartTime.Location() != zone {
+		t.Errorf("unexpected start time %v", noon.StartTime)
+	}
+
+	// Output scales with system size
+	double := solarForecast(g, 39.74, -104.99, 10, start, 48)
+	if math.Abs(double[12].OutputKW-2*noon.OutputKW) > 0.02 {
+		t.Errorf("expected double the output, got %v and %v", double[12].OutputKW, noon.OutputKW)
+	}
+}
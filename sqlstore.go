@@ -0,0 +1,938 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dialect captures the differences between the SQL databases we support.
+// Queries are written with ? placeholders and rebound per dialect.
+type dialect struct {
+	name   string
+	driver string
+	// numbered placeholders ($1, $2, ...) instead of ?
+	numbered bool
+}
+
+var (
+	sqliteDialect   = dialect{name: "sqlite", driver: "sqlite"}
+	postgresDialect = dialect{name: "postgres", driver: "pgx", numbered: true}
+)
+
+// rebind rewrites ? placeholders for the dialect
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlStore is a Store backed by SQLite or Postgres. Times are stored as Unix
+// seconds; subscription secrets and API keys are sealed by cipher when set.
+// A store returned by inTx runs its queries in the transaction tx.
+type sqlStore struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+	cipher  *secretCipher
+}
+
+// sqlConn runs queries, on the database or in a transaction
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the store's transaction, if it has one, or its database
+func (s *sqlStore) conn() sqlConn {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.conn().ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.conn().QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.conn().QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *sqlStore) insert(ctx context.Context, query string, args ...any) (int64, error) {
+	var id int64
+	err := s.queryRow(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// inTx runs fn with a copy of the store whose queries run in one transaction,
+// committed if fn succeeds and rolled back otherwise. In a store that already
+// has a transaction, fn joins it.
+func (s *sqlStore) inTx(ctx context.Context, fn func(tx *sqlStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	scoped := *s
+	scoped.tx = tx
+	if err := fn(&scoped); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Atomically(ctx context.Context, fn func(Store) error) error {
+	return s.inTx(ctx, func(tx *sqlStore) error { return fn(tx) })
+}
+
+func (s *sqlStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+	sub.CreatedAt = sub.CreatedAt.UTC().Truncate(time.Second)
+	secret, err := s.cipher.seal(sub.Secret)
+	if err != nil {
+		return err
+	}
+	escalation := ""
+	if len(sub.Escalation) > 0 {
+		b, err := json.Marshal(sub.Escalation)
+		if err != nil {
+			return fmt.Errorf("failed to encode escalation: %v", err)
+		}
+		escalation = string(b)
+	}
+	id, err := s.insert(ctx,
+		`INSERT INTO subscriptions (owner, latitude, longitude, webhook_url, secret, quiet_start, quiet_end, time_zone, max_per_day, escalation, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sub.Owner, sub.Latitude, sub.Longitude, sub.WebhookURL, secret, sub.QuietStart, sub.QuietEnd, sub.TimeZone, sub.MaxPerDay, escalation, sub.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %v", err)
+	}
+	sub.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListSubscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	query := `SELECT id, owner, latitude, longitude, webhook_url, secret, quiet_start, quiet_end, time_zone, max_per_day, escalation, created_at FROM subscriptions`
+	var args []any
+	if owner != "" {
+		query += ` WHERE owner = ?`
+		args = append(args, owner)
+	}
+	rows, err := s.query(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		var escalation string
+		var created int64
+		if err := rows.Scan(&sub.ID, &sub.Owner, &sub.Latitude, &sub.Longitude, &sub.WebhookURL, &sub.Secret,
+			&sub.QuietStart, &sub.QuietEnd, &sub.TimeZone, &sub.MaxPerDay, &escalation, &created); err != nil {
+			return nil, fmt.Errorf("failed to read subscription: %v", err)
+		}
+		if escalation != "" {
+			if err := json.Unmarshal([]byte(escalation), &sub.Escalation); err != nil {
+				return nil, fmt.Errorf("subscription %d: invalid escalation: %v", sub.ID, err)
+			}
+		}
+		if sub.Secret, err = s.cipher.open(sub.Secret); err != nil {
+			return nil, fmt.Errorf("subscription %d: %v", sub.ID, err)
+		}
+		sub.CreatedAt = time.Unix(created, 0).UTC()
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *sqlStore) DeleteSubscription(ctx context.Context, id int64) error {
+	res, err := s.exec(ctx, `DELETE FROM subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) CreateLocation(ctx context.Context, loc *Location) error {
+	if loc.CreatedAt.IsZero() {
+		loc.CreatedAt = time.Now()
+	}
+	loc.CreatedAt = loc.CreatedAt.UTC().Truncate(time.Second)
+	id, err := s.insert(ctx,
+		`INSERT INTO locations (owner, name, latitude, longitude, created_at) VALUES (?, ?, ?, ?, ?)`,
+		loc.Owner, loc.Name, loc.Latitude, loc.Longitude, loc.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create location: %v", err)
+	}
+	loc.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListLocations(ctx context.Context, owner string) ([]Location, error) {
+	query := `SELECT id, owner, name, latitude, longitude, created_at FROM locations`
+	var args []any
+	if owner != "" {
+		query += ` WHERE owner = ?`
+		args = append(args, owner)
+	}
+	rows, err := s.query(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %v", err)
+	}
+	defer rows.Close()
+
+	var locs []Location
+	for rows.Next() {
+		var loc Location
+		var created int64
+		if err := rows.Scan(&loc.ID, &loc.Owner, &loc.Name, &loc.Latitude, &loc.Longitude, &created); err != nil {
+			return nil, fmt.Errorf("failed to read location: %v", err)
+		}
+		loc.CreatedAt = time.Unix(created, 0).UTC()
+		locs = append(locs, loc)
+	}
+	return locs, rows.Err()
+}
+
+func (s *sqlStore) DeleteLocation(ctx context.Context, id int64) error {
+	res, err := s.exec(ctx, `DELETE FROM locations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete location: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	key.CreatedAt = key.CreatedAt.UTC().Truncate(time.Second)
+	if len(key.Roles) == 0 {
+		key.Roles = []string{scopeRead}
+	}
+	sealed, err := s.cipher.seal(key.Key)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx,
+		`INSERT INTO api_keys (id, owner, name, key, roles, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Owner, key.Name, sealed, strings.Join(key.Roles, ","), key.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %v", err)
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, owner, name, key, roles, created_at`
+
+func (s *sqlStore) scanAPIKey(rows interface{ Scan(...any) error }) (*APIKey, error) {
+	var key APIKey
+	var roles string
+	var created int64
+	if err := rows.Scan(&key.ID, &key.Owner, &key.Name, &key.Key, &roles, &created); err != nil {
+		return nil, err
+	}
+	var err error
+	if key.Key, err = s.cipher.open(key.Key); err != nil {
+		return nil, fmt.Errorf("API key %s: %v", key.ID, err)
+	}
+	key.Roles = strings.Split(roles, ",")
+	key.CreatedAt = time.Unix(created, 0).UTC()
+	return &key, nil
+}
+
+func (s *sqlStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	row := s.queryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+	key, err := s.scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key: %v", err)
+	}
+	return key, nil
+}
+
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := s.scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API key: %v", err)
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) DeleteAPIKey(ctx context.Context, id string) error {
+	res, err := s.exec(ctx, `DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) AddHistory(ctx context.Context, rec *HistoryRecord) error {
+	if rec.RecordedAt.IsZero() {
+		rec.RecordedAt = time.Now()
+	}
+	rec.RecordedAt = rec.RecordedAt.UTC().Truncate(time.Second)
+	id, err := s.insert(ctx,
+		`INSERT INTO history (latitude, longitude, forecast, temperature, recorded_at) VALUES (?, ?, ?, ?, ?)`,
+		rec.Latitude, rec.Longitude, rec.Forecast, rec.Temperature, rec.RecordedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add history: %v", err)
+	}
+	rec.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListHistory(ctx context.Context, lat, lon float64, since time.Time) ([]HistoryRecord, error) {
+	rows, err := s.query(ctx,
+		`SELECT id, latitude, longitude, forecast, temperature, recorded_at FROM history
+		 WHERE latitude = ? AND longitude = ? AND recorded_at >= ? ORDER BY recorded_at, id`,
+		lat, lon, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history: %v", err)
+	}
+	defer rows.Close()
+
+	var recs []HistoryRecord
+	for rows.Next() {
+		var rec HistoryRecord
+		var recorded int64
+		if err := rows.Scan(&rec.ID, &rec.Latitude, &rec.Longitude, &rec.Forecast, &rec.Temperature, &recorded); err != nil {
+			return nil, fmt.Errorf("failed to read history: %v", err)
+		}
+		rec.RecordedAt = time.Unix(recorded, 0).UTC()
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+func (s *sqlStore) AddSnapshot(ctx context.Context, snap *ForecastSnapshot) error {
+	if snap.RecordedAt.IsZero() {
+		snap.RecordedAt = time.Now()
+	}
+	snap.RecordedAt = snap.RecordedAt.UTC().Truncate(time.Second)
+	id, err := s.insert(ctx,
+		`INSERT INTO forecast_snapshots (latitude, longitude, product, periods, recorded_at) VALUES (?, ?, ?, ?, ?)`,
+		snap.Latitude, snap.Longitude, snap.Product, string(snap.Periods), snap.RecordedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add forecast snapshot: %v", err)
+	}
+	snap.ID = id
+	return nil
+}
+
+func (s *sqlStore) GetSnapshot(ctx context.Context, lat, lon float64, product string, at time.Time) (*ForecastSnapshot, error) {
+	var snap ForecastSnapshot
+	var periods string
+	var recorded int64
+	err := s.queryRow(ctx,
+		`SELECT id, latitude, longitude, product, periods, recorded_at FROM forecast_snapshots
+		 WHERE latitude = ? AND longitude = ? AND product = ? AND recorded_at <= ?
+		 ORDER BY recorded_at DESC, id DESC LIMIT 1`,
+		lat, lon, product, at.Unix()).Scan(&snap.ID, &snap.Latitude, &snap.Longitude, &snap.Product, &periods, &recorded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read forecast snapshot: %v", err)
+	}
+	snap.Periods = json.RawMessage(periods)
+	snap.RecordedAt = time.Unix(recorded, 0).UTC()
+	return &snap, nil
+}
+
+func (s *sqlStore) ListSnapshots(ctx context.Context, from, to time.Time) ([]ForecastSnapshot, error) {
+	rows, err := s.query(ctx,
+		`SELECT id, latitude, longitude, product, periods, recorded_at FROM forecast_snapshots
+		 WHERE recorded_at >= ? AND recorded_at < ? ORDER BY recorded_at, id`,
+		from.Unix(), to.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forecast snapshots: %v", err)
+	}
+	return scanSnapshots(rows)
+}
+
+func (s *sqlStore) RecentSnapshots(ctx context.Context, lat, lon float64, product string, limit int) ([]ForecastSnapshot, error) {
+	rows, err := s.query(ctx,
+		`SELECT id, latitude, longitude, product, periods, recorded_at FROM forecast_snapshots
+		 WHERE latitude = ? AND longitude = ? AND product = ?
+		 ORDER BY recorded_at DESC, id DESC LIMIT ?`,
+		lat, lon, product, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forecast snapshots: %v", err)
+	}
+	return scanSnapshots(rows)
+}
+
+// scanSnapshots reads and closes rows of forecast snapshots
+func scanSnapshots(rows *sql.Rows) ([]ForecastSnapshot, error) {
+	defer rows.Close()
+
+	var snaps []ForecastSnapshot
+	for rows.Next() {
+		var snap ForecastSnapshot
+		var periods string
+		var recorded int64
+		if err := rows.Scan(&snap.ID, &snap.Latitude, &snap.Longitude, &snap.Product, &periods, &recorded); err != nil {
+			return nil, fmt.Errorf("failed to read forecast snapshot: %v", err)
+		}
+		snap.Periods = json.RawMessage(periods)
+		snap.RecordedAt = time.Unix(recorded, 0).UTC()
+		snaps = append(snaps, snap)
+	}
+	return snaps, rows.Err()
+}
+
+func (s *sqlStore) SaveAlert(ctx context.Context, alert *Alert) error {
+	alert.Sent = alert.Sent.UTC().Truncate(time.Second)
+	alert.Onset = alert.Onset.UTC().Truncate(time.Second)
+	alert.Ends = alert.Ends.UTC().Truncate(time.Second)
+	err := s.inTx(ctx, func(tx *sqlStore) error {
+		exec := func(query string, args ...any) error {
+			_, err := tx.exec(ctx, query, args...)
+			return err
+		}
+		err := exec(`INSERT INTO alerts (id, event, severity, headline, area_desc, sent, onset, ends) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (id) DO UPDATE SET event = excluded.event, severity = excluded.severity, headline = excluded.headline,
+			 area_desc = excluded.area_desc, sent = excluded.sent, onset = excluded.onset, ends = excluded.ends`,
+			alert.ID, alert.Event, alert.Severity, alert.Headline, alert.AreaDesc, alert.Sent.Unix(), alert.Onset.Unix(), alert.Ends.Unix())
+		if err == nil {
+			err = exec(`DELETE FROM alert_zones WHERE alert_id = ?`, alert.ID)
+		}
+		for _, zone := range alert.Zones {
+			if err != nil {
+				break
+			}
+			err = exec(`INSERT INTO alert_zones (alert_id, zone) VALUES (?, ?) ON CONFLICT DO NOTHING`, alert.ID, zone)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save alert: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetAlert(ctx context.Context, id string) (*Alert, error) {
+	alert := Alert{ID: id}
+	var sent, onset, ends int64
+	err := s.queryRow(ctx,
+		`SELECT event, severity, headline, area_desc, sent, onset, ends FROM alerts WHERE id = ?`,
+		id).Scan(&alert.Event, &alert.Severity, &alert.Headline, &alert.AreaDesc, &sent, &onset, &ends)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert: %v", err)
+	}
+	alert.Sent = time.Unix(sent, 0).UTC()
+	alert.Onset = time.Unix(onset, 0).UTC()
+	alert.Ends = time.Unix(ends, 0).UTC()
+	if alert.Zones, err = s.alertZones(ctx, id); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (s *sqlStore) ListAlerts(ctx context.Context, q AlertQuery) ([]Alert, error) {
+	rows, err := s.query(ctx,
+		`SELECT a.id, a.event, a.severity, a.headline, a.area_desc, a.sent, a.onset, a.ends
+		 FROM alerts a JOIN alert_zones z ON z.alert_id = a.id
+		 WHERE z.zone = ? AND a.ends >= ? AND (a.sent > ? OR (a.sent = ? AND a.id > ?))
+		 ORDER BY a.sent, a.id LIMIT ?`,
+		q.Zone, q.Since.Unix(), q.AfterSent.Unix(), q.AfterSent.Unix(), q.AfterID, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %v", err)
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		var alert Alert
+		var sent, onset, ends int64
+		if err := rows.Scan(&alert.ID, &alert.Event, &alert.Severity, &alert.Headline, &alert.AreaDesc, &sent, &onset, &ends); err != nil {
+			return nil, fmt.Errorf("failed to read alert: %v", err)
+		}
+		alert.Sent = time.Unix(sent, 0).UTC()
+		alert.Onset = time.Unix(onset, 0).UTC()
+		alert.Ends = time.Unix(ends, 0).UTC()
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range alerts {
+		if alerts[i].Zones, err = s.alertZones(ctx, alerts[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return alerts, nil
+}
+
+// alertZones returns the zones of an alert in order
+func (s *sqlStore) alertZones(ctx context.Context, id string) ([]string, error) {
+	rows, err := s.query(ctx, `SELECT zone FROM alert_zones WHERE alert_id = ? ORDER BY zone`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert zones: %v", err)
+	}
+	defer rows.Close()
+
+	zones := []string{}
+	for rows.Next() {
+		var zone string
+		if err := rows.Scan(&zone); err != nil {
+			return nil, fmt.Errorf("failed to read alert zone: %v", err)
+		}
+		zones = append(zones, zone)
+	}
+	return zones, rows.Err()
+}
+
+// usageDay truncates t to the start of its UTC day
+func usageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func (s *sqlStore) AddDelivery(ctx context.Context, d *Delivery) error {
+	if d.SentAt.IsZero() {
+		d.SentAt = time.Now()
+	}
+	d.SentAt = d.SentAt.UTC().Truncate(time.Second)
+	replayOf := sql.NullInt64{Int64: d.ReplayOf, Valid: d.ReplayOf != 0}
+	id, err := s.insert(ctx,
+		`INSERT INTO deliveries (subscription_id, event, content_type, body, delivered, error, replay_of, held, sent_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.SubscriptionID, d.Event, d.ContentType, d.Body, d.Delivered, d.Error, replayOf, d.Held, d.SentAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add delivery: %v", err)
+	}
+	d.ID = id
+	return nil
+}
+
+func (s *sqlStore) GetDelivery(ctx context.Context, id int64) (*Delivery, error) {
+	d := Delivery{ID: id}
+	var replayOf, digestID sql.NullInt64
+	var sent int64
+	err := s.queryRow(ctx,
+		`SELECT subscription_id, event, content_type, body, delivered, error, replay_of, held, digest_id, sent_at FROM deliveries WHERE id = ?`,
+		id).Scan(&d.SubscriptionID, &d.Event, &d.ContentType, &d.Body, &d.Delivered, &d.Error, &replayOf, &d.Held, &digestID, &sent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery: %v", err)
+	}
+	d.ReplayOf, d.DigestID = replayOf.Int64, digestID.Int64
+	d.SentAt = time.Unix(sent, 0).UTC()
+	return &d, nil
+}
+
+func (s *sqlStore) ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]Delivery, error) {
+	return s.listDeliveries(ctx, false,
+		`SELECT id, subscription_id, event, content_type, delivered, error, replay_of, held, digest_id, sent_at FROM deliveries
+		 WHERE subscription_id = ? ORDER BY sent_at DESC, id DESC LIMIT ?`,
+		subscriptionID, limit)
+}
+
+func (s *sqlStore) CountDeliveries(ctx context.Context, subscriptionID int64, since time.Time) (int, error) {
+	var n int
+	err := s.queryRow(ctx,
+		`SELECT COUNT(*) FROM deliveries WHERE subscription_id = ? AND held = ? AND digest_id IS NULL AND replay_of IS NULL AND sent_at >= ?`,
+		subscriptionID, false, since.Unix()).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deliveries: %v", err)
+	}
+	return n, nil
+}
+
+func (s *sqlStore) ListHeldDeliveries(ctx context.Context) ([]Delivery, error) {
+	return s.listDeliveries(ctx, true,
+		`SELECT id, subscription_id, event, content_type, delivered, error, replay_of, held, digest_id, sent_at, body FROM deliveries
+		 WHERE held = ? ORDER BY subscription_id, sent_at, id`,
+		true)
+}
+
+// listDeliveries runs a query for deliveries, which selects their bodies last
+// when withBody is set
+func (s *sqlStore) listDeliveries(ctx context.Context, withBody bool, query string, args ...any) ([]Delivery, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		var replayOf, digestID sql.NullInt64
+		var sent int64
+		dest := []any{&d.ID, &d.SubscriptionID, &d.Event, &d.ContentType, &d.Delivered, &d.Error, &replayOf, &d.Held, &digestID, &sent}
+		if withBody {
+			dest = append(dest, &d.Body)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read delivery: %v", err)
+		}
+		d.ReplayOf, d.DigestID = replayOf.Int64, digestID.Int64
+		d.SentAt = time.Unix(sent, 0).UTC()
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlStore) ReleaseDeliveries(ctx context.Context, subscriptionID, throughID, digestID int64) error {
+	_, err := s.exec(ctx,
+		`UPDATE deliveries SET held = ?, digest_id = ? WHERE subscription_id = ? AND held = ? AND id <= ?`,
+		false, digestID, subscriptionID, true, throughID)
+	if err != nil {
+		return fmt.Errorf("failed to release deliveries: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) CreateShareLink(ctx context.Context, link *ShareLink) error {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+	link.CreatedAt = link.CreatedAt.UTC().Truncate(time.Second)
+	link.ExpiresAt = link.ExpiresAt.UTC().Truncate(time.Second)
+	_, err := s.exec(ctx,
+		`INSERT INTO share_links (token, owner, latitude, longitude, start_time, end_time, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.Token, link.Owner, link.Latitude, link.Longitude, nullUnix(link.Start), nullUnix(link.End),
+		link.CreatedAt.Unix(), link.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetShareLink(ctx context.Context, token string) (*ShareLink, error) {
+	link := ShareLink{Token: token}
+	var start, end sql.NullInt64
+	var created, expires int64
+	err := s.queryRow(ctx,
+		`SELECT owner, latitude, longitude, start_time, end_time, created_at, expires_at FROM share_links WHERE token = ?`,
+		token).Scan(&link.Owner, &link.Latitude, &link.Longitude, &start, &end, &created, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read share link: %v", err)
+	}
+	link.Start, link.End = unixTime(start), unixTime(end)
+	link.CreatedAt = time.Unix(created, 0).UTC()
+	link.ExpiresAt = time.Unix(expires, 0).UTC()
+	return &link, nil
+}
+
+func (s *sqlStore) CreateSigningKey(ctx context.Context, key *SigningKey) error {
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	key.CreatedAt = key.CreatedAt.UTC().Truncate(time.Second)
+	secret, err := s.cipher.seal(key.Secret)
+	if err != nil {
+		return err
+	}
+	id, err := s.insert(ctx,
+		`INSERT INTO signing_keys (owner, secret, created_at, expires_at, revoked_at) VALUES (?, ?, ?, ?, ?)`,
+		key.Owner, secret, key.CreatedAt.Unix(), nullUnix(key.ExpiresAt), nullUnix(key.RevokedAt))
+	if err != nil {
+		return fmt.Errorf("failed to create signing key: %v", err)
+	}
+	key.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListSigningKeys(ctx context.Context, owner string) ([]SigningKey, error) {
+	query := `SELECT id, owner, secret, created_at, expires_at, revoked_at FROM signing_keys`
+	var args []any
+	if owner != "" {
+		query += ` WHERE owner = ?`
+		args = append(args, owner)
+	}
+	rows, err := s.query(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		var created int64
+		var expires, revoked sql.NullInt64
+		if err := rows.Scan(&key.ID, &key.Owner, &key.Secret, &created, &expires, &revoked); err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %v", err)
+		}
+		if key.Secret, err = s.cipher.open(key.Secret); err != nil {
+			return nil, fmt.Errorf("signing key %d: %v", key.ID, err)
+		}
+		key.CreatedAt = time.Unix(created, 0).UTC()
+		key.ExpiresAt, key.RevokedAt = unixTime(expires), unixTime(revoked)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) ExpireSigningKey(ctx context.Context, id int64, at time.Time) error {
+	return s.updateSigningKey(ctx, `UPDATE signing_keys SET expires_at = ? WHERE id = ?`, at.Unix(), id)
+}
+
+func (s *sqlStore) RevokeSigningKey(ctx context.Context, id int64, at time.Time) error {
+	return s.updateSigningKey(ctx, `UPDATE signing_keys SET revoked_at = ? WHERE id = ?`, at.Unix(), id)
+}
+
+func (s *sqlStore) updateSigningKey(ctx context.Context, query string, args ...any) error {
+	res, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update signing key: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// nullUnix stores an optional time as unix seconds, or NULL
+func nullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+// unixTime reads an optional time stored by nullUnix
+func unixTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(v.Int64, 0).UTC()
+	return &t
+}
+
+func (s *sqlStore) RecordUsage(ctx context.Context, apiKey string, at time.Time) error {
+	_, err := s.exec(ctx,
+		`INSERT INTO usage (api_key, day, requests) VALUES (?, ?, 1)
+		 ON CONFLICT (api_key, day) DO UPDATE SET requests = usage.requests + 1`,
+		apiKey, usageDay(at).Unix())
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) ListUsage(ctx context.Context, apiKey string, since time.Time) ([]UsageRecord, error) {
+	rows, err := s.query(ctx,
+		`SELECT api_key, day, requests FROM usage WHERE api_key = ? AND day >= ? ORDER BY day`,
+		apiKey, usageDay(since).Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %v", err)
+	}
+	defer rows.Close()
+
+	var recs []UsageRecord
+	for rows.Next() {
+		var rec UsageRecord
+		var day int64
+		if err := rows.Scan(&rec.APIKey, &day, &rec.Requests); err != nil {
+			return nil, fmt.Errorf("failed to read usage: %v", err)
+		}
+		rec.Day = time.Unix(day, 0).UTC()
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+func (s *sqlStore) AppendAudit(ctx context.Context, entry *AuditEntry) error {
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+	entry.At = entry.At.UTC().Truncate(time.Second)
+	id, err := s.insert(ctx,
+		`INSERT INTO audit (actor, action, detail, at) VALUES (?, ?, ?, ?)`,
+		entry.Actor, entry.Action, entry.Detail, entry.At.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %v", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+func (s *sqlStore) ListAudit(ctx context.Context, since time.Time) ([]AuditEntry, error) {
+	rows, err := s.query(ctx,
+		`SELECT id, actor, action, detail, at FROM audit WHERE at >= ? ORDER BY at, id`,
+		since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var at int64
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.Detail, &at); err != nil {
+			return nil, fmt.Errorf("failed to read audit entry: %v", err)
+		}
+		entry.At = time.Unix(at, 0).UTC()
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) PruneHistory(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM history WHERE recorded_at < ?`, before)
+}
+
+func (s *sqlStore) PruneAudit(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM audit WHERE at < ?`, before)
+}
+
+func (s *sqlStore) PruneUsage(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM usage WHERE day < ?`, usageDay(before))
+}
+
+func (s *sqlStore) PruneSnapshots(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM forecast_snapshots WHERE recorded_at < ?`, before)
+}
+
+func (s *sqlStore) PruneAlerts(ctx context.Context, before time.Time) (int64, error) {
+	if _, err := s.prune(ctx, `DELETE FROM alert_zones WHERE alert_id IN (SELECT id FROM alerts WHERE ends < ?)`, before); err != nil {
+		return 0, err
+	}
+	return s.prune(ctx, `DELETE FROM alerts WHERE ends < ?`, before)
+}
+
+func (s *sqlStore) PruneDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM deliveries WHERE sent_at < ?`, before)
+}
+
+func (s *sqlStore) PruneShareLinks(ctx context.Context, before time.Time) (int64, error) {
+	return s.prune(ctx, `DELETE FROM share_links WHERE expires_at < ?`, before)
+}
+
+func (s *sqlStore) PruneSigningKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.exec(ctx, `DELETE FROM signing_keys WHERE expires_at < ? OR revoked_at < ?`, before.Unix(), before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) prune(ctx context.Context, query string, before time.Time) (int64, error) {
+	res, err := s.exec(ctx, query, before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune: %v", err)
+	}
+	return res.RowsAffected()
+}
+
+// rotateSecrets re-seals every stored secret that isn't already sealed with the
+// primary key, encrypting plaintext left from before encryption was enabled. It
+// returns the number of values rewritten.
+func (s *sqlStore) rotateSecrets(ctx context.Context) (int, error) {
+	columns := []struct{ table, id, column string }{
+		{table: "subscriptions", id: "id", column: "secret"},
+		{table: "api_keys", id: "id", column: "key"},
+		{table: "signing_keys", id: "id", column: "secret"},
+	}
+
+	rewritten := 0
+	for _, c := range columns {
+		rows, err := s.query(ctx, fmt.Sprintf(`SELECT %s, %s FROM %s`, c.id, c.column, c.table))
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to read %s: %v", c.table, err)
+		}
+		stale := make(map[string]string)
+		for rows.Next() {
+			var id, value string
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			if !s.cipher.current(value) {
+				stale[id] = value
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
+
+		for id, value := range stale {
+			plaintext, err := s.cipher.open(value)
+			if err != nil {
+				return rewritten, fmt.Errorf("%s %s: %v", c.table, id, err)
+			}
+			sealed, err := s.cipher.seal(plaintext)
+			if err != nil {
+				return rewritten, err
+			}
+			if _, err := s.exec(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE CAST(%s AS TEXT) = ?`, c.table, c.column, c.id), sealed, id); err != nil {
+				return rewritten, fmt.Errorf("failed to update %s %s: %v", c.table, id, err)
+			}
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// state is a concurrency-safe holder for the active configuration. Handlers take
+// a snapshot per request and never see a half-applied reload; writers replace
+// the whole Config atomically.
+type state struct {
+	config atomic.Pointer[Config]
+
+	// writeMu serializes Update so concurrent read-modify-write cycles don't
+	// lose each other's changes
+	writeMu sync.Mutex
+}
+
+// newState returns a state holding cfg
+func newState(cfg Config) *state {
+	s := &state{}
+	s.config.Store(&cfg)
+	return s
+}
+
+// Config returns the current configuration. The returned value must be treated
+// as read-only; use Store or Update to change it.
+func (s *state) Config() *Config {
+	return s.config.Load()
+}
+
+// Store replaces the configuration
+func (s *state) Store(cfg Config) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.config.Store(&cfg)
+}
+
+// Update applies fn to a copy of the current configuration and publishes the result
+func (s *state) Update(fn func(*Config)) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	cfg := *s.config.Load()
+	fn(&cfg)
+	s.config.Store(&cfg)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestStateConcurrentAccess exercises concurrent readers and writers; run with
+// -race to detect unsynchronized access
+func TestStateConcurrentAccess(t *testing.T) {
+	s := newState(defaultConfig())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Update(func(c *Config) {
+					c.NWSAPIHost = fmt.Sprintf("http://nws-%d-%d.example", i, j)
+				})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if cfg := s.Config(); cfg.NWSAPIHost == "" || cfg.Addr != ":8080" {
+					t.Errorf("observed inconsistent config %+v", *cfg)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestStateSnapshotIsolation tests that updates don't mutate earlier snapshots
+func TestStateSnapshotIsolation(t *testing.T) {
+	s := newState(defaultConfig())
+	before := s.Config()
+
+	s.Update(func(c *Config) { c.NWSAPIHost = "http://other.example" })
+
+	if before.NWSAPIHost != "https://api.weather.gov" {
+		t.Errorf("snapshot changed to %q", before.NWSAPIHost)
+	}
+	if got := s.Config().NWSAPIHost; got != "http://other.example" {
+		t.Errorf("expected updated host, got %q", got)
+	}
+
+	s.Store(defaultConfig())
+	if got := s.Config().NWSAPIHost; got != "https://api.weather.gov" {
+		t.Errorf("expected stored host, got %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// validStation reports whether id looks like an NWS observation station
+// identifier, such as the ICAO code KSEA
+func validStation(id string) bool {
+	if len(id) < 3 || len(id) > 8 {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// stationPoint resolves the observation station of a request's station
+// parameter to its location with the NWS /stations/{id} API, writing the
+// error response and returning false when it can't
+func (s *server) stationPoint(w http.ResponseWriter, r *http.Request, station string) (lat, lon string, ok bool) {
+	id := strings.ToUpper(strings.TrimSpace(station))
+	if !validStation(id) {
+		http.Error(w, "Invalid station parameter (want a station identifier such as KSEA)", http.StatusBadRequest)
+		return "", "", false
+	}
+	stationURL := fmt.Sprintf("%s/stations/%s", s.state.Config().NWSAPIHost, id)
+	body, statusCode, err := s.cachedNWSRequest(r.Context(), stationURL, stationURL, pointCacheTTLFor(s.state.Config().NWSCacheTTL))
+	if statusCode == http.StatusNotFound {
+		http.Error(w, "Station not found", http.StatusNotFound)
+		return "", "", false
+	}
+	if err != nil {
+		log.Printf("Failed to look up station %s: %v", id, err)
+		http.Error(w, "Failed to look up station", http.StatusBadGateway)
+		return "", "", false
+	}
+	var resp struct {
+		Geometry struct {
+			// Coordinates are GeoJSON, longitude first
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Geometry.Coordinates) < 2 {
+		http.Error(w, "Failed to parse station response", http.StatusBadGateway)
+		return "", "", false
+	}
+	return strconv.FormatFloat(resp.Geometry.Coordinates[1], 'f', 4, 64), strconv.FormatFloat(resp.Geometry.Coordinates[0], 'f', 4, 64), true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestStationForecast tests forecasting for an observation station's location
+func TestStationForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		station        fakeResponse
+		expectedStatus int
+	}{
+		{name: "station", path: "/forecast?station=KSEA", station: fakeResponse{body: `{"geometry": {"type": "Point", "coordinates": [-122.31442, 47.44467]}}`}, expectedStatus: http.StatusOK},
+		{name: "lowercase", path: "/forecast?station=ksea", station: fakeResponse{body: `{"geometry": {"type": "Point", "coordinates": [-122.31442, 47.44467]}}`}, expectedStatus: http.StatusOK},
+		{name: "unknown station", path: "/forecast?station=KXYZ", station: fakeResponse{status: http.StatusNotFound}, expectedStatus: http.StatusNotFound},
+		{name: "invalid station", path: "/forecast?station=../points", expectedStatus: http.StatusBadRequest},
+		{name: "NWS unavailable", path: "/forecast?station=KSEA", station: fakeResponse{status: http.StatusServiceUnavailable}, expectedStatus: http.StatusBadGateway},
+		{name: "no location", path: "/forecast?station=KSEA", station: fakeResponse{body: `{"geometry": null}`}, expectedStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			nws.responses["/stations/"] = tt.station
+			srv.nws = nws
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if paths := nws.paths(); len(paths) < 2 || paths[0] != "/stations/KSEA" || paths[1] != "/points/47.4447,-122.3144" {
+				t.Errorf("expected the station's location to be forecast, got %v", paths)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultStatsHours and maxStatsHours bound the horizon of /forecast/stats.
+	// NWS publishes about a week of hourly periods.
+	defaultStatsHours = 24
+	maxStatsHours     = 168
+)
+
+// temperatureStats summarises temperatures over a horizon, in °C
+type temperatureStats struct {
+	MinC  float64 `json:"minC"`
+	MaxC  float64 `json:"maxC"`
+	MeanC float64 `json:"meanC"`
+}
+
+// windiestPeriod is the hour with the highest forecast wind speed
+type windiestPeriod struct {
+	StartTime     time.Time `json:"startTime"`
+	WindSpeedKPH  float64   `json:"windSpeedKph"`
+	WindDirection string    `json:"windDirection,omitempty"`
+}
+
+// forecastStats is the body of /forecast/stats
+type forecastStats struct {
+	Latitude    float64          `json:"latitude"`
+	Longitude   float64          `json:"longitude"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	Hours       int              `json:"hours"`
+	Temperature temperatureStats `json:"temperature"`
+	// ExpectedPrecipitationHours is the sum of the hourly probabilities of
+	// precipitation: the number of hours it is expected to be wet.
+	ExpectedPrecipitationHours  float64         `json:"expectedPrecipitationHours"`
+	MaxPrecipitationProbability *int            `json:"maxPrecipitationProbability,omitempty"`
+	Windiest                    *windiestPeriod `json:"windiest,omitempty"`
+	FirstFreeze                 *time.Time      `json:"firstFreeze,omitempty"`
+	FirstThaw                   *time.Time      `json:"firstThaw,omitempty"`
+}
+
+// computeStats summarises the periods starting within hours of the first one.
+// A freeze is a drop from above 0°C to 0°C or below and a thaw the reverse;
+// each is reported at the start of the first period past the crossing.
+func computeStats(periods []weatherPeriod, hours int) forecastStats {
+	var stats forecastStats
+	if len(periods) == 0 {
+		return stats
+	}
+	stats.Start = periods[0].Start
+	horizon := stats.Start.Add(time.Duration(hours) * time.Hour)
+	stats.Temperature.MinC = math.Inf(1)
+	stats.Temperature.MaxC = math.Inf(-1)
+
+	var sum, pop float64
+	for i, p := range periods {
+		if i > 0 && !p.Start.Before(horizon) {
+			break
+		}
+		stats.Hours++
+		stats.End = p.End
+		sum += p.TemperatureC
+		stats.Temperature.MinC = min(stats.Temperature.MinC, p.TemperatureC)
+		stats.Temperature.MaxC = max(stats.Temperature.MaxC, p.TemperatureC)
+
+		if p.PrecipitationProbability != nil {
+			pop += float64(*p.PrecipitationProbability) / 100
+			if stats.MaxPrecipitationProbability == nil || *p.PrecipitationProbability > *stats.MaxPrecipitationProbability {
+				stats.MaxPrecipitationProbability = p.PrecipitationProbability
+			}
+		}
+		if p.WindSpeedKPH != nil && (stats.Windiest == nil || *p.WindSpeedKPH > stats.Windiest.WindSpeedKPH) {
+			stats.Windiest = &windiestPeriod{StartTime: p.Start, WindSpeedKPH: *p.WindSpeedKPH, WindDirection: p.WindDirection}
+		}
+
+		if i == 0 {
+			continue
+		}
+		start := p.Start
+		prev := periods[i-1].TemperatureC
+		if stats.FirstFreeze == nil && prev > 0 && p.TemperatureC <= 0 {
+			stats.FirstFreeze = &start
+		}
+		if stats.FirstThaw == nil && prev <= 0 && p.TemperatureC > 0 {
+			stats.FirstThaw = &start
+		}
+	}
+	stats.Temperature.MeanC = roundTenth(sum / float64(stats.Hours))
+	stats.ExpectedPrecipitationHours = roundTenth(pop)
+	return stats
+}
+
+// statsHandler serves a summary of the hourly forecast over ?hours= hours
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	hours := defaultStatsHours
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatsHours {
+			http.Error(w, fmt.Sprintf("Invalid hours parameter (want 1 to %d)", maxStatsHours), http.StatusBadRequest)
+			return
+		}
+		hours = n
+	}
+
+	periods, statusCode, err := s.fetchPeriods(r.Context(), lat, lon, true)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	if len(periods) == 0 {
+		http.Error(w, "No forecast periods found", http.StatusNotFound)
+		return
+	}
+	fillPrecipitationGaps(periods, s.state.Config().PrecipitationGapFill)
+
+	stats := computeStats(periods, hours)
+	stats.Latitude, stats.Longitude = parsePoint(lat, lon)
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestComputeStats tests summarising hourly periods over a horizon
+func TestComputeStats(t *testing.T) {
+	start := time.Date(2024, 11, 1, 18, 0, 0, 0, time.UTC)
+	pop := func(v int) *int { return &v }
+	wind := func(v float64) *float64 { return &v }
+	hours := []weatherPeriod{
+		{TemperatureC: 3, PrecipitationProbability: pop(50), WindSpeedKPH: wind(10), WindDirection: "N"},
+		{TemperatureC: 1, PrecipitationProbability: pop(30), WindSpeedKPH: wind(25), WindDirection: "NW"},
+		{TemperatureC: -1, PrecipitationProbability: pop(20), WindSpeedKPH: wind(15)},
+		{TemperatureC: -2},
+		{TemperatureC: 2, WindSpeedKPH: wind(25), WindDirection: "W"},
+		{TemperatureC: -5, PrecipitationProbability: pop(90)},
+	}
+	for i := range hours {
+		hours[i].Start = start.Add(time.Duration(i) * time.Hour)
+		hours[i].End = hours[i].Start.Add(time.Hour)
+	}
+
+	stats := computeStats(hours, 5)
+	if stats.Hours != 5 || !stats.Start.Equal(start) || !stats.End.Equal(start.Add(5*time.Hour)) {
+		t.Errorf("unexpected horizon %d hours %v - %v", stats.Hours, stats.Start, stats.End)
+	}
+	expected := temperatureStats{MinC: -2, MaxC: 3, MeanC: 0.6}
+	if stats.Temperature != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats.Temperature)
+	}
+	if stats.ExpectedPrecipitationHours != 1 {
+		t.Errorf("expected 1 wet hour, got %v", stats.ExpectedPrecipitationHours)
+	}
+	if stats.MaxPrecipitationProbability == nil || *stats.MaxPrecipitationProbability != 50 {
+		t.Errorf("expected 50%%, got %v", stats.MaxPrecipitationProbability)
+	}
+	// Ties keep the earliest windiest hour
+	if stats.Windiest == nil || stats.Windiest.WindSpeedKPH != 25 || stats.Windiest.WindDirection != "NW" {
+		t.Errorf("unexpected windiest period %+v", stats.Windiest)
+	}
+	if stats.FirstFreeze == nil || !stats.FirstFreeze.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("expected freeze at %v, got %v", start.Add(2*time.Hour), stats.FirstFreeze)
+	}
+	if stats.FirstThaw == nil || !stats.FirstThaw.Equal(start.Add(4*time.Hour)) {
+		t.Errorf("expected thaw at %v, got %v", start.Add(4*time.Hour), stats.FirstThaw)
+	}
+
+	// A single hour has no crossings and no wind
+	stats = computeStats(hours[3:4], 24)
+	if stats.Hours != 1 || stats.FirstFreeze != nil || stats.FirstThaw != nil || stats.Windiest != nil || stats.MaxPrecipitationProbability != nil {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if stats := computeStats(nil, 24); stats.Hours != 0 {
+		t.Errorf("expected no hours, got %d", stats.Hours)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when the requested record doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Subscription asks for webhook notifications about a location. Between
+// QuietStart and QuietEnd, local times such as "22:00" in TimeZone (UTC when
+// empty), notifications are held and sent as a digest afterwards, as are those
+// past MaxPerDay in a local day. A zero MaxPerDay means no cap. Escalation
+// decides how each alert is notified.
+type Subscription struct {
+	ID         int64            `json:"id"`
+	Owner      string           `json:"owner"`
+	Latitude   float64          `json:"latitude"`
+	Longitude  float64          `json:"longitude"`
+	WebhookURL string           `json:"webhookUrl"`
+	Secret     string           `json:"secret,omitempty"`
+	QuietStart string           `json:"quietStart,omitempty"`
+	QuietEnd   string           `json:"quietEnd,omitempty"`
+	TimeZone   string           `json:"timeZone,omitempty"`
+	MaxPerDay  int              `json:"maxPerDay,omitempty"`
+	Escalation []EscalationRule `json:"escalation,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// EscalationRule matches alerts at or above MinSeverity whose event is one of
+// Events and whose change is one of Changes, each matching any alert when
+// empty, and that satisfy the When expression if there is one. The first rule
+// an alert matches sets the Action taken.
+type EscalationRule struct {
+	MinSeverity string   `json:"minSeverity,omitempty"`
+	Events      []string `json:"events,omitempty"`
+	Changes     []string `json:"changes,omitempty"`
+	When        string   `json:"when,omitempty"`
+	Action      string   `json:"action"`
+}
+
+// Location is a named point saved by an owner
+type Location struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIKey is a credential issued to an owner. ID is public and identifies the key
+// in usage and audit records; Key is the secret presented by clients. Roles
+// are the scopes the key is allowed to use.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// HistoryRecord is a forecast that was served for a point
+type HistoryRecord struct {
+	ID          int64     `json:"id"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	Forecast    string    `json:"forecast"`
+	Temperature int       `json:"temperature"`
+	RecordedAt  time.Time `json:"recordedAt"`
+}
+
+// ForecastSnapshot is a revision of a forecast product for a point, kept so
+// the forecast can be reviewed as it stood at a past moment. Product is
+// "forecast" or "hourly", and Periods is the JSON encoded list of periods.
+type ForecastSnapshot struct {
+	ID         int64           `json:"id"`
+	Latitude   float64         `json:"latitude"`
+	Longitude  float64         `json:"longitude"`
+	Product    string          `json:"product"`
+	Periods    json.RawMessage `json:"periods"`
+	RecordedAt time.Time       `json:"recordedAt"`
+}
+
+// UsageRecord counts the requests made with an API key on a UTC day
+type UsageRecord struct {
+	APIKey   string    `json:"apiKey"`
+	Day      time.Time `json:"day"`
+	Requests int64     `json:"requests"`
+}
+
+// AuditEntry records an administrative action
+type AuditEntry struct {
+	ID     int64     `json:"id"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
+
+// Alert is a weather alert seen by the alert poller. Zones are the NWS UGC
+// codes of the forecast zones and counties it covers, and Ends is when the
+// hazard ends, or the alert expires if NWS gives no end. Expires, when NWS
+// stops reporting the alert, MessageType, and References, the IDs of the
+// earlier alerts an update or cancellation replaces, are read from NWS but not
+// stored.
+type Alert struct {
+	ID          string    `json:"id"`
+	Event       string    `json:"event"`
+	Severity    string    `json:"severity"`
+	Headline    string    `json:"headline"`
+	AreaDesc    string    `json:"areaDesc"`
+	Zones       []string  `json:"zones"`
+	Sent        time.Time `json:"sent"`
+	Onset       time.Time `json:"onset"`
+	Ends        time.Time `json:"ends"`
+	Expires     time.Time `json:"expires,omitzero"`
+	MessageType string    `json:"messageType,omitempty"`
+	References  []string  `json:"references,omitempty"`
+}
+
+// Delivery is a webhook notification as it was sent to a subscription, kept
+// so it can be replayed. ReplayOf is the delivery a replay resent. A held
+// delivery hasn't been sent yet; once it goes out in a digest, DigestID is the
+// digest's delivery.
+type Delivery struct {
+	ID             int64     `json:"id"`
+	SubscriptionID int64     `json:"subscriptionId"`
+	Event          string    `json:"event"`
+	ContentType    string    `json:"contentType"`
+	Body           []byte    `json:"-"`
+	Delivered      bool      `json:"delivered"`
+	Error          string    `json:"error,omitempty"`
+	ReplayOf       int64     `json:"replayOf,omitempty"`
+	Held           bool      `json:"held,omitempty"`
+	DigestID       int64     `json:"digestId,omitempty"`
+	SentAt         time.Time `json:"sentAt"`
+}
+
+// ShareLink is a short token naming a point and, optionally, a time window of
+// its forecast, for sharing in chat. Links stop resolving at ExpiresAt.
+type ShareLink struct {
+	Token     string     `json:"token"`
+	Owner     string     `json:"owner,omitempty"`
+	Latitude  float64    `json:"latitude"`
+	Longitude float64    `json:"longitude"`
+	Start     *time.Time `json:"start,omitempty"`
+	End       *time.Time `json:"end,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+}
+
+// SigningKey is a secret an owner's webhook notifications are signed with in
+// place of each subscription's own. A key signs notifications until it's
+// revoked or ExpiresAt passes; keys replaced by a rotation expire after an
+// overlap, so subscribers can move to the new key without missing any.
+type SigningKey struct {
+	ID        int64      `json:"id"`
+	Owner     string     `json:"owner"`
+	Secret    string     `json:"secret,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// active reports whether the key signs notifications at now
+func (k SigningKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// AlertQuery selects a page of alerts for a zone that were in effect at or
+// after Since. Alerts are ordered by sent time, then ID; AfterSent and AfterID
+// resume after the last alert of the previous page.
+type AlertQuery struct {
+	Zone      string
+	Since     time.Time
+	AfterSent time.Time
+	AfterID   string
+	Limit     int
+}
+
+// Store persists the service's subscriptions, saved locations, API keys,
+// forecast history and revisions, alerts, webhook deliveries and signing keys,
+// share links, API usage, and audit log
+type Store interface {
+	// CreateSubscription saves sub and sets its ID
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	// ListSubscriptions returns the subscriptions of owner, or all of them if owner is empty
+	ListSubscriptions(ctx context.Context, owner string) ([]Subscription, error)
+	// DeleteSubscription removes a subscription, returning ErrNotFound if it doesn't exist
+	DeleteSubscription(ctx context.Context, id int64) error
+
+	// CreateLocation saves loc and sets its ID
+	CreateLocation(ctx context.Context, loc *Location) error
+	// ListLocations returns the locations of owner, or all of them if owner is empty
+	ListLocations(ctx context.Context, owner string) ([]Location, error)
+	// DeleteLocation removes a location, returning ErrNotFound if it doesn't exist
+	DeleteLocation(ctx context.Context, id int64) error
+
+	// CreateAPIKey saves key; its ID must be unique. A key without roles gets
+	// the read role.
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	// GetAPIKey returns the key with an ID, or ErrNotFound
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	// ListAPIKeys returns every API key
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// DeleteAPIKey removes a key, returning ErrNotFound if it doesn't exist
+	DeleteAPIKey(ctx context.Context, id string) error
+
+	// AddHistory saves a served forecast and sets its ID
+	AddHistory(ctx context.Context, rec *HistoryRecord) error
+	// ListHistory returns the forecasts served for a point since a time, oldest first
+	ListHistory(ctx context.Context, lat, lon float64, since time.Time) ([]HistoryRecord, error)
+
+	// AddSnapshot saves a forecast revision and sets its ID
+	AddSnapshot(ctx context.Context, snap *ForecastSnapshot) error
+	// GetSnapshot returns the latest revision of a product for a point recorded
+	// at or before a time, or ErrNotFound
+	GetSnapshot(ctx context.Context, lat, lon float64, product string, at time.Time) (*ForecastSnapshot, error)
+	// ListSnapshots returns the revisions of every point recorded at or after
+	// from and before to, oldest first
+	ListSnapshots(ctx context.Context, from, to time.Time) ([]ForecastSnapshot, error)
+	// RecentSnapshots returns the latest revisions of a product for a point,
+	// newest first
+	RecentSnapshots(ctx context.Context, lat, lon float64, product string, limit int) ([]ForecastSnapshot, error)
+
+	// SaveAlert saves an alert, replacing any earlier copy with the same ID
+	SaveAlert(ctx context.Context, alert *Alert) error
+	// GetAlert returns the alert with an ID, or ErrNotFound
+	GetAlert(ctx context.Context, id string) (*Alert, error)
+	// ListAlerts returns a page of the alerts matching q
+	ListAlerts(ctx context.Context, q AlertQuery) ([]Alert, error)
+
+	// AddDelivery saves a webhook delivery and sets its ID
+	AddDelivery(ctx context.Context, d *Delivery) error
+	// GetDelivery returns the delivery with an ID, or ErrNotFound
+	GetDelivery(ctx context.Context, id int64) (*Delivery, error)
+	// ListDeliveries returns the latest deliveries to a subscription, newest
+	// first, without their bodies
+	ListDeliveries(ctx context.Context, subscriptionID int64, limit int) ([]Delivery, error)
+	// CountDeliveries returns how many deliveries were sent to a subscription
+	// since a time, not counting held deliveries or replays
+	CountDeliveries(ctx context.Context, subscriptionID int64, since time.Time) (int, error)
+	// ListHeldDeliveries returns every held delivery with its body, by
+	// subscription and then oldest first
+	ListHeldDeliveries(ctx context.Context) ([]Delivery, error)
+	// ReleaseDeliveries marks a subscription's held deliveries up to and
+	// including an ID as sent in a digest
+	ReleaseDeliveries(ctx context.Context, subscriptionID, throughID, digestID int64) error
+
+	// CreateSigningKey saves key and sets its ID
+	CreateSigningKey(ctx context.Context, key *SigningKey) error
+	// ListSigningKeys returns the signing keys of owner, or all of them if
+	// owner is empty, oldest first
+	ListSigningKeys(ctx context.Context, owner string) ([]SigningKey, error)
+	// ExpireSigningKey sets when a key stops signing, returning ErrNotFound if
+	// it doesn't exist
+	ExpireSigningKey(ctx context.Context, id int64, at time.Time) error
+	// RevokeSigningKey marks a key revoked at a time, returning ErrNotFound if
+	// it doesn't exist
+	RevokeSigningKey(ctx context.Context, id int64, at time.Time) error
+
+	// CreateShareLink saves link; its token must be unique
+	CreateShareLink(ctx context.Context, link *ShareLink) error
+	// GetShareLink returns the link with a token, or ErrNotFound. Expired links
+	// are returned until they're pruned.
+	GetShareLink(ctx context.Context, token string) (*ShareLink, error)
+
+	// RecordUsage counts one request for apiKey on the UTC day of at
+	RecordUsage(ctx context.Context, apiKey string, at time.Time) error
+	// ListUsage returns the daily request counts for apiKey since a time, oldest first
+	ListUsage(ctx context.Context, apiKey string, since time.Time) ([]UsageRecord, error)
+
+	// AppendAudit saves an audit entry and sets its ID
+	AppendAudit(ctx context.Context, entry *AuditEntry) error
+	// ListAudit returns audit entries since a time, oldest first
+	ListAudit(ctx context.Context, since time.Time) ([]AuditEntry, error)
+
+	// PruneHistory, PruneAudit, and PruneUsage delete rows older than a time and
+	// return how many were deleted
+	PruneHistory(ctx context.Context, before time.Time) (int64, error)
+	PruneAudit(ctx context.Context, before time.Time) (int64, error)
+	PruneUsage(ctx context.Context, before time.Time) (int64, error)
+	// PruneSnapshots deletes forecast revisions recorded before a time and
+	// returns how many were deleted
+	PruneSnapshots(ctx context.Context, before time.Time) (int64, error)
+	// PruneAlerts deletes alerts that ended before a time and returns how many
+	// were deleted
+	PruneAlerts(ctx context.Context, before time.Time) (int64, error)
+	// PruneDeliveries deletes webhook deliveries sent before a time and
+	// returns how many were deleted
+	PruneDeliveries(ctx context.Context, before time.Time) (int64, error)
+	// PruneShareLinks deletes share links that expired before a time and
+	// returns how many were deleted
+	PruneShareLinks(ctx context.Context, before time.Time) (int64, error)
+	// PruneSigningKeys deletes signing keys that expired or were revoked
+	// before a time and returns how many were deleted
+	PruneSigningKeys(ctx context.Context, before time.Time) (int64, error)
+
+	// Atomically runs fn with a Store whose writes are committed together if
+	// fn returns nil and discarded otherwise
+	Atomically(ctx context.Context, fn func(Store) error) error
+
+	Close() error
+}
+
+// openConfiguredStore opens the database named in cfg and attaches the
+// encryption keys, if configured
+func openConfiguredStore(cfg Config) (*sqlStore, error) {
+	var c *secretCipher
+	if cfg.EncryptionKeysFile != "" {
+		var err error
+		if c, err = loadKeyring(cfg.EncryptionKeysFile); err != nil {
+			return nil, err
+		}
+	}
+	store, err := openStore(cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	store.cipher = c
+	return store, nil
+}
+
+// openStore opens the database named by a URL: postgres://... or
+// postgresql://... for Postgres, and sqlite://path (or sqlite://:memory:) for SQLite
+func openStore(databaseURL string) (*sqlStore, error) {
+	var d dialect
+	var dsn string
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		d, dsn = postgresDialect, databaseURL
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		d, dsn = sqliteDialect, strings.TrimPrefix(databaseURL, "sqlite://")
+	default:
+		return nil, fmt.Errorf("unsupported database URL %q", databaseURL)
+	}
+
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if d.name == "sqlite" {
+		// SQLite allows a single writer, and each connection to :memory: is a
+		// separate database
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &sqlStore{db: db, dialect: d}, nil
+}
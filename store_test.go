@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a migrated in-memory SQLite store
+func newTestStore(t *testing.T) *sqlStore {
+	t.Helper()
+	return openMigratedStore(t, "sqlite://:memory:")
+}
+
+func openMigratedStore(t *testing.T, databaseURL string) *sqlStore {
+	t.Helper()
+	store, err := openStore(databaseURL)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.migrateUp(context.Background()); err != nil {
+		t.Fatalf("failed to migrate store: %v", err)
+	}
+	return store
+}
+
+// storeBackends returns the stores the contract tests run against. Postgres is
+// included when FORECAST_TEST_POSTGRES_URL points at a scratch database.
+func storeBackends(t *testing.T) map[string]func(t *testing.T) *sqlStore {
+	backends := map[string]func(t *testing.T) *sqlStore{
+		"sqlite": newTestStore,
+	}
+	if url := os.Getenv("FORECAST_TEST_POSTGRES_URL"); url != "" {
+		backends["postgres"] = func(t *testing.T) *sqlStore {
+			store := openMigratedStore(t, url)
+			t.Cleanup(func() {
+				if _, err := store.migrateDown(context.Background(), 1000); err != nil {
+					t.Errorf("failed to reset postgres: %v", err)
+				}
+			})
+			return store
+		}
+	}
+	return backends
+}
+
+// TestStoreSubscriptions tests creating, listing, and deleting subscriptions
+func TestStoreSubscriptions(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			a := &Subscription{Owner: "alice", Latitude: 47.6062, Longitude: -122.3321, WebhookURL: "https://example.com/a", Secret: "s3cret",
+				QuietStart: "22:00", QuietEnd: "07:00", TimeZone: "America/Los_Angeles", MaxPerDay: 5,
+				Escalation: []EscalationRule{{MinSeverity: "Extreme", Action: escalateImmediate}, {Events: []string{"Heat Advisory"}, Action: escalateDigest}}}
+			b := &Subscription{Owner: "bob", Latitude: 33.4484, Longitude: -112.074, WebhookURL: "https://example.com/b"}
+			for _, sub := range []*Subscription{a, b} {
+				if err := store.CreateSubscription(ctx, sub); err != nil {
+					t.Fatalf("create failed: %v", err)
+				}
+				if sub.ID == 0 {
+					t.Fatal("expected ID to be set")
+				}
+			}
+
+			all, err := store.ListSubscriptions(ctx, "")
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(all) != 2 {
+				t.Fatalf("expected 2 subscriptions, got %d", len(all))
+			}
+
+			mine, err := store.ListSubscriptions(ctx, "alice")
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(mine) != 1 || !reflect.DeepEqual(mine[0], *a) {
+				t.Errorf("expected %+v, got %+v", *a, mine)
+			}
+
+			if err := store.DeleteSubscription(ctx, a.ID); err != nil {
+				t.Fatalf("delete failed: %v", err)
+			}
+			if err := store.DeleteSubscription(ctx, a.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreLocationsAndAPIKeys tests saved locations and API keys
+func TestStoreLocationsAndAPIKeys(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			loc := &Location{Owner: "alice", Name: "Cabin", Latitude: 46.8523, Longitude: -121.7603}
+			if err := store.CreateLocation(ctx, loc); err != nil {
+				t.Fatalf("create location failed: %v", err)
+			}
+			locs, err := store.ListLocations(ctx, "alice")
+			if err != nil {
+				t.Fatalf("list locations failed: %v", err)
+			}
+			if len(locs) != 1 || locs[0] != *loc {
+				t.Errorf("expected %+v, got %+v", *loc, locs)
+			}
+			if others, _ := store.ListLocations(ctx, "bob"); len(others) != 0 {
+				t.Errorf("expected no locations for bob, got %+v", others)
+			}
+			if err := store.DeleteLocation(ctx, loc.ID); err != nil {
+				t.Fatalf("delete location failed: %v", err)
+			}
+			if err := store.DeleteLocation(ctx, loc.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			key := &APIKey{ID: "key-1", Owner: "alice", Name: "ci", Key: "secret", Roles: []string{scopeRead, scopeSubscribe}}
+			if err := store.CreateAPIKey(ctx, key); err != nil {
+				t.Fatalf("create key failed: %v", err)
+			}
+			if err := store.CreateAPIKey(ctx, &APIKey{ID: "key-1", Owner: "bob", Key: "other"}); err == nil {
+				t.Error("expected duplicate key ID to fail")
+			}
+			keys, err := store.ListAPIKeys(ctx)
+			if err != nil {
+				t.Fatalf("list keys failed: %v", err)
+			}
+			if len(keys) != 1 || !reflect.DeepEqual(keys[0], *key) {
+				t.Errorf("expected %+v, got %+v", *key, keys)
+			}
+			got, err := store.GetAPIKey(ctx, "key-1")
+			if err != nil || !reflect.DeepEqual(*got, *key) {
+				t.Errorf("expected %+v, got %+v (%v)", *key, got, err)
+			}
+			if _, err := store.GetAPIKey(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+			if err := store.DeleteAPIKey(ctx, "key-1"); err != nil {
+				t.Fatalf("delete key failed: %v", err)
+			}
+			if err := store.DeleteAPIKey(ctx, "key-1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreHistory tests recording and querying served forecasts
+func TestStoreHistory(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			records := []*HistoryRecord{
+				{Latitude: 47.6062, Longitude: -122.3321, Forecast: "Rain", Temperature: 50, RecordedAt: now.Add(-48 * time.Hour)},
+				{Latitude: 47.6062, Longitude: -122.3321, Forecast: "Sunny", Temperature: 70, RecordedAt: now},
+				{Latitude: 33.4484, Longitude: -112.074, Forecast: "Hot", Temperature: 110, RecordedAt: now},
+			}
+			for _, rec := range records {
+				if err := store.AddHistory(ctx, rec); err != nil {
+					t.Fatalf("add failed: %v", err)
+				}
+			}
+
+			got, err := store.ListHistory(ctx, 47.6062, -122.3321, now.Add(-time.Hour))
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(got) != 1 || got[0] != *records[1] {
+				t.Errorf("expected %+v, got %+v", *records[1], got)
+			}
+		})
+	}
+}
+
+// TestStoreSnapshots tests retrieving the forecast revision in effect at a time
+func TestStoreSnapshots(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			old := &ForecastSnapshot{Latitude: 47.6062, Longitude: -122.3321, Product: "forecast", Periods: json.RawMessage(`[1]`), RecordedAt: now.Add(-2 * time.Hour)}
+			current := &ForecastSnapshot{Latitude: 47.6062, Longitude: -122.3321, Product: "forecast", Periods: json.RawMessage(`[2]`), RecordedAt: now}
+			hourly := &ForecastSnapshot{Latitude: 47.6062, Longitude: -122.3321, Product: "hourly", Periods: json.RawMessage(`[3]`), RecordedAt: now.Add(-time.Hour)}
+			for _, snap := range []*ForecastSnapshot{old, current, hourly} {
+				if err := store.AddSnapshot(ctx, snap); err != nil {
+					t.Fatalf("add failed: %v", err)
+				}
+			}
+
+			got, err := store.GetSnapshot(ctx, 47.6062, -122.3321, "forecast", now.Add(-time.Hour))
+			if err != nil {
+				t.Fatalf("get failed: %v", err)
+			}
+			if !reflect.DeepEqual(*got, *old) {
+				t.Errorf("expected %+v, got %+v", *old, *got)
+			}
+			if _, err := store.GetSnapshot(ctx, 47.6062, -122.3321, "forecast", now.Add(-3*time.Hour)); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			recent, err := store.RecentSnapshots(ctx, 47.6062, -122.3321, "forecast", 5)
+			if err != nil {
+				t.Fatalf("recent failed: %v", err)
+			}
+			if len(recent) != 2 || recent[0].ID != current.ID || recent[1].ID != old.ID {
+				t.Errorf("expected the two forecast revisions newest first, got %+v", recent)
+			}
+
+			if n, err := store.PruneSnapshots(ctx, now.Add(-90*time.Minute)); err != nil || n != 1 {
+				t.Errorf("expected 1 snapshot pruned, got %d (%v)", n, err)
+			}
+		})
+	}
+}
+
+// TestStoreAlerts tests saving, updating, paging, and pruning alerts
+func TestStoreAlerts(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			old := &Alert{ID: "urn:oid:1", Event: "Flood Watch", Zones: []string{"WAZ558"}, Sent: now.Add(-72 * time.Hour), Onset: now.Add(-72 * time.Hour), Ends: now.Add(-48 * time.Hour)}
+			a := &Alert{ID: "urn:oid:2", Event: "Wind Advisory", Zones: []string{"WAZ558"}, Sent: now.Add(-2 * time.Hour), Onset: now, Ends: now.Add(time.Hour)}
+			b := &Alert{ID: "urn:oid:3", Event: "Winter Storm Watch", Zones: []string{"WAZ558", "WAZ559"}, Sent: now.Add(-time.Hour), Onset: now, Ends: now.Add(time.Hour)}
+			for _, alert := range []*Alert{old, a, b} {
+				if err := store.SaveAlert(ctx, alert); err != nil {
+					t.Fatalf("save failed: %v", err)
+				}
+			}
+			// Saving again replaces the alert and its zones
+			a.Headline, a.Zones = "Wind Advisory extended", []string{"WAC033", "WAZ558"}
+			if err := store.SaveAlert(ctx, a); err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+
+			got, err := store.ListAlerts(ctx, AlertQuery{Zone: "WAZ558", Since: now.Add(-24 * time.Hour), Limit: 1})
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(got) != 1 || !reflect.DeepEqual(got[0], *a) {
+				t.Errorf("expected %+v, got %+v", *a, got)
+			}
+			got, err = store.ListAlerts(ctx, AlertQuery{Zone: "WAZ558", Since: now.Add(-24 * time.Hour), AfterSent: a.Sent, AfterID: a.ID, Limit: 10})
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(got) != 1 || got[0].ID != b.ID {
+				t.Errorf("expected the next page to hold %s, got %+v", b.ID, got)
+			}
+			if alert, err := store.GetAlert(ctx, b.ID); err != nil || !reflect.DeepEqual(*alert, *b) {
+				t.Errorf("expected %+v, got %+v (%v)", *b, alert, err)
+			}
+			if _, err := store.GetAlert(ctx, "urn:oid:999"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			n, err := store.PruneAlerts(ctx, now.Add(-24*time.Hour))
+			if err != nil || n != 1 {
+				t.Errorf("expected 1 alert pruned, got %d (%v)", n, err)
+			}
+			if got, _ := store.ListAlerts(ctx, AlertQuery{Zone: "WAZ558", Limit: 10}); len(got) != 2 {
+				t.Errorf("expected 2 alerts left, got %+v", got)
+			}
+		})
+	}
+}
+
+// TestStoreDeliveries tests saving, listing, and pruning webhook deliveries
+func TestStoreDeliveries(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			old := &Delivery{SubscriptionID: 1, Event: "report.weekly", ContentType: "application/pdf", Body: []byte("%PDF-\x00"), Delivered: true, SentAt: now.Add(-48 * time.Hour)}
+			failed := &Delivery{SubscriptionID: 1, Event: "report.weekly", ContentType: "application/pdf", Body: []byte("%PDF-"), Error: "webhook 1 failed with status: 500", SentAt: now.Add(-time.Hour)}
+			other := &Delivery{SubscriptionID: 2, Event: "report.weekly", ContentType: "text/html", Body: []byte("<p>"), Delivered: true, SentAt: now}
+			for _, d := range []*Delivery{old, failed, other} {
+				if err := store.AddDelivery(ctx, d); err != nil {
+					t.Fatalf("add failed: %v", err)
+				}
+			}
+			replay := &Delivery{SubscriptionID: 1, Event: old.Event, ContentType: old.ContentType, Body: old.Body, Delivered: true, ReplayOf: old.ID, SentAt: now}
+			if err := store.AddDelivery(ctx, replay); err != nil {
+				t.Fatalf("add failed: %v", err)
+			}
+
+			got, err := store.GetDelivery(ctx, old.ID)
+			if err != nil {
+				t.Fatalf("get failed: %v", err)
+			}
+			if !reflect.DeepEqual(*got, *old) {
+				t.Errorf("expected %+v, got %+v", *old, *got)
+			}
+			if _, err := store.GetDelivery(ctx, 999); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			list, err := store.ListDeliveries(ctx, 1, 10)
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(list) != 3 || list[0].ID != replay.ID || list[0].ReplayOf != old.ID || list[1].ID != failed.ID || list[1].Error == "" || list[0].Body != nil {
+				t.Errorf("expected subscription 1's deliveries newest first without bodies, got %+v", list)
+			}
+
+			if n, err := store.CountDeliveries(ctx, 1, now.Add(-24*time.Hour)); err != nil || n != 1 {
+				t.Errorf("expected 1 delivery counted without the replay, got %d (%v)", n, err)
+			}
+			held := &Delivery{SubscriptionID: 1, Event: "report.weekly", ContentType: "text/html", Body: []byte("<p>"), Held: true, SentAt: now}
+			if err := store.AddDelivery(ctx, held); err != nil {
+				t.Fatalf("add failed: %v", err)
+			}
+			pending, err := store.ListHeldDeliveries(ctx)
+			if err != nil || len(pending) != 1 || pending[0].ID != held.ID || string(pending[0].Body) != "<p>" {
+				t.Errorf("expected the held delivery with its body, got %+v (%v)", pending, err)
+			}
+			if err := store.ReleaseDeliveries(ctx, 1, held.ID, replay.ID); err != nil {
+				t.Fatalf("release failed: %v", err)
+			}
+			if got, err := store.GetDelivery(ctx, held.ID); err != nil || got.Held || got.DigestID != replay.ID {
+				t.Errorf("expected the delivery released in digest %d, got %+v (%v)", replay.ID, got, err)
+			}
+			if n, _ := store.CountDeliveries(ctx, 1, now.Add(-24*time.Hour)); n != 1 {
+				t.Errorf("expected a released delivery not to be counted, got %d", n)
+			}
+
+			if n, err := store.PruneDeliveries(ctx, now.Add(-24*time.Hour)); err != nil || n != 1 {
+				t.Errorf("expected 1 delivery pruned, got %d (%v)", n, err)
+			}
+		})
+	}
+}
+
+// TestStoreShareLinks tests saving, reading, and pruning share links
+func TestStoreShareLinks(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			start, end := now.Add(time.Hour), now.Add(4*time.Hour)
+			window := &ShareLink{Token: "window", Owner: "alice", Latitude: 47.6062, Longitude: -122.3321, Start: &start, End: &end, CreatedAt: now, ExpiresAt: now.Add(24 * time.Hour)}
+			expired := &ShareLink{Token: "expired", Latitude: 1, Longitude: 2, CreatedAt: now.Add(-48 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+			for _, link := range []*ShareLink{window, expired} {
+				if err := store.CreateShareLink(ctx, link); err != nil {
+					t.Fatalf("create failed: %v", err)
+				}
+			}
+			if err := store.CreateShareLink(ctx, &ShareLink{Token: "window", ExpiresAt: now}); err == nil {
+				t.Error("expected an error for a duplicate token")
+			}
+
+			got, err := store.GetShareLink(ctx, "window")
+			if err != nil {
+				t.Fatalf("get failed: %v", err)
+			}
+			if !reflect.DeepEqual(*got, *window) {
+				t.Errorf("expected %+v, got %+v", *window, *got)
+			}
+			got, err = store.GetShareLink(ctx, "expired")
+			if err != nil || got.Start != nil || got.End != nil {
+				t.Errorf("expected a link without a window, got %+v (%v)", got, err)
+			}
+
+			if n, err := store.PruneShareLinks(ctx, now); err != nil || n != 1 {
+				t.Errorf("expected 1 share link pruned, got %d (%v)", n, err)
+			}
+			if _, err := store.GetShareLink(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreSigningKeys tests saving, expiring, revoking, and pruning signing keys
+func TestStoreSigningKeys(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			first := &SigningKey{Owner: "alice", Secret: "first", CreatedAt: now.Add(-time.Hour)}
+			second := &SigningKey{Owner: "alice", Secret: "second", CreatedAt: now}
+			other := &SigningKey{Owner: "bob", Secret: "other", CreatedAt: now}
+			for _, key := range []*SigningKey{first, second, other} {
+				if err := store.CreateSigningKey(ctx, key); err != nil || key.ID == 0 {
+					t.Fatalf("create failed: %v", err)
+				}
+			}
+
+			expires := now.Add(time.Hour)
+			if err := store.ExpireSigningKey(ctx, first.ID, expires); err != nil {
+				t.Fatalf("expire failed: %v", err)
+			}
+			if err := store.RevokeSigningKey(ctx, other.ID, now.Add(-time.Minute)); err != nil {
+				t.Fatalf("revoke failed: %v", err)
+			}
+			if err := store.RevokeSigningKey(ctx, 999, now); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			keys, err := store.ListSigningKeys(ctx, "alice")
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			first.ExpiresAt = &expires
+			expected := []SigningKey{*first, *second}
+			if !reflect.DeepEqual(keys, expected) {
+				t.Errorf("expected %+v, got %+v", expected, keys)
+			}
+			if !keys[0].active(now) || keys[0].active(expires) {
+				t.Errorf("expected the first key to be active until %v", expires)
+			}
+
+			if n, err := store.PruneSigningKeys(ctx, now); err != nil || n != 1 {
+				t.Errorf("expected 1 signing key pruned, got %d (%v)", n, err)
+			}
+			if keys, _ := store.ListSigningKeys(ctx, "bob"); len(keys) != 0 {
+				t.Errorf("expected the revoked key to be pruned, got %+v", keys)
+			}
+		})
+	}
+}
+
+// TestStoreUsage tests per-day request counting
+func TestStoreUsage(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+			for _, at := range []time.Time{day.Add(time.Hour), day.Add(23 * time.Hour), day.Add(25 * time.Hour)} {
+				if err := store.RecordUsage(ctx, "key-1", at); err != nil {
+					t.Fatalf("record failed: %v", err)
+				}
+			}
+			if err := store.RecordUsage(ctx, "key-2", day); err != nil {
+				t.Fatalf("record failed: %v", err)
+			}
+
+			got, err := store.ListUsage(ctx, "key-1", day)
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			expected := []UsageRecord{
+				{APIKey: "key-1", Day: day, Requests: 2},
+				{APIKey: "key-1", Day: day.Add(24 * time.Hour), Requests: 1},
+			}
+			if len(got) != len(expected) {
+				t.Fatalf("expected %+v, got %+v", expected, got)
+			}
+			for i := range expected {
+				if got[i] != expected[i] {
+					t.Errorf("expected %+v, got %+v", expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+// TestStoreAudit tests appending and listing audit entries
+func TestStoreAudit(t *testing.T) {
+	for name, open := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+
+			old := &AuditEntry{Actor: "admin", Action: "key.create", At: now.Add(-time.Hour)}
+			recent := &AuditEntry{Actor: "admin", Action: "key.revoke", Detail: "key-1", At: now}
+			for _, e := range []*AuditEntry{old, recent} {
+				if err := store.AppendAudit(ctx, e); err != nil {
+					t.Fatalf("append failed: %v", err)
+				}
+			}
+
+			got, err := store.ListAudit(ctx, now.Add(-time.Minute))
+			if err != nil {
+				t.Fatalf("list failed: %v", err)
+			}
+			if len(got) != 1 || got[0] != *recent {
+				t.Errorf("expected %+v, got %+v", *recent, got)
+			}
+		})
+	}
+}
+
+// TestOpenStoreUnsupported tests rejecting unknown database URLs
+func TestOpenStoreUnsupported(t *testing.T) {
+	if _, err := openStore("mysql://localhost/forecast"); err == nil {
+		t.Error("expected error for unsupported database")
+	}
+}
+
+// TestForecastHandlerRecordsHistory tests that served forecasts are persisted
+func TestForecastHandlerRecordsHistory(t *testing.T) {
+	mockNWS := createMockNWSServer(200, 200, `{"properties": {"periods": [{"shortForecast": "Sunny", "temperature": 72}]}}`)
+	defer mockNWS.Close()
+
+	srv := newServer(Config{NWSAPIHost: mockNWS.URL})
+	srv.store = newTestStore(t)
+
+	req := httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil)
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	history, err := srv.store.ListHistory(context.Background(), 47.6062, -122.3321, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Forecast != "Sunny" || history[0].Temperature != 72 {
+		t.Errorf("unexpected history %+v", history)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// createSubscriptionRequest is the body of POST /subscriptions. A signing
+// secret is generated when none is given. Quiet hours, the daily cap, and
+// escalation rules are optional.
+type createSubscriptionRequest struct {
+	Latitude   float64          `json:"latitude"`
+	Longitude  float64          `json:"longitude"`
+	WebhookURL string           `json:"webhookUrl"`
+	Secret     string           `json:"secret"`
+	QuietStart string           `json:"quietStart"`
+	QuietEnd   string           `json:"quietEnd"`
+	TimeZone   string           `json:"timeZone"`
+	MaxPerDay  int              `json:"maxPerDay"`
+	Escalation []EscalationRule `json:"escalation"`
+}
+
+// validate checks the point, webhook, notification policy, and escalation
+// rules of a new subscription
+func (req createSubscriptionRequest) validate() error {
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
+		return fmt.Errorf("latitude or longitude out of range")
+	}
+	u, err := url.Parse(req.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhookUrl must be an http or https URL")
+	}
+	if err := validateNotificationPolicy(req.QuietStart, req.QuietEnd, req.TimeZone, req.MaxPerDay); err != nil {
+		return err
+	}
+	return validateEscalation(req.Escalation)
+}
+
+func (s *server) createSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	key := apiKeyFromContext(r.Context())
+	var req createSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			http.Error(w, "Failed to create subscription", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = hex.EncodeToString(b)
+	}
+
+	sub := &Subscription{
+		Owner:      key.Owner,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		WebhookURL: req.WebhookURL,
+		Secret:     req.Secret,
+		QuietStart: req.QuietStart,
+		QuietEnd:   req.QuietEnd,
+		TimeZone:   req.TimeZone,
+		MaxPerDay:  req.MaxPerDay,
+		Escalation: req.Escalation,
+	}
+	if err := s.store.CreateSubscription(r.Context(), sub); err != nil {
+		log.Printf("Failed to create subscription: %v", err)
+		http.Error(w, "Failed to create subscription", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "subscription.create", strconv.FormatInt(sub.ID, 10))
+	// The secret is only returned when the subscription is created
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (s *server) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.store.ListSubscriptions(r.Context(), apiKeyFromContext(r.Context()).Owner)
+	if err != nil {
+		log.Printf("Failed to list subscriptions: %v", err)
+		http.Error(w, "Failed to list subscriptions", http.StatusInternalServerError)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	if subs == nil {
+		subs = []Subscription{}
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (s *server) deleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+	_, err = s.ownedSubscription(r, id)
+	if err == nil {
+		err = s.store.DeleteSubscription(r.Context(), id)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete subscription: %v", err)
+		http.Error(w, "Failed to delete subscription", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, "subscription.delete", strconv.FormatInt(id, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSubscriptionEndpoints tests that subscribe keys manage only their owner's subscriptions
+func TestSubscriptionEndpoints(t *testing.T) {
+	srv, tokens := newAuthServer(t, Config{})
+	handler := srv.routes()
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{name: "valid", body: `{"latitude": 47.6, "longitude": -122.3, "webhookUrl": "https://example.com/hook"}`, expected: http.StatusCreated},
+		{name: "latitude out of range", body: `{"latitude": 95, "longitude": -122.3, "webhookUrl": "https://example.com/hook"}`, expected: http.StatusBadRequest},
+		{name: "non-http webhook", body: `{"latitude": 47.6, "longitude": -122.3, "webhookUrl": "ftp://example.com"}`, expected: http.StatusBadRequest},
+		{name: "invalid body", body: `{`, expected: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do("POST", "/subscriptions", tokens[scopeSubscribe], tt.body); w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := do("POST", "/subscriptions", tokens[scopeRead], tests[0].body); w.Code != http.StatusForbidden {
+		t.Errorf("expected read key to be forbidden, got %d", w.Code)
+	}
+
+	w := do("GET", "/subscriptions", tokens[scopeSubscribe], "")
+	var subs []Subscription
+	if err := json.Unmarshal(w.Body.Bytes(), &subs); err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].Owner != "owner-subscribe" || subs[0].Secret != "" {
+		t.Fatalf("unexpected subscriptions %+v", subs)
+	}
+
+	// Another owner can't see or delete the subscription
+	other, otherToken, err := newAPIKey("owner-other", "other", []string{scopeSubscribe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.store.CreateAPIKey(t.Context(), other); err != nil {
+		t.Fatal(err)
+	}
+	path := "/subscriptions/" + strconv.FormatInt(subs[0].ID, 10)
+	if w := do("GET", "/subscriptions", otherToken, ""); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected no subscriptions for another owner, got %s", w.Body.String())
+	}
+	if w := do("DELETE", path, otherToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+	if w := do("DELETE", path, tokens[scopeSubscribe], ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+
+	// Admins may delete any owner's subscription
+	w = do("POST", "/subscriptions", tokens[scopeSubscribe], tests[0].body)
+	var created Subscription
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	path = "/subscriptions/" + strconv.FormatInt(created.ID, 10)
+	if w := do("DELETE", path, tokens[scopeAdmin], ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 for an admin, got %d", w.Code)
+	}
+	if w := do("GET", "/subscriptions", tokens[scopeSubscribe], ""); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected the subscription to be deleted, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// outlookDays is how many days summaryText describes
+const outlookDays = 3
+
+// The weather an outlook day is described by, in increasing severity
+const (
+	outlookDry = iota
+	outlookRain
+	outlookSnow
+	outlookStorms
+)
+
+// outlookWeather maps conditions to the weather they bring to an outlook.
+// Conditions not listed are dry.
+var outlookWeather = map[condition]int{
+	conditionDrizzle:       outlookRain,
+	conditionRain:          outlookRain,
+	conditionShowers:       outlookRain,
+	conditionFreezingRain:  outlookRain,
+	conditionSleet:         outlookSnow,
+	conditionRainSnow:      outlookSnow,
+	conditionSnow:          outlookSnow,
+	conditionBlizzard:      outlookSnow,
+	conditionThunderstorm:  outlookStorms,
+	conditionTropicalStorm: outlookStorms,
+	conditionHurricane:     outlookStorms,
+	conditionTornado:       outlookStorms,
+}
+
+// outlookRainChance is the chance of precipitation in percent at which a
+// period whose wording doesn't mention any is described as rainy
+const outlookRainChance = 60
+
+// outlookAdjectives and outlookNouns describe the weather opening an outlook
+// and arriving later in it; dry weather arriving is "drying out" instead
+var (
+	outlookAdjectives = []string{"Dry", "Rainy", "Snowy", "Stormy"}
+	outlookNouns      = []string{"", "rain", "snow", "storms"}
+)
+
+// outlookDay is one day of an outlook
+type outlookDay struct {
+	Date    time.Time
+	Weather int
+	// HighC is the daytime high, or the warmest period when the day has no
+	// daytime period
+	HighC float64
+}
+
+// feel describes a daytime high in °C
+func feel(highC float64) string {
+	switch {
+	case highC < 5:
+		return "cold"
+	case highC < 15:
+		return "cool"
+	case highC < 25:
+		return "mild"
+	case highC < 32:
+		return "warm"
+	default:
+		return "hot"
+	}
+}
+
+// outlookDaysOf groups periods into at most outlookDays days, in the local
+// time of the forecast, each described by its wettest weather
+func outlookDaysOf(periods []weatherPeriod) []outlookDay {
+	var days []outlookDay
+	hasHigh := false
+	for _, p := range periods {
+		y, m, d := p.Start.Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, p.Start.Location())
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(date) {
+			if len(days) == outlookDays {
+				break
+			}
+			days = append(days, outlookDay{Date: date, HighC: p.TemperatureC})
+			hasHigh = false
+		}
+		day := &days[len(days)-1]
+		weather := outlookWeather[p.Condition]
+		if weather == outlookDry && p.PrecipitationProbability != nil && *p.PrecipitationProbability >= outlookRainChance {
+			weather = outlookRain
+		}
+		day.Weather = max(day.Weather, weather)
+		switch {
+		case p.IsDaytime && !hasHigh:
+			day.HighC, hasHigh = p.TemperatureC, true
+		case !hasHigh:
+			day.HighC = max(day.HighC, p.TemperatureC)
+		}
+	}
+	return days
+}
+
+// summarizeOutlook composes a one-sentence summary of the next outlookDays
+// days of a forecast, such as "Dry and mild through Thursday, rain arriving
+// Friday". It returns "" when the periods have no start times to group them
+// into days by.
+func summarizeOutlook(periods []weatherPeriod) string {
+	if len(periods) == 0 || periods[0].Start.IsZero() {
+		return ""
+	}
+	days := outlookDaysOf(periods)
+
+	// The outlook opens with the first run of days with the same weather,
+	// then names each change of weather on the day it arrives
+	end := 1
+	for end < len(days) && days[end].Weather == days[0].Weather {
+		end++
+	}
+	var b strings.Builder
+	b.WriteString(outlookAdjectives[days[0].Weather])
+	b.WriteString(" and ")
+	b.WriteString(feel(days[0].HighC))
+	if end > 1 {
+		b.WriteString(" through")
+	}
+	b.WriteString(" ")
+	b.WriteString(days[end-1].Date.Weekday().String())
+	for i := end; i < len(days); i++ {
+		if days[i].Weather == days[i-1].Weather {
+			continue
+		}
+		b.WriteString(", ")
+		if days[i].Weather == outlookDry {
+			b.WriteString("drying out ")
+		} else {
+			b.WriteString(outlookNouns[days[i].Weather])
+			b.WriteString(" arriving ")
+		}
+		b.WriteString(days[i].Date.Weekday().String())
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// outlookPeriods returns a day and night period for each day from Tuesday,
+// June 4th 2024, with the given conditions and daytime highs
+func outlookPeriods(conditions []condition, highs []float64) []weatherPeriod {
+	start := time.Date(2024, 6, 4, 6, 0, 0, 0, time.UTC)
+	var periods []weatherPeriod
+	for i, c := range conditions {
+		day := start.AddDate(0, 0, i)
+		periods = append(periods,
+			weatherPeriod{Start: day, End: day.Add(12 * time.Hour), IsDaytime: true, TemperatureC: highs[i], Condition: c},
+			weatherPeriod{Start: day.Add(12 * time.Hour), End: day.Add(24 * time.Hour), TemperatureC: highs[i] - 10, Condition: conditionClear},
+		)
+	}
+	return periods
+}
+
+// TestSummarizeOutlook tests composing an outlook of the next three days
+func TestSummarizeOutlook(t *testing.T) {
+	pop := 80
+	likely := outlookPeriods([]condition{conditionCloudy}, []float64{12})
+	likely[0].PrecipitationProbability = &pop
+	tests := []struct {
+		name     string
+		periods  []weatherPeriod
+		expected string
+	}{
+		{name: "no periods"},
+		{name: "no start times", periods: []weatherPeriod{{Summary: "Sunny"}}},
+		{
+			name:     "dry",
+			periods:  outlookPeriods([]condition{conditionClear, conditionPartlyCloudy, conditionCloudy, conditionRain}, []float64{20, 22, 21, 18}),
+			expected: "Dry and mild through Thursday",
+		},
+		{
+			name:     "rain arriving",
+			periods:  outlookPeriods([]condition{conditionClear, conditionClear, conditionShowers}, []float64{20, 22, 18}),
+			expected: "Dry and mild through Wednesday, rain arriving Thursday",
+		},
+		{
+			name:     "drying out",
+			periods:  outlookPeriods([]condition{conditionSnow, conditionClear, conditionClear}, []float64{-2, 0, 1}),
+			expected: "Snowy and cold Tuesday, drying out Wednesday",
+		},
+		{
+			name:     "storms then rain",
+			periods:  outlookPeriods([]condition{conditionThunderstorm, conditionRain, conditionRain}, []float64{33, 28, 27}),
+			expected: "Stormy and hot Tuesday, rain arriving Wednesday",
+		},
+		{name: "likely precipitation", periods: likely, expected: "Rainy and cool Tuesday"},
+		{
+			name:     "starting tonight",
+			periods:  outlookPeriods([]condition{conditionClear, conditionClear}, []float64{10, 10})[1:],
+			expected: "Dry and cold through Wednesday",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeOutlook(tt.periods); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestForecastHandlerSummary tests returning the outlook as summaryText
+func TestForecastHandlerSummary(t *testing.T) {
+	srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+	srv.nws = newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [
+		{"startTime": "2024-06-04T06:00:00-07:00", "isDaytime": true, "temperature": 75, "shortForecast": "Sunny"},
+		{"startTime": "2024-06-04T18:00:00-07:00", "isDaytime": false, "temperature": 55, "shortForecast": "Clear"},
+		{"startTime": "2024-06-05T06:00:00-07:00", "isDaytime": true, "temperature": 68, "shortForecast": "Rain"}
+	]}}`})
+	w := httptest.NewRecorder()
+	srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321&period=first", nil))
+	var response ForecastOutput
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if expected := "Dry and mild Tuesday, rain arriving Wednesday"; response.SummaryText != expected {
+		t.Errorf("expected %q, got %q", expected, response.SummaryText)
+	}
+}
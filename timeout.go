@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits of the HTTP listeners, protecting them from clients that send
+// slowly or hold connections open. A handler that runs past its route's
+// timeout is answered with 503 while it's abandoned.
+const (
+	// readHeaderTimeout bounds reading a request's headers
+	readHeaderTimeout = 5 * time.Second
+	// readTimeout bounds reading a whole request, including its body
+	readTimeout = 30 * time.Second
+	// idleTimeout is how long a keep-alive connection waits for its next
+	// request
+	idleTimeout = 2 * time.Minute
+	// maxHeaderBytes bounds the size of a request's headers
+	maxHeaderBytes = 64 << 10
+	// slowRouteTimeout is the timeout of routes that make many upstream
+	// requests, such as /compare
+	slowRouteTimeout = 2 * time.Minute
+	// upstreamTimeout bounds each request to NWS
+	upstreamTimeout = 20 * time.Second
+	// writeTimeoutMargin is how much longer than the longest route timeout a
+	// response may take to write
+	writeTimeoutMargin = 10 * time.Second
+)
+
+// requestsTimedOut counts requests answered with 503 because their handler
+// ran past its timeout
+var requestsTimedOut = expvar.NewInt("forecast_requests_timed_out")
+
+// newHTTPServer returns a server for handler on addr with the listener limits
+func newHTTPServer(addr string, handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      max(cfg.RequestTimeout, slowRouteTimeout) + writeTimeoutMargin,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ConnState:         trackConnState,
+	}
+}
+
+// timeoutWriter buffers a handler's response until it finishes, so nothing is
+// written if it times out first
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.status, w.wroteHeader = status, true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = http.StatusOK, true
+	}
+	return w.buf.Write(b)
+}
+
+// withTimeout runs next with a deadline of timeout, or the configured request
+// timeout when that's zero. The request's context is cancelled at the
+// deadline, and if next hasn't finished by then the client gets a 503 with a
+// JSON error instead of its response. Without any timeout next runs as is.
+func (s *server) withTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := timeout
+		if d == 0 {
+			d = s.state.Config().RequestTimeout
+		}
+		if d == 0 {
+			next(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			maps.Copy(w.Header(), tw.header)
+			if tw.wroteHeader {
+				w.WriteHeader(tw.status)
+			}
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			requestsTimedOut.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Request timed out"})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestWithTimeout tests passing on the responses of handlers that finish in
+// time and answering with a JSON 503 for those that don't
+func TestWithTimeout(t *testing.T) {
+	s := newServer(Config{RequestTimeout: 20 * time.Millisecond})
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		handler  http.HandlerFunc
+		expected int
+	}{
+		{
+			name: "fast",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "done")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("ok"))
+			},
+			expected: http.StatusCreated,
+		},
+		{
+			name: "stuck",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				w.Header().Set("X-Handler", "done")
+				w.Write([]byte("late"))
+			},
+			expected: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "slow route",
+			timeout: time.Second,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+				w.Header().Set("X-Handler", "done")
+				w.Write([]byte("ok"))
+			},
+			expected: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.withTimeout(tt.timeout, tt.handler)(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.expected {
+				t.Fatalf("expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected != http.StatusServiceUnavailable {
+				if w.Header().Get("X-Handler") != "done" || w.Body.String() != "ok" {
+					t.Errorf("expected the handler's response, got %v %q", w.Header(), w.Body.String())
+				}
+				return
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] == "" {
+				t.Errorf("expected a JSON error, got %q", w.Body.String())
+			}
+			if w.Header().Get("X-Handler") != "" {
+				t.Errorf("expected none of the handler's headers, got %v", w.Header())
+			}
+		})
+	}
+}
+
+// TestWithTimeoutReload tests that a route without its own timeout follows
+// the configured one across reloads
+func TestWithTimeoutReload(t *testing.T) {
+	s := newServer(Config{RequestTimeout: 20 * time.Millisecond})
+	handler := s.withTimeout(0, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+
+	s.state.Update(func(c *Config) { c.RequestTimeout = time.Second })
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the reloaded timeout, got status %d", w.Code)
+	}
+}
+
+// TestNewHTTPServer tests the listener limits, allowing the slowest route to
+// finish writing
+func TestNewHTTPServer(t *testing.T) {
+	hs := newHTTPServer(":8080", http.NotFoundHandler(), Config{RequestTimeout: 5 * time.Minute})
+	if hs.ReadHeaderTimeout != readHeaderTimeout || hs.IdleTimeout != idleTimeout || hs.MaxHeaderBytes != maxHeaderBytes {
+		t.Errorf("expected the listener limits, got %+v", hs)
+	}
+	if hs.WriteTimeout <= 5*time.Minute {
+		t.Errorf("expected a write timeout past the request timeout, got %v", hs.WriteTimeout)
+	}
+	if hs = newHTTPServer(":8080", http.NotFoundHandler(), Config{RequestTimeout: time.Second}); hs.WriteTimeout <= slowRouteTimeout {
+		t.Errorf("expected a write timeout past the slowest route, got %v", hs.WriteTimeout)
+	}
+}
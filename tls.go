@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// Listeners that can require client certificates, set by FORECAST_CLIENT_AUTH
+const (
+	clientAuthMain  = "main"
+	clientAuthAdmin = "admin"
+	clientAuthAll   = "all"
+)
+
+// requiresClientCert reports whether the main or admin listener demands a
+// verified client certificate
+func (c Config) requiresClientCert(admin bool) bool {
+	switch c.ClientAuth {
+	case clientAuthAll:
+		return true
+	case clientAuthAdmin:
+		return admin
+	case clientAuthMain:
+		return !admin
+	default:
+		return false
+	}
+}
+
+// tlsConfig returns the TLS settings of a listener, or nil when TLS is off.
+// With requireClientCert, connections must present a certificate issued by
+// a CA in the client CA bundle.
+func tlsConfig(cfg Config, requireClientCert bool) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if requireClientCert {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", cfg.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+// listen serves handler on addr, over TLS when configured
+func listen(addr string, handler http.Handler, cfg Config, admin bool) error {
+	tc, err := tlsConfig(cfg, cfg.requiresClientCert(admin))
+	if err != nil {
+		return err
+	}
+	hs := newHTTPServer(addr, handler, cfg)
+	hs.TLSConfig = tc
+	if tc == nil {
+		return hs.ListenAndServe()
+	}
+	return hs.ListenAndServeTLS("", "")
+}
+
+// clientCertKey maps a verified client certificate to a key. The common name
+// becomes the owner and organizational units naming a role become its roles;
+// a certificate without any is read-only.
+func clientCertKey(r *http.Request) *APIKey {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	key := &APIKey{ID: "cert:" + cert.Subject.CommonName, Owner: cert.Subject.CommonName}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if slices.Contains(validScopes, ou) {
+			key.Roles = append(key.Roles, ou)
+		}
+	}
+	if len(key.Roles) == 0 {
+		key.Roles = []string{scopeRead}
+	}
+	return key
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, signed by a test CA
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+// issueCert creates a certificate from template, self-signed when parent is nil
+func issueCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, der: der, key: key}
+}
+
+// writePEM writes the certificate and key of c to dir, returning their paths
+func (c *testCert) writePEM(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// TestClientCertAuthentication tests that a listener requiring client
+// certificates rejects clients without one and maps verified ones to keys
+func TestClientCertAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	serverCert := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "forecast"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	adminClient := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ops", OrganizationalUnit: []string{"admin"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	plainClient := issueCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "dashboard"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	untrusted := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, nil)
+
+	cfg := defaultConfig()
+	cfg.TLSCertFile, cfg.TLSKeyFile = serverCert.writePEM(t, dir, "server")
+	cfg.ClientCAFile, _ = ca.writePEM(t, dir, "ca")
+	cfg.ClientAuth = clientAuthAll
+	tc, err := tlsConfig(cfg, cfg.requiresClientCert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer(cfg)
+	ts := httptest.NewUnstartedServer(srv.requireScope(scopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(apiKeyFromContext(r.Context()).Owner))
+	}))
+	ts.TLS = tc
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tests := []struct {
+		name        string
+		cert        *testCert
+		expected    int
+		expectError bool
+	}{
+		{name: "no certificate", expectError: true},
+		{name: "untrusted certificate", cert: untrusted, expectError: true},
+		{name: "admin certificate", cert: adminClient, expected: http.StatusOK},
+		{name: "certificate without roles", cert: plainClient, expected: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS := &tls.Config{RootCAs: roots}
+			if tt.cert != nil {
+				clientTLS.Certificates = []tls.Certificate{tt.cert.tlsCertificate()}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(ts.URL)
+			if tt.expectError {
+				if err == nil {
+					resp.Body.Close()
+					t.Error("expected handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// TestRequiresClientCert tests which listeners demand certificates
+func TestRequiresClientCert(t *testing.T) {
+	tests := []struct {
+		clientAuth  string
+		main, admin bool
+	}{
+		{clientAuth: ""},
+		{clientAuth: clientAuthMain, main: true},
+		{clientAuth: clientAuthAdmin, admin: true},
+		{clientAuth: clientAuthAll, main: true, admin: true},
+	}
+	for _, tt := range tests {
+		cfg := Config{ClientAuth: tt.clientAuth}
+		if cfg.requiresClientCert(false) != tt.main || cfg.requiresClientCert(true) != tt.admin {
+			t.Errorf("%q: expected main=%v admin=%v", tt.clientAuth, tt.main, tt.admin)
+		}
+	}
+}
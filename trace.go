@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// traceContext identifies the work that caused an action, such as the request
+// or scheduled evaluation behind a webhook delivery. TraceID and SpanID follow
+// W3C Trace Context; RequestID is echoed in X-Request-ID.
+type traceContext struct {
+	TraceID   string
+	SpanID    string
+	Flags     string
+	State     string
+	RequestID string
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newTrace starts a trace with a new request ID, for work no request caused
+func newTrace() traceContext {
+	return traceContext{TraceID: randomHex(16), SpanID: randomHex(8), Flags: "01", RequestID: randomHex(8)}
+}
+
+// child returns a new span of the same trace
+func (t traceContext) child() traceContext {
+	t.SpanID = randomHex(8)
+	return t
+}
+
+// traceparent formats the traceparent header of the trace's span
+func (t traceContext) traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// parseTraceparent reads a traceparent header, reporting whether it was valid.
+// Fields after the flags, which later versions may add, are ignored.
+func parseTraceparent(v string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceContext{}, false
+	}
+	t := traceContext{TraceID: parts[1], SpanID: parts[2], Flags: parts[3]}
+	for _, f := range []struct {
+		value  string
+		length int
+	}{{parts[0], 2}, {t.TraceID, 32}, {t.SpanID, 16}, {t.Flags, 2}} {
+		if len(f.value) != f.length || strings.Trim(f.value, "0123456789abcdef") != "" {
+			return traceContext{}, false
+		}
+	}
+	if strings.Trim(t.TraceID, "0") == "" || strings.Trim(t.SpanID, "0") == "" {
+		return traceContext{}, false
+	}
+	return t, true
+}
+
+// validRequestID reports whether a client's request ID is short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// withTrace returns a context carrying a trace
+func withTrace(ctx context.Context, t traceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey, t)
+}
+
+// traceFromContext returns the trace of a context, if any
+func traceFromContext(ctx context.Context) (traceContext, bool) {
+	t, ok := ctx.Value(traceContextKey).(traceContext)
+	return t, ok
+}
+
+// traced wraps every route so requests carry a trace, continuing the caller's
+// traceparent and X-Request-ID when they're valid. The request ID is echoed in
+// the response.
+func traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if ok {
+			t.State = r.Header.Get("tracestate")
+			t = t.child()
+		} else {
+			t = newTrace()
+		}
+		if id := r.Header.Get("X-Request-ID"); validRequestID(id) {
+			t.RequestID = id
+		} else if t.RequestID == "" {
+			t.RequestID = randomHex(8)
+		}
+		w.Header().Set("X-Request-ID", t.RequestID)
+		next.ServeHTTP(w, r.WithContext(withTrace(r.Context(), t)))
+	})
+}
+
+// setTraceHeaders adds the trace of ctx to an outgoing request as a new span,
+// so the receiver can correlate it with the work that caused it
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	t, ok := traceFromContext(ctx)
+	if !ok {
+		return
+	}
+	t = t.child()
+	req.Header.Set("traceparent", t.traceparent())
+	if t.State != "" {
+		req.Header.Set("tracestate", t.State)
+	}
+	req.Header.Set("X-Request-ID", t.RequestID)
+}
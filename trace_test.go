@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseTraceparent tests reading W3C traceparent headers
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected bool
+	}{
+		{name: "valid", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expected: true},
+		{name: "later version with more fields", header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", expected: true},
+		{name: "version 00 with more fields", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "invalid version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{name: "short trace ID", header: "00-4bf92f35-00f067aa0ba902b7-01"},
+		{name: "empty", header: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTraceparent(tt.header)
+			if ok != tt.expected {
+				t.Fatalf("expected valid %v, got %v", tt.expected, ok)
+			}
+			if ok && (got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID != "00f067aa0ba902b7") {
+				t.Errorf("unexpected trace %+v", got)
+			}
+		})
+	}
+}
+
+// TestTraced tests that requests continue the caller's trace and request ID,
+// or start new ones
+func TestTraced(t *testing.T) {
+	var got traceContext
+	handler := traced(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = traceFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=value")
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID == "00f067aa0ba902b7" || got.State != "vendor=value" || got.RequestID != "req-123" {
+		t.Errorf("expected a child of the caller's trace, got %+v", got)
+	}
+	if w.Header().Get("X-Request-ID") != "req-123" {
+		t.Errorf("expected the request ID to be echoed, got %q", w.Header().Get("X-Request-ID"))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "garbage")
+	req.Header.Set("X-Request-ID", "has spaces")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if _, ok := parseTraceparent(got.traceparent()); !ok || got.RequestID == "has spaces" || len(got.RequestID) != 16 {
+		t.Errorf("expected a new trace, got %+v", got)
+	}
+	if w.Header().Get("X-Request-ID") != got.RequestID {
+		t.Errorf("expected request ID %s to be echoed, got %q", got.RequestID, w.Header().Get("X-Request-ID"))
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// forecastTransform adjusts a forecast response before it's rendered, given
+// the period it was built from. Transforms may change any field, such as
+// replacing a category with one of their own.
+type forecastTransform func(p weatherPeriod, out *ForecastOutput)
+
+// transforms holds the transforms compiled into the server by name. An
+// extension registers its transforms from an init function in a file of its
+// own, so deployments add them without changing the rest of the server, and
+// FORECAST_TRANSFORMS picks which ones run.
+var transforms = map[string]forecastTransform{}
+
+// registerTransform makes a transform available to FORECAST_TRANSFORMS. It
+// panics when the name is taken, since that's a mistake in the build.
+func registerTransform(name string, t forecastTransform) {
+	if _, ok := transforms[name]; ok {
+		panic(fmt.Sprintf("transform %q registered twice", name))
+	}
+	transforms[name] = t
+}
+
+// parseTransforms splits a comma-separated list of transform names, checking
+// each is registered
+func parseTransforms(list string) ([]string, error) {
+	names := []string{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := transforms[name]; !ok {
+			return nil, fmt.Errorf("unknown transform %q (want one of %s)", name, strings.Join(slices.Sorted(maps.Keys(transforms)), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// applyTransforms runs the configured transforms over out, in the order
+// they're listed
+func (s *server) applyTransforms(p weatherPeriod, out *ForecastOutput) {
+	// The list was checked when the configuration was loaded
+	names, _ := parseTransforms(s.state.Config().Transforms)
+	for _, name := range names {
+		transforms[name](p, out)
+	}
+}
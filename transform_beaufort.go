@@ -0,0 +1,20 @@
+package main
+
+// beaufortScale buckets sustained wind speeds in km/h by the Beaufort scale
+var beaufortScale = categoryScale{
+	Bounds: []int{0, 5, 11, 19, 28, 38, 49, 61, 74, 88, 102, 117},
+	Labels: []string{
+		"calm", "light air", "light breeze", "gentle breeze", "moderate breeze", "fresh breeze", "strong breeze",
+		"near gale", "gale", "strong gale", "storm", "violent storm", "hurricane force",
+	},
+}
+
+// The beaufort transform describes the wind by its Beaufort force, as marine
+// forecasts do, in place of the calm/breezy/windy/strong categories
+func init() {
+	registerTransform("beaufort", func(p weatherPeriod, out *ForecastOutput) {
+		if p.WindSpeedKPH != nil {
+			out.Wind = beaufortScale.category(roundInt(*p.WindSpeedKPH))
+		}
+	})
+}
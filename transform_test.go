@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseTransforms tests reading the list of transforms to apply
+func TestParseTransforms(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []string
+		err      bool
+	}{
+		{list: "", expected: []string{}},
+		{list: "beaufort", expected: []string{"beaufort"}},
+		{list: " beaufort, ", expected: []string{"beaufort"}},
+		{list: "beaufort,fire-danger", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			names, err := parseTransforms(tt.list)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(names) != len(tt.expected) || (len(names) > 0 && names[0] != tt.expected[0]) {
+				t.Errorf("expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+// TestForecastTransforms tests applying registered transforms to forecast
+// responses in the configured order
+func TestForecastTransforms(t *testing.T) {
+	registerTransform("test-shout", func(p weatherPeriod, out *ForecastOutput) {
+		out.Forecast += "!"
+	})
+	t.Cleanup(func() { delete(transforms, "test-shout") })
+
+	tests := []struct {
+		name             string
+		transforms       string
+		expectedForecast string
+		expectedWind     string
+	}{
+		{name: "none", expectedForecast: "Sunny", expectedWind: "windy"},
+		{name: "beaufort", transforms: "beaufort", expectedForecast: "Sunny", expectedWind: "fresh breeze"},
+		{name: "several", transforms: "test-shout,beaufort,test-shout", expectedForecast: "Sunny!!", expectedWind: "fresh breeze"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost, Transforms: tt.transforms})
+			srv.nws = newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 64, "shortForecast": "Sunny", "windSpeed": "20 mph"}]}}`})
+			w := httptest.NewRecorder()
+			srv.forecastHandler(w, httptest.NewRequest("GET", "/forecast?latitude=47.6062&longitude=-122.3321", nil))
+			var response ForecastOutput
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Forecast != tt.expectedForecast || response.Wind != tt.expectedWind {
+				t.Errorf("expected %q with %q wind, got %q with %q wind", tt.expectedForecast, tt.expectedWind, response.Forecast, response.Wind)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Forecast text is translated by a provider when a client asks for a language
+// other than English with ?lang=, and translations are cached by
+// cachingTranslator since the same few phrases recur across every forecast.
+const (
+	// translationCacheTTL is how long a translated phrase is reused
+	translationCacheTTL = 7 * 24 * time.Hour
+	// translationCacheSize bounds the number of cached phrases
+	translationCacheSize = 10000
+)
+
+// translationFailures counts phrases served untranslated because the provider
+// failed
+var translationFailures = expvar.NewInt("forecast_translation_failures")
+
+// langPattern matches the language tags accepted by ?lang=, such as es or
+// pt-BR
+var langPattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})?$`)
+
+// translationClient calls the translation provider
+var translationClient = &http.Client{Timeout: 10 * time.Second}
+
+// translator translates English forecast text into a language
+type translator interface {
+	translate(ctx context.Context, text, lang string) (string, error)
+}
+
+// parseLang reads the lang parameter, returning "" when it's absent or
+// English, which needs no translation
+func parseLang(r *http.Request) (string, error) {
+	lang := r.URL.Query().Get("lang")
+	if lang == "" {
+		return "", nil
+	}
+	if !langPattern.MatchString(lang) {
+		return "", fmt.Errorf("Invalid lang parameter (want a language tag such as es or pt-BR)")
+	}
+	if primary, _, _ := strings.Cut(strings.ToLower(lang), "-"); primary == "en" {
+		return "", nil
+	}
+	return lang, nil
+}
+
+// libreTranslator translates with a LibreTranslate server
+type libreTranslator struct {
+	client   doer
+	endpoint string
+	apiKey   string
+}
+
+func (l libreTranslator) translate(ctx context.Context, text, lang string) (string, error) {
+	// LibreTranslate names languages by their primary subtag, except Chinese
+	target, region, _ := strings.Cut(strings.ToLower(lang), "-")
+	if target == "zh" && (region == "tw" || region == "hant") {
+		target = "zt"
+	}
+	body, err := json.Marshal(map[string]string{"q": text, "source": "en", "target": target, "format": "text", "api_key": l.apiKey})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(l.endpoint, "/")+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return "", fmt.Errorf("translation provider returned status: %d", resp.StatusCode)
+	}
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse translation: %v", err)
+	}
+	if result.TranslatedText == "" {
+		return "", fmt.Errorf("translation provider returned no text")
+	}
+	return result.TranslatedText, nil
+}
+
+// translationEntry is a cached translation
+type translationEntry struct {
+	text    string
+	expires time.Time
+}
+
+// cachingTranslator caches a provider's translations by language and text.
+// Failures aren't cached.
+type cachingTranslator struct {
+	provider translator
+	clock    clock
+
+	mu      sync.Mutex
+	entries map[string]translationEntry
+}
+
+func newCachingTranslator(provider translator, clk clock) *cachingTranslator {
+	return &cachingTranslator{provider: provider, clock: clk, entries: map[string]translationEntry{}}
+}
+
+// newTranslator returns the translator configured by cfg, or nil when
+// translation is disabled
+func newTranslator(cfg Config, clk clock) translator {
+	if cfg.TranslateURL == "" {
+		return nil
+	}
+	return newCachingTranslator(libreTranslator{client: translationClient, endpoint: cfg.TranslateURL, apiKey: cfg.TranslateAPIKey}, clk)
+}
+
+func (c *cachingTranslator) translate(ctx context.Context, text, lang string) (string, error) {
+	key := strings.ToLower(lang) + "\x00" + text
+	now := c.clock.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.text, nil
+	}
+
+	translated, err := c.provider.translate(ctx, text, lang)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= translationCacheSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) || len(c.entries) >= translationCacheSize {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = translationEntry{text: translated, expires: now.Add(translationCacheTTL)}
+	return translated, nil
+}
+
+// translateTexts translates texts in place into lang, reporting whether they
+// were. Texts are left in English when lang is "", translation isn't
+// configured, or the provider fails.
+func (s *server) translateTexts(ctx context.Context, lang string, texts ...*string) bool {
+	if lang == "" || s.translator == nil {
+		return false
+	}
+	translated := make([]string, len(texts))
+	for i, text := range texts {
+		if *text == "" {
+			continue
+		}
+		t, err := s.translator.translate(ctx, *text, lang)
+		if err != nil {
+			translationFailures.Add(1)
+			log.Printf("Failed to translate forecast into %s: %v", lang, err)
+			return false
+		}
+		translated[i] = t
+	}
+	for i, text := range texts {
+		if *text != "" {
+			*text = translated[i]
+		}
+	}
+	return true
+}
+
+// setContentLanguage names the language of a response's forecast text when
+// the client asked for one
+func setContentLanguage(w http.ResponseWriter, lang string, translated bool) {
+	if translated {
+		w.Header().Set("Content-Language", lang)
+	} else if lang != "" {
+		w.Header().Set("Content-Language", "en")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestParseLang tests reading the lang parameter
+func TestParseLang(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		wantErr  bool
+	}{
+		{query: ""},
+		{query: "lang=en"},
+		{query: "lang=en-GB"},
+		{query: "lang=es", expected: "es"},
+		{query: "lang=pt-BR", expected: "pt-BR"},
+		{query: "lang=zh-Hant", expected: "zh-Hant"},
+		{query: "lang=spanish", wantErr: true},
+		{query: "lang=es_MX", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := parseLang(httptest.NewRequest("GET", "/forecast?"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// fakeTranslator translates by prefixing the language, failing when err is set
+type fakeTranslator struct {
+	calls int
+	err   error
+}
+
+func (f *fakeTranslator) translate(ctx context.Context, text, lang string) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return lang + ":" + text, nil
+}
+
+// TestCachingTranslator tests caching translations per language until they
+// expire, without caching failures
+func TestCachingTranslator(t *testing.T) {
+	provider := &fakeTranslator{}
+	clk := newFakeClock(time.Now())
+	c := newCachingTranslator(provider, clk)
+	ctx := context.Background()
+
+	for range 2 {
+		if got, err := c.translate(ctx, "Sunny", "es"); err != nil || got != "es:Sunny" {
+			t.Fatalf("unexpected translation %q (%v)", got, err)
+		}
+	}
+	c.translate(ctx, "Sunny", "fr")
+	if provider.calls != 2 {
+		t.Errorf("expected one call per language, got %d", provider.calls)
+	}
+	clk.Advance(translationCacheTTL)
+	c.translate(ctx, "Sunny", "es")
+	if provider.calls != 3 {
+		t.Errorf("expected the translation to expire, got %d calls", provider.calls)
+	}
+
+	provider.err = errors.New("connection refused")
+	for range 2 {
+		if _, err := c.translate(ctx, "Rain", "es"); err == nil {
+			t.Fatal("expected provider error")
+		}
+	}
+	if provider.calls != 5 {
+		t.Errorf("expected failures to be retried, got %d calls", provider.calls)
+	}
+}
+
+// TestForecastTranslation tests translating forecast text with a
+// LibreTranslate server, and serving English when it fails
+func TestForecastTranslation(t *testing.T) {
+	var mu sync.Mutex
+	var requests []map[string]string
+	status := http.StatusOK
+	libre := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+		if r.URL.Path != "/translate" || status != http.StatusOK {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"translatedText": "Soleado"})
+	}))
+	defer libre.Close()
+	mockNWS := createMockNWSServer(http.StatusOK, http.StatusOK, `{"properties": {"periods": [{"temperature": 72, "shortForecast": "Sunny"}]}}`)
+	defer mockNWS.Close()
+	handler := newServer(Config{NWSAPIHost: mockNWS.URL, TranslateURL: libre.URL + "/", TranslateAPIKey: "k3y"}).routes()
+
+	get := func(query string) (*httptest.ResponseRecorder, ForecastOutput) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/forecast?latitude=39.7456&longitude=-97.0892"+query, nil))
+		var out ForecastOutput
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w, out
+	}
+
+	w, out := get("&lang=es")
+	if w.Code != http.StatusOK || out.Forecast != "Soleado" || w.Header().Get("Content-Language") != "es" {
+		t.Fatalf("expected a Spanish forecast, got %d %+v %q", w.Code, out, w.Header().Get("Content-Language"))
+	}
+	get("&lang=es")
+	mu.Lock()
+	if len(requests) != 1 || requests[0]["q"] != "Sunny" || requests[0]["target"] != "es" || requests[0]["api_key"] != "k3y" {
+		t.Errorf("expected one cached request to the provider, got %+v", requests)
+	}
+	status = http.StatusServiceUnavailable
+	mu.Unlock()
+
+	w, out = get("&lang=fr")
+	if w.Code != http.StatusOK || out.Forecast != "Sunny" || w.Header().Get("Content-Language") != "en" {
+		t.Errorf("expected English when translation fails, got %d %+v %q", w.Code, out, w.Header().Get("Content-Language"))
+	}
+	if w, out = get(""); out.Forecast != "Sunny" || w.Header().Get("Content-Language") != "" {
+		t.Errorf("expected English without lang, got %+v %q", out, w.Header().Get("Content-Language"))
+	}
+	if w, _ = get("&lang=" + strings.Repeat("x", 20)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid lang, got %d", w.Code)
+	}
+}
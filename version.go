@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build details, set at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// Unset values are filled in from the build information Go embeds.
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	// Modified is set when the binary was built from a tree with uncommitted
+	// changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// build is the build information of this binary
+var build = readBuildInfo()
+
+// readBuildInfo combines the link-time build details with the module and VCS
+// information recorded by the Go toolchain
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = setting.Value
+			}
+		case "vcs.time":
+			if b.BuildTime == "" {
+				b.BuildTime = setting.Value
+			}
+		case "vcs.modified":
+			b.Modified = setting.Value == "true"
+		}
+	}
+	return b
+}
+
+// String describes the build for logs, such as
+// "forecast v1.2.0 (commit 1a2b3c4d5e6f, built 2024-06-01T12:00:00Z)"
+func (b buildInfo) String() string {
+	s := "forecast " + b.Version
+	if b.Commit != "" {
+		c := b.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if b.Modified {
+			c += "-dirty"
+		}
+		s += " (commit " + c
+		if b.BuildTime != "" {
+			s += ", built " + b.BuildTime
+		}
+		s += ")"
+	}
+	return s
+}
+
+// versionResponse is the body of /version
+type versionResponse struct {
+	buildInfo
+	Features indexFeatures `json:"features"`
+}
+
+// versionHandler reports the build of the running server and the features
+// enabled in its configuration
+func (s *server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, versionResponse{buildInfo: build, Features: s.features()})
+}
+
+// runVersionCommand prints the build of the binary
+func runVersionCommand(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("version", flag.ContinueOnError)
+	fset.SetOutput(out)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, build)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBuildInfoString tests describing a build for logs
+func TestBuildInfoString(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     buildInfo
+		expected string
+	}{
+		{name: "no commit", info: buildInfo{Version: "dev"}, expected: "forecast dev"},
+		{
+			name:     "release",
+			info:     buildInfo{Version: "v1.2.0", Commit: "1a2b3c4d5e6f7a8b9c0d", BuildTime: "2024-06-01T12:00:00Z"},
+			expected: "forecast v1.2.0 (commit 1a2b3c4d5e6f, built 2024-06-01T12:00:00Z)",
+		},
+		{name: "modified", info: buildInfo{Version: "dev", Commit: "abc123", Modified: true}, expected: "forecast dev (commit abc123-dirty)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestVersionEndpoint tests reporting the build and features without credentials
+func TestVersionEndpoint(t *testing.T) {
+	handler := newServer(Config{AuthRequired: true, OIDCIssuer: "https://issuer.example.com"}).routes()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp versionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Version != build.Version || resp.GoVersion == "" {
+		t.Errorf("unexpected build %+v", resp.buildInfo)
+	}
+	if !resp.Features.AuthRequired || !resp.Features.OIDC {
+		t.Errorf("unexpected features %+v", resp.Features)
+	}
+
+	var out bytes.Buffer
+	if err := runVersionCommand(nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "forecast "+build.Version) {
+		t.Errorf("unexpected version output %q", out.String())
+	}
+	if !strings.HasPrefix(userAgent, "forecast/"+build.Version+" (") {
+		t.Errorf("expected the User-Agent to name the build, got %q", userAgent)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Rules clients compile to WASM run in wazero's interpreter, which validates a
+// module before any of it runs. Modules can't import anything, so a rule has
+// nothing to call outside its own memory, and memory is limited to
+// maxWASMPages. A request's rules stop when its share of the caller's run time
+// is spent, and each API key may spend FORECAST_WASM_BUDGET a minute, so a
+// rule can't hang or exhaust the server.
+
+const (
+	// maxWASMModuleSize bounds the size of a module
+	maxWASMModuleSize = 64 << 10
+	// maxWASMPages bounds the memory of an instance, in 64 KiB pages
+	maxWASMPages = 16
+	// maxWASMTableSize bounds the maximum size modules must give their tables
+	maxWASMTableSize = 1 << 12
+	// maxWASMLocals bounds the locals of a function
+	maxWASMLocals = 50000
+	// maxWASMRunTime bounds the time a request's WASM rules run, whatever is
+	// left of the caller's budget
+	maxWASMRunTime = 250 * time.Millisecond
+)
+
+// WASM value types
+const (
+	wasmI32 = api.ValueTypeI32
+	wasmF64 = api.ValueTypeF64
+)
+
+var (
+	// errWASMRunTime is returned when a request's rules run out of time
+	errWASMRunTime = errors.New("wasm: run time limit exceeded")
+	// wasmRunSeconds counts the run time of WASM rules charged to each API
+	// key
+	wasmRunSeconds = expvar.NewMap("forecast_wasm_run_seconds")
+)
+
+// wasmError is a malformed or unsupported module, or a trap while running one
+type wasmError string
+
+func (e wasmError) Error() string { return "wasm: " + string(e) }
+
+// wasmFuncType is the signature of a function
+type wasmFuncType struct {
+	params, results []api.ValueType
+}
+
+// wasmRuntime holds the modules of a request, which share its context and
+// are closed together
+type wasmRuntime struct {
+	ctx     context.Context
+	runtime wazero.Runtime
+}
+
+// newWASMRuntime returns a runtime whose modules stop running once ctx is done
+func newWASMRuntime(ctx context.Context) *wasmRuntime {
+	cfg := wazero.NewRuntimeConfigInterpreter().
+		WithMemoryLimitPages(maxWASMPages).
+		WithCloseOnContextDone(true)
+	return &wasmRuntime{ctx: ctx, runtime: wazero.NewRuntimeWithConfig(ctx, cfg)}
+}
+
+// close frees the runtime's modules
+func (rt *wasmRuntime) close() {
+	rt.runtime.Close(context.WithoutCancel(rt.ctx))
+}
+
+// wasmModule is an instance of a module, with its own memory. It isn't safe
+// for concurrent use.
+type wasmModule struct {
+	rt     *wasmRuntime
+	module api.Module
+}
+
+// compile validates a module and instantiates it, running its start function
+// if it has one. Modules that import anything are rejected.
+func (rt *wasmRuntime) compile(b []byte) (*wasmModule, error) {
+	if len(b) > maxWASMModuleSize {
+		return nil, wasmError(fmt.Sprintf("module is larger than %d bytes", maxWASMModuleSize))
+	}
+	b, err := checkWASMSections(b)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := rt.runtime.CompileModule(rt.ctx, b)
+	if err != nil {
+		return nil, rt.error(err)
+	}
+	module, err := rt.runtime.InstantiateModule(rt.ctx, compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions())
+	if err != nil {
+		return nil, rt.error(err)
+	}
+	return &wasmModule{rt: rt, module: module}, nil
+}
+
+// error turns an error of wazero into a wasmError, or errWASMRunTime when the
+// runtime's time ran out
+func (rt *wasmRuntime) error(err error) error {
+	if rt.ctx.Err() != nil {
+		return errWASMRunTime
+	}
+	return wasmError(err.Error())
+}
+
+// wasmSectionNames names the sections of a module by ID
+var wasmSectionNames = [...]string{"custom", "type", "import", "function", "table", "memory", "global", "export", "start", "element", "code", "data", "data count"}
+
+// checkWASMSections reads the sections of a module ahead of wazero, which
+// allocates as many entries as a vector says it has before reading any of
+// them. It refuses vectors with more entries than there are bytes left to hold
+// them, imports, functions with more than maxWASMLocals locals, and tables
+// that could grow past maxWASMTableSize, and drops custom sections, which rules
+// have no use for. Modules without the WASM header are left to wazero to
+// reject.
+func checkWASMSections(b []byte) ([]byte, error) {
+	if len(b) < 8 || string(b[:8]) != "\x00asm\x01\x00\x00\x00" {
+		return b, nil
+	}
+	checked := slices.Clone(b[:8])
+	r := wasmReader{b: b[8:]}
+	for len(r.b) > 0 {
+		start := r.b
+		id := r.byte()
+		body := r.bytes(r.leb())
+		if r.bad {
+			return nil, wasmError("section is truncated")
+		}
+		if int(id) >= len(wasmSectionNames) {
+			return nil, wasmError(fmt.Sprintf("unknown section %d", id))
+		}
+		if id == 0 {
+			continue
+		}
+		if err := checkWASMSection(id, &wasmReader{b: body}); err != nil {
+			return nil, err
+		}
+		checked = append(checked, start[:len(start)-len(r.b)]...)
+	}
+	return checked, nil
+}
+
+// checkWASMSection reads the body of a section with the given ID
+func checkWASMSection(id byte, r *wasmReader) error {
+	switch id {
+	case 1: // type
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			if r.byte() != 0x60 {
+				r.bad = true
+			}
+			r.bytes(r.count()) // params
+			r.bytes(r.count()) // results
+		}
+	case 2: // import
+		if r.count() > 0 {
+			return wasmError("modules can't import anything")
+		}
+	case 3, 5, 6: // function, memory, global
+		r.count()
+	case 4: // table
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			r.byte() // reference type
+			hasMax := r.leb() == 1
+			r.leb() // min
+			if !hasMax || r.leb() > maxWASMTableSize {
+				return wasmError(fmt.Sprintf("tables need a maximum size of at most %d", maxWASMTableSize))
+			}
+		}
+	case 7: // export
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			r.bytes(r.leb()) // name
+			r.byte()         // kind
+			r.leb()          // index
+		}
+	case 9: // element
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			flags := r.leb()
+			if flags > 7 {
+				r.bad = true
+				break
+			}
+			if flags == 2 || flags == 6 {
+				r.leb() // table
+			}
+			if flags&1 == 0 {
+				r.expr() // offset
+			}
+			if flags != 0 && flags != 4 {
+				r.byte() // element kind or reference type
+			}
+			for j := r.count(); j > 0 && !r.bad; j-- {
+				if flags < 4 {
+					r.leb() // function
+				} else {
+					r.expr()
+				}
+			}
+		}
+	case 10: // code
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			code := wasmReader{b: r.bytes(r.leb())}
+			var locals uint64
+			for j := code.count(); j > 0 && !code.bad; j-- {
+				locals += code.leb()
+				code.byte() // type
+			}
+			if locals > maxWASMLocals {
+				return wasmError(fmt.Sprintf("function has more than %d locals", maxWASMLocals))
+			}
+			r.bad = r.bad || code.bad
+		}
+	case 11: // data
+		for i := r.count(); i > 0 && !r.bad; i-- {
+			switch r.leb() {
+			case 0:
+				r.expr() // offset
+			case 1:
+			case 2:
+				r.leb()  // memory
+				r.expr() // offset
+			default:
+				r.bad = true
+			}
+			r.bytes(r.leb())
+		}
+	}
+	if r.bad {
+		return wasmError(fmt.Sprintf("malformed %s section", wasmSectionNames[id]))
+	}
+	return nil
+}
+
+// wasmReader reads the binary format of a module. Reading past its end or
+// anything it doesn't expect makes it bad.
+type wasmReader struct {
+	b   []byte
+	bad bool
+}
+
+func (r *wasmReader) byte() byte {
+	if len(r.b) == 0 {
+		r.bad = true
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *wasmReader) bytes(n uint64) []byte {
+	if n > uint64(len(r.b)) {
+		r.bad = true
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// leb reads a LEB128 number, which skips signed ones as well
+func (r *wasmReader) leb() uint64 {
+	var n uint64
+	for shift := 0; shift < 70 && !r.bad; shift += 7 {
+		c := r.byte()
+		n |= uint64(c&0x7F) << shift
+		if c&0x80 == 0 {
+			return n
+		}
+	}
+	r.bad = true
+	return n
+}
+
+// count reads the length of a vector, whose entries take a byte each at least
+func (r *wasmReader) count() uint64 {
+	n := r.leb()
+	if n > uint64(len(r.b)) {
+		r.bad = true
+	}
+	return n
+}
+
+// expr reads a constant expression
+func (r *wasmReader) expr() {
+	for !r.bad {
+		switch r.byte() {
+		case 0x0B: // end
+			return
+		case 0x23, 0x41, 0x42, 0xD2: // global.get, i32.const, i64.const, ref.func
+			r.leb()
+		case 0x43: // f32.const
+			r.bytes(4)
+		case 0x44: // f64.const
+			r.bytes(8)
+		case 0xD0: // ref.null
+			r.byte()
+		case 0xFD: // v128.const
+			if r.leb() != 12 {
+				r.bad = true
+			}
+			r.bytes(16)
+		default:
+			r.bad = true
+		}
+	}
+}
+
+// export returns an exported function with the given signature
+func (m *wasmModule) export(name string, typ wasmFuncType) (api.Function, error) {
+	f := m.module.ExportedFunction(name)
+	if f == nil {
+		return nil, wasmError(fmt.Sprintf("module doesn't export %s", name))
+	}
+	def := f.Definition()
+	if !slices.Equal(def.ParamTypes(), typ.params) || !slices.Equal(def.ResultTypes(), typ.results) {
+		return nil, wasmError(fmt.Sprintf("%s has the wrong signature", name))
+	}
+	return f, nil
+}
+
+// run calls a function of the module, turning traps into errors
+func (m *wasmModule) run(f api.Function, args ...uint64) ([]uint64, error) {
+	results, err := f.Call(m.rt.ctx, args...)
+	if err != nil {
+		return nil, m.rt.error(err)
+	}
+	return results, nil
+}
+
+func wasmBool(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// wasmBudget holds the run time of WASM rules left to each API key, refilled
+// at a rate of perMinute a minute
+type wasmBudget struct {
+	mu sync.Mutex
+	// perMinute is the budget the buckets were made for
+	perMinute time.Duration
+	// buckets hold seconds of run time
+	buckets map[string]*tokenBucket
+}
+
+// left returns the run time left to key, or when there's none, how long until
+// there is. A changed budget starts every key afresh.
+func (b *wasmBudget) left(key string, perMinute time.Duration, now time.Time) (time.Duration, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bucket := b.bucket(key, perMinute, now)
+	bucket.refill(now)
+	if bucket.tokens <= 0 {
+		return 0, time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+	}
+	return time.Duration(bucket.tokens * float64(time.Second)), 0
+}
+
+// charge spends run time from key's budget, which goes into debt when spent
+// runs past what was left
+func (b *wasmBudget) charge(key string, perMinute, spent time.Duration, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(key, perMinute, now).charge(now, spent.Seconds())
+	wasmRunSeconds.AddFloat(key, spent.Seconds())
+}
+
+func (b *wasmBudget) bucket(key string, perMinute time.Duration, now time.Time) *tokenBucket {
+	if b.buckets == nil || b.perMinute != perMinute {
+		b.perMinute = perMinute
+		b.buckets = make(map[string]*tokenBucket)
+	}
+	bucket, ok := b.buckets[key]
+	if !ok {
+		if len(b.buckets) >= maxRateLimitClients {
+			// Keys whose buckets have refilled are as good as new
+			for k, other := range b.buckets {
+				if other.refill(now); other.tokens >= other.burst {
+					delete(b.buckets, k)
+				}
+			}
+			if len(b.buckets) >= maxRateLimitClients {
+				b.buckets = make(map[string]*tokenBucket)
+			}
+		}
+		bucket = newTokenBucket(perMinute.Seconds()/60, perMinute.Seconds(), now)
+		b.buckets[key] = bucket
+	}
+	return bucket
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// testWASMFunc is a function of a module built by buildWASM
+type testWASMFunc struct {
+	params, results, locals []api.ValueType
+	body                    []byte
+	export                  string
+}
+
+func wasmULEB(n uint64) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7F)
+		if n >>= 7; n != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func wasmVec(items ...[]byte) []byte {
+	b := wasmULEB(uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func wasmSection(id byte, content []byte) []byte {
+	return append(append([]byte{id}, wasmULEB(uint64(len(content)))...), content...)
+}
+
+// buildWASM assembles a module of functions, each with a type of its own, and
+// a memory of pages if pages isn't negative
+func buildWASM(pages int, funcs ...testWASMFunc) []byte {
+	var types, indices, exports, codes [][]byte
+	for i, f := range funcs {
+		types = append(types, append(append([]byte{0x60}, wasmVec(splitBytes(f.params)...)...), wasmVec(splitBytes(f.results)...)...))
+		indices = append(indices, wasmULEB(uint64(i)))
+		if f.export != "" {
+			exports = append(exports, append(append(wasmVec(splitBytes([]byte(f.export))...), 0), wasmULEB(uint64(i))...))
+		}
+		var locals [][]byte
+		for _, l := range f.locals {
+			locals = append(locals, []byte{1, l})
+		}
+		code := append(wasmVec(locals...), f.body...)
+		codes = append(codes, append(wasmULEB(uint64(len(code))), code...))
+	}
+	m := []byte("\x00asm\x01\x00\x00\x00")
+	m = append(m, wasmSection(1, wasmVec(types...))...)
+	m = append(m, wasmSection(3, wasmVec(indices...))...)
+	if pages >= 0 {
+		m = append(m, wasmSection(5, wasmVec(append([]byte{0}, wasmULEB(uint64(pages))...)))...)
+	}
+	m = append(m, wasmSection(7, wasmVec(exports...))...)
+	return append(m, wasmSection(10, wasmVec(codes...))...)
+}
+
+func splitBytes(b []byte) [][]byte {
+	items := make([][]byte, len(b))
+	for i := range b {
+		items[i] = b[i : i+1]
+	}
+	return items
+}
+
+// compileTestWASM compiles a module into a runtime that gives up after a
+// second
+func compileTestWASM(t testing.TB, b []byte) (*wasmModule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	rt := newWASMRuntime(ctx)
+	t.Cleanup(func() {
+		rt.close()
+		cancel()
+	})
+	return rt.compile(b)
+}
+
+// TestWASM tests running functions and trapping those that misbehave
+func TestWASM(t *testing.T) {
+	i32, i64, f64 := wasmI32, api.ValueTypeI64, wasmF64
+	tests := []struct {
+		name     string
+		f        testWASMFunc
+		args     []uint64
+		expected uint64
+		err      string
+	}{
+		{
+			name:     "add",
+			f:        testWASMFunc{params: []byte{i32, i32}, results: []byte{i32}, body: []byte{0x20, 0, 0x20, 1, 0x6A, 0x0B}},
+			args:     []uint64{2, 3},
+			expected: 5,
+		},
+		{
+			name: "loop",
+			// acc = 1; while n != 0 { acc *= n; n-- }
+			f: testWASMFunc{params: []byte{i64}, results: []byte{i64}, locals: []byte{i64}, body: []byte{
+				0x42, 1, 0x21, 1,
+				0x02, 0x40, 0x03, 0x40,
+				0x20, 0, 0x50, 0x0D, 1,
+				0x20, 1, 0x20, 0, 0x7E, 0x21, 1,
+				0x20, 0, 0x42, 1, 0x7D, 0x21, 0,
+				0x0C, 0, 0x0B, 0x0B,
+				0x20, 1, 0x0B,
+			}},
+			args:     []uint64{10},
+			expected: 3628800,
+		},
+		{
+			name: "recursion",
+			// n < 2 ? n : fib(n-1) + fib(n-2)
+			f: testWASMFunc{params: []byte{i32}, results: []byte{i32}, body: []byte{
+				0x20, 0, 0x41, 2, 0x48, 0x04, 0x7F,
+				0x20, 0,
+				0x05,
+				0x20, 0, 0x41, 1, 0x6B, 0x10, 0, 0x20, 0, 0x41, 2, 0x6B, 0x10, 0, 0x6A,
+				0x0B, 0x0B,
+			}},
+			args:     []uint64{15},
+			expected: 610,
+		},
+		{
+			name: "memory",
+			f: testWASMFunc{params: []byte{i32}, results: []byte{i32}, body: []byte{
+				0x41, 8, 0x20, 0, 0x36, 2, 0,
+				0x41, 4, 0x28, 2, 4, 0x0B,
+			}},
+			args:     []uint64{0xDEADBEEF},
+			expected: 0xDEADBEEF,
+		},
+		{
+			name:     "grow past the limit",
+			f:        testWASMFunc{results: []byte{i32}, body: []byte{0x41, 100, 0x40, 0, 0x0B}},
+			expected: math.MaxUint32,
+		},
+		{
+			name:     "saturating truncation",
+			f:        testWASMFunc{params: []byte{f64}, results: []byte{i32}, body: []byte{0x20, 0, 0xFC, 2, 0x0B}},
+			args:     []uint64{math.Float64bits(1e20)},
+			expected: math.MaxInt32,
+		},
+		{
+			name: "unbounded loop",
+			f:    testWASMFunc{body: []byte{0x03, 0x40, 0x0C, 0, 0x0B, 0x0B}},
+			err:  errWASMRunTime.Error(),
+		},
+		{
+			name: "unbounded recursion",
+			f:    testWASMFunc{body: []byte{0x10, 0, 0x0B}},
+			err:  "stack overflow",
+		},
+		{
+			name: "divide by zero",
+			f:    testWASMFunc{results: []byte{i32}, body: []byte{0x41, 1, 0x41, 0, 0x6D, 0x0B}},
+			err:  "integer divide by zero",
+		},
+		{
+			name: "truncation overflow",
+			f:    testWASMFunc{params: []byte{f64}, results: []byte{i32}, body: []byte{0x20, 0, 0xAA, 0x0B}},
+			args: []uint64{math.Float64bits(1e20)},
+			err:  "integer overflow",
+		},
+		{
+			name: "out of bounds",
+			f:    testWASMFunc{results: []byte{i32}, body: []byte{0x41, 0x80, 0x80, 0x04, 0x28, 2, 0, 0x0B}},
+			err:  "out of bounds memory access",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f.export = "f"
+			m, err := compileTestWASM(t, buildWASM(1, tt.f))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			f, err := m.export("f", wasmFuncType{params: tt.f.params, results: tt.f.results})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			results, err := m.run(f, tt.args...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v, %v", tt.err, results, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results) != 1 || results[0] != tt.expected {
+				t.Errorf("expected %d, got %v", tt.expected, results)
+			}
+		})
+	}
+}
+
+// TestWASMBranchTable tests br_table picking a target or its default
+func TestWASMBranchTable(t *testing.T) {
+	m, err := compileTestWASM(t, buildWASM(-1, testWASMFunc{params: []byte{wasmI32}, results: []byte{wasmI32}, export: "f", body: []byte{
+		0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+		0x20, 0, 0x0E, 2, 0, 1, 2,
+		0x0B, 0x41, 10, 0x0F,
+		0x0B, 0x41, 20, 0x0F,
+		0x0B, 0x41, 30, 0x0B,
+	}}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, _ := m.export("f", wasmFuncType{params: []api.ValueType{wasmI32}, results: []api.ValueType{wasmI32}})
+	for arg, expected := range map[uint64]uint64{0: 10, 1: 20, 2: 30, 7: 30} {
+		if results, err := m.run(f, arg); err != nil || results[0] != expected {
+			t.Errorf("br_table %d: expected %d, got %v, %v", arg, expected, results, err)
+		}
+	}
+}
+
+// TestCompileWASMErrors tests rejecting modules the sandbox won't run,
+// including any that fails validation
+func TestCompileWASMErrors(t *testing.T) {
+	valid := buildWASM(-1, testWASMFunc{body: []byte{0x0B}})
+	imports := append(append([]byte("\x00asm\x01\x00\x00\x00"), wasmSection(2, wasmVec(append(append(wasmVec(splitBytes([]byte("env"))...), wasmVec(splitBytes([]byte("f"))...)...), 0, 0)))...), valid[8:]...)
+	i32 := wasmI32
+	manyLocals := append(wasmVec(append(wasmULEB(maxWASMLocals+1), byte(i32))), 0x0B)
+	manyLocals = append(valid[:len(valid)-6], wasmSection(10, wasmVec(append(wasmULEB(uint64(len(manyLocals))), manyLocals...)))...)
+	tests := []struct {
+		name   string
+		module []byte
+		err    string
+	}{
+		{name: "not wasm", module: []byte("hello, world"), err: "invalid magic number"},
+		{name: "truncated", module: valid[:len(valid)-2], err: "section"},
+		{name: "imports", module: imports, err: "can't import"},
+		{name: "vector past its section", module: []byte("\x00asm\x01\x00\x00\x00\x0A\x05\xFF\xFF\xFF\xFF\x0F"), err: "malformed code section"},
+		{name: "too many locals", module: manyLocals, err: "locals"},
+		{name: "table without maximum", module: []byte("\x00asm\x01\x00\x00\x00\x04\x04\x01\x70\x00\x01"), err: "tables need a maximum"},
+		{name: "table too large", module: append([]byte("\x00asm\x01\x00\x00\x00\x04\x06\x01\x70\x01\x01"), wasmULEB(maxWASMTableSize+1)...), err: "tables need a maximum"},
+		{name: "too much memory", module: buildWASM(maxWASMPages+1, testWASMFunc{body: []byte{0x0B}}), err: "over limit"},
+		{name: "stack underflow", module: buildWASM(-1, testWASMFunc{results: []byte{i32}, body: []byte{0x6A, 0x0B}}), err: "invalid function"},
+		{name: "wrong type", module: buildWASM(-1, testWASMFunc{results: []byte{i32}, body: []byte{0x42, 1, 0x0B}}), err: "invalid function"},
+		{name: "branch out of blocks", module: buildWASM(-1, testWASMFunc{body: []byte{0x0C, 5, 0x0B}}), err: "invalid function"},
+		{name: "unterminated block", module: buildWASM(-1, testWASMFunc{body: []byte{0x02, 0x40, 0x0B}}), err: "invalid function"},
+		{name: "too large", module: make([]byte, maxWASMModuleSize+1), err: "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileTestWASM(t, tt.module)
+			var we wasmError
+			if !errors.As(err, &we) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestCompileWASMSections tests compiling modules with sections the sandbox
+// reads ahead of wazero
+func TestCompileWASMSections(t *testing.T) {
+	valid := buildWASM(-1, testWASMFunc{body: []byte{0x0B}})
+	tests := []struct {
+		name   string
+		module []byte
+	}{
+		{name: "custom section", module: append(slices.Clone(valid), wasmSection(0, append(wasmVec(splitBytes([]byte("name"))...), 0xFF, 0xFF, 0xFF, 0xFF, 0x0F))...)},
+		{name: "bounded table", module: []byte("\x00asm\x01\x00\x00\x00\x04\x05\x01\x70\x01\x01\x08")},
+		{name: "data", module: append(buildWASM(1), wasmSection(11, wasmVec([]byte{0, 0x41, 8, 0x0B, 3, 'a', 'b', 'c'}))...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileTestWASM(t, tt.module); err != nil {
+				t.Errorf("expected the module to compile, got %v", err)
+			}
+		})
+	}
+}
+
+// FuzzCompileWASM tests that no module, however malformed, crashes the
+// sandbox compiling it
+func FuzzCompileWASM(f *testing.F) {
+	f.Add(buildWASM(-1, testWASMFunc{body: []byte{0x0B}}))
+	f.Add(buildWASM(1, testWASMFunc{params: []byte{wasmI32}, results: []byte{wasmI32}, export: "f", body: []byte{0x20, 0, 0x28, 2, 0, 0x0B}}))
+	f.Add([]byte("\x00asm\x01\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if _, err := compileTestWASM(t, b); err != nil {
+			var we wasmError
+			if !errors.As(err, &we) && !errors.Is(err, errWASMRunTime) {
+				t.Errorf("expected a wasmError, got %v", err)
+			}
+		}
+	})
+}
+
+// FuzzRun tests that a score function with any body either is rejected or
+// runs to a result or an error within its time
+func FuzzRun(f *testing.F) {
+	f.Add([]byte{0x44, 0, 0, 0, 0, 0, 0, 0xF0, 0x3F, 0x0B}, 0.5)
+	f.Add([]byte{0x20, 2, 0x44, 0, 0, 0, 0, 0, 0, 0x59, 0x40, 0xA3, 0x0B}, 40.0)
+	f.Add([]byte{0x03, 0x40, 0x0C, 0, 0x0B, 0x00, 0x0B}, 0.0)
+	f.Add([]byte{0x10, 0, 0x0B}, 1.0)
+	f.Fuzz(func(t *testing.T, body []byte, arg float64) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		rt := newWASMRuntime(ctx)
+		defer rt.close()
+		m, err := rt.compile(buildWASM(1, testWASMFunc{params: wasmScoreType.params, results: wasmScoreType.results, export: "score", body: body}))
+		if err != nil {
+			return
+		}
+		score, err := m.export("score", wasmScoreType)
+		if err != nil {
+			t.Fatalf("expected the compiled score function, got %v", err)
+		}
+		x := math.Float64bits(arg)
+		results, err := m.run(score, x, x, x, x, 1)
+		if err == nil && len(results) != 1 {
+			t.Errorf("expected one result, got %v", results)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+// Demo page for the forecast API: looks up a point and renders the current
+// forecast and the next twelve hours.
+"use strict";
+
+const hoursShown = 12;
+
+function text(tag, value) {
+  const el = document.createElement(tag);
+  el.textContent = value;
+  return el;
+}
+
+async function getJSON(path, key) {
+  const headers = { Accept: "application/json" };
+  if (key) {
+    headers["X-API-Key"] = key;
+  }
+  const resp = await fetch(path, { headers });
+  if (!resp.ok) {
+    throw new Error((await resp.text()).trim() || resp.statusText);
+  }
+  return resp.json();
+}
+
+async function lookup(form) {
+  const status = document.getElementById("status");
+  const result = document.getElementById("result");
+  const query = new URLSearchParams({
+    latitude: form.latitude.value,
+    longitude: form.longitude.value,
+  });
+  status.textContent = "Loading…";
+  try {
+    const [forecast, hourly] = await Promise.all([
+      getJSON("/forecast?" + query, form.key.value),
+      getJSON("/forecast/hourly?" + query, form.key.value),
+    ]);
+
+    document.getElementById("summary").textContent = forecast.forecast;
+    const categories = document.getElementById("categories");
+    categories.replaceChildren();
+    for (const name of ["temperature", "wind", "precipitation"]) {
+      if (forecast[name]) {
+        categories.append(text("dt", name), text("dd", forecast[name]));
+      }
+    }
+
+    const hours = document.getElementById("hours");
+    hours.replaceChildren();
+    for (const p of hourly.periods.slice(0, hoursShown)) {
+      const row = document.createElement("tr");
+      const start = new Date(p.startTime);
+      row.append(
+        text("td", start.toLocaleTimeString([], { weekday: "short", hour: "numeric" })),
+        text("td", p.forecast),
+        text("td", Math.round(p.temperatureC) + "°C"),
+        text("td", p.windSpeedKph == null ? "–" : Math.round(p.windSpeedKph) + " km/h " + (p.windDirection || "")),
+        text("td", p.precipitationProbability == null ? "–" : p.precipitationProbability + "%"),
+      );
+      hours.append(row);
+    }
+    result.hidden = false;
+    status.textContent = "";
+  } catch (err) {
+    result.hidden = true;
+    status.textContent = err.message;
+  }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  const form = document.getElementById("lookup");
+  form.addEventListener("submit", (e) => {
+    e.preventDefault();
+    lookup(form);
+  });
+  document.getElementById("locate").addEventListener("click", () => {
+    navigator.geolocation.getCurrentPosition((pos) => {
+      form.latitude.value = pos.coords.latitude.toFixed(4);
+      form.longitude.value = pos.coords.longitude.toFixed(4);
+      lookup(form);
+    }, (err) => {
+      document.getElementById("status").textContent = err.message;
+    });
+  });
+});
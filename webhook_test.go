@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestDeliverWebhook tests that notifications are signed and failures reported
+func TestDeliverWebhook(t *testing.T) {
+	status := http.StatusNoContent
+	var received *http.Request
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer hook.Close()
+
+	sub := Subscription{ID: 7, WebhookURL: hook.URL, Secret: "s3cret"}
+	now := time.Unix(1717200000, 0)
+	if err := deliverWebhook(context.Background(), webhookClient, sub, nil, "test.event", []byte(`{"ok":true}`), "application/json", now); err != nil {
+		t.Fatalf("expected delivery, got %v", err)
+	}
+	if received.Header.Get("X-Forecast-Event") != "test.event" || received.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", received.Header)
+	}
+	timestamp, _ := strconv.ParseInt(received.Header.Get("X-Forecast-Timestamp"), 10, 64)
+	if timestamp != now.Unix() {
+		t.Errorf("expected timestamp %d, got %d", now.Unix(), timestamp)
+	}
+	if got, want := received.Header.Get("X-Forecast-Signature"), signWebhook("s3cret", timestamp, body); got != want {
+		t.Errorf("expected signature %s, got %s", want, got)
+	}
+	if signWebhook("other", timestamp, body) == signWebhook("s3cret", timestamp, body) {
+		t.Error("expected signatures to depend on the secret")
+	}
+
+	if received.Header.Get("traceparent") != "" {
+		t.Errorf("expected no traceparent without a trace, got %q", received.Header.Get("traceparent"))
+	}
+
+	// A delivery continues the trace of its context in a span of its own
+	trace := newTrace()
+	if err := deliverWebhook(withTrace(context.Background(), trace), webhookClient, sub, nil, "test.event", nil, "application/json", now); err != nil {
+		t.Fatalf("expected delivery, got %v", err)
+	}
+	sent, ok := parseTraceparent(received.Header.Get("traceparent"))
+	if !ok || sent.TraceID != trace.TraceID || sent.SpanID == trace.SpanID {
+		t.Errorf("expected a new span of trace %s, got %q", trace.TraceID, received.Header.Get("traceparent"))
+	}
+	if got := received.Header.Get("X-Request-ID"); got != trace.RequestID {
+		t.Errorf("expected request ID %s, got %q", trace.RequestID, got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := deliverWebhook(context.Background(), webhookClient, sub, nil, "test.event", nil, "application/json", now); err == nil {
+		t.Error("expected an error for a failed delivery")
+	}
+}
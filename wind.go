@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// windHorizonHours is how far ahead /wind forecasts
+	windHorizonHours = 48
+	// forecastWindHeightM is the height NWS forecasts wind speeds at
+	forecastWindHeightM = 10.0
+	// defaultWindShear is the power law exponent for open, level ground
+	defaultWindShear = 1.0 / 7
+	// defaultHubHeightM is a typical tower height for small turbines
+	defaultHubHeightM = 30.0
+)
+
+// turbineCurve is a generic power curve: nothing below the cut-in speed,
+// output rising with the cube of the speed up to the rated speed, rated output
+// up to the cut-out speed, and nothing beyond while the turbine shuts down to
+// protect itself. Speeds are in m/s.
+type turbineCurve struct {
+	RatedKW    float64 `json:"ratedKw"`
+	CutIn      float64 `json:"cutInMs"`
+	RatedSpeed float64 `json:"ratedSpeedMs"`
+	CutOut     float64 `json:"cutOutMs"`
+}
+
+// defaultTurbineCurve suits typical small horizontal-axis turbines
+var defaultTurbineCurve = turbineCurve{RatedKW: 1, CutIn: 3, RatedSpeed: 12, CutOut: 25}
+
+// output returns the power produced in kW at a hub height wind speed in m/s
+func (c turbineCurve) output(speed float64) float64 {
+	switch {
+	case speed < c.CutIn || speed >= c.CutOut:
+		return 0
+	case speed >= c.RatedSpeed:
+		return c.RatedKW
+	default:
+		return c.RatedKW * (math.Pow(speed, 3) - math.Pow(c.CutIn, 3)) / (math.Pow(c.RatedSpeed, 3) - math.Pow(c.CutIn, 3))
+	}
+}
+
+// windAtHeight adjusts a wind speed measured at forecastWindHeightM to
+// heightM with the power law
+func windAtHeight(speed, heightM, shear float64) float64 {
+	return speed * math.Pow(heightM/forecastWindHeightM, shear)
+}
+
+// windHour is one hour of the /wind response
+type windHour struct {
+	StartTime time.Time `json:"startTime"`
+	// WindSpeedKPH is the forecast at 10 m, and HubWindSpeedKPH its
+	// adjustment to hub height
+	WindSpeedKPH    float64 `json:"windSpeedKph"`
+	HubWindSpeedKPH float64 `json:"hubWindSpeedKph"`
+	OutputKW        float64 `json:"outputKw"`
+}
+
+// windResponse is the body of /wind
+type windResponse struct {
+	Latitude  float64      `json:"latitude"`
+	Longitude float64      `json:"longitude"`
+	HeightM   float64      `json:"heightM"`
+	Shear     float64      `json:"shear"`
+	Turbine   turbineCurve `json:"turbine"`
+	EnergyKWh float64      `json:"energyKwh"`
+	Hours     []windHour   `json:"hours"`
+}
+
+// windForecast estimates a turbine's average output for each hour from start
+// for which the grid forecasts wind, up to hours hours
+func windForecast(g gridData, heightM, shear float64, curve turbineCurve, start time.Time, hours int) []windHour {
+	var out []windHour
+	for h := range hours {
+		t := start.Add(time.Duration(h) * time.Hour)
+		speed, ok := g.WindSpeed.at(t)
+		if !ok {
+			continue
+		}
+		hub := windAtHeight(speed, heightM, shear)
+		out = append(out, windHour{
+			StartTime:       t.In(g.Location),
+			WindSpeedKPH:    roundTenth(speed),
+			HubWindSpeedKPH: roundTenth(hub),
+			OutputKW:        math.Round(curve.output(hub/3.6)*100) / 100,
+		})
+	}
+	return out
+}
+
+// parseWindParameter reads a positive number from the query, falling back to
+// def when the parameter is absent
+func parseWindParameter(r *http.Request, name string, def, limit float64) (float64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 || n > limit {
+		return 0, fmt.Errorf("Invalid %s parameter (want a number above 0 and at most %g)", name, limit)
+	}
+	return n, nil
+}
+
+// windHandler serves hub height wind speeds and the estimated output of a
+// small turbine over the next two days. ?height= sets the hub height in
+// metres, ?shear= the power law exponent for the terrain, and ?kw=, ?cutIn=,
+// ?ratedSpeed=, and ?cutOut= the turbine's power curve.
+func (s *server) windHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lat, lon, ok := s.requirePoint(w, r)
+	if !ok {
+		return
+	}
+	curve := defaultTurbineCurve
+	var height, shear float64
+	params := []struct {
+		name  string
+		value *float64
+		def   float64
+		limit float64
+	}{
+		{"height", &height, defaultHubHeightM, 200},
+		{"shear", &shear, defaultWindShear, 1},
+		{"kw", &curve.RatedKW, curve.RatedKW, 10000},
+		{"cutIn", &curve.CutIn, curve.CutIn, 50},
+		{"ratedSpeed", &curve.RatedSpeed, curve.RatedSpeed, 50},
+		{"cutOut", &curve.CutOut, curve.CutOut, 100},
+	}
+	for _, p := range params {
+		v, err := parseWindParameter(r, p.name, p.def, p.limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*p.value = v
+	}
+	if curve.CutIn >= curve.RatedSpeed || curve.RatedSpeed >= curve.CutOut {
+		http.Error(w, "Invalid turbine curve (want cutIn < ratedSpeed < cutOut)", http.StatusBadRequest)
+		return
+	}
+
+	data, statusCode, err := s.fetchGridData(r.Context(), lat, lon)
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	resp := windResponse{HeightM: height, Shear: shear, Turbine: curve}
+	resp.Latitude, resp.Longitude = parsePoint(lat, lon)
+	start := data.WindSpeed.forecastStart(s.clock.Now())
+	resp.Hours = windForecast(data, height, shear, curve, start, windHorizonHours)
+	for _, h := range resp.Hours {
+		resp.EnergyKWh += h.OutputKW
+	}
+	resp.EnergyKWh = roundTenth(resp.EnergyKWh)
+	if resp.Hours == nil {
+		resp.Hours = []windHour{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
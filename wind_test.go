@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestTurbineCurve tests output across the regions of the power curve
+func TestTurbineCurve(t *testing.T) {
+	curve := turbineCurve{RatedKW: 10, CutIn: 3, RatedSpeed: 12, CutOut: 25}
+	tests := []struct {
+		speed    float64
+		expected float64
+	}{
+		{speed: 0, expected: 0},
+		{speed: 2.9, expected: 0},
+		{speed: 3, expected: 0},
+		{speed: 7.5, expected: 10 * (7.5*7.5*7.5 - 27) / (1728 - 27)},
+		{speed: 12, expected: 10},
+		{speed: 24.9, expected: 10},
+		{speed: 25, expected: 0},
+	}
+	for _, tt := range tests {
+		if got := curve.output(tt.speed); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("%v m/s: expected %v kW, got %v kW", tt.speed, tt.expected, got)
+		}
+	}
+}
+
+// TestWindAtHeight tests the power law height adjustment
+func TestWindAtHeight(t *testing.T) {
+	if got := windAtHeight(20, forecastWindHeightM, defaultWindShear); got != 20 {
+		t.Errorf("expected no change at the forecast height, got %v", got)
+	}
+	// Doubling the height raises speeds by 2^(1/7), about 10%
+	if got := windAtHeight(20, 20, defaultWindShear); math.Abs(got-22.082) > 0.001 {
+		t.Errorf("expected 22.082 km/h, got %v", got)
+	}
+	if low, high := windAtHeight(20, 30, 0.1), windAtHeight(20, 30, 0.3); low >= high {
+		t.Errorf("expected rougher terrain to shear more, got %v and %v", low, high)
+	}
+}
+
+// TestWindForecast tests hourly hub height speeds and output
+func TestWindForecast(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	g := gridData{
+		Location: time.UTC,
+		WindSpeed: gridSeries{
+			{Start: start, Duration: 2 * time.Hour, Value: 36},
+			{Start: start.Add(3 * time.Hour), Duration: time.Hour, Value: 5},
+		},
+	}
+	hours := windForecast(g, 10, defaultWindShear, defaultTurbineCurve, start, 48)
+	if len(hours) != 3 {
+		t.Fatalf("expected an hour for each hour of wind, got %d", len(hours))
+	}
+	// 36 km/h is 10 m/s
+	expected := math.Round(defaultTurbineCurve.output(10)*100) / 100
+	if hours[0].WindSpeedKPH != 36 || hours[0].HubWindSpeedKPH != 36 || hours[0].OutputKW != expected {
+		t.Errorf("unexpected hour %+v", hours[0])
+	}
+	if !hours[2].StartTime.Equal(start.Add(3*time.Hour)) || hours[2].OutputKW != 0 {
+		t.Errorf("expected no output below cut-in, got %+v", hours[2])
+	}
+}
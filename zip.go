@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// centroid is the point a ZIP code or county is forecast for
+type centroid struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// validZIP reports whether zip is a five-digit ZIP code
+func validZIP(zip string) bool {
+	if len(zip) != 5 {
+		return false
+	}
+	for _, c := range zip {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// centroidColumn returns the column of a header naming one of names, or -1
+func centroidColumn(header []string, names ...string) int {
+	for i, h := range header {
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// loadZIPCentroids returns the centroids of a CSV or tab-separated file with
+// a header naming its ZIP code, latitude, and longitude columns, such as the
+// Census Bureau's ZCTA gazetteer file, or none when path is empty
+func loadZIPCentroids(path string) (map[string]centroid, error) {
+	return loadCentroids(path, "ZIP", []string{"zip", "zipcode", "zcta", "zcta5", "geoid"}, validZIP)
+}
+
+// loadCentroids returns the centroids of a CSV or tab-separated file of the
+// codes of a kind, such as a Census Bureau gazetteer file, whose header names
+// its code column by one of codeNames, or none when path is empty
+func loadCentroids(path, kind string, codeNames []string, valid func(string) bool) (map[string]centroid, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s file: %v", kind, err)
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	if first, _ := bufio.NewReader(bytes.NewReader(data)).ReadString('\n'); strings.Contains(first, "\t") {
+		cr.Comma = '\t'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s file %s: %v", kind, path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s file %s: empty", kind, path)
+	}
+	codeCol := centroidColumn(records[0], codeNames...)
+	latCol := centroidColumn(records[0], "latitude", "lat", "intptlat")
+	lonCol := centroidColumn(records[0], "longitude", "lon", "lng", "intptlong")
+	if codeCol < 0 || latCol < 0 || lonCol < 0 {
+		return nil, fmt.Errorf("%s file %s: header must name %s, latitude, and longitude columns", kind, path, codeNames[0])
+	}
+
+	centroids := make(map[string]centroid, len(records)-1)
+	for i, record := range records[1:] {
+		if len(record) <= max(codeCol, latCol, lonCol) {
+			return nil, fmt.Errorf("%s file %s: line %d: missing columns", kind, path, i+2)
+		}
+		code := strings.TrimSpace(record[codeCol])
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[latCol]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[lonCol]), 64)
+		if !valid(code) || latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("%s file %s: line %d: invalid %s code or point", kind, path, i+2, kind)
+		}
+		centroids[code] = centroid{Latitude: lat, Longitude: lon}
+	}
+	return centroids, nil
+}
+
+// zipCentroids returns the centroids of the configured ZIP file, nil when ZIP
+// lookup is disabled
+func (s *server) zipCentroids() map[string]centroid {
+	if c := s.zips.Load(); c != nil {
+		return *c
+	}
+	return nil
+}
+
+// zipPoint resolves the ZIP code of a request's zip parameter to its
+// centroid, writing the error response and returning false when it can't,
+// including when there's no ZIP file to look it up in
+func (s *server) zipPoint(w http.ResponseWriter, zip string) (lat, lon string, ok bool) {
+	if s.zipCentroids() == nil {
+		http.Error(w, "ZIP code lookup isn't enabled on this server (use latitude and longitude)", http.StatusBadRequest)
+		return "", "", false
+	}
+	// ZIP+4 codes are forecast for their five-digit ZIP code
+	if base, plus4, found := strings.Cut(zip, "-"); found && len(plus4) == 4 && validZIP(plus4+"0") {
+		zip = base
+	}
+	if !validZIP(zip) {
+		http.Error(w, "Invalid zip parameter (want a five-digit ZIP code)", http.StatusBadRequest)
+		return "", "", false
+	}
+	c, found := s.zipCentroids()[zip]
+	if !found {
+		http.Error(w, fmt.Sprintf("ZIP code %s not found", zip), http.StatusNotFound)
+		return "", "", false
+	}
+	return strconv.FormatFloat(c.Latitude, 'f', 4, 64), strconv.FormatFloat(c.Longitude, 'f', 4, 64), true
+}
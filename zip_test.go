@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadZIPCentroids tests reading ZIP code centroids from CSV and from the
+// Census gazetteer's tab-separated format
+func TestLoadZIPCentroids(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected map[string]centroid
+		err      bool
+	}{
+		{
+			name:     "csv",
+			contents: "zip,latitude,longitude\n98101,47.6114,-122.3305\n83702,43.6323,-116.2050\n",
+			expected: map[string]centroid{"98101": {47.6114, -122.3305}, "83702": {43.6323, -116.2050}},
+		},
+		{
+			name:     "gazetteer",
+			contents: "GEOID\tALAND\tAWATER\tALAND_SQMI\tAWATER_SQMI\tINTPTLAT\tINTPTLONG                                                                                                               \n98101\t1436215\t0\t0.555\t0.000\t47.611435\t-122.330456                                                \n",
+			expected: map[string]centroid{"98101": {47.611435, -122.330456}},
+		},
+		{name: "no header", contents: "98101,47.6114,-122.3305\n", err: true},
+		{name: "short ZIP code", contents: "zip,lat,lon\n9810,47.6114,-122.3305\n", err: true},
+		{name: "invalid point", contents: "zip,lat,lon\n98101,north,-122.3305\n", err: true},
+		{name: "empty", contents: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "zips.txt")
+			if err := os.WriteFile(file, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			centroids, err := loadZIPCentroids(file)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", centroids)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(centroids) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, centroids)
+			}
+			for zip, c := range tt.expected {
+				if centroids[zip] != c {
+					t.Errorf("expected %s at %v, got %v", zip, c, centroids[zip])
+				}
+			}
+		})
+	}
+}
+
+// TestZIPForecast tests forecasts for a ZIP code given as zip
+func TestZIPForecast(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		disabled       bool
+		expectedStatus int
+		expectedPoint  string
+		expectedBody   string
+	}{
+		{name: "ZIP code", path: "/forecast?zip=98101", expectedStatus: http.StatusOK, expectedPoint: "/points/47.6114,-122.3305"},
+		{name: "ZIP+4", path: "/forecast?zip=98101-3143", expectedStatus: http.StatusOK, expectedPoint: "/points/47.6114,-122.3305"},
+		{name: "coordinates win", path: "/forecast?zip=98101&latitude=43.6323&longitude=-116.2050", expectedStatus: http.StatusOK, expectedPoint: "/points/43.6323,-116.2050"},
+		{name: "unknown", path: "/forecast?zip=00000", expectedStatus: http.StatusNotFound, expectedBody: "ZIP code 00000 not found"},
+		{name: "invalid", path: "/forecast?zip=seattle", expectedStatus: http.StatusBadRequest},
+		{name: "disabled", path: "/forecast?zip=98101", disabled: true, expectedStatus: http.StatusBadRequest, expectedBody: "ZIP code lookup isn't enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(Config{NWSAPIHost: fakeNWSHost})
+			nws := newFakeNWSDoer(fakeResponse{body: `{"properties": {"periods": [{"temperature": 65, "shortForecast": "Sunny"}]}}`})
+			srv.nws = nws
+			if !tt.disabled {
+				srv.zips.Store(&map[string]centroid{"98101": {47.6114, -122.3305}})
+			}
+			w := httptest.NewRecorder()
+			srv.routes().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedPoint != "" && nws.paths()[0] != tt.expectedPoint {
+				t.Errorf("expected %s to be looked up, got %v", tt.expectedPoint, nws.paths())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}